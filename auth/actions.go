@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+)
+
+// ResourceActions maps resource types to the actions that are valid for them.
+//
+// Resource types missing from the map accept any action.
+type ResourceActions map[string][]string
+
+// DefaultResourceActions contains the action vocabularies defined by the [Token Scope documentation].
+//
+// [Token Scope documentation]: https://github.com/distribution/distribution/blob/main/docs/spec/auth/scope.md
+var DefaultResourceActions = ResourceActions{
+	"repository": {"pull", "push", "delete", "*"},
+	"registry":   {"*"},
+}
+
+// ValidateScope checks that every action in scope is valid for its resource type.
+//
+// ValidateScope returns an ErrInvalidScope error otherwise.
+func (a ResourceActions) ValidateScope(scope Scope) error {
+	validActions, ok := a[scope.Type]
+	if !ok {
+		return nil
+	}
+
+	for _, action := range scope.Actions {
+		if !slices.Contains(validActions, action) {
+			return fmt.Errorf("%w: action %q is not valid for resource type %q", ErrInvalidScope, action, scope.Type)
+		}
+	}
+
+	return nil
+}
+
+// ValidateScopes calls ValidateScope for each scope in the list.
+func (a ResourceActions) ValidateScopes(scopes []Scope) error {
+	for _, scope := range scopes {
+		if err := a.ValidateScope(scope); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ScopeLimits normalizes requested scopes and checks them against the limits of a transport.
+//
+// Transports (eg. TokenServer) share it to enforce the same limits on every request.
+type ScopeLimits struct {
+	// ResourceActions restricts the actions clients may request for each resource type.
+	// Defaults to DefaultResourceActions.
+	ResourceActions ResourceActions
+
+	// MaxScopes rejects requests listing more scopes than this (zero means no limit).
+	MaxScopes int
+
+	// MaxActionsPerScope rejects requests with a scope listing more actions than this (zero means no limit).
+	MaxActionsPerScope int
+
+	// RegistryHosts are stripped from repository names in requested scopes (see StripRegistryHost).
+	RegistryHosts []string
+}
+
+// CheckScopes normalizes scopes (see RegistryHosts) and checks them against ResourceActions, MaxScopes and MaxActionsPerScope.
+//
+// CheckScopes returns an ErrInvalidScope error if any of the checks fail.
+func (l ScopeLimits) CheckScopes(scopes []Scope) ([]Scope, error) {
+	if l.MaxScopes > 0 && len(scopes) > l.MaxScopes {
+		return nil, fmt.Errorf("%w: more than %d scopes requested", ErrInvalidScope, l.MaxScopes)
+	}
+
+	scopes = StripRegistryHost(scopes, l.RegistryHosts)
+
+	if l.MaxActionsPerScope > 0 {
+		for _, scope := range scopes {
+			if len(scope.Actions) > l.MaxActionsPerScope {
+				return nil, fmt.Errorf("%w: %s requests more than %d actions", ErrInvalidScope, scope.Resource, l.MaxActionsPerScope)
+			}
+		}
+	}
+
+	resourceActions := l.ResourceActions
+	if resourceActions == nil {
+		resourceActions = DefaultResourceActions
+	}
+
+	if err := resourceActions.ValidateScopes(scopes); err != nil {
+		return nil, err
+	}
+
+	return scopes, nil
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"net/http"
+)
+
+// AdminMiddleware restricts access to administrative endpoints to subjects authenticated using basic auth
+// that have every attribute in subjectAttributes (with the exact values).
+//
+// Unauthenticated requests are rejected with 401 Unauthorized, other subjects with 403 Forbidden.
+// If subjectAttributes is empty, every request is rejected.
+func AdminMiddleware(authenticator PasswordAuthenticator, subjectAttributes map[string]string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			username, password, ok := r.BasicAuth()
+			if !ok || username == "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="admin"`)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+				return
+			}
+
+			subject, err := authenticator.AuthenticatePassword(r.Context(), username, password)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Basic realm="admin"`)
+				status, response := errorFor(err)
+				writeError(w, status, response)
+
+				return
+			}
+
+			if !isAdmin(subject, subjectAttributes) {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func isAdmin(subject Subject, subjectAttributes map[string]string) bool {
+	if subject == nil || len(subjectAttributes) == 0 {
+		return false
+	}
+
+	for key, value := range subjectAttributes {
+		if v, ok := subject.Attribute(key); !ok || v != value {
+			return false
+		}
+	}
+
+	return true
+}
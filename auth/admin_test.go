@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminMiddleware(t *testing.T) {
+	authenticator := passwordAuthenticatorStub{
+		subjects: map[string]Subject{
+			"admin": subjectStub{id: "admin", attrs: map[string]string{"role": "admin"}},
+			"user":  subjectStub{id: "user"},
+		},
+	}
+
+	handler := AdminMiddleware(authenticator, map[string]string{"role": "admin"})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	testCases := []struct {
+		name           string
+		username       string
+		expectedStatus int
+	}{
+		{
+			name:           "Admin",
+			username:       "admin",
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "NotAdmin",
+			username:       "user",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "UnknownUser",
+			username:       "unknown",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Anonymous",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/rules", nil)
+
+			if testCase.username != "" {
+				req.SetBasicAuth(testCase.username, "password")
+			}
+
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, testCase.expectedStatus, rec.Code)
+		})
+	}
+}
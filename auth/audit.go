@@ -0,0 +1,489 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Audit event operations.
+const (
+	AuditOperationToken      = "token"
+	AuditOperationOAuth2     = "oauth2"
+	AuditOperationBatchToken = "batch_token"
+	AuditOperationBreakGlass = "break_glass"
+)
+
+// AuditSeverity indicates how much attention an audit event deserves.
+type AuditSeverity int
+
+// Audit event severities.
+const (
+	// AuditSeverityNormal is the severity of routine events (eg. token requests).
+	AuditSeverityNormal AuditSeverity = iota
+
+	// AuditSeverityHigh is the severity of events that should be reviewed (eg. the use of a break-glass credential).
+	AuditSeverityHigh
+)
+
+// String implements [fmt.Stringer].
+func (s AuditSeverity) String() string {
+	switch s {
+	case AuditSeverityNormal:
+		return "normal"
+
+	case AuditSeverityHigh:
+		return "high"
+	}
+
+	return "unknown"
+}
+
+// Authentication failure causes recorded in audit events.
+const (
+	AuditCauseInvalidCredentials   = "invalid_credentials"
+	AuditCauseAccountDisabled      = "account_disabled"
+	AuditCauseAuthenticationFailed = "authentication_failed"
+	AuditCauseBackendError         = "backend_error"
+)
+
+// AuditEvent records the outcome of a token request.
+//
+// Unlike regular logs, audit events always contain the real (unhashed) subject identifier.
+type AuditEvent struct {
+	Time      time.Time
+	RequestID string
+	Operation string
+	Severity  AuditSeverity
+
+	ClientID  string
+	Service   string
+	GrantType string
+
+	AuthenticationMethod string
+	Subject              SubjectID
+
+	RequestedScopes Scopes
+	GrantedScopes   Scopes
+
+	// Reasons explain the authorization decisions (eg. the names of the deciding rules).
+	Reasons []AuthorizationReason
+
+	Success bool
+	Error   string
+
+	// Cause classifies authentication failures (see the AuditCause constants).
+	// It is empty if authentication succeeded or did not take place.
+	Cause string
+
+	// TokenFingerprints are the fingerprints of the issued access tokens (see [TokenFingerprint]).
+	// They are only recorded if enabled in AuditTokenService.
+	TokenFingerprints []string
+
+	// Signature is a hex encoded HMAC-SHA256 of the other fields (see [SignAuditEvent]).
+	// It is empty unless events are signed by a [SigningAuditLogger].
+	Signature string
+}
+
+// AuditLogger records audit events.
+type AuditLogger interface {
+	LogAuditEvent(ctx context.Context, event AuditEvent)
+}
+
+// SlogAuditLogger is an AuditLogger writing events to a [slog.Logger].
+type SlogAuditLogger struct {
+	Logger *slog.Logger
+}
+
+// LogAuditEvent implements AuditLogger.
+func (l SlogAuditLogger) LogAuditEvent(ctx context.Context, event AuditEvent) {
+	level := slog.LevelInfo
+
+	if event.Severity >= AuditSeverityHigh {
+		level = slog.LevelWarn
+	}
+
+	l.Logger.LogAttrs(
+		ctx,
+		level,
+		"audit",
+		slog.Time("time", event.Time),
+		slog.String("request_id", event.RequestID),
+		slog.String("operation", event.Operation),
+		slog.String("severity", event.Severity.String()),
+		slog.String("client_id", event.ClientID),
+		slog.String("service", event.Service),
+		slog.String("grant_type", event.GrantType),
+		slog.String("authentication_method", event.AuthenticationMethod),
+		slog.String("subject", string(event.Subject)),
+		slog.String("requested_scopes", event.RequestedScopes.String()),
+		slog.String("granted_scopes", event.GrantedScopes.String()),
+		slog.Any("reasons", event.Reasons),
+		slog.Bool("success", event.Success),
+		slog.String("error", event.Error),
+		slog.String("cause", event.Cause),
+		slog.String("token_fingerprints", strings.Join(event.TokenFingerprints, ",")),
+		slog.String("signature", event.Signature),
+	)
+}
+
+// SigningAuditLogger signs audit events before passing them to another AuditLogger,
+// making it possible to detect events that were modified (or forged) after they were logged.
+type SigningAuditLogger struct {
+	AuditLogger AuditLogger
+
+	// Key is the HMAC key. It should be dedicated to signing audit events.
+	Key []byte
+}
+
+// LogAuditEvent implements AuditLogger.
+func (l SigningAuditLogger) LogAuditEvent(ctx context.Context, event AuditEvent) {
+	event.Signature = SignAuditEvent(event, l.Key)
+
+	l.AuditLogger.LogAuditEvent(ctx, event)
+}
+
+// SignAuditEvent returns the hex encoded HMAC-SHA256 of an audit event (ignoring its Signature).
+//
+// The MAC is computed over the JSON encoding of an object with the same fields (and values) as the ones logged by [SlogAuditLogger],
+// in the same order, except signature. The time is formatted as RFC 3339 (with nanoseconds) in UTC.
+// Token fingerprints are omitted if there are none, so that signatures of events recorded before they were introduced remain valid.
+func SignAuditEvent(event AuditEvent, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(auditEventSigningPayload(event))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyAuditEvent reports whether the Signature of an audit event is valid.
+func VerifyAuditEvent(event AuditEvent, key []byte) bool {
+	signature, err := hex.DecodeString(event.Signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(auditEventSigningPayload(event))
+
+	return hmac.Equal(signature, mac.Sum(nil))
+}
+
+func auditEventSigningPayload(event AuditEvent) []byte {
+	reasons := event.Reasons
+	if reasons == nil {
+		reasons = []AuthorizationReason{}
+	}
+
+	payload := struct {
+		Time                 string                `json:"time"`
+		RequestID            string                `json:"request_id"`
+		Operation            string                `json:"operation"`
+		Severity             string                `json:"severity"`
+		ClientID             string                `json:"client_id"`
+		Service              string                `json:"service"`
+		GrantType            string                `json:"grant_type"`
+		AuthenticationMethod string                `json:"authentication_method"`
+		Subject              string                `json:"subject"`
+		RequestedScopes      string                `json:"requested_scopes"`
+		GrantedScopes        string                `json:"granted_scopes"`
+		Reasons              []AuthorizationReason `json:"reasons"`
+		Success              bool                  `json:"success"`
+		Error                string                `json:"error"`
+		Cause                string                `json:"cause"`
+		TokenFingerprints    string                `json:"token_fingerprints,omitempty"`
+	}{
+		Time:                 event.Time.UTC().Format(time.RFC3339Nano),
+		RequestID:            event.RequestID,
+		Operation:            event.Operation,
+		Severity:             event.Severity.String(),
+		ClientID:             event.ClientID,
+		Service:              event.Service,
+		GrantType:            event.GrantType,
+		AuthenticationMethod: event.AuthenticationMethod,
+		Subject:              string(event.Subject),
+		RequestedScopes:      event.RequestedScopes.String(),
+		GrantedScopes:        event.GrantedScopes.String(),
+		Reasons:              reasons,
+		Success:              event.Success,
+		Error:                event.Error,
+		Cause:                event.Cause,
+		TokenFingerprints:    strings.Join(event.TokenFingerprints, ","),
+	}
+
+	// Marshaling strings, booleans and AuthorizationReasons cannot fail
+	b, _ := json.Marshal(payload)
+
+	return b
+}
+
+// AuditTokenService acts as a middleware for a TokenService and records an audit event for every request.
+type AuditTokenService struct {
+	Service     TokenService
+	AuditLogger AuditLogger
+
+	// AuthenticationFailureCause maps authentication errors to the cause recorded in audit events.
+	// Defaults to [AuthenticationFailureCause].
+	//
+	// Use it to classify errors returned by custom authenticators.
+	AuthenticationFailureCause func(err error) string
+
+	// SampleRates maps actions (eg. pull) to the fraction (between 0 and 1) of successful requests audited.
+	// A request is sampled at the highest rate of the actions it requests,
+	// so requests including an action missing from SampleRates (eg. push) are always audited.
+	// Failed requests and requests without scopes are always audited.
+	//
+	// For example, {"pull": 0.1} audits every write but only one in ten successful pulls.
+	SampleRates map[string]float64
+
+	// TokenFingerprints records the fingerprints of issued access tokens (see [TokenFingerprint]),
+	// so that a token seen by the registry can be correlated with the event of its issuance.
+	TokenFingerprints bool
+
+	Dependencies Dependencies
+}
+
+// AuthenticationFailureCause classifies an authentication error based on the typed authentication errors.
+//
+// Errors other than ErrAuthenticationFailed (eg. connection problems) are classified as backend errors.
+func AuthenticationFailureCause(err error) string {
+	switch {
+	case errors.Is(err, ErrAccountDisabled):
+		return AuditCauseAccountDisabled
+
+	case errors.Is(err, ErrInvalidCredentials):
+		return AuditCauseInvalidCredentials
+
+	case errors.Is(err, ErrAuthenticationFailed):
+		return AuditCauseAuthenticationFailed
+	}
+
+	return AuditCauseBackendError
+}
+
+// TokenHandler implements TokenService and records an audit event for every request.
+func (s AuditTokenService) TokenHandler(ctx context.Context, r TokenRequest) (TokenResponse, error) {
+	ctx, record := contextWithTokenRequestRecord(ctx)
+
+	resp, err := s.Service.TokenHandler(ctx, r)
+
+	s.logAuditEvent(ctx, record, AuditEvent{
+		Operation:            AuditOperationToken,
+		ClientID:             r.ClientID,
+		Service:              r.Service,
+		AuthenticationMethod: r.AuthenticationMethod(),
+		RequestedScopes:      r.Scopes,
+	}, err)
+
+	return resp, err
+}
+
+// OAuth2Handler implements TokenService and records an audit event for every request.
+func (s AuditTokenService) OAuth2Handler(ctx context.Context, r OAuth2Request) (OAuth2Response, error) {
+	ctx, record := contextWithTokenRequestRecord(ctx)
+
+	resp, err := s.Service.OAuth2Handler(ctx, r)
+
+	s.logAuditEvent(ctx, record, AuditEvent{
+		Operation:            AuditOperationOAuth2,
+		ClientID:             r.ClientID,
+		Service:              r.Service,
+		GrantType:            r.GrantType,
+		AuthenticationMethod: r.AuthenticationMethod(),
+		RequestedScopes:      r.Scopes,
+	}, err)
+
+	return resp, err
+}
+
+func (s AuditTokenService) logAuditEvent(ctx context.Context, record *tokenRequestRecord, event AuditEvent, err error) {
+	if err == nil && !s.sample(event.RequestedScopes) {
+		return
+	}
+
+	event.Time = s.Dependencies.GetClock().Now()
+	event.RequestID = RequestIDFromContext(ctx)
+	event.GrantedScopes = record.grantedScopes
+	event.Reasons = record.reasons
+	event.Success = err == nil
+
+	if record.subject != nil {
+		event.Subject = record.subject.ID()
+	}
+
+	if s.TokenFingerprints {
+		for _, id := range record.issuedTokenIDs {
+			event.TokenFingerprints = append(event.TokenFingerprints, TokenFingerprint(id))
+		}
+	}
+
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	if record.authenticationErr != nil {
+		classify := s.AuthenticationFailureCause
+		if classify == nil {
+			classify = AuthenticationFailureCause
+		}
+
+		event.Cause = classify(record.authenticationErr)
+	}
+
+	s.AuditLogger.LogAuditEvent(ctx, event)
+}
+
+// sample decides whether a successful request for scopes is audited according to SampleRates.
+func (s AuditTokenService) sample(scopes []Scope) bool {
+	if len(s.SampleRates) == 0 {
+		return true
+	}
+
+	var (
+		rate       float64
+		hasActions bool
+	)
+
+	for _, scope := range scopes {
+		for _, action := range scope.Actions {
+			hasActions = true
+
+			actionRate, ok := s.SampleRates[action]
+			if !ok {
+				return true
+			}
+
+			rate = max(rate, actionRate)
+		}
+	}
+
+	if !hasActions || rate >= 1 {
+		return true
+	}
+
+	if rate <= 0 {
+		return false
+	}
+
+	var b [8]byte
+
+	if _, err := io.ReadFull(s.Dependencies.GetRand(), b[:]); err != nil {
+		// Err on the side of auditing
+		return true
+	}
+
+	// Uniformly distributed in [0, 1)
+	return float64(binary.BigEndian.Uint64(b[:])>>11)/(1<<53) < rate
+}
+
+// TokenFingerprint returns a non-reversible fingerprint of a token ID (eg. the "jti" claim of a JWT):
+// the hex encoded SHA-256 hash of the ID.
+func TokenFingerprint(id string) string {
+	sum := sha256.Sum256([]byte(id))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// HashSubjectID returns a salted SHA-256 hash of a SubjectID (hex encoded).
+//
+// It allows correlating log entries belonging to the same subject without revealing its identity.
+func HashSubjectID(id SubjectID, salt []byte) string {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(id))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// tokenRequestRecord collects information about a token request while TokenServiceImpl processes it,
+// so that middlewares (eg. AuditTokenService) can access it.
+type tokenRequestRecord struct {
+	subject           Subject
+	grantedScopes     []Scope
+	authenticationErr error
+	reasons           []AuthorizationReason
+
+	// authorized is true if the authorizer made a decision (even if it granted nothing).
+	authorized bool
+
+	issuedTokenIDs []string
+}
+
+type tokenRequestRecordContextKey struct{}
+
+// contextWithTokenRequestRecord returns a copy of ctx carrying a tokenRequestRecord.
+// If ctx already carries one, it is returned instead, so that every middleware shares the same record.
+func contextWithTokenRequestRecord(ctx context.Context) (context.Context, *tokenRequestRecord) {
+	if record := tokenRequestRecordFromContext(ctx); record != nil {
+		return ctx, record
+	}
+
+	record := &tokenRequestRecord{}
+
+	return context.WithValue(ctx, tokenRequestRecordContextKey{}, record), record
+}
+
+func tokenRequestRecordFromContext(ctx context.Context) *tokenRequestRecord {
+	record, _ := ctx.Value(tokenRequestRecordContextKey{}).(*tokenRequestRecord)
+
+	return record
+}
+
+func recordSubject(ctx context.Context, subject Subject) {
+	if record := tokenRequestRecordFromContext(ctx); record != nil {
+		record.subject = subject
+	}
+}
+
+func recordAuthenticationError(ctx context.Context, err error) {
+	if record := tokenRequestRecordFromContext(ctx); record != nil {
+		record.authenticationErr = err
+	}
+}
+
+// AuthorizationReason explains the authorization decision about a resource (eg. the name of the deciding rule).
+type AuthorizationReason struct {
+	Resource Resource `json:"resource"`
+	Reason   string   `json:"reason"`
+}
+
+// String implements [fmt.Stringer].
+func (r AuthorizationReason) String() string {
+	return r.Resource.String() + ": " + r.Reason
+}
+
+// RecordAuthorizationReason records why access to a resource was decided the way it was.
+//
+// Authorizers may call it, so that the reason shows up in audit events and permission listings.
+func RecordAuthorizationReason(ctx context.Context, resource Resource, reason string) {
+	if record := tokenRequestRecordFromContext(ctx); record != nil {
+		record.reasons = append(record.reasons, AuthorizationReason{
+			Resource: resource,
+			Reason:   reason,
+		})
+	}
+}
+
+func recordIssuedAccessToken(ctx context.Context, token AccessToken) {
+	if token.ID == "" {
+		return
+	}
+
+	if record := tokenRequestRecordFromContext(ctx); record != nil {
+		record.issuedTokenIDs = append(record.issuedTokenIDs, token.ID)
+	}
+}
+
+func recordGrantedScopes(ctx context.Context, grantedScopes []Scope) {
+	if record := tokenRequestRecordFromContext(ctx); record != nil {
+		record.grantedScopes = append(record.grantedScopes, grantedScopes...)
+		record.authorized = true
+	}
+}
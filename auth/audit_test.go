@@ -0,0 +1,573 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type auditLoggerStub struct {
+	events *[]AuditEvent
+}
+
+func (l auditLoggerStub) LogAuditEvent(_ context.Context, event AuditEvent) {
+	*l.events = append(*l.events, event)
+}
+
+func TestHashSubjectID(t *testing.T) {
+	hash := HashSubjectID("user", []byte("salt"))
+
+	assert.Len(t, hash, 64)
+	assert.Equal(t, hash, HashSubjectID("user", []byte("salt")))
+	assert.NotEqual(t, hash, HashSubjectID("user", []byte("other salt")))
+	assert.NotEqual(t, hash, HashSubjectID("other user", []byte("salt")))
+}
+
+func TestLoggerTokenService_HashSubjectIDs(t *testing.T) {
+	var buf bytes.Buffer
+	var events []AuditEvent
+
+	salt := []byte("salt")
+
+	service := LoggerTokenService{
+		Service: AuditTokenService{
+			Service:     newTokenServiceStub(),
+			AuditLogger: auditLoggerStub{&events},
+		},
+		Logger:          slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		HashSubjectIDs:  true,
+		SubjectHashSalt: salt,
+	}
+
+	_, err := service.OAuth2Handler(context.Background(), OAuth2Request{
+		GrantType:    GrantTypeRefreshToken,
+		Service:      "service.example.com",
+		ClientID:     "client",
+		RefreshToken: "refresh:user",
+		Scopes: Scopes{
+			{
+				Resource: Resource{
+					Type: "repository",
+					Name: "foo",
+				},
+				Actions: []string{"pull"},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	var record map[string]any
+
+	err = json.Unmarshal(buf.Bytes(), &record)
+	require.NoError(t, err)
+
+	assert.Equal(t, HashSubjectID("user", salt), record["subject"])
+	assert.NotContains(t, buf.String(), `"user"`)
+
+	require.Len(t, events, 1)
+
+	assert.Equal(t, SubjectID("user"), events[0].Subject)
+	assert.Equal(t, AuditOperationOAuth2, events[0].Operation)
+	assert.Equal(t, AuthenticationMethodRefreshToken, events[0].AuthenticationMethod)
+	assert.Equal(t, "repository:foo:pull", events[0].GrantedScopes.String())
+	assert.True(t, events[0].Success)
+}
+
+func TestLoggerTokenService_RequestID(t *testing.T) {
+	var buf bytes.Buffer
+
+	service := LoggerTokenService{
+		Service: newTokenServiceStub(),
+		Logger:  slog.New(slog.NewJSONHandler(&buf, nil)),
+	}
+
+	ctx := ContextWithRequestID(context.Background(), "request-1")
+
+	_, err := service.TokenHandler(ctx, TokenRequest{
+		Service:  "service.example.com",
+		Username: "user",
+		Password: "password",
+	})
+	require.NoError(t, err)
+
+	var record map[string]any
+
+	err = json.Unmarshal(buf.Bytes(), &record)
+	require.NoError(t, err)
+
+	assert.Equal(t, "request-1", record["request_id"])
+}
+
+// leakyAuthenticator rejects every credential with an error message containing the credential.
+type leakyAuthenticator struct{}
+
+func (leakyAuthenticator) AuthenticatePassword(_ context.Context, _ string, password string) (Subject, error) {
+	return nil, fmt.Errorf("%w: password %q does not match", ErrInvalidCredentials, password)
+}
+
+func (leakyAuthenticator) AuthenticateRefreshToken(_ context.Context, _ string, refreshToken string) (Subject, error) {
+	return nil, fmt.Errorf("%w: unknown refresh token %s", ErrAuthenticationFailed, refreshToken)
+}
+
+func (leakyAuthenticator) AuthenticateBearerToken(_ context.Context, token string) (Subject, error) {
+	return nil, fmt.Errorf("%w: malformed token %s", ErrAuthenticationFailed, token)
+}
+
+func TestLoggerTokenService_Redaction(t *testing.T) {
+	const secret = "s3cr3t-credential"
+
+	newService := func(buf *bytes.Buffer, logUsernames bool) LoggerTokenService {
+		stub := newTokenServiceStub()
+		stub.Authenticator = Authenticator{
+			PasswordAuthenticator:     leakyAuthenticator{},
+			RefreshTokenAuthenticator: leakyAuthenticator{},
+			BearerTokenAuthenticator:  leakyAuthenticator{},
+		}
+
+		return LoggerTokenService{
+			Service:      stub,
+			Logger:       slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+			LogUsernames: logUsernames,
+		}
+	}
+
+	testCases := []struct {
+		name    string
+		request func(service LoggerTokenService) error
+		reason  string
+	}{
+		{
+			name: "Password",
+			request: func(service LoggerTokenService) error {
+				_, err := service.TokenHandler(context.Background(), TokenRequest{
+					Service:  "service.example.com",
+					Username: "user",
+					Password: secret,
+				})
+
+				return err
+			},
+			reason: AuditCauseInvalidCredentials,
+		},
+		{
+			name: "BearerToken",
+			request: func(service LoggerTokenService) error {
+				_, err := service.TokenHandler(context.Background(), TokenRequest{
+					Service:     "service.example.com",
+					BearerToken: secret,
+				})
+
+				return err
+			},
+			reason: AuditCauseAuthenticationFailed,
+		},
+		{
+			name: "PasswordGrant",
+			request: func(service LoggerTokenService) error {
+				_, err := service.OAuth2Handler(context.Background(), OAuth2Request{
+					GrantType: GrantTypePassword,
+					Service:   "service.example.com",
+					ClientID:  "client",
+					Username:  "user",
+					Password:  secret,
+				})
+
+				return err
+			},
+			reason: AuditCauseInvalidCredentials,
+		},
+		{
+			name: "RefreshTokenGrant",
+			request: func(service LoggerTokenService) error {
+				_, err := service.OAuth2Handler(context.Background(), OAuth2Request{
+					GrantType:    GrantTypeRefreshToken,
+					Service:      "service.example.com",
+					ClientID:     "client",
+					RefreshToken: secret,
+				})
+
+				return err
+			},
+			reason: AuditCauseAuthenticationFailed,
+		},
+		{
+			name: "BatchToken",
+			request: func(service LoggerTokenService) error {
+				_, err := service.BatchTokenHandler(context.Background(), BatchTokenRequest{
+					Service:  "service.example.com",
+					Username: "user",
+					Password: secret,
+					Entries:  []BatchTokenRequestEntry{{}},
+				})
+
+				return err
+			},
+			reason: AuditCauseInvalidCredentials,
+		},
+		{
+			name: "Permissions",
+			request: func(service LoggerTokenService) error {
+				_, err := service.PermissionsHandler(context.Background(), PermissionsRequest{
+					Service:  "service.example.com",
+					Username: "user",
+					Password: secret,
+				})
+
+				return err
+			},
+			reason: AuditCauseInvalidCredentials,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			err := testCase.request(newService(&buf, false))
+			require.ErrorIs(t, err, ErrAuthenticationFailed)
+
+			assert.NotContains(t, buf.String(), secret, "credentials should never be logged")
+
+			var record map[string]any
+
+			err = json.Unmarshal(buf.Bytes(), &record)
+			require.NoError(t, err)
+
+			assert.Equal(t, testCase.reason, record["reason"])
+			assert.Contains(t, record["error"], "[REDACTED]")
+			assert.NotContains(t, record, "username", "usernames should not be logged by default")
+		})
+	}
+
+	t.Run("LogUsernames", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		_, err := newService(&buf, true).TokenHandler(context.Background(), TokenRequest{
+			Service:  "service.example.com",
+			Username: "user",
+			Password: secret,
+		})
+		require.Error(t, err)
+
+		assert.NotContains(t, buf.String(), secret, "credentials should never be logged")
+
+		var record map[string]any
+
+		err = json.Unmarshal(buf.Bytes(), &record)
+		require.NoError(t, err)
+
+		assert.Equal(t, "user", record["username"])
+	})
+}
+
+type failingPasswordAuthenticator struct {
+	errs map[string]error
+}
+
+func (a failingPasswordAuthenticator) AuthenticatePassword(_ context.Context, username string, _ string) (Subject, error) {
+	return nil, a.errs[username]
+}
+
+var errCustomAuthentication = errors.New("custom authentication error")
+
+func TestAuditTokenService_AuthenticationFailureCause(t *testing.T) {
+	authenticator := failingPasswordAuthenticator{
+		errs: map[string]error{
+			"invalid":  ErrInvalidCredentials,
+			"disabled": fmt.Errorf("%w: locked by an administrator", ErrAccountDisabled),
+			"generic":  ErrAuthenticationFailed,
+			"backend":  errors.New("connection refused"),
+			"custom":   errCustomAuthentication,
+		},
+	}
+
+	testCases := []struct {
+		username string
+		cause    string
+	}{
+		{"invalid", AuditCauseInvalidCredentials},
+		{"disabled", AuditCauseAccountDisabled},
+		{"generic", AuditCauseAuthenticationFailed},
+		{"backend", AuditCauseBackendError},
+		{"custom", "custom"},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.username, func(t *testing.T) {
+			var events []AuditEvent
+
+			stub := newTokenServiceStub()
+			stub.Authenticator.PasswordAuthenticator = authenticator
+
+			service := AuditTokenService{
+				Service:     stub,
+				AuditLogger: auditLoggerStub{&events},
+				AuthenticationFailureCause: func(err error) string {
+					if errors.Is(err, errCustomAuthentication) {
+						return "custom"
+					}
+
+					return AuthenticationFailureCause(err)
+				},
+			}
+
+			_, err := service.TokenHandler(context.Background(), TokenRequest{
+				Service:  "service.example.com",
+				Username: testCase.username,
+				Password: "password",
+			})
+			require.Error(t, err)
+
+			_, err = service.OAuth2Handler(context.Background(), OAuth2Request{
+				GrantType: GrantTypePassword,
+				Service:   "service.example.com",
+				ClientID:  "client",
+				Username:  testCase.username,
+				Password:  "password",
+			})
+			require.Error(t, err)
+
+			require.Len(t, events, 2)
+
+			for _, event := range events {
+				assert.False(t, event.Success)
+				assert.Equal(t, testCase.cause, event.Cause)
+			}
+		})
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		var events []AuditEvent
+
+		service := AuditTokenService{
+			Service:     newTokenServiceStub(),
+			AuditLogger: auditLoggerStub{&events},
+		}
+
+		_, err := service.TokenHandler(context.Background(), TokenRequest{
+			Service:  "service.example.com",
+			Username: "user",
+			Password: "password",
+		})
+		require.NoError(t, err)
+
+		require.Len(t, events, 1)
+
+		assert.Empty(t, events[0].Cause)
+	})
+}
+
+func TestAuditTokenService_SampleRates(t *testing.T) {
+	request := func(actions ...string) TokenRequest {
+		return TokenRequest{
+			Service:  "service.example.com",
+			Username: "user",
+			Password: "password",
+			Scopes: Scopes{
+				{
+					Resource: Resource{Type: "repository", Name: "foo"},
+					Actions:  actions,
+				},
+			},
+		}
+	}
+
+	newService := func(events *[]AuditEvent, random []byte) AuditTokenService {
+		return AuditTokenService{
+			Service:     newTokenServiceStub(),
+			AuditLogger: auditLoggerStub{events},
+			SampleRates: map[string]float64{
+				"pull":   0.5,
+				"delete": 0,
+			},
+			Dependencies: Dependencies{
+				Rand: bytes.NewReader(random),
+			},
+		}
+	}
+
+	t.Run("WritesAlwaysAudited", func(t *testing.T) {
+		var events []AuditEvent
+
+		service := newService(&events, nil)
+
+		_, err := service.TokenHandler(context.Background(), request("push"))
+		require.NoError(t, err)
+
+		_, err = service.TokenHandler(context.Background(), request("pull", "push"))
+		require.NoError(t, err)
+
+		assert.Len(t, events, 2)
+	})
+
+	t.Run("ReadsSampled", func(t *testing.T) {
+		var events []AuditEvent
+
+		// The first draw falls below the rate, the second one above it
+		random := append(bytes.Repeat([]byte{0x00}, 8), bytes.Repeat([]byte{0xff}, 8)...)
+
+		service := newService(&events, random)
+
+		_, err := service.TokenHandler(context.Background(), request("pull"))
+		require.NoError(t, err)
+
+		_, err = service.TokenHandler(context.Background(), request("pull"))
+		require.NoError(t, err)
+
+		assert.Len(t, events, 1)
+	})
+
+	t.Run("Suppressed", func(t *testing.T) {
+		var events []AuditEvent
+
+		service := newService(&events, nil)
+
+		_, err := service.TokenHandler(context.Background(), request("delete"))
+		require.NoError(t, err)
+
+		assert.Empty(t, events)
+	})
+
+	t.Run("FailuresAlwaysAudited", func(t *testing.T) {
+		var events []AuditEvent
+
+		service := newService(&events, nil)
+
+		r := request("delete")
+		r.Username = "unknown"
+
+		_, err := service.TokenHandler(context.Background(), r)
+		require.Error(t, err)
+
+		assert.Len(t, events, 1)
+	})
+}
+
+func TestSigningAuditLogger(t *testing.T) {
+	var events []AuditEvent
+
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	logger := SigningAuditLogger{
+		AuditLogger: auditLoggerStub{&events},
+		Key:         key,
+	}
+
+	logger.LogAuditEvent(context.Background(), AuditEvent{
+		Time:                 time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC),
+		RequestID:            "1234",
+		Operation:            AuditOperationToken,
+		Service:              "service.example.com",
+		AuthenticationMethod: AuthenticationMethodPassword,
+		Subject:              "user",
+		RequestedScopes:      Scopes{{Resource: Resource{Type: "repository", Name: "foo"}, Actions: []string{"pull", "push"}}},
+		GrantedScopes:        Scopes{{Resource: Resource{Type: "repository", Name: "foo"}, Actions: []string{"pull"}}},
+		Success:              true,
+	})
+
+	require.Len(t, events, 1)
+
+	event := events[0]
+
+	require.NotEmpty(t, event.Signature)
+	assert.Equal(t, SignAuditEvent(event, key), event.Signature)
+	assert.True(t, VerifyAuditEvent(event, key))
+
+	t.Run("WrongKey", func(t *testing.T) {
+		assert.False(t, VerifyAuditEvent(event, []byte("fedcba9876543210fedcba9876543210")))
+	})
+
+	t.Run("Modified", func(t *testing.T) {
+		modifications := map[string]func(event *AuditEvent){
+			"Subject":       func(event *AuditEvent) { event.Subject = "admin" },
+			"Time":          func(event *AuditEvent) { event.Time = event.Time.Add(time.Second) },
+			"GrantedScopes": func(event *AuditEvent) { event.GrantedScopes[0].Actions = []string{"pull", "push"} },
+			"Success":       func(event *AuditEvent) { event.Success = false },
+			"Signature":     func(event *AuditEvent) { event.Signature = "not hex" },
+		}
+
+		for name, modify := range modifications {
+			modify := modify
+
+			t.Run(name, func(t *testing.T) {
+				modified := event
+				modified.GrantedScopes = Scopes{{Resource: event.GrantedScopes[0].Resource, Actions: event.GrantedScopes[0].Actions}}
+
+				modify(&modified)
+
+				assert.False(t, VerifyAuditEvent(modified, key))
+			})
+		}
+	})
+}
+
+// idAccessTokenIssuerStub issues access tokens with a predictable ID.
+type idAccessTokenIssuerStub struct {
+	accessTokenIssuerStub
+}
+
+func (i idAccessTokenIssuerStub) IssueAccessToken(ctx context.Context, service string, subject Subject, grantedScopes []Scope) (AccessToken, error) {
+	token, err := i.accessTokenIssuerStub.IssueAccessToken(ctx, service, subject, grantedScopes)
+	token.ID = "jti:" + string(subject.ID())
+
+	return token, err
+}
+
+func TestAuditTokenService_TokenFingerprints(t *testing.T) {
+	var events []AuditEvent
+
+	tokenService := newTokenServiceStub()
+	tokenService.TokenIssuer.AccessTokenIssuer = idAccessTokenIssuerStub{tokenService.TokenIssuer.AccessTokenIssuer.(accessTokenIssuerStub)}
+
+	service := AuditTokenService{
+		Service:           tokenService,
+		AuditLogger:       auditLoggerStub{&events},
+		TokenFingerprints: true,
+	}
+
+	_, err := service.TokenHandler(context.Background(), TokenRequest{
+		Service:  "service.example.com",
+		Username: "user",
+		Password: "password",
+	})
+	require.NoError(t, err)
+
+	require.Len(t, events, 1)
+
+	sum := sha256.Sum256([]byte("jti:user"))
+
+	assert.Equal(t, []string{hex.EncodeToString(sum[:])}, events[0].TokenFingerprints)
+
+	t.Run("Disabled", func(t *testing.T) {
+		var events []AuditEvent
+
+		service := AuditTokenService{
+			Service:     tokenService,
+			AuditLogger: auditLoggerStub{&events},
+		}
+
+		_, err := service.TokenHandler(context.Background(), TokenRequest{
+			Service:  "service.example.com",
+			Username: "user",
+			Password: "password",
+		})
+		require.NoError(t, err)
+
+		require.Len(t, events, 1)
+		assert.Empty(t, events[0].TokenFingerprints)
+	})
+}
@@ -3,6 +3,7 @@ package auth
 import (
 	"context"
 	"errors"
+	"fmt"
 )
 
 // ErrAuthenticationFailed is returned when authentication fails.
@@ -11,6 +12,29 @@ import (
 // Any other error (eg. connection problems) should be returned directly.
 var ErrAuthenticationFailed = errors.New("authentication failed")
 
+// Typed authentication errors allowing callers (eg. the audit log) to tell the cause of a failure apart.
+//
+// They wrap ErrAuthenticationFailed, so checking for ErrAuthenticationFailed matches them as well.
+var (
+	// ErrInvalidCredentials is returned when credentials (eg. a password or a refresh token) are invalid or unknown.
+	ErrInvalidCredentials = fmt.Errorf("%w: invalid credentials", ErrAuthenticationFailed)
+
+	// ErrAccountDisabled is returned when credentials belong to a disabled (locked) account.
+	ErrAccountDisabled = fmt.Errorf("%w: account disabled", ErrAuthenticationFailed)
+)
+
+// Authentication methods a Subject can authenticate with.
+//
+// AuthenticationMethodPassword is the value registered by [RFC 8176], so it can be used in the "amr" claim of access tokens.
+// Refresh and bearer tokens do not have a registered value: they do not tell how the subject originally authenticated.
+//
+// [RFC 8176]: https://datatracker.ietf.org/doc/html/rfc8176#section-2
+const (
+	AuthenticationMethodPassword     = "pwd"
+	AuthenticationMethodRefreshToken = "refresh_token"
+	AuthenticationMethodBearerToken  = "bearer_token"
+)
+
 // PasswordAuthenticator authenticates a subject using the "password" grant or basic auth.
 //
 // It returns an ErrAuthenticationFailed error in case credentials are invalid.
@@ -22,3 +46,17 @@ type PasswordAuthenticator interface {
 type RefreshTokenAuthenticator interface {
 	AuthenticateRefreshToken(ctx context.Context, service string, refreshToken string) (Subject, error)
 }
+
+// BearerTokenAuthenticator authenticates a subject using a bearer token issued by a trusted identity provider (eg. an OIDC ID token).
+//
+// It returns an ErrAuthenticationFailed error in case the token is invalid.
+type BearerTokenAuthenticator interface {
+	AuthenticateBearerToken(ctx context.Context, token string) (Subject, error)
+}
+
+// SubjectEnricher adds information (eg. roles fetched from an external service) to an authenticated Subject.
+//
+// It returns the Subject unchanged if there is nothing to add.
+type SubjectEnricher interface {
+	EnrichSubject(ctx context.Context, subject Subject) (Subject, error)
+}
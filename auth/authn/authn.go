@@ -2,7 +2,10 @@ package authn
 
 import (
 	"context"
+	"fmt"
 	"maps"
+	"slices"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
@@ -12,19 +15,49 @@ import (
 // UserAuthenticator is a static list of users.
 type UserAuthenticator struct {
 	entries map[string]User
+
+	lastEntryWins bool
 }
 
 // NewUserAuthenticator returns a new UserAuthenticator.
-func NewUserAuthenticator(users []User) UserAuthenticator {
-	entries := make(map[string]User, len(users))
+//
+// If a username is listed multiple times, the last entry is used, but the most restrictive one wins:
+// the user is disabled if any of its entries is disabled (see WithLastEntryWins).
+func NewUserAuthenticator(users []User, opts ...UserAuthenticatorOption) UserAuthenticator {
+	a := UserAuthenticator{
+		entries: make(map[string]User, len(users)),
+	}
 
-	for _, user := range users {
-		entries[user.Username] = user
+	for _, opt := range opts {
+		opt.applyUserAuthenticator(&a)
 	}
 
-	return UserAuthenticator{
-		entries: entries,
+	for _, user := range users {
+		if previous, ok := a.entries[user.Username]; ok && !previous.Enabled && !a.lastEntryWins {
+			user.Enabled = false
+		}
+
+		a.entries[user.Username] = user
 	}
+
+	return a
+}
+
+// UserAuthenticatorOption configures a UserAuthenticator.
+type UserAuthenticatorOption interface {
+	applyUserAuthenticator(a *UserAuthenticator)
+}
+
+// WithLastEntryWins configures a UserAuthenticator to use the last entry of users listed multiple times as is,
+// even if an earlier entry disables the user.
+func WithLastEntryWins() UserAuthenticatorOption {
+	return withLastEntryWins{}
+}
+
+type withLastEntryWins struct{}
+
+func (withLastEntryWins) applyUserAuthenticator(a *UserAuthenticator) {
+	a.lastEntryWins = true
 }
 
 // User is an auth.Subject.
@@ -32,7 +65,12 @@ type User struct {
 	Enabled      bool
 	Username     string
 	PasswordHash string
-	Attrs        map[string]string
+
+	Email       string
+	DisplayName string
+	Groups      []string
+
+	Attrs map[string]string
 }
 
 // ID implements auth.Subject.
@@ -56,23 +94,57 @@ func (u User) Attributes() map[string]string {
 	return maps.Clone(u.Attrs)
 }
 
+// Identity returns typed identity information about the user (see auth.GetSubjectIdentity).
+//
+// The second return value is false if the user has no identity information (eg. users of an htpasswd file).
+func (u User) Identity() (auth.Identity, bool) {
+	if u.Email == "" && u.DisplayName == "" && len(u.Groups) == 0 {
+		return auth.Identity{}, false
+	}
+
+	return auth.Identity{
+		Email:       u.Email,
+		DisplayName: u.DisplayName,
+		Groups:      slices.Clone(u.Groups),
+	}, true
+}
+
 // AuthenticatePassword implements auth.PasswordAuthenticator.
 func (a UserAuthenticator) AuthenticatePassword(_ context.Context, username string, password string) (auth.Subject, error) {
 	if a.entries == nil {
-		return nil, auth.ErrAuthenticationFailed
+		return nil, auth.ErrInvalidCredentials
 	}
 
 	user, ok := a.entries[username]
-	if !ok || !user.Enabled {
+
+	user, err := verifyPassword(user, ok, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// verifyPassword checks password against the password hash of a user looked up by an authenticator.
+// found reports whether the user exists at all.
+//
+// Disabled accounts are only reported after the password is verified,
+// so that clients without valid credentials cannot tell them apart from unknown ones.
+func verifyPassword(user User, found bool, password string) (User, error) {
+	if !found {
 		// timing attack paranoia
 		_ = bcrypt.CompareHashAndPassword([]byte{}, []byte(password))
 
-		return nil, auth.ErrAuthenticationFailed
+		return User{}, auth.ErrInvalidCredentials
 	}
 
-	err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+	err := comparePasswordHash(user.PasswordHash, password)
 	if err != nil {
-		return nil, auth.ErrAuthenticationFailed
+		return User{}, auth.ErrInvalidCredentials
+	}
+
+	if !user.Enabled {
+		return User{}, auth.ErrAccountDisabled
 	}
 
 	return user, nil
@@ -81,8 +153,12 @@ func (a UserAuthenticator) AuthenticatePassword(_ context.Context, username stri
 // GetSubjectByID implements SubjectRepository.
 func (a UserAuthenticator) GetSubjectByID(_ context.Context, id auth.SubjectID) (auth.Subject, error) {
 	user, ok := a.entries[string(id)]
-	if !ok || !user.Enabled {
-		return nil, auth.ErrAuthenticationFailed
+	if !ok {
+		return nil, auth.ErrInvalidCredentials
+	}
+
+	if !user.Enabled {
+		return nil, auth.ErrAccountDisabled
 	}
 
 	return user, nil
@@ -92,14 +168,27 @@ func (a UserAuthenticator) GetSubjectByID(_ context.Context, id auth.SubjectID)
 type RefreshTokenAuthenticator struct {
 	verifier          RefreshTokenVerifier
 	subjectRepository SubjectRepository
+
+	maxLifetime time.Duration
+	clock       auth.Clock
 }
 
 // NewRefreshTokenAuthenticator returns a new RefreshTokenAuthenticator.
-func NewRefreshTokenAuthenticator(verifier RefreshTokenVerifier, subjectRepository SubjectRepository) RefreshTokenAuthenticator {
-	return RefreshTokenAuthenticator{
+func NewRefreshTokenAuthenticator(verifier RefreshTokenVerifier, subjectRepository SubjectRepository, opts ...RefreshTokenAuthenticatorOption) RefreshTokenAuthenticator {
+	a := RefreshTokenAuthenticator{
 		verifier:          verifier,
 		subjectRepository: subjectRepository,
 	}
+
+	for _, opt := range opts {
+		opt.applyRefreshTokenAuthenticator(&a)
+	}
+
+	if a.clock == nil {
+		a.clock = auth.Dependencies{}.GetClock()
+	}
+
+	return a
 }
 
 // RefreshTokenVerifier verifies a refresh token and returns the Subject ID it belongs to.
@@ -107,22 +196,175 @@ type RefreshTokenVerifier interface {
 	VerifyRefreshToken(ctx context.Context, service string, refreshToken string) (auth.SubjectID, error)
 }
 
+// RefreshTokenAuthTimeVerifier is an optional interface for a RefreshTokenVerifier.
+//
+// In addition to the Subject ID, it returns the time the Subject originally authenticated at
+// (ie. when the first refresh token in a chain of refreshed tokens was issued).
+type RefreshTokenAuthTimeVerifier interface {
+	VerifyRefreshTokenAuthTime(ctx context.Context, service string, refreshToken string) (auth.SubjectID, time.Time, error)
+}
+
+// RefreshTokenSessionVerifier is an optional interface for a RefreshTokenVerifier.
+//
+// It returns the session (refresh token family) a refresh token belongs to,
+// so that refresh tokens issued in exchange for it stay in the same session.
+type RefreshTokenSessionVerifier interface {
+	VerifyRefreshTokenSession(ctx context.Context, service string, refreshToken string) (RefreshTokenSession, error)
+}
+
+// RefreshTokenSession describes the session a refresh token belongs to.
+type RefreshTokenSession struct {
+	SubjectID auth.SubjectID
+
+	// AuthTime is the time the session started at (ie. when the Subject originally authenticated).
+	AuthTime time.Time
+
+	// ID identifies the session (eg. the "sid" claim). It is empty if the refresh token does not belong to a session.
+	ID string
+}
+
 // SubjectRepository looks up an auth.Subject based on an identifier.
 type SubjectRepository interface {
 	GetSubjectByID(ctx context.Context, id auth.SubjectID) (auth.Subject, error)
 }
 
 // AuthenticateRefreshToken implements auth.RefreshTokenAuthenticator.
+//
+// If the verifier implements RefreshTokenAuthTimeVerifier, the returned auth.Subject carries the original authentication time
+// (see [auth.GetSubjectAuthTime]), so that refreshed tokens can preserve it.
+// Similarly, if the verifier implements RefreshTokenSessionVerifier, it carries the session ID (see [auth.GetSubjectSessionID]).
 func (a RefreshTokenAuthenticator) AuthenticateRefreshToken(ctx context.Context, service string, refreshToken string) (auth.Subject, error) {
-	subjectID, err := a.verifier.VerifyRefreshToken(ctx, service, refreshToken)
+	session, err := a.verifyRefreshToken(ctx, service, refreshToken)
 	if err != nil {
 		return nil, err
 	}
 
-	subject, err := a.subjectRepository.GetSubjectByID(ctx, subjectID)
+	authTime := session.AuthTime
+
+	if a.maxLifetime > 0 {
+		if authTime.IsZero() {
+			return nil, fmt.Errorf("%w: refresh token does not have an authentication time", auth.ErrInvalidCredentials)
+		}
+
+		if a.clock.Now().After(authTime.Add(a.maxLifetime)) {
+			return nil, fmt.Errorf("%w: refresh token exceeded its maximum lifetime", auth.ErrInvalidCredentials)
+		}
+	}
+
+	subject, err := a.subjectRepository.GetSubjectByID(ctx, session.SubjectID)
 	if err != nil {
 		return nil, err
 	}
 
+	if !authTime.IsZero() || session.ID != "" {
+		subject = sessionSubject{
+			Subject:   subject,
+			authTime:  authTime,
+			sessionID: session.ID,
+		}
+	}
+
 	return subject, nil
 }
+
+func (a RefreshTokenAuthenticator) verifyRefreshToken(ctx context.Context, service string, refreshToken string) (RefreshTokenSession, error) {
+	if verifier, ok := a.verifier.(RefreshTokenSessionVerifier); ok {
+		return verifier.VerifyRefreshTokenSession(ctx, service, refreshToken)
+	}
+
+	if verifier, ok := a.verifier.(RefreshTokenAuthTimeVerifier); ok {
+		subjectID, authTime, err := verifier.VerifyRefreshTokenAuthTime(ctx, service, refreshToken)
+
+		return RefreshTokenSession{SubjectID: subjectID, AuthTime: authTime}, err
+	}
+
+	subjectID, err := a.verifier.VerifyRefreshToken(ctx, service, refreshToken)
+
+	return RefreshTokenSession{SubjectID: subjectID}, err
+}
+
+// sessionSubject decorates an auth.Subject with the time it originally authenticated at and the session it belongs to.
+type sessionSubject struct {
+	auth.Subject
+
+	authTime  time.Time
+	sessionID string
+}
+
+func (s sessionSubject) AuthTime() time.Time {
+	return s.authTime
+}
+
+func (s sessionSubject) SessionID() string {
+	return s.sessionID
+}
+
+func (s sessionSubject) Identity() (auth.Identity, bool) {
+	return auth.GetSubjectIdentity(s.Subject)
+}
+
+// RefreshTokenAuthenticatorOption configures a RefreshTokenAuthenticator.
+type RefreshTokenAuthenticatorOption interface {
+	applyRefreshTokenAuthenticator(a *RefreshTokenAuthenticator)
+}
+
+// WithMaxLifetime configures a RefreshTokenAuthenticator to reject refresh tokens
+// after the given duration passed since the Subject originally authenticated,
+// regardless of how recently the refresh token was issued.
+//
+// The verifier must implement RefreshTokenAuthTimeVerifier (or RefreshTokenSessionVerifier), otherwise every refresh token is rejected.
+func WithMaxLifetime(maxLifetime time.Duration) RefreshTokenAuthenticatorOption {
+	return withMaxLifetime{maxLifetime}
+}
+
+type withMaxLifetime struct {
+	maxLifetime time.Duration
+}
+
+func (w withMaxLifetime) applyRefreshTokenAuthenticator(a *RefreshTokenAuthenticator) {
+	a.maxLifetime = w.maxLifetime
+}
+
+// ClockOption configures an authenticator (or a refresh token issuer or store, or a subject enricher) to use a Clock.
+type ClockOption interface {
+	RefreshTokenAuthenticatorOption
+	BreakGlassAuthenticatorOption
+	OIDCAuthenticatorOption
+	StoredRefreshTokenIssuerOption
+	MemoryRefreshTokenStoreOption
+	HTTPSubjectEnricherOption
+}
+
+// WithClock configures a RefreshTokenAuthenticator, a BreakGlassAuthenticator, an OIDCAuthenticator,
+// a StoredRefreshTokenIssuer, a MemoryRefreshTokenStore or an HTTPSubjectEnricher to use a Clock.
+func WithClock(clock auth.Clock) ClockOption {
+	return withClock{clock}
+}
+
+type withClock struct {
+	clock auth.Clock
+}
+
+func (w withClock) applyRefreshTokenAuthenticator(a *RefreshTokenAuthenticator) {
+	a.clock = w.clock
+}
+
+func (w withClock) applyBreakGlassAuthenticator(a *BreakGlassAuthenticator) {
+	a.clock = w.clock
+}
+
+func (w withClock) applyOIDCAuthenticator(a *OIDCAuthenticator) {
+	a.clock = w.clock
+}
+
+func (w withClock) applyStoredRefreshTokenIssuer(i *StoredRefreshTokenIssuer) {
+	i.clock = w.clock
+}
+
+func (w withClock) applyMemoryRefreshTokenStore(s *MemoryRefreshTokenStore) {
+	s.clock = w.clock
+}
+
+func (w withClock) applyHTTPSubjectEnricher(e *HTTPSubjectEnricher) {
+	e.clock = w.clock
+}
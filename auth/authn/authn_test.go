@@ -3,7 +3,9 @@ package authn
 import (
 	"context"
 	"testing"
+	"time"
 
+	"github.com/jonboulle/clockwork"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/bcrypt"
@@ -37,16 +39,51 @@ func TestUserAuthenticator(t *testing.T) {
 
 	t.Run("Error", func(t *testing.T) {
 		t.Run("DisabledUser", func(t *testing.T) {
+			passwordHash, err := bcrypt.GenerateFromPassword([]byte("password"), 10)
+			require.NoError(t, err)
+
 			user := User{
-				Enabled: false,
+				Enabled:      false,
+				Username:     "username",
+				PasswordHash: string(passwordHash),
 			}
 
 			authenticator := NewUserAuthenticator([]User{user})
 
-			_, err := authenticator.AuthenticatePassword(context.Background(), "username", "password")
+			_, err = authenticator.AuthenticatePassword(context.Background(), "username", "password")
 			require.Error(t, err)
 
 			assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+			assert.ErrorIs(t, err, auth.ErrAccountDisabled)
+		})
+
+		t.Run("DisabledUserPasswordMismatch", func(t *testing.T) {
+			passwordHash, err := bcrypt.GenerateFromPassword([]byte("password"), 10)
+			require.NoError(t, err)
+
+			user := User{
+				Enabled:      false,
+				Username:     "username",
+				PasswordHash: string(passwordHash),
+			}
+
+			authenticator := NewUserAuthenticator([]User{user})
+
+			_, err = authenticator.AuthenticatePassword(context.Background(), "username", "wrong")
+			require.Error(t, err)
+
+			// Disabled accounts are not disclosed without valid credentials
+			assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+			assert.NotErrorIs(t, err, auth.ErrAccountDisabled)
+		})
+
+		t.Run("UnknownUser", func(t *testing.T) {
+			authenticator := NewUserAuthenticator([]User{})
+
+			_, err := authenticator.AuthenticatePassword(context.Background(), "username", "password")
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
 		})
 
 		t.Run("PasswordMismatch", func(t *testing.T) {
@@ -69,10 +106,72 @@ func TestUserAuthenticator(t *testing.T) {
 			require.Error(t, err)
 
 			assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+			assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
 		})
 	})
 }
 
+func TestUserAuthenticator_Duplicates(t *testing.T) {
+	const password = "password"
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	enabled := User{
+		Enabled:      true,
+		Username:     "username",
+		PasswordHash: string(passwordHash),
+	}
+
+	disabled := enabled
+	disabled.Enabled = false
+
+	testCases := []struct {
+		name    string
+		users   []User
+		opts    []UserAuthenticatorOption
+		enabled bool
+	}{
+		{
+			name:    "DisabledFirst",
+			users:   []User{disabled, enabled},
+			enabled: false,
+		},
+		{
+			name:    "DisabledLast",
+			users:   []User{enabled, disabled},
+			enabled: false,
+		},
+		{
+			name:    "BothEnabled",
+			users:   []User{enabled, enabled},
+			enabled: true,
+		},
+		{
+			name:    "LastEntryWins",
+			users:   []User{disabled, enabled},
+			opts:    []UserAuthenticatorOption{WithLastEntryWins()},
+			enabled: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			authenticator := NewUserAuthenticator(testCase.users, testCase.opts...)
+
+			_, err := authenticator.AuthenticatePassword(context.Background(), "username", password)
+
+			if testCase.enabled {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, auth.ErrAccountDisabled)
+			}
+		})
+	}
+}
+
 func TestUser(t *testing.T) {
 	const (
 		username  = "username"
@@ -127,3 +226,164 @@ func TestRefreshTokenAuthenticator(t *testing.T) {
 
 	assert.Equal(t, user, subject)
 }
+
+type refreshTokenAuthTimeVerifier struct {
+	subjectID auth.SubjectID
+	authTime  time.Time
+}
+
+func (v refreshTokenAuthTimeVerifier) VerifyRefreshToken(_ context.Context, _ string, _ string) (auth.SubjectID, error) {
+	return v.subjectID, nil
+}
+
+func (v refreshTokenAuthTimeVerifier) VerifyRefreshTokenAuthTime(_ context.Context, _ string, _ string) (auth.SubjectID, time.Time, error) {
+	return v.subjectID, v.authTime, nil
+}
+
+func TestRefreshTokenAuthenticator_MaxLifetime(t *testing.T) {
+	user := User{
+		Enabled:  true,
+		Username: "user",
+	}
+
+	subjectRepository := NewUserAuthenticator([]User{user})
+
+	authTime := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+
+	verifier := refreshTokenAuthTimeVerifier{
+		subjectID: user.ID(),
+		authTime:  authTime,
+	}
+
+	const maxLifetime = 30 * 24 * time.Hour
+
+	t.Run("WithinMaxLifetime", func(t *testing.T) {
+		clock := clockwork.NewFakeClockAt(authTime.Add(maxLifetime - time.Minute))
+
+		authenticator := NewRefreshTokenAuthenticator(verifier, subjectRepository, WithMaxLifetime(maxLifetime), WithClock(clock))
+
+		subject, err := authenticator.AuthenticateRefreshToken(context.Background(), "service", "refresh token")
+		require.NoError(t, err)
+
+		assert.Equal(t, user.ID(), subject.ID())
+
+		actualAuthTime, ok := auth.GetSubjectAuthTime(subject)
+		require.True(t, ok)
+		assert.Equal(t, authTime, actualAuthTime)
+	})
+
+	t.Run("PastMaxLifetime", func(t *testing.T) {
+		// The refresh token itself may still be within its sliding expiration window,
+		// but the subject authenticated too long ago.
+		clock := clockwork.NewFakeClockAt(authTime.Add(maxLifetime + time.Minute))
+
+		authenticator := NewRefreshTokenAuthenticator(verifier, subjectRepository, WithMaxLifetime(maxLifetime), WithClock(clock))
+
+		_, err := authenticator.AuthenticateRefreshToken(context.Background(), "service", "refresh token")
+		require.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+	})
+
+	t.Run("NoAuthTime", func(t *testing.T) {
+		verifier := refreshTokenVerifier{
+			refreshTokens: map[string]auth.SubjectID{
+				"refresh token": user.ID(),
+			},
+		}
+
+		authenticator := NewRefreshTokenAuthenticator(verifier, subjectRepository, WithMaxLifetime(maxLifetime))
+
+		_, err := authenticator.AuthenticateRefreshToken(context.Background(), "service", "refresh token")
+		require.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+	})
+}
+
+type refreshTokenSessionVerifier struct {
+	refreshTokenVerifier
+
+	session RefreshTokenSession
+}
+
+func (v refreshTokenSessionVerifier) VerifyRefreshTokenSession(_ context.Context, _ string, _ string) (RefreshTokenSession, error) {
+	return v.session, nil
+}
+
+func TestRefreshTokenAuthenticator_Session(t *testing.T) {
+	user := User{
+		Enabled:  true,
+		Username: "user",
+	}
+
+	authTime := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+
+	verifier := refreshTokenSessionVerifier{
+		session: RefreshTokenSession{
+			SubjectID: user.ID(),
+			AuthTime:  authTime,
+			ID:        "session",
+		},
+	}
+
+	authenticator := NewRefreshTokenAuthenticator(verifier, NewUserAuthenticator([]User{user}))
+
+	subject, err := authenticator.AuthenticateRefreshToken(context.Background(), "service", "refresh token")
+	require.NoError(t, err)
+
+	assert.Equal(t, user.ID(), subject.ID())
+
+	sessionID, ok := auth.GetSubjectSessionID(subject)
+	require.True(t, ok)
+	assert.Equal(t, "session", sessionID)
+
+	actualAuthTime, ok := auth.GetSubjectAuthTime(subject)
+	require.True(t, ok)
+	assert.Equal(t, authTime, actualAuthTime)
+}
+
+func TestAuthenticators_Identity(t *testing.T) {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	user := User{
+		Enabled:      true,
+		Username:     "user",
+		PasswordHash: string(passwordHash),
+		Email:        "user@example.com",
+		DisplayName:  "Jane Doe",
+		Groups:       []string{"dev", "ops"},
+	}
+
+	expected := auth.Identity{
+		Email:       "user@example.com",
+		DisplayName: "Jane Doe",
+		Groups:      []string{"dev", "ops"},
+	}
+
+	userAuthenticator := NewUserAuthenticator([]User{user})
+
+	t.Run("UserAuthenticator", func(t *testing.T) {
+		subject, err := userAuthenticator.AuthenticatePassword(context.Background(), "user", "password")
+		require.NoError(t, err)
+
+		identity, ok := auth.GetSubjectIdentity(subject)
+		require.True(t, ok)
+
+		assert.Equal(t, expected, identity)
+	})
+
+	t.Run("RefreshTokenAuthenticator", func(t *testing.T) {
+		verifier := refreshTokenAuthTimeVerifier{
+			subjectID: user.ID(),
+			authTime:  time.Now(),
+		}
+
+		authenticator := NewRefreshTokenAuthenticator(verifier, userAuthenticator)
+
+		subject, err := authenticator.AuthenticateRefreshToken(context.Background(), "service", "refresh token")
+		require.NoError(t, err)
+
+		identity, ok := auth.GetSubjectIdentity(subject)
+		require.True(t, ok)
+
+		assert.Equal(t, expected, identity)
+	})
+}
@@ -0,0 +1,127 @@
+package authn
+
+import (
+	"context"
+	"time"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+// BreakGlassAuthenticator provides emergency access when the primary authenticator (eg. LDAP) is unavailable.
+//
+// A request with the break-glass username is authenticated against the break-glass credential only
+// (it is never sent to the primary authenticator), every other request is delegated to the primary authenticator.
+//
+// Every use of the break-glass credential (successful or not) is recorded as a high severity audit event.
+// The credential stops working after notAfter (see [WithNotAfter]).
+//
+// The break-glass user is not returned by GetSubjectByID,
+// so refresh tokens issued to it cannot be used: it has to authenticate with its password every time.
+//
+// BreakGlassAuthenticator deliberately does not forward readiness checks (auth.Checker) to the primary authenticator:
+// the server has to remain ready (and reachable) for the break-glass credential while the primary backend is down.
+type BreakGlassAuthenticator struct {
+	authenticator auth.PasswordAuthenticator
+	user          User
+	auditLogger   auth.AuditLogger
+
+	notAfter time.Time
+	clock    auth.Clock
+}
+
+// NewBreakGlassAuthenticator returns a new BreakGlassAuthenticator layered in front of authenticator.
+func NewBreakGlassAuthenticator(authenticator auth.PasswordAuthenticator, user User, auditLogger auth.AuditLogger, opts ...BreakGlassAuthenticatorOption) BreakGlassAuthenticator {
+	a := BreakGlassAuthenticator{
+		authenticator: authenticator,
+		user:          user,
+		auditLogger:   auditLogger,
+	}
+
+	// The break-glass credential is always enabled while it is configured
+	a.user.Enabled = true
+
+	for _, opt := range opts {
+		opt.applyBreakGlassAuthenticator(&a)
+	}
+
+	if a.clock == nil {
+		a.clock = auth.Dependencies{}.GetClock()
+	}
+
+	return a
+}
+
+// AuthenticatePassword implements auth.PasswordAuthenticator.
+func (a BreakGlassAuthenticator) AuthenticatePassword(ctx context.Context, username string, password string) (auth.Subject, error) {
+	if username != a.user.Username {
+		return a.authenticator.AuthenticatePassword(ctx, username, password)
+	}
+
+	subject, err := a.authenticateBreakGlass(password)
+
+	event := auth.AuditEvent{
+		Time:                 a.clock.Now(),
+		RequestID:            auth.RequestIDFromContext(ctx),
+		Operation:            auth.AuditOperationBreakGlass,
+		Severity:             auth.AuditSeverityHigh,
+		AuthenticationMethod: auth.AuthenticationMethodPassword,
+		Subject:              a.user.ID(),
+		Success:              err == nil,
+	}
+
+	if err != nil {
+		event.Error = err.Error()
+		event.Cause = auth.AuthenticationFailureCause(err)
+	}
+
+	a.auditLogger.LogAuditEvent(ctx, event)
+
+	return subject, err
+}
+
+func (a BreakGlassAuthenticator) authenticateBreakGlass(password string) (auth.Subject, error) {
+	err := comparePasswordHash(a.user.PasswordHash, password)
+	if err != nil {
+		return nil, auth.ErrInvalidCredentials
+	}
+
+	if !a.notAfter.IsZero() && a.clock.Now().After(a.notAfter) {
+		return nil, auth.ErrAccountDisabled
+	}
+
+	return a.user, nil
+}
+
+// GetSubjectByID implements SubjectRepository if the primary authenticator implements it.
+func (a BreakGlassAuthenticator) GetSubjectByID(ctx context.Context, id auth.SubjectID) (auth.Subject, error) {
+	if id == a.user.ID() {
+		return nil, auth.ErrInvalidCredentials
+	}
+
+	subjectRepository, ok := a.authenticator.(SubjectRepository)
+	if !ok {
+		return nil, auth.ErrInvalidCredentials
+	}
+
+	return subjectRepository.GetSubjectByID(ctx, id)
+}
+
+// BreakGlassAuthenticatorOption configures a BreakGlassAuthenticator.
+type BreakGlassAuthenticatorOption interface {
+	applyBreakGlassAuthenticator(a *BreakGlassAuthenticator)
+}
+
+// WithNotAfter limits the validity of the break-glass credential.
+//
+// A zero time means the credential never expires.
+func WithNotAfter(notAfter time.Time) BreakGlassAuthenticatorOption {
+	return withNotAfter{notAfter}
+}
+
+type withNotAfter struct {
+	notAfter time.Time
+}
+
+func (w withNotAfter) applyBreakGlassAuthenticator(a *BreakGlassAuthenticator) {
+	a.notAfter = w.notAfter
+}
@@ -0,0 +1,118 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+type auditLoggerStub struct {
+	events *[]auth.AuditEvent
+}
+
+func (l auditLoggerStub) LogAuditEvent(_ context.Context, event auth.AuditEvent) {
+	*l.events = append(*l.events, event)
+}
+
+type unavailableAuthenticator struct{}
+
+func (unavailableAuthenticator) AuthenticatePassword(_ context.Context, _ string, _ string) (auth.Subject, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestBreakGlassAuthenticator(t *testing.T) {
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte("emergency"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	user := User{
+		Username:     "break-glass",
+		PasswordHash: string(passwordHash),
+		Groups:       []string{"admins"},
+	}
+
+	newAuthenticator := func(events *[]auth.AuditEvent, opts ...BreakGlassAuthenticatorOption) BreakGlassAuthenticator {
+		opts = append(opts, WithClock(clockwork.NewFakeClockAt(now)))
+
+		return NewBreakGlassAuthenticator(unavailableAuthenticator{}, user, auditLoggerStub{events}, opts...)
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		var events []auth.AuditEvent
+
+		authenticator := newAuthenticator(&events)
+
+		subject, err := authenticator.AuthenticatePassword(context.Background(), "break-glass", "emergency")
+		require.NoError(t, err)
+
+		assert.Equal(t, auth.SubjectID("break-glass"), subject.ID())
+
+		expected := []auth.AuditEvent{
+			{
+				Time:                 now,
+				Operation:            auth.AuditOperationBreakGlass,
+				Severity:             auth.AuditSeverityHigh,
+				AuthenticationMethod: auth.AuthenticationMethodPassword,
+				Subject:              "break-glass",
+				Success:              true,
+			},
+		}
+
+		assert.Equal(t, expected, events)
+	})
+
+	t.Run("InvalidPassword", func(t *testing.T) {
+		var events []auth.AuditEvent
+
+		authenticator := newAuthenticator(&events)
+
+		_, err := authenticator.AuthenticatePassword(context.Background(), "break-glass", "wrong")
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+
+		require.Len(t, events, 1)
+		assert.False(t, events[0].Success)
+		assert.Equal(t, auth.AuditSeverityHigh, events[0].Severity)
+		assert.Equal(t, auth.AuditCauseInvalidCredentials, events[0].Cause)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		var events []auth.AuditEvent
+
+		authenticator := newAuthenticator(&events, WithNotAfter(now.Add(-time.Minute)))
+
+		_, err := authenticator.AuthenticatePassword(context.Background(), "break-glass", "emergency")
+		require.ErrorIs(t, err, auth.ErrAccountDisabled)
+
+		require.Len(t, events, 1)
+		assert.Equal(t, auth.AuditCauseAccountDisabled, events[0].Cause)
+	})
+
+	t.Run("OtherUser", func(t *testing.T) {
+		var events []auth.AuditEvent
+
+		authenticator := newAuthenticator(&events)
+
+		_, err := authenticator.AuthenticatePassword(context.Background(), "user", "password")
+		require.EqualError(t, err, "connection refused")
+
+		assert.Empty(t, events)
+	})
+
+	t.Run("GetSubjectByID", func(t *testing.T) {
+		var events []auth.AuditEvent
+
+		authenticator := newAuthenticator(&events)
+
+		_, err := authenticator.GetSubjectByID(context.Background(), "break-glass")
+		require.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+	})
+}
@@ -0,0 +1,206 @@
+package authn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+// maxEnrichmentResponseSize limits the size of responses read from a subject enrichment endpoint.
+const maxEnrichmentResponseSize = 1 << 20
+
+// HTTPSubjectEnricherConfig configures an HTTPSubjectEnricher.
+type HTTPSubjectEnricherConfig struct {
+	// URL of the lookup endpoint. The subject ID is sent in the "subject" query parameter.
+	URL string
+
+	// CacheTTL is how long looked up attributes are cached for (zero disables caching).
+	CacheTTL time.Duration
+
+	// FailOpen authenticates subjects without additional attributes if the lookup fails.
+	// By default, authentication fails instead.
+	FailOpen bool
+
+	// HTTPClient calls the lookup endpoint (defaults to a client with a 10 second timeout).
+	HTTPClient *http.Client
+}
+
+// Validate validates the configuration.
+func (c HTTPSubjectEnricherConfig) Validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("url: %w", err)
+	}
+
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return errors.New("url: scheme must be http or https")
+	}
+
+	if c.CacheTTL < 0 {
+		return errors.New("cacheTTL cannot be negative")
+	}
+
+	return nil
+}
+
+// HTTPSubjectEnricher adds attributes (eg. roles) looked up from an HTTP service to authenticated subjects.
+//
+// The endpoint is called with a GET request and responds with a JSON object of string attributes:
+//
+//	GET /lookup?subject=user
+//
+//	{"roles": "admin,developer"}
+//
+// A 404 response means there is nothing to add.
+// Attributes provided by the authenticator take precedence over the looked up ones.
+type HTTPSubjectEnricher struct {
+	config HTTPSubjectEnricherConfig
+
+	cache *enrichmentCache
+	clock auth.Clock
+}
+
+// NewHTTPSubjectEnricher returns a new HTTPSubjectEnricher.
+func NewHTTPSubjectEnricher(config HTTPSubjectEnricherConfig, opts ...HTTPSubjectEnricherOption) HTTPSubjectEnricher {
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	e := HTTPSubjectEnricher{
+		config: config,
+	}
+
+	for _, opt := range opts {
+		opt.applyHTTPSubjectEnricher(&e)
+	}
+
+	if e.clock == nil {
+		e.clock = auth.Dependencies{}.GetClock()
+	}
+
+	e.cache = &enrichmentCache{
+		entries: make(map[auth.SubjectID]enrichmentCacheEntry),
+	}
+
+	return e
+}
+
+// EnrichSubject implements auth.SubjectEnricher.
+func (e HTTPSubjectEnricher) EnrichSubject(ctx context.Context, subject auth.Subject) (auth.Subject, error) {
+	now := e.clock.Now()
+
+	if attrs, ok := e.cache.get(subject.ID(), now); ok {
+		return auth.MergeSubjectAttributes(subject, attrs), nil
+	}
+
+	attrs, err := e.lookup(ctx, subject.ID())
+	if err != nil {
+		if e.config.FailOpen {
+			return subject, nil
+		}
+
+		return nil, err
+	}
+
+	if e.config.CacheTTL > 0 {
+		e.cache.set(subject.ID(), attrs, now.Add(e.config.CacheTTL), now)
+	}
+
+	return auth.MergeSubjectAttributes(subject, attrs), nil
+}
+
+func (e HTTPSubjectEnricher) lookup(ctx context.Context, subjectID auth.SubjectID) (map[string]string, error) {
+	u, err := url.Parse(e.config.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	query := u.Query()
+	query.Set("subject", string(subjectID))
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := e.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+
+	case http.StatusNotFound:
+		return nil, nil
+
+	default:
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	var attrs map[string]string
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxEnrichmentResponseSize)).Decode(&attrs); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+
+	return attrs, nil
+}
+
+// HTTPSubjectEnricherOption configures an HTTPSubjectEnricher.
+type HTTPSubjectEnricherOption interface {
+	applyHTTPSubjectEnricher(e *HTTPSubjectEnricher)
+}
+
+// enrichmentCache caches looked up attributes by subject.
+//
+// Expired entries are forgotten when new entries are added.
+type enrichmentCache struct {
+	mu      sync.Mutex
+	entries map[auth.SubjectID]enrichmentCacheEntry
+}
+
+type enrichmentCacheEntry struct {
+	attrs     map[string]string
+	expiresAt time.Time
+}
+
+func (c *enrichmentCache) get(subjectID auth.SubjectID, now time.Time) (map[string]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[subjectID]
+	if !ok || !now.Before(entry.expiresAt) {
+		return nil, false
+	}
+
+	return entry.attrs, true
+}
+
+func (c *enrichmentCache) set(subjectID auth.SubjectID, attrs map[string]string, expiresAt time.Time, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, id)
+		}
+	}
+
+	c.entries[subjectID] = enrichmentCacheEntry{
+		attrs:     attrs,
+		expiresAt: expiresAt,
+	}
+}
@@ -0,0 +1,141 @@
+package authn
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+type enrichmentServiceStub struct {
+	mu       sync.Mutex
+	attrs    map[string]map[string]string
+	requests int
+	down     bool
+}
+
+func (s *enrichmentServiceStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+
+	if s.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+
+		return
+	}
+
+	attrs, ok := s.attrs[r.URL.Query().Get("subject")]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(attrs)
+}
+
+func TestHTTPSubjectEnricher(t *testing.T) {
+	ctx := context.Background()
+
+	subject := User{
+		Username: "user",
+		Attrs: map[string]string{
+			"team": "platform",
+		},
+	}
+
+	newEnricher := func(t *testing.T, failOpen bool) (HTTPSubjectEnricher, *enrichmentServiceStub, clockwork.FakeClock) {
+		t.Helper()
+
+		service := &enrichmentServiceStub{
+			attrs: map[string]map[string]string{
+				"user": {
+					"roles": "admin,developer",
+					"team":  "other",
+				},
+			},
+		}
+
+		server := httptest.NewServer(service)
+		t.Cleanup(server.Close)
+
+		clock := clockwork.NewFakeClock()
+
+		enricher := NewHTTPSubjectEnricher(HTTPSubjectEnricherConfig{
+			URL:      server.URL + "/lookup",
+			CacheTTL: time.Minute,
+			FailOpen: failOpen,
+		}, WithClock(clock))
+
+		return enricher, service, clock
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		enricher, service, clock := newEnricher(t, false)
+
+		enriched, err := enricher.EnrichSubject(ctx, subject)
+		require.NoError(t, err)
+
+		assert.Equal(t, auth.SubjectID("user"), enriched.ID())
+		assert.Equal(t, map[string]string{"roles": "admin,developer", "team": "platform"}, enriched.Attributes())
+
+		// Cached
+		_, err = enricher.EnrichSubject(ctx, subject)
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, service.requests)
+
+		clock.Advance(time.Minute)
+
+		_, err = enricher.EnrichSubject(ctx, subject)
+		require.NoError(t, err)
+
+		assert.Equal(t, 2, service.requests)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		enricher, _, _ := newEnricher(t, false)
+
+		enriched, err := enricher.EnrichSubject(ctx, User{Username: "unknown"})
+		require.NoError(t, err)
+
+		assert.Empty(t, enriched.Attributes())
+	})
+
+	t.Run("FailClosed", func(t *testing.T) {
+		enricher, service, _ := newEnricher(t, false)
+		service.down = true
+
+		_, err := enricher.EnrichSubject(ctx, subject)
+		require.Error(t, err)
+	})
+
+	t.Run("FailOpen", func(t *testing.T) {
+		enricher, service, _ := newEnricher(t, true)
+		service.down = true
+
+		enriched, err := enricher.EnrichSubject(ctx, subject)
+		require.NoError(t, err)
+
+		assert.Equal(t, map[string]string{"team": "platform"}, enriched.Attributes())
+
+		// Failures are not cached
+		service.down = false
+
+		enriched, err = enricher.EnrichSubject(ctx, subject)
+		require.NoError(t, err)
+
+		assert.Equal(t, "admin,developer", enriched.Attributes()["roles"])
+	})
+}
@@ -0,0 +1,204 @@
+package authn
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Supported password hash formats are bcrypt ($2a$, $2b$ or $2y$ prefix)
+// and the PHC string formats of argon2id ($argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>)
+// and scrypt ($scrypt$ln=15,r=8,p=1$<salt>$<hash>), with salt and hash encoded as unpadded standard base64.
+
+var errPasswordMismatch = errors.New("password does not match")
+
+// CheckPasswordHash returns an error if hash is not in a supported format.
+func CheckPasswordHash(hash string) error {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		_, err := parseArgon2idHash(hash)
+
+		return err
+
+	case strings.HasPrefix(hash, "$scrypt$"):
+		_, err := parseScryptHash(hash)
+
+		return err
+	}
+
+	_, err := bcrypt.Cost([]byte(hash))
+
+	return err
+}
+
+// comparePasswordHash compares password with hash, detecting the format of the hash.
+func comparePasswordHash(hash string, password string) error {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		h, err := parseArgon2idHash(hash)
+		if err != nil {
+			return err
+		}
+
+		return compareDerivedKey(h.key, argon2.IDKey([]byte(password), h.salt, h.time, h.memory, h.threads, uint32(len(h.key))))
+
+	case strings.HasPrefix(hash, "$scrypt$"):
+		h, err := parseScryptHash(hash)
+		if err != nil {
+			return err
+		}
+
+		key, err := scrypt.Key([]byte(password), h.salt, 1<<h.logN, h.r, h.p, len(h.key))
+		if err != nil {
+			return err
+		}
+
+		return compareDerivedKey(h.key, key)
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+}
+
+func compareDerivedKey(expected []byte, actual []byte) error {
+	if subtle.ConstantTimeCompare(expected, actual) != 1 {
+		return errPasswordMismatch
+	}
+
+	return nil
+}
+
+type argon2idHash struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func parseArgon2idHash(hash string) (argon2idHash, error) {
+	// "", "argon2id", "v=19", "m=65536,t=3,p=4", salt, hash
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return argon2idHash{}, errors.New("argon2id: invalid hash format")
+	}
+
+	if parts[2] != "v="+strconv.Itoa(argon2.Version) {
+		return argon2idHash{}, fmt.Errorf("argon2id: unsupported version %q", parts[2])
+	}
+
+	params, err := parsePHCParams(parts[3], "m", "t", "p")
+	if err != nil {
+		return argon2idHash{}, fmt.Errorf("argon2id: %w", err)
+	}
+
+	if params["t"] < 1 || params["p"] < 1 || params["p"] > 255 {
+		return argon2idHash{}, errors.New("argon2id: invalid parameters")
+	}
+
+	salt, key, err := decodePHCSaltAndHash(parts[4], parts[5])
+	if err != nil {
+		return argon2idHash{}, fmt.Errorf("argon2id: %w", err)
+	}
+
+	return argon2idHash{
+		memory:  uint32(params["m"]),
+		time:    uint32(params["t"]),
+		threads: uint8(params["p"]),
+		salt:    salt,
+		key:     key,
+	}, nil
+}
+
+type scryptHash struct {
+	logN uint
+	r    int
+	p    int
+	salt []byte
+	key  []byte
+}
+
+func parseScryptHash(hash string) (scryptHash, error) {
+	// "", "scrypt", "ln=15,r=8,p=1", salt, hash
+	parts := strings.Split(hash, "$")
+	if len(parts) != 5 {
+		return scryptHash{}, errors.New("scrypt: invalid hash format")
+	}
+
+	params, err := parsePHCParams(parts[2], "ln", "r", "p")
+	if err != nil {
+		return scryptHash{}, fmt.Errorf("scrypt: %w", err)
+	}
+
+	if params["ln"] < 1 || params["ln"] > 62 || params["r"] < 1 || params["p"] < 1 {
+		return scryptHash{}, errors.New("scrypt: invalid parameters")
+	}
+
+	salt, key, err := decodePHCSaltAndHash(parts[3], parts[4])
+	if err != nil {
+		return scryptHash{}, fmt.Errorf("scrypt: %w", err)
+	}
+
+	return scryptHash{
+		logN: uint(params["ln"]),
+		r:    int(params["r"]),
+		p:    int(params["p"]),
+		salt: salt,
+		key:  key,
+	}, nil
+}
+
+// parsePHCParams parses a comma separated list of key=value parameters, requiring exactly the given keys.
+func parsePHCParams(s string, keys ...string) (map[string]uint64, error) {
+	params := make(map[string]uint64, len(keys))
+
+	for _, param := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid parameter %q", param)
+		}
+
+		v, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid parameter %q", param)
+		}
+
+		params[key] = v
+	}
+
+	for _, key := range keys {
+		if _, ok := params[key]; !ok {
+			return nil, fmt.Errorf("missing parameter %q", key)
+		}
+	}
+
+	if len(params) != len(keys) {
+		return nil, errors.New("unknown parameters")
+	}
+
+	return params, nil
+}
+
+func decodePHCSaltAndHash(encodedSalt string, encodedHash string) ([]byte, []byte, error) {
+	salt, err := base64.RawStdEncoding.DecodeString(encodedSalt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid salt: %w", err)
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(encodedHash)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid hash: %w", err)
+	}
+
+	if len(key) == 0 {
+		return nil, nil, errors.New("empty hash")
+	}
+
+	return salt, key, nil
+}
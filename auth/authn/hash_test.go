@@ -0,0 +1,91 @@
+package authn
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+func TestUserAuthenticator_PasswordHashes(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+
+	argon2idKey := argon2.IDKey([]byte("password"), salt, 1, 64, 1, 32)
+	argon2idHash := fmt.Sprintf(
+		"$argon2id$v=19$m=64,t=1,p=1$%s$%s",
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(argon2idKey),
+	)
+
+	scryptKey, err := scrypt.Key([]byte("password"), salt, 1<<4, 8, 1, 32)
+	require.NoError(t, err)
+
+	scryptHash := fmt.Sprintf(
+		"$scrypt$ln=4,r=8,p=1$%s$%s",
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(scryptKey),
+	)
+
+	testCases := []struct {
+		name string
+		hash string
+	}{
+		{"argon2id", argon2idHash},
+		{"scrypt", scryptHash},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			require.NoError(t, CheckPasswordHash(testCase.hash))
+
+			authenticator := NewUserAuthenticator([]User{
+				{
+					Enabled:      true,
+					Username:     "user",
+					PasswordHash: testCase.hash,
+				},
+			})
+
+			_, err := authenticator.AuthenticatePassword(context.Background(), "user", "password")
+			require.NoError(t, err)
+
+			_, err = authenticator.AuthenticatePassword(context.Background(), "user", "wrong")
+			require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+		})
+	}
+}
+
+func TestCheckPasswordHash(t *testing.T) {
+	valid := []string{
+		"$2a$12$vox7h99HV.gzbZGeBj69jeJVgkkP2nHTndG9USjp..00.WtIqvSpa",
+		"$argon2id$v=19$m=65536,t=3,p=4$c2FsdHNhbHQ$aGFzaGhhc2hoYXNo",
+		"$scrypt$ln=15,r=8,p=1$c2FsdHNhbHQ$aGFzaGhhc2hoYXNo",
+	}
+
+	for _, hash := range valid {
+		assert.NoError(t, CheckPasswordHash(hash), hash)
+	}
+
+	invalid := []string{
+		"password",
+		"$apr1$salt$hash",
+		"$argon2id$v=16$m=65536,t=3,p=4$c2FsdHNhbHQ$aGFzaGhhc2hoYXNo",
+		"$argon2id$v=19$m=65536,t=3$c2FsdHNhbHQ$aGFzaGhhc2hoYXNo",
+		"$argon2id$v=19$m=65536,t=3,p=4$c2FsdHNhbHQ",
+		"$scrypt$ln=15,r=8,p=1$c2FsdHNhbHQ$!!!",
+		"$scrypt$ln=0,r=8,p=1$c2FsdHNhbHQ$aGFzaGhhc2hoYXNo",
+	}
+
+	for _, hash := range invalid {
+		assert.Error(t, CheckPasswordHash(hash), hash)
+	}
+}
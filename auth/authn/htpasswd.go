@@ -0,0 +1,145 @@
+package authn
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+// ParseHtpasswd parses htpasswd file contents (as managed by Apache's htpasswd tool).
+//
+// Only bcrypt hashes (htpasswd -B) are supported, other algorithms result in an error.
+// Empty lines and lines starting with # are ignored.
+func ParseHtpasswd(data []byte) ([]User, error) {
+	var users []User
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		username, hash, ok := strings.Cut(line, ":")
+		if !ok || username == "" || hash == "" {
+			return nil, fmt.Errorf("line %d: invalid format", lineNumber)
+		}
+
+		if !isBcryptHash(hash) {
+			return nil, fmt.Errorf("line %d: user %q: unsupported hash algorithm (only bcrypt is supported)", lineNumber, username)
+		}
+
+		users = append(users, User{
+			Enabled:      true,
+			Username:     username,
+			PasswordHash: hash,
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func isBcryptHash(hash string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(hash, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HtpasswdAuthenticator authenticates users listed in an htpasswd file.
+//
+// The file is checked for changes before every lookup and reloaded if it changed,
+// so users can be added or removed without a restart.
+// If reloading fails, the previously loaded users remain in effect.
+type HtpasswdAuthenticator struct {
+	path string
+
+	mu            sync.Mutex
+	modTime       time.Time
+	size          int64
+	authenticator UserAuthenticator
+}
+
+// NewHtpasswdAuthenticator returns a new HtpasswdAuthenticator loading users from the file at path.
+func NewHtpasswdAuthenticator(path string) (*HtpasswdAuthenticator, error) {
+	a := &HtpasswdAuthenticator{
+		path: path,
+	}
+
+	if err := a.reload(); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// AuthenticatePassword implements auth.PasswordAuthenticator.
+func (a *HtpasswdAuthenticator) AuthenticatePassword(ctx context.Context, username string, password string) (auth.Subject, error) {
+	return a.users().AuthenticatePassword(ctx, username, password)
+}
+
+// GetSubjectByID implements SubjectRepository.
+func (a *HtpasswdAuthenticator) GetSubjectByID(ctx context.Context, id auth.SubjectID) (auth.Subject, error) {
+	return a.users().GetSubjectByID(ctx, id)
+}
+
+func (a *HtpasswdAuthenticator) users() UserAuthenticator {
+	// Errors are deliberately ignored: keep serving the last valid version of the file
+	_ = a.reload()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.authenticator
+}
+
+// reload parses the file if it changed since it was last loaded.
+func (a *HtpasswdAuthenticator) reload() error {
+	info, err := os.Stat(a.path)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	unchanged := info.ModTime().Equal(a.modTime) && info.Size() == a.size
+	a.mu.Unlock()
+
+	if unchanged {
+		return nil
+	}
+
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		return err
+	}
+
+	users, err := ParseHtpasswd(data)
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", a.path, err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.modTime = info.ModTime()
+	a.size = info.Size()
+	a.authenticator = NewUserAuthenticator(users)
+
+	return nil
+}
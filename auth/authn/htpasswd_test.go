@@ -0,0 +1,98 @@
+package authn
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+func htpasswdEntry(t *testing.T, username string, password string) string {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	return username + ":" + string(hash) + "\n"
+}
+
+func TestParseHtpasswd(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		data := "# comment\n\nuser:$2y$05$abcdefghijklmnopqrstuu5Rn1/iSpOpV/JvBqV3/KJcgMnNPQ0cy\n"
+
+		users, err := ParseHtpasswd([]byte(data))
+		require.NoError(t, err)
+
+		require.Len(t, users, 1)
+		assert.Equal(t, "user", users[0].Username)
+		assert.True(t, users[0].Enabled)
+	})
+
+	t.Run("UnsupportedHash", func(t *testing.T) {
+		_, err := ParseHtpasswd([]byte("user:$apr1$salt$hash\n"))
+		require.Error(t, err)
+	})
+
+	t.Run("InvalidFormat", func(t *testing.T) {
+		_, err := ParseHtpasswd([]byte("user\n"))
+		require.Error(t, err)
+	})
+}
+
+func TestHtpasswdAuthenticator(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+
+	err := os.WriteFile(path, []byte(htpasswdEntry(t, "user", "password")), 0o600)
+	require.NoError(t, err)
+
+	authenticator, err := NewHtpasswdAuthenticator(path)
+	require.NoError(t, err)
+
+	subject, err := authenticator.AuthenticatePassword(context.Background(), "user", "password")
+	require.NoError(t, err)
+	assert.Equal(t, auth.SubjectID("user"), subject.ID())
+
+	_, err = authenticator.AuthenticatePassword(context.Background(), "user", "wrong")
+	require.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+
+	_, err = authenticator.AuthenticatePassword(context.Background(), "other", "password")
+	require.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+
+	t.Run("Reload", func(t *testing.T) {
+		data := htpasswdEntry(t, "user", "password") + htpasswdEntry(t, "other", "password")
+
+		err := os.WriteFile(path, []byte(data), 0o600)
+		require.NoError(t, err)
+
+		// Make sure the change is detected even on file systems with coarse timestamps
+		err = os.Chtimes(path, time.Now(), time.Now().Add(time.Minute))
+		require.NoError(t, err)
+
+		subject, err := authenticator.AuthenticatePassword(context.Background(), "other", "password")
+		require.NoError(t, err)
+		assert.Equal(t, auth.SubjectID("other"), subject.ID())
+
+		subject, err = authenticator.GetSubjectByID(context.Background(), "other")
+		require.NoError(t, err)
+		assert.Equal(t, auth.SubjectID("other"), subject.ID())
+	})
+
+	t.Run("InvalidReload", func(t *testing.T) {
+		err := os.WriteFile(path, []byte("broken\n"), 0o600)
+		require.NoError(t, err)
+
+		err = os.Chtimes(path, time.Now(), time.Now().Add(2*time.Minute))
+		require.NoError(t, err)
+
+		// The last valid version remains in effect
+		_, err = authenticator.AuthenticatePassword(context.Background(), "user", "password")
+		require.NoError(t, err)
+	})
+}
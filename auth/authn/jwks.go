@@ -0,0 +1,254 @@
+package authn
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+// jwksMinRefreshInterval limits how often unknown key IDs trigger fetching the key set,
+// so that tokens with made up key IDs cannot be used to flood the identity provider.
+const jwksMinRefreshInterval = time.Minute
+
+var errUnknownSigningKey = errors.New("unknown signing key")
+
+// jwksCache caches a JSON Web Key Set (RFC 7517) fetched from a URL.
+//
+// Keys are refreshed periodically and whenever a token is signed by an unknown key (eg. after the provider rotated its keys).
+// If refreshing fails, the previously fetched keys remain in use.
+type jwksCache struct {
+	url             string
+	client          *http.Client
+	refreshInterval time.Duration
+	clock           auth.Clock
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+// key returns the key identified by kid.
+//
+// An empty kid is accepted if the key set contains a single key.
+func (c *jwksCache) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock.Now()
+
+	if err := c.load(ctx, now); err != nil {
+		return nil, err
+	}
+
+	if key, ok := c.lookup(kid); ok {
+		return key, nil
+	}
+
+	// The provider may have rotated its keys since the last refresh
+	if now.Sub(c.attemptedAt) >= jwksMinRefreshInterval {
+		if err := c.refresh(ctx, now); err != nil {
+			return nil, err
+		}
+
+		if key, ok := c.lookup(kid); ok {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w %q", errUnknownSigningKey, kid)
+}
+
+// check makes sure keys are available.
+func (c *jwksCache) check(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.load(ctx, c.clock.Now())
+}
+
+// load refreshes the keys if they are stale. It only fails if no keys were fetched before.
+func (c *jwksCache) load(ctx context.Context, now time.Time) error {
+	if c.keys != nil && now.Sub(c.fetchedAt) < c.refreshInterval {
+		return nil
+	}
+
+	// Keep using stale keys for a while instead of retrying on every request if the provider is unavailable
+	if c.keys != nil && now.Sub(c.attemptedAt) < jwksMinRefreshInterval {
+		return nil
+	}
+
+	if err := c.refresh(ctx, now); err != nil && c.keys == nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *jwksCache) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(c.keys) == 1 {
+		for _, key := range c.keys {
+			return key, true
+		}
+	}
+
+	key, ok := c.keys[kid]
+
+	return key, ok
+}
+
+func (c *jwksCache) refresh(ctx context.Context, now time.Time) error {
+	c.attemptedAt = now
+
+	keys, err := fetchJWKS(ctx, c.client, c.url)
+	if err != nil {
+		return fmt.Errorf("fetching JWKS: %w", err)
+	}
+
+	c.keys = keys
+	c.fetchedAt = now
+
+	return nil
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func fetchJWKS(ctx context.Context, client *http.Client, url string) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	var set jwkSet
+
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+
+	for _, key := range set.Keys {
+		// Skip encryption keys and key types we cannot verify signatures with
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		publicKey, err := key.publicKey()
+		if err != nil {
+			continue
+		}
+
+		keys[key.Kid] = publicKey
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no usable signing keys")
+	}
+
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeJWKInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeJWKInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		x, err := decodeJWKInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeJWKInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		if !curve.IsOnCurve(x, y) { //nolint:staticcheck
+			return nil, errors.New("point is not on the curve")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeJWKInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) == 0 {
+		return nil, errors.New("empty value")
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
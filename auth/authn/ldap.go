@@ -0,0 +1,281 @@
+package authn
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+// LDAPConfig configures an LDAPAuthenticator.
+type LDAPConfig struct {
+	// URL of the LDAP server (ldap:// or ldaps://).
+	URL string
+
+	// BindDN and BindPassword are the credentials of the account used for searching users.
+	// Searches are anonymous if BindDN is empty.
+	BindDN       string
+	BindPassword string
+
+	// BaseDN is where users are searched (in the whole subtree).
+	BaseDN string
+
+	// UserFilter is the search filter for finding a user.
+	// Occurrences of {username} are replaced by the (escaped) username.
+	//
+	// For example: (&(objectClass=person)(uid={username}))
+	UserFilter string
+
+	// Attributes lists the LDAP attributes (eg. mail, memberOf) copied to subject attributes.
+	// Multiple values are joined by commas.
+	Attributes []string
+
+	// EmailAttribute, DisplayNameAttribute and GroupsAttribute are the LDAP attributes
+	// populating the typed identity of users (mail, displayName and memberOf by default).
+	EmailAttribute       string
+	DisplayNameAttribute string
+	GroupsAttribute      string
+
+	// StartTLS upgrades ldap:// connections to TLS before binding.
+	StartTLS bool
+
+	// Timeout limits the time spent talking to the LDAP server during an authentication (optional).
+	Timeout time.Duration
+}
+
+// Validate validates the configuration.
+func (c LDAPConfig) Validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("url: %w", err)
+	}
+
+	if u.Scheme != "ldap" && u.Scheme != "ldaps" {
+		return fmt.Errorf("url: scheme must be ldap or ldaps")
+	}
+
+	if c.StartTLS && u.Scheme == "ldaps" {
+		return fmt.Errorf("startTLS cannot be used with ldaps")
+	}
+
+	if c.BaseDN == "" {
+		return fmt.Errorf("base DN is required")
+	}
+
+	if !strings.Contains(c.UserFilter, "{username}") {
+		return fmt.Errorf("user filter must contain {username}")
+	}
+
+	if _, err := ldap.CompileFilter(strings.ReplaceAll(c.UserFilter, "{username}", "username")); err != nil {
+		return fmt.Errorf("user filter: %w", err)
+	}
+
+	return nil
+}
+
+// LDAPAuthenticator authenticates users by binding to an LDAP (or Active Directory) server.
+//
+// Users are looked up using a search account, then a bind with the DN found and the supplied password verifies the credentials.
+// A new connection is opened for every authentication.
+type LDAPAuthenticator struct {
+	config LDAPConfig
+
+	dial func(ctx context.Context, config LDAPConfig) (ldapConn, error)
+}
+
+// ldapConn is the subset of [ldap.Conn] used by LDAPAuthenticator.
+type ldapConn interface {
+	Bind(username string, password string) error
+	Search(searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+// NewLDAPAuthenticator returns a new LDAPAuthenticator.
+func NewLDAPAuthenticator(config LDAPConfig) LDAPAuthenticator {
+	if config.EmailAttribute == "" {
+		config.EmailAttribute = "mail"
+	}
+
+	if config.DisplayNameAttribute == "" {
+		config.DisplayNameAttribute = "displayName"
+	}
+
+	if config.GroupsAttribute == "" {
+		config.GroupsAttribute = "memberOf"
+	}
+
+	return LDAPAuthenticator{
+		config: config,
+		dial:   dialLDAP,
+	}
+}
+
+// dialLDAP connects to the LDAP server (upgrading the connection to TLS if configured).
+//
+// The connection is subject to the deadline of ctx (if any) for its whole lifetime.
+func dialLDAP(ctx context.Context, config LDAPConfig) (ldapConn, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: parsing url: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName: u.Hostname(),
+		MinVersion: tls.VersionTLS12,
+	}
+
+	dialer := &net.Dialer{Timeout: ldap.DefaultTimeout}
+
+	deadline, hasDeadline := ctx.Deadline()
+	if hasDeadline {
+		dialer.Deadline = deadline
+	}
+
+	conn, err := ldap.DialURL(config.URL, ldap.DialWithDialer(dialer), ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("ldap: %w", err)
+	}
+
+	if hasDeadline {
+		conn.SetTimeout(time.Until(deadline))
+	}
+
+	if config.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+
+			return nil, fmt.Errorf("ldap: starting TLS: %w", err)
+		}
+	}
+
+	return conn, nil
+}
+
+// AuthenticatePassword implements auth.PasswordAuthenticator.
+func (a LDAPAuthenticator) AuthenticatePassword(ctx context.Context, username string, password string) (auth.Subject, error) {
+	// An empty password would result in an unauthenticated bind (RFC 4513) that most servers accept
+	if username == "" || password == "" {
+		return nil, auth.ErrInvalidCredentials
+	}
+
+	return a.withConn(ctx, func(conn ldapConn) (auth.Subject, error) {
+		entry, err := a.findUser(conn, username)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := conn.Bind(entry.DN, password); err != nil {
+			if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+				return nil, auth.ErrInvalidCredentials
+			}
+
+			return nil, err
+		}
+
+		return a.user(username, entry), nil
+	})
+}
+
+// GetSubjectByID implements SubjectRepository.
+func (a LDAPAuthenticator) GetSubjectByID(ctx context.Context, id auth.SubjectID) (auth.Subject, error) {
+	return a.withConn(ctx, func(conn ldapConn) (auth.Subject, error) {
+		entry, err := a.findUser(conn, string(id))
+		if err != nil {
+			return nil, err
+		}
+
+		return a.user(string(id), entry), nil
+	})
+}
+
+// Check implements auth.Checker by connecting to the server (and binding the search account, if any).
+func (a LDAPAuthenticator) Check(ctx context.Context) error {
+	_, err := a.withConn(ctx, func(ldapConn) (auth.Subject, error) {
+		return nil, nil
+	})
+
+	return err
+}
+
+func (a LDAPAuthenticator) withConn(ctx context.Context, fn func(conn ldapConn) (auth.Subject, error)) (auth.Subject, error) {
+	if a.config.Timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, a.config.Timeout)
+		defer cancel()
+	}
+
+	conn, err := a.dial(ctx, a.config)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if a.config.BindDN != "" {
+		if err := conn.Bind(a.config.BindDN, a.config.BindPassword); err != nil {
+			return nil, fmt.Errorf("ldap: binding search account: %w", err)
+		}
+	}
+
+	return fn(conn)
+}
+
+func (a LDAPAuthenticator) findUser(conn ldapConn, username string) (*ldap.Entry, error) {
+	filter := strings.ReplaceAll(a.config.UserFilter, "{username}", ldap.EscapeFilter(username))
+
+	attributes := append([]string{a.config.EmailAttribute, a.config.DisplayNameAttribute, a.config.GroupsAttribute}, a.config.Attributes...)
+
+	// Ask for two entries to detect ambiguous filters
+	request := ldap.NewSearchRequest(
+		a.config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, 0, false,
+		filter,
+		attributes,
+		nil,
+	)
+
+	result, err := conn.Search(request)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("ldap: user filter matches multiple entries for %q", username)
+	} else if err != nil {
+		return nil, err
+	}
+
+	switch len(result.Entries) {
+	case 0:
+		return nil, auth.ErrInvalidCredentials
+
+	case 1:
+		return result.Entries[0], nil
+	}
+
+	return nil, fmt.Errorf("ldap: user filter matches multiple entries for %q", username)
+}
+
+func (a LDAPAuthenticator) user(username string, entry *ldap.Entry) User {
+	attrs := make(map[string]string, len(a.config.Attributes))
+
+	for _, attribute := range a.config.Attributes {
+		// Attribute names are case-insensitive
+		if values := entry.GetEqualFoldAttributeValues(attribute); len(values) > 0 {
+			attrs[attribute] = strings.Join(values, ",")
+		}
+	}
+
+	return User{
+		Enabled:     true,
+		Username:    username,
+		Email:       entry.GetEqualFoldAttributeValue(a.config.EmailAttribute),
+		DisplayName: entry.GetEqualFoldAttributeValue(a.config.DisplayNameAttribute),
+		Groups:      entry.GetEqualFoldAttributeValues(a.config.GroupsAttribute),
+		Attrs:       attrs,
+	}
+}
@@ -0,0 +1,189 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+// ldapServerStub is an in-memory directory.
+type ldapServerStub struct {
+	// passwords maps DNs to passwords
+	passwords map[string]string
+
+	// entries maps search filters to the entries they match
+	entries map[string][]*ldap.Entry
+}
+
+func (s ldapServerStub) dial(_ context.Context, _ LDAPConfig) (ldapConn, error) {
+	return ldapConnStub{s}, nil
+}
+
+type ldapConnStub struct {
+	server ldapServerStub
+}
+
+func (c ldapConnStub) Bind(username string, password string) error {
+	if expected, ok := c.server.passwords[username]; !ok || expected != password {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+	}
+
+	return nil
+}
+
+func (c ldapConnStub) Search(searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	entries := c.server.entries[searchRequest.Filter]
+
+	if searchRequest.SizeLimit > 0 && len(entries) > searchRequest.SizeLimit {
+		return &ldap.SearchResult{Entries: entries[:searchRequest.SizeLimit]}, ldap.NewError(ldap.LDAPResultSizeLimitExceeded, errors.New("size limit exceeded"))
+	}
+
+	return &ldap.SearchResult{Entries: entries}, nil
+}
+
+func (ldapConnStub) Close() error {
+	return nil
+}
+
+func newLDAPAuthenticatorStub() LDAPAuthenticator {
+	john := ldap.NewEntry("uid=john,dc=example,dc=com", map[string][]string{
+		"mail":        {"john@example.com"},
+		"displayName": {"John Doe"},
+		"memberOf":    {"cn=admins,dc=example,dc=com", "cn=developers,dc=example,dc=com"},
+	})
+
+	server := ldapServerStub{
+		passwords: map[string]string{
+			"cn=search,dc=example,dc=com": "search",
+			"uid=john,dc=example,dc=com":  "password",
+		},
+		entries: map[string][]*ldap.Entry{
+			"(&(objectClass=person)(uid=john))":         {john},
+			"(&(objectClass=person)(uid=\\2a))":         {john},
+			"(&(objectClass=person)(uid=ambiguous))":    {john, john},
+			"(&(objectClass=person)(uid=jo\\28hn\\29))": {john},
+		},
+	}
+
+	authenticator := NewLDAPAuthenticator(LDAPConfig{
+		URL:          "ldap://ldap.example.com",
+		BindDN:       "cn=search,dc=example,dc=com",
+		BindPassword: "search",
+		BaseDN:       "dc=example,dc=com",
+		UserFilter:   "(&(objectClass=person)(uid={username}))",
+		Attributes:   []string{"mail", "memberOf"},
+	})
+	authenticator.dial = server.dial
+
+	return authenticator
+}
+
+func TestLDAPAuthenticator(t *testing.T) {
+	authenticator := newLDAPAuthenticatorStub()
+
+	t.Run("OK", func(t *testing.T) {
+		subject, err := authenticator.AuthenticatePassword(context.Background(), "john", "password")
+		require.NoError(t, err)
+
+		assert.Equal(t, auth.SubjectID("john"), subject.ID())
+
+		expected := map[string]string{
+			"mail":     "john@example.com",
+			"memberOf": "cn=admins,dc=example,dc=com,cn=developers,dc=example,dc=com",
+		}
+
+		assert.Equal(t, expected, subject.Attributes())
+
+		identity, ok := auth.GetSubjectIdentity(subject)
+		require.True(t, ok)
+
+		expectedIdentity := auth.Identity{
+			Email:       "john@example.com",
+			DisplayName: "John Doe",
+			Groups:      []string{"cn=admins,dc=example,dc=com", "cn=developers,dc=example,dc=com"},
+		}
+
+		assert.Equal(t, expectedIdentity, identity)
+	})
+
+	t.Run("InvalidPassword", func(t *testing.T) {
+		_, err := authenticator.AuthenticatePassword(context.Background(), "john", "wrong")
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	})
+
+	t.Run("EmptyPassword", func(t *testing.T) {
+		_, err := authenticator.AuthenticatePassword(context.Background(), "john", "")
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	})
+
+	t.Run("UnknownUser", func(t *testing.T) {
+		_, err := authenticator.AuthenticatePassword(context.Background(), "jane", "password")
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	})
+
+	t.Run("EscapedUsername", func(t *testing.T) {
+		subject, err := authenticator.AuthenticatePassword(context.Background(), "jo(hn)", "password")
+		require.NoError(t, err)
+
+		assert.Equal(t, auth.SubjectID("jo(hn)"), subject.ID())
+
+		_, err = authenticator.AuthenticatePassword(context.Background(), "*", "password")
+		require.NoError(t, err, "wildcards should be escaped")
+	})
+
+	t.Run("AmbiguousFilter", func(t *testing.T) {
+		_, err := authenticator.AuthenticatePassword(context.Background(), "ambiguous", "password")
+		require.Error(t, err)
+
+		assert.NotErrorIs(t, err, auth.ErrAuthenticationFailed)
+	})
+
+	t.Run("SearchAccountFailure", func(t *testing.T) {
+		authenticator := authenticator
+		authenticator.config.BindPassword = "wrong"
+
+		_, err := authenticator.AuthenticatePassword(context.Background(), "john", "password")
+		require.Error(t, err)
+
+		// A misconfigured search account is not a credential problem
+		assert.NotErrorIs(t, err, auth.ErrAuthenticationFailed)
+	})
+
+	t.Run("GetSubjectByID", func(t *testing.T) {
+		subject, err := authenticator.GetSubjectByID(context.Background(), "john")
+		require.NoError(t, err)
+
+		assert.Equal(t, auth.SubjectID("john"), subject.ID())
+
+		_, err = authenticator.GetSubjectByID(context.Background(), "jane")
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	})
+}
+
+func TestLDAPConfig_Validate(t *testing.T) {
+	config := LDAPConfig{
+		URL:        "ldap://ldap.example.com",
+		BaseDN:     "dc=example,dc=com",
+		UserFilter: "(uid={username})",
+		StartTLS:   true,
+	}
+
+	require.NoError(t, config.Validate())
+
+	for _, filter := range []string{"uid={username}", "(uid={username}", "(&(uid={username})"} {
+		config := config
+		config.UserFilter = filter
+
+		assert.Error(t, config.Validate(), filter)
+	}
+
+	config.URL = "ldaps://ldap.example.com"
+
+	assert.Error(t, config.Validate(), "startTLS should not be used with ldaps")
+}
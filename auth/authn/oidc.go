@@ -0,0 +1,255 @@
+package authn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+// oidcSigningMethods lists the signing algorithms accepted in ID tokens.
+var oidcSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// OIDCConfig configures an OIDCAuthenticator.
+type OIDCConfig struct {
+	// Issuer must match the "iss" claim of tokens.
+	Issuer string
+
+	// Audience must be listed in the "aud" claim of tokens (eg. the client ID of the registry at the identity provider).
+	Audience string
+
+	// JWKSURL is where the signing keys of the issuer are published.
+	JWKSURL string
+
+	// SubjectID composes the subject ID from claims (defaults to {sub}).
+	// Use eg. {iss}|{sub} to keep subjects of different identity providers apart.
+	SubjectID auth.SubjectIDTemplate
+
+	// GroupsClaim is the claim listing the groups of the subject (defaults to groups).
+	GroupsClaim string
+
+	// RefreshInterval is how often signing keys are refreshed (defaults to 1 hour).
+	// Tokens signed by an unknown key trigger a refresh regardless (at most once a minute).
+	RefreshInterval time.Duration
+
+	// MaxClockSkew rejects tokens issued more than MaxClockSkew in the future (disabled if zero).
+	// See [CheckTimestamps].
+	MaxClockSkew time.Duration
+
+	// HTTPClient fetches signing keys (defaults to a client with a 10 second timeout).
+	HTTPClient *http.Client
+}
+
+// Validate validates the configuration.
+func (c OIDCConfig) Validate() error {
+	if c.Issuer == "" {
+		return errors.New("issuer is required")
+	}
+
+	if c.Audience == "" {
+		return errors.New("audience is required")
+	}
+
+	u, err := url.Parse(c.JWKSURL)
+	if err != nil {
+		return fmt.Errorf("jwksURL: %w", err)
+	}
+
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return errors.New("jwksURL: scheme must be http or https")
+	}
+
+	if c.RefreshInterval < 0 {
+		return errors.New("refreshInterval cannot be negative")
+	}
+
+	if c.MaxClockSkew < 0 {
+		return errors.New("maxClockSkew cannot be negative")
+	}
+
+	return nil
+}
+
+// OIDCAuthenticator authenticates subjects presenting an ID token issued by an OpenID Connect provider.
+//
+// Tokens are verified against the signing keys of the provider and their "iss", "aud", "exp", "nbf" and (optionally) "iat" claims are checked.
+// The subject carries the string claims of the token as attributes and the email, name and groups claims as its identity.
+type OIDCAuthenticator struct {
+	config OIDCConfig
+
+	keys  *jwksCache
+	clock auth.Clock
+}
+
+// NewOIDCAuthenticator returns a new OIDCAuthenticator.
+func NewOIDCAuthenticator(config OIDCConfig, opts ...OIDCAuthenticatorOption) OIDCAuthenticator {
+	if config.SubjectID.String() == "" {
+		config.SubjectID, _ = auth.ParseSubjectIDTemplate("{sub}")
+	}
+
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+
+	if config.RefreshInterval == 0 {
+		config.RefreshInterval = time.Hour
+	}
+
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	a := OIDCAuthenticator{
+		config: config,
+	}
+
+	for _, opt := range opts {
+		opt.applyOIDCAuthenticator(&a)
+	}
+
+	if a.clock == nil {
+		a.clock = auth.Dependencies{}.GetClock()
+	}
+
+	a.keys = &jwksCache{
+		url:             config.JWKSURL,
+		client:          config.HTTPClient,
+		refreshInterval: config.RefreshInterval,
+		clock:           a.clock,
+	}
+
+	return a
+}
+
+// AuthenticateBearerToken implements auth.BearerTokenAuthenticator.
+func (a OIDCAuthenticator) AuthenticateBearerToken(ctx context.Context, token string) (auth.Subject, error) {
+	claims := jwt.MapClaims{}
+
+	// Fetching keys may fail because of the provider: report it as a backend error rather than invalid credentials
+	var keyErr error
+
+	// Claims are validated below, using the clock of the authenticator
+	parser := jwt.NewParser(jwt.WithValidMethods(oidcSigningMethods), jwt.WithoutClaimsValidation())
+
+	_, err := parser.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		key, err := a.keys.key(ctx, kid)
+		if err != nil {
+			keyErr = err
+		}
+
+		return key, err
+	})
+	if keyErr != nil && !errors.Is(keyErr, errUnknownSigningKey) {
+		return nil, keyErr
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %v", auth.ErrInvalidCredentials, err)
+	}
+
+	if err := a.validateClaims(claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", auth.ErrInvalidCredentials, err)
+	}
+
+	return a.user(claims)
+}
+
+// Check implements auth.Checker by making sure the signing keys of the provider can be fetched.
+func (a OIDCAuthenticator) Check(ctx context.Context) error {
+	return a.keys.check(ctx)
+}
+
+func (a OIDCAuthenticator) validateClaims(claims jwt.MapClaims) error {
+	clockNow := a.clock.Now()
+	now := clockNow.Unix()
+
+	if !claims.VerifyIssuer(a.config.Issuer, true) {
+		return errors.New("unexpected issuer")
+	}
+
+	if !claims.VerifyAudience(a.config.Audience, true) {
+		return errors.New("unexpected audience")
+	}
+
+	if !claims.VerifyExpiresAt(now, true) {
+		return errors.New("token is expired or has no expiration")
+	}
+
+	if !claims.VerifyNotBefore(now, false) {
+		return errors.New("token is not valid yet")
+	}
+
+	timestamps := jwt.RegisteredClaims{
+		IssuedAt:  numericDateClaim(claims, "iat"),
+		NotBefore: numericDateClaim(claims, "nbf"),
+	}
+
+	return CheckTimestamps(timestamps, clockNow, a.config.MaxClockSkew)
+}
+
+// numericDateClaim returns a NumericDate claim (or nil if it is missing or malformed).
+func numericDateClaim(claims jwt.MapClaims, name string) *jwt.NumericDate {
+	switch v := claims[name].(type) {
+	case float64:
+		return jwt.NewNumericDate(time.Unix(int64(v), 0))
+
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return nil
+		}
+
+		return jwt.NewNumericDate(time.Unix(n, 0))
+	}
+
+	return nil
+}
+
+func (a OIDCAuthenticator) user(claims jwt.MapClaims) (User, error) {
+	attrs := make(map[string]string, len(claims))
+
+	for name, value := range claims {
+		if s, ok := value.(string); ok {
+			attrs[name] = s
+		}
+	}
+
+	id, err := a.config.SubjectID.Execute(attrs)
+	if err != nil {
+		return User{}, err
+	}
+
+	user := User{
+		Enabled:     true,
+		Username:    string(id),
+		Email:       attrs["email"],
+		DisplayName: attrs["name"],
+		Attrs:       attrs,
+	}
+
+	switch groups := claims[a.config.GroupsClaim].(type) {
+	case []any:
+		for _, group := range groups {
+			if s, ok := group.(string); ok {
+				user.Groups = append(user.Groups, s)
+			}
+		}
+
+	case string:
+		user.Groups = []string{groups}
+	}
+
+	return user, nil
+}
+
+// OIDCAuthenticatorOption configures an OIDCAuthenticator.
+type OIDCAuthenticatorOption interface {
+	applyOIDCAuthenticator(a *OIDCAuthenticator)
+}
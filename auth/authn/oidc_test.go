@@ -0,0 +1,225 @@
+package authn
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+type oidcProviderStub struct {
+	mu       sync.Mutex
+	keys     map[string]*rsa.PrivateKey
+	requests int
+	down     bool
+}
+
+func (p *oidcProviderStub) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.requests++
+
+	if p.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+
+		return
+	}
+
+	var set jwkSet
+
+	for kid, key := range p.keys {
+		set.Keys = append(set.Keys, jwk{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+
+	_ = json.NewEncoder(w).Encode(set)
+}
+
+func (p *oidcProviderStub) rotate(t *testing.T, kid string) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.keys = map[string]*rsa.PrivateKey{kid: key}
+
+	return key
+}
+
+func signIDToken(t *testing.T, kid string, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+
+	signedToken, err := token.SignedString(key)
+	require.NoError(t, err)
+
+	return signedToken
+}
+
+func TestOIDCAuthenticator(t *testing.T) {
+	const (
+		issuer   = "https://idp.example.com"
+		audience = "registry"
+	)
+
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	clock := clockwork.NewFakeClockAt(now)
+
+	provider := &oidcProviderStub{}
+	key := provider.rotate(t, "key-1")
+
+	server := httptest.NewServer(provider)
+	defer server.Close()
+
+	subjectID, err := auth.ParseSubjectIDTemplate("{iss}|{sub}")
+	require.NoError(t, err)
+
+	authenticator := NewOIDCAuthenticator(OIDCConfig{
+		Issuer:       issuer,
+		Audience:     audience,
+		JWKSURL:      server.URL,
+		SubjectID:    subjectID,
+		MaxClockSkew: 5 * time.Minute,
+	}, WithClock(clock))
+
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":    issuer,
+			"aud":    []string{audience, "other"},
+			"sub":    "1234",
+			"email":  "user@example.com",
+			"name":   "User",
+			"groups": []string{"developers", "admins"},
+			"exp":    now.Add(time.Hour).Unix(),
+			"nbf":    now.Add(-time.Minute).Unix(),
+			"iat":    now.Add(time.Minute).Unix(),
+		}
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		subject, err := authenticator.AuthenticateBearerToken(context.Background(), signIDToken(t, "key-1", key, validClaims()))
+		require.NoError(t, err)
+
+		assert.Equal(t, auth.SubjectID("https://idp.example.com|1234"), subject.ID())
+
+		email, _ := subject.Attribute("email")
+		assert.Equal(t, "user@example.com", email)
+
+		identity, ok := auth.GetSubjectIdentity(subject)
+		require.True(t, ok)
+
+		assert.Equal(t, auth.Identity{
+			Email:       "user@example.com",
+			DisplayName: "User",
+			Groups:      []string{"developers", "admins"},
+		}, identity)
+	})
+
+	testCases := map[string]func(claims jwt.MapClaims){
+		"Expired":        func(claims jwt.MapClaims) { claims["exp"] = now.Add(-time.Second).Unix() },
+		"NoExpiration":   func(claims jwt.MapClaims) { delete(claims, "exp") },
+		"NotValidYet":    func(claims jwt.MapClaims) { claims["nbf"] = now.Add(time.Minute).Unix() },
+		"IssuedInFuture": func(claims jwt.MapClaims) { claims["iat"] = now.Add(time.Hour).Unix() },
+		"WrongIssuer":    func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example.com" },
+		"WrongAudience":  func(claims jwt.MapClaims) { claims["aud"] = "other" },
+		"MissingSubject": func(claims jwt.MapClaims) { delete(claims, "sub") },
+	}
+
+	for name, modify := range testCases {
+		modify := modify
+
+		t.Run(name, func(t *testing.T) {
+			claims := validClaims()
+			modify(claims)
+
+			_, err := authenticator.AuthenticateBearerToken(context.Background(), signIDToken(t, "key-1", key, claims))
+			require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+		})
+	}
+
+	t.Run("WrongKey", func(t *testing.T) {
+		otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+
+		_, err = authenticator.AuthenticateBearerToken(context.Background(), signIDToken(t, "key-1", otherKey, validClaims()))
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	})
+
+	t.Run("KeyRotation", func(t *testing.T) {
+		clock.Advance(2 * time.Minute)
+
+		newKey := provider.rotate(t, "key-2")
+
+		// Unknown key IDs trigger a refresh
+		subject, err := authenticator.AuthenticateBearerToken(context.Background(), signIDToken(t, "key-2", newKey, validClaims()))
+		require.NoError(t, err)
+
+		assert.Equal(t, auth.SubjectID("https://idp.example.com|1234"), subject.ID())
+
+		_, err = authenticator.AuthenticateBearerToken(context.Background(), signIDToken(t, "key-1", key, validClaims()))
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+
+		// Refreshes triggered by unknown key IDs are rate limited
+		requests := provider.requests
+
+		_, err = authenticator.AuthenticateBearerToken(context.Background(), signIDToken(t, "key-3", newKey, validClaims()))
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+
+		assert.Equal(t, requests, provider.requests)
+	})
+
+	t.Run("ProviderDown", func(t *testing.T) {
+		provider.mu.Lock()
+		provider.down = true
+		provider.mu.Unlock()
+
+		// Keys keep working after the refresh interval if the provider is unavailable
+		clock.Advance(2 * time.Hour)
+
+		claims := validClaims()
+		claims["exp"] = clock.Now().Add(time.Hour).Unix()
+
+		_, err := authenticator.AuthenticateBearerToken(context.Background(), signIDToken(t, "key-2", provider.keys["key-2"], claims))
+		require.NoError(t, err)
+
+		require.NoError(t, authenticator.Check(context.Background()))
+
+		// Without keys fetched before, the failure is reported as a backend error
+		authenticator := NewOIDCAuthenticator(OIDCConfig{
+			Issuer:   issuer,
+			Audience: audience,
+			JWKSURL:  server.URL,
+		}, WithClock(clock))
+
+		_, err = authenticator.AuthenticateBearerToken(context.Background(), signIDToken(t, "key-2", provider.keys["key-2"], claims))
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, auth.ErrAuthenticationFailed)
+
+		require.Error(t, authenticator.Check(context.Background()))
+	})
+}
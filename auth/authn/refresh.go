@@ -0,0 +1,282 @@
+package authn
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+// refreshTokenLength is the number of random bytes in a refresh token issued by StoredRefreshTokenIssuer.
+const refreshTokenLength = 32
+
+// RefreshTokenRecord is a refresh token persisted in a RefreshTokenStore.
+type RefreshTokenRecord struct {
+	// ID identifies the token (see [RefreshTokenID]).
+	ID string
+
+	SubjectID auth.SubjectID
+	Service   string
+
+	// AuthTime is the time the Subject originally authenticated at.
+	AuthTime time.Time
+
+	// ExpiresAt is zero if the token does not expire.
+	ExpiresAt time.Time
+
+	Revoked bool
+}
+
+// RefreshTokenStore persists issued refresh tokens, so that they can be revoked.
+type RefreshTokenStore interface {
+	// Save persists a newly issued refresh token.
+	Save(ctx context.Context, record RefreshTokenRecord) error
+
+	// Get returns a refresh token by ID. The second return value is false if the token is unknown.
+	Get(ctx context.Context, id string) (RefreshTokenRecord, bool, error)
+
+	// Revoke revokes a refresh token by ID. Revoking an unknown token is not an error.
+	Revoke(ctx context.Context, id string) error
+
+	// RevokeAllForSubject revokes every refresh token issued to a Subject.
+	RevokeAllForSubject(ctx context.Context, subject auth.SubjectID) error
+}
+
+// RefreshTokenID returns the ID of a refresh token issued by StoredRefreshTokenIssuer.
+//
+// Stores only see token IDs (not the tokens themselves), so a leaked store cannot be used to refresh tokens.
+func RefreshTokenID(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// StoredRefreshTokenIssuer issues opaque refresh tokens persisted in a RefreshTokenStore.
+//
+// Unlike self-contained (eg. JWT) refresh tokens, stored tokens can be revoked before they expire:
+// verifying a revoked (or unknown) token fails.
+type StoredRefreshTokenIssuer struct {
+	store      RefreshTokenStore
+	expiration time.Duration
+
+	clock auth.Clock
+	rand  io.Reader
+}
+
+// NewStoredRefreshTokenIssuer returns a new StoredRefreshTokenIssuer.
+//
+// Tokens never expire if expiration is zero.
+func NewStoredRefreshTokenIssuer(store RefreshTokenStore, expiration time.Duration, opts ...StoredRefreshTokenIssuerOption) StoredRefreshTokenIssuer {
+	i := StoredRefreshTokenIssuer{
+		store:      store,
+		expiration: expiration,
+	}
+
+	for _, opt := range opts {
+		opt.applyStoredRefreshTokenIssuer(&i)
+	}
+
+	if i.clock == nil {
+		i.clock = auth.Dependencies{}.GetClock()
+	}
+
+	if i.rand == nil {
+		i.rand = auth.Dependencies{}.GetRand()
+	}
+
+	return i
+}
+
+// IssueRefreshToken implements auth.RefreshTokenIssuer.
+func (i StoredRefreshTokenIssuer) IssueRefreshToken(ctx context.Context, service string, subject auth.Subject) (auth.RefreshToken, error) {
+	b := make([]byte, refreshTokenLength)
+
+	if _, err := io.ReadFull(i.rand, b); err != nil {
+		return auth.RefreshToken{}, err
+	}
+
+	refreshToken := base64.RawURLEncoding.EncodeToString(b)
+
+	now := i.clock.Now()
+
+	authTime, ok := auth.GetSubjectAuthTime(subject)
+	if !ok {
+		// The subject authenticated with the current request
+		authTime = now
+	}
+
+	record := RefreshTokenRecord{
+		ID:        RefreshTokenID(refreshToken),
+		SubjectID: subject.ID(),
+		Service:   service,
+		AuthTime:  authTime,
+	}
+
+	if i.expiration > 0 {
+		record.ExpiresAt = now.Add(i.expiration)
+	}
+
+	if err := i.store.Save(ctx, record); err != nil {
+		return auth.RefreshToken{}, fmt.Errorf("saving refresh token: %w", err)
+	}
+
+	return auth.RefreshToken{
+		Payload:   refreshToken,
+		ExpiresIn: i.expiration,
+		IssuedAt:  now,
+	}, nil
+}
+
+// VerifyRefreshToken implements RefreshTokenVerifier.
+func (i StoredRefreshTokenIssuer) VerifyRefreshToken(ctx context.Context, service string, refreshToken string) (auth.SubjectID, error) {
+	session, err := i.VerifyRefreshTokenSession(ctx, service, refreshToken)
+
+	return session.SubjectID, err
+}
+
+// VerifyRefreshTokenSession implements RefreshTokenSessionVerifier.
+func (i StoredRefreshTokenIssuer) VerifyRefreshTokenSession(ctx context.Context, service string, refreshToken string) (RefreshTokenSession, error) {
+	record, found, err := i.store.Get(ctx, RefreshTokenID(refreshToken))
+	if err != nil {
+		return RefreshTokenSession{}, err
+	}
+
+	switch {
+	case !found:
+		return RefreshTokenSession{}, fmt.Errorf("%w: unknown refresh token", auth.ErrInvalidCredentials)
+
+	case record.Revoked:
+		return RefreshTokenSession{}, fmt.Errorf("%w: refresh token revoked", auth.ErrInvalidCredentials)
+
+	case !record.ExpiresAt.IsZero() && !i.clock.Now().Before(record.ExpiresAt):
+		return RefreshTokenSession{}, fmt.Errorf("%w: refresh token expired", auth.ErrInvalidCredentials)
+
+	case record.Service != service:
+		return RefreshTokenSession{}, fmt.Errorf("%w: refresh token was issued for another service", auth.ErrInvalidCredentials)
+	}
+
+	return RefreshTokenSession{
+		SubjectID: record.SubjectID,
+		AuthTime:  record.AuthTime,
+	}, nil
+}
+
+// Revoke revokes a refresh token by ID (see [RefreshTokenID]).
+func (i StoredRefreshTokenIssuer) Revoke(ctx context.Context, tokenID string) error {
+	return i.store.Revoke(ctx, tokenID)
+}
+
+// RevokeAllForSubject revokes every refresh token issued to a Subject (eg. when their credentials leak).
+func (i StoredRefreshTokenIssuer) RevokeAllForSubject(ctx context.Context, subject auth.SubjectID) error {
+	return i.store.RevokeAllForSubject(ctx, subject)
+}
+
+// Check implements auth.Checker if the store does (eg. by pinging the database of a SQLRefreshTokenStore).
+func (i StoredRefreshTokenIssuer) Check(ctx context.Context) error {
+	if checker, ok := i.store.(auth.Checker); ok {
+		return checker.Check(ctx)
+	}
+
+	return nil
+}
+
+// StoredRefreshTokenIssuerOption configures a StoredRefreshTokenIssuer.
+type StoredRefreshTokenIssuerOption interface {
+	applyStoredRefreshTokenIssuer(i *StoredRefreshTokenIssuer)
+}
+
+// MemoryRefreshTokenStore is a RefreshTokenStore for single-node deployments.
+//
+// Tokens are kept in memory, so they do not survive restarts (clients have to log in again).
+// Expired tokens are forgotten when new tokens are saved.
+// MemoryRefreshTokenStore is safe for concurrent use.
+type MemoryRefreshTokenStore struct {
+	clock auth.Clock
+
+	mu      sync.Mutex
+	records map[string]RefreshTokenRecord
+}
+
+// NewMemoryRefreshTokenStore returns a new MemoryRefreshTokenStore.
+func NewMemoryRefreshTokenStore(opts ...MemoryRefreshTokenStoreOption) *MemoryRefreshTokenStore {
+	s := &MemoryRefreshTokenStore{
+		records: make(map[string]RefreshTokenRecord),
+	}
+
+	for _, opt := range opts {
+		opt.applyMemoryRefreshTokenStore(s)
+	}
+
+	if s.clock == nil {
+		s.clock = auth.Dependencies{}.GetClock()
+	}
+
+	return s
+}
+
+// Save implements RefreshTokenStore.
+func (s *MemoryRefreshTokenStore) Save(_ context.Context, record RefreshTokenRecord) error {
+	now := s.clock.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, r := range s.records {
+		if !r.ExpiresAt.IsZero() && !now.Before(r.ExpiresAt) {
+			delete(s.records, id)
+		}
+	}
+
+	s.records[record.ID] = record
+
+	return nil
+}
+
+// Get implements RefreshTokenStore.
+func (s *MemoryRefreshTokenStore) Get(_ context.Context, id string) (RefreshTokenRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[id]
+
+	return record, ok, nil
+}
+
+// Revoke implements RefreshTokenStore.
+func (s *MemoryRefreshTokenStore) Revoke(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record, ok := s.records[id]; ok {
+		record.Revoked = true
+		s.records[id] = record
+	}
+
+	return nil
+}
+
+// RevokeAllForSubject implements RefreshTokenStore.
+func (s *MemoryRefreshTokenStore) RevokeAllForSubject(_ context.Context, subject auth.SubjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, record := range s.records {
+		if record.SubjectID == subject {
+			record.Revoked = true
+			s.records[id] = record
+		}
+	}
+
+	return nil
+}
+
+// MemoryRefreshTokenStoreOption configures a MemoryRefreshTokenStore.
+type MemoryRefreshTokenStoreOption interface {
+	applyMemoryRefreshTokenStore(s *MemoryRefreshTokenStore)
+}
@@ -0,0 +1,156 @@
+package authn
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+// DefaultRefreshTokenTable is the default table of a SQLRefreshTokenStore.
+const DefaultRefreshTokenTable = "refresh_tokens"
+
+// Placeholder styles of SQL drivers.
+const (
+	// PlaceholderQuestion uses ? placeholders (eg. MySQL or SQLite).
+	PlaceholderQuestion = "question"
+
+	// PlaceholderDollar uses $1, $2, ... placeholders (eg. PostgreSQL).
+	PlaceholderDollar = "dollar"
+)
+
+// SQLRefreshTokenStore is a RefreshTokenStore persisting refresh tokens in a relational database,
+// so that they survive restarts and are shared between replicas.
+//
+// The table has to be created in advance, for example:
+//
+//	CREATE TABLE refresh_tokens (
+//	    id         VARCHAR(64) PRIMARY KEY,
+//	    subject    VARCHAR(255) NOT NULL,
+//	    service    VARCHAR(255) NOT NULL,
+//	    auth_time  BIGINT NOT NULL,
+//	    expires_at BIGINT NOT NULL,
+//	    revoked    BOOLEAN NOT NULL DEFAULT FALSE
+//	);
+//	CREATE INDEX refresh_tokens_subject ON refresh_tokens (subject);
+//
+// Times are stored as Unix timestamps (expires_at is 0 if the token does not expire).
+// Expired tokens are not deleted automatically.
+type SQLRefreshTokenStore struct {
+	db *sql.DB
+
+	insertQuery    string
+	selectQuery    string
+	revokeQuery    string
+	revokeAllQuery string
+}
+
+// NewSQLRefreshTokenStore returns a new SQLRefreshTokenStore.
+//
+// table defaults to DefaultRefreshTokenTable, placeholder defaults to PlaceholderQuestion.
+// The table name is not escaped: it must come from trusted configuration.
+func NewSQLRefreshTokenStore(db *sql.DB, table string, placeholder string) SQLRefreshTokenStore {
+	if table == "" {
+		table = DefaultRefreshTokenTable
+	}
+
+	p := func(n int) string {
+		if placeholder == PlaceholderDollar {
+			return fmt.Sprintf("$%d", n)
+		}
+
+		return "?"
+	}
+
+	return SQLRefreshTokenStore{
+		db: db,
+
+		insertQuery: fmt.Sprintf(
+			"INSERT INTO %s (id, subject, service, auth_time, expires_at, revoked) VALUES (%s)",
+			table,
+			strings.Join([]string{p(1), p(2), p(3), p(4), p(5), p(6)}, ", "),
+		),
+		selectQuery:    fmt.Sprintf("SELECT id, subject, service, auth_time, expires_at, revoked FROM %s WHERE id = %s", table, p(1)),
+		revokeQuery:    fmt.Sprintf("UPDATE %s SET revoked = %s WHERE id = %s", table, p(1), p(2)),
+		revokeAllQuery: fmt.Sprintf("UPDATE %s SET revoked = %s WHERE subject = %s", table, p(1), p(2)),
+	}
+}
+
+// Save implements RefreshTokenStore.
+func (s SQLRefreshTokenStore) Save(ctx context.Context, record RefreshTokenRecord) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		s.insertQuery,
+		record.ID,
+		string(record.SubjectID),
+		record.Service,
+		unixTime(record.AuthTime),
+		unixTime(record.ExpiresAt),
+		record.Revoked,
+	)
+
+	return err
+}
+
+// Get implements RefreshTokenStore.
+func (s SQLRefreshTokenStore) Get(ctx context.Context, id string) (RefreshTokenRecord, bool, error) {
+	var (
+		record    RefreshTokenRecord
+		subject   string
+		authTime  int64
+		expiresAt int64
+	)
+
+	err := s.db.QueryRowContext(ctx, s.selectQuery, id).Scan(&record.ID, &subject, &record.Service, &authTime, &expiresAt, &record.Revoked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RefreshTokenRecord{}, false, nil
+	} else if err != nil {
+		return RefreshTokenRecord{}, false, err
+	}
+
+	record.SubjectID = auth.SubjectID(subject)
+	record.AuthTime = fromUnixTime(authTime)
+	record.ExpiresAt = fromUnixTime(expiresAt)
+
+	return record, true, nil
+}
+
+// Revoke implements RefreshTokenStore.
+func (s SQLRefreshTokenStore) Revoke(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, s.revokeQuery, true, id)
+
+	return err
+}
+
+// RevokeAllForSubject implements RefreshTokenStore.
+func (s SQLRefreshTokenStore) RevokeAllForSubject(ctx context.Context, subject auth.SubjectID) error {
+	_, err := s.db.ExecContext(ctx, s.revokeAllQuery, true, string(subject))
+
+	return err
+}
+
+// Check implements auth.Checker by pinging the database.
+func (s SQLRefreshTokenStore) Check(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// unixTime converts t to a Unix timestamp (0 for the zero time).
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.Unix()
+}
+
+func fromUnixTime(v int64) time.Time {
+	if v == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(v, 0)
+}
@@ -0,0 +1,136 @@
+package authn
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+// refreshTokenDriverStub is a database/sql driver emulating the refresh token table of SQLRefreshTokenStore
+// (it only understands the queries of the store).
+type refreshTokenDriverStub struct {
+	mu sync.Mutex
+
+	// queries records the received queries
+	queries []string
+	rows    map[string][]driver.Value
+}
+
+func (d *refreshTokenDriverStub) Open(_ string) (driver.Conn, error) {
+	return refreshTokenConnStub{d}, nil
+}
+
+type refreshTokenConnStub struct {
+	driver *refreshTokenDriverStub
+}
+
+func (c refreshTokenConnStub) Prepare(query string) (driver.Stmt, error) {
+	return refreshTokenStmtStub{driver: c.driver, query: query}, nil
+}
+
+func (refreshTokenConnStub) Close() error {
+	return nil
+}
+
+func (refreshTokenConnStub) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("transactions are not supported")
+}
+
+type refreshTokenStmtStub struct {
+	driver *refreshTokenDriverStub
+	query  string
+}
+
+func (refreshTokenStmtStub) Close() error {
+	return nil
+}
+
+func (refreshTokenStmtStub) NumInput() int {
+	return -1
+}
+
+func (s refreshTokenStmtStub) Exec(args []driver.Value) (driver.Result, error) {
+	d := s.driver
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.queries = append(d.queries, s.query)
+
+	switch {
+	case strings.HasPrefix(s.query, "INSERT"):
+		d.rows[args[0].(string)] = args
+
+	case strings.HasPrefix(s.query, "UPDATE") && strings.HasSuffix(s.query, "WHERE id = $2"):
+		if row, ok := d.rows[args[1].(string)]; ok {
+			row[5] = args[0]
+		}
+
+	case strings.HasPrefix(s.query, "UPDATE") && strings.HasSuffix(s.query, "WHERE subject = $2"):
+		for _, row := range d.rows {
+			if row[1] == args[1] {
+				row[5] = args[0]
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("unexpected query: %s", s.query)
+	}
+
+	return driver.RowsAffected(1), nil
+}
+
+func (s refreshTokenStmtStub) Query(args []driver.Value) (driver.Rows, error) {
+	d := s.driver
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.queries = append(d.queries, s.query)
+
+	if !strings.HasPrefix(s.query, "SELECT") {
+		return nil, fmt.Errorf("unexpected query: %s", s.query)
+	}
+
+	rows := &sqlRowsStub{
+		columns: []string{"id", "subject", "service", "auth_time", "expires_at", "revoked"},
+	}
+
+	if row, ok := d.rows[args[0].(string)]; ok {
+		rows.rows = [][]driver.Value{append([]driver.Value(nil), row...)}
+	}
+
+	return rows, nil
+}
+
+func TestSQLRefreshTokenStore(t *testing.T) {
+	stub := &refreshTokenDriverStub{rows: make(map[string][]driver.Value)}
+
+	sql.Register("refresh-token-test", stub)
+
+	db, err := sql.Open("refresh-token-test", "")
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewSQLRefreshTokenStore(db, "tokens", PlaceholderDollar)
+
+	testStoredRefreshTokenIssuer(t, func(_ auth.Clock) RefreshTokenStore {
+		return store
+	})
+
+	assert.Contains(t, stub.queries, "INSERT INTO tokens (id, subject, service, auth_time, expires_at, revoked) VALUES ($1, $2, $3, $4, $5, $6)")
+	assert.Contains(t, stub.queries, "SELECT id, subject, service, auth_time, expires_at, revoked FROM tokens WHERE id = $1")
+
+	t.Run("Check", func(t *testing.T) {
+		require.NoError(t, store.Check(context.Background()))
+	})
+}
@@ -0,0 +1,172 @@
+package authn
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+func TestStoredRefreshTokenIssuer(t *testing.T) {
+	testStoredRefreshTokenIssuer(t, func(clock auth.Clock) RefreshTokenStore {
+		return NewMemoryRefreshTokenStore(WithClock(clock))
+	})
+}
+
+func testStoredRefreshTokenIssuer(t *testing.T, newStore func(clock auth.Clock) RefreshTokenStore) {
+	t.Helper()
+
+	const service = "service.example.com"
+
+	ctx := context.Background()
+
+	now := time.Date(2023, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+	newIssuer := func() (StoredRefreshTokenIssuer, clockwork.FakeClock) {
+		clock := clockwork.NewFakeClockAt(now)
+
+		return NewStoredRefreshTokenIssuer(newStore(clock), time.Hour, WithClock(clock)), clock
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		issuer, _ := newIssuer()
+
+		refreshToken, err := issuer.IssueRefreshToken(ctx, service, User{Username: "user"})
+		require.NoError(t, err)
+
+		assert.Equal(t, time.Hour, refreshToken.ExpiresIn)
+		assert.Equal(t, now, refreshToken.IssuedAt)
+
+		session, err := issuer.VerifyRefreshTokenSession(ctx, service, refreshToken.Payload)
+		require.NoError(t, err)
+
+		assert.Equal(t, auth.SubjectID("user"), session.SubjectID)
+		assert.True(t, now.Equal(session.AuthTime))
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		issuer, _ := newIssuer()
+
+		refreshToken, err := issuer.IssueRefreshToken(ctx, service, User{Username: "user"})
+		require.NoError(t, err)
+
+		otherRefreshToken, err := issuer.IssueRefreshToken(ctx, service, User{Username: "user"})
+		require.NoError(t, err)
+
+		err = issuer.Revoke(ctx, RefreshTokenID(refreshToken.Payload))
+		require.NoError(t, err)
+
+		_, err = issuer.VerifyRefreshToken(ctx, service, refreshToken.Payload)
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+
+		_, err = issuer.VerifyRefreshToken(ctx, service, otherRefreshToken.Payload)
+		require.NoError(t, err, "other tokens of the subject should remain valid")
+	})
+
+	t.Run("RevokeAllForSubject", func(t *testing.T) {
+		issuer, _ := newIssuer()
+
+		refreshToken, err := issuer.IssueRefreshToken(ctx, service, User{Username: "user"})
+		require.NoError(t, err)
+
+		otherRefreshToken, err := issuer.IssueRefreshToken(ctx, service, User{Username: "user"})
+		require.NoError(t, err)
+
+		otherSubjectRefreshToken, err := issuer.IssueRefreshToken(ctx, service, User{Username: "other"})
+		require.NoError(t, err)
+
+		err = issuer.RevokeAllForSubject(ctx, "user")
+		require.NoError(t, err)
+
+		_, err = issuer.VerifyRefreshToken(ctx, service, refreshToken.Payload)
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+
+		_, err = issuer.VerifyRefreshToken(ctx, service, otherRefreshToken.Payload)
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+
+		_, err = issuer.VerifyRefreshToken(ctx, service, otherSubjectRefreshToken.Payload)
+		require.NoError(t, err, "tokens of other subjects should remain valid")
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		issuer, clock := newIssuer()
+
+		refreshToken, err := issuer.IssueRefreshToken(ctx, service, User{Username: "user"})
+		require.NoError(t, err)
+
+		clock.Advance(time.Hour)
+
+		_, err = issuer.VerifyRefreshToken(ctx, service, refreshToken.Payload)
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	})
+
+	t.Run("OtherService", func(t *testing.T) {
+		issuer, _ := newIssuer()
+
+		refreshToken, err := issuer.IssueRefreshToken(ctx, service, User{Username: "user"})
+		require.NoError(t, err)
+
+		_, err = issuer.VerifyRefreshToken(ctx, "other.example.com", refreshToken.Payload)
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		issuer, _ := newIssuer()
+
+		_, err := issuer.VerifyRefreshToken(ctx, service, "unknown")
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	})
+}
+
+func TestStoredRefreshTokenIssuer_RefreshTokenAuthenticator(t *testing.T) {
+	issuer := NewStoredRefreshTokenIssuer(NewMemoryRefreshTokenStore(), time.Hour)
+
+	user := User{Username: "user", Enabled: true}
+
+	authenticator := NewRefreshTokenAuthenticator(issuer, NewUserAuthenticator([]User{user}))
+
+	refreshToken, err := issuer.IssueRefreshToken(context.Background(), "service.example.com", user)
+	require.NoError(t, err)
+
+	subject, err := authenticator.AuthenticateRefreshToken(context.Background(), "service.example.com", refreshToken.Payload)
+	require.NoError(t, err)
+
+	assert.Equal(t, auth.SubjectID("user"), subject.ID())
+
+	err = issuer.RevokeAllForSubject(context.Background(), "user")
+	require.NoError(t, err)
+
+	_, err = authenticator.AuthenticateRefreshToken(context.Background(), "service.example.com", refreshToken.Payload)
+	require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+}
+
+func TestMemoryRefreshTokenStore_Prune(t *testing.T) {
+	now := time.Date(2023, time.October, 1, 0, 0, 0, 0, time.UTC)
+	clock := clockwork.NewFakeClockAt(now)
+
+	store := NewMemoryRefreshTokenStore(WithClock(clock))
+
+	err := store.Save(context.Background(), RefreshTokenRecord{ID: "expiring", ExpiresAt: now.Add(time.Minute)})
+	require.NoError(t, err)
+
+	err = store.Save(context.Background(), RefreshTokenRecord{ID: "forever"})
+	require.NoError(t, err)
+
+	clock.Advance(time.Minute)
+
+	err = store.Save(context.Background(), RefreshTokenRecord{ID: "new"})
+	require.NoError(t, err)
+
+	_, found, err := store.Get(context.Background(), "expiring")
+	require.NoError(t, err)
+	assert.False(t, found, "expired tokens should be forgotten")
+
+	_, found, err = store.Get(context.Background(), "forever")
+	require.NoError(t, err)
+	assert.True(t, found, "tokens that never expire should be kept")
+}
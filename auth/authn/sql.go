@@ -0,0 +1,197 @@
+package authn
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+// SQLAuthenticator authenticates users stored in a relational database.
+//
+// Users are looked up by a query receiving the username as its only parameter
+// (eg. SELECT username, password_hash, enabled, email FROM users WHERE username = $1, depending on the driver's placeholder syntax).
+// The first three columns must be the username, the (bcrypt) password hash and the enabled flag, in that order.
+// Any further columns are returned as subject attributes named after the column (NULL values are omitted).
+//
+// The typed identity of subjects (see [auth.GetSubjectIdentity]) is read from the email, display_name and groups (comma-separated) columns
+// (see [WithIdentityColumns]).
+type SQLAuthenticator struct {
+	db    *sql.DB
+	query string
+
+	identityColumns SQLIdentityColumns
+}
+
+// SQLIdentityColumns names the columns holding the typed identity of subjects.
+type SQLIdentityColumns struct {
+	Email       string
+	DisplayName string
+
+	// Groups is a comma-separated list of groups.
+	Groups string
+}
+
+// NewSQLAuthenticator returns a new SQLAuthenticator.
+func NewSQLAuthenticator(db *sql.DB, query string, opts ...SQLAuthenticatorOption) SQLAuthenticator {
+	a := SQLAuthenticator{
+		db:    db,
+		query: query,
+	}
+
+	for _, opt := range opts {
+		opt.applySQLAuthenticator(&a)
+	}
+
+	if a.identityColumns.Email == "" {
+		a.identityColumns.Email = "email"
+	}
+
+	if a.identityColumns.DisplayName == "" {
+		a.identityColumns.DisplayName = "display_name"
+	}
+
+	if a.identityColumns.Groups == "" {
+		a.identityColumns.Groups = "groups"
+	}
+
+	return a
+}
+
+// AuthenticatePassword implements auth.PasswordAuthenticator.
+func (a SQLAuthenticator) AuthenticatePassword(ctx context.Context, username string, password string) (auth.Subject, error) {
+	user, found, err := a.findUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err = verifyPassword(user, found, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// GetSubjectByID implements SubjectRepository.
+func (a SQLAuthenticator) GetSubjectByID(ctx context.Context, id auth.SubjectID) (auth.Subject, error) {
+	user, found, err := a.findUser(ctx, string(id))
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, auth.ErrInvalidCredentials
+	}
+
+	if !user.Enabled {
+		return nil, auth.ErrAccountDisabled
+	}
+
+	return user, nil
+}
+
+// Check implements auth.Checker by pinging the database.
+func (a SQLAuthenticator) Check(ctx context.Context) error {
+	return a.db.PingContext(ctx)
+}
+
+func (a SQLAuthenticator) findUser(ctx context.Context, username string) (User, bool, error) {
+	rows, err := a.db.QueryContext(ctx, a.query, username)
+	if err != nil {
+		return User{}, false, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return User{}, false, err
+	}
+
+	if len(columns) < 3 {
+		return User{}, false, fmt.Errorf("sql: query must return at least 3 columns (username, password hash, enabled), got %d", len(columns))
+	}
+
+	if !rows.Next() {
+		return User{}, false, rows.Err()
+	}
+
+	var (
+		user         User
+		passwordHash sql.NullString
+		enabled      sql.NullBool
+		attributes   = make([]sql.NullString, len(columns)-3)
+	)
+
+	dest := []any{&user.Username, &passwordHash, &enabled}
+	for i := range attributes {
+		dest = append(dest, &attributes[i])
+	}
+
+	if err := rows.Scan(dest...); err != nil {
+		return User{}, false, err
+	}
+
+	if rows.Next() {
+		return User{}, false, fmt.Errorf("sql: query returned multiple users for %q", username)
+	}
+
+	if err := rows.Err(); err != nil {
+		return User{}, false, err
+	}
+
+	user.PasswordHash = passwordHash.String
+	user.Enabled = enabled.Valid && enabled.Bool
+
+	if len(attributes) > 0 {
+		user.Attrs = make(map[string]string, len(attributes))
+
+		for i, attribute := range attributes {
+			if !attribute.Valid {
+				continue
+			}
+
+			column := columns[i+3]
+
+			user.Attrs[column] = attribute.String
+
+			switch column {
+			case a.identityColumns.Email:
+				user.Email = attribute.String
+
+			case a.identityColumns.DisplayName:
+				user.DisplayName = attribute.String
+
+			case a.identityColumns.Groups:
+				for _, group := range strings.Split(attribute.String, ",") {
+					if group = strings.TrimSpace(group); group != "" {
+						user.Groups = append(user.Groups, group)
+					}
+				}
+			}
+		}
+	}
+
+	return user, true, nil
+}
+
+// SQLAuthenticatorOption configures an SQLAuthenticator.
+type SQLAuthenticatorOption interface {
+	applySQLAuthenticator(a *SQLAuthenticator)
+}
+
+// WithIdentityColumns configures an SQLAuthenticator to read the typed identity of subjects from columns.
+// Empty column names fall back to the defaults.
+func WithIdentityColumns(columns SQLIdentityColumns) SQLAuthenticatorOption {
+	return withIdentityColumns{columns}
+}
+
+type withIdentityColumns struct {
+	columns SQLIdentityColumns
+}
+
+func (w withIdentityColumns) applySQLAuthenticator(a *SQLAuthenticator) {
+	a.identityColumns = w.columns
+}
@@ -0,0 +1,160 @@
+package authn
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+// sqlDriverStub is a database/sql driver returning rows from a static table keyed by the first query argument.
+type sqlDriverStub struct {
+	columns []string
+	rows    map[string][][]driver.Value
+}
+
+func (d sqlDriverStub) Open(_ string) (driver.Conn, error) {
+	return sqlConnStub{d}, nil
+}
+
+type sqlConnStub struct {
+	driver sqlDriverStub
+}
+
+func (c sqlConnStub) Prepare(_ string) (driver.Stmt, error) {
+	return sqlStmtStub(c), nil
+}
+
+func (sqlConnStub) Close() error {
+	return nil
+}
+
+func (sqlConnStub) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+type sqlStmtStub struct {
+	driver sqlDriverStub
+}
+
+func (sqlStmtStub) Close() error {
+	return nil
+}
+
+func (sqlStmtStub) NumInput() int {
+	return 1
+}
+
+func (sqlStmtStub) Exec(_ []driver.Value) (driver.Result, error) {
+	return nil, errors.New("exec is not supported")
+}
+
+func (s sqlStmtStub) Query(args []driver.Value) (driver.Rows, error) {
+	return &sqlRowsStub{
+		columns: s.driver.columns,
+		rows:    s.driver.rows[args[0].(string)],
+	}, nil
+}
+
+type sqlRowsStub struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *sqlRowsStub) Columns() []string {
+	return r.columns
+}
+
+func (r *sqlRowsStub) Close() error {
+	return nil
+}
+
+func (r *sqlRowsStub) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+
+	return nil
+}
+
+func TestSQLAuthenticator(t *testing.T) {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	sql.Register("authn-test", sqlDriverStub{
+		columns: []string{"username", "password_hash", "enabled", "email", "team", "display_name", "groups"},
+		rows: map[string][][]driver.Value{
+			"user":     {{"user", passwordHash, int64(1), "user@example.com", nil, "User", "developers, admins"}},
+			"disabled": {{"disabled", passwordHash, false, nil, nil, nil, nil}},
+			"multiple": {{"multiple", passwordHash, true, nil, nil, nil, nil}, {"multiple", passwordHash, true, nil, nil, nil, nil}},
+		},
+	})
+
+	db, err := sql.Open("authn-test", "")
+	require.NoError(t, err)
+	defer db.Close()
+
+	authenticator := NewSQLAuthenticator(db, "SELECT username, password_hash, enabled, email, team, display_name, groups FROM users WHERE username = ?")
+
+	t.Run("OK", func(t *testing.T) {
+		subject, err := authenticator.AuthenticatePassword(context.Background(), "user", "password")
+		require.NoError(t, err)
+
+		assert.Equal(t, auth.SubjectID("user"), subject.ID())
+		assert.Equal(t, map[string]string{"email": "user@example.com", "display_name": "User", "groups": "developers, admins"}, subject.Attributes())
+
+		identity, ok := auth.GetSubjectIdentity(subject)
+		require.True(t, ok)
+
+		assert.Equal(t, auth.Identity{
+			Email:       "user@example.com",
+			DisplayName: "User",
+			Groups:      []string{"developers", "admins"},
+		}, identity)
+	})
+
+	t.Run("InvalidPassword", func(t *testing.T) {
+		_, err := authenticator.AuthenticatePassword(context.Background(), "user", "wrong")
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	})
+
+	t.Run("UnknownUser", func(t *testing.T) {
+		_, err := authenticator.AuthenticatePassword(context.Background(), "unknown", "password")
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	})
+
+	t.Run("DisabledUser", func(t *testing.T) {
+		_, err := authenticator.AuthenticatePassword(context.Background(), "disabled", "password")
+		require.ErrorIs(t, err, auth.ErrAccountDisabled)
+	})
+
+	t.Run("MultipleUsers", func(t *testing.T) {
+		_, err := authenticator.AuthenticatePassword(context.Background(), "multiple", "password")
+		require.Error(t, err)
+
+		assert.NotErrorIs(t, err, auth.ErrAuthenticationFailed)
+	})
+
+	t.Run("GetSubjectByID", func(t *testing.T) {
+		subject, err := authenticator.GetSubjectByID(context.Background(), "user")
+		require.NoError(t, err)
+		assert.Equal(t, auth.SubjectID("user"), subject.ID())
+
+		_, err = authenticator.GetSubjectByID(context.Background(), "disabled")
+		require.ErrorIs(t, err, auth.ErrAccountDisabled)
+
+		_, err = authenticator.GetSubjectByID(context.Background(), "unknown")
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	})
+}
@@ -0,0 +1,33 @@
+package authn
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// CheckTimestamps is a sanity check for tokens issued by a trusted upstream issuer.
+//
+// It rejects tokens issued (iat) or becoming valid (nbf) more than maxSkew in the future relative to now.
+// A validly signed token with an absurdly future-dated timestamp may have been forged (eg. using a leaked key)
+// or issued by a server with a broken clock.
+//
+// A non-positive maxSkew disables the check.
+func CheckTimestamps(claims jwt.RegisteredClaims, now time.Time, maxSkew time.Duration) error {
+	if maxSkew <= 0 {
+		return nil
+	}
+
+	limit := now.Add(maxSkew)
+
+	if claims.IssuedAt != nil && claims.IssuedAt.After(limit) {
+		return fmt.Errorf("token issued in the future: iat %s exceeds the maximum clock difference of %s", claims.IssuedAt.UTC().Format(time.RFC3339), maxSkew)
+	}
+
+	if claims.NotBefore != nil && claims.NotBefore.After(limit) {
+		return fmt.Errorf("token not valid until the far future: nbf %s exceeds the maximum clock difference of %s", claims.NotBefore.UTC().Format(time.RFC3339), maxSkew)
+	}
+
+	return nil
+}
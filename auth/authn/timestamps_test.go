@@ -0,0 +1,78 @@
+package authn
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckTimestamps(t *testing.T) {
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+
+	const maxSkew = 5 * time.Minute
+
+	testCases := []struct {
+		name   string
+		claims jwt.RegisteredClaims
+		valid  bool
+	}{
+		{
+			name: "Current",
+			claims: jwt.RegisteredClaims{
+				IssuedAt:  jwt.NewNumericDate(now),
+				NotBefore: jwt.NewNumericDate(now),
+			},
+			valid: true,
+		},
+		{
+			name: "WithinSkew",
+			claims: jwt.RegisteredClaims{
+				IssuedAt:  jwt.NewNumericDate(now.Add(maxSkew)),
+				NotBefore: jwt.NewNumericDate(now.Add(time.Minute)),
+			},
+			valid: true,
+		},
+		{
+			name:   "NoTimestamps",
+			claims: jwt.RegisteredClaims{},
+			valid:  true,
+		},
+		{
+			name: "FutureIssuedAt",
+			claims: jwt.RegisteredClaims{
+				IssuedAt: jwt.NewNumericDate(now.Add(365 * 24 * time.Hour)),
+			},
+		},
+		{
+			name: "FutureNotBefore",
+			claims: jwt.RegisteredClaims{
+				IssuedAt:  jwt.NewNumericDate(now),
+				NotBefore: jwt.NewNumericDate(now.Add(time.Hour)),
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			err := CheckTimestamps(testCase.claims, now, maxSkew)
+
+			if testCase.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		claims := jwt.RegisteredClaims{
+			IssuedAt: jwt.NewNumericDate(now.Add(365 * 24 * time.Hour)),
+		}
+
+		assert.NoError(t, CheckTimestamps(claims, now, 0))
+	})
+}
@@ -6,11 +6,15 @@ import (
 )
 
 // ErrUnauthorized is returned when a client did not provide any credentials
-// and the authorization server does not support anonymous access.
-// TODO: this could be moved to another component to make anonymous access check global.
+// and the authorization server does not support anonymous access (see TokenServiceImpl.AnonymousAccess).
 var ErrUnauthorized = errors.New("unauthorized")
 
 // Authorizer authorizes an access request to a list of resources (scopes) and returns the list of granted scopes.
+//
+// Subject is nil for anonymous requests (requests without credentials):
+// the Authorizer decides what (if anything) anonymous subjects may do, typically pulling public repositories.
+// Anonymous requests for access the Authorizer does not grant receive a token without that access,
+// unless the Authorizer returns ErrUnauthorized to ask the client for credentials.
 type Authorizer interface {
 	Authorize(ctx context.Context, subject Subject, requestedScopes []Scope) ([]Scope, error)
 }
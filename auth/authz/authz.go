@@ -3,6 +3,7 @@ package authz
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/sagikazarmark/registry-auth/auth"
@@ -11,6 +12,9 @@ import (
 // DefaultAuthorizer implements a basic set of authorization rules
 // and delegates authorization for repository resources.
 // Access to everything else is denied.
+//
+// Anonymous subjects are never granted write actions (push, delete) on repositories,
+// even if the RepositoryAuthorizer grants them (eg. due to a misconfigured rule).
 type DefaultAuthorizer struct {
 	repoAuthorizer RepositoryAuthorizer
 	allowAnonymous bool
@@ -44,6 +48,11 @@ func (a DefaultAuthorizer) Authorize(ctx context.Context, subject auth.Subject,
 				return nil, err
 			}
 
+			// Safety net: never let anonymous subjects write, whatever the repository authorizer decided
+			if subject == nil {
+				grantedActions = ReadOnlyActions(grantedActions)
+			}
+
 			// Don't add a scope with no actions
 			if len(grantedActions) == 0 {
 				continue
@@ -67,6 +76,25 @@ func (a DefaultAuthorizer) Authorize(ctx context.Context, subject auth.Subject,
 	return grantedScopes, nil
 }
 
+// ReadOnlyActions returns actions without the ones modifying a repository (push, delete and "*").
+//
+// Authorizers use it to never let anonymous subjects write, whatever their policies decided.
+func ReadOnlyActions(actions []string) []string {
+	return slices.DeleteFunc(slices.Clone(actions), isWriteAction)
+}
+
+// isWriteAction reports whether action modifies a repository.
+//
+// Unknown actions are not considered write actions, so the wildcard action is treated as one explicitly.
+func isWriteAction(action string) bool {
+	switch action {
+	case "push", "delete", "*":
+		return true
+	}
+
+	return false
+}
+
 // DefaultRepositoryAuthorizer implements a simple authorization logic for authenticated users.
 type DefaultRepositoryAuthorizer struct {
 	allowAnonymous bool
@@ -14,6 +14,7 @@ import (
 type subject struct {
 	id         auth.SubjectID
 	attributes map[string]string
+	groups     []string
 }
 
 func (s subject) ID() auth.SubjectID {
@@ -34,6 +35,14 @@ func (s subject) Attributes() map[string]string {
 	return maps.Clone(s.attributes)
 }
 
+func (s subject) Identity() (auth.Identity, bool) {
+	if s.groups == nil {
+		return auth.Identity{}, false
+	}
+
+	return auth.Identity{Groups: s.groups}, true
+}
+
 type repositoryAuthorizerStub struct {
 	repositories map[string]bool
 }
@@ -120,3 +129,56 @@ func TestDefaultAuthorizer(t *testing.T) {
 		})
 	}
 }
+
+func TestDefaultAuthorizer_AnonymousWrite(t *testing.T) {
+	// Misconfigured rule granting everything to everyone
+	repoAuthorizer := NewRuleRepositoryAuthorizer([]Rule{
+		{
+			Repository: "**",
+			Actions:    []string{"*"},
+		},
+	}, "")
+
+	authorizer := NewDefaultAuthorizer(repoAuthorizer, true)
+
+	scopes := []auth.Scope{
+		{
+			Resource: auth.Resource{
+				Type: "repository",
+				Name: "user/repository",
+			},
+			Actions: []string{"pull", "push", "delete", "*"},
+		},
+		{
+			Resource: auth.Resource{
+				Type: "repository",
+				Name: "other/repository",
+			},
+			Actions: []string{"push"},
+		},
+	}
+
+	t.Run("Anonymous", func(t *testing.T) {
+		grantedScopes, err := authorizer.Authorize(context.Background(), nil, scopes)
+		require.NoError(t, err)
+
+		expectedScopes := []auth.Scope{
+			{
+				Resource: auth.Resource{
+					Type: "repository",
+					Name: "user/repository",
+				},
+				Actions: []string{"pull"},
+			},
+		}
+
+		assert.Equal(t, expectedScopes, grantedScopes)
+	})
+
+	t.Run("Authenticated", func(t *testing.T) {
+		grantedScopes, err := authorizer.Authorize(context.Background(), subject{id: "user"}, scopes)
+		require.NoError(t, err)
+
+		assert.Equal(t, scopes, grantedScopes)
+	})
+}
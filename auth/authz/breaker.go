@@ -0,0 +1,195 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+// ErrCircuitOpen is returned by CircuitBreakerAuthorizer when the circuit is open and no fallback is configured.
+var ErrCircuitOpen = errors.New("authorizer circuit breaker is open")
+
+// CircuitBreakerAuthorizer protects a remote authorizer (and the token service) during partial outages.
+//
+// After threshold consecutive failures the circuit opens and requests are no longer sent to the authorizer.
+// Once the cooldown elapses, a single probe request is let through (half-open):
+// the circuit closes if it succeeds and opens again if it fails.
+//
+// While the circuit is open, requests fail closed (ErrCircuitOpen) unless a fallback authorizer is configured (see [WithFallback]).
+//
+// Denials (auth.ErrUnauthorized) and canceled requests do not count as failures.
+// A non-positive threshold disables the circuit breaker.
+type CircuitBreakerAuthorizer struct {
+	authorizer auth.Authorizer
+	threshold  int
+	cooldown   time.Duration
+
+	fallback auth.Authorizer
+	clock    auth.Clock
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewCircuitBreakerAuthorizer returns a new CircuitBreakerAuthorizer.
+func NewCircuitBreakerAuthorizer(authorizer auth.Authorizer, threshold int, cooldown time.Duration, opts ...CircuitBreakerOption) *CircuitBreakerAuthorizer {
+	a := &CircuitBreakerAuthorizer{
+		authorizer: authorizer,
+		threshold:  threshold,
+		cooldown:   cooldown,
+	}
+
+	for _, opt := range opts {
+		opt.applyCircuitBreaker(a)
+	}
+
+	if a.clock == nil {
+		a.clock = auth.Dependencies{}.GetClock()
+	}
+
+	return a
+}
+
+// Authorize implements auth.Authorizer.
+func (a *CircuitBreakerAuthorizer) Authorize(ctx context.Context, subject auth.Subject, requestedScopes []auth.Scope) ([]auth.Scope, error) {
+	allowed, probe := a.allow()
+	if !allowed {
+		if a.fallback == nil {
+			return nil, ErrCircuitOpen
+		}
+
+		return a.fallback.Authorize(ctx, subject, requestedScopes)
+	}
+
+	grantedScopes, err := a.authorizer.Authorize(ctx, subject, requestedScopes)
+
+	a.record(err, probe)
+
+	return grantedScopes, err
+}
+
+// allow reports whether a request may be sent to the authorizer and whether it is the probe of a half-open circuit.
+func (a *CircuitBreakerAuthorizer) allow() (allowed bool, probe bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.threshold <= 0 || a.failures < a.threshold {
+		return true, false
+	}
+
+	// Half-open: let a single probe through after the cooldown
+	if !a.probing && !a.clock.Now().Before(a.openedAt.Add(a.cooldown)) {
+		a.probing = true
+
+		return true, true
+	}
+
+	return false, false
+}
+
+func (a *CircuitBreakerAuthorizer) record(err error, probe bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Requests started before the circuit opened may finish while the probe is in flight
+	if probe {
+		a.probing = false
+	}
+
+	// Canceled requests tell nothing about the health of the authorizer
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	if err == nil || errors.Is(err, auth.ErrUnauthorized) {
+		a.failures = 0
+
+		return
+	}
+
+	a.failures++
+
+	if a.failures >= a.threshold {
+		a.openedAt = a.clock.Now()
+	}
+}
+
+// CircuitBreakerOption configures a CircuitBreakerAuthorizer.
+type CircuitBreakerOption interface {
+	applyCircuitBreaker(a *CircuitBreakerAuthorizer)
+}
+
+// WithFallback configures a CircuitBreakerAuthorizer to delegate to fallback while the circuit is open (fail open).
+//
+// For example, a DefaultAuthorizer granting pull access only keeps clients running during an outage.
+func WithFallback(fallback auth.Authorizer) CircuitBreakerOption {
+	return withFallback{fallback}
+}
+
+type withFallback struct {
+	fallback auth.Authorizer
+}
+
+func (w withFallback) applyCircuitBreaker(a *CircuitBreakerAuthorizer) {
+	a.fallback = w.fallback
+}
+
+// FailOpenAuthorizer grants a fixed set of actions (eg. pull) on every requested repository to authenticated subjects.
+//
+// It is meant to be the fallback of a CircuitBreakerAuthorizer (see [WithFallback]),
+// so that clients keep running (with limited access) while the authorizer is unavailable.
+type FailOpenAuthorizer struct {
+	actions []string
+}
+
+// NewFailOpenAuthorizer returns a new FailOpenAuthorizer.
+func NewFailOpenAuthorizer(actions []string) FailOpenAuthorizer {
+	return FailOpenAuthorizer{
+		actions: actions,
+	}
+}
+
+// Authorize implements auth.Authorizer.
+func (a FailOpenAuthorizer) Authorize(_ context.Context, subject auth.Subject, requestedScopes []auth.Scope) ([]auth.Scope, error) {
+	if subject == nil {
+		return nil, auth.ErrUnauthorized
+	}
+
+	grantedScopes := make([]auth.Scope, 0, len(requestedScopes))
+
+	for _, scope := range requestedScopes {
+		if scope.Type != "repository" {
+			continue
+		}
+
+		actions := IntersectActions(scope.Actions, a.actions)
+		if len(actions) == 0 {
+			continue
+		}
+
+		grantedScopes = append(grantedScopes, auth.Scope{
+			Resource: scope.Resource,
+			Actions:  actions,
+		})
+	}
+
+	return grantedScopes, nil
+}
+
+// WithClock configures a CircuitBreakerAuthorizer to use a Clock.
+func WithClock(clock auth.Clock) CircuitBreakerOption {
+	return withClock{clock}
+}
+
+type withClock struct {
+	clock auth.Clock
+}
+
+func (w withClock) applyCircuitBreaker(a *CircuitBreakerAuthorizer) {
+	a.clock = w.clock
+}
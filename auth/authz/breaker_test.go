@@ -0,0 +1,259 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+type remoteAuthorizerStub struct {
+	err   error
+	calls int
+}
+
+func (a *remoteAuthorizerStub) Authorize(_ context.Context, _ auth.Subject, requestedScopes []auth.Scope) ([]auth.Scope, error) {
+	a.calls++
+
+	if a.err != nil {
+		return nil, a.err
+	}
+
+	return requestedScopes, nil
+}
+
+type fallbackAuthorizerStub struct{}
+
+func (fallbackAuthorizerStub) Authorize(_ context.Context, _ auth.Subject, _ []auth.Scope) ([]auth.Scope, error) {
+	return []auth.Scope{}, nil
+}
+
+func TestCircuitBreakerAuthorizer(t *testing.T) {
+	errRemote := errors.New("connection refused")
+
+	requestedScopes := []auth.Scope{
+		{
+			Resource: auth.Resource{
+				Type: "repository",
+				Name: "foo",
+			},
+			Actions: []string{"pull"},
+		},
+	}
+
+	t.Run("FailClosed", func(t *testing.T) {
+		remote := &remoteAuthorizerStub{err: errRemote}
+		clock := clockwork.NewFakeClock()
+
+		authorizer := NewCircuitBreakerAuthorizer(remote, 3, time.Minute, WithClock(clock))
+
+		for i := 0; i < 3; i++ {
+			_, err := authorizer.Authorize(context.Background(), subject{}, requestedScopes)
+			require.ErrorIs(t, err, errRemote)
+		}
+
+		_, err := authorizer.Authorize(context.Background(), subject{}, requestedScopes)
+		require.ErrorIs(t, err, ErrCircuitOpen)
+
+		assert.Equal(t, 3, remote.calls)
+	})
+
+	t.Run("FailOpen", func(t *testing.T) {
+		remote := &remoteAuthorizerStub{err: errRemote}
+		clock := clockwork.NewFakeClock()
+
+		authorizer := NewCircuitBreakerAuthorizer(remote, 2, time.Minute, WithClock(clock), WithFallback(fallbackAuthorizerStub{}))
+
+		for i := 0; i < 2; i++ {
+			_, err := authorizer.Authorize(context.Background(), subject{}, requestedScopes)
+			require.ErrorIs(t, err, errRemote)
+		}
+
+		grantedScopes, err := authorizer.Authorize(context.Background(), subject{}, requestedScopes)
+		require.NoError(t, err)
+
+		assert.Empty(t, grantedScopes)
+		assert.Equal(t, 2, remote.calls)
+	})
+
+	t.Run("HalfOpen", func(t *testing.T) {
+		remote := &remoteAuthorizerStub{err: errRemote}
+		clock := clockwork.NewFakeClock()
+
+		authorizer := NewCircuitBreakerAuthorizer(remote, 1, time.Minute, WithClock(clock))
+
+		_, err := authorizer.Authorize(context.Background(), subject{}, requestedScopes)
+		require.ErrorIs(t, err, errRemote)
+
+		// Probe fails: circuit opens again
+		clock.Advance(time.Minute)
+
+		_, err = authorizer.Authorize(context.Background(), subject{}, requestedScopes)
+		require.ErrorIs(t, err, errRemote)
+
+		_, err = authorizer.Authorize(context.Background(), subject{}, requestedScopes)
+		require.ErrorIs(t, err, ErrCircuitOpen)
+
+		// Probe succeeds: circuit closes
+		remote.err = nil
+		clock.Advance(time.Minute)
+
+		grantedScopes, err := authorizer.Authorize(context.Background(), subject{}, requestedScopes)
+		require.NoError(t, err)
+		assert.Equal(t, requestedScopes, grantedScopes)
+
+		grantedScopes, err = authorizer.Authorize(context.Background(), subject{}, requestedScopes)
+		require.NoError(t, err)
+		assert.Equal(t, requestedScopes, grantedScopes)
+
+		assert.Equal(t, 4, remote.calls)
+	})
+
+	t.Run("Denials", func(t *testing.T) {
+		remote := &remoteAuthorizerStub{err: auth.ErrUnauthorized}
+
+		authorizer := NewCircuitBreakerAuthorizer(remote, 1, time.Minute)
+
+		for i := 0; i < 3; i++ {
+			_, err := authorizer.Authorize(context.Background(), nil, requestedScopes)
+			require.ErrorIs(t, err, auth.ErrUnauthorized)
+		}
+
+		assert.Equal(t, 3, remote.calls)
+	})
+}
+
+// blockingAuthorizerStub returns the result sent on results[i] from the i-th call.
+type blockingAuthorizerStub struct {
+	results []chan error
+	started chan struct{}
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (a *blockingAuthorizerStub) Authorize(_ context.Context, _ auth.Subject, requestedScopes []auth.Scope) ([]auth.Scope, error) {
+	a.mu.Lock()
+	result := a.results[a.calls]
+	a.calls++
+	a.mu.Unlock()
+
+	a.started <- struct{}{}
+
+	if err := <-result; err != nil {
+		return nil, err
+	}
+
+	return requestedScopes, nil
+}
+
+func TestCircuitBreakerAuthorizer_Probe(t *testing.T) {
+	requestedScopes := []auth.Scope{
+		{
+			Resource: auth.Resource{
+				Type: "repository",
+				Name: "foo",
+			},
+			Actions: []string{"pull"},
+		},
+	}
+
+	remote := &blockingAuthorizerStub{
+		results: []chan error{make(chan error, 1), make(chan error, 1), make(chan error, 1)},
+		started: make(chan struct{}, 3),
+	}
+	clock := clockwork.NewFakeClock()
+
+	authorizer := NewCircuitBreakerAuthorizer(remote, 1, time.Minute, WithClock(clock))
+
+	errs := make(chan error, 2)
+
+	// A slow request started while the circuit is closed
+	go func() {
+		_, err := authorizer.Authorize(context.Background(), subject{}, requestedScopes)
+		errs <- err
+	}()
+	<-remote.started
+
+	// A failure opens the circuit
+	remote.results[1] <- errors.New("connection refused")
+
+	_, err := authorizer.Authorize(context.Background(), subject{}, requestedScopes)
+	require.Error(t, err)
+	<-remote.started
+
+	// The probe is in flight
+	clock.Advance(time.Minute)
+
+	go func() {
+		_, err := authorizer.Authorize(context.Background(), subject{}, requestedScopes)
+		errs <- err
+	}()
+	<-remote.started
+
+	// The slow request finishing does not end the probe
+	remote.results[0] <- context.Canceled
+	require.ErrorIs(t, <-errs, context.Canceled)
+
+	_, err = authorizer.Authorize(context.Background(), subject{}, requestedScopes)
+	require.ErrorIs(t, err, ErrCircuitOpen)
+
+	// The probe succeeds: circuit closes
+	remote.results[2] <- nil
+	require.NoError(t, <-errs)
+
+	assert.Equal(t, 3, remote.calls)
+}
+
+func TestFailOpenAuthorizer(t *testing.T) {
+	authorizer := NewFailOpenAuthorizer([]string{"pull"})
+
+	requestedScopes := []auth.Scope{
+		{
+			Resource: auth.Resource{
+				Type: "repository",
+				Name: "foo",
+			},
+			Actions: []string{"pull", "push"},
+		},
+		{
+			Resource: auth.Resource{
+				Type: "repository",
+				Name: "bar",
+			},
+			Actions: []string{"delete"},
+		},
+		{
+			Resource: auth.Resource{
+				Type: "registry",
+				Name: "catalog",
+			},
+			Actions: []string{"*"},
+		},
+	}
+
+	grantedScopes, err := authorizer.Authorize(context.Background(), subject{}, requestedScopes)
+	require.NoError(t, err)
+
+	expectedScopes := []auth.Scope{
+		{
+			Resource: auth.Resource{
+				Type: "repository",
+				Name: "foo",
+			},
+			Actions: []string{"pull"},
+		},
+	}
+
+	assert.Equal(t, expectedScopes, grantedScopes)
+
+	_, err = authorizer.Authorize(context.Background(), nil, requestedScopes)
+	require.ErrorIs(t, err, auth.ErrUnauthorized)
+}
@@ -0,0 +1,100 @@
+package authz
+
+import (
+	"context"
+	"slices"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+// ResourceTypeFilter restricts the resource types that may appear in granted scopes.
+//
+// A filter applies to a request if both its service and subject attributes match.
+// An empty Service matches every service, empty SubjectAttributes match every subject (including anonymous ones).
+type ResourceTypeFilter struct {
+	Service           string
+	SubjectAttributes map[string]string
+
+	// Allow lists the only resource types that may be granted. An empty list allows every type.
+	Allow []string
+
+	// Deny lists resource types that must never be granted.
+	Deny []string
+}
+
+func (f ResourceTypeFilter) matches(service string, subject auth.Subject) bool {
+	if f.Service != "" && f.Service != service {
+		return false
+	}
+
+	for key, value := range f.SubjectAttributes {
+		if subject == nil {
+			return false
+		}
+
+		if v, ok := subject.Attribute(key); !ok || v != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (f ResourceTypeFilter) permits(resourceType string) bool {
+	if slices.Contains(f.Deny, resourceType) {
+		return false
+	}
+
+	return len(f.Allow) == 0 || slices.Contains(f.Allow, resourceType)
+}
+
+// FilteringAuthorizer strips scopes of filtered resource types from the scopes granted by another auth.Authorizer.
+type FilteringAuthorizer struct {
+	authorizer auth.Authorizer
+	filters    []ResourceTypeFilter
+}
+
+// NewFilteringAuthorizer returns a new FilteringAuthorizer.
+func NewFilteringAuthorizer(authorizer auth.Authorizer, filters []ResourceTypeFilter) FilteringAuthorizer {
+	return FilteringAuthorizer{
+		authorizer: authorizer,
+		filters:    filters,
+	}
+}
+
+// Authorize implements auth.Authorizer.
+func (a FilteringAuthorizer) Authorize(ctx context.Context, subject auth.Subject, requestedScopes []auth.Scope) ([]auth.Scope, error) {
+	grantedScopes, err := a.authorizer.Authorize(ctx, subject, requestedScopes)
+	if err != nil {
+		return nil, err
+	}
+
+	service := auth.ServiceFromContext(ctx)
+
+	var filters []ResourceTypeFilter
+
+	for _, filter := range a.filters {
+		if filter.matches(service, subject) {
+			filters = append(filters, filter)
+		}
+	}
+
+	if len(filters) == 0 {
+		return grantedScopes, nil
+	}
+
+	filteredScopes := make([]auth.Scope, 0, len(grantedScopes))
+
+scopes:
+	for _, scope := range grantedScopes {
+		for _, filter := range filters {
+			if !filter.permits(scope.Type) {
+				continue scopes
+			}
+		}
+
+		filteredScopes = append(filteredScopes, scope)
+	}
+
+	return filteredScopes, nil
+}
@@ -0,0 +1,95 @@
+package authz
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+type allowAllAuthorizer struct{}
+
+func (allowAllAuthorizer) Authorize(_ context.Context, _ auth.Subject, requestedScopes []auth.Scope) ([]auth.Scope, error) {
+	return requestedScopes, nil
+}
+
+func TestFilteringAuthorizer(t *testing.T) {
+	catalogScope := auth.Scope{
+		Resource: auth.Resource{
+			Type: "registry",
+			Name: "catalog",
+		},
+		Actions: []string{"*"},
+	}
+
+	repositoryScope := auth.Scope{
+		Resource: auth.Resource{
+			Type: "repository",
+			Name: "tenant/repository",
+		},
+		Actions: []string{"pull"},
+	}
+
+	tenantSubject := subject{
+		id: "user",
+		attributes: map[string]string{
+			"tenant": "tenant",
+		},
+	}
+
+	authorizer := NewFilteringAuthorizer(allowAllAuthorizer{}, []ResourceTypeFilter{
+		{
+			Service: "tenant.example.com",
+			Deny:    []string{"registry"},
+		},
+		{
+			SubjectAttributes: map[string]string{
+				"tenant": "tenant",
+			},
+			Allow: []string{"repository"},
+		},
+	})
+
+	testCases := []struct {
+		service        string
+		subject        auth.Subject
+		expectedScopes []auth.Scope
+	}{
+		{
+			service:        "tenant.example.com",
+			subject:        subject{id: "user"},
+			expectedScopes: []auth.Scope{repositoryScope},
+		},
+		{
+			service:        "other.example.com",
+			subject:        subject{id: "user"},
+			expectedScopes: []auth.Scope{catalogScope, repositoryScope},
+		},
+		{
+			service:        "other.example.com",
+			subject:        tenantSubject,
+			expectedScopes: []auth.Scope{repositoryScope},
+		},
+		{
+			service:        "other.example.com",
+			subject:        nil,
+			expectedScopes: []auth.Scope{catalogScope, repositoryScope},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run("", func(t *testing.T) {
+			ctx := auth.ContextWithService(context.Background(), testCase.service)
+
+			grantedScopes, err := authorizer.Authorize(ctx, testCase.subject, []auth.Scope{catalogScope, repositoryScope})
+			require.NoError(t, err)
+
+			assert.Equal(t, testCase.expectedScopes, grantedScopes)
+		})
+	}
+}
@@ -0,0 +1,242 @@
+// Package opa delegates authorization decisions to Open Policy Agent (Rego) policies.
+package opa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+	"github.com/sagikazarmark/registry-auth/auth/authz"
+)
+
+// DefaultTimeout is the default deadline of a policy evaluation.
+const DefaultTimeout = time.Second
+
+// Config configures an Authorizer.
+type Config struct {
+	// Policy is an inline Rego module.
+	Policy string
+
+	// Bundle is the path of a policy bundle (a directory or a .tar.gz file).
+	// Data files in the bundle are available to the policy.
+	Bundle string
+
+	// Decision is the reference of the rule producing the decision (eg. data.registry.authz.allow).
+	Decision string
+
+	// Timeout limits the time a single policy evaluation may take.
+	// Defaults to DefaultTimeout.
+	Timeout time.Duration
+}
+
+// Validate validates the configuration.
+//
+// It compiles the policy, so invalid policies are detected before the Authorizer is created.
+func (c Config) Validate() error {
+	_, err := c.prepare(context.Background())
+
+	return err
+}
+
+func (c Config) prepare(ctx context.Context) (rego.PreparedEvalQuery, error) {
+	if (c.Policy == "") == (c.Bundle == "") {
+		return rego.PreparedEvalQuery{}, errors.New("either policy or bundle is required")
+	}
+
+	if c.Decision == "" {
+		return rego.PreparedEvalQuery{}, errors.New("decision is required")
+	}
+
+	decision, err := ast.ParseRef(c.Decision)
+	if err != nil {
+		return rego.PreparedEvalQuery{}, fmt.Errorf("decision: %w", err)
+	}
+
+	if !decision.HasPrefix(ast.DefaultRootRef) {
+		return rego.PreparedEvalQuery{}, fmt.Errorf("decision: %s must refer to a rule under data", c.Decision)
+	}
+
+	compiler := ast.NewCompiler()
+
+	options := []func(*rego.Rego){
+		rego.Compiler(compiler),
+		rego.Query(decision.String()),
+	}
+
+	if c.Policy != "" {
+		options = append(options, rego.Module("policy.rego", c.Policy))
+	} else {
+		options = append(options, rego.LoadBundle(c.Bundle))
+	}
+
+	query, err := rego.New(options...).PrepareForEval(ctx)
+	if err != nil {
+		return rego.PreparedEvalQuery{}, fmt.Errorf("compiling policy: %w", err)
+	}
+
+	if len(compiler.GetRules(decision)) == 0 {
+		return rego.PreparedEvalQuery{}, fmt.Errorf("decision: policy does not define %s", c.Decision)
+	}
+
+	return query, nil
+}
+
+// Authorizer evaluates a Rego policy for every authorization request.
+//
+// The policy receives the following input:
+//
+//	{
+//	  "subject": {"id": "user", "name": "user", "attributes": {"group": "team"}}, // null for anonymous subjects
+//	  "scopes": [
+//	    {"resource": "repository:team/app", "type": "repository", "class": "", "name": "team/app", "actions": ["pull", "push"]}
+//	  ]
+//	}
+//
+// The decision must be an object mapping resources (the resource field of the requested scopes) to the allowed actions.
+// Granted actions are the intersection of the requested and allowed actions ("*" allows every requested action),
+// resources missing from the decision (or an undefined decision) are denied.
+//
+// For example:
+//
+//	package registry.authz
+//
+//	import future.keywords.if
+//	import future.keywords.in
+//
+//	allow[scope.resource] := ["pull", "push"] if {
+//	    some scope in input.scopes
+//	    scope.type == "repository"
+//	    startswith(scope.name, concat("", [input.subject.attributes.group, "/"]))
+//	}
+type Authorizer struct {
+	query   rego.PreparedEvalQuery
+	timeout time.Duration
+}
+
+// NewAuthorizer compiles the configured policy and returns a new Authorizer.
+func NewAuthorizer(ctx context.Context, config Config) (Authorizer, error) {
+	query, err := config.prepare(ctx)
+	if err != nil {
+		return Authorizer{}, err
+	}
+
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return Authorizer{
+		query:   query,
+		timeout: timeout,
+	}, nil
+}
+
+// Authorize implements auth.Authorizer.
+func (a Authorizer) Authorize(ctx context.Context, subject auth.Subject, requestedScopes []auth.Scope) ([]auth.Scope, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	results, err := a.query.Eval(ctx, rego.EvalInput(newInput(subject, requestedScopes)))
+	if err != nil {
+		return nil, fmt.Errorf("opa: evaluating policy: %w", err)
+	}
+
+	grantedScopes := make([]auth.Scope, 0, len(requestedScopes))
+
+	// An undefined decision denies everything
+	if len(results) == 0 || len(results[0].Expressions) == 0 {
+		return grantedScopes, nil
+	}
+
+	decision, ok := results[0].Expressions[0].Value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("opa: decision must be an object, got %T", results[0].Expressions[0].Value)
+	}
+
+	for _, scope := range requestedScopes {
+		allowedActions, err := actions(decision[scope.Resource.String()])
+		if err != nil {
+			return nil, fmt.Errorf("opa: decision for %s: %w", scope.Resource, err)
+		}
+
+		grantedActions := authz.IntersectActions(scope.Actions, allowedActions)
+
+		// Safety net: never let anonymous subjects write, whatever the policy decided (like authz.DefaultAuthorizer)
+		if subject == nil && scope.Type == "repository" {
+			grantedActions = authz.ReadOnlyActions(grantedActions)
+		}
+
+		if len(grantedActions) == 0 {
+			continue
+		}
+
+		scope.Actions = grantedActions
+
+		grantedScopes = append(grantedScopes, scope)
+	}
+
+	return grantedScopes, nil
+}
+
+func newInput(subject auth.Subject, scopes []auth.Scope) map[string]any {
+	inputScopes := make([]map[string]any, 0, len(scopes))
+
+	for _, scope := range scopes {
+		inputScopes = append(inputScopes, map[string]any{
+			"resource": scope.Resource.String(),
+			"type":     scope.Type,
+			"class":    scope.Class,
+			"name":     scope.Name,
+			"actions":  scope.Actions,
+		})
+	}
+
+	input := map[string]any{
+		"subject": nil,
+		"scopes":  inputScopes,
+	}
+
+	if subject != nil {
+		attributes := subject.Attributes()
+		if attributes == nil {
+			attributes = map[string]string{}
+		}
+
+		input["subject"] = map[string]any{
+			"id":         string(subject.ID()),
+			"name":       auth.GetSubjectName(subject),
+			"attributes": attributes,
+		}
+	}
+
+	return input
+}
+
+func actions(v any) ([]string, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	values, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("allowed actions must be an array, got %T", v)
+	}
+
+	actions := make([]string, 0, len(values))
+
+	for _, value := range values {
+		action, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("allowed actions must be strings, got %T", value)
+		}
+
+		actions = append(actions, action)
+	}
+
+	return actions, nil
+}
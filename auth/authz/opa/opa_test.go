@@ -0,0 +1,273 @@
+package opa
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+	"github.com/sagikazarmark/registry-auth/auth/authn"
+)
+
+const policy = `
+package registry.authz
+
+import future.keywords.if
+import future.keywords.in
+
+allow[scope.resource] := ["*"] if {
+	some scope in input.scopes
+	scope.type == "repository"
+	startswith(scope.name, concat("", [input.subject.name, "/"]))
+}
+
+allow[scope.resource] := ["pull"] if {
+	some scope in input.scopes
+	scope.type == "repository"
+	startswith(scope.name, concat("", [input.subject.attributes.group, "/"]))
+}
+`
+
+func TestAuthorizer(t *testing.T) {
+	authorizer, err := NewAuthorizer(context.Background(), Config{
+		Policy:   policy,
+		Decision: "data.registry.authz.allow",
+	})
+	require.NoError(t, err)
+
+	subject := authn.User{
+		Enabled:  true,
+		Username: "user",
+		Attrs:    map[string]string{"group": "team"},
+	}
+
+	requestedScopes := []auth.Scope{
+		{
+			Resource: auth.Resource{Type: "repository", Name: "user/app"},
+			Actions:  []string{"pull", "push"},
+		},
+		{
+			Resource: auth.Resource{Type: "repository", Name: "team/app"},
+			Actions:  []string{"pull", "push"},
+		},
+		{
+			Resource: auth.Resource{Type: "repository", Name: "other/app"},
+			Actions:  []string{"pull"},
+		},
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		grantedScopes, err := authorizer.Authorize(context.Background(), subject, requestedScopes)
+		require.NoError(t, err)
+
+		expected := []auth.Scope{
+			{
+				Resource: auth.Resource{Type: "repository", Name: "user/app"},
+				Actions:  []string{"pull", "push"},
+			},
+			{
+				Resource: auth.Resource{Type: "repository", Name: "team/app"},
+				Actions:  []string{"pull"},
+			},
+		}
+
+		assert.Equal(t, expected, grantedScopes)
+	})
+
+	t.Run("Anonymous", func(t *testing.T) {
+		grantedScopes, err := authorizer.Authorize(context.Background(), nil, requestedScopes)
+		require.NoError(t, err)
+
+		assert.Empty(t, grantedScopes)
+	})
+}
+
+func TestAuthorizer_AnonymousWrite(t *testing.T) {
+	// A misconfigured policy granting everything to everyone
+	const policy = `
+package registry.authz
+
+import future.keywords.if
+import future.keywords.in
+
+allow[scope.resource] := ["*"] if {
+	some scope in input.scopes
+}
+`
+
+	authorizer, err := NewAuthorizer(context.Background(), Config{
+		Policy:   policy,
+		Decision: "data.registry.authz.allow",
+	})
+	require.NoError(t, err)
+
+	requestedScopes := []auth.Scope{
+		{
+			Resource: auth.Resource{Type: "repository", Name: "public/app"},
+			Actions:  []string{"pull", "push", "delete"},
+		},
+		{
+			Resource: auth.Resource{Type: "repository", Name: "public/other"},
+			Actions:  []string{"*"},
+		},
+	}
+
+	t.Run("Anonymous", func(t *testing.T) {
+		grantedScopes, err := authorizer.Authorize(context.Background(), nil, requestedScopes)
+		require.NoError(t, err)
+
+		expected := []auth.Scope{
+			{
+				Resource: auth.Resource{Type: "repository", Name: "public/app"},
+				Actions:  []string{"pull"},
+			},
+		}
+
+		assert.Equal(t, expected, grantedScopes)
+	})
+
+	t.Run("Authenticated", func(t *testing.T) {
+		grantedScopes, err := authorizer.Authorize(context.Background(), authn.User{Enabled: true, Username: "user"}, requestedScopes)
+		require.NoError(t, err)
+
+		assert.Equal(t, requestedScopes, grantedScopes)
+	})
+}
+
+func TestAuthorizer_Timeout(t *testing.T) {
+	const policy = `
+package registry.authz
+
+import future.keywords.if
+import future.keywords.in
+
+allow[scope.resource] := ["pull"] if {
+	some scope in input.scopes
+	count([i | some i in numbers.range(1, 100000000)]) == 0
+}
+`
+
+	authorizer, err := NewAuthorizer(context.Background(), Config{
+		Policy:   policy,
+		Decision: "data.registry.authz.allow",
+		Timeout:  10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	start := time.Now()
+
+	_, err = authorizer.Authorize(context.Background(), nil, []auth.Scope{
+		{
+			Resource: auth.Resource{Type: "repository", Name: "team/app"},
+			Actions:  []string{"pull"},
+		},
+	})
+	require.Error(t, err)
+
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestAuthorizer_Bundle(t *testing.T) {
+	bundle := t.TempDir()
+
+	const policy = `
+package registry.authz
+
+import future.keywords.if
+import future.keywords.in
+
+allow[scope.resource] := data.teams[input.subject.attributes.group][scope.name] if {
+	some scope in input.scopes
+}
+`
+
+	err := os.WriteFile(filepath.Join(bundle, "policy.rego"), []byte(policy), 0o600)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(bundle, "data.json"), []byte(`{"teams": {"team": {"team/app": ["pull", "push"]}}}`), 0o600)
+	require.NoError(t, err)
+
+	authorizer, err := NewAuthorizer(context.Background(), Config{
+		Bundle:   bundle,
+		Decision: "data.registry.authz.allow",
+	})
+	require.NoError(t, err)
+
+	subject := authn.User{
+		Enabled:  true,
+		Username: "user",
+		Attrs:    map[string]string{"group": "team"},
+	}
+
+	grantedScopes, err := authorizer.Authorize(context.Background(), subject, []auth.Scope{
+		{
+			Resource: auth.Resource{Type: "repository", Name: "team/app"},
+			Actions:  []string{"pull", "push", "delete"},
+		},
+	})
+	require.NoError(t, err)
+
+	expected := []auth.Scope{
+		{
+			Resource: auth.Resource{Type: "repository", Name: "team/app"},
+			Actions:  []string{"pull", "push"},
+		},
+	}
+
+	assert.Equal(t, expected, grantedScopes)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config Config
+	}{
+		{
+			name:   "MissingPolicy",
+			config: Config{Decision: "data.registry.authz.allow"},
+		},
+		{
+			name:   "PolicyAndBundle",
+			config: Config{Policy: policy, Bundle: "bundle", Decision: "data.registry.authz.allow"},
+		},
+		{
+			name:   "MissingDecision",
+			config: Config{Policy: policy},
+		},
+		{
+			name:   "InvalidDecision",
+			config: Config{Policy: policy, Decision: "input.allow"},
+		},
+		{
+			name:   "UndefinedDecision",
+			config: Config{Policy: policy, Decision: "data.registry.authz.deny"},
+		},
+		{
+			name:   "CompileError",
+			config: Config{Policy: "package registry.authz\n\nallow := ", Decision: "data.registry.authz.allow"},
+		},
+		{
+			name:   "MissingBundle",
+			config: Config{Bundle: filepath.Join(t.TempDir(), "missing"), Decision: "data.registry.authz.allow"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Error(t, testCase.config.Validate())
+		})
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		config := Config{Policy: policy, Decision: "data.registry.authz.allow"}
+
+		assert.NoError(t, config.Validate())
+	})
+}
@@ -0,0 +1,215 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+	"github.com/sagikazarmark/registry-auth/pkg/glob"
+)
+
+// Rule precedences of a PatternRepositoryAuthorizer.
+const (
+	// PrecedenceFirstMatch applies the first rule (in order) matching both the repository and the subject.
+	PrecedenceFirstMatch = "first-match"
+
+	// PrecedenceMostSpecific applies the matching rule with the most specific repository pattern (see [Pattern]).
+	// Among rules with equally specific repository patterns, rules with a subject pattern win over rules without one,
+	// then the first rule (in order) wins.
+	PrecedenceMostSpecific = "most-specific"
+)
+
+// Pattern matches names (eg. repository names or usernames) either against a glob (see [glob.Match]) or a regular expression.
+//
+// The zero value matches every name.
+type Pattern struct {
+	glob   string
+	regexp *regexp.Regexp
+}
+
+// GlobPattern returns a Pattern matching names against a glob pattern.
+func GlobPattern(pattern string) Pattern {
+	return Pattern{glob: pattern}
+}
+
+// RegexpPattern returns a Pattern matching names against a regular expression.
+//
+// The regular expression has to match the whole name (it is implicitly anchored).
+func RegexpPattern(pattern string) (Pattern, error) {
+	re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+	if err != nil {
+		return Pattern{}, err
+	}
+
+	return Pattern{regexp: re}, nil
+}
+
+// IsZero reports whether p is the zero value (matching every name).
+func (p Pattern) IsZero() bool {
+	return p.glob == "" && p.regexp == nil
+}
+
+// Match reports whether name matches the pattern.
+func (p Pattern) Match(name string) bool {
+	switch {
+	case p.regexp != nil:
+		return p.regexp.MatchString(name)
+
+	case p.glob != "":
+		return glob.Match(p.glob, name)
+	}
+
+	return true
+}
+
+// String implements [fmt.Stringer].
+func (p Pattern) String() string {
+	if p.regexp != nil {
+		// Strip the implicit anchors
+		s := p.regexp.String()
+
+		return s[len(`^(?:`) : len(s)-len(`)$`)]
+	}
+
+	return p.glob
+}
+
+// patternSpecificity ranks patterns: literal patterns (matching a single name) are the most specific,
+// other patterns are ranked by the number of literal characters (globs) or the length of their literal prefix (regular expressions).
+type patternSpecificity struct {
+	literal bool
+	length  int
+}
+
+func (s patternSpecificity) compare(other patternSpecificity) int {
+	switch {
+	case s.literal != other.literal:
+		if s.literal {
+			return 1
+		}
+
+		return -1
+
+	case s.length != other.length:
+		return s.length - other.length
+	}
+
+	return 0
+}
+
+func (p Pattern) specificity() patternSpecificity {
+	switch {
+	case p.regexp != nil:
+		prefix, complete := p.regexp.LiteralPrefix()
+
+		return patternSpecificity{literal: complete, length: len(prefix)}
+
+	case p.glob != "":
+		literal := strings.NewReplacer("*", "", "?", "").Replace(p.glob)
+
+		return patternSpecificity{literal: len(literal) == len(p.glob), length: len(literal)}
+	}
+
+	return patternSpecificity{}
+}
+
+// PatternRule grants actions on repositories matching a pattern to subjects matching a pattern.
+type PatternRule struct {
+	// Name is an optional human-readable name (or reason) of the rule.
+	// It is recorded (see [auth.RecordAuthorizationReason]) when the rule decides access to a repository.
+	Name string
+
+	// Repository is matched against repository names.
+	Repository Pattern
+
+	// Subject is matched against subject names (see [auth.GetSubjectName]).
+	// Rules with a subject pattern never apply to anonymous subjects.
+	// The zero value matches every subject (including anonymous ones).
+	Subject Pattern
+
+	// Actions are the actions granted by the rule.
+	Actions []string
+}
+
+// PatternRepositoryAuthorizer authorizes access to repositories based on a list of PatternRules.
+//
+// A single rule decides the granted actions (the intersection of the requested actions and the actions of the rule),
+// selected by the configured precedence. If no rule matches, access is denied.
+type PatternRepositoryAuthorizer struct {
+	rules      []PatternRule
+	precedence string
+}
+
+// NewPatternRepositoryAuthorizer returns a new PatternRepositoryAuthorizer.
+//
+// precedence defaults to PrecedenceFirstMatch.
+func NewPatternRepositoryAuthorizer(rules []PatternRule, precedence string) (PatternRepositoryAuthorizer, error) {
+	switch precedence {
+	case "":
+		precedence = PrecedenceFirstMatch
+
+	case PrecedenceFirstMatch, PrecedenceMostSpecific:
+
+	default:
+		return PatternRepositoryAuthorizer{}, fmt.Errorf("unsupported precedence %q", precedence)
+	}
+
+	return PatternRepositoryAuthorizer{
+		rules:      rules,
+		precedence: precedence,
+	}, nil
+}
+
+// Authorize implements RepositoryAuthorizer.
+func (a PatternRepositoryAuthorizer) Authorize(ctx context.Context, name string, subject auth.Subject, requestedActions []string) ([]string, error) {
+	var subjectName string
+
+	if subject != nil {
+		subjectName = auth.GetSubjectName(subject)
+	}
+
+	var (
+		match   PatternRule
+		matched bool
+	)
+
+	for _, rule := range a.rules {
+		if !rule.Repository.Match(name) {
+			continue
+		}
+
+		if !rule.Subject.IsZero() && (subject == nil || !rule.Subject.Match(subjectName)) {
+			continue
+		}
+
+		if a.precedence == PrecedenceFirstMatch {
+			match, matched = rule, true
+
+			break
+		}
+
+		if !matched || rule.moreSpecificThan(match) {
+			match, matched = rule, true
+		}
+	}
+
+	if !matched {
+		return []string{}, nil
+	}
+
+	if match.Name != "" {
+		auth.RecordAuthorizationReason(ctx, auth.Resource{Type: "repository", Name: name}, match.Name)
+	}
+
+	return IntersectActions(requestedActions, match.Actions), nil
+}
+
+func (r PatternRule) moreSpecificThan(other PatternRule) bool {
+	if c := r.Repository.specificity().compare(other.Repository.specificity()); c != 0 {
+		return c > 0
+	}
+
+	return !r.Subject.IsZero() && other.Subject.IsZero()
+}
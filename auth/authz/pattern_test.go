@@ -0,0 +1,169 @@
+package authz
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+func TestRegexpPattern(t *testing.T) {
+	pattern, err := RegexpPattern(`team/(app|web)`)
+	require.NoError(t, err)
+
+	assert.True(t, pattern.Match("team/app"))
+	assert.True(t, pattern.Match("team/web"))
+	assert.False(t, pattern.Match("team/app/sub"), "regular expressions must match the whole name")
+	assert.False(t, pattern.Match("other/team/app"), "regular expressions must match the whole name")
+	assert.Equal(t, `team/(app|web)`, pattern.String())
+
+	_, err = RegexpPattern(`team/(`)
+	require.Error(t, err)
+}
+
+func TestPatternRepositoryAuthorizer(t *testing.T) {
+	mustRegexp := func(pattern string) Pattern {
+		p, err := RegexpPattern(pattern)
+		require.NoError(t, err)
+
+		return p
+	}
+
+	rules := []PatternRule{
+		{
+			Repository: GlobPattern("team/**"),
+			Actions:    []string{"pull"},
+		},
+		{
+			Repository: GlobPattern("team/app"),
+			Subject:    mustRegexp(`ci-.+`),
+			Actions:    []string{"pull", "push"},
+		},
+		{
+			Repository: mustRegexp(`team/app(-[a-z]+)?`),
+			Subject:    GlobPattern("admin"),
+			Actions:    []string{"*"},
+		},
+		{
+			Repository: GlobPattern("public/*"),
+			Actions:    []string{"pull"},
+		},
+	}
+
+	testCases := []struct {
+		name       string
+		precedence string
+		repository string
+		subject    auth.Subject
+		expected   []string
+	}{
+		{
+			name:       "FirstMatch",
+			precedence: PrecedenceFirstMatch,
+			repository: "team/app",
+			subject:    subject{id: "ci-build"},
+			expected:   []string{"pull"},
+		},
+		{
+			name:       "MostSpecific",
+			precedence: PrecedenceMostSpecific,
+			repository: "team/app",
+			subject:    subject{id: "ci-build"},
+			expected:   []string{"pull", "push"},
+		},
+		{
+			name:       "MostSpecific_RegexpPrefix",
+			precedence: PrecedenceMostSpecific,
+			repository: "team/app",
+			subject:    subject{id: "admin"},
+			expected:   []string{"pull", "push", "delete"},
+		},
+		{
+			name:       "MostSpecific_Regexp",
+			precedence: PrecedenceMostSpecific,
+			repository: "team/app-dev",
+			subject:    subject{id: "admin"},
+			expected:   []string{"pull", "push", "delete"},
+		},
+		{
+			name:       "MostSpecific_SubjectMismatch",
+			precedence: PrecedenceMostSpecific,
+			repository: "team/app",
+			subject:    subject{id: "user"},
+			expected:   []string{"pull"},
+		},
+		{
+			name:       "SubjectPatternSkipsAnonymous",
+			precedence: PrecedenceMostSpecific,
+			repository: "team/app",
+			subject:    nil,
+			expected:   []string{"pull"},
+		},
+		{
+			name:       "Intersection",
+			precedence: PrecedenceFirstMatch,
+			repository: "public/app",
+			subject:    subject{id: "user"},
+			expected:   []string{"pull"},
+		},
+		{
+			name:       "DenyByDefault",
+			precedence: PrecedenceFirstMatch,
+			repository: "other/app",
+			subject:    subject{id: "admin"},
+			expected:   []string{},
+		},
+		{
+			name:       "DenyByDefault_MostSpecific",
+			precedence: PrecedenceMostSpecific,
+			repository: "public/nested/app",
+			subject:    subject{id: "admin"},
+			expected:   []string{},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			authorizer, err := NewPatternRepositoryAuthorizer(rules, testCase.precedence)
+			require.NoError(t, err)
+
+			actual, err := authorizer.Authorize(context.Background(), testCase.repository, testCase.subject, []string{"pull", "push", "delete"})
+			require.NoError(t, err)
+
+			assert.Equal(t, testCase.expected, actual)
+		})
+	}
+}
+
+func TestPatternRepositoryAuthorizer_MostSpecificTie(t *testing.T) {
+	rules := []PatternRule{
+		{
+			Name:       "first",
+			Repository: GlobPattern("team/*"),
+			Actions:    []string{"pull"},
+		},
+		{
+			Name:       "second",
+			Repository: GlobPattern("team/**"),
+			Actions:    []string{"pull", "push"},
+		},
+	}
+
+	authorizer, err := NewPatternRepositoryAuthorizer(rules, PrecedenceMostSpecific)
+	require.NoError(t, err)
+
+	actual, err := authorizer.Authorize(context.Background(), "team/app", subject{id: "user"}, []string{"pull", "push"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"pull"}, actual, "equally specific rules must be applied in order")
+}
+
+func TestNewPatternRepositoryAuthorizer_UnsupportedPrecedence(t *testing.T) {
+	_, err := NewPatternRepositoryAuthorizer(nil, "last-match")
+	require.Error(t, err)
+}
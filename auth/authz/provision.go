@@ -0,0 +1,60 @@
+package authz
+
+import (
+	"context"
+	"slices"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+	"github.com/sagikazarmark/registry-auth/pkg/glob"
+)
+
+// NamespaceProvisioningRepositoryAuthorizer grants every authenticated subject access to a personal namespace,
+// even if no explicit rule covers it (eg. for users authenticating for the first time).
+//
+// The namespace is a glob pattern containing the auth.SubjectPlaceholder (eg. namespace/{subject}/**).
+// Actions granted on the namespace are added to the ones granted by the underlying RepositoryAuthorizer.
+// Anonymous subjects never receive a namespace.
+type NamespaceProvisioningRepositoryAuthorizer struct {
+	repoAuthorizer RepositoryAuthorizer
+	namespace      string
+	actions        []string
+}
+
+// NewNamespaceProvisioningRepositoryAuthorizer returns a new NamespaceProvisioningRepositoryAuthorizer.
+//
+// Actions default to every action ("*").
+func NewNamespaceProvisioningRepositoryAuthorizer(repoAuthorizer RepositoryAuthorizer, namespace string, actions []string) NamespaceProvisioningRepositoryAuthorizer {
+	if len(actions) == 0 {
+		actions = []string{"*"}
+	}
+
+	return NamespaceProvisioningRepositoryAuthorizer{
+		repoAuthorizer: repoAuthorizer,
+		namespace:      namespace,
+		actions:        actions,
+	}
+}
+
+// Authorize implements RepositoryAuthorizer.
+func (a NamespaceProvisioningRepositoryAuthorizer) Authorize(ctx context.Context, name string, subject auth.Subject, requestedActions []string) ([]string, error) {
+	grantedActions, err := a.repoAuthorizer.Authorize(ctx, name, subject, requestedActions)
+	if err != nil {
+		return nil, err
+	}
+
+	if subject == nil {
+		return grantedActions, nil
+	}
+
+	if !glob.Match(subjectPattern(a.namespace, auth.GetSubjectName(subject)), name) {
+		return grantedActions, nil
+	}
+
+	for _, action := range IntersectActions(requestedActions, a.actions) {
+		if !slices.Contains(grantedActions, action) {
+			grantedActions = append(grantedActions, action)
+		}
+	}
+
+	return grantedActions, nil
+}
@@ -0,0 +1,91 @@
+package authz
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+func TestNamespaceProvisioningRepositoryAuthorizer(t *testing.T) {
+	rules := []Rule{
+		{
+			Repository: "library/**",
+			Actions:    []string{"pull"},
+		},
+		{
+			Repository:        "namespace/**",
+			SubjectAttributes: map[string]string{"role": "admin"},
+			Actions:           []string{"pull", "delete"},
+		},
+	}
+
+	authorizer := NewNamespaceProvisioningRepositoryAuthorizer(
+		NewRuleRepositoryAuthorizer(rules, MissingAttributeSkip),
+		"namespace/{subject}/**",
+		[]string{"pull", "push"},
+	)
+
+	testCases := []struct {
+		name            string
+		repository      string
+		subject         auth.Subject
+		expectedActions []string
+	}{
+		{
+			name:            "NewUser",
+			repository:      "namespace/user/app",
+			subject:         subject{id: "user"},
+			expectedActions: []string{"pull", "push"},
+		},
+		{
+			name:            "OtherNamespace",
+			repository:      "namespace/other/app",
+			subject:         subject{id: "user"},
+			expectedActions: []string{},
+		},
+		{
+			name:            "WildcardSubjectName",
+			repository:      "namespace/other/app",
+			subject:         subject{id: "*"},
+			expectedActions: []string{},
+		},
+		{
+			name:            "DoubleWildcardSubjectName",
+			repository:      "namespace/other/app",
+			subject:         subject{id: "**"},
+			expectedActions: []string{},
+		},
+		{
+			name:            "ExplicitRule",
+			repository:      "namespace/admin/app",
+			subject:         subject{id: "admin", attributes: map[string]string{"role": "admin"}},
+			expectedActions: []string{"pull", "delete", "push"},
+		},
+		{
+			name:            "OutsideNamespace",
+			repository:      "library/app",
+			subject:         subject{id: "user"},
+			expectedActions: []string{"pull"},
+		},
+		{
+			name:            "Anonymous",
+			repository:      "namespace/user/app",
+			expectedActions: []string{},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			actions, err := authorizer.Authorize(context.Background(), testCase.repository, testCase.subject, []string{"pull", "push", "delete"})
+			require.NoError(t, err)
+
+			assert.Equal(t, testCase.expectedActions, actions)
+		})
+	}
+}
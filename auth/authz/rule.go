@@ -0,0 +1,220 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+	"github.com/sagikazarmark/registry-auth/pkg/glob"
+)
+
+// Behaviors when a subject lacks an attribute required by a Rule.
+const (
+	// MissingAttributeDeny denies access to repositories matched by the rule.
+	MissingAttributeDeny = "deny"
+
+	// MissingAttributeSkip ignores the rule and continues with the next one.
+	MissingAttributeSkip = "skip"
+)
+
+// Rule grants actions on repositories to subjects.
+type Rule struct {
+	// Name is an optional human-readable name (or reason) of the rule.
+	// It is recorded (see [auth.RecordAuthorizationReason]) when the rule decides access to a repository.
+	Name string `json:"name,omitempty"`
+
+	// Repository is a glob pattern matched against repository names (see [glob.Match]).
+	// It may contain the auth.SubjectPlaceholder (eg. {subject}/**).
+	Repository string `json:"repository"`
+
+	// SubjectAttributes are attributes the subject must have (with the exact values) for the rule to apply.
+	// Rules without required attributes apply to every subject (including anonymous ones).
+	SubjectAttributes map[string]string `json:"subjectAttributes,omitempty"`
+
+	// Groups are groups of the subject's identity (see [auth.GetSubjectIdentity]) the subject must belong to (at least one of them) for the rule to apply.
+	// Subjects without an identity are treated as missing a required attribute.
+	Groups []string `json:"groups,omitempty"`
+
+	// Actions are the actions granted by the rule.
+	Actions []string `json:"actions"`
+
+	// MissingAttribute controls what happens when the subject lacks a required attribute.
+	// Defaults to the behavior configured for the RuleRepositoryAuthorizer.
+	MissingAttribute string `json:"missingAttribute,omitempty"`
+}
+
+// RuleSet is a list of rules along with the default behavior for missing attributes.
+type RuleSet struct {
+	MissingAttribute string `json:"missingAttribute"`
+	Rules            []Rule `json:"rules"`
+}
+
+// RuleSetHandler responds with ruleSet encoded as JSON.
+//
+// It helps confirming the effective rules (eg. after configuration processing).
+// Rules are not secret, but the handler should still be restricted to administrators (see [auth.AdminMiddleware]).
+func RuleSetHandler(ruleSet RuleSet) http.Handler {
+	if ruleSet.MissingAttribute == "" {
+		ruleSet.MissingAttribute = MissingAttributeDeny
+	}
+
+	if ruleSet.Rules == nil {
+		ruleSet.Rules = []Rule{}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(ruleSet)
+	})
+}
+
+// RuleRepositoryAuthorizer authorizes access to repositories based on a list of rules.
+//
+// Rules are evaluated in order and the first rule matching both the repository and the subject decides the granted actions.
+// If no rule matches, access is denied.
+type RuleRepositoryAuthorizer struct {
+	rules            []Rule
+	missingAttribute string
+}
+
+// NewRuleRepositoryAuthorizer returns a new RuleRepositoryAuthorizer.
+//
+// missingAttribute is the default behavior for rules requiring an attribute the subject lacks.
+// It defaults to MissingAttributeDeny.
+func NewRuleRepositoryAuthorizer(rules []Rule, missingAttribute string) RuleRepositoryAuthorizer {
+	if missingAttribute == "" {
+		missingAttribute = MissingAttributeDeny
+	}
+
+	return RuleRepositoryAuthorizer{
+		rules:            rules,
+		missingAttribute: missingAttribute,
+	}
+}
+
+// Authorize implements RepositoryAuthorizer.
+func (a RuleRepositoryAuthorizer) Authorize(ctx context.Context, name string, subject auth.Subject, requestedActions []string) ([]string, error) {
+	var subjectName string
+
+	if subject != nil {
+		subjectName = auth.GetSubjectName(subject)
+	}
+
+	for _, rule := range a.rules {
+		pattern := rule.Repository
+
+		if strings.Contains(pattern, auth.SubjectPlaceholder) {
+			// Personal rules never apply to anonymous subjects
+			if subject == nil {
+				continue
+			}
+
+			pattern = subjectPattern(pattern, subjectName)
+		}
+
+		if !glob.Match(pattern, name) {
+			continue
+		}
+
+		matches, missing := rule.matchesSubject(subject)
+		if missing {
+			missingAttribute := rule.MissingAttribute
+			if missingAttribute == "" {
+				missingAttribute = a.missingAttribute
+			}
+
+			if missingAttribute == MissingAttributeSkip {
+				continue
+			}
+
+			rule.recordReason(ctx, name)
+
+			return []string{}, nil
+		}
+
+		if !matches {
+			continue
+		}
+
+		rule.recordReason(ctx, name)
+
+		return IntersectActions(requestedActions, rule.Actions), nil
+	}
+
+	return []string{}, nil
+}
+
+func (r Rule) recordReason(ctx context.Context, repository string) {
+	if r.Name == "" {
+		return
+	}
+
+	auth.RecordAuthorizationReason(ctx, auth.Resource{Type: "repository", Name: repository}, r.Name)
+}
+
+// matchesSubject reports whether the subject has every required attribute (and group)
+// and whether any of the required attributes are missing.
+func (r Rule) matchesSubject(subject auth.Subject) (bool, bool) {
+	matches := true
+
+	if len(r.Groups) > 0 {
+		if subject == nil {
+			return false, true
+		}
+
+		identity, ok := auth.GetSubjectIdentity(subject)
+		if !ok {
+			return false, true
+		}
+
+		if !slices.ContainsFunc(r.Groups, func(group string) bool { return slices.Contains(identity.Groups, group) }) {
+			matches = false
+		}
+	}
+
+	for key, value := range r.SubjectAttributes {
+		if subject == nil {
+			return false, true
+		}
+
+		v, ok := subject.Attribute(key)
+		if !ok {
+			return false, true
+		}
+
+		if v != value {
+			matches = false
+		}
+	}
+
+	return matches, false
+}
+
+// subjectPattern replaces auth.SubjectPlaceholder in pattern with subjectName.
+//
+// Metacharacters in subjectName are escaped (see [glob.QuoteMeta]):
+// otherwise a subject named "*" would match the namespace of every other subject.
+func subjectPattern(pattern string, subjectName string) string {
+	return strings.ReplaceAll(pattern, auth.SubjectPlaceholder, glob.QuoteMeta(subjectName))
+}
+
+// IntersectActions returns the requested actions that are also allowed.
+// The "*" allowed action grants every requested action.
+func IntersectActions(requestedActions []string, allowedActions []string) []string {
+	if slices.Contains(allowedActions, "*") {
+		return slices.Clone(requestedActions)
+	}
+
+	grantedActions := make([]string, 0, len(requestedActions))
+
+	for _, action := range requestedActions {
+		if slices.Contains(allowedActions, action) {
+			grantedActions = append(grantedActions, action)
+		}
+	}
+
+	return grantedActions
+}
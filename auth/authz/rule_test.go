@@ -0,0 +1,307 @@
+package authz
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+	"github.com/sagikazarmark/registry-auth/auth/fakes"
+)
+
+func TestRuleRepositoryAuthorizer(t *testing.T) {
+	rules := []Rule{
+		{
+			Repository: "{subject}/**",
+			Actions:    []string{"*"},
+		},
+		{
+			Repository:        "team/**",
+			SubjectAttributes: map[string]string{"group": "team"},
+			Actions:           []string{"pull", "push"},
+		},
+		{
+			Repository: "**",
+			Actions:    []string{"pull"},
+		},
+	}
+
+	authorizer := NewRuleRepositoryAuthorizer(rules, "")
+
+	testCases := []struct {
+		name            string
+		repository      string
+		subject         auth.Subject
+		expectedActions []string
+	}{
+		{
+			name:            "PersonalNamespace",
+			repository:      "user/app",
+			subject:         subject{id: "user"},
+			expectedActions: []string{"pull", "push", "delete"},
+		},
+		{
+			name:            "AttributeMatches",
+			repository:      "team/app",
+			subject:         subject{id: "user", attributes: map[string]string{"group": "team"}},
+			expectedActions: []string{"pull", "push"},
+		},
+		{
+			name:            "AttributeMismatch",
+			repository:      "team/app",
+			subject:         subject{id: "user", attributes: map[string]string{"group": "other"}},
+			expectedActions: []string{"pull"},
+		},
+		{
+			name:            "NoMatch",
+			repository:      "other/app",
+			subject:         nil,
+			expectedActions: []string{"pull"},
+		},
+		{
+			name:            "WildcardSubjectName",
+			repository:      "user/app",
+			subject:         subject{id: "*"},
+			expectedActions: []string{"pull"},
+		},
+		{
+			name:            "DoubleWildcardSubjectName",
+			repository:      "user/app",
+			subject:         subject{id: "**"},
+			expectedActions: []string{"pull"},
+		},
+		{
+			name:            "WildcardSubjectNamespace",
+			repository:      "*/app",
+			subject:         subject{id: "*"},
+			expectedActions: []string{"pull", "push", "delete"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			grantedActions, err := authorizer.Authorize(context.Background(), testCase.repository, testCase.subject, []string{"pull", "push", "delete"})
+			require.NoError(t, err)
+
+			assert.Equal(t, testCase.expectedActions, grantedActions)
+		})
+	}
+}
+
+func TestRuleRepositoryAuthorizer_MissingAttribute(t *testing.T) {
+	rules := []Rule{
+		{
+			Repository:        "team/**",
+			SubjectAttributes: map[string]string{"group": "team"},
+			Actions:           []string{"pull", "push"},
+		},
+		{
+			Repository: "**",
+			Actions:    []string{"pull"},
+		},
+	}
+
+	// The subject lacks the group attribute
+	s := subject{id: "user"}
+
+	t.Run("Deny", func(t *testing.T) {
+		authorizer := NewRuleRepositoryAuthorizer(rules, MissingAttributeDeny)
+
+		grantedActions, err := authorizer.Authorize(context.Background(), "team/app", s, []string{"pull", "push"})
+		require.NoError(t, err)
+
+		assert.Empty(t, grantedActions)
+	})
+
+	t.Run("Skip", func(t *testing.T) {
+		authorizer := NewRuleRepositoryAuthorizer(rules, MissingAttributeSkip)
+
+		grantedActions, err := authorizer.Authorize(context.Background(), "team/app", s, []string{"pull", "push"})
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"pull"}, grantedActions)
+	})
+
+	t.Run("RuleOverride", func(t *testing.T) {
+		rules := []Rule{rules[0], rules[1]}
+		rules[0].MissingAttribute = MissingAttributeSkip
+
+		authorizer := NewRuleRepositoryAuthorizer(rules, MissingAttributeDeny)
+
+		grantedActions, err := authorizer.Authorize(context.Background(), "team/app", s, []string{"pull", "push"})
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"pull"}, grantedActions)
+	})
+}
+
+func TestRuleRepositoryAuthorizer_Groups(t *testing.T) {
+	rules := []Rule{
+		{
+			Repository: "team/**",
+			Groups:     []string{"developers", "admins"},
+			Actions:    []string{"pull", "push"},
+		},
+		{
+			Repository: "**",
+			Actions:    []string{"pull"},
+		},
+	}
+
+	authorizer := NewRuleRepositoryAuthorizer(rules, MissingAttributeSkip)
+
+	testCases := []struct {
+		name            string
+		subject         auth.Subject
+		expectedActions []string
+	}{
+		{
+			name:            "Member",
+			subject:         subject{id: "user", groups: []string{"users", "admins"}},
+			expectedActions: []string{"pull", "push"},
+		},
+		{
+			name:            "NotMember",
+			subject:         subject{id: "user", groups: []string{"users"}},
+			expectedActions: []string{"pull"},
+		},
+		{
+			name:            "NoIdentity",
+			subject:         subject{id: "user"},
+			expectedActions: []string{"pull"},
+		},
+		{
+			name:            "Anonymous",
+			subject:         nil,
+			expectedActions: []string{"pull"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			grantedActions, err := authorizer.Authorize(context.Background(), "team/app", testCase.subject, []string{"pull", "push"})
+			require.NoError(t, err)
+
+			assert.Equal(t, testCase.expectedActions, grantedActions)
+		})
+	}
+
+	t.Run("MissingIdentityDenies", func(t *testing.T) {
+		authorizer := NewRuleRepositoryAuthorizer(rules, MissingAttributeDeny)
+
+		grantedActions, err := authorizer.Authorize(context.Background(), "team/app", subject{id: "user"}, []string{"pull", "push"})
+		require.NoError(t, err)
+
+		assert.Empty(t, grantedActions)
+	})
+}
+
+type passwordAuthenticatorStub struct {
+	subjects map[string]auth.Subject
+}
+
+func (a passwordAuthenticatorStub) AuthenticatePassword(_ context.Context, username string, _ string) (auth.Subject, error) {
+	subject, ok := a.subjects[username]
+	if !ok {
+		return nil, auth.ErrAuthenticationFailed
+	}
+
+	return subject, nil
+}
+
+type auditLoggerStub struct {
+	events *[]auth.AuditEvent
+}
+
+func (l auditLoggerStub) LogAuditEvent(_ context.Context, event auth.AuditEvent) {
+	*l.events = append(*l.events, event)
+}
+
+func TestRuleRepositoryAuthorizer_Reason(t *testing.T) {
+	rules := []Rule{
+		{
+			Name:              "team members",
+			Repository:        "team/**",
+			SubjectAttributes: map[string]string{"group": "team"},
+			Actions:           []string{"pull", "push"},
+		},
+		{
+			Repository: "**",
+			Actions:    []string{"pull"},
+		},
+	}
+
+	tokenIssuer := fakes.FakeTokenIssuer{Expiration: 5 * time.Minute}
+
+	service := auth.TokenServiceImpl{
+		Authenticator: auth.Authenticator{
+			PasswordAuthenticator: passwordAuthenticatorStub{
+				subjects: map[string]auth.Subject{
+					"user": subject{id: "user", attributes: map[string]string{"group": "team"}},
+				},
+			},
+		},
+		Authorizer: NewDefaultAuthorizer(NewRuleRepositoryAuthorizer(rules, ""), false),
+		TokenIssuer: auth.TokenIssuer{
+			AccessTokenIssuer: tokenIssuer,
+		},
+	}
+
+	scopes := auth.Scopes{
+		{
+			Resource: auth.Resource{Type: "repository", Name: "team/app"},
+			Actions:  []string{"pull", "push"},
+		},
+		{
+			Resource: auth.Resource{Type: "repository", Name: "other/app"},
+			Actions:  []string{"pull"},
+		},
+	}
+
+	expected := []auth.AuthorizationReason{
+		{
+			Resource: auth.Resource{Type: "repository", Name: "team/app"},
+			Reason:   "team members",
+		},
+	}
+
+	t.Run("Audit", func(t *testing.T) {
+		var events []auth.AuditEvent
+
+		auditService := auth.AuditTokenService{
+			Service:     service,
+			AuditLogger: auditLoggerStub{&events},
+		}
+
+		_, err := auditService.TokenHandler(context.Background(), auth.TokenRequest{
+			Service:  "service.example.com",
+			Scopes:   scopes,
+			Username: "user",
+			Password: "password",
+		})
+		require.NoError(t, err)
+
+		require.Len(t, events, 1)
+
+		assert.Equal(t, expected, events[0].Reasons)
+	})
+
+	t.Run("Permissions", func(t *testing.T) {
+		response, err := service.PermissionsHandler(context.Background(), auth.PermissionsRequest{
+			Service:  "service.example.com",
+			Scopes:   scopes,
+			Username: "user",
+			Password: "password",
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, expected, response.Reasons)
+	})
+}
@@ -0,0 +1,120 @@
+package authz
+
+import (
+	"context"
+	"maps"
+	"regexp"
+	"slices"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+// IdentityGroupsAttribute is the Attribute of AttributeTransformation rewriting every group of the subject's identity
+// (see [auth.GetSubjectIdentity]) instead of an attribute.
+const IdentityGroupsAttribute = "identity.groups"
+
+// AttributeTransformation rewrites the value of a subject attribute before authorization.
+//
+// For example, it can turn group DNs returned by LDAP (cn=admins,ou=groups,dc=example,dc=com)
+// into the short names (admins) authorization rules reference.
+type AttributeTransformation struct {
+	// Attribute is the key of the attribute to transform (or IdentityGroupsAttribute).
+	Attribute string
+
+	// Regexp extracts the new value from the original one: the first capturing group (or the whole match if there is none).
+	// Values that do not match are left intact.
+	Regexp *regexp.Regexp
+
+	// Mapping replaces values (after applying Regexp) found in the table.
+	Mapping map[string]string
+}
+
+func (t AttributeTransformation) transform(value string) string {
+	if t.Regexp != nil {
+		if match := t.Regexp.FindStringSubmatch(value); match != nil {
+			if len(match) > 1 {
+				value = match[1]
+			} else {
+				value = match[0]
+			}
+		}
+	}
+
+	if mapped, ok := t.Mapping[value]; ok {
+		value = mapped
+	}
+
+	return value
+}
+
+// AttributeTransformingAuthorizer transforms subject attributes before passing the subject to another auth.Authorizer.
+type AttributeTransformingAuthorizer struct {
+	authorizer      auth.Authorizer
+	transformations []AttributeTransformation
+}
+
+// NewAttributeTransformingAuthorizer returns a new AttributeTransformingAuthorizer.
+func NewAttributeTransformingAuthorizer(authorizer auth.Authorizer, transformations []AttributeTransformation) AttributeTransformingAuthorizer {
+	return AttributeTransformingAuthorizer{
+		authorizer:      authorizer,
+		transformations: transformations,
+	}
+}
+
+// Authorize implements auth.Authorizer.
+func (a AttributeTransformingAuthorizer) Authorize(ctx context.Context, subject auth.Subject, requestedScopes []auth.Scope) ([]auth.Scope, error) {
+	if subject == nil || len(a.transformations) == 0 {
+		return a.authorizer.Authorize(ctx, subject, requestedScopes)
+	}
+
+	attrs := subject.Attributes()
+	if attrs == nil {
+		attrs = map[string]string{}
+	}
+
+	identity, hasIdentity := auth.GetSubjectIdentity(subject)
+	identity.Groups = slices.Clone(identity.Groups)
+
+	for _, transformation := range a.transformations {
+		if transformation.Attribute == IdentityGroupsAttribute {
+			for i, group := range identity.Groups {
+				identity.Groups[i] = transformation.transform(group)
+			}
+
+			continue
+		}
+
+		value, ok := attrs[transformation.Attribute]
+		if !ok {
+			continue
+		}
+
+		attrs[transformation.Attribute] = transformation.transform(value)
+	}
+
+	return a.authorizer.Authorize(ctx, transformedSubject{subject, attrs, identity, hasIdentity}, requestedScopes)
+}
+
+// transformedSubject overrides the attributes (and the identity) of an auth.Subject.
+type transformedSubject struct {
+	auth.Subject
+
+	attrs map[string]string
+
+	identity    auth.Identity
+	hasIdentity bool
+}
+
+func (s transformedSubject) Attribute(key string) (string, bool) {
+	v, ok := s.attrs[key]
+
+	return v, ok
+}
+
+func (s transformedSubject) Attributes() map[string]string {
+	return maps.Clone(s.attrs)
+}
+
+func (s transformedSubject) Identity() (auth.Identity, bool) {
+	return s.identity, s.hasIdentity
+}
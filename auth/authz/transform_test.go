@@ -0,0 +1,158 @@
+package authz
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+func TestAttributeTransformation(t *testing.T) {
+	testCases := []struct {
+		name           string
+		transformation AttributeTransformation
+		value          string
+		expected       string
+	}{
+		{
+			name: "RegexpCapture",
+			transformation: AttributeTransformation{
+				Regexp: regexp.MustCompile(`^cn=([^,]+),`),
+			},
+			value:    "cn=admins,ou=groups,dc=example,dc=com",
+			expected: "admins",
+		},
+		{
+			name: "RegexpNoMatch",
+			transformation: AttributeTransformation{
+				Regexp: regexp.MustCompile(`^cn=([^,]+),`),
+			},
+			value:    "admins",
+			expected: "admins",
+		},
+		{
+			name: "Mapping",
+			transformation: AttributeTransformation{
+				Mapping: map[string]string{
+					"cn=admins,ou=groups,dc=example,dc=com": "admin",
+				},
+			},
+			value:    "cn=admins,ou=groups,dc=example,dc=com",
+			expected: "admin",
+		},
+		{
+			name: "RegexpThenMapping",
+			transformation: AttributeTransformation{
+				Regexp: regexp.MustCompile(`^cn=([^,]+),`),
+				Mapping: map[string]string{
+					"admins": "admin",
+				},
+			},
+			value:    "cn=admins,ou=groups,dc=example,dc=com",
+			expected: "admin",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, testCase.transformation.transform(testCase.value))
+		})
+	}
+}
+
+func TestAttributeTransformingAuthorizer(t *testing.T) {
+	// The rule references the short group name
+	authorizer := NewAttributeTransformingAuthorizer(
+		NewFilteringAuthorizer(allowAllAuthorizer{}, []ResourceTypeFilter{
+			{
+				SubjectAttributes: map[string]string{"group": "users"},
+				Deny:              []string{"registry"},
+			},
+		}),
+		[]AttributeTransformation{
+			{
+				Attribute: "group",
+				Regexp:    regexp.MustCompile(`^cn=([^,]+),`),
+			},
+		},
+	)
+
+	requestedScopes := []auth.Scope{
+		{
+			Resource: auth.Resource{Type: "registry", Name: "catalog"},
+			Actions:  []string{"*"},
+		},
+	}
+
+	t.Run("Admin", func(t *testing.T) {
+		s := subject{
+			id:         "admin",
+			attributes: map[string]string{"group": "cn=admins,ou=groups,dc=example,dc=com"},
+		}
+
+		grantedScopes, err := authorizer.Authorize(context.Background(), s, requestedScopes)
+		require.NoError(t, err)
+
+		assert.Equal(t, requestedScopes, grantedScopes)
+	})
+
+	t.Run("User", func(t *testing.T) {
+		s := subject{
+			id:         "user",
+			attributes: map[string]string{"group": "cn=users,ou=groups,dc=example,dc=com"},
+		}
+
+		grantedScopes, err := authorizer.Authorize(context.Background(), s, requestedScopes)
+		require.NoError(t, err)
+
+		assert.Empty(t, grantedScopes)
+
+		// The original subject is left intact
+		group, _ := s.Attribute("group")
+		assert.Equal(t, "cn=users,ou=groups,dc=example,dc=com", group)
+	})
+}
+
+func TestAttributeTransformingAuthorizer_IdentityGroups(t *testing.T) {
+	authorizer := NewAttributeTransformingAuthorizer(
+		NewDefaultAuthorizer(NewRuleRepositoryAuthorizer([]Rule{
+			{
+				Repository: "team/**",
+				Groups:     []string{"admins"},
+				Actions:    []string{"pull", "push"},
+			},
+		}, MissingAttributeDeny), false),
+		[]AttributeTransformation{
+			{
+				Attribute: IdentityGroupsAttribute,
+				Regexp:    regexp.MustCompile(`^cn=([^,]+),`),
+			},
+		},
+	)
+
+	requestedScopes := []auth.Scope{
+		{
+			Resource: auth.Resource{Type: "repository", Name: "team/app"},
+			Actions:  []string{"pull", "push"},
+		},
+	}
+
+	s := subject{
+		id:     "admin",
+		groups: []string{"cn=users,ou=groups,dc=example,dc=com", "cn=admins,ou=groups,dc=example,dc=com"},
+	}
+
+	grantedScopes, err := authorizer.Authorize(context.Background(), s, requestedScopes)
+	require.NoError(t, err)
+
+	assert.Equal(t, requestedScopes, grantedScopes)
+
+	// The original subject is left intact
+	assert.Equal(t, "cn=admins,ou=groups,dc=example,dc=com", s.groups[1])
+}
@@ -0,0 +1,352 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// DefaultMaxBatchEntries is the maximum number of entries in a batch token request unless configured otherwise
+// (see TokenServer.MaxBatchEntries).
+const DefaultMaxBatchEntries = 20
+
+// BatchTokenService issues multiple access tokens in a single round trip.
+//
+// It is an optional extension of TokenService, useful for clients that need tokens for several repositories at once
+// (eg. when pulling a multi-arch image).
+type BatchTokenService interface {
+	BatchTokenHandler(ctx context.Context, r BatchTokenRequest) (BatchTokenResponse, error)
+}
+
+// BatchTokenRequest requests an access token for each entry.
+//
+// The subject is authenticated once, then every entry is authorized independently.
+type BatchTokenRequest struct {
+	Service  string
+	ClientID string
+	Entries  []BatchTokenRequestEntry
+
+	Anonymous bool
+	Username  string
+	Password  string
+
+	// DPoPKeyThumbprint is the JWK thumbprint of a verified DPoP proof key the access tokens should be bound to.
+	DPoPKeyThumbprint string
+}
+
+// BatchTokenRequestEntry is a set of scopes a single access token is requested for.
+type BatchTokenRequestEntry struct {
+	Scopes Scopes
+}
+
+// AuthenticationMethod returns the method the request authenticates with or an empty string for anonymous requests.
+func (r BatchTokenRequest) AuthenticationMethod() string {
+	if r.Anonymous {
+		return ""
+	}
+
+	return AuthenticationMethodPassword
+}
+
+func (r BatchTokenRequest) Validate() error {
+	if r.Service == "" {
+		return fmt.Errorf("%w: service is required", ErrInvalidRequest)
+	}
+
+	if len(r.Entries) == 0 {
+		return fmt.Errorf("%w: at least one entry is required", ErrInvalidRequest)
+	}
+
+	return nil
+}
+
+// BatchTokenResponse contains an access token for each entry of a BatchTokenRequest (in the same order).
+type BatchTokenResponse struct {
+	Tokens []BatchToken `json:"tokens"`
+}
+
+// BatchToken is an access token issued for a BatchTokenRequestEntry.
+type BatchToken struct {
+	Token     string `json:"access_token"`
+	TokenType string `json:"token_type,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	ExpiresIn int    `json:"expires_in,omitempty"`
+	IssuedAt  string `json:"issued_at,omitempty"`
+}
+
+// BatchTokenHandler implements BatchTokenService.
+func (s TokenServiceImpl) BatchTokenHandler(ctx context.Context, r BatchTokenRequest) (BatchTokenResponse, error) {
+	ctx, span := startSpan(
+		ctx,
+		s.Dependencies.GetTracerProvider(),
+		"BatchTokenHandler",
+		TraceAttributeGrantType.String(tokenRequestGrantType(r.AuthenticationMethod())),
+		TraceAttributeAuthenticationMethod.String(r.AuthenticationMethod()),
+		TraceAttributeService.String(r.Service),
+	)
+
+	resp, err := s.batchTokenHandler(ctx, r)
+
+	endSpan(span, err)
+
+	return resp, err
+}
+
+func (s TokenServiceImpl) batchTokenHandler(ctx context.Context, r BatchTokenRequest) (BatchTokenResponse, error) {
+	if err := r.Validate(); err != nil {
+		return BatchTokenResponse{}, err
+	}
+
+	var subject Subject
+
+	if !r.Anonymous {
+		var err error
+
+		subject, err = s.authenticate(ctx, AuthenticationMethodPassword, func(ctx context.Context) (Subject, error) {
+			return s.Authenticator.AuthenticatePassword(ctx, r.Username, r.Password)
+		})
+		if err != nil {
+			recordAuthenticationError(ctx, err)
+
+			return BatchTokenResponse{}, err
+		}
+	}
+
+	ctx = withAuthenticationMethod(ctx, r.AuthenticationMethod())
+	recordSubject(ctx, subject)
+
+	response := BatchTokenResponse{
+		Tokens: make([]BatchToken, 0, len(r.Entries)),
+	}
+
+	for _, entry := range r.Entries {
+		token, grantedScopes, err := s.authorizeAndIssueAccessToken(ctx, r.Service, subject, entry.Scopes, r.DPoPKeyThumbprint)
+		if err != nil {
+			return BatchTokenResponse{}, err
+		}
+
+		response.Tokens = append(response.Tokens, BatchToken{
+			Token:     token.Payload,
+			TokenType: tokenType(r.DPoPKeyThumbprint),
+			Scope:     Scopes(grantedScopes).String(),
+			ExpiresIn: int(token.ExpiresIn.Seconds()),
+			IssuedAt:  token.IssuedAt.Format(time.RFC3339),
+		})
+	}
+
+	return response, nil
+}
+
+// BatchTokenHandler implements BatchTokenService and logs every request.
+//
+// It returns an error if the underlying TokenService does not implement BatchTokenService.
+func (s LoggerTokenService) BatchTokenHandler(ctx context.Context, r BatchTokenRequest) (BatchTokenResponse, error) {
+	service, ok := s.Service.(BatchTokenService)
+	if !ok {
+		return BatchTokenResponse{}, errors.New("batch token requests are not supported")
+	}
+
+	ctx, record := contextWithTokenRequestRecord(ctx)
+
+	resp, err := service.BatchTokenHandler(ctx, r)
+
+	logger := s.Logger.With(
+		slog.String("request_id", RequestIDFromContext(ctx)),
+		slog.String("client_id", r.ClientID),
+		slog.String("service", r.Service),
+		slog.Int("entries", len(r.Entries)),
+		slog.Bool("anonymous", r.Anonymous),
+		slog.String("authentication_method", r.AuthenticationMethod()),
+		s.subjectAttr(record),
+	).With(s.usernameAttrs(r.Username)...)
+
+	if err != nil && !(errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrAuthenticationFailed)) {
+		logger.Error("authorization failed", failureAttrs(record, err, r.Password)...)
+	} else if err != nil {
+		logger.Info("authorization failed due to client error", failureAttrs(record, err, r.Password)...)
+	} else {
+		logger.Info("client authorized")
+	}
+
+	return resp, err
+}
+
+// BatchTokenHandler implements BatchTokenService and records an audit event for every request.
+//
+// It returns an error if the underlying TokenService does not implement BatchTokenService.
+func (s AuditTokenService) BatchTokenHandler(ctx context.Context, r BatchTokenRequest) (BatchTokenResponse, error) {
+	service, ok := s.Service.(BatchTokenService)
+	if !ok {
+		return BatchTokenResponse{}, errors.New("batch token requests are not supported")
+	}
+
+	ctx, record := contextWithTokenRequestRecord(ctx)
+
+	resp, err := service.BatchTokenHandler(ctx, r)
+
+	var requestedScopes Scopes
+
+	for _, entry := range r.Entries {
+		requestedScopes = append(requestedScopes, entry.Scopes...)
+	}
+
+	s.logAuditEvent(ctx, record, AuditEvent{
+		Operation:            AuditOperationBatchToken,
+		ClientID:             r.ClientID,
+		Service:              r.Service,
+		AuthenticationMethod: r.AuthenticationMethod(),
+		RequestedScopes:      requestedScopes,
+	}, err)
+
+	return resp, err
+}
+
+// BatchTokenHandler issues multiple access tokens in a single request.
+//
+// The request body is a JSON document listing the scopes of each token:
+//
+//	{"service": "registry.example.com", "client_id": "client", "requests": [{"scope": ["repository:foo:pull"]}, {"scope": ["repository:bar:pull"]}]}
+//
+// Credentials are accepted using basic auth, the same way as in TokenHandler.
+// Requests with more entries than MaxBatchEntries are rejected.
+// The Service must implement BatchTokenService.
+func (s TokenServer) BatchTokenHandler(w http.ResponseWriter, r *http.Request) {
+	s.preventCaching(w)
+
+	service, ok := s.Service.(BatchTokenService)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	request, err := decodeBatchTokenRequest(r, s.maxBatchEntries(), s.checkScopes)
+	if err != nil {
+		s.Logger.Error("failed to decode request", slog.Any("error", err))
+		s.handleError(err, w, r)
+		return
+	}
+
+	request.Service = s.service(request.Service)
+
+	if s.RejectEmptyPassword && !request.Anonymous && request.Password == "" {
+		s.handleError(ErrAuthenticationFailed, w, r)
+		return
+	}
+
+	request.DPoPKeyThumbprint, err = s.verifyDPoPProof(r)
+	if err != nil {
+		s.handleError(err, w, r)
+		return
+	}
+
+	response, err := service.BatchTokenHandler(r.Context(), request)
+	if err != nil {
+		s.handleError(err, w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// maxBatchEntries returns MaxBatchEntries or DefaultMaxBatchEntries if it is not set.
+func (s TokenServer) maxBatchEntries() int {
+	if s.MaxBatchEntries <= 0 {
+		return DefaultMaxBatchEntries
+	}
+
+	return s.MaxBatchEntries
+}
+
+func decodeBatchTokenRequest(r *http.Request, maxEntries int, checkScopes func([]Scope) ([]Scope, error)) (BatchTokenRequest, error) {
+	var rawRequest rawBatchTokenRequest
+
+	err := json.NewDecoder(r.Body).Decode(&rawRequest)
+	if err != nil {
+		return BatchTokenRequest{}, fmt.Errorf("%w: %s", ErrInvalidRequest, err)
+	}
+
+	// Every entry is authorized and signed separately: MaxScopes only bounds the work of a single entry
+	if len(rawRequest.Requests) > maxEntries {
+		return BatchTokenRequest{}, fmt.Errorf("%w: more than %d entries requested", ErrInvalidRequest, maxEntries)
+	}
+
+	request := BatchTokenRequest{
+		Service:  rawRequest.Service,
+		ClientID: rawRequest.ClientID,
+		Entries:  make([]BatchTokenRequestEntry, 0, len(rawRequest.Requests)),
+	}
+
+	for _, rawEntry := range rawRequest.Requests {
+		scopes, err := ParseScopes(rawEntry.Scopes)
+		if err != nil {
+			return BatchTokenRequest{}, err
+		}
+
+		scopes, err = checkScopes(scopes)
+		if err != nil {
+			return BatchTokenRequest{}, err
+		}
+
+		scopes, err = MergeScopes(scopes)
+		if err != nil {
+			return BatchTokenRequest{}, err
+		}
+
+		request.Entries = append(request.Entries, BatchTokenRequestEntry{
+			Scopes: scopes,
+		})
+	}
+
+	username, password, ok := r.BasicAuth()
+
+	// Some clients send empty credentials for anonymous requests
+	if username == "" && password == "" {
+		ok = false
+	}
+
+	request.Anonymous = !ok
+	request.Username = username
+	request.Password = password
+
+	return request, nil
+}
+
+type rawBatchTokenRequest struct {
+	Service  string `json:"service"`
+	ClientID string `json:"client_id"`
+	Requests []struct {
+		Scopes []string `json:"scope"`
+	} `json:"requests"`
+}
+
+// BatchTokenHandler implements BatchTokenService and records metrics about every request.
+//
+// It returns an error if the underlying TokenService does not implement BatchTokenService.
+func (s InstrumentedTokenService) BatchTokenHandler(ctx context.Context, r BatchTokenRequest) (BatchTokenResponse, error) {
+	service, ok := s.Service.(BatchTokenService)
+	if !ok {
+		return BatchTokenResponse{}, errors.New("batch token requests are not supported")
+	}
+
+	ctx, record := contextWithTokenRequestRecord(ctx)
+	start := s.Dependencies.GetClock().Now()
+
+	resp, err := service.BatchTokenHandler(ctx, r)
+
+	var requestedScopes []Scope
+
+	for _, entry := range r.Entries {
+		requestedScopes = append(requestedScopes, entry.Scopes...)
+	}
+
+	s.observe(AuditOperationBatchToken, start, err)
+	s.recordAuthentication(tokenRequestGrantType(r.AuthenticationMethod()), record)
+	s.recordAuthorization(requestedScopes, record)
+
+	return resp, err
+}
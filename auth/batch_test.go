@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenServer_BatchTokenHandler(t *testing.T) {
+	server := newTokenServerStub()
+
+	body := `{"service": "service.example.com", "client_id": "client", "requests": [{"scope": ["repository:foo:pull"]}, {"scope": ["repository:bar:pull,push"]}]}`
+
+	req := httptest.NewRequest(http.MethodPost, "/token/batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth("user", "password")
+
+	rec := httptest.NewRecorder()
+
+	server.BatchTokenHandler(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var response BatchTokenResponse
+
+	err := json.NewDecoder(rec.Body).Decode(&response)
+	require.NoError(t, err)
+
+	require.Len(t, response.Tokens, 2)
+
+	assert.Equal(t, "access:user", response.Tokens[0].Token)
+	assert.Equal(t, "repository:foo:pull", response.Tokens[0].Scope)
+	assert.Equal(t, 900, response.Tokens[0].ExpiresIn)
+
+	assert.Equal(t, "access:user", response.Tokens[1].Token)
+	assert.Equal(t, "repository:bar:pull,push", response.Tokens[1].Scope)
+	assert.Equal(t, 900, response.Tokens[1].ExpiresIn)
+}
+
+func TestTokenServer_BatchTokenHandler_AuthenticationFailed(t *testing.T) {
+	server := newTokenServerStub()
+
+	body := `{"service": "service.example.com", "requests": [{"scope": ["repository:foo:pull"]}]}`
+
+	req := httptest.NewRequest(http.MethodPost, "/token/batch", strings.NewReader(body))
+	req.SetBasicAuth("unknown", "password")
+
+	rec := httptest.NewRecorder()
+
+	server.BatchTokenHandler(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestTokenServer_BatchTokenHandler_PartialDenial(t *testing.T) {
+	service := newTokenServiceStub()
+	service.Authorizer = namespaceAuthorizerStub{}
+
+	server := newTokenServerStub()
+	server.Service = service
+
+	body := `{"service": "service.example.com", "requests": [{"scope": ["repository:user/app:pull,push"]}, {"scope": ["repository:other/app:pull"]}, {"scope": ["repository:library/app:pull,push"]}]}`
+
+	req := httptest.NewRequest(http.MethodPost, "/token/batch", strings.NewReader(body))
+	req.SetBasicAuth("user", "password")
+
+	rec := httptest.NewRecorder()
+
+	server.BatchTokenHandler(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var response BatchTokenResponse
+
+	err := json.NewDecoder(rec.Body).Decode(&response)
+	require.NoError(t, err)
+
+	require.Len(t, response.Tokens, 3)
+
+	// Denied entries still get a token (without access), so that entries stay aligned with the request
+	assert.Equal(t, "repository:user/app:pull,push", response.Tokens[0].Scope)
+	assert.Equal(t, "", response.Tokens[1].Scope)
+	assert.Equal(t, "access:user", response.Tokens[1].Token)
+	assert.Equal(t, "repository:library/app:pull", response.Tokens[2].Scope)
+}
+
+func TestTokenServer_BatchTokenHandler_InvalidRequest(t *testing.T) {
+	testCases := []struct {
+		name          string
+		body          string
+		expectedError string
+	}{
+		{
+			name:          "MalformedBody",
+			body:          `{"service": `,
+			expectedError: "invalid_request",
+		},
+		{
+			name:          "MissingService",
+			body:          `{"requests": [{"scope": ["repository:foo:pull"]}]}`,
+			expectedError: "invalid_request",
+		},
+		{
+			name:          "NoEntries",
+			body:          `{"service": "service.example.com", "requests": []}`,
+			expectedError: "invalid_request",
+		},
+		{
+			name:          "TooManyEntries",
+			body:          `{"service": "service.example.com", "requests": [{"scope": ["repository:foo:pull"]}, {"scope": ["repository:bar:pull"]}, {"scope": ["repository:baz:pull"]}]}`,
+			expectedError: "invalid_request",
+		},
+		{
+			name:          "InvalidScope",
+			body:          `{"service": "service.example.com", "requests": [{"scope": ["repository:foo:pull"]}, {"scope": ["registry:catalog:push"]}]}`,
+			expectedError: "invalid_scope",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			server := newTokenServerStub()
+			server.MaxBatchEntries = 2
+
+			req := httptest.NewRequest(http.MethodPost, "/token/batch", strings.NewReader(testCase.body))
+			req.SetBasicAuth("user", "password")
+
+			rec := httptest.NewRecorder()
+
+			server.BatchTokenHandler(rec, req)
+
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+			var response errorResponse
+
+			err := json.NewDecoder(rec.Body).Decode(&response)
+			require.NoError(t, err)
+
+			assert.Equal(t, testCase.expectedError, response.Error)
+		})
+	}
+}
+
+func TestTokenServer_BatchTokenHandler_DefaultMaxEntries(t *testing.T) {
+	server := newTokenServerStub()
+
+	entries := make([]string, 0, DefaultMaxBatchEntries+1)
+
+	for i := 0; i <= DefaultMaxBatchEntries; i++ {
+		entries = append(entries, `{"scope": ["repository:foo:pull"]}`)
+	}
+
+	body := `{"service": "service.example.com", "requests": [` + strings.Join(entries, ", ") + `]}`
+
+	req := httptest.NewRequest(http.MethodPost, "/token/batch", strings.NewReader(body))
+	req.SetBasicAuth("user", "password")
+
+	rec := httptest.NewRecorder()
+
+	server.BatchTokenHandler(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
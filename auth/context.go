@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"context"
+	"time"
+)
+
+type serviceContextKey struct{}
+
+// ContextWithService returns a copy of ctx carrying the name of the service a token is requested for.
+//
+// TokenServiceImpl stores the service in the context passed to authorizers.
+func ContextWithService(ctx context.Context, service string) context.Context {
+	return context.WithValue(ctx, serviceContextKey{}, service)
+}
+
+// ServiceFromContext returns the name of the service stored in ctx (if any).
+func ServiceFromContext(ctx context.Context) string {
+	service, _ := ctx.Value(serviceContextKey{}).(string)
+
+	return service
+}
+
+type dpopKeyThumbprintContextKey struct{}
+
+// ContextWithDPoPKeyThumbprint returns a copy of ctx carrying the JWK thumbprint of a verified DPoP proof key.
+//
+// Access token issuers should bind issued tokens to this key.
+func ContextWithDPoPKeyThumbprint(ctx context.Context, thumbprint string) context.Context {
+	return context.WithValue(ctx, dpopKeyThumbprintContextKey{}, thumbprint)
+}
+
+// DPoPKeyThumbprintFromContext returns the JWK thumbprint of a DPoP proof key stored in ctx (if any).
+func DPoPKeyThumbprintFromContext(ctx context.Context) string {
+	thumbprint, _ := ctx.Value(dpopKeyThumbprintContextKey{}).(string)
+
+	return thumbprint
+}
+
+type authenticationMethodContextKey struct{}
+
+// ContextWithAuthenticationMethod returns a copy of ctx carrying the method (eg. AuthenticationMethodPassword) a Subject authenticated with.
+//
+// TokenServiceImpl stores the authentication method in the context passed to authorizers and token issuers.
+func ContextWithAuthenticationMethod(ctx context.Context, method string) context.Context {
+	return context.WithValue(ctx, authenticationMethodContextKey{}, method)
+}
+
+// AuthenticationMethodFromContext returns the authentication method stored in ctx (if any).
+func AuthenticationMethodFromContext(ctx context.Context) string {
+	method, _ := ctx.Value(authenticationMethodContextKey{}).(string)
+
+	return method
+}
+
+type notBeforeContextKey struct{}
+
+// ContextWithNotBefore returns a copy of ctx carrying the time a scheduled access token should become valid at.
+//
+// TokenServiceImpl stores it in the context passed to token issuers after checking it against ScheduledTokens.
+func ContextWithNotBefore(ctx context.Context, notBefore time.Time) context.Context {
+	return context.WithValue(ctx, notBeforeContextKey{}, notBefore)
+}
+
+// NotBeforeFromContext returns the time a scheduled access token should become valid at (if any).
+func NotBeforeFromContext(ctx context.Context) time.Time {
+	notBefore, _ := ctx.Value(notBeforeContextKey{}).(time.Time)
+
+	return notBefore
+}
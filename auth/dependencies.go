@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"crypto/rand"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Clock provides access to the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+// IDGenerator generates a random ID.
+type IDGenerator interface {
+	GenerateID() (string, error)
+}
+
+// Dependencies collects the sources of nondeterminism (time, randomness, IDs), the logger, the metrics and the tracer provider shared by the components of a token service.
+// Passing the same Dependencies to every component allows controlling all of them from a single place (eg. in tests).
+//
+// Components fall back to sensible defaults for nil fields.
+type Dependencies struct {
+	Clock       Clock
+	Rand        io.Reader
+	IDGenerator IDGenerator
+	Logger      *slog.Logger
+	Metrics     Metrics
+
+	TracerProvider trace.TracerProvider
+}
+
+// GetClock returns the configured Clock or the system clock.
+func (d Dependencies) GetClock() Clock {
+	if d.Clock == nil {
+		return systemClock{}
+	}
+
+	return d.Clock
+}
+
+// GetRand returns the configured random source or a cryptographically secure one.
+func (d Dependencies) GetRand() io.Reader {
+	if d.Rand == nil {
+		return rand.Reader
+	}
+
+	return d.Rand
+}
+
+// GetIDGenerator returns the configured IDGenerator or one generating UUIDs (v4) from the random source.
+func (d Dependencies) GetIDGenerator() IDGenerator {
+	if d.IDGenerator == nil {
+		return uuidGenerator{uuid.NewGenWithOptions(uuid.WithRandomReader(d.GetRand()))}
+	}
+
+	return d.IDGenerator
+}
+
+// GetLogger returns the configured logger or one that discards every record.
+func (d Dependencies) GetLogger() *slog.Logger {
+	if d.Logger == nil {
+		return slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	return d.Logger
+}
+
+// GetMetrics returns the configured Metrics or one that discards every measurement.
+func (d Dependencies) GetMetrics() Metrics {
+	if d.Metrics == nil {
+		return noopMetrics{}
+	}
+
+	return d.Metrics
+}
+
+// GetTracerProvider returns the configured TracerProvider or the global one (which does not record anything unless configured).
+func (d Dependencies) GetTracerProvider() trace.TracerProvider {
+	if d.TracerProvider == nil {
+		return otel.GetTracerProvider()
+	}
+
+	return d.TracerProvider
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+type uuidGenerator struct {
+	gen *uuid.Gen
+}
+
+func (g uuidGenerator) GenerateID() (string, error) {
+	u, err := g.gen.NewV4()
+	if err != nil {
+		return "", err
+	}
+
+	return u.String(), nil
+}
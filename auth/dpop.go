@@ -0,0 +1,25 @@
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrInvalidDPoPProof is returned when a DPoP proof is missing or invalid.
+var ErrInvalidDPoPProof = errors.New("invalid DPoP proof")
+
+// DPoPHeader is the HTTP header carrying a DPoP proof as defined in [RFC 9449].
+//
+// [RFC 9449]: https://datatracker.ietf.org/doc/html/rfc9449
+const DPoPHeader = "DPoP"
+
+// TokenTypeDPoP is the token type of access tokens bound to a DPoP key.
+const TokenTypeDPoP = "DPoP"
+
+// DPoPProofVerifier verifies a DPoP proof presented for an HTTP request
+// and returns the JWK thumbprint of the key the proof was signed with.
+//
+// It returns an ErrInvalidDPoPProof error in case the proof is invalid.
+type DPoPProofVerifier interface {
+	VerifyDPoPProof(ctx context.Context, proof string, method string, uri string) (string, error)
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"html/template"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var errorPageTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{ .Status }} {{ .StatusText }}</title>
+</head>
+<body>
+<h1>{{ .Status }} {{ .StatusText }}</h1>
+{{- if .Description }}
+<p>{{ .Description }}</p>
+{{- end }}
+<p>This endpoint is meant to be used by container clients (eg. docker login), not browsers.</p>
+{{- if .RequestID }}
+<p>Request ID: <code>{{ .RequestID }}</code></p>
+{{- end }}
+{{- if .HelpURL }}
+<p><a href="{{ .HelpURL }}">Get help</a></p>
+{{- end }}
+</body>
+</html>
+`))
+
+type errorPage struct {
+	Status      int
+	StatusText  string
+	Description string
+	RequestID   string
+	HelpURL     string
+}
+
+func (s TokenServer) writeErrorPage(w http.ResponseWriter, r *http.Request, status int, response *errorResponse) {
+	page := errorPage{
+		Status:     status,
+		StatusText: statusText(status),
+		RequestID:  RequestIDFromContext(r.Context()),
+		HelpURL:    s.HelpURL,
+	}
+
+	if response != nil {
+		page.Description = response.ErrorDescription
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = errorPageTemplate.Execute(w, page)
+}
+
+// acceptsHTML reports whether the client explicitly asked for an HTML response.
+//
+// Wildcards (eg. */*) are ignored: API clients often send them and expect JSON.
+func acceptsHTML(r *http.Request) bool {
+	for _, value := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(value, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+			if err != nil {
+				continue
+			}
+
+			if mediaType != "text/html" {
+				continue
+			}
+
+			if q, ok := params["q"]; ok {
+				if weight, err := strconv.ParseFloat(q, 64); err != nil || weight == 0 {
+					continue
+				}
+			}
+
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,90 @@
+package fakes_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+	"github.com/sagikazarmark/registry-auth/auth/authn"
+	"github.com/sagikazarmark/registry-auth/auth/authz"
+	"github.com/sagikazarmark/registry-auth/auth/fakes"
+)
+
+func newTokenService() auth.TokenServiceImpl {
+	passwordHash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+
+	userAuthenticator := authn.NewUserAuthenticator([]authn.User{
+		{
+			Enabled:      true,
+			Username:     "user",
+			PasswordHash: string(passwordHash),
+		},
+	})
+
+	tokenIssuer := fakes.FakeTokenIssuer{
+		Expiration: 5 * time.Minute,
+		IssuedAt:   time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC),
+	}
+
+	return auth.TokenServiceImpl{
+		Authenticator: auth.Authenticator{
+			PasswordAuthenticator: userAuthenticator,
+		},
+		Authorizer: authz.NewDefaultAuthorizer(authz.NewDefaultRepositoryAuthorizer(false), false),
+		TokenIssuer: auth.TokenIssuer{
+			AccessTokenIssuer:  tokenIssuer,
+			RefreshTokenIssuer: tokenIssuer,
+		},
+	}
+}
+
+func ExampleFakeTokenIssuer() {
+	service := newTokenService()
+
+	scopes, _ := auth.ParseScopes([]string{"repository:user/app:pull,push", "repository:other/app:pull"})
+
+	response, err := service.TokenHandler(context.Background(), auth.TokenRequest{
+		Service:  "registry.example.com",
+		Offline:  true,
+		Scopes:   scopes,
+		Username: "user",
+		Password: "password",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(response.Token)
+	fmt.Println(response.RefreshToken)
+	fmt.Println(response.ExpiresIn)
+
+	// Output:
+	// access_token service=registry.example.com sub=user access=repository:user/app:pull,push
+	// refresh_token service=registry.example.com sub=user
+	// 300
+}
+
+func ExampleFakeTokenIssuer_oAuth2() {
+	service := newTokenService()
+
+	response, err := service.OAuth2Handler(context.Background(), auth.OAuth2Request{
+		GrantType: auth.GrantTypePassword,
+		Service:   "registry.example.com",
+		ClientID:  "client",
+		Username:  "user",
+		Password:  "password",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(response.Token)
+	fmt.Println(response.IssuedAt)
+
+	// Output:
+	// access_token service=registry.example.com sub=user access=
+	// 2009-11-10T23:00:00Z
+}
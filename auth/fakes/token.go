@@ -0,0 +1,57 @@
+// Package fakes provides fake implementations of the auth interfaces for testing purposes.
+package fakes
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+// FakeTokenIssuer issues predictable, non-cryptographic tokens encoding the service, the subject and the granted access.
+//
+// Access tokens look like this:
+//
+//	access_token service=<service> sub=<subject ID> access=<granted scopes>
+//
+// Refresh tokens look like this:
+//
+//	refresh_token service=<service> sub=<subject ID>
+//
+// The subject ID is empty for anonymous subjects.
+//
+// FakeTokenIssuer implements both auth.AccessTokenIssuer and auth.RefreshTokenIssuer.
+type FakeTokenIssuer struct {
+	// Expiration is reported as the lifetime of issued tokens.
+	Expiration time.Duration
+
+	// IssuedAt is reported as the issuance time of issued tokens.
+	IssuedAt time.Time
+}
+
+// IssueAccessToken implements auth.AccessTokenIssuer.
+func (i FakeTokenIssuer) IssueAccessToken(_ context.Context, service string, subject auth.Subject, grantedScopes []auth.Scope) (auth.AccessToken, error) {
+	return auth.AccessToken{
+		Payload:   fmt.Sprintf("access_token service=%s sub=%s access=%s", service, subjectID(subject), auth.Scopes(grantedScopes)),
+		ExpiresIn: i.Expiration,
+		IssuedAt:  i.IssuedAt,
+	}, nil
+}
+
+// IssueRefreshToken implements auth.RefreshTokenIssuer.
+func (i FakeTokenIssuer) IssueRefreshToken(_ context.Context, service string, subject auth.Subject) (auth.RefreshToken, error) {
+	return auth.RefreshToken{
+		Payload:   fmt.Sprintf("refresh_token service=%s sub=%s", service, subjectID(subject)),
+		ExpiresIn: i.Expiration,
+		IssuedAt:  i.IssuedAt,
+	}, nil
+}
+
+func subjectID(subject auth.Subject) auth.SubjectID {
+	if subject == nil {
+		return ""
+	}
+
+	return subject.ID()
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Checker reports whether a component (eg. a database or directory backing an authenticator) is able to serve requests.
+//
+// Components implement it optionally. Check should be quick (eg. a ping) and respect ctx.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc is an adapter allowing the use of ordinary functions as a Checker.
+type CheckerFunc func(ctx context.Context) error
+
+// Check implements Checker.
+func (fn CheckerFunc) Check(ctx context.Context) error {
+	return fn(ctx)
+}
+
+// readinessCheckTimeout limits the time ReadyHandler waits for all checks.
+const readinessCheckTimeout = 5 * time.Second
+
+// healthResponse is the body of health and readiness responses.
+type healthResponse struct {
+	Status string `json:"status"`
+
+	// Checks lists the errors of failed checks by component name.
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// HealthHandler is a liveness probe: it responds with 200 OK as long as the server is able to handle requests.
+func (s TokenServer) HealthHandler(w http.ResponseWriter, _ *http.Request) {
+	writeHealthResponse(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+// ReadyHandler is a readiness probe: it responds with 200 OK if every check in ReadinessCheckers passes
+// and with 503 Service Unavailable listing the failed checks otherwise.
+func (s TokenServer) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessCheckTimeout)
+	defer cancel()
+
+	names := make([]string, 0, len(s.ReadinessCheckers))
+	for name := range s.ReadinessCheckers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	failed := make(map[string]string)
+
+	for _, name := range names {
+		if err := s.ReadinessCheckers[name].Check(ctx); err != nil {
+			failed[name] = err.Error()
+		}
+	}
+
+	if len(failed) > 0 {
+		writeHealthResponse(w, http.StatusServiceUnavailable, healthResponse{
+			Status: "unavailable",
+			Checks: failed,
+		})
+
+		return
+	}
+
+	writeHealthResponse(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+func writeHealthResponse(w http.ResponseWriter, status int, response healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenServer_HealthHandler(t *testing.T) {
+	server := TokenServer{
+		ReadinessCheckers: map[string]Checker{
+			"ldap": CheckerFunc(func(_ context.Context) error {
+				return errors.New("connection refused")
+			}),
+		},
+	}
+
+	w := httptest.NewRecorder()
+
+	server.HealthHandler(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	// Liveness does not depend on backends
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status": "ok"}`, w.Body.String())
+}
+
+func TestTokenServer_ReadyHandler(t *testing.T) {
+	ok := CheckerFunc(func(_ context.Context) error {
+		return nil
+	})
+
+	t.Run("Ready", func(t *testing.T) {
+		server := TokenServer{
+			ReadinessCheckers: map[string]Checker{
+				"sql": ok,
+			},
+		}
+
+		w := httptest.NewRecorder()
+
+		server.ReadyHandler(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"status": "ok"}`, w.Body.String())
+	})
+
+	t.Run("NotReady", func(t *testing.T) {
+		server := TokenServer{
+			ReadinessCheckers: map[string]Checker{
+				"sql": ok,
+				"ldap": CheckerFunc(func(_ context.Context) error {
+					return errors.New("connection refused")
+				}),
+			},
+		}
+
+		w := httptest.NewRecorder()
+
+		server.ReadyHandler(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.JSONEq(t, `{"status": "unavailable", "checks": {"ldap": "connection refused"}}`, w.Body.String())
+	})
+}
@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Token types reported in metrics.
+const (
+	MetricTokenTypeAccess  = "access_token"
+	MetricTokenTypeRefresh = "refresh_token"
+)
+
+// Metrics records operational metrics of a token service.
+type Metrics interface {
+	// IncIssuerFailures counts token issuance failures caused by a token issuer (eg. an unavailable HSM).
+	IncIssuerFailures(tokenType string)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) IncIssuerFailures(string) {}
+
+// Metric label values.
+const (
+	metricResultSuccess = "success"
+	metricResultFailure = "failure"
+
+	metricDecisionAllow = "allow"
+	metricDecisionDeny  = "deny"
+
+	metricRefreshTokenIssued = "issued"
+	metricRefreshTokenUsed   = "used"
+
+	metricOperationPermissions = "permissions"
+
+	// metricActionOther replaces actions outside the known vocabulary,
+	// so that clients cannot create an unbounded number of time series.
+	metricActionOther = "other"
+)
+
+// metricActions lists the actions reported as they are.
+var metricActions = []string{"pull", "push", "delete", "*"}
+
+// PrometheusMetrics records the metrics of a token service in Prometheus.
+//
+// It implements Metrics, so it can be passed to TokenServiceImpl in Dependencies,
+// and it collects the metrics recorded by InstrumentedTokenService.
+type PrometheusMetrics struct {
+	authentications *prometheus.CounterVec
+	authorizations  *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	refreshTokens   *prometheus.CounterVec
+	issuerFailures  *prometheus.CounterVec
+}
+
+// NewPrometheusMetrics returns a new PrometheusMetrics and registers its collectors in registerer.
+//
+// Metric names are prefixed with namespace and subsystem (either of them may be empty).
+func NewPrometheusMetrics(namespace string, subsystem string, registerer prometheus.Registerer) (*PrometheusMetrics, error) {
+	m := &PrometheusMetrics{
+		authentications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "authentications_total",
+			Help:      "Number of authentication attempts by grant type and result.",
+		}, []string{"grant_type", "result"}),
+		authorizations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "authorizations_total",
+			Help:      "Number of requested actions allowed or denied by action and decision.",
+		}, []string{"action", "decision"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "request_duration_seconds",
+			Help:      "Time it takes to process token requests by operation and result.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation", "result"}),
+		refreshTokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "refresh_tokens_total",
+			Help:      "Number of refresh tokens issued or used.",
+		}, []string{"event"}),
+		issuerFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "issuer_failures_total",
+			Help:      "Number of token issuance failures caused by a token issuer by token type.",
+		}, []string{"token_type"}),
+	}
+
+	for _, collector := range []prometheus.Collector{
+		m.authentications,
+		m.authorizations,
+		m.requestDuration,
+		m.refreshTokens,
+		m.issuerFailures,
+	} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// IncIssuerFailures implements Metrics.
+func (m *PrometheusMetrics) IncIssuerFailures(tokenType string) {
+	m.issuerFailures.WithLabelValues(tokenType).Inc()
+}
+
+// InstrumentedTokenService acts as a middleware for a TokenService and records metrics about every request.
+type InstrumentedTokenService struct {
+	Service TokenService
+	Metrics *PrometheusMetrics
+
+	Dependencies Dependencies
+}
+
+// TokenHandler implements TokenService and records metrics about every request.
+func (s InstrumentedTokenService) TokenHandler(ctx context.Context, r TokenRequest) (TokenResponse, error) {
+	ctx, record := contextWithTokenRequestRecord(ctx)
+	start := s.Dependencies.GetClock().Now()
+
+	resp, err := s.Service.TokenHandler(ctx, r)
+
+	s.observe(AuditOperationToken, start, err)
+	s.recordAuthentication(tokenRequestGrantType(r.AuthenticationMethod()), record)
+	s.recordAuthorization(r.Scopes, record)
+
+	if resp.RefreshToken != "" {
+		s.Metrics.refreshTokens.WithLabelValues(metricRefreshTokenIssued).Inc()
+	}
+
+	return resp, err
+}
+
+// OAuth2Handler implements TokenService and records metrics about every request.
+func (s InstrumentedTokenService) OAuth2Handler(ctx context.Context, r OAuth2Request) (OAuth2Response, error) {
+	ctx, record := contextWithTokenRequestRecord(ctx)
+	start := s.Dependencies.GetClock().Now()
+
+	resp, err := s.Service.OAuth2Handler(ctx, r)
+
+	s.observe(AuditOperationOAuth2, start, err)
+	s.recordAuthentication(r.GrantType, record)
+	s.recordAuthorization(r.Scopes, record)
+
+	if r.GrantType == GrantTypeRefreshToken && record.subject != nil {
+		s.Metrics.refreshTokens.WithLabelValues(metricRefreshTokenUsed).Inc()
+	}
+
+	// Otherwise the refresh token presented in a refresh_token grant is returned unchanged
+	if r.AccessType == AccessTypeOffline && resp.RefreshToken != "" {
+		s.Metrics.refreshTokens.WithLabelValues(metricRefreshTokenIssued).Inc()
+	}
+
+	return resp, err
+}
+
+func (s InstrumentedTokenService) observe(operation string, start time.Time, err error) {
+	result := metricResultSuccess
+	if err != nil {
+		result = metricResultFailure
+	}
+
+	s.Metrics.requestDuration.WithLabelValues(operation, result).Observe(s.Dependencies.GetClock().Now().Sub(start).Seconds())
+}
+
+// recordAuthentication counts the outcome of authentication.
+// Requests rejected before authentication (eg. invalid requests) and anonymous requests are not counted.
+func (s InstrumentedTokenService) recordAuthentication(grantType string, record *tokenRequestRecord) {
+	switch {
+	case grantType == "":
+		return
+
+	case record.authenticationErr != nil:
+		// Canceled requests say nothing about the credentials
+		if errors.Is(record.authenticationErr, context.Canceled) {
+			return
+		}
+
+		s.Metrics.authentications.WithLabelValues(grantType, metricResultFailure).Inc()
+
+	case record.subject != nil:
+		s.Metrics.authentications.WithLabelValues(grantType, metricResultSuccess).Inc()
+	}
+}
+
+// recordAuthorization counts the decision about every requested action.
+// Requests failing before authorization are not counted.
+func (s InstrumentedTokenService) recordAuthorization(requestedScopes []Scope, record *tokenRequestRecord) {
+	if !record.authorized {
+		return
+	}
+
+	for _, scope := range requestedScopes {
+		for _, action := range scope.Actions {
+			decision := metricDecisionDeny
+
+			if isActionGranted(scope.Resource, action, record.grantedScopes) {
+				decision = metricDecisionAllow
+			}
+
+			s.Metrics.authorizations.WithLabelValues(metricActionLabel(action), decision).Inc()
+		}
+	}
+}
+
+func isActionGranted(resource Resource, action string, grantedScopes []Scope) bool {
+	for _, scope := range grantedScopes {
+		if scope.Resource == resource && slices.Contains(scope.Actions, action) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// metricActionLabel returns the label value of an action.
+func metricActionLabel(action string) string {
+	if !slices.Contains(metricActions, action) {
+		return metricActionOther
+	}
+
+	return action
+}
+
+// tokenRequestGrantType returns the OAuth2 grant type equivalent to the authentication method of a token request,
+// so that both endpoints report the same labels.
+func tokenRequestGrantType(authenticationMethod string) string {
+	switch authenticationMethod {
+	case AuthenticationMethodPassword:
+		return GrantTypePassword
+
+	case AuthenticationMethodBearerToken:
+		return GrantTypeJWTBearer
+	}
+
+	return authenticationMethod
+}
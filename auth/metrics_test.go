@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstrumentedTokenService(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	metrics, err := NewPrometheusMetrics("registry_auth", "test", registry)
+	require.NoError(t, err)
+
+	tokenService := newTokenServiceStub()
+	tokenService.Authorizer = namespaceAuthorizerStub{}
+	tokenService.Dependencies.Metrics = metrics
+
+	service := InstrumentedTokenService{
+		Service: tokenService,
+		Metrics: metrics,
+	}
+
+	scopes, err := ParseScopes([]string{"repository:library/app:pull,push", "custom:library/app:x-random-1,x-random-2"})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	_, err = service.TokenHandler(ctx, TokenRequest{
+		Service:  "service.example.com",
+		ClientID: "client",
+		Offline:  true,
+		Scopes:   scopes,
+		Username: "user",
+		Password: "password",
+	})
+	require.NoError(t, err)
+
+	_, err = service.TokenHandler(ctx, TokenRequest{
+		Service:  "service.example.com",
+		ClientID: "client",
+		Scopes:   scopes,
+		Username: "unknown",
+		Password: "password",
+	})
+	require.Error(t, err)
+
+	_, err = service.OAuth2Handler(ctx, OAuth2Request{
+		GrantType:    GrantTypeRefreshToken,
+		Service:      "service.example.com",
+		ClientID:     "client",
+		AccessType:   AccessTypeOffline,
+		RefreshToken: "refresh:user",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.authentications.WithLabelValues(GrantTypePassword, "success")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.authentications.WithLabelValues(GrantTypePassword, "failure")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.authentications.WithLabelValues(GrantTypeRefreshToken, "success")))
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.authorizations.WithLabelValues("pull", "allow")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.authorizations.WithLabelValues("push", "deny")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.authorizations.WithLabelValues("other", "deny")))
+	assert.Equal(t, 3, testutil.CollectAndCount(registry, "registry_auth_test_authorizations_total"))
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.refreshTokens.WithLabelValues("issued")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.refreshTokens.WithLabelValues("used")))
+
+	assert.Equal(t, 3, testutil.CollectAndCount(registry, "registry_auth_test_request_duration_seconds"))
+}
@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/gofrs/uuid"
+)
+
+// RequestIDHeader is the HTTP header carrying the ID of a request.
+const RequestIDHeader = "X-Request-Id"
+
+type requestIDContextKey struct{}
+
+// ContextWithRequestID returns a copy of ctx carrying a request ID.
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID stored in ctx (if any).
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey{}).(string)
+
+	return requestID
+}
+
+// maxRequestIDLength is the maximum length of request IDs accepted from clients.
+const maxRequestIDLength = 128
+
+// validRequestID reports whether a request ID received from a client is safe to log and echo in response headers:
+// it must be at most maxRequestIDLength characters of [A-Za-z0-9._-].
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range []byte(requestID) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// RequestIDMiddleware assigns an ID to every request.
+//
+// It reuses the ID received in the X-Request-Id header or generates a new one if there is none.
+// Received IDs longer than 128 characters or containing characters other than [A-Za-z0-9._-] are replaced
+// (so that clients cannot inject content into logs).
+// The ID is stored in the request context and returned in the response headers.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+
+		if !validRequestID(requestID) {
+			requestID = ""
+
+			id, err := uuid.NewV4()
+			if err == nil {
+				requestID = id.String()
+			}
+		}
+
+		w.Header().Set(RequestIDHeader, requestID)
+
+		next.ServeHTTP(w, r.WithContext(ContextWithRequestID(r.Context(), requestID)))
+	})
+}
+
+// RecoveryMiddleware recovers from panics occurring in downstream handlers.
+//
+// It logs the panic along with the request ID and responds with a 500 Internal Server Error.
+func RecoveryMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+
+				// Let net/http abort the response
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+
+				logger.Error(
+					"recovered from panic",
+					slog.String("request_id", RequestIDFromContext(r.Context())),
+					slog.String("panic", fmt.Sprint(v)),
+					slog.String("stack", string(debug.Stack())),
+				)
+
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequestLimits restricts the size of incoming requests.
+//
+// Zero values mean no limit.
+type RequestLimits struct {
+	// MaxURLLength is the maximum length of the request URL (including the query string).
+	// Requests with longer URLs are rejected with 414 Request-URI Too Long.
+	MaxURLLength int
+
+	// MaxBodySize is the maximum size of the request body in bytes.
+	// Reading beyond this limit fails, resulting in a 400 Bad Request response.
+	MaxBodySize int64
+}
+
+// UserAgentFilter restricts the clients (identified by their User-Agent header) allowed to request tokens.
+//
+// Patterns match case-insensitive substrings of the User-Agent header (eg. "docker/" or "python-requests").
+// The zero value lets every request through.
+type UserAgentFilter struct {
+	// Allow lists the accepted user agents. If empty, every user agent not denied is accepted.
+	Allow []string
+
+	// Deny lists the rejected user agents. Deny takes precedence over Allow.
+	Deny []string
+
+	// RequireUserAgent rejects requests without a User-Agent header.
+	RequireUserAgent bool
+}
+
+// Allowed reports whether a request with the given User-Agent header passes the filter.
+func (f UserAgentFilter) Allowed(userAgent string) bool {
+	if userAgent == "" {
+		return !f.RequireUserAgent && len(f.Allow) == 0
+	}
+
+	userAgent = strings.ToLower(userAgent)
+
+	matches := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			if strings.Contains(userAgent, strings.ToLower(pattern)) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if matches(f.Deny) {
+		return false
+	}
+
+	return len(f.Allow) == 0 || matches(f.Allow)
+}
+
+// UserAgentMiddleware rejects requests from user agents not passing filter with 403 Forbidden.
+func UserAgentMiddleware(filter UserAgentFilter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !filter.Allowed(r.UserAgent()) {
+				writeErrorResponse(w, http.StatusForbidden, errorResponse{
+					Error:            "access_denied",
+					ErrorDescription: "user agent is not allowed",
+				})
+
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequestLimitsMiddleware rejects requests exceeding limits before they are parsed.
+func RequestLimitsMiddleware(limits RequestLimits) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if limits.MaxURLLength > 0 && len(r.URL.RequestURI()) > limits.MaxURLLength {
+				writeErrorResponse(w, http.StatusRequestURITooLong, errorResponse{
+					Error:            "invalid_request",
+					ErrorDescription: fmt.Sprintf("request URL exceeds the maximum length of %d characters", limits.MaxURLLength),
+				})
+
+				return
+			}
+
+			if limits.MaxBodySize > 0 && r.Body != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, limits.MaxBodySize)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
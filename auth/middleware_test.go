@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type panickingPasswordAuthenticator struct{}
+
+func (panickingPasswordAuthenticator) AuthenticatePassword(_ context.Context, username string, _ string) (Subject, error) {
+	if username == "panic" {
+		panic("authenticator blew up")
+	}
+
+	return subjectStub{id: SubjectID(username)}, nil
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+
+	service := newTokenServiceStub()
+	service.Authenticator.PasswordAuthenticator = panickingPasswordAuthenticator{}
+
+	tokenServer := TokenServer{
+		Service: service,
+		Logger:  logger,
+	}
+
+	server := httptest.NewServer(RequestIDMiddleware(RecoveryMiddleware(logger)(http.HandlerFunc(tokenServer.TokenHandler))))
+	defer server.Close()
+
+	query := url.Values{
+		"service": {"service.example.com"},
+	}
+
+	doRequest := func(username string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/token?"+query.Encode(), nil)
+		require.NoError(t, err)
+
+		req.Header.Set(RequestIDHeader, "request-"+username)
+		req.SetBasicAuth(username, "password")
+
+		resp, err := server.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		return resp
+	}
+
+	resp := doRequest("panic")
+
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, "request-panic", resp.Header.Get(RequestIDHeader))
+	assert.Contains(t, logs.String(), "authenticator blew up")
+	assert.Contains(t, logs.String(), "request_id=request-panic")
+
+	// The server should keep serving requests
+	resp = doRequest("user")
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	testCases := []struct {
+		name      string
+		requestID string
+		reused    bool
+	}{
+		{
+			name:      "Valid",
+			requestID: "Request-1.2_3",
+			reused:    true,
+		},
+		{
+			name:      "MaxLength",
+			requestID: strings.Repeat("a", 128),
+			reused:    true,
+		},
+		{
+			name:      "Missing",
+			requestID: "",
+		},
+		{
+			name:      "TooLong",
+			requestID: strings.Repeat("a", 129),
+		},
+		{
+			name:      "LogInjection",
+			requestID: "id\nlevel=ERROR msg=injected",
+		},
+		{
+			name:      "InvalidCharacter",
+			requestID: "id/1",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			var contextRequestID string
+
+			handler := RequestIDMiddleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				contextRequestID = RequestIDFromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/token", nil)
+			req.Header[RequestIDHeader] = []string{testCase.requestID}
+
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			requestID := rec.Header().Get(RequestIDHeader)
+
+			assert.Equal(t, requestID, contextRequestID)
+
+			if testCase.reused {
+				assert.Equal(t, testCase.requestID, requestID)
+			} else {
+				assert.NotEqual(t, testCase.requestID, requestID)
+				assert.Len(t, requestID, 36, "a UUID should be generated")
+			}
+		})
+	}
+}
+
+func TestRequestLimitsMiddleware(t *testing.T) {
+	tokenServer := newTokenServerStub()
+
+	handler := RequestLimitsMiddleware(RequestLimits{MaxURLLength: 256})(http.HandlerFunc(tokenServer.TokenHandler))
+
+	doRequest := func(scopes []string) *httptest.ResponseRecorder {
+		query := url.Values{
+			"service": {"service.example.com"},
+			"scope":   scopes,
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/token?"+query.Encode(), nil)
+		req.SetBasicAuth("user", "password")
+
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		rec := doRequest([]string{"repository:user/repository:pull"})
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("URLTooLong", func(t *testing.T) {
+		scopes := make([]string, 0, 20)
+
+		for i := 0; i < 20; i++ {
+			scopes = append(scopes, fmt.Sprintf("repository:user/repository-%d:pull", i))
+		}
+
+		rec := doRequest(scopes)
+
+		assert.Equal(t, http.StatusRequestURITooLong, rec.Code)
+		assert.Contains(t, rec.Body.String(), "request URL exceeds the maximum length of 256 characters")
+	})
+}
+
+func TestRequestLimitsMiddleware_BodyTooLarge(t *testing.T) {
+	tokenServer := newTokenServerStub()
+
+	handler := RequestLimitsMiddleware(RequestLimits{MaxBodySize: 64})(http.HandlerFunc(tokenServer.OAuth2Handler))
+
+	form := url.Values{
+		"grant_type": {GrantTypePassword},
+		"service":    {"service.example.com"},
+		"client_id":  {"client"},
+		"username":   {"user"},
+		"password":   {"password"},
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid_request")
+}
+
+func TestUserAgentMiddleware(t *testing.T) {
+	handler := UserAgentMiddleware(UserAgentFilter{
+		Allow:            []string{"docker/", "containerd/"},
+		Deny:             []string{"docker/0."},
+		RequireUserAgent: true,
+	})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	testCases := []struct {
+		userAgent string
+		status    int
+	}{
+		{"docker/24.0.5 go/go1.20.6 git-commit/a61e2b4", http.StatusOK},
+		{"Containerd/1.7.2", http.StatusOK},
+		{"python-requests/2.31.0", http.StatusForbidden},
+		{"docker/0.9.1", http.StatusForbidden},
+		{"", http.StatusForbidden},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.userAgent, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/token", nil)
+			r.Header.Set("User-Agent", testCase.userAgent)
+
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, testCase.status, w.Code)
+
+			if testCase.status == http.StatusForbidden {
+				assert.JSONEq(t, `{"error": "access_denied", "error_description": "user agent is not allowed"}`, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestUserAgentFilter_ZeroValue(t *testing.T) {
+	assert.True(t, UserAgentFilter{}.Allowed(""))
+	assert.True(t, UserAgentFilter{}.Allowed("curl/8.0.1"))
+	assert.False(t, UserAgentFilter{Deny: []string{"curl"}}.Allowed("curl/8.0.1"))
+	assert.True(t, UserAgentFilter{Deny: []string{"curl"}}.Allowed(""))
+}
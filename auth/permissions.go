@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// SubjectPlaceholder is replaced with the name of the subject (see GetSubjectName) in the resource names of a PermissionsRequest.
+const SubjectPlaceholder = "{subject}"
+
+// PermissionsService lists the effective permissions of a subject.
+//
+// It is an optional extension of TokenService.
+type PermissionsService interface {
+	PermissionsHandler(ctx context.Context, r PermissionsRequest) (PermissionsResponse, error)
+}
+
+// PermissionsRequest asks which of the listed scopes would be granted to the subject.
+//
+// Authorizers cannot enumerate the resources they grant access to (eg. every repository under a namespace),
+// so the candidate scopes have to be listed explicitly.
+// Resource names may contain SubjectPlaceholder to refer to resources belonging to the subject (eg. a personal namespace).
+type PermissionsRequest struct {
+	Service string
+	Scopes  Scopes
+
+	Username string
+	Password string
+}
+
+func (r PermissionsRequest) Validate() error {
+	if r.Service == "" {
+		return errors.New("service is required")
+	}
+
+	return nil
+}
+
+// PermissionsResponse lists the scopes granted to the subject.
+type PermissionsResponse struct {
+	Permissions Scopes `json:"permissions"`
+
+	// Reasons explain the authorization decisions (if the authorizer records any, see RecordAuthorizationReason).
+	Reasons []AuthorizationReason `json:"reasons,omitempty"`
+}
+
+// PermissionsHandler implements PermissionsService.
+func (s TokenServiceImpl) PermissionsHandler(ctx context.Context, r PermissionsRequest) (PermissionsResponse, error) {
+	if err := r.Validate(); err != nil {
+		return PermissionsResponse{}, err
+	}
+
+	subject, err := s.Authenticator.AuthenticatePassword(ctx, r.Username, r.Password)
+	if err != nil {
+		recordAuthenticationError(ctx, err)
+
+		return PermissionsResponse{}, err
+	}
+
+	ctx, record := contextWithTokenRequestRecord(ctx)
+
+	ctx = withAuthenticationMethod(ctx, AuthenticationMethodPassword)
+	recordSubject(ctx, subject)
+
+	name := GetSubjectName(subject)
+
+	requestedScopes := make([]Scope, 0, len(r.Scopes))
+
+	for _, scope := range r.Scopes {
+		scope.Name = strings.ReplaceAll(scope.Name, SubjectPlaceholder, name)
+
+		requestedScopes = append(requestedScopes, scope)
+	}
+
+	grantedScopes, err := s.Authorizer.Authorize(ContextWithService(ctx, r.Service), subject, requestedScopes)
+	if err != nil {
+		return PermissionsResponse{}, err
+	}
+
+	recordGrantedScopes(ctx, grantedScopes)
+
+	if grantedScopes == nil {
+		grantedScopes = []Scope{}
+	}
+
+	return PermissionsResponse{
+		Permissions: grantedScopes,
+		Reasons:     record.reasons,
+	}, nil
+}
+
+// PermissionsHandler implements PermissionsService and logs every request.
+//
+// It returns an error if the underlying TokenService does not implement PermissionsService.
+func (s LoggerTokenService) PermissionsHandler(ctx context.Context, r PermissionsRequest) (PermissionsResponse, error) {
+	service, ok := s.Service.(PermissionsService)
+	if !ok {
+		return PermissionsResponse{}, errors.New("permission requests are not supported")
+	}
+
+	ctx, record := contextWithTokenRequestRecord(ctx)
+
+	resp, err := service.PermissionsHandler(ctx, r)
+
+	logger := s.Logger.With(
+		slog.String("request_id", RequestIDFromContext(ctx)),
+		slog.String("service", r.Service),
+		s.subjectAttr(record),
+	).With(s.usernameAttrs(r.Username)...)
+
+	if err != nil && !errors.Is(err, ErrAuthenticationFailed) {
+		logger.Error("listing permissions failed", failureAttrs(record, err, r.Password)...)
+	} else if err != nil {
+		logger.Info("listing permissions failed due to client error", failureAttrs(record, err, r.Password)...)
+	} else {
+		logger.Info("permissions listed")
+	}
+
+	return resp, err
+}
+
+// PermissionsHandler implements PermissionsService.
+//
+// Listing permissions does not grant access to anything, so no audit event is recorded.
+// It returns an error if the underlying TokenService does not implement PermissionsService.
+func (s AuditTokenService) PermissionsHandler(ctx context.Context, r PermissionsRequest) (PermissionsResponse, error) {
+	service, ok := s.Service.(PermissionsService)
+	if !ok {
+		return PermissionsResponse{}, errors.New("permission requests are not supported")
+	}
+
+	return service.PermissionsHandler(ctx, r)
+}
+
+// PermissionsHandler lists the effective permissions of the subject authenticated using basic auth.
+//
+// Candidate scopes are taken from PermissionScopes.
+// The Service must implement PermissionsService.
+func (s TokenServer) PermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	service, ok := s.Service.(PermissionsService)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	username, password, ok := r.BasicAuth()
+	if !ok || username == "" {
+		s.handleError(ErrAuthenticationFailed, w, r)
+		return
+	}
+
+	if s.RejectEmptyPassword && password == "" {
+		s.handleError(ErrAuthenticationFailed, w, r)
+		return
+	}
+
+	request := PermissionsRequest{
+		Service:  s.service(r.URL.Query().Get("service")),
+		Scopes:   s.PermissionScopes,
+		Username: username,
+		Password: password,
+	}
+
+	response, err := service.PermissionsHandler(r.Context(), request)
+	if err != nil {
+		s.handleError(err, w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// PermissionsHandler implements PermissionsService and records the duration of every request.
+//
+// Permissions are only listed, so no authentication or authorization outcome is recorded.
+// It returns an error if the underlying TokenService does not implement PermissionsService.
+func (s InstrumentedTokenService) PermissionsHandler(ctx context.Context, r PermissionsRequest) (PermissionsResponse, error) {
+	service, ok := s.Service.(PermissionsService)
+	if !ok {
+		return PermissionsResponse{}, errors.New("permission requests are not supported")
+	}
+
+	start := s.Dependencies.GetClock().Now()
+
+	resp, err := service.PermissionsHandler(ctx, r)
+
+	s.observe(metricOperationPermissions, start, err)
+
+	return resp, err
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// namespaceAuthorizerStub grants full access to the subject's namespace and pull access to the library namespace.
+type namespaceAuthorizerStub struct{}
+
+func (namespaceAuthorizerStub) Authorize(_ context.Context, subject Subject, requestedScopes []Scope) ([]Scope, error) {
+	var grantedScopes []Scope
+
+	for _, scope := range requestedScopes {
+		switch {
+		case strings.HasPrefix(scope.Name, GetSubjectName(subject)+"/"):
+			grantedScopes = append(grantedScopes, scope)
+
+		case strings.HasPrefix(scope.Name, "library/"):
+			scope.Actions = []string{"pull"}
+			grantedScopes = append(grantedScopes, scope)
+		}
+	}
+
+	return grantedScopes, nil
+}
+
+func TestTokenServer_PermissionsHandler(t *testing.T) {
+	service := newTokenServiceStub()
+	service.Authorizer = namespaceAuthorizerStub{}
+
+	scopes, err := ParseScopes([]string{
+		"repository:{subject}/app:pull,push",
+		"repository:library/alpine:pull,push",
+		"repository:other/app:pull,push",
+	})
+	require.NoError(t, err)
+
+	server := newTokenServerStub()
+	server.Service = service
+	server.PermissionScopes = scopes
+
+	t.Run("OK", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/permissions?service=service.example.com", nil)
+		req.SetBasicAuth("user", "password")
+
+		rec := httptest.NewRecorder()
+
+		server.PermissionsHandler(rec, req)
+
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var response PermissionsResponse
+
+		err := json.NewDecoder(rec.Body).Decode(&response)
+		require.NoError(t, err)
+
+		assert.Equal(t, "repository:user/app:pull,push repository:library/alpine:pull", response.Permissions.String())
+	})
+
+	t.Run("Anonymous", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/permissions?service=service.example.com", nil)
+
+		rec := httptest.NewRecorder()
+
+		server.PermissionsHandler(rec, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
@@ -0,0 +1,262 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned when a client exceeds a rate limit.
+//
+// Rate limiters should return a RateLimitedError (wrapping ErrRateLimited), so that clients know when to retry.
+var ErrRateLimited = errors.New("rate limited")
+
+// RateLimitedError rejects a request exceeding a rate limit.
+type RateLimitedError struct {
+	// RetryAfter is the time until the request would be allowed (eg. the refill time of a token bucket).
+	// It is advertised in the Retry-After header.
+	RetryAfter time.Duration
+}
+
+func (e RateLimitedError) Error() string {
+	return fmt.Sprintf("%s: retry in %d seconds", ErrRateLimited, e.retryAfterSeconds())
+}
+
+func (e RateLimitedError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// retryAfterSeconds rounds RetryAfter up to whole seconds (clients retrying early would be rejected again).
+func (e RateLimitedError) retryAfterSeconds() int {
+	return max(1, int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// Responses to rate limited requests.
+const (
+	// RateLimitedResponsePlain responds with 429 Too Many Requests and a plain text body.
+	RateLimitedResponsePlain = "plain"
+
+	// RateLimitedResponseJSON responds with 429 Too Many Requests and an OAuth2 style JSON body including retry hints:
+	//
+	//	{"error": "rate_limited", "error_description": "rate limited: retry in 2 seconds", "retry_after": 2}
+	RateLimitedResponseJSON = "json"
+)
+
+// RateLimiter limits the rate of requests by key (eg. a client IP address).
+//
+// Allow returns a RateLimitedError if a request exceeds the limit.
+// Other errors (eg. an unavailable backend of a distributed limiter) are reported as server errors.
+type RateLimiter interface {
+	Allow(ctx context.Context, key string) error
+}
+
+// rateLimiterPruneThreshold is the number of buckets above which TokenBucketRateLimiter forgets idle buckets.
+const rateLimiterPruneThreshold = 10000
+
+// TokenBucketRateLimiter is an in-memory RateLimiter using a token bucket per key.
+//
+// Each bucket holds up to burst tokens and refills at rate tokens per second; every request takes a token.
+// Limits are not shared between replicas: implement RateLimiter (eg. using Redis) for multi-replica deployments.
+// TokenBucketRateLimiter is safe for concurrent use.
+type TokenBucketRateLimiter struct {
+	rate  float64
+	burst float64
+	clock Clock
+
+	mu      sync.Mutex
+	buckets map[string]tokenBucket
+}
+
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// NewTokenBucketRateLimiter returns a new TokenBucketRateLimiter allowing rate requests per second with bursts of burst requests.
+func NewTokenBucketRateLimiter(rate float64, burst int, deps Dependencies) *TokenBucketRateLimiter {
+	return &TokenBucketRateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		clock:   deps.GetClock(),
+		buckets: make(map[string]tokenBucket),
+	}
+}
+
+// Allow implements RateLimiter.
+func (l *TokenBucketRateLimiter) Allow(_ context.Context, key string) error {
+	now := l.clock.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= rateLimiterPruneThreshold {
+			l.prune(now)
+		}
+
+		bucket = tokenBucket{tokens: l.burst, updatedAt: now}
+	}
+
+	bucket = l.refill(bucket, now)
+
+	if bucket.tokens < 1 {
+		l.buckets[key] = bucket
+
+		return RateLimitedError{
+			RetryAfter: time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second)),
+		}
+	}
+
+	bucket.tokens--
+	l.buckets[key] = bucket
+
+	return nil
+}
+
+func (l *TokenBucketRateLimiter) refill(bucket tokenBucket, now time.Time) tokenBucket {
+	if elapsed := now.Sub(bucket.updatedAt); elapsed > 0 {
+		bucket.tokens = min(l.burst, bucket.tokens+elapsed.Seconds()*l.rate)
+		bucket.updatedAt = now
+	}
+
+	return bucket
+}
+
+// prune forgets full buckets: they are indistinguishable from new ones.
+func (l *TokenBucketRateLimiter) prune(now time.Time) {
+	for key, bucket := range l.buckets {
+		if l.refill(bucket, now).tokens >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RateLimits configures RateLimitMiddleware.
+//
+// All limiters are optional.
+type RateLimits struct {
+	// ClientIP limits requests by client IP address.
+	ClientIP RateLimiter
+
+	// Username limits requests by the username presented in basic auth credentials or a password grant,
+	// so that credential stuffing attempts against an account are limited even if they are distributed across IP addresses.
+	Username RateLimiter
+
+	// Services limit requests by the requested service (the service parameter, or the default service of the TokenServer),
+	// so that clients of a noisy service cannot exhaust the limits of other services.
+	// Services without a limiter are not limited.
+	Services map[string]RateLimiter
+
+	// TrustedProxy takes the client IP address from the X-Forwarded-For header (the address appended by the proxy).
+	// Only enable it behind a proxy setting the header, otherwise clients can choose the address they are limited by.
+	TrustedProxy bool
+}
+
+// RateLimitMiddleware rejects requests exceeding limits with 429 Too Many Requests and a Retry-After header.
+func (s TokenServer) RateLimitMiddleware(limits RateLimits) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if limits.ClientIP != nil {
+				if err := limits.ClientIP.Allow(r.Context(), "ip:"+clientIP(r, limits.TrustedProxy)); err != nil {
+					s.handleRateLimitError(err, w, r)
+
+					return
+				}
+			}
+
+			if limits.Username != nil {
+				if username := requestUsername(r); username != "" {
+					if err := limits.Username.Allow(r.Context(), "username:"+username); err != nil {
+						s.handleRateLimitError(err, w, r)
+
+						return
+					}
+				}
+			}
+
+			if len(limits.Services) > 0 {
+				// Invalid requests are rejected by the handler
+				service, _ := s.requestService(requestForm(r))
+
+				if limiter, ok := limits.Services[service]; ok {
+					if err := limiter.Allow(r.Context(), "service:"+service); err != nil {
+						s.handleRateLimitError(err, w, r)
+
+						return
+					}
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (s TokenServer) handleRateLimitError(err error, w http.ResponseWriter, r *http.Request) {
+	if !errors.Is(err, ErrRateLimited) {
+		s.Logger.Error("checking rate limit failed", slog.Any("error", err))
+	}
+
+	s.handleError(err, w, r)
+}
+
+// clientIP returns the IP address of the client sending r.
+func clientIP(r *http.Request, trustedProxy bool) string {
+	if trustedProxy {
+		if forwardedFor := r.Header.Values("X-Forwarded-For"); len(forwardedFor) > 0 {
+			addrs := strings.Split(forwardedFor[len(forwardedFor)-1], ",")
+
+			if addr := strings.TrimSpace(addrs[len(addrs)-1]); addr != "" {
+				return addr
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// requestUsername returns the username presented in basic auth credentials or in a password grant (if any).
+func requestUsername(r *http.Request) string {
+	if username, _, ok := r.BasicAuth(); ok {
+		return username
+	}
+
+	if r.Method != http.MethodPost {
+		return ""
+	}
+
+	// Parsed forms are cached in the request, so handlers can parse it again
+	if err := r.ParseForm(); err != nil {
+		return ""
+	}
+
+	if r.PostForm.Get("grant_type") != GrantTypePassword {
+		return ""
+	}
+
+	return r.PostForm.Get("username")
+}
+
+// requestForm returns the parsed query and form parameters of r.
+func requestForm(r *http.Request) url.Values {
+	// Parsed forms are cached in the request, so handlers can parse it again
+	if err := r.ParseForm(); err != nil {
+		return r.URL.Query()
+	}
+
+	return r.Form
+}
@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucketRateLimiter(t *testing.T) {
+	ctx := context.Background()
+	clock := clockwork.NewFakeClock()
+
+	limiter := NewTokenBucketRateLimiter(0.5, 2, Dependencies{Clock: clock})
+
+	require.NoError(t, limiter.Allow(ctx, "a"))
+	require.NoError(t, limiter.Allow(ctx, "a"))
+
+	err := limiter.Allow(ctx, "a")
+	require.ErrorIs(t, err, ErrRateLimited)
+
+	var rateLimitedErr RateLimitedError
+	require.True(t, errors.As(err, &rateLimitedErr))
+	assert.Equal(t, 2*time.Second, rateLimitedErr.RetryAfter)
+
+	// Keys are limited independently
+	require.NoError(t, limiter.Allow(ctx, "b"))
+
+	clock.Advance(2 * time.Second)
+
+	require.NoError(t, limiter.Allow(ctx, "a"))
+	require.ErrorIs(t, limiter.Allow(ctx, "a"), ErrRateLimited)
+}
+
+func TestTokenServer_RateLimitMiddleware(t *testing.T) {
+	newHandler := func(limits RateLimits) http.Handler {
+		server := newTokenServerStub()
+
+		return server.RateLimitMiddleware(limits)(http.HandlerFunc(server.TokenHandler))
+	}
+
+	newRequest := func(remoteAddr string, username string) *http.Request {
+		query := url.Values{
+			"service": {"service.example.com"},
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/token?"+query.Encode(), nil)
+		req.RemoteAddr = remoteAddr
+
+		if username != "" {
+			req.SetBasicAuth(username, "password")
+		}
+
+		return req
+	}
+
+	serve := func(handler http.Handler, req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	t.Run("ClientIP", func(t *testing.T) {
+		handler := newHandler(RateLimits{
+			ClientIP: NewTokenBucketRateLimiter(1, 1, Dependencies{Clock: clockwork.NewFakeClock()}),
+		})
+
+		assert.Equal(t, http.StatusOK, serve(handler, newRequest("192.0.2.1:1234", "user")).Code)
+
+		rec := serve(handler, newRequest("192.0.2.1:5678", "user"))
+
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+		assert.Equal(t, http.StatusOK, serve(handler, newRequest("192.0.2.2:1234", "user")).Code)
+	})
+
+	t.Run("TrustedProxy", func(t *testing.T) {
+		handler := newHandler(RateLimits{
+			ClientIP:     NewTokenBucketRateLimiter(1, 1, Dependencies{Clock: clockwork.NewFakeClock()}),
+			TrustedProxy: true,
+		})
+
+		forwarded := func(forwardedFor string) *http.Request {
+			req := newRequest("10.0.0.1:1234", "user")
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+
+			return req
+		}
+
+		assert.Equal(t, http.StatusOK, serve(handler, forwarded("192.0.2.1")).Code)
+
+		// Addresses prepended by the client are ignored
+		assert.Equal(t, http.StatusTooManyRequests, serve(handler, forwarded("198.51.100.1, 192.0.2.1")).Code)
+
+		assert.Equal(t, http.StatusOK, serve(handler, forwarded("192.0.2.2")).Code)
+	})
+
+	t.Run("UntrustedProxy", func(t *testing.T) {
+		handler := newHandler(RateLimits{
+			ClientIP: NewTokenBucketRateLimiter(1, 1, Dependencies{Clock: clockwork.NewFakeClock()}),
+		})
+
+		req := newRequest("192.0.2.1:1234", "user")
+		req.Header.Set("X-Forwarded-For", "198.51.100.1")
+
+		assert.Equal(t, http.StatusOK, serve(handler, req).Code)
+
+		req = newRequest("192.0.2.1:1234", "user")
+		req.Header.Set("X-Forwarded-For", "198.51.100.2")
+
+		assert.Equal(t, http.StatusTooManyRequests, serve(handler, req).Code)
+	})
+
+	t.Run("Username", func(t *testing.T) {
+		server := newTokenServerStub()
+
+		handler := server.RateLimitMiddleware(RateLimits{
+			Username: NewTokenBucketRateLimiter(1, 1, Dependencies{Clock: clockwork.NewFakeClock()}),
+		})(http.HandlerFunc(server.OAuth2Handler))
+
+		newPasswordGrant := func(remoteAddr string) *http.Request {
+			form := url.Values{
+				"grant_type": {GrantTypePassword},
+				"service":    {"service.example.com"},
+				"client_id":  {"client"},
+				"username":   {"user"},
+				"password":   {"password"},
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.RemoteAddr = remoteAddr
+
+			return req
+		}
+
+		// The form remains readable by the handler
+		assert.Equal(t, http.StatusOK, serve(handler, newPasswordGrant("192.0.2.1:1234")).Code)
+
+		// The same username from another address
+		assert.Equal(t, http.StatusTooManyRequests, serve(handler, newPasswordGrant("192.0.2.2:1234")).Code)
+	})
+
+	t.Run("Services", func(t *testing.T) {
+		server := newTokenServerStub()
+		server.DefaultService = "default.example.com"
+
+		handler := server.RateLimitMiddleware(RateLimits{
+			Services: map[string]RateLimiter{
+				"noisy.example.com":   NewTokenBucketRateLimiter(1, 1, Dependencies{Clock: clockwork.NewFakeClock()}),
+				"default.example.com": NewTokenBucketRateLimiter(1, 1, Dependencies{Clock: clockwork.NewFakeClock()}),
+			},
+		})(http.HandlerFunc(server.TokenHandler))
+
+		newServiceRequest := func(service string) *http.Request {
+			req := httptest.NewRequest(http.MethodGet, "/token?"+url.Values{"service": {service}}.Encode(), nil)
+			req.SetBasicAuth("user", "password")
+
+			return req
+		}
+
+		assert.Equal(t, http.StatusOK, serve(handler, newServiceRequest("noisy.example.com")).Code)
+		assert.Equal(t, http.StatusTooManyRequests, serve(handler, newServiceRequest("noisy.example.com")).Code)
+
+		// Other services are not affected
+		assert.Equal(t, http.StatusOK, serve(handler, newServiceRequest("quiet.example.com")).Code)
+		assert.Equal(t, http.StatusOK, serve(handler, newServiceRequest("quiet.example.com")).Code)
+
+		// The default service is limited when no service is requested
+		req := httptest.NewRequest(http.MethodGet, "/token", nil)
+		req.SetBasicAuth("user", "password")
+
+		assert.Equal(t, http.StatusOK, serve(handler, req).Code)
+		assert.Equal(t, http.StatusTooManyRequests, serve(handler, newServiceRequest("default.example.com")).Code)
+	})
+}
@@ -0,0 +1,242 @@
+// Package revocation keeps track of revoked tokens.
+package revocation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+// Store records revoked tokens (identified by their ID, eg. the "jti" claim) until they expire.
+type Store interface {
+	// Revoke revokes a token. The revocation can be forgotten once the token expires.
+	Revoke(ctx context.Context, id string, expiresAt time.Time) error
+
+	// IsRevoked reports whether a token is revoked.
+	IsRevoked(ctx context.Context, id string) (bool, error)
+}
+
+// DefaultSnapshotInterval is the interval [MemoryStore.Run] writes snapshots at by default.
+const DefaultSnapshotInterval = time.Minute
+
+// MemoryStore is a Store for single-node deployments.
+//
+// Revocations are kept in memory and (optionally) snapshotted to a file, so that they survive restarts.
+// MemoryStore is safe for concurrent use.
+type MemoryStore struct {
+	path     string
+	interval time.Duration
+	clock    auth.Clock
+
+	mu      sync.RWMutex
+	entries map[string]time.Time
+}
+
+// NewMemoryStore returns a new MemoryStore.
+//
+// If path is not empty, revocations are loaded from the snapshot stored there (if it exists)
+// and [MemoryStore.Snapshot] writes them back to it.
+func NewMemoryStore(path string, opts ...MemoryStoreOption) (*MemoryStore, error) {
+	s := &MemoryStore{
+		path:    path,
+		entries: make(map[string]time.Time),
+	}
+
+	for _, opt := range opts {
+		opt.applyMemoryStore(s)
+	}
+
+	if s.interval <= 0 {
+		s.interval = DefaultSnapshotInterval
+	}
+
+	if s.clock == nil {
+		s.clock = auth.Dependencies{}.GetClock()
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Revoke implements Store.
+func (s *MemoryStore) Revoke(_ context.Context, id string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Keep the revocation for as long as any token with this ID may be valid
+	if current, ok := s.entries[id]; !ok || expiresAt.After(current) {
+		s.entries[id] = expiresAt
+	}
+
+	return nil
+}
+
+// IsRevoked implements Store.
+func (s *MemoryStore) IsRevoked(_ context.Context, id string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.entries[id]
+
+	return ok, nil
+}
+
+// Prune forgets revocations of tokens that expired and returns the number of removed entries.
+func (s *MemoryStore) Prune() int {
+	now := s.clock.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var pruned int
+
+	for id, expiresAt := range s.entries {
+		if !expiresAt.After(now) {
+			delete(s.entries, id)
+			pruned++
+		}
+	}
+
+	return pruned
+}
+
+// Snapshot writes the current revocations to the snapshot file.
+//
+// The file is replaced atomically, so a crash never leaves a partially written snapshot behind.
+// Snapshot is a no-op if the store has no snapshot file.
+func (s *MemoryStore) Snapshot() error {
+	if s.path == "" {
+		return nil
+	}
+
+	s.mu.RLock()
+	data, err := json.Marshal(snapshot{Revocations: s.entries})
+	s.mu.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), s.path)
+}
+
+// Run implements [auth.Runner]: it prunes expired revocations and writes a snapshot
+// every snapshot interval (see [WithSnapshotInterval]) until ctx is canceled.
+//
+// A final snapshot is written before Run returns.
+func (s *MemoryStore) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return s.Snapshot()
+
+		case <-ticker.C:
+			s.Prune()
+
+			if err := s.Snapshot(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+type snapshot struct {
+	Revocations map[string]time.Time `json:"revocations"`
+}
+
+func (s *MemoryStore) load() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var snapshot snapshot
+
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return err
+	}
+
+	for id, expiresAt := range snapshot.Revocations {
+		s.entries[id] = expiresAt
+	}
+
+	s.Prune()
+
+	return nil
+}
+
+// MemoryStoreOption configures a MemoryStore.
+type MemoryStoreOption interface {
+	applyMemoryStore(s *MemoryStore)
+}
+
+// WithSnapshotInterval configures a MemoryStore to write snapshots at interval (defaults to [DefaultSnapshotInterval]).
+func WithSnapshotInterval(interval time.Duration) MemoryStoreOption {
+	return withSnapshotInterval{interval}
+}
+
+type withSnapshotInterval struct {
+	interval time.Duration
+}
+
+func (w withSnapshotInterval) applyMemoryStore(s *MemoryStore) {
+	s.interval = w.interval
+}
+
+// ClockOption configures a MemoryStore or a SessionLimiter.
+type ClockOption interface {
+	MemoryStoreOption
+	SessionLimiterOption
+}
+
+// WithClock configures a MemoryStore or a SessionLimiter to use a Clock.
+func WithClock(clock auth.Clock) ClockOption {
+	return withClock{clock}
+}
+
+type withClock struct {
+	clock auth.Clock
+}
+
+func (w withClock) applyMemoryStore(s *MemoryStore) {
+	s.clock = w.clock
+}
+
+func (w withClock) applySessionLimiter(l *SessionLimiter) {
+	l.clock = w.clock
+}
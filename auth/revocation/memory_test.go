@@ -0,0 +1,128 @@
+package revocation
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore_Snapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "revocations.json")
+
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	clock := clockwork.NewFakeClockAt(now)
+
+	store, err := NewMemoryStore(path, WithClock(clock))
+	require.NoError(t, err)
+
+	err = store.Revoke(context.Background(), "token", now.Add(time.Hour))
+	require.NoError(t, err)
+
+	err = store.Revoke(context.Background(), "other", now.Add(time.Minute))
+	require.NoError(t, err)
+
+	err = store.Snapshot()
+	require.NoError(t, err)
+
+	t.Run("Reload", func(t *testing.T) {
+		store, err := NewMemoryStore(path, WithClock(clock))
+		require.NoError(t, err)
+
+		revoked, err := store.IsRevoked(context.Background(), "token")
+		require.NoError(t, err)
+		assert.True(t, revoked)
+
+		revoked, err = store.IsRevoked(context.Background(), "unknown")
+		require.NoError(t, err)
+		assert.False(t, revoked)
+	})
+
+	t.Run("ReloadPrunesExpired", func(t *testing.T) {
+		clock := clockwork.NewFakeClockAt(now.Add(30 * time.Minute))
+
+		store, err := NewMemoryStore(path, WithClock(clock))
+		require.NoError(t, err)
+
+		revoked, err := store.IsRevoked(context.Background(), "other")
+		require.NoError(t, err)
+		assert.False(t, revoked)
+
+		revoked, err = store.IsRevoked(context.Background(), "token")
+		require.NoError(t, err)
+		assert.True(t, revoked)
+	})
+}
+
+func TestMemoryStore_Prune(t *testing.T) {
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	clock := clockwork.NewFakeClockAt(now)
+
+	store, err := NewMemoryStore("", WithClock(clock))
+	require.NoError(t, err)
+
+	require.NoError(t, store.Revoke(context.Background(), "short", now.Add(time.Minute)))
+	require.NoError(t, store.Revoke(context.Background(), "long", now.Add(time.Hour)))
+
+	// A later expiration extends the revocation
+	require.NoError(t, store.Revoke(context.Background(), "short", now.Add(2*time.Hour)))
+	require.NoError(t, store.Revoke(context.Background(), "short", now.Add(time.Minute)))
+
+	assert.Zero(t, store.Prune())
+
+	clock.Advance(time.Hour)
+
+	assert.Equal(t, 1, store.Prune())
+
+	revoked, err := store.IsRevoked(context.Background(), "long")
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	revoked, err = store.IsRevoked(context.Background(), "short")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+}
+
+func TestMemoryStore_Run(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "revocations.json")
+
+	store, err := NewMemoryStore(path, WithSnapshotInterval(time.Millisecond))
+	require.NoError(t, err)
+
+	err = store.Revoke(context.Background(), "token", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error)
+
+	go func() {
+		done <- store.Run(ctx)
+	}()
+
+	// The snapshot is written periodically
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(path)
+
+		return err == nil
+	}, time.Second, time.Millisecond)
+
+	err = store.Revoke(context.Background(), "other", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	// The final snapshot contains every revocation
+	store, err = NewMemoryStore(path)
+	require.NoError(t, err)
+
+	revoked, err := store.IsRevoked(context.Background(), "other")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+}
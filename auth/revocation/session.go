@@ -0,0 +1,211 @@
+package revocation
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+// neverExpires is recorded as the expiration of revoked sessions that would otherwise never expire.
+var neverExpires = time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+// DefaultPruneInterval is the interval [SessionLimiter.Run] forgets expired sessions at by default.
+const DefaultPruneInterval = time.Minute
+
+// SessionLimiter caps the number of concurrent sessions (eg. refresh token families) of a subject to limit credential sharing.
+//
+// When a new session exceeds the cap, the oldest sessions of the subject are revoked in the Store.
+// Active sessions are tracked in memory: they are not shared between replicas and counting starts over after a restart
+// (revocations persist as long as the Store does).
+//
+// SessionLimiter is safe for concurrent use.
+type SessionLimiter struct {
+	store       Store
+	maxSessions int
+
+	pruneInterval time.Duration
+	clock         auth.Clock
+
+	mu       sync.Mutex
+	sessions map[auth.SubjectID][]session
+}
+
+type session struct {
+	id        string
+	expiresAt time.Time
+}
+
+// NewSessionLimiter returns a new SessionLimiter allowing maxSessions concurrent sessions per subject.
+func NewSessionLimiter(store Store, maxSessions int, opts ...SessionLimiterOption) *SessionLimiter {
+	if maxSessions <= 0 {
+		panic("maxSessions must be positive")
+	}
+
+	l := &SessionLimiter{
+		store:       store,
+		maxSessions: maxSessions,
+		sessions:    make(map[auth.SubjectID][]session),
+	}
+
+	for _, opt := range opts {
+		opt.applySessionLimiter(l)
+	}
+
+	if l.pruneInterval <= 0 {
+		l.pruneInterval = DefaultPruneInterval
+	}
+
+	if l.clock == nil {
+		l.clock = auth.Dependencies{}.GetClock()
+	}
+
+	return l
+}
+
+// RecordSession records a session of a subject that remains active until expiresAt (zero means it never expires).
+//
+// Recording a known session again (eg. when a refresh token is rotated) extends its expiration.
+// Recording a new session revokes the oldest sessions of the subject exceeding the limit.
+func (l *SessionLimiter) RecordSession(ctx context.Context, subject auth.SubjectID, id string, expiresAt time.Time) error {
+	if expiresAt.IsZero() {
+		expiresAt = neverExpires
+	}
+
+	now := l.clock.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Sessions are kept in the order they started at
+	sessions := l.sessions[subject][:0]
+
+	for _, s := range l.sessions[subject] {
+		if s.expiresAt.After(now) {
+			sessions = append(sessions, s)
+		}
+	}
+
+	var found bool
+
+	for i := range sessions {
+		if sessions[i].id != id {
+			continue
+		}
+
+		if expiresAt.After(sessions[i].expiresAt) {
+			sessions[i].expiresAt = expiresAt
+		}
+
+		found = true
+	}
+
+	if !found {
+		sessions = append(sessions, session{id: id, expiresAt: expiresAt})
+	}
+
+	for len(sessions) > l.maxSessions {
+		if err := l.store.Revoke(ctx, sessions[0].id, sessions[0].expiresAt); err != nil {
+			l.sessions[subject] = sessions
+
+			return err
+		}
+
+		sessions = sessions[1:]
+	}
+
+	l.sessions[subject] = sessions
+
+	return nil
+}
+
+// IsSessionRevoked reports whether a session is revoked.
+func (l *SessionLimiter) IsSessionRevoked(ctx context.Context, id string) (bool, error) {
+	return l.store.IsRevoked(ctx, id)
+}
+
+// Prune forgets expired sessions (and subjects without active sessions) and returns the number of removed sessions.
+func (l *SessionLimiter) Prune() int {
+	now := l.clock.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var pruned int
+
+	for subject, sessions := range l.sessions {
+		active := sessions[:0]
+
+		for _, s := range sessions {
+			if s.expiresAt.After(now) {
+				active = append(active, s)
+			}
+		}
+
+		pruned += len(sessions) - len(active)
+
+		if len(active) == 0 {
+			delete(l.sessions, subject)
+
+			continue
+		}
+
+		l.sessions[subject] = active
+	}
+
+	return pruned
+}
+
+// Run implements [auth.Runner]: it forgets expired sessions every prune interval (see [WithPruneInterval])
+// and runs the background tasks of the Store (eg. [MemoryStore.Run]) until ctx is canceled.
+func (l *SessionLimiter) Run(ctx context.Context) error {
+	// Receiving from a nil channel blocks forever, so there is nothing to wait for if the Store has no background tasks
+	var storeErr chan error
+
+	if runner, ok := l.store.(auth.Runner); ok {
+		storeErr = make(chan error, 1)
+
+		go func() {
+			storeErr <- runner.Run(ctx)
+		}()
+	}
+
+	ticker := time.NewTicker(l.pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if storeErr != nil {
+				return <-storeErr
+			}
+
+			return nil
+
+		case err := <-storeErr:
+			return err
+
+		case <-ticker.C:
+			l.Prune()
+		}
+	}
+}
+
+// SessionLimiterOption configures a SessionLimiter.
+type SessionLimiterOption interface {
+	applySessionLimiter(l *SessionLimiter)
+}
+
+// WithPruneInterval configures a SessionLimiter to forget expired sessions at interval (defaults to [DefaultPruneInterval]).
+func WithPruneInterval(interval time.Duration) SessionLimiterOption {
+	return withPruneInterval{interval}
+}
+
+type withPruneInterval struct {
+	interval time.Duration
+}
+
+func (w withPruneInterval) applySessionLimiter(l *SessionLimiter) {
+	l.pruneInterval = w.interval
+}
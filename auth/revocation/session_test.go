@@ -0,0 +1,80 @@
+package revocation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionLimiter(t *testing.T) {
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	clock := clockwork.NewFakeClockAt(now)
+
+	store, err := NewMemoryStore("", WithClock(clock))
+	require.NoError(t, err)
+
+	limiter := NewSessionLimiter(store, 2, WithClock(clock))
+
+	ctx := context.Background()
+
+	require.NoError(t, limiter.RecordSession(ctx, "user", "first", now.Add(time.Hour)))
+	require.NoError(t, limiter.RecordSession(ctx, "user", "second", now.Add(time.Minute)))
+	require.NoError(t, limiter.RecordSession(ctx, "other", "other", time.Time{}))
+
+	// Recording a known session does not count as a new one
+	require.NoError(t, limiter.RecordSession(ctx, "user", "second", now.Add(2*time.Hour)))
+
+	assertRevoked := func(t *testing.T, expected map[string]bool) {
+		t.Helper()
+
+		for id, expectedRevoked := range expected {
+			revoked, err := limiter.IsSessionRevoked(ctx, id)
+			require.NoError(t, err)
+
+			assert.Equal(t, expectedRevoked, revoked, id)
+		}
+	}
+
+	assertRevoked(t, map[string]bool{"first": false, "second": false, "other": false})
+
+	require.NoError(t, limiter.RecordSession(ctx, "user", "third", now.Add(time.Hour)))
+
+	assertRevoked(t, map[string]bool{"first": true, "second": false, "third": false, "other": false})
+
+	t.Run("Expired", func(t *testing.T) {
+		clock.Advance(90 * time.Minute)
+
+		// The third session expired, so there is room for a new one
+		require.NoError(t, limiter.RecordSession(ctx, "user", "fourth", now.Add(3*time.Hour)))
+
+		assertRevoked(t, map[string]bool{"second": false, "third": false, "fourth": false})
+	})
+}
+
+func TestSessionLimiter_Prune(t *testing.T) {
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	clock := clockwork.NewFakeClockAt(now)
+
+	store, err := NewMemoryStore("", WithClock(clock))
+	require.NoError(t, err)
+
+	limiter := NewSessionLimiter(store, 2, WithClock(clock))
+
+	ctx := context.Background()
+
+	require.NoError(t, limiter.RecordSession(ctx, "user", "first", now.Add(time.Minute)))
+	require.NoError(t, limiter.RecordSession(ctx, "user", "second", now.Add(time.Hour)))
+	require.NoError(t, limiter.RecordSession(ctx, "other", "other", now.Add(time.Minute)))
+
+	clock.Advance(30 * time.Minute)
+
+	assert.Equal(t, 2, limiter.Prune())
+
+	// Subjects without active sessions are forgotten
+	assert.Len(t, limiter.sessions, 1)
+	assert.Len(t, limiter.sessions["user"], 1)
+}
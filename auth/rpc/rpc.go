@@ -0,0 +1,225 @@
+// Package rpc exposes an auth.TokenService to RPC transports (eg. gRPC).
+//
+// Messages mirror what a protobuf definition of the token service would look like,
+// so that a generated gRPC server can delegate to Server without touching the service, authorizer or issuer wiring:
+//
+//	service TokenService {
+//	  rpc IssueToken(TokenRequest) returns (TokenResponse);
+//	}
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+// TokenRequest is a request for an access token.
+//
+// An empty GrantType issues a token using the [Docker Registry v2 authentication] flow
+// (anonymously if no Username is provided).
+// Otherwise, the [Docker Registry v2 OAuth2 authentication] flow is used with the selected grant type.
+//
+// [Docker Registry v2 authentication]: https://github.com/distribution/distribution/blob/main/docs/spec/auth/token.md
+// [Docker Registry v2 OAuth2 authentication]: https://github.com/distribution/distribution/blob/main/docs/spec/auth/oauth.md
+type TokenRequest struct {
+	GrantType string
+	Service   string
+	ClientID  string
+	Scopes    []string
+
+	// Offline requests a refresh token.
+	Offline bool
+
+	Username     string
+	Password     string
+	RefreshToken string
+}
+
+// TokenResponse is the response to a TokenRequest.
+type TokenResponse struct {
+	AccessToken  string
+	TokenType    string
+	ExpiresIn    int64
+	IssuedAt     string
+	Scope        string
+	RefreshToken string
+
+	// RefreshTokenExpiresIn is the lifetime of a newly issued refresh token in seconds.
+	RefreshTokenExpiresIn int64
+}
+
+// Code is an RPC status code.
+//
+// Values match the respective gRPC codes, so they can be converted directly.
+type Code uint32
+
+// Status codes returned by Server.
+const (
+	CodeCanceled         Code = 1
+	CodeInvalidArgument  Code = 3
+	CodeDeadlineExceeded Code = 4
+	CodeInternal         Code = 13
+	CodeUnauthenticated  Code = 16
+)
+
+// Error is an error returned by Server carrying an RPC status code.
+type Error struct {
+	Code    Code
+	Message string
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error: code = %d desc = %s", e.Code, e.Message)
+}
+
+// Server adapts an auth.TokenService to RPC transports.
+type Server struct {
+	Service auth.TokenService
+
+	// ResourceActions restricts the actions clients may request for each resource type.
+	// Defaults to auth.DefaultResourceActions.
+	ResourceActions auth.ResourceActions
+
+	// MaxScopes rejects requests listing more scopes than this (zero means no limit).
+	MaxScopes int
+
+	// MaxActionsPerScope rejects requests with a scope listing more actions than this (zero means no limit).
+	MaxActionsPerScope int
+
+	// RegistryHosts are stripped from repository names in requested scopes (see auth.StripRegistryHost).
+	RegistryHosts []string
+
+	// DefaultService is used when a request does not specify a service.
+	DefaultService string
+}
+
+// IssueToken issues an access token (and optionally a refresh token).
+//
+// Errors are returned as *Error.
+func (s Server) IssueToken(ctx context.Context, r *TokenRequest) (*TokenResponse, error) {
+	resp, err := s.issueToken(ctx, r)
+	if err != nil {
+		return nil, errorFor(err)
+	}
+
+	return resp, nil
+}
+
+func (s Server) issueToken(ctx context.Context, r *TokenRequest) (*TokenResponse, error) {
+	scopes, err := s.parseScopes(r.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	service := r.Service
+	if service == "" {
+		service = s.DefaultService
+	}
+
+	if r.GrantType == "" {
+		request := auth.TokenRequest{
+			Service:   service,
+			ClientID:  r.ClientID,
+			Offline:   r.Offline,
+			Scopes:    scopes,
+			Anonymous: r.Username == "",
+			Username:  r.Username,
+			Password:  r.Password,
+		}
+
+		if err := request.Validate(); err != nil {
+			return nil, fmt.Errorf("%w: %s", auth.ErrInvalidRequest, err)
+		}
+
+		resp, err := s.Service.TokenHandler(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+
+		return &TokenResponse{
+			AccessToken:  resp.Token,
+			TokenType:    resp.TokenType,
+			ExpiresIn:    int64(resp.ExpiresIn),
+			RefreshToken: resp.RefreshToken,
+		}, nil
+	}
+
+	request := auth.OAuth2Request{
+		GrantType:    r.GrantType,
+		Service:      service,
+		ClientID:     r.ClientID,
+		Scopes:       scopes,
+		Username:     r.Username,
+		Password:     r.Password,
+		RefreshToken: r.RefreshToken,
+	}
+
+	if r.Offline {
+		request.AccessType = auth.AccessTypeOffline
+	}
+
+	if err := request.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %s", auth.ErrInvalidRequest, err)
+	}
+
+	resp, err := s.Service.OAuth2Handler(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken:           resp.Token,
+		TokenType:             resp.TokenType,
+		ExpiresIn:             int64(resp.ExpiresIn),
+		IssuedAt:              resp.IssuedAt,
+		Scope:                 resp.Scope,
+		RefreshToken:          resp.RefreshToken,
+		RefreshTokenExpiresIn: int64(resp.RefreshTokenExpiresIn),
+	}, nil
+}
+
+func (s Server) parseScopes(rawScopes []string) ([]auth.Scope, error) {
+	scopes, err := auth.ParseScopes(rawScopes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply the same limits as the HTTP transport (see auth.TokenServer)
+	limits := auth.ScopeLimits{
+		ResourceActions:    s.ResourceActions,
+		MaxScopes:          s.MaxScopes,
+		MaxActionsPerScope: s.MaxActionsPerScope,
+		RegistryHosts:      s.RegistryHosts,
+	}
+
+	scopes, err = limits.CheckScopes(scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	return auth.MergeScopes(scopes)
+}
+
+// errorFor maps err to an *Error the same way the HTTP transport maps errors to status codes.
+func errorFor(err error) *Error {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return &Error{Code: CodeCanceled, Message: err.Error()}
+
+	case errors.Is(err, context.DeadlineExceeded):
+		return &Error{Code: CodeDeadlineExceeded, Message: err.Error()}
+
+	case errors.Is(err, auth.ErrUnauthorized), errors.Is(err, auth.ErrAuthenticationFailed):
+		// Do not reveal the cause of authentication failures
+		return &Error{Code: CodeUnauthenticated, Message: "unauthorized"}
+
+	case errors.Is(err, auth.ErrInvalidRequest), errors.Is(err, auth.ErrInvalidScope):
+		return &Error{Code: CodeInvalidArgument, Message: err.Error()}
+	}
+
+	return &Error{Code: CodeInternal, Message: "internal error"}
+}
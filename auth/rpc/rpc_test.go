@@ -0,0 +1,176 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+	"github.com/sagikazarmark/registry-auth/auth/authn"
+	"github.com/sagikazarmark/registry-auth/auth/authz"
+	"github.com/sagikazarmark/registry-auth/auth/fakes"
+)
+
+func newServer(t *testing.T) Server {
+	t.Helper()
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	tokenIssuer := fakes.FakeTokenIssuer{
+		Expiration: 5 * time.Minute,
+		IssuedAt:   time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC),
+	}
+
+	return Server{
+		Service: auth.TokenServiceImpl{
+			Authenticator: auth.Authenticator{
+				PasswordAuthenticator: authn.NewUserAuthenticator([]authn.User{
+					{
+						Enabled:      true,
+						Username:     "user",
+						PasswordHash: string(passwordHash),
+					},
+				}),
+			},
+			Authorizer: authz.NewDefaultAuthorizer(authz.NewDefaultRepositoryAuthorizer(false), false),
+			TokenIssuer: auth.TokenIssuer{
+				AccessTokenIssuer:  tokenIssuer,
+				RefreshTokenIssuer: tokenIssuer,
+			},
+		},
+		DefaultService: "registry.example.com",
+	}
+}
+
+func TestServer_IssueToken(t *testing.T) {
+	server := newServer(t)
+
+	t.Run("Token", func(t *testing.T) {
+		resp, err := server.IssueToken(context.Background(), &TokenRequest{
+			Scopes:   []string{"repository:user/app:pull,push"},
+			Offline:  true,
+			Username: "user",
+			Password: "password",
+		})
+		require.NoError(t, err)
+
+		expected := &TokenResponse{
+			AccessToken:  "access_token service=registry.example.com sub=user access=repository:user/app:pull,push",
+			ExpiresIn:    300,
+			RefreshToken: "refresh_token service=registry.example.com sub=user",
+		}
+
+		assert.Equal(t, expected, resp)
+	})
+
+	t.Run("OAuth2", func(t *testing.T) {
+		resp, err := server.IssueToken(context.Background(), &TokenRequest{
+			GrantType: auth.GrantTypePassword,
+			Service:   "other.example.com",
+			ClientID:  "client",
+			Scopes:    []string{"repository:user/app:pull", "repository:user/app:push"},
+			Username:  "user",
+			Password:  "password",
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, "access_token service=other.example.com sub=user access=repository:user/app:pull,push", resp.AccessToken)
+		assert.Equal(t, "repository:user/app:pull,push", resp.Scope)
+		assert.Equal(t, "2009-11-10T23:00:00Z", resp.IssuedAt)
+		assert.Empty(t, resp.RefreshToken)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		testCases := map[string]struct {
+			request TokenRequest
+			code    Code
+		}{
+			"AuthenticationFailed": {
+				request: TokenRequest{Username: "user", Password: "wrong"},
+				code:    CodeUnauthenticated,
+			},
+			"InvalidScope": {
+				request: TokenRequest{Scopes: []string{"repository:foo"}},
+				code:    CodeInvalidArgument,
+			},
+			"InvalidRequest": {
+				request: TokenRequest{GrantType: auth.GrantTypePassword, Username: "user", Password: "password"},
+				code:    CodeInvalidArgument,
+			},
+		}
+
+		for name, testCase := range testCases {
+			testCase := testCase
+
+			t.Run(name, func(t *testing.T) {
+				_, err := server.IssueToken(context.Background(), &testCase.request)
+				require.Error(t, err)
+
+				var rpcErr *Error
+				require.ErrorAs(t, err, &rpcErr)
+
+				assert.Equal(t, testCase.code, rpcErr.Code)
+			})
+		}
+	})
+}
+
+func TestServer_IssueToken_MaxScopes(t *testing.T) {
+	server := newServer(t)
+	server.MaxScopes = 1
+
+	_, err := server.IssueToken(context.Background(), &TokenRequest{
+		Scopes:   []string{"repository:user/app:pull", "repository:user/other:pull"},
+		Username: "user",
+		Password: "password",
+	})
+	require.Error(t, err)
+
+	var rpcErr *Error
+	require.ErrorAs(t, err, &rpcErr)
+
+	assert.Equal(t, CodeInvalidArgument, rpcErr.Code)
+
+	_, err = server.IssueToken(context.Background(), &TokenRequest{
+		Scopes:   []string{"repository:user/app:pull"},
+		Username: "user",
+		Password: "password",
+	})
+	require.NoError(t, err)
+}
+
+func TestServer_IssueToken_MaxActionsPerScope(t *testing.T) {
+	server := newServer(t)
+	server.MaxActionsPerScope = 1
+
+	_, err := server.IssueToken(context.Background(), &TokenRequest{
+		Scopes:   []string{"repository:user/app:pull,push"},
+		Username: "user",
+		Password: "password",
+	})
+	require.Error(t, err)
+
+	var rpcErr *Error
+	require.ErrorAs(t, err, &rpcErr)
+
+	assert.Equal(t, CodeInvalidArgument, rpcErr.Code)
+}
+
+func TestServer_IssueToken_RegistryHosts(t *testing.T) {
+	server := newServer(t)
+	server.RegistryHosts = []string{"registry.example.com"}
+
+	resp, err := server.IssueToken(context.Background(), &TokenRequest{
+		Scopes:   []string{"repository:registry.example.com/user/app:pull"},
+		Username: "user",
+		Password: "password",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "access_token service=registry.example.com sub=user access=repository:user/app:pull", resp.AccessToken)
+}
@@ -0,0 +1,12 @@
+package auth
+
+import (
+	"context"
+)
+
+// Runner is implemented by components running background tasks (eg. persisting state to disk).
+//
+// Components implement it optionally. Run blocks until ctx is canceled.
+type Runner interface {
+	Run(ctx context.Context) error
+}
@@ -1,13 +1,18 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
+	stdslices "slices"
 	"strings"
 
 	"github.com/sagikazarmark/registry-auth/pkg/slices"
 )
 
+// ErrInvalidScope is returned when a requested scope is malformed or not acceptable.
+var ErrInvalidScope = errors.New("invalid scope")
+
 // Scopes is a list of Scope instances.
 type Scopes []Scope
 
@@ -41,35 +46,158 @@ func (r Resource) String() string {
 	return fmt.Sprintf("%s:%s", r.Type, r.Name)
 }
 
-// ParseScopes calls ParseScope for each scope in the list.
+// MergeScopes merges scopes requesting access to the same resource (eg. repository:foo:pull and repository:foo:push)
+// into a single scope listing every requested action once (in the order of their first appearance).
+// Scopes are returned in the order their resources first appear.
+//
+// Scopes for the same resource type and name with different resource classes (eg. repository(plugin):foo and repository:foo)
+// are ambiguous: MergeScopes returns an ErrInvalidScope error.
+func MergeScopes(scopes []Scope) ([]Scope, error) {
+	type key struct {
+		Type string
+		Name string
+	}
+
+	merged := make([]Scope, 0, len(scopes))
+	indexes := make(map[key]int, len(scopes))
+
+	for _, scope := range scopes {
+		k := key{scope.Type, scope.Name}
+
+		i, ok := indexes[k]
+		if !ok {
+			indexes[k] = len(merged)
+			merged = append(merged, Scope{
+				Resource: scope.Resource,
+				Actions:  appendUnique(nil, scope.Actions...),
+			})
+
+			continue
+		}
+
+		if merged[i].Class != scope.Class {
+			return nil, fmt.Errorf("%w: conflicting resource classes for %s:%s: %q and %q", ErrInvalidScope, scope.Type, scope.Name, merged[i].Class, scope.Class)
+		}
+
+		merged[i].Actions = appendUnique(merged[i].Actions, scope.Actions...)
+	}
+
+	return merged, nil
+}
+
+// StripRegistryHost removes a registry host prefix (eg. registry.example.com/team/app becomes team/app)
+// from the names of repository scopes, so that repositories are named the same way regardless of the client.
+//
+// Hosts are compared case-insensitively.
+func StripRegistryHost(scopes []Scope, hosts []string) []Scope {
+	if len(hosts) == 0 {
+		return scopes
+	}
+
+	stripped := make([]Scope, 0, len(scopes))
+
+	for _, scope := range scopes {
+		if scope.Type == "repository" {
+			if host, name, ok := strings.Cut(scope.Name, "/"); ok && name != "" {
+				for _, h := range hosts {
+					if strings.EqualFold(host, h) {
+						scope.Name = name
+
+						break
+					}
+				}
+			}
+		}
+
+		stripped = append(stripped, scope)
+	}
+
+	return stripped
+}
+
+// deniedScopes returns the requested actions missing from grantedScopes (grouped by resource, in the order they were requested).
+func deniedScopes(requestedScopes []Scope, grantedScopes []Scope) []Scope {
+	var denied []Scope
+
+	for _, scope := range requestedScopes {
+		var actions []string
+
+		for _, action := range scope.Actions {
+			if !isActionGranted(scope.Resource, action, grantedScopes) {
+				actions = append(actions, action)
+			}
+		}
+
+		if len(actions) > 0 {
+			denied = append(denied, Scope{Resource: scope.Resource, Actions: actions})
+		}
+	}
+
+	return denied
+}
+
+func appendUnique(s []string, values ...string) []string {
+	for _, v := range values {
+		if !stdslices.Contains(s, v) {
+			s = append(s, v)
+		}
+	}
+
+	return s
+}
+
+// ParseScopes parses scope parameters (see ParseScope).
+//
+// A parameter may list multiple space-delimited scopes (as OAuth2 clients send them).
 // If any of the scopes is invalid, ParseScopes returns an empty slice and an error.
 func ParseScopes(scopes []string) ([]Scope, error) {
-	return slices.TryMap(scopes, ParseScope)
+	var fields []string
+
+	for _, scope := range scopes {
+		fields = append(fields, strings.Fields(scope)...)
+	}
+
+	return slices.TryMap(fields, ParseScope)
 }
 
 // ParseScope parses a scope string into a formal structure according to the [Token Scope documentation].
 //
 // General scope format: resourceType[(resourceClass)]:resourceName:action[,action...]
 //
+// The resource name may contain colons (eg. a registry host with a port): actions follow the last colon.
+// Actions are trimmed and empty ones are ignored. The "*" action requests every action of the resource type.
+//
 // ParseScope returns an error if the scope format is invalid.
 //
 // [Token Scope documentation]: https://github.com/distribution/distribution/blob/main/docs/spec/auth/scope.md
 func ParseScope(scope string) (Scope, error) {
-	parts := strings.SplitN(scope, ":", 3)
+	resourceType, rest, ok := strings.Cut(scope, ":")
+	if !ok {
+		return Scope{}, fmt.Errorf("%w: invalid format: %q", ErrInvalidScope, scope)
+	}
 
-	if len(parts) != 3 {
-		return Scope{}, fmt.Errorf("invalid scope format: %q", scope)
+	i := strings.LastIndex(rest, ":")
+	if i < 0 {
+		return Scope{}, fmt.Errorf("%w: invalid format: %q", ErrInvalidScope, scope)
 	}
 
-	resourceType, resourceName, actions := parts[0], parts[1], parts[2]
+	resourceName, rawActions := rest[:i], rest[i+1:]
+
+	var actions []string
+
+	for _, action := range strings.Split(rawActions, ",") {
+		if action = strings.TrimSpace(action); action != "" {
+			actions = append(actions, action)
+		}
+	}
 
-	if actions == "" {
-		return Scope{}, fmt.Errorf("invalid scope format: %q", scope)
+	if len(actions) == 0 {
+		return Scope{}, fmt.Errorf("%w: invalid format: %q", ErrInvalidScope, scope)
 	}
 
 	resourceType, resourceClass := splitResourceClass(resourceType)
 	if resourceType == "" {
-		return Scope{}, fmt.Errorf("invalid scope format: %q", scope)
+		return Scope{}, fmt.Errorf("%w: invalid format: %q", ErrInvalidScope, scope)
 	}
 
 	return Scope{
@@ -78,7 +206,7 @@ func ParseScope(scope string) (Scope, error) {
 			Class: resourceClass,
 			Name:  resourceName,
 		},
-		Actions: slices.Map(strings.Split(actions, ","), strings.TrimSpace),
+		Actions: actions,
 	}, nil
 }
 
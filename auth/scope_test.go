@@ -70,6 +70,39 @@ func TestParseScope(t *testing.T) {
 					Actions: []string{"pull"},
 				},
 			},
+			{
+				"repository:localhost:5000/path/to/repo:pull",
+				auth.Scope{
+					Resource: auth.Resource{
+						Type:  "repository",
+						Class: "",
+						Name:  "localhost:5000/path/to/repo",
+					},
+					Actions: []string{"pull"},
+				},
+			},
+			{
+				"registry:catalog:*",
+				auth.Scope{
+					Resource: auth.Resource{
+						Type:  "registry",
+						Class: "",
+						Name:  "catalog",
+					},
+					Actions: []string{"*"},
+				},
+			},
+			{
+				"repository:path/to/repo:pull,,push,",
+				auth.Scope{
+					Resource: auth.Resource{
+						Type:  "repository",
+						Class: "",
+						Name:  "path/to/repo",
+					},
+					Actions: []string{"pull", "push"},
+				},
+			},
 		}
 
 		for _, testCase := range testCases {
@@ -87,6 +120,10 @@ func TestParseScope(t *testing.T) {
 	t.Run("Error", func(t *testing.T) {
 		testCases := []string{
 			"repository : path/to/repo : pull , push ",
+			"repository:path/to/repo",
+			"repository:path/to/repo:",
+			"repository:path/to/repo:,",
+			"repository",
 		}
 
 		for _, testCase := range testCases {
@@ -139,6 +176,32 @@ func TestParseScopes(t *testing.T) {
 				nil,
 				nil,
 			},
+			{
+				[]string{"repository:foo/bar:pull,push", "registry:catalog:*"},
+				[]auth.Scope{
+					{
+						Resource: auth.Resource{Type: "repository", Name: "foo/bar"},
+						Actions:  []string{"pull", "push"},
+					},
+					{
+						Resource: auth.Resource{Type: "registry", Name: "catalog"},
+						Actions:  []string{"*"},
+					},
+				},
+			},
+			{
+				[]string{"repository:foo/bar:pull repository(plugin):baz:push", ""},
+				[]auth.Scope{
+					{
+						Resource: auth.Resource{Type: "repository", Name: "foo/bar"},
+						Actions:  []string{"pull"},
+					},
+					{
+						Resource: auth.Resource{Type: "repository", Class: "plugin", Name: "baz"},
+						Actions:  []string{"push"},
+					},
+				},
+			},
 		}
 
 		for _, testCase := range testCases {
@@ -153,3 +216,205 @@ func TestParseScopes(t *testing.T) {
 		}
 	})
 }
+
+func TestScopes_String_RoundTrip(t *testing.T) {
+	scopes, err := auth.ParseScopes([]string{
+		"repository:foo/bar:pull,push",
+		"repository(plugin):localhost:5000/baz:pull",
+		"registry:catalog:*",
+	})
+	require.NoError(t, err)
+
+	s := auth.Scopes(scopes).String()
+
+	assert.Equal(t, "repository:foo/bar:pull,push repository(plugin):localhost:5000/baz:pull registry:catalog:*", s)
+
+	actual, err := auth.ParseScopes([]string{s})
+	require.NoError(t, err)
+
+	assert.Equal(t, scopes, actual)
+}
+
+func TestResourceActions_ValidateScope(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		testCases := []string{
+			"repository:path/to/repo:pull,push",
+			"repository:path/to/repo:delete",
+			"registry:catalog:*",
+			"unknown:resource:anything",
+		}
+
+		for _, testCase := range testCases {
+			testCase := testCase
+
+			t.Run("", func(t *testing.T) {
+				scope, err := auth.ParseScope(testCase)
+				require.NoError(t, err)
+
+				err = auth.DefaultResourceActions.ValidateScope(scope)
+				require.NoError(t, err)
+			})
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		testCases := []string{
+			"registry:catalog:push",
+			"repository:path/to/repo:pull,search",
+		}
+
+		for _, testCase := range testCases {
+			testCase := testCase
+
+			t.Run("", func(t *testing.T) {
+				scope, err := auth.ParseScope(testCase)
+				require.NoError(t, err)
+
+				err = auth.DefaultResourceActions.ValidateScope(scope)
+				require.Error(t, err)
+
+				assert.ErrorIs(t, err, auth.ErrInvalidScope)
+			})
+		}
+	})
+}
+
+func TestMergeScopes(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		testCases := []struct {
+			name     string
+			scopes   []string
+			expected []auth.Scope
+		}{
+			{
+				name:     "Empty",
+				scopes:   nil,
+				expected: []auth.Scope{},
+			},
+			{
+				name:   "SameResource",
+				scopes: []string{"repository:foo:pull", "repository:bar:pull", "repository:foo:push,pull"},
+				expected: []auth.Scope{
+					{
+						Resource: auth.Resource{Type: "repository", Name: "foo"},
+						Actions:  []string{"pull", "push"},
+					},
+					{
+						Resource: auth.Resource{Type: "repository", Name: "bar"},
+						Actions:  []string{"pull"},
+					},
+				},
+			},
+			{
+				name:   "SameClass",
+				scopes: []string{"repository(plugin):foo:pull", "repository(plugin):foo:push"},
+				expected: []auth.Scope{
+					{
+						Resource: auth.Resource{Type: "repository", Class: "plugin", Name: "foo"},
+						Actions:  []string{"pull", "push"},
+					},
+				},
+			},
+			{
+				name:   "DifferentType",
+				scopes: []string{"repository:catalog:pull", "registry:catalog:*"},
+				expected: []auth.Scope{
+					{
+						Resource: auth.Resource{Type: "repository", Name: "catalog"},
+						Actions:  []string{"pull"},
+					},
+					{
+						Resource: auth.Resource{Type: "registry", Name: "catalog"},
+						Actions:  []string{"*"},
+					},
+				},
+			},
+		}
+
+		for _, testCase := range testCases {
+			testCase := testCase
+
+			t.Run(testCase.name, func(t *testing.T) {
+				scopes, err := auth.ParseScopes(testCase.scopes)
+				require.NoError(t, err)
+
+				actual, err := auth.MergeScopes(scopes)
+				require.NoError(t, err)
+
+				assert.Equal(t, testCase.expected, actual)
+			})
+		}
+	})
+
+	t.Run("ConflictingClasses", func(t *testing.T) {
+		testCases := [][]string{
+			{"repository(plugin):foo:pull", "repository:foo:pull"},
+			{"repository(plugin):foo:pull", "repository(image):foo:push"},
+		}
+
+		for _, testCase := range testCases {
+			testCase := testCase
+
+			t.Run("", func(t *testing.T) {
+				scopes, err := auth.ParseScopes(testCase)
+				require.NoError(t, err)
+
+				_, err = auth.MergeScopes(scopes)
+				require.ErrorIs(t, err, auth.ErrInvalidScope)
+			})
+		}
+	})
+}
+
+func TestStripRegistryHost(t *testing.T) {
+	testCases := []struct {
+		name     string
+		scope    string
+		expected auth.Resource
+	}{
+		{
+			name:     "WithHost",
+			scope:    "repository:registry.example.com/team/app:pull",
+			expected: auth.Resource{Type: "repository", Name: "team/app"},
+		},
+		{
+			name:     "WithoutHost",
+			scope:    "repository:team/app:pull",
+			expected: auth.Resource{Type: "repository", Name: "team/app"},
+		},
+		{
+			name:     "CaseInsensitive",
+			scope:    "repository:Registry.Example.com/team/app:pull",
+			expected: auth.Resource{Type: "repository", Name: "team/app"},
+		},
+		{
+			name:     "UnknownHost",
+			scope:    "repository:other.example.com/team/app:pull",
+			expected: auth.Resource{Type: "repository", Name: "other.example.com/team/app"},
+		},
+		{
+			name:     "HostOnly",
+			scope:    "repository:registry.example.com:pull",
+			expected: auth.Resource{Type: "repository", Name: "registry.example.com"},
+		},
+		{
+			name:     "NotRepository",
+			scope:    "registry:registry.example.com/catalog:*",
+			expected: auth.Resource{Type: "registry", Name: "registry.example.com/catalog"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			scope, err := auth.ParseScope(testCase.scope)
+			require.NoError(t, err)
+
+			actual := auth.StripRegistryHost([]auth.Scope{scope}, []string{"registry.example.com"})
+
+			require.Len(t, actual, 1)
+			assert.Equal(t, testCase.expected, actual[0].Resource)
+		})
+	}
+}
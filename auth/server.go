@@ -1,10 +1,16 @@
 package auth
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/schema"
 )
@@ -17,52 +23,468 @@ func init() {
 	decoder.IgnoreUnknownKeys(true)
 }
 
+// ErrInvalidRequest is returned when a request is malformed.
+var ErrInvalidRequest = errors.New("invalid request")
+
+// ErrUnsupportedGrantType is returned when an OAuth2 request uses an unknown grant type.
+var ErrUnsupportedGrantType = errors.New("unsupported grant type")
+
+// ErrInvalidGrant is returned when the credentials or the refresh token presented in an OAuth2 request are invalid.
+var ErrInvalidGrant = errors.New("invalid grant")
+
 // TokenServer implements the [Docker Registry v2 authentication] specification.
 //
 // [Docker Registry v2 authentication]: https://github.com/distribution/distribution/blob/main/docs/spec/auth/index.md
 type TokenServer struct {
 	Service TokenService
 	Logger  *slog.Logger
+
+	// ResourceActions restricts the actions clients may request for each resource type.
+	// Defaults to DefaultResourceActions.
+	ResourceActions ResourceActions
+
+	// MaxActionsPerScope rejects requests with a scope listing more actions than this (zero means no limit).
+	MaxActionsPerScope int
+
+	// MaxScopes rejects requests listing more scopes than this (zero means no limit),
+	// bounding the work of authorizers independently from the size limits of issued tokens.
+	MaxScopes int
+
+	// MaxAudiences rejects requests listing more service parameters (the audiences tokens are requested for) than this
+	// (zero means no limit). Multiple service parameters are only accepted as configured by MultipleServices.
+	MaxAudiences int
+
+	// MaxBatchEntries rejects batch token requests listing more entries than this (see BatchTokenHandler).
+	// Defaults to DefaultMaxBatchEntries.
+	MaxBatchEntries int
+
+	// RegistryHosts are stripped from repository names in requested scopes (see StripRegistryHost),
+	// so that authorization rules match whether or not clients include the registry host.
+	RegistryHosts []string
+
+	// RejectEmptyPassword rejects basic auth credentials and password grants with an empty password without consulting the authenticator.
+	//
+	// By default, empty passwords are passed to the authenticator.
+	// Basic auth credentials with both username and password empty are always treated as anonymous.
+	RejectEmptyPassword bool
+
+	// DPoPProofVerifier enables binding access tokens to a key presented in a DPoP proof.
+	DPoPProofVerifier DPoPProofVerifier
+
+	// RequireDPoP rejects requests without a DPoP proof.
+	// It has no effect unless a DPoPProofVerifier is configured.
+	RequireDPoP bool
+
+	// ExternalURL is the URL clients reach the server at (eg. https://auth.example.com behind a TLS terminating proxy).
+	// DPoP proofs are verified against it (with the path of the request appended).
+	//
+	// Defaults to the scheme of the connection and the Host header of the request.
+	ExternalURL *url.URL
+
+	// DefaultService is used when a request does not specify a service.
+	DefaultService string
+
+	// MultipleServices controls how requests with multiple service parameters are handled.
+	// Defaults to MultipleServicesReject.
+	MultipleServices string
+
+	// PermissionScopes lists the candidate scopes checked by PermissionsHandler.
+	PermissionScopes Scopes
+
+	// Realm is the realm advertised in the WWW-Authenticate challenge.
+	Realm string
+
+	// AnonymousDenial controls the response when an anonymous request is denied (ErrUnauthorized).
+	// Defaults to AnonymousDenialChallenge.
+	//
+	// Denied requests presenting credentials are always rejected with 403 Forbidden.
+	AnonymousDenial string
+
+	// HTMLErrors responds with a minimal HTML error page to clients accepting text/html (eg. browsers).
+	// The page includes the request ID, so users can report the failure.
+	// Other clients keep receiving the usual responses.
+	HTMLErrors bool
+
+	// HelpURL is linked from HTML error pages.
+	HelpURL string
+
+	// CacheControl overrides the Cache-Control header of token responses.
+	// By default, token responses are marked as non-cacheable (no-store), so proxies do not cache bearer tokens.
+	CacheControl string
+
+	// ResponseFields renames fields of token responses (eg. access_token to jwt) for registries expecting a non-standard envelope.
+	// Fields not listed keep the names defined by the specification.
+	ResponseFields map[string]string
+
+	// RetryAfter is advertised in the Retry-After header when a backend (eg. the token issuer) is unavailable.
+	// Defaults to DefaultRetryAfter.
+	RetryAfter time.Duration
+
+	// RateLimitedResponse controls the body of 429 Too Many Requests responses (see RateLimitedError).
+	// Defaults to RateLimitedResponsePlain.
+	RateLimitedResponse string
+
+	// ReadinessCheckers are checked by ReadyHandler (keyed by component name).
+	ReadinessCheckers map[string]Checker
+}
+
+// DefaultRetryAfter is the default value of the Retry-After header sent with 503 Service Unavailable responses.
+const DefaultRetryAfter = 30 * time.Second
+
+// Responses to denied anonymous requests.
+const (
+	// AnonymousDenialChallenge responds with 401 Unauthorized and a WWW-Authenticate challenge prompting clients to log in.
+	AnonymousDenialChallenge = "challenge"
+
+	// AnonymousDenialForbidden responds with 403 Forbidden.
+	AnonymousDenialForbidden = "forbidden"
+)
+
+// Behaviors for requests with multiple service parameters.
+const (
+	// MultipleServicesReject rejects the request as invalid.
+	MultipleServicesReject = "reject"
+
+	// MultipleServicesFirst uses the first service parameter.
+	MultipleServicesFirst = "first"
+
+	// MultipleServicesMatching accepts the request if every service parameter is the same.
+	MultipleServicesMatching = "matching"
+)
+
+func (s TokenServer) service(service string) string {
+	if service == "" {
+		return s.DefaultService
+	}
+
+	return service
+}
+
+// requestService returns the service requested in a parsed form, applying MultipleServices.
+func (s TokenServer) requestService(form url.Values) (string, error) {
+	services := form["service"]
+
+	if s.MaxAudiences > 0 && len(services) > s.MaxAudiences {
+		return "", fmt.Errorf("%w: more than %d service parameters", ErrInvalidRequest, s.MaxAudiences)
+	}
+
+	if len(services) > 1 {
+		switch s.MultipleServices {
+		case MultipleServicesFirst:
+
+		case MultipleServicesMatching:
+			for _, service := range services[1:] {
+				if service != services[0] {
+					return "", fmt.Errorf("%w: conflicting service parameters", ErrInvalidRequest)
+				}
+			}
+
+		default:
+			return "", fmt.Errorf("%w: multiple service parameters", ErrInvalidRequest)
+		}
+	}
+
+	var service string
+
+	if len(services) > 0 {
+		service = services[0]
+	}
+
+	return s.service(service), nil
+}
+
+// checkScopes normalizes requested scopes and checks them against the limits of the server (see ScopeLimits).
+func (s TokenServer) checkScopes(scopes []Scope) ([]Scope, error) {
+	limits := ScopeLimits{
+		ResourceActions:    s.ResourceActions,
+		MaxScopes:          s.MaxScopes,
+		MaxActionsPerScope: s.MaxActionsPerScope,
+		RegistryHosts:      s.RegistryHosts,
+	}
+
+	return limits.CheckScopes(scopes)
+}
+
+// errorResponse is an error response body as defined in the [OAuth 2.0 Error Response] specification.
+//
+// [OAuth 2.0 Error Response]: https://datatracker.ietf.org/doc/html/rfc6749#section-5.2
+type errorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+
+	// RetryAfter is the number of seconds after which a rate limited request may be retried.
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+func writeErrorResponse(w http.ResponseWriter, status int, response errorResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (s TokenServer) handleError(err error, w http.ResponseWriter, r *http.Request) {
+	status, response := errorFor(err)
+
+	if errors.Is(err, ErrUnauthorized) {
+		// Prompting clients for credentials only makes sense if they did not present any
+		if s.AnonymousDenial == AnonymousDenialForbidden || hasCredentials(r) {
+			status = http.StatusForbidden
+		} else {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", s.Realm))
+		}
+	}
+
+	if status == http.StatusServiceUnavailable {
+		retryAfter := s.RetryAfter
+		if retryAfter <= 0 {
+			retryAfter = DefaultRetryAfter
+		}
+
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+	}
+
+	var rateLimitedErr RateLimitedError
+	if errors.As(err, &rateLimitedErr) {
+		retryAfter := rateLimitedErr.retryAfterSeconds()
+
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+
+		if s.RateLimitedResponse == RateLimitedResponseJSON {
+			response = &errorResponse{
+				Error:            "rate_limited",
+				ErrorDescription: rateLimitedErr.Error(),
+				RetryAfter:       retryAfter,
+			}
+		}
+	}
+
+	if s.HTMLErrors && acceptsHTML(r) {
+		s.writeErrorPage(w, r, status, response)
+
+		return
+	}
+
+	writeError(w, status, response)
+}
+
+// statusClientClosedRequest is a non-standard status code (popularized by nginx) used when the client cancels the request.
+const statusClientClosedRequest = 499
+
+// errorFor maps err to an HTTP status code and an optional OAuth2 style error response.
+//
+// A nil response means the error is reported as plain text.
+func errorFor(err error) (int, *errorResponse) {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return statusClientClosedRequest, nil
+
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, nil
+
+	case errors.Is(err, ErrIssuerUnavailable):
+		return http.StatusServiceUnavailable, nil
+
+	case errors.Is(err, ErrRateLimited):
+		return http.StatusTooManyRequests, nil
+
+	// Checked before authentication failures: invalid grants wrap them
+	// The description is fixed: authentication errors may reveal details (eg. disabled accounts) clients should not learn
+	case errors.Is(err, ErrInvalidGrant):
+		return http.StatusBadRequest, &errorResponse{
+			Error:            "invalid_grant",
+			ErrorDescription: "invalid credentials or refresh token",
+		}
+
+	case errors.Is(err, ErrUnauthorized), errors.Is(err, ErrAuthenticationFailed):
+		return http.StatusUnauthorized, nil
+
+	case errors.Is(err, ErrInvalidDPoPProof):
+		return http.StatusBadRequest, &errorResponse{
+			Error:            "invalid_dpop_proof",
+			ErrorDescription: err.Error(),
+		}
+
+	case errors.Is(err, ErrInvalidRequest):
+		return http.StatusBadRequest, &errorResponse{
+			Error:            "invalid_request",
+			ErrorDescription: err.Error(),
+		}
+
+	case errors.Is(err, ErrInvalidScope):
+		return http.StatusBadRequest, &errorResponse{
+			Error:            "invalid_scope",
+			ErrorDescription: err.Error(),
+		}
+
+	case errors.Is(err, ErrUnsupportedGrantType):
+		return http.StatusBadRequest, &errorResponse{
+			Error:            "unsupported_grant_type",
+			ErrorDescription: err.Error(),
+		}
+	}
+
+	return http.StatusInternalServerError, nil
 }
 
-func handleError(err error, w http.ResponseWriter) {
-	if errors.Is(err, ErrAuthenticationFailed) {
-		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+func writeError(w http.ResponseWriter, status int, response *errorResponse) {
+	if response != nil {
+		writeErrorResponse(w, status, *response)
 
 		return
 	}
 
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	http.Error(w, statusText(status), status)
+}
+
+func statusText(status int) string {
+	if status == statusClientClosedRequest {
+		return "Client Closed Request"
+	}
+
+	return http.StatusText(status)
 }
 
 // TokenHandler implements the [Docker Registry v2 authentication] specification.
 //
 // [Docker Registry v2 authentication]: https://github.com/distribution/distribution/blob/main/docs/spec/auth/token.md
 func (s TokenServer) TokenHandler(w http.ResponseWriter, r *http.Request) {
-	request, err := decodeTokenRequest(r)
+	s.preventCaching(w)
+
+	request, err := decodeTokenRequest(r, s.checkScopes)
 	if err != nil {
 		s.Logger.Error("failed to decode request", slog.Any("error", err))
-		handleError(err, w)
+		s.handleError(err, w, r)
+		return
+	}
+
+	request.Service, err = s.requestService(r.URL.Query())
+	if err != nil {
+		s.handleError(err, w, r)
+		return
+	}
+
+	if s.RejectEmptyPassword && !request.Anonymous && request.BearerToken == "" && request.Password == "" {
+		s.handleError(ErrAuthenticationFailed, w, r)
+		return
+	}
+
+	request.DPoPKeyThumbprint, err = s.verifyDPoPProof(r)
+	if err != nil {
+		s.handleError(err, w, r)
 		return
 	}
 
 	response, err := s.Service.TokenHandler(r.Context(), request)
 	if err != nil {
-		handleError(err, w)
+		s.handleError(err, w, r)
 		return
 	}
 
+	s.writeTokenResponse(w, response)
+}
+
+// preventCaching marks token responses (including errors) as non-cacheable as required by RFC 6749.
+func (s TokenServer) preventCaching(w http.ResponseWriter) {
+	if s.CacheControl != "" {
+		w.Header().Set("Cache-Control", s.CacheControl)
+
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+}
+
+func (s TokenServer) writeTokenResponse(w http.ResponseWriter, response any) {
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(response)
+
+	if len(s.ResponseFields) == 0 {
+		_ = json.NewEncoder(w).Encode(response)
+
+		return
+	}
+
+	envelope, err := renameFields(response, s.ResponseFields)
+	if err != nil {
+		s.Logger.Error("failed to rename response fields", slog.Any("error", err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(envelope)
+}
+
+// renameFields converts v to a JSON object with fields renamed according to names.
+func renameFields(v any, names map[string]string) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := make(map[string]json.RawMessage, len(fields))
+
+	for name, value := range fields {
+		if newName, ok := names[name]; ok && newName != "" {
+			name = newName
+		}
+
+		envelope[name] = value
+	}
+
+	return envelope, nil
 }
 
-// TODO: error handling 400
-func decodeTokenRequest(r *http.Request) (TokenRequest, error) {
+func (s TokenServer) verifyDPoPProof(r *http.Request) (string, error) {
+	if s.DPoPProofVerifier == nil {
+		return "", nil
+	}
+
+	proof := r.Header.Get(DPoPHeader)
+	if proof == "" {
+		if s.RequireDPoP {
+			return "", fmt.Errorf("%w: missing proof", ErrInvalidDPoPProof)
+		}
+
+		return "", nil
+	}
+
+	uri := s.requestURL(r).String()
+
+	return s.DPoPProofVerifier.VerifyDPoPProof(r.Context(), proof, r.Method, uri)
+}
+
+// requestURL returns the URL (without query) a client sent r to.
+func (s TokenServer) requestURL(r *http.Request) *url.URL {
+	if s.ExternalURL != nil {
+		return &url.URL{
+			Scheme: s.ExternalURL.Scheme,
+			Host:   s.ExternalURL.Host,
+			Path:   strings.TrimSuffix(s.ExternalURL.Path, "/") + r.URL.Path,
+		}
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return &url.URL{Scheme: scheme, Host: r.Host, Path: r.URL.Path}
+}
+
+func decodeTokenRequest(r *http.Request, checkScopes func([]Scope) ([]Scope, error)) (TokenRequest, error) {
 	var rawRequest rawTokenRequest
 
 	err := decoder.Decode(&rawRequest, r.URL.Query())
 	if err != nil {
-		return TokenRequest{}, err
+		return TokenRequest{}, fmt.Errorf("%w: %s", ErrInvalidRequest, err)
 	}
 
 	scopes, err := ParseScopes(rawRequest.Scopes)
@@ -70,14 +492,37 @@ func decodeTokenRequest(r *http.Request) (TokenRequest, error) {
 		return TokenRequest{}, err
 	}
 
+	scopes, err = checkScopes(scopes)
+	if err != nil {
+		return TokenRequest{}, err
+	}
+
+	scopes, err = MergeScopes(scopes)
+	if err != nil {
+		return TokenRequest{}, err
+	}
+
 	request := TokenRequest{
-		Service:  rawRequest.Service,
-		ClientID: rawRequest.ClientID,
-		Offline:  rawRequest.Offline,
-		Scopes:   scopes,
+		Service:   rawRequest.Service,
+		ClientID:  rawRequest.ClientID,
+		Offline:   rawRequest.Offline,
+		Scopes:    scopes,
+		NotBefore: notBefore(rawRequest.NotBefore),
+	}
+
+	if token, ok := bearerToken(r); ok {
+		request.BearerToken = token
+
+		return request, nil
 	}
 
 	username, password, ok := r.BasicAuth()
+
+	// Some clients send empty credentials for anonymous requests
+	if username == "" && password == "" {
+		ok = false
+	}
+
 	request.Anonymous = !ok
 	request.Username = username
 	request.Password = password
@@ -85,46 +530,95 @@ func decodeTokenRequest(r *http.Request) (TokenRequest, error) {
 	return request, nil
 }
 
+// bearerToken returns the token from an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+
+	return token, token != ""
+}
+
+// hasCredentials reports whether r presents credentials (as opposed to an anonymous request).
+func hasCredentials(r *http.Request) bool {
+	if _, ok := bearerToken(r); ok {
+		return true
+	}
+
+	if username, password, ok := r.BasicAuth(); ok && (username != "" || password != "") {
+		return true
+	}
+
+	// Every OAuth2 grant authenticates the client
+	return r.PostForm.Get("grant_type") != ""
+}
+
 type rawTokenRequest struct {
-	Service  string   `schema:"service"`
-	ClientID string   `schema:"client_id"`
-	Offline  bool     `schema:"offline_token"`
-	Scopes   []string `schema:"scope"`
+	Service   string   `schema:"service"`
+	ClientID  string   `schema:"client_id"`
+	Offline   bool     `schema:"offline_token"`
+	Scopes    []string `schema:"scope"`
+	NotBefore int64    `schema:"not_before"`
 }
 
 // OAuth2Handler implements the [Docker Registry v2 OAuth2 authentication] specification.
 //
 // [Docker Registry v2 OAuth2 authentication]: https://github.com/distribution/distribution/blob/main/docs/spec/auth/oauth.md
 func (s TokenServer) OAuth2Handler(w http.ResponseWriter, r *http.Request) {
-	request, err := decodeOAuth2Request(r)
+	s.preventCaching(w)
+
+	request, err := decodeOAuth2Request(r, s.checkScopes)
 	if err != nil {
 		s.Logger.Error("failed to decode request", slog.Any("error", err))
-		handleError(err, w)
+		s.handleError(err, w, r)
+		return
+	}
+
+	request.Service, err = s.requestService(r.Form)
+	if err != nil {
+		s.handleError(err, w, r)
+		return
+	}
+
+	if s.RejectEmptyPassword && request.GrantType == GrantTypePassword && request.Username != "" && request.Password == "" {
+		s.handleError(fmt.Errorf("%w: %w", ErrInvalidGrant, ErrAuthenticationFailed), w, r)
+		return
+	}
+
+	request.DPoPKeyThumbprint, err = s.verifyDPoPProof(r)
+	if err != nil {
+		s.handleError(err, w, r)
 		return
 	}
 
 	response, err := s.Service.OAuth2Handler(r.Context(), request)
 	if err != nil {
-		handleError(err, w)
+		// RFC 6749 reports invalid credentials and refresh tokens as invalid grants
+		if errors.Is(err, ErrAuthenticationFailed) {
+			err = fmt.Errorf("%w: %w", ErrInvalidGrant, err)
+		}
+
+		s.handleError(err, w, r)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(response)
+	s.writeTokenResponse(w, response)
 }
 
-// TODO: error handling 400
-func decodeOAuth2Request(r *http.Request) (OAuth2Request, error) {
+func decodeOAuth2Request(r *http.Request, checkScopes func([]Scope) ([]Scope, error)) (OAuth2Request, error) {
 	err := r.ParseForm()
 	if err != nil {
-		return OAuth2Request{}, err
+		return OAuth2Request{}, fmt.Errorf("%w: %s", ErrInvalidRequest, err)
 	}
 
 	var rawRequest rawOAuth2Request
 
 	err = decoder.Decode(&rawRequest, r.PostForm)
 	if err != nil {
-		return OAuth2Request{}, err
+		return OAuth2Request{}, fmt.Errorf("%w: %s", ErrInvalidRequest, err)
 	}
 
 	scopes, err := ParseScopes(rawRequest.Scopes)
@@ -132,29 +626,80 @@ func decodeOAuth2Request(r *http.Request) (OAuth2Request, error) {
 		return OAuth2Request{}, err
 	}
 
+	scopes, err = checkScopes(scopes)
+	if err != nil {
+		return OAuth2Request{}, err
+	}
+
+	scopes, err = MergeScopes(scopes)
+	if err != nil {
+		return OAuth2Request{}, err
+	}
+
+	accessType, err := oauth2AccessType(rawRequest.AccessType, rawRequest.Offline)
+	if err != nil {
+		return OAuth2Request{}, err
+	}
+
 	request := OAuth2Request{
 		GrantType:    rawRequest.GrantType,
 		Service:      rawRequest.Service,
 		ClientID:     rawRequest.ClientID,
-		AccessType:   rawRequest.AccessType,
+		AccessType:   accessType,
 		Scopes:       scopes,
 		Username:     rawRequest.Username,
 		Password:     rawRequest.Password,
 		RefreshToken: rawRequest.RefreshToken,
+		Assertion:    rawRequest.Assertion,
+		NotBefore:    notBefore(rawRequest.NotBefore),
 	}
 
 	return request, nil
 }
 
+// notBefore converts the not_before parameter (seconds since the Unix epoch) requesting a scheduled token.
+func notBefore(v int64) time.Time {
+	if v <= 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(v, 0)
+}
+
+// oauth2AccessType reconciles the access_type parameter with offline_token.
+//
+// offline_token is defined for the GET endpoint, but some clients send it to the OAuth2 endpoint as well.
+// offline_token=true is equivalent to access_type=offline and offline_token=false to access_type=online.
+func oauth2AccessType(accessType string, offline *bool) (string, error) {
+	if offline == nil {
+		return accessType, nil
+	}
+
+	offlineAccessType := AccessTypeOnline
+	if *offline {
+		offlineAccessType = AccessTypeOffline
+	}
+
+	if accessType != "" && accessType != offlineAccessType {
+		return "", fmt.Errorf("%w: access_type %q conflicts with offline_token", ErrInvalidRequest, accessType)
+	}
+
+	return offlineAccessType, nil
+}
+
 type rawOAuth2Request struct {
 	GrantType string `schema:"grant_type"`
 
 	Service    string   `schema:"service"`
 	ClientID   string   `schema:"client_id"`
 	AccessType string   `schema:"access_type"`
+	Offline    *bool    `schema:"offline_token"`
 	Scopes     []string `schema:"scope"`
 
 	Username     string `schema:"username"`
 	Password     string `schema:"password"`
 	RefreshToken string `schema:"refresh_token"`
+	Assertion    string `schema:"assertion"`
+
+	NotBefore int64 `schema:"not_before"`
 }
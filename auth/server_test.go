@@ -0,0 +1,1536 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTokenServerStub() TokenServer {
+	return TokenServer{
+		Service: newTokenServiceStub(),
+		Logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+func TestTokenServer_TokenHandler_InvalidScope(t *testing.T) {
+	server := newTokenServerStub()
+
+	query := url.Values{
+		"service": {"service.example.com"},
+		"scope":   {"registry:catalog:push"},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/token?"+query.Encode(), nil)
+	req.SetBasicAuth("user", "password")
+
+	rec := httptest.NewRecorder()
+
+	server.TokenHandler(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	var response errorResponse
+
+	err := json.NewDecoder(rec.Body).Decode(&response)
+	require.NoError(t, err)
+
+	assert.Equal(t, "invalid_scope", response.Error)
+}
+
+func TestTokenServer_OAuth2Handler_InvalidScope(t *testing.T) {
+	server := newTokenServerStub()
+
+	form := url.Values{
+		"grant_type": {GrantTypePassword},
+		"service":    {"service.example.com"},
+		"client_id":  {"client"},
+		"username":   {"user"},
+		"password":   {"password"},
+		"scope":      {"registry:catalog:push"},
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rec := httptest.NewRecorder()
+
+	server.OAuth2Handler(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	var response errorResponse
+
+	err := json.NewDecoder(rec.Body).Decode(&response)
+	require.NoError(t, err)
+
+	assert.Equal(t, "invalid_scope", response.Error)
+}
+
+func TestTokenServer_TokenHandler_EmptyCredentials(t *testing.T) {
+	query := url.Values{
+		"service": {"service.example.com"},
+	}
+
+	doRequest := func(server TokenServer, username string, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/token?"+query.Encode(), nil)
+		req.SetBasicAuth(username, password)
+
+		rec := httptest.NewRecorder()
+
+		server.TokenHandler(rec, req)
+
+		return rec
+	}
+
+	decodeResponse := func(t *testing.T, rec *httptest.ResponseRecorder) TokenResponse {
+		t.Helper()
+
+		var response TokenResponse
+
+		err := json.NewDecoder(rec.Body).Decode(&response)
+		require.NoError(t, err)
+
+		return response
+	}
+
+	t.Run("EmptyPassword", func(t *testing.T) {
+		rec := doRequest(newTokenServerStub(), "user", "")
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "access:user", decodeResponse(t, rec).Token)
+	})
+
+	t.Run("EmptyPasswordRejected", func(t *testing.T) {
+		server := newTokenServerStub()
+		server.RejectEmptyPassword = true
+
+		rec := doRequest(server, "user", "")
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("EmptyEverything", func(t *testing.T) {
+		server := newTokenServerStub()
+		server.RejectEmptyPassword = true
+
+		rec := doRequest(server, "", "")
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "access:anonymous", decodeResponse(t, rec).Token)
+	})
+}
+
+func TestTokenServer_OAuth2Handler_EmptyPassword(t *testing.T) {
+	form := url.Values{
+		"grant_type": {GrantTypePassword},
+		"service":    {"service.example.com"},
+		"client_id":  {"client"},
+		"username":   {"user"},
+	}
+
+	doRequest := func(server TokenServer) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rec := httptest.NewRecorder()
+
+		server.OAuth2Handler(rec, req)
+
+		return rec
+	}
+
+	t.Run("EmptyPassword", func(t *testing.T) {
+		rec := doRequest(newTokenServerStub())
+
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var response OAuth2Response
+
+		err := json.NewDecoder(rec.Body).Decode(&response)
+		require.NoError(t, err)
+
+		assert.Equal(t, "access:user", response.Token)
+	})
+
+	t.Run("EmptyPasswordRejected", func(t *testing.T) {
+		server := newTokenServerStub()
+		server.RejectEmptyPassword = true
+
+		rec := doRequest(server)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		var response errorResponse
+
+		err := json.NewDecoder(rec.Body).Decode(&response)
+		require.NoError(t, err)
+
+		assert.Equal(t, "invalid_grant", response.Error)
+	})
+}
+
+type dpopProofVerifierStub struct{}
+
+func (dpopProofVerifierStub) VerifyDPoPProof(_ context.Context, proof string, method string, uri string) (string, error) {
+	if proof != "valid" || method != http.MethodGet || uri != "http://example.com/token" {
+		return "", ErrInvalidDPoPProof
+	}
+
+	return "thumbprint", nil
+}
+
+func TestTokenServer_TokenHandler_DPoP(t *testing.T) {
+	server := newTokenServerStub()
+	server.DPoPProofVerifier = dpopProofVerifierStub{}
+	server.RequireDPoP = true
+
+	query := url.Values{
+		"service": {"service.example.com"},
+	}
+
+	doRequest := func(proof string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/token?"+query.Encode(), nil)
+		req.SetBasicAuth("user", "password")
+
+		if proof != "" {
+			req.Header.Set(DPoPHeader, proof)
+		}
+
+		rec := httptest.NewRecorder()
+
+		server.TokenHandler(rec, req)
+
+		return rec
+	}
+
+	t.Run("ValidProof", func(t *testing.T) {
+		rec := doRequest("valid")
+
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var response TokenResponse
+
+		err := json.NewDecoder(rec.Body).Decode(&response)
+		require.NoError(t, err)
+
+		assert.Equal(t, TokenTypeDPoP, response.TokenType)
+		assert.Equal(t, "access:user;jkt=thumbprint", response.Token)
+	})
+
+	for name, proof := range map[string]string{"InvalidProof": "invalid", "MissingProof": ""} {
+		proof := proof
+
+		t.Run(name, func(t *testing.T) {
+			rec := doRequest(proof)
+
+			require.Equal(t, http.StatusBadRequest, rec.Code)
+
+			var response errorResponse
+
+			err := json.NewDecoder(rec.Body).Decode(&response)
+			require.NoError(t, err)
+
+			assert.Equal(t, "invalid_dpop_proof", response.Error)
+		})
+	}
+
+	t.Run("ExternalURL", func(t *testing.T) {
+		server := server
+		server.ExternalURL = &url.URL{Scheme: "http", Host: "example.com"}
+
+		req := httptest.NewRequest(http.MethodGet, "http://internal.example.com:8080/token?"+query.Encode(), nil)
+		req.SetBasicAuth("user", "password")
+		req.Header.Set(DPoPHeader, "valid")
+
+		rec := httptest.NewRecorder()
+
+		server.TokenHandler(rec, req)
+
+		require.Equal(t, http.StatusOK, rec.Code)
+	})
+}
+
+type tokenServiceRecorder struct {
+	TokenService
+
+	tokenRequests *[]TokenRequest
+}
+
+func (s tokenServiceRecorder) TokenHandler(ctx context.Context, r TokenRequest) (TokenResponse, error) {
+	*s.tokenRequests = append(*s.tokenRequests, r)
+
+	return s.TokenService.TokenHandler(ctx, r)
+}
+
+func TestTokenServer_TokenHandler_DefaultService(t *testing.T) {
+	var requests []TokenRequest
+
+	server := newTokenServerStub()
+	server.Service = tokenServiceRecorder{
+		TokenService:  server.Service,
+		tokenRequests: &requests,
+	}
+	server.DefaultService = "default.example.com"
+
+	t.Run("Missing", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/token", nil)
+		req.SetBasicAuth("user", "password")
+
+		rec := httptest.NewRecorder()
+
+		server.TokenHandler(rec, req)
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.NotEmpty(t, requests)
+		assert.Equal(t, "default.example.com", requests[len(requests)-1].Service)
+	})
+
+	t.Run("Provided", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/token?service=service.example.com", nil)
+		req.SetBasicAuth("user", "password")
+
+		rec := httptest.NewRecorder()
+
+		server.TokenHandler(rec, req)
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.NotEmpty(t, requests)
+		assert.Equal(t, "service.example.com", requests[len(requests)-1].Service)
+	})
+}
+
+func TestTokenServer_TokenHandler_MultipleServices(t *testing.T) {
+	testCases := []struct {
+		name             string
+		multipleServices string
+		services         []string
+		expectedStatus   int
+		expectedService  string
+	}{
+		{
+			name:             "Reject",
+			multipleServices: MultipleServicesReject,
+			services:         []string{"service.example.com", "service.example.com"},
+			expectedStatus:   http.StatusBadRequest,
+		},
+		{
+			name:           "RejectByDefault",
+			services:       []string{"service.example.com", "other.example.com"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:             "First",
+			multipleServices: MultipleServicesFirst,
+			services:         []string{"service.example.com", "other.example.com"},
+			expectedStatus:   http.StatusOK,
+			expectedService:  "service.example.com",
+		},
+		{
+			name:             "Matching",
+			multipleServices: MultipleServicesMatching,
+			services:         []string{"service.example.com", "service.example.com"},
+			expectedStatus:   http.StatusOK,
+			expectedService:  "service.example.com",
+		},
+		{
+			name:             "MatchingConflict",
+			multipleServices: MultipleServicesMatching,
+			services:         []string{"service.example.com", "other.example.com"},
+			expectedStatus:   http.StatusBadRequest,
+		},
+		{
+			name:             "Single",
+			multipleServices: MultipleServicesReject,
+			services:         []string{"service.example.com"},
+			expectedStatus:   http.StatusOK,
+			expectedService:  "service.example.com",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			var requests []TokenRequest
+
+			server := newTokenServerStub()
+			server.Service = tokenServiceRecorder{
+				TokenService:  server.Service,
+				tokenRequests: &requests,
+			}
+			server.MultipleServices = testCase.multipleServices
+
+			query := url.Values{"service": testCase.services}
+
+			req := httptest.NewRequest(http.MethodGet, "/token?"+query.Encode(), nil)
+			req.SetBasicAuth("user", "password")
+
+			rec := httptest.NewRecorder()
+
+			server.TokenHandler(rec, req)
+
+			require.Equal(t, testCase.expectedStatus, rec.Code)
+
+			if testCase.expectedStatus != http.StatusOK {
+				var response errorResponse
+
+				err := json.NewDecoder(rec.Body).Decode(&response)
+				require.NoError(t, err)
+
+				assert.Equal(t, "invalid_request", response.Error)
+				assert.Empty(t, requests)
+
+				return
+			}
+
+			require.Len(t, requests, 1)
+			assert.Equal(t, testCase.expectedService, requests[0].Service)
+		})
+	}
+}
+
+func TestTokenServer_OAuth2Handler_MultipleServices(t *testing.T) {
+	doRequest := func(multipleServices string) *httptest.ResponseRecorder {
+		form := url.Values{
+			"grant_type": {"password"},
+			"service":    {"service.example.com", "other.example.com"},
+			"client_id":  {"client"},
+			"username":   {"user"},
+			"password":   {"password"},
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rec := httptest.NewRecorder()
+
+		server := newTokenServerStub()
+		server.MultipleServices = multipleServices
+
+		server.OAuth2Handler(rec, req)
+
+		return rec
+	}
+
+	assert.Equal(t, http.StatusBadRequest, doRequest(MultipleServicesReject).Code)
+	assert.Equal(t, http.StatusBadRequest, doRequest(MultipleServicesMatching).Code)
+	assert.Equal(t, http.StatusOK, doRequest(MultipleServicesFirst).Code)
+}
+
+type denyAnonymousAuthorizerStub struct{}
+
+func (denyAnonymousAuthorizerStub) Authorize(_ context.Context, subject Subject, requestedScopes []Scope) ([]Scope, error) {
+	if subject == nil {
+		return nil, ErrUnauthorized
+	}
+
+	return requestedScopes, nil
+}
+
+func TestTokenServer_TokenHandler_AnonymousDenial(t *testing.T) {
+	service := newTokenServiceStub()
+	service.Authorizer = denyAnonymousAuthorizerStub{}
+
+	doRequest := func(server TokenServer) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/token?service=service.example.com&scope=repository:foo:pull", nil)
+
+		rec := httptest.NewRecorder()
+
+		server.TokenHandler(rec, req)
+
+		return rec
+	}
+
+	t.Run("Challenge", func(t *testing.T) {
+		server := newTokenServerStub()
+		server.Service = service
+		server.Realm = "registry.example.com"
+
+		rec := doRequest(server)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, `Basic realm="registry.example.com"`, rec.Header().Get("WWW-Authenticate"))
+	})
+
+	t.Run("Forbidden", func(t *testing.T) {
+		server := newTokenServerStub()
+		server.Service = service
+		server.Realm = "registry.example.com"
+		server.AnonymousDenial = AnonymousDenialForbidden
+
+		rec := doRequest(server)
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Empty(t, rec.Header().Get("WWW-Authenticate"))
+	})
+}
+
+func TestTokenServer_AuthenticatedDenial(t *testing.T) {
+	service := newTokenServiceStub()
+
+	// Subjects without the attribute are denied scheduled tokens
+	service.ScheduledTokens = ScheduledTokens{
+		MaxDelay:          24 * time.Hour,
+		SubjectAttributes: map[string]string{"role": "ci"},
+	}
+
+	server := newTokenServerStub()
+	server.Service = service
+	server.Realm = "registry.example.com"
+
+	notBefore := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+
+	t.Run("TokenHandler", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/token?service=service.example.com&scope=repository:foo:pull&not_before="+notBefore, nil)
+		req.SetBasicAuth("user", "password")
+
+		rec := httptest.NewRecorder()
+
+		server.TokenHandler(rec, req)
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Empty(t, rec.Header().Get("WWW-Authenticate"))
+	})
+
+	t.Run("OAuth2Handler", func(t *testing.T) {
+		form := url.Values{
+			"grant_type": {GrantTypePassword},
+			"service":    {"service.example.com"},
+			"client_id":  {"client"},
+			"username":   {"user"},
+			"password":   {"password"},
+			"scope":      {"repository:foo:pull"},
+			"not_before": {notBefore},
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rec := httptest.NewRecorder()
+
+		server.OAuth2Handler(rec, req)
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Empty(t, rec.Header().Get("WWW-Authenticate"))
+	})
+}
+
+func TestTokenServer_TokenHandler_Canceled(t *testing.T) {
+	server := newTokenServerStub()
+	server.Service = canceledTokenServiceStub{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req := httptest.NewRequest(http.MethodGet, "/token?service=service.example.com", nil).WithContext(ctx)
+	req.SetBasicAuth("user", "password")
+
+	rec := httptest.NewRecorder()
+
+	server.TokenHandler(rec, req)
+
+	assert.Equal(t, statusClientClosedRequest, rec.Code)
+}
+
+type canceledTokenServiceStub struct {
+	TokenService
+}
+
+func (canceledTokenServiceStub) TokenHandler(ctx context.Context, _ TokenRequest) (TokenResponse, error) {
+	return TokenResponse{}, ctx.Err()
+}
+
+type rateLimitedTokenServiceStub struct {
+	TokenService
+}
+
+func (rateLimitedTokenServiceStub) TokenHandler(_ context.Context, _ TokenRequest) (TokenResponse, error) {
+	return TokenResponse{}, RateLimitedError{RetryAfter: 1500 * time.Millisecond}
+}
+
+func TestTokenServer_TokenHandler_RateLimited(t *testing.T) {
+	doRequest := func(server TokenServer) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/token?service=service.example.com&scope=repository:foo:pull", nil)
+		req.SetBasicAuth("user", "password")
+
+		rec := httptest.NewRecorder()
+
+		server.TokenHandler(rec, req)
+
+		return rec
+	}
+
+	server := newTokenServerStub()
+	server.Service = rateLimitedTokenServiceStub{}
+
+	t.Run("Plain", func(t *testing.T) {
+		rec := doRequest(server)
+
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "2", rec.Header().Get("Retry-After"), "Retry-After should be rounded up to whole seconds")
+		assert.Equal(t, "Too Many Requests\n", rec.Body.String())
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		server := server
+		server.RateLimitedResponse = RateLimitedResponseJSON
+
+		rec := doRequest(server)
+
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "2", rec.Header().Get("Retry-After"))
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"error":"rate_limited","error_description":"rate limited: retry in 2 seconds","retry_after":2}`, rec.Body.String())
+	})
+}
+
+func TestTokenServer_TokenHandler_HTMLErrors(t *testing.T) {
+	server := newTokenServerStub()
+	server.HTMLErrors = true
+	server.HelpURL = "https://help.example.com"
+
+	doRequest := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/token?service=service.example.com&scope=registry:catalog:push", nil)
+		req.SetBasicAuth("user", "password")
+		req.Header.Set("Accept", accept)
+
+		rec := httptest.NewRecorder()
+
+		RequestIDMiddleware(http.HandlerFunc(server.TokenHandler)).ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	t.Run("HTML", func(t *testing.T) {
+		rec := doRequest("text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+
+		body := rec.Body.String()
+
+		assert.Contains(t, body, rec.Header().Get(RequestIDHeader))
+		assert.Contains(t, body, `href="https://help.example.com"`)
+	})
+
+	testCases := map[string]string{
+		"JSON":         "application/json",
+		"Wildcard":     "*/*",
+		"HTMLRejected": "text/html;q=0, application/json",
+	}
+
+	for name, accept := range testCases {
+		accept := accept
+
+		t.Run(name, func(t *testing.T) {
+			rec := doRequest(accept)
+
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+			var response errorResponse
+
+			err := json.NewDecoder(rec.Body).Decode(&response)
+			require.NoError(t, err)
+
+			assert.Equal(t, "invalid_scope", response.Error)
+		})
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		server := newTokenServerStub()
+
+		req := httptest.NewRequest(http.MethodGet, "/token?service=service.example.com&scope=registry:catalog:push", nil)
+		req.SetBasicAuth("user", "password")
+		req.Header.Set("Accept", "text/html")
+
+		rec := httptest.NewRecorder()
+
+		server.TokenHandler(rec, req)
+
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	})
+}
+
+func TestTokenServer_TokenHandler_ResponseFields(t *testing.T) {
+	server := newTokenServerStub()
+	server.ResponseFields = map[string]string{
+		"access_token": "jwt",
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/token?service=service.example.com", nil)
+	req.SetBasicAuth("user", "password")
+
+	rec := httptest.NewRecorder()
+
+	server.TokenHandler(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var response map[string]any
+
+	err := json.NewDecoder(rec.Body).Decode(&response)
+	require.NoError(t, err)
+
+	assert.Equal(t, "access:user", response["jwt"])
+	assert.NotContains(t, response, "access_token")
+	assert.Equal(t, float64(900), response["expires_in"])
+}
+
+func TestTokenServer_TokenHandler_ResponseFormat(t *testing.T) {
+	server := newTokenServerStub()
+
+	req := httptest.NewRequest(http.MethodGet, "/token?service=service.example.com", nil)
+	req.SetBasicAuth("user", "password")
+
+	rec := httptest.NewRecorder()
+
+	server.TokenHandler(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var response map[string]any
+
+	err := json.NewDecoder(rec.Body).Decode(&response)
+	require.NoError(t, err)
+
+	assert.Equal(t, "access:user", response["token"])
+	assert.Equal(t, "access:user", response["access_token"])
+
+	// Derived from the issued token
+	assert.Equal(t, float64(900), response["expires_in"])
+	assert.Equal(t, "2009-11-10T23:00:00Z", response["issued_at"])
+}
+
+func TestTokenServer_TokenHandler_NoStore(t *testing.T) {
+	doRequest := func(server TokenServer, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/token?service=service.example.com", nil)
+		req.SetBasicAuth(password, password)
+
+		rec := httptest.NewRecorder()
+
+		server.TokenHandler(rec, req)
+
+		return rec
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		rec := doRequest(newTokenServerStub(), "user")
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+		assert.Equal(t, "no-cache", rec.Header().Get("Pragma"))
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		rec := doRequest(newTokenServerStub(), "unknown")
+
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+		assert.Equal(t, "no-cache", rec.Header().Get("Pragma"))
+	})
+
+	t.Run("Override", func(t *testing.T) {
+		server := newTokenServerStub()
+		server.CacheControl = "private, max-age=60"
+
+		rec := doRequest(server, "user")
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "private, max-age=60", rec.Header().Get("Cache-Control"))
+		assert.Empty(t, rec.Header().Get("Pragma"))
+	})
+}
+
+func TestTokenServer_OAuth2Handler_OfflineToken(t *testing.T) {
+	doRequest := func(form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rec := httptest.NewRecorder()
+
+		newTokenServerStub().OAuth2Handler(rec, req)
+
+		return rec
+	}
+
+	passwordGrant := func(extra url.Values) url.Values {
+		form := url.Values{
+			"grant_type": {GrantTypePassword},
+			"service":    {"service.example.com"},
+			"client_id":  {"client"},
+			"username":   {"user"},
+			"password":   {"password"},
+		}
+
+		for key, values := range extra {
+			form[key] = values
+		}
+
+		return form
+	}
+
+	refreshTokenGrant := func(extra url.Values) url.Values {
+		form := url.Values{
+			"grant_type":    {GrantTypeRefreshToken},
+			"service":       {"service.example.com"},
+			"client_id":     {"client"},
+			"refresh_token": {"refresh:user"},
+		}
+
+		for key, values := range extra {
+			form[key] = values
+		}
+
+		return form
+	}
+
+	testCases := []struct {
+		name                 string
+		form                 url.Values
+		expectedRefreshToken string
+	}{
+		{
+			name:                 "PasswordGrant",
+			form:                 passwordGrant(nil),
+			expectedRefreshToken: "",
+		},
+		{
+			name:                 "PasswordGrantOffline",
+			form:                 passwordGrant(url.Values{"offline_token": {"true"}}),
+			expectedRefreshToken: "refresh:user",
+		},
+		{
+			name:                 "RefreshTokenGrant",
+			form:                 refreshTokenGrant(nil),
+			expectedRefreshToken: "refresh:user",
+		},
+		{
+			name:                 "RefreshTokenGrantOnline",
+			form:                 refreshTokenGrant(url.Values{"offline_token": {"false"}}),
+			expectedRefreshToken: "",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			rec := doRequest(testCase.form)
+
+			require.Equal(t, http.StatusOK, rec.Code)
+
+			var response OAuth2Response
+
+			err := json.NewDecoder(rec.Body).Decode(&response)
+			require.NoError(t, err)
+
+			assert.Equal(t, testCase.expectedRefreshToken, response.RefreshToken)
+		})
+	}
+
+	t.Run("Conflict", func(t *testing.T) {
+		rec := doRequest(passwordGrant(url.Values{"offline_token": {"false"}, "access_type": {AccessTypeOffline}}))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestTokenServer_OAuth2Handler_Grants(t *testing.T) {
+	doRequest := func(form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rec := httptest.NewRecorder()
+
+		newTokenServerStub().OAuth2Handler(rec, req)
+
+		return rec
+	}
+
+	t.Run("PasswordGrant", func(t *testing.T) {
+		rec := doRequest(url.Values{
+			"grant_type":  {GrantTypePassword},
+			"service":     {"service.example.com"},
+			"client_id":   {"client"},
+			"username":    {"user"},
+			"password":    {"password"},
+			"scope":       {"repository:foo:pull"},
+			"access_type": {AccessTypeOffline},
+		})
+
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var response map[string]any
+
+		err := json.NewDecoder(rec.Body).Decode(&response)
+		require.NoError(t, err)
+
+		assert.Equal(t, map[string]any{
+			"access_token":             "access:user",
+			"refresh_token":            "refresh:user",
+			"expires_in":               float64(900),
+			"issued_at":                "2009-11-10T23:00:00Z",
+			"scope":                    "repository:foo:pull",
+			"refresh_token_expires_in": float64(86400),
+		}, response)
+	})
+
+	t.Run("RefreshTokenGrant", func(t *testing.T) {
+		rec := doRequest(url.Values{
+			"grant_type":    {GrantTypeRefreshToken},
+			"service":       {"service.example.com"},
+			"client_id":     {"client"},
+			"refresh_token": {"refresh:user"},
+			"scope":         {"repository:foo:pull,push"},
+		})
+
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var response map[string]any
+
+		err := json.NewDecoder(rec.Body).Decode(&response)
+		require.NoError(t, err)
+
+		assert.Equal(t, map[string]any{
+			"access_token":  "access:user",
+			"refresh_token": "refresh:user",
+			"expires_in":    float64(900),
+			"issued_at":     "2009-11-10T23:00:00Z",
+			"scope":         "repository:foo:pull,push",
+		}, response)
+	})
+
+	testCases := []struct {
+		name          string
+		form          url.Values
+		expectedError string
+	}{
+		{
+			name:          "MissingGrantType",
+			form:          url.Values{"service": {"service.example.com"}, "client_id": {"client"}},
+			expectedError: "invalid_request",
+		},
+		{
+			name:          "UnsupportedGrantType",
+			form:          url.Values{"grant_type": {"client_credentials"}, "service": {"service.example.com"}, "client_id": {"client"}},
+			expectedError: "unsupported_grant_type",
+		},
+		{
+			name:          "MissingClientID",
+			form:          url.Values{"grant_type": {GrantTypePassword}, "service": {"service.example.com"}, "username": {"user"}, "password": {"password"}},
+			expectedError: "invalid_request",
+		},
+		{
+			name:          "MissingRefreshToken",
+			form:          url.Values{"grant_type": {GrantTypeRefreshToken}, "service": {"service.example.com"}, "client_id": {"client"}},
+			expectedError: "invalid_request",
+		},
+		{
+			name:          "UnknownAccessType",
+			form:          url.Values{"grant_type": {GrantTypeRefreshToken}, "service": {"service.example.com"}, "client_id": {"client"}, "refresh_token": {"refresh:user"}, "access_type": {"forever"}},
+			expectedError: "invalid_request",
+		},
+		{
+			name:          "InvalidPassword",
+			form:          url.Values{"grant_type": {GrantTypePassword}, "service": {"service.example.com"}, "client_id": {"client"}, "username": {"unknown"}, "password": {"password"}},
+			expectedError: "invalid_grant",
+		},
+		{
+			name:          "InvalidRefreshToken",
+			form:          url.Values{"grant_type": {GrantTypeRefreshToken}, "service": {"service.example.com"}, "client_id": {"client"}, "refresh_token": {"forged"}},
+			expectedError: "invalid_grant",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			rec := doRequest(testCase.form)
+
+			require.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+			var response errorResponse
+
+			err := json.NewDecoder(rec.Body).Decode(&response)
+			require.NoError(t, err)
+
+			assert.Equal(t, testCase.expectedError, response.Error)
+			assert.NotEmpty(t, response.ErrorDescription)
+		})
+	}
+}
+
+func TestTokenServer_OAuth2Handler_InvalidGrantDescription(t *testing.T) {
+	service := newTokenServiceStub()
+	service.Authenticator.PasswordAuthenticator = leakyAuthenticator{}
+
+	server := newTokenServerStub()
+	server.Service = service
+
+	form := url.Values{
+		"grant_type": {GrantTypePassword},
+		"service":    {"service.example.com"},
+		"client_id":  {"client"},
+		"username":   {"user"},
+		"password":   {"secret"},
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rec := httptest.NewRecorder()
+
+	server.OAuth2Handler(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	var response errorResponse
+
+	err := json.NewDecoder(rec.Body).Decode(&response)
+	require.NoError(t, err)
+
+	assert.Equal(t, "invalid_grant", response.Error)
+	assert.Equal(t, "invalid credentials or refresh token", response.ErrorDescription)
+}
+
+func TestTokenServer_TokenHandler_MaxActionsPerScope(t *testing.T) {
+	server := newTokenServerStub()
+	server.MaxActionsPerScope = 3
+
+	doRequest := func(scope string) *httptest.ResponseRecorder {
+		query := url.Values{
+			"service": {"service.example.com"},
+			"scope":   {scope},
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/token?"+query.Encode(), nil)
+		req.SetBasicAuth("user", "password")
+
+		rec := httptest.NewRecorder()
+
+		server.TokenHandler(rec, req)
+
+		return rec
+	}
+
+	t.Run("WithinLimit", func(t *testing.T) {
+		rec := doRequest("repository:user/app:pull,push,delete")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("ExceedsLimit", func(t *testing.T) {
+		rec := doRequest("repository:user/app:pull,push,delete,pull")
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		var response errorResponse
+
+		err := json.NewDecoder(rec.Body).Decode(&response)
+		require.NoError(t, err)
+
+		assert.Equal(t, "invalid_scope", response.Error)
+	})
+}
+
+func TestTokenServer_TokenHandler_MaxScopes(t *testing.T) {
+	server := newTokenServerStub()
+	server.MaxScopes = 2
+
+	doRequest := func(scopes ...string) *httptest.ResponseRecorder {
+		query := url.Values{
+			"service": {"service.example.com"},
+			"scope":   scopes,
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/token?"+query.Encode(), nil)
+		req.SetBasicAuth("user", "password")
+
+		rec := httptest.NewRecorder()
+
+		server.TokenHandler(rec, req)
+
+		return rec
+	}
+
+	t.Run("WithinLimit", func(t *testing.T) {
+		rec := doRequest("repository:user/app:pull", "repository:user/lib:pull")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("ExceedsLimit", func(t *testing.T) {
+		rec := doRequest("repository:user/app:pull", "repository:user/lib:pull", "repository:user/tool:pull")
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		var response errorResponse
+
+		err := json.NewDecoder(rec.Body).Decode(&response)
+		require.NoError(t, err)
+
+		assert.Equal(t, "invalid_scope", response.Error)
+		assert.Equal(t, "invalid scope: more than 2 scopes requested", response.ErrorDescription)
+	})
+
+	t.Run("SpaceDelimited", func(t *testing.T) {
+		rec := doRequest("repository:user/app:pull repository:user/lib:pull repository:user/tool:pull")
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestTokenServer_TokenHandler_MaxAudiences(t *testing.T) {
+	server := newTokenServerStub()
+	server.MultipleServices = MultipleServicesMatching
+	server.MaxAudiences = 2
+
+	doRequest := func(services ...string) *httptest.ResponseRecorder {
+		query := url.Values{
+			"service": services,
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/token?"+query.Encode(), nil)
+		req.SetBasicAuth("user", "password")
+
+		rec := httptest.NewRecorder()
+
+		server.TokenHandler(rec, req)
+
+		return rec
+	}
+
+	t.Run("WithinLimit", func(t *testing.T) {
+		rec := doRequest("service.example.com", "service.example.com")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("ExceedsLimit", func(t *testing.T) {
+		rec := doRequest("service.example.com", "service.example.com", "service.example.com")
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		var response errorResponse
+
+		err := json.NewDecoder(rec.Body).Decode(&response)
+		require.NoError(t, err)
+
+		assert.Equal(t, "invalid_request", response.Error)
+		assert.Contains(t, response.ErrorDescription, "more than 2 service parameters")
+	})
+}
+
+func TestTokenServer_TokenHandler_DuplicateScopes(t *testing.T) {
+	var grantedScopes []Scope
+
+	service := newTokenServiceStub()
+	service.Authorizer = scopeRecorder{scopes: &grantedScopes}
+
+	server := newTokenServerStub()
+	server.Service = service
+
+	doRequest := func(scopes ...string) *httptest.ResponseRecorder {
+		query := url.Values{
+			"service": {"service.example.com"},
+			"scope":   scopes,
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/token?"+query.Encode(), nil)
+		req.SetBasicAuth("user", "password")
+
+		rec := httptest.NewRecorder()
+
+		server.TokenHandler(rec, req)
+
+		return rec
+	}
+
+	t.Run("Merge", func(t *testing.T) {
+		rec := doRequest("repository:foo:pull", "repository:foo:push")
+
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		expected := []Scope{
+			{
+				Resource: Resource{Type: "repository", Name: "foo"},
+				Actions:  []string{"pull", "push"},
+			},
+		}
+
+		assert.Equal(t, expected, grantedScopes)
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		rec := doRequest("repository(plugin):foo:pull", "repository:foo:push")
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		var response errorResponse
+
+		err := json.NewDecoder(rec.Body).Decode(&response)
+		require.NoError(t, err)
+
+		assert.Equal(t, "invalid_scope", response.Error)
+	})
+}
+
+func TestTokenServer_OAuth2Handler_ScopeRoundTrip(t *testing.T) {
+	var requestedScopes []Scope
+
+	service := newTokenServiceStub()
+	service.Authorizer = scopeRecorder{scopes: &requestedScopes}
+
+	server := newTokenServerStub()
+	server.Service = service
+
+	form := url.Values{
+		"grant_type": {GrantTypePassword},
+		"service":    {"service.example.com"},
+		"client_id":  {"client"},
+		"username":   {"user"},
+		"password":   {"password"},
+		"scope": {
+			"repository:foo/bar:pull,push",
+			"repository:foo/bar:pull registry:catalog:*",
+			"repository:localhost:5000/baz:pull",
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rec := httptest.NewRecorder()
+
+	server.OAuth2Handler(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// The authorizer receives the deduplicated set
+	assert.Equal(t, []Scope{
+		{Resource: Resource{Type: "repository", Name: "foo/bar"}, Actions: []string{"pull", "push"}},
+		{Resource: Resource{Type: "registry", Name: "catalog"}, Actions: []string{"*"}},
+		{Resource: Resource{Type: "repository", Name: "localhost:5000/baz"}, Actions: []string{"pull"}},
+	}, requestedScopes)
+
+	var response OAuth2Response
+
+	err := json.NewDecoder(rec.Body).Decode(&response)
+	require.NoError(t, err)
+
+	assert.Equal(t, "repository:foo/bar:pull,push registry:catalog:* repository:localhost:5000/baz:pull", response.Scope)
+}
+
+func TestTokenServer_TokenHandler_RegistryHosts(t *testing.T) {
+	var grantedScopes []Scope
+
+	service := newTokenServiceStub()
+	service.Authorizer = scopeRecorder{scopes: &grantedScopes}
+
+	server := newTokenServerStub()
+	server.Service = service
+	server.RegistryHosts = []string{"registry.example.com"}
+
+	testCases := []struct {
+		name   string
+		scopes []string
+	}{
+		{
+			name:   "WithHost",
+			scopes: []string{"repository:registry.example.com/team/app:pull"},
+		},
+		{
+			name:   "WithoutHost",
+			scopes: []string{"repository:team/app:pull"},
+		},
+		{
+			name:   "Both",
+			scopes: []string{"repository:REGISTRY.example.com/team/app:pull", "repository:team/app:pull"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			query := url.Values{
+				"service": {"service.example.com"},
+				"scope":   testCase.scopes,
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/token?"+query.Encode(), nil)
+			req.SetBasicAuth("user", "password")
+
+			rec := httptest.NewRecorder()
+
+			server.TokenHandler(rec, req)
+
+			require.Equal(t, http.StatusOK, rec.Code)
+
+			expected := []Scope{
+				{
+					Resource: Resource{Type: "repository", Name: "team/app"},
+					Actions:  []string{"pull"},
+				},
+			}
+
+			assert.Equal(t, expected, grantedScopes)
+		})
+	}
+}
+
+// scopeRecorder grants and records every requested scope.
+type scopeRecorder struct {
+	scopes *[]Scope
+}
+
+func (a scopeRecorder) Authorize(_ context.Context, _ Subject, requestedScopes []Scope) ([]Scope, error) {
+	*a.scopes = requestedScopes
+
+	return requestedScopes, nil
+}
+
+type failingAccessTokenIssuer struct{}
+
+func (failingAccessTokenIssuer) IssueAccessToken(_ context.Context, _ string, _ Subject, _ []Scope) (AccessToken, error) {
+	return AccessToken{}, errors.New("HSM unavailable")
+}
+
+type issuerFailureCounter struct {
+	failures map[string]int
+}
+
+func (m *issuerFailureCounter) IncIssuerFailures(tokenType string) {
+	m.failures[tokenType]++
+}
+
+func TestTokenServer_IssuerFailure(t *testing.T) {
+	metrics := &issuerFailureCounter{failures: map[string]int{}}
+
+	service := newTokenServiceStub()
+	service.TokenIssuer.AccessTokenIssuer = failingAccessTokenIssuer{}
+	service.Dependencies.Metrics = metrics
+
+	server := newTokenServerStub()
+	server.Service = service
+	server.RetryAfter = time.Minute
+
+	query := url.Values{
+		"service": {"service.example.com"},
+		"scope":   {"repository:foo:pull"},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/token?"+query.Encode(), nil)
+	req.SetBasicAuth("user", "password")
+
+	rec := httptest.NewRecorder()
+
+	server.TokenHandler(rec, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+	assert.Equal(t, map[string]int{MetricTokenTypeAccess: 1}, metrics.failures)
+}
+
+type bearerTokenAuthenticatorStub struct {
+	subjects map[string]Subject
+}
+
+func (a bearerTokenAuthenticatorStub) AuthenticateBearerToken(_ context.Context, token string) (Subject, error) {
+	subject, ok := a.subjects[token]
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	return subject, nil
+}
+
+func TestTokenServer_BearerToken(t *testing.T) {
+	newServer := func(enabled bool) TokenServer {
+		service := newTokenServiceStub()
+
+		if enabled {
+			service.Authenticator.BearerTokenAuthenticator = bearerTokenAuthenticatorStub{
+				subjects: map[string]Subject{
+					"id-token": subjectStub{id: "oidc-user"},
+				},
+			}
+		}
+
+		server := newTokenServerStub()
+		server.Service = service
+
+		return server
+	}
+
+	tokenRequest := func(token string) *http.Request {
+		query := url.Values{
+			"service":       {"service.example.com"},
+			"scope":         {"repository:foo:pull"},
+			"offline_token": {"true"},
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/token?"+query.Encode(), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		return req
+	}
+
+	oauth2Request := func(token string) *http.Request {
+		form := url.Values{
+			"grant_type":  {GrantTypeJWTBearer},
+			"service":     {"service.example.com"},
+			"client_id":   {"client"},
+			"assertion":   {token},
+			"access_type": {AccessTypeOffline},
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		return req
+	}
+
+	t.Run("TokenHandler", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+
+		newServer(true).TokenHandler(rec, tokenRequest("id-token"))
+
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var response TokenResponse
+
+		err := json.NewDecoder(rec.Body).Decode(&response)
+		require.NoError(t, err)
+
+		assert.Equal(t, "access:oidc-user", response.Token)
+
+		// Refresh tokens cannot be verified for subjects unknown to the subject repository
+		assert.Empty(t, response.RefreshToken)
+	})
+
+	t.Run("OAuth2Handler", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+
+		newServer(true).OAuth2Handler(rec, oauth2Request("id-token"))
+
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var response OAuth2Response
+
+		err := json.NewDecoder(rec.Body).Decode(&response)
+		require.NoError(t, err)
+
+		assert.Equal(t, "access:oidc-user", response.Token)
+		assert.Empty(t, response.RefreshToken)
+	})
+
+	t.Run("InvalidToken", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+
+		newServer(true).TokenHandler(rec, tokenRequest("forged"))
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+
+		newServer(false).OAuth2Handler(rec, oauth2Request("id-token"))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+type failingAuthorizerStub struct{}
+
+func (failingAuthorizerStub) Authorize(_ context.Context, _ Subject, _ []Scope) ([]Scope, error) {
+	return nil, errors.New("authorizer is down")
+}
+
+func TestTokenServer_TokenHandler_DockerLogin(t *testing.T) {
+	// docker login sends an authenticated request without any scope to check the credentials
+	doRequest := func(server TokenServer) *httptest.ResponseRecorder {
+		query := url.Values{
+			"account":       {"user"},
+			"client_id":     {"docker"},
+			"offline_token": {"true"},
+			"service":       {"service.example.com"},
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/token?"+query.Encode(), nil)
+		req.SetBasicAuth("user", "password")
+
+		rec := httptest.NewRecorder()
+
+		server.TokenHandler(rec, req)
+
+		return rec
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		service := newTokenServiceStub()
+		service.Authorizer = failingAuthorizerStub{}
+
+		server := newTokenServerStub()
+		server.Service = service
+
+		rec := doRequest(server)
+
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var response TokenResponse
+
+		err := json.NewDecoder(rec.Body).Decode(&response)
+		require.NoError(t, err)
+
+		assert.Equal(t, "access:user", response.Token)
+		assert.Equal(t, "refresh:user", response.RefreshToken)
+	})
+
+	t.Run("InvalidCredentials", func(t *testing.T) {
+		server := newTokenServerStub()
+
+		query := url.Values{
+			"service": {"service.example.com"},
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/token?"+query.Encode(), nil)
+		req.SetBasicAuth("unknown", "password")
+
+		rec := httptest.NewRecorder()
+
+		server.TokenHandler(rec, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("Authorize", func(t *testing.T) {
+		service := newTokenServiceStub()
+		service.Authorizer = failingAuthorizerStub{}
+		service.EmptyScope = EmptyScopeAuthorize
+
+		server := newTokenServerStub()
+		server.Service = service
+
+		rec := doRequest(server)
+
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
@@ -2,9 +2,12 @@ package auth
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"slices"
+	"strings"
 	"time"
 )
 
@@ -36,11 +39,33 @@ type TokenRequest struct {
 	Anonymous bool
 	Username  string
 	Password  string
+
+	// BearerToken is a token issued by a trusted identity provider (eg. an OIDC ID token) the request authenticates with instead of a password.
+	BearerToken string
+
+	// NotBefore requests a scheduled access token becoming valid in the future (see ScheduledTokens).
+	NotBefore time.Time
+
+	// DPoPKeyThumbprint is the JWK thumbprint of a verified DPoP proof key the access token should be bound to.
+	DPoPKeyThumbprint string
+}
+
+// AuthenticationMethod returns the method the request authenticates with or an empty string for anonymous requests.
+func (r TokenRequest) AuthenticationMethod() string {
+	if r.Anonymous {
+		return ""
+	}
+
+	if r.BearerToken != "" {
+		return AuthenticationMethodBearerToken
+	}
+
+	return AuthenticationMethodPassword
 }
 
 func (r TokenRequest) Validate() error {
 	if r.Service == "" {
-		return errors.New("service is required")
+		return fmt.Errorf("%w: service is required", ErrInvalidRequest)
 	}
 
 	if r.ClientID == "" { //nolint
@@ -55,12 +80,41 @@ func (r TokenRequest) Validate() error {
 // [Docker Registry v2 authentication]: https://github.com/distribution/distribution/blob/main/docs/spec/auth/token.md
 type TokenResponse struct {
 	Token        string `json:"access_token"`
+	TokenType    string `json:"token_type,omitempty"`
 	RefreshToken string `json:"refresh_token,omitempty"`
-	ExpiresIn    int    `json:"expires_in,omitempty"`
+
+	// ExpiresIn is the number of seconds until the access token expires.
+	ExpiresIn int `json:"expires_in,omitempty"`
+
+	// IssuedAt is the time the access token was issued at (RFC 3339).
+	IssuedAt string `json:"issued_at,omitempty"`
+
+	// Warnings explains why requested access was not granted (non-standard, see TokenServiceImpl.ScopeWarnings).
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// MarshalJSON implements [json.Marshaler].
+//
+// The specification requires the token in the "token" field and accepts "access_token" as an alias (for OAuth2 compatibility):
+// the token is included in both of them, so that every client finds it.
+func (r TokenResponse) MarshalJSON() ([]byte, error) {
+	type tokenResponse TokenResponse
+
+	return json.Marshal(struct {
+		Token string `json:"token"`
+		tokenResponse
+	}{
+		Token:         r.Token,
+		tokenResponse: tokenResponse(r),
+	})
 }
 
 // OAuth2Request implements the token request defined in the [Docker Registry v2 OAuth2 authentication] specification.
 //
+// AccessType controls refresh token issuance regardless of the grant type:
+// "offline" issues a new refresh token, "online" returns none.
+// By default, the refresh token presented in a refresh_token grant is returned.
+//
 // [Docker Registry v2 OAuth2 authentication]: https://github.com/distribution/distribution/blob/main/docs/spec/auth/oauth.md
 type OAuth2Request struct {
 	GrantType string
@@ -73,44 +127,73 @@ type OAuth2Request struct {
 	Username     string
 	Password     string
 	RefreshToken string
+
+	// Assertion is the bearer token (eg. an OIDC ID token) presented in a jwt-bearer grant (RFC 7523).
+	Assertion string
+
+	// NotBefore requests a scheduled access token becoming valid in the future (see ScheduledTokens).
+	NotBefore time.Time
+
+	// DPoPKeyThumbprint is the JWK thumbprint of a verified DPoP proof key the access token should be bound to.
+	DPoPKeyThumbprint string
+}
+
+// AuthenticationMethod returns the method the request authenticates with.
+func (r OAuth2Request) AuthenticationMethod() string {
+	switch r.GrantType {
+	case GrantTypeRefreshToken:
+		return AuthenticationMethodRefreshToken
+	case GrantTypePassword:
+		return AuthenticationMethodPassword
+	case GrantTypeJWTBearer:
+		return AuthenticationMethodBearerToken
+	default:
+		return ""
+	}
 }
 
-// TODO: oauth2 error
+// Validate checks the request for missing or invalid parameters.
+//
+// It returns an ErrUnsupportedGrantType error for unknown grant types and an ErrInvalidRequest error otherwise.
 func (r OAuth2Request) Validate() error {
 	if r.Service == "" {
-		return errors.New("service is required")
+		return fmt.Errorf("%w: service is required", ErrInvalidRequest)
 	}
 
 	if r.ClientID == "" {
-		return errors.New("client ID is required")
+		return fmt.Errorf("%w: client ID is required", ErrInvalidRequest)
 	}
 
 	if r.GrantType == "" {
-		return errors.New("missing grant_type value")
+		return fmt.Errorf("%w: missing grant_type value", ErrInvalidRequest)
 	}
 
 	if !slices.Contains(validGrantTypes, r.GrantType) {
-		return errors.New("unknown grant_type value")
+		return fmt.Errorf("%w: %q", ErrUnsupportedGrantType, r.GrantType)
 	}
 
 	if r.GrantType == GrantTypeRefreshToken {
 		if r.RefreshToken == "" {
-			return errors.New("missing refresh_token value")
+			return fmt.Errorf("%w: missing refresh_token value", ErrInvalidRequest)
 		}
 	}
 
+	// Empty passwords are passed to the authenticator, the same way as basic auth credentials (see TokenServer.RejectEmptyPassword)
 	if r.GrantType == GrantTypePassword {
 		if r.Username == "" {
-			return errors.New("missing username value")
+			return fmt.Errorf("%w: missing username value", ErrInvalidRequest)
 		}
+	}
 
-		if r.Password == "" {
-			return errors.New("missing password value")
+	if r.GrantType == GrantTypeJWTBearer {
+		// The username is enough for the password fallback (see TokenServiceImpl.PasswordFallback)
+		if r.Assertion == "" && r.Username == "" {
+			return fmt.Errorf("%w: missing assertion value", ErrInvalidRequest)
 		}
 	}
 
 	if !slices.Contains(validAccessTypes, r.AccessType) {
-		return errors.New("unknown access_type value")
+		return fmt.Errorf("%w: unknown access_type value", ErrInvalidRequest)
 	}
 
 	return nil
@@ -120,6 +203,9 @@ const (
 	GrantTypeRefreshToken = "refresh_token"
 	GrantTypePassword     = "password"
 
+	// GrantTypeJWTBearer authenticates with a bearer token issued by a trusted identity provider (RFC 7523).
+	GrantTypeJWTBearer = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
 	AccessTypeOnline  = "online"
 	AccessTypeOffline = "offline"
 )
@@ -127,6 +213,7 @@ const (
 var validGrantTypes = []string{
 	GrantTypeRefreshToken,
 	GrantTypePassword,
+	GrantTypeJWTBearer,
 }
 
 var validAccessTypes = []string{
@@ -140,22 +227,98 @@ var validAccessTypes = []string{
 // [Docker Registry v2 OAuth2 authentication]: https://github.com/distribution/distribution/blob/main/docs/spec/auth/oauth.md
 type OAuth2Response struct {
 	Token        string `json:"access_token"`
+	TokenType    string `json:"token_type,omitempty"`
 	Scope        string `json:"scope,omitempty"`
 	ExpiresIn    int    `json:"expires_in,omitempty"`
 	IssuedAt     string `json:"issued_at,omitempty"`
 	RefreshToken string `json:"refresh_token,omitempty"`
+
+	// RefreshTokenExpiresIn is the lifetime of the refresh token in seconds.
+	// It is only present if a new refresh token is issued and it has an expiration.
+	RefreshTokenExpiresIn int `json:"refresh_token_expires_in,omitempty"`
+
+	// Warnings explains why requested access was not granted (non-standard, see TokenServiceImpl.ScopeWarnings).
+	Warnings []string `json:"warnings,omitempty"`
 }
 
 // Authenticator is a facade combining different type of authenticators.
+//
+// BearerTokenAuthenticator is optional: bearer token authentication is rejected if it is nil.
+// SubjectEnricher is optional: if set, every authenticated subject is passed to it.
 type Authenticator struct {
 	PasswordAuthenticator
 	RefreshTokenAuthenticator
+	BearerTokenAuthenticator
+
+	SubjectEnricher SubjectEnricher
+}
+
+// AuthenticatePassword implements PasswordAuthenticator.
+func (a Authenticator) AuthenticatePassword(ctx context.Context, username string, password string) (Subject, error) {
+	subject, err := a.PasswordAuthenticator.AuthenticatePassword(ctx, username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.enrich(ctx, subject)
+}
+
+// AuthenticateRefreshToken implements RefreshTokenAuthenticator.
+func (a Authenticator) AuthenticateRefreshToken(ctx context.Context, service string, refreshToken string) (Subject, error) {
+	subject, err := a.RefreshTokenAuthenticator.AuthenticateRefreshToken(ctx, service, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.enrich(ctx, subject)
+}
+
+// AuthenticateBearerToken implements BearerTokenAuthenticator.
+func (a Authenticator) AuthenticateBearerToken(ctx context.Context, token string) (Subject, error) {
+	if a.BearerTokenAuthenticator == nil {
+		return nil, fmt.Errorf("%w: bearer token authentication is not enabled", ErrInvalidRequest)
+	}
+
+	subject, err := a.BearerTokenAuthenticator.AuthenticateBearerToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.enrich(ctx, subject)
+}
+
+// enrich passes an authenticated subject to the SubjectEnricher (if any).
+func (a Authenticator) enrich(ctx context.Context, subject Subject) (Subject, error) {
+	if a.SubjectEnricher == nil || subject == nil {
+		return subject, nil
+	}
+
+	enriched, err := a.SubjectEnricher.EnrichSubject(ctx, subject)
+	if err != nil {
+		return nil, fmt.Errorf("enriching subject: %w", err)
+	}
+
+	return enriched, nil
 }
 
 // TokenIssuer is a facade combining different type of token issuers.
 type TokenIssuer struct {
 	AccessTokenIssuer
 	RefreshTokenIssuer
+
+	// StrippedAttributes lists subject attributes (eg. userPassword or internal IDs from LDAP)
+	// that are removed before the subject is passed to the issuers, so that they never end up in a token.
+	StrippedAttributes []string
+}
+
+// IssueAccessToken implements AccessTokenIssuer.
+func (i TokenIssuer) IssueAccessToken(ctx context.Context, service string, subject Subject, grantedScopes []Scope) (AccessToken, error) {
+	return i.AccessTokenIssuer.IssueAccessToken(ctx, service, StripSubjectAttributes(subject, i.StrippedAttributes), grantedScopes)
+}
+
+// IssueRefreshToken implements RefreshTokenIssuer.
+func (i TokenIssuer) IssueRefreshToken(ctx context.Context, service string, subject Subject) (RefreshToken, error) {
+	return i.RefreshTokenIssuer.IssueRefreshToken(ctx, service, StripSubjectAttributes(subject, i.StrippedAttributes))
 }
 
 // TokenServer implements the [Docker Registry v2 authentication] specification.
@@ -165,12 +328,117 @@ type TokenServiceImpl struct {
 	Authenticator Authenticator
 	Authorizer    Authorizer
 	TokenIssuer   TokenIssuer
+
+	// ScheduledTokens allows privileged subjects to request access tokens becoming valid in the future.
+	ScheduledTokens ScheduledTokens
+
+	// EmptyScope controls authenticated requests without any scope (eg. docker login checking credentials).
+	// Defaults to EmptyScopeIssue.
+	EmptyScope string
+
+	// AnonymousAccess controls requests without credentials.
+	// Defaults to AnonymousAccessAuthorize.
+	AnonymousAccess string
+
+	// PasswordFallback authenticates jwt-bearer grants with the username and password of the request
+	// if the assertion is missing or invalid (eg. while migrating clients to token exchange).
+	// Other errors (eg. an unreachable identity provider) are returned as usual.
+	PasswordFallback bool
+
+	// ScopeWarnings lists the requested scopes that were not granted in a non-standard "warnings" field of responses
+	// to help debugging failing pulls and pushes. Strict clients may reject unknown fields, so it is disabled by default.
+	ScopeWarnings bool
+
+	Dependencies Dependencies
+}
+
+const (
+	// EmptyScopeIssue issues an access token without any access to authenticated subjects requesting no scope,
+	// without consulting the authorizer.
+	EmptyScopeIssue = "issue"
+
+	// EmptyScopeAuthorize passes requests without any scope to the authorizer like any other request.
+	EmptyScopeAuthorize = "authorize"
+)
+
+const (
+	// AnonymousAccessAuthorize passes anonymous requests to the authorizer with a nil Subject,
+	// letting it decide what (if anything) anonymous subjects may do (eg. pull public repositories).
+	AnonymousAccessAuthorize = "authorize"
+
+	// AnonymousAccessDeny rejects anonymous requests with ErrUnauthorized without consulting the authorizer.
+	AnonymousAccessDeny = "deny"
+)
+
+// ScheduledTokens controls access tokens requested with a future "nbf" (eg. by CI pipelines pre-fetching tokens for a scheduled job).
+//
+// The token lifetime starts at the requested time.
+type ScheduledTokens struct {
+	// MaxDelay is the maximum time a token may become valid in the future.
+	// Zero disables scheduled tokens.
+	MaxDelay time.Duration
+
+	// SubjectAttributes are attributes a subject must have (with the exact values) to request scheduled tokens.
+	// Anonymous subjects can never request scheduled tokens.
+	SubjectAttributes map[string]string
+}
+
+// withNotBefore checks a scheduled token request and stores the requested time in ctx.
+func (s TokenServiceImpl) withNotBefore(ctx context.Context, subject Subject, notBefore time.Time) (context.Context, error) {
+	if notBefore.IsZero() {
+		return ctx, nil
+	}
+
+	if s.ScheduledTokens.MaxDelay <= 0 {
+		return ctx, fmt.Errorf("%w: scheduled tokens are not enabled", ErrInvalidRequest)
+	}
+
+	if subject == nil {
+		return ctx, ErrUnauthorized
+	}
+
+	for key, value := range s.ScheduledTokens.SubjectAttributes {
+		if v, ok := subject.Attribute(key); !ok || v != value {
+			return ctx, ErrUnauthorized
+		}
+	}
+
+	now := s.Dependencies.GetClock().Now()
+
+	if notBefore.After(now.Add(s.ScheduledTokens.MaxDelay)) {
+		return ctx, fmt.Errorf("%w: not_before exceeds the maximum delay of %s", ErrInvalidRequest, s.ScheduledTokens.MaxDelay)
+	}
+
+	// Tokens cannot become valid in the past
+	if !notBefore.After(now) {
+		return ctx, nil
+	}
+
+	return ContextWithNotBefore(ctx, notBefore), nil
 }
 
 // TokenHandler implements the [Docker Registry v2 authentication] specification.
 //
 // [Docker Registry v2 authentication]: https://github.com/distribution/distribution/blob/main/docs/spec/auth/token.md
 func (s TokenServiceImpl) TokenHandler(ctx context.Context, r TokenRequest) (TokenResponse, error) {
+	ctx, span := startSpan(
+		ctx,
+		s.Dependencies.GetTracerProvider(),
+		"TokenHandler",
+		TraceAttributeGrantType.String(tokenRequestGrantType(r.AuthenticationMethod())),
+		TraceAttributeAuthenticationMethod.String(r.AuthenticationMethod()),
+		TraceAttributeService.String(r.Service),
+		TraceAttributeRequestedScopes.Int(len(r.Scopes)),
+	)
+
+	resp, err := s.tokenHandler(ctx, r)
+
+	endSpan(span, err)
+
+	return resp, err
+}
+
+func (s TokenServiceImpl) tokenHandler(ctx context.Context, r TokenRequest) (TokenResponse, error) {
 	if err := r.Validate(); err != nil {
 		return TokenResponse{}, err
 	}
@@ -180,62 +448,114 @@ func (s TokenServiceImpl) TokenHandler(ctx context.Context, r TokenRequest) (Tok
 	if !r.Anonymous {
 		var err error
 
-		subject, err = s.Authenticator.AuthenticatePassword(ctx, r.Username, r.Password)
+		subject, err = s.authenticate(ctx, r.AuthenticationMethod(), func(ctx context.Context) (Subject, error) {
+			if r.BearerToken != "" {
+				return s.Authenticator.AuthenticateBearerToken(ctx, r.BearerToken)
+			}
+
+			return s.Authenticator.AuthenticatePassword(ctx, r.Username, r.Password)
+		})
+
 		if err != nil {
+			recordAuthenticationError(ctx, err)
+
 			return TokenResponse{}, err
 		}
 	}
 
-	grantedScopes, err := s.Authorizer.Authorize(ctx, subject, r.Scopes)
+	ctx = withAuthenticationMethod(ctx, r.AuthenticationMethod())
+	recordSubject(ctx, subject)
+
+	ctx, err := s.withNotBefore(ctx, subject, r.NotBefore)
 	if err != nil {
 		return TokenResponse{}, err
 	}
 
-	token, err := s.TokenIssuer.IssueAccessToken(ctx, r.Service, subject, grantedScopes)
+	token, grantedScopes, err := s.authorizeAndIssueAccessToken(ctx, r.Service, subject, r.Scopes, r.DPoPKeyThumbprint)
 	if err != nil {
 		return TokenResponse{}, err
 	}
 
 	response := TokenResponse{
 		Token:     token.Payload,
+		TokenType: tokenType(r.DPoPKeyThumbprint),
 		ExpiresIn: int(token.ExpiresIn.Seconds()),
+		IssuedAt:  token.IssuedAt.Format(time.RFC3339),
+		Warnings:  s.scopeWarnings(r.Scopes, grantedScopes),
 	}
 
-	if r.Offline && subject != nil {
-		refreshToken, err := s.TokenIssuer.IssueRefreshToken(ctx, r.Service, subject)
+	// Subjects authenticated with a bearer token are not known to the subject repository refresh tokens are verified against
+	if r.Offline && subject != nil && r.BearerToken == "" {
+		refreshToken, err := s.issueRefreshToken(ctx, r.Service, subject)
 		if err != nil {
 			return TokenResponse{}, err
 		}
 
-		response.RefreshToken = refreshToken
+		response.RefreshToken = refreshToken.Payload
 	}
 
 	return response, nil
 }
 
 func (s TokenServiceImpl) OAuth2Handler(ctx context.Context, r OAuth2Request) (OAuth2Response, error) {
+	ctx, span := startSpan(
+		ctx,
+		s.Dependencies.GetTracerProvider(),
+		"OAuth2Handler",
+		TraceAttributeGrantType.String(r.GrantType),
+		TraceAttributeService.String(r.Service),
+		TraceAttributeRequestedScopes.Int(len(r.Scopes)),
+	)
+
+	resp, err := s.oauth2Handler(ctx, r)
+
+	endSpan(span, err)
+
+	return resp, err
+}
+
+func (s TokenServiceImpl) oauth2Handler(ctx context.Context, r OAuth2Request) (OAuth2Response, error) {
 	if err := r.Validate(); err != nil {
 		return OAuth2Response{}, err
 	}
 
 	var subject Subject
-	var refreshToken string
+	var refreshToken RefreshToken
+
+	authenticationMethod := r.AuthenticationMethod()
 
 	switch r.GrantType {
 	case GrantTypeRefreshToken:
 		var err error
 
-		subject, err = s.Authenticator.AuthenticateRefreshToken(ctx, r.Service, r.RefreshToken)
+		subject, err = s.authenticate(ctx, AuthenticationMethodRefreshToken, func(ctx context.Context) (Subject, error) {
+			return s.Authenticator.AuthenticateRefreshToken(ctx, r.Service, r.RefreshToken)
+		})
 		if err != nil {
+			recordAuthenticationError(ctx, err)
+
 			return OAuth2Response{}, err
 		}
 
-		refreshToken = r.RefreshToken
+		refreshToken = RefreshToken{Payload: r.RefreshToken}
 	case GrantTypePassword:
 		var err error
 
-		subject, err = s.Authenticator.AuthenticatePassword(ctx, r.Username, r.Password)
+		subject, err = s.authenticate(ctx, AuthenticationMethodPassword, func(ctx context.Context) (Subject, error) {
+			return s.Authenticator.AuthenticatePassword(ctx, r.Username, r.Password)
+		})
 		if err != nil {
+			recordAuthenticationError(ctx, err)
+
+			return OAuth2Response{}, err
+		}
+	case GrantTypeJWTBearer:
+		var err error
+
+		subject, authenticationMethod, err = s.authenticateJWTBearer(ctx, r)
+		if err != nil {
+			recordAuthenticationError(ctx, err)
+
 			return OAuth2Response{}, err
 		}
 	default:
@@ -243,62 +563,304 @@ func (s TokenServiceImpl) OAuth2Handler(ctx context.Context, r OAuth2Request) (O
 		return OAuth2Response{}, errors.New("unknown grant_type value")
 	}
 
-	grantedScopes, err := s.Authorizer.Authorize(ctx, subject, r.Scopes)
+	ctx = withAuthenticationMethod(ctx, authenticationMethod)
+	recordSubject(ctx, subject)
+
+	ctx, err := s.withNotBefore(ctx, subject, r.NotBefore)
 	if err != nil {
 		return OAuth2Response{}, err
 	}
 
-	token, err := s.TokenIssuer.IssueAccessToken(ctx, r.Service, subject, grantedScopes)
+	token, grantedScopes, err := s.authorizeAndIssueAccessToken(ctx, r.Service, subject, r.Scopes, r.DPoPKeyThumbprint)
 	if err != nil {
 		return OAuth2Response{}, err
 	}
 
 	response := OAuth2Response{
 		Token:     token.Payload,
+		TokenType: tokenType(r.DPoPKeyThumbprint),
 		ExpiresIn: int(token.ExpiresIn.Seconds()),
 		IssuedAt:  token.IssuedAt.Format(time.RFC3339),
 		Scope:     Scopes(grantedScopes).String(),
+		Warnings:  s.scopeWarnings(r.Scopes, grantedScopes),
 	}
 
-	if r.AccessType == AccessTypeOffline && subject != nil && r.GrantType == GrantTypeRefreshToken {
-		token, err := s.TokenIssuer.IssueRefreshToken(ctx, r.Service, subject)
-		if err != nil {
-			return OAuth2Response{}, err
+	switch r.AccessType {
+	case AccessTypeOffline:
+		// Subjects authenticated with a bearer token are not known to the subject repository refresh tokens are verified against
+		if subject != nil && authenticationMethod != AuthenticationMethodBearerToken {
+			token, err := s.issueRefreshToken(ctx, r.Service, subject)
+			if err != nil {
+				return OAuth2Response{}, err
+			}
+
+			refreshToken = token
 		}
 
-		refreshToken = token
+	case AccessTypeOnline:
+		// The client explicitly asked for no refresh token
+		refreshToken = RefreshToken{}
 	}
 
-	if refreshToken != "" {
-		response.RefreshToken = refreshToken
+	if refreshToken.Payload != "" {
+		response.RefreshToken = refreshToken.Payload
+		response.RefreshTokenExpiresIn = int(refreshToken.ExpiresIn.Seconds())
 	}
 
 	return response, nil
 }
 
+// authenticateJWTBearer authenticates a jwt-bearer grant and returns the authentication method that succeeded.
+//
+// If PasswordFallback is enabled, a missing or invalid assertion is retried with the username and password of the request.
+func (s TokenServiceImpl) authenticateJWTBearer(ctx context.Context, r OAuth2Request) (Subject, string, error) {
+	fallback := s.PasswordFallback && r.Username != ""
+
+	if r.Assertion != "" {
+		subject, err := s.authenticate(ctx, AuthenticationMethodBearerToken, func(ctx context.Context) (Subject, error) {
+			return s.Authenticator.AuthenticateBearerToken(ctx, r.Assertion)
+		})
+		if err == nil || !fallback || !errors.Is(err, ErrAuthenticationFailed) {
+			return subject, AuthenticationMethodBearerToken, err
+		}
+
+		s.Dependencies.GetLogger().DebugContext(ctx, "bearer token authentication failed, falling back to password", slog.Any("error", err))
+	} else if !fallback {
+		return nil, "", fmt.Errorf("%w: missing assertion value", ErrInvalidRequest)
+	}
+
+	subject, err := s.authenticate(ctx, AuthenticationMethodPassword, func(ctx context.Context) (Subject, error) {
+		return s.Authenticator.AuthenticatePassword(ctx, r.Username, r.Password)
+	})
+
+	return subject, AuthenticationMethodPassword, err
+}
+
+// authorizeAndIssueAccessToken issues an access token for the scopes granted to subject.
+func (s TokenServiceImpl) authorizeAndIssueAccessToken(
+	ctx context.Context,
+	service string,
+	subject Subject,
+	requestedScopes []Scope,
+	dpopKeyThumbprint string,
+) (AccessToken, []Scope, error) {
+	if subject == nil && s.AnonymousAccess == AnonymousAccessDeny {
+		return AccessToken{}, nil, ErrUnauthorized
+	}
+
+	grantedScopes := []Scope{}
+
+	// Authenticated requests without any scope only check credentials: there is nothing to authorize
+	if len(requestedScopes) > 0 || subject == nil || s.EmptyScope == EmptyScopeAuthorize {
+		var err error
+
+		grantedScopes, err = s.authorize(ctx, service, subject, requestedScopes)
+		if err != nil {
+			return AccessToken{}, nil, err
+		}
+	}
+
+	recordGrantedScopes(ctx, grantedScopes)
+
+	issueCtx, span := startSpan(ctx, s.Dependencies.GetTracerProvider(), "IssueAccessToken", TraceAttributeTokenType.String(MetricTokenTypeAccess))
+
+	token, err := s.TokenIssuer.IssueAccessToken(withDPoPKeyThumbprint(issueCtx, dpopKeyThumbprint), service, subject, grantedScopes)
+
+	endSpan(span, err)
+
+	if err != nil {
+		return AccessToken{}, nil, s.issuerError(MetricTokenTypeAccess, err)
+	}
+
+	recordIssuedAccessToken(ctx, token)
+
+	return token, grantedScopes, nil
+}
+
+// authenticate calls an authenticator in a span.
+func (s TokenServiceImpl) authenticate(ctx context.Context, method string, authenticate func(ctx context.Context) (Subject, error)) (Subject, error) {
+	ctx, span := startSpan(ctx, s.Dependencies.GetTracerProvider(), "Authenticate", TraceAttributeAuthenticationMethod.String(method))
+
+	subject, err := authenticate(ctx)
+
+	endSpan(span, err)
+
+	return subject, err
+}
+
+// authorize calls the authorizer in a span.
+func (s TokenServiceImpl) authorize(ctx context.Context, service string, subject Subject, requestedScopes []Scope) ([]Scope, error) {
+	ctx, span := startSpan(
+		ctx,
+		s.Dependencies.GetTracerProvider(),
+		"Authorize",
+		TraceAttributeRequestedScopes.Int(len(requestedScopes)),
+	)
+
+	grantedScopes, err := s.Authorizer.Authorize(ContextWithService(ctx, service), subject, requestedScopes)
+
+	span.SetAttributes(TraceAttributeGrantedActions.Int(countActions(grantedScopes)))
+	endSpan(span, err)
+
+	return grantedScopes, err
+}
+
+// issueRefreshToken issues a refresh token in a span.
+func (s TokenServiceImpl) issueRefreshToken(ctx context.Context, service string, subject Subject) (RefreshToken, error) {
+	ctx, span := startSpan(ctx, s.Dependencies.GetTracerProvider(), "IssueRefreshToken", TraceAttributeTokenType.String(MetricTokenTypeRefresh))
+
+	token, err := s.TokenIssuer.IssueRefreshToken(ctx, service, subject)
+
+	endSpan(span, err)
+
+	if err != nil {
+		return RefreshToken{}, s.issuerError(MetricTokenTypeRefresh, err)
+	}
+
+	return token, nil
+}
+
+// issuerError classifies token issuer failures (eg. signing errors) as ErrIssuerUnavailable, so they are reported as backend errors.
+//
+// Canceled requests and client errors (eg. requesting a token for an unknown service) are returned unchanged.
+func (s TokenServiceImpl) issuerError(tokenType string, err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrInvalidRequest) {
+		return err
+	}
+
+	s.Dependencies.GetMetrics().IncIssuerFailures(tokenType)
+
+	return fmt.Errorf("%w: %w", ErrIssuerUnavailable, err)
+}
+
+// scopeWarnings describes the requested actions that were not granted (if ScopeWarnings is enabled).
+func (s TokenServiceImpl) scopeWarnings(requestedScopes []Scope, grantedScopes []Scope) []string {
+	if !s.ScopeWarnings {
+		return nil
+	}
+
+	var warnings []string
+
+	for _, scope := range deniedScopes(requestedScopes, grantedScopes) {
+		warnings = append(warnings, fmt.Sprintf("access to %s was not granted", scope))
+	}
+
+	return warnings
+}
+
+func withDPoPKeyThumbprint(ctx context.Context, thumbprint string) context.Context {
+	if thumbprint == "" {
+		return ctx
+	}
+
+	return ContextWithDPoPKeyThumbprint(ctx, thumbprint)
+}
+
+func withAuthenticationMethod(ctx context.Context, method string) context.Context {
+	if method == "" {
+		return ctx
+	}
+
+	return ContextWithAuthenticationMethod(ctx, method)
+}
+
+func tokenType(dpopKeyThumbprint string) string {
+	if dpopKeyThumbprint != "" {
+		return TokenTypeDPoP
+	}
+
+	return ""
+}
+
 // LoggerTokenService acts as a middleware for a TokenService and logs every request.
+//
+// Credentials (passwords, bearer tokens, refresh tokens and assertions) are never logged:
+// failed requests are logged with a reason code (see AuthenticationFailureCause) and an error message with the credentials of the request redacted.
 type LoggerTokenService struct {
 	Service TokenService
 	Logger  *slog.Logger
+
+	// HashSubjectIDs replaces subject identifiers in logs with a salted hash (see HashSubjectID).
+	HashSubjectIDs  bool
+	SubjectHashSalt []byte
+
+	// LogUsernames includes the username presented by the client in logs (even if authentication fails).
+	// Usernames may identify people, so they are not logged by default.
+	LogUsernames bool
+}
+
+// redacted replaces credentials in logs.
+const redacted = "[REDACTED]"
+
+func (s LoggerTokenService) subjectAttr(record *tokenRequestRecord) slog.Attr {
+	if record.subject == nil {
+		return slog.String("subject", "")
+	}
+
+	if s.HashSubjectIDs {
+		return slog.String("subject", HashSubjectID(record.subject.ID(), s.SubjectHashSalt))
+	}
+
+	return slog.String("subject", string(record.subject.ID()))
+}
+
+func (s LoggerTokenService) usernameAttrs(username string) []any {
+	if !s.LogUsernames || username == "" {
+		return nil
+	}
+
+	return []any{slog.String("username", username)}
+}
+
+// failureAttrs returns the attributes of a failed request:
+// the error with every credential of the request redacted and the reason of authentication failures.
+func failureAttrs(record *tokenRequestRecord, err error, credentials ...string) []any {
+	attrs := []any{slog.String("error", redactCredentials(err.Error(), credentials...))}
+
+	if record.authenticationErr != nil {
+		attrs = append(attrs, slog.String("reason", AuthenticationFailureCause(record.authenticationErr)))
+	}
+
+	return attrs
+}
+
+// redactCredentials replaces every occurrence of credentials in s.
+//
+// Errors should not contain credentials in the first place (eg. authenticators should not echo passwords),
+// but they may come from third-party code.
+func redactCredentials(s string, credentials ...string) string {
+	for _, credential := range credentials {
+		if credential == "" {
+			continue
+		}
+
+		s = strings.ReplaceAll(s, credential, redacted)
+	}
+
+	return s
 }
 
 // TokenHandler implements TokenService and logs every request.
 func (s LoggerTokenService) TokenHandler(ctx context.Context, r TokenRequest) (TokenResponse, error) {
+	ctx, record := contextWithTokenRequestRecord(ctx)
+
 	resp, err := s.Service.TokenHandler(ctx, r)
 
 	logger := s.Logger.With(
-		// TODO: correlation ID
+		slog.String("request_id", RequestIDFromContext(ctx)),
 		slog.String("client_id", r.ClientID),
 		slog.String("service", r.Service),
 		slog.String("scopes", r.Scopes.String()),
 		slog.Bool("offline", r.Offline),
 		slog.Bool("anonymous", r.Anonymous),
-	)
+		slog.String("authentication_method", r.AuthenticationMethod()),
+		s.subjectAttr(record),
+	).With(s.usernameAttrs(r.Username)...)
 
 	if err != nil && !(errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrAuthenticationFailed)) {
-		logger.Error("authorization failed", slog.Any("error", err))
+		logger.Error("authorization failed", failureAttrs(record, err, r.Password, r.BearerToken)...)
 	} else if err != nil {
-		logger.Info("authorization failed due to client error", slog.Any("error", err))
+		logger.Info("authorization failed due to client error", failureAttrs(record, err, r.Password, r.BearerToken)...)
 	} else {
 		logger.Info("client authorized")
 	}
@@ -308,21 +870,25 @@ func (s LoggerTokenService) TokenHandler(ctx context.Context, r TokenRequest) (T
 
 // OAuth2Handler implements TokenService and logs every request.
 func (s LoggerTokenService) OAuth2Handler(ctx context.Context, r OAuth2Request) (OAuth2Response, error) {
+	ctx, record := contextWithTokenRequestRecord(ctx)
+
 	resp, err := s.Service.OAuth2Handler(ctx, r)
 
 	logger := s.Logger.With(
-		// TODO: correlation ID
+		slog.String("request_id", RequestIDFromContext(ctx)),
 		slog.String("client_id", r.ClientID),
 		slog.String("service", r.Service),
 		slog.String("scopes", r.Scopes.String()),
 		slog.Bool("offline", r.AccessType == AccessTypeOffline),
 		slog.String("grant_type", r.GrantType),
-	)
+		slog.String("authentication_method", r.AuthenticationMethod()),
+		s.subjectAttr(record),
+	).With(s.usernameAttrs(r.Username)...)
 
 	if err != nil && !(errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrAuthenticationFailed)) {
-		logger.Error("authorization failed", slog.Any("error", err))
+		logger.Error("authorization failed", failureAttrs(record, err, r.Password, r.RefreshToken, r.Assertion)...)
 	} else if err != nil {
-		logger.Info("authorization failed due to client error", slog.Any("error", err))
+		logger.Info("authorization failed due to client error", failureAttrs(record, err, r.Password, r.RefreshToken, r.Assertion)...)
 	} else {
 		logger.Info("client authorized")
 	}
@@ -0,0 +1,575 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type passwordAuthenticatorStub struct {
+	subjects map[string]Subject
+}
+
+func (a passwordAuthenticatorStub) AuthenticatePassword(_ context.Context, username string, _ string) (Subject, error) {
+	subject, ok := a.subjects[username]
+	if !ok {
+		return nil, ErrAuthenticationFailed
+	}
+
+	return subject, nil
+}
+
+type refreshTokenAuthenticatorStub struct {
+	subjects map[string]Subject
+}
+
+func (a refreshTokenAuthenticatorStub) AuthenticateRefreshToken(_ context.Context, _ string, refreshToken string) (Subject, error) {
+	subject, ok := a.subjects[refreshToken]
+	if !ok {
+		return nil, ErrAuthenticationFailed
+	}
+
+	return subject, nil
+}
+
+type authorizerStub struct{}
+
+func (authorizerStub) Authorize(_ context.Context, _ Subject, requestedScopes []Scope) ([]Scope, error) {
+	return requestedScopes, nil
+}
+
+type accessTokenIssuerStub struct {
+	expiration time.Duration
+	now        time.Time
+}
+
+func (i accessTokenIssuerStub) IssueAccessToken(ctx context.Context, _ string, subject Subject, _ []Scope) (AccessToken, error) {
+	payload := "access:anonymous"
+
+	if subject != nil {
+		payload = "access:" + string(subject.ID())
+	}
+
+	if jkt := DPoPKeyThumbprintFromContext(ctx); jkt != "" {
+		payload += ";jkt=" + jkt
+	}
+
+	return AccessToken{
+		Payload:   payload,
+		ExpiresIn: i.expiration,
+		IssuedAt:  i.now,
+	}, nil
+}
+
+type refreshTokenIssuerStub struct {
+	expiration time.Duration
+	now        time.Time
+}
+
+func (i refreshTokenIssuerStub) IssueRefreshToken(_ context.Context, _ string, subject Subject) (RefreshToken, error) {
+	return RefreshToken{
+		Payload:   "refresh:" + string(subject.ID()),
+		ExpiresIn: i.expiration,
+		IssuedAt:  i.now,
+	}, nil
+}
+
+func newTokenServiceStub() TokenServiceImpl {
+	subject := subjectStub{
+		id: "user",
+	}
+
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+
+	return TokenServiceImpl{
+		Authenticator: Authenticator{
+			PasswordAuthenticator: passwordAuthenticatorStub{
+				subjects: map[string]Subject{
+					"user": subject,
+				},
+			},
+			RefreshTokenAuthenticator: refreshTokenAuthenticatorStub{
+				subjects: map[string]Subject{
+					"refresh:user": subject,
+				},
+			},
+		},
+		Authorizer: authorizerStub{},
+		TokenIssuer: TokenIssuer{
+			AccessTokenIssuer: accessTokenIssuerStub{
+				expiration: 15 * time.Minute,
+				now:        now,
+			},
+			RefreshTokenIssuer: refreshTokenIssuerStub{
+				expiration: 24 * time.Hour,
+				now:        now,
+			},
+		},
+	}
+}
+
+func TestTokenServiceImpl_OAuth2Handler_RefreshTokenExpiresIn(t *testing.T) {
+	service := newTokenServiceStub()
+
+	t.Run("NewRefreshToken", func(t *testing.T) {
+		response, err := service.OAuth2Handler(context.Background(), OAuth2Request{
+			GrantType:    GrantTypeRefreshToken,
+			Service:      "service.example.com",
+			ClientID:     "client",
+			AccessType:   AccessTypeOffline,
+			RefreshToken: "refresh:user",
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, "refresh:user", response.RefreshToken)
+		assert.Equal(t, int((24 * time.Hour).Seconds()), response.RefreshTokenExpiresIn)
+	})
+
+	t.Run("ExistingRefreshToken", func(t *testing.T) {
+		response, err := service.OAuth2Handler(context.Background(), OAuth2Request{
+			GrantType:    GrantTypeRefreshToken,
+			Service:      "service.example.com",
+			ClientID:     "client",
+			RefreshToken: "refresh:user",
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, "refresh:user", response.RefreshToken)
+		assert.Zero(t, response.RefreshTokenExpiresIn)
+	})
+}
+
+type authenticationMethodRecorder struct {
+	AccessTokenIssuer
+
+	methods *[]string
+}
+
+func (i authenticationMethodRecorder) IssueAccessToken(ctx context.Context, service string, subject Subject, grantedScopes []Scope) (AccessToken, error) {
+	*i.methods = append(*i.methods, AuthenticationMethodFromContext(ctx))
+
+	return i.AccessTokenIssuer.IssueAccessToken(ctx, service, subject, grantedScopes)
+}
+
+func TestTokenServiceImpl_AuthenticationMethod(t *testing.T) {
+	var methods []string
+
+	service := newTokenServiceStub()
+	service.TokenIssuer.AccessTokenIssuer = authenticationMethodRecorder{
+		AccessTokenIssuer: service.TokenIssuer.AccessTokenIssuer,
+		methods:           &methods,
+	}
+
+	_, err := service.TokenHandler(context.Background(), TokenRequest{
+		Service:  "service.example.com",
+		Username: "user",
+		Password: "password",
+	})
+	require.NoError(t, err)
+
+	_, err = service.TokenHandler(context.Background(), TokenRequest{
+		Service:   "service.example.com",
+		Anonymous: true,
+	})
+	require.NoError(t, err)
+
+	_, err = service.OAuth2Handler(context.Background(), OAuth2Request{
+		GrantType: GrantTypePassword,
+		Service:   "service.example.com",
+		ClientID:  "client",
+		Username:  "user",
+		Password:  "password",
+	})
+	require.NoError(t, err)
+
+	_, err = service.OAuth2Handler(context.Background(), OAuth2Request{
+		GrantType:    GrantTypeRefreshToken,
+		Service:      "service.example.com",
+		ClientID:     "client",
+		RefreshToken: "refresh:user",
+	})
+	require.NoError(t, err)
+
+	expected := []string{
+		AuthenticationMethodPassword,
+		"",
+		AuthenticationMethodPassword,
+		AuthenticationMethodRefreshToken,
+	}
+
+	assert.Equal(t, expected, methods)
+}
+
+// attributeClaimsIssuer maps every subject attribute to the issued token (like a naive claim mapper would).
+type attributeClaimsIssuer struct{}
+
+func (attributeClaimsIssuer) IssueAccessToken(_ context.Context, _ string, subject Subject, _ []Scope) (AccessToken, error) {
+	payload, err := json.Marshal(subject.Attributes())
+	if err != nil {
+		return AccessToken{}, err
+	}
+
+	return AccessToken{Payload: string(payload)}, nil
+}
+
+func (attributeClaimsIssuer) IssueRefreshToken(_ context.Context, _ string, subject Subject) (RefreshToken, error) {
+	payload, err := json.Marshal(subject.Attributes())
+	if err != nil {
+		return RefreshToken{}, err
+	}
+
+	return RefreshToken{Payload: string(payload)}, nil
+}
+
+func TestTokenServiceImpl_StrippedAttributes(t *testing.T) {
+	service := newTokenServiceStub()
+	service.Authenticator.PasswordAuthenticator = passwordAuthenticatorStub{
+		subjects: map[string]Subject{
+			"user": subjectStub{
+				id: "user",
+				attrs: map[string]string{
+					"group":        "team",
+					"userPassword": "{SSHA}secret",
+					"internalId":   "1234",
+				},
+			},
+		},
+	}
+	service.TokenIssuer = TokenIssuer{
+		AccessTokenIssuer:  attributeClaimsIssuer{},
+		RefreshTokenIssuer: attributeClaimsIssuer{},
+		StrippedAttributes: []string{"userPassword", "internalId"},
+	}
+
+	response, err := service.TokenHandler(context.Background(), TokenRequest{
+		Service:  "service.example.com",
+		Offline:  true,
+		Username: "user",
+		Password: "password",
+	})
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{"group": "team"}`, response.Token)
+	assert.JSONEq(t, `{"group": "team"}`, response.RefreshToken)
+}
+
+type notBeforeRecorder struct {
+	AccessTokenIssuer
+
+	notBefore *time.Time
+}
+
+func (i notBeforeRecorder) IssueAccessToken(ctx context.Context, service string, subject Subject, grantedScopes []Scope) (AccessToken, error) {
+	*i.notBefore = NotBeforeFromContext(ctx)
+
+	return i.AccessTokenIssuer.IssueAccessToken(ctx, service, subject, grantedScopes)
+}
+
+func TestTokenServiceImpl_ScheduledTokens(t *testing.T) {
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+
+	var notBefore time.Time
+
+	service := newTokenServiceStub()
+	service.Authenticator.PasswordAuthenticator = passwordAuthenticatorStub{
+		subjects: map[string]Subject{
+			"ci":   subjectStub{id: "ci", attrs: map[string]string{"role": "ci"}},
+			"user": subjectStub{id: "user"},
+		},
+	}
+	service.TokenIssuer.AccessTokenIssuer = notBeforeRecorder{
+		AccessTokenIssuer: service.TokenIssuer.AccessTokenIssuer,
+		notBefore:         &notBefore,
+	}
+	service.ScheduledTokens = ScheduledTokens{
+		MaxDelay:          24 * time.Hour,
+		SubjectAttributes: map[string]string{"role": "ci"},
+	}
+	service.Dependencies.Clock = clockwork.NewFakeClockAt(now)
+
+	request := func(username string, notBefore time.Time) OAuth2Request {
+		return OAuth2Request{
+			GrantType: GrantTypePassword,
+			Service:   "service.example.com",
+			ClientID:  "client",
+			Username:  username,
+			Password:  "password",
+			NotBefore: notBefore,
+		}
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		_, err := service.OAuth2Handler(context.Background(), request("ci", now.Add(6*time.Hour)))
+		require.NoError(t, err)
+
+		assert.Equal(t, now.Add(6*time.Hour), notBefore)
+	})
+
+	t.Run("BeyondWindow", func(t *testing.T) {
+		_, err := service.OAuth2Handler(context.Background(), request("ci", now.Add(25*time.Hour)))
+		require.ErrorIs(t, err, ErrInvalidRequest)
+	})
+
+	t.Run("Unprivileged", func(t *testing.T) {
+		_, err := service.OAuth2Handler(context.Background(), request("user", now.Add(time.Hour)))
+		require.ErrorIs(t, err, ErrUnauthorized)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		service := service
+		service.ScheduledTokens = ScheduledTokens{}
+
+		_, err := service.OAuth2Handler(context.Background(), request("ci", now.Add(time.Hour)))
+		require.ErrorIs(t, err, ErrInvalidRequest)
+	})
+}
+
+func TestTokenServiceImpl_OAuth2Handler_PasswordFallback(t *testing.T) {
+	newService := func(fallback bool) TokenServiceImpl {
+		service := newTokenServiceStub()
+		service.Authenticator.BearerTokenAuthenticator = bearerTokenAuthenticatorStub{
+			subjects: map[string]Subject{
+				"id-token": subjectStub{id: "oidc-user"},
+			},
+		}
+		service.PasswordFallback = fallback
+
+		return service
+	}
+
+	newRequest := func(assertion string, username string) OAuth2Request {
+		return OAuth2Request{
+			GrantType:  GrantTypeJWTBearer,
+			Service:    "service.example.com",
+			ClientID:   "client",
+			AccessType: AccessTypeOffline,
+			Assertion:  assertion,
+			Username:   username,
+			Password:   "password",
+		}
+	}
+
+	t.Run("Exchange", func(t *testing.T) {
+		response, err := newService(true).OAuth2Handler(context.Background(), newRequest("id-token", "user"))
+		require.NoError(t, err)
+
+		assert.Equal(t, "access:oidc-user", response.Token)
+		assert.Empty(t, response.RefreshToken)
+	})
+
+	t.Run("InvalidAssertion", func(t *testing.T) {
+		response, err := newService(true).OAuth2Handler(context.Background(), newRequest("forged", "user"))
+		require.NoError(t, err)
+
+		assert.Equal(t, "access:user", response.Token)
+
+		// Subjects authenticated with a password are known to the subject repository
+		assert.Equal(t, "refresh:user", response.RefreshToken)
+	})
+
+	t.Run("MissingAssertion", func(t *testing.T) {
+		response, err := newService(true).OAuth2Handler(context.Background(), newRequest("", "user"))
+		require.NoError(t, err)
+
+		assert.Equal(t, "access:user", response.Token)
+	})
+
+	t.Run("BothFailing", func(t *testing.T) {
+		_, err := newService(true).OAuth2Handler(context.Background(), newRequest("forged", "unknown"))
+		require.ErrorIs(t, err, ErrAuthenticationFailed)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		_, err := newService(false).OAuth2Handler(context.Background(), newRequest("forged", "user"))
+		require.ErrorIs(t, err, ErrInvalidCredentials)
+
+		_, err = newService(false).OAuth2Handler(context.Background(), newRequest("", "user"))
+		require.ErrorIs(t, err, ErrInvalidRequest)
+	})
+}
+
+func TestTokenServiceImpl_ScopeWarnings(t *testing.T) {
+	scopes := Scopes{
+		{Resource: Resource{Type: "repository", Name: "user/app"}, Actions: []string{"pull", "push"}},
+		{Resource: Resource{Type: "repository", Name: "library/alpine"}, Actions: []string{"pull", "push"}},
+		{Resource: Resource{Type: "repository", Name: "other/app"}, Actions: []string{"pull"}},
+	}
+
+	newService := func(enabled bool) TokenServiceImpl {
+		service := newTokenServiceStub()
+		service.Authorizer = namespaceAuthorizerStub{}
+		service.ScopeWarnings = enabled
+
+		return service
+	}
+
+	expectedWarnings := []string{
+		"access to repository:library/alpine:push was not granted",
+		"access to repository:other/app:pull was not granted",
+	}
+
+	t.Run("TokenHandler", func(t *testing.T) {
+		response, err := newService(true).TokenHandler(context.Background(), TokenRequest{
+			Service:  "service.example.com",
+			Scopes:   scopes,
+			Username: "user",
+			Password: "password",
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, expectedWarnings, response.Warnings)
+	})
+
+	t.Run("OAuth2Handler", func(t *testing.T) {
+		response, err := newService(true).OAuth2Handler(context.Background(), OAuth2Request{
+			GrantType: GrantTypePassword,
+			Service:   "service.example.com",
+			ClientID:  "client",
+			Scopes:    scopes,
+			Username:  "user",
+			Password:  "password",
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, expectedWarnings, response.Warnings)
+	})
+
+	t.Run("AllGranted", func(t *testing.T) {
+		response, err := newService(true).TokenHandler(context.Background(), TokenRequest{
+			Service:  "service.example.com",
+			Scopes:   scopes[:1],
+			Username: "user",
+			Password: "password",
+		})
+		require.NoError(t, err)
+
+		assert.Empty(t, response.Warnings)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		response, err := newService(false).TokenHandler(context.Background(), TokenRequest{
+			Service:  "service.example.com",
+			Scopes:   scopes,
+			Username: "user",
+			Password: "password",
+		})
+		require.NoError(t, err)
+
+		assert.Empty(t, response.Warnings)
+
+		data, err := json.Marshal(response)
+		require.NoError(t, err)
+
+		assert.NotContains(t, string(data), "warnings")
+	})
+}
+
+// publicAuthorizerStub grants pull access to the library namespace to everyone (including anonymous subjects)
+// and full access to authenticated subjects.
+type publicAuthorizerStub struct {
+	calls *int
+}
+
+func (a publicAuthorizerStub) Authorize(_ context.Context, subject Subject, requestedScopes []Scope) ([]Scope, error) {
+	*a.calls++
+
+	if subject != nil {
+		return requestedScopes, nil
+	}
+
+	var grantedScopes []Scope
+
+	for _, scope := range requestedScopes {
+		if strings.HasPrefix(scope.Name, "library/") && slices.Contains(scope.Actions, "pull") {
+			grantedScopes = append(grantedScopes, Scope{Resource: scope.Resource, Actions: []string{"pull"}})
+		}
+	}
+
+	return grantedScopes, nil
+}
+
+func TestTokenServiceImpl_AnonymousAccess(t *testing.T) {
+	newService := func(anonymousAccess string) (TokenServiceImpl, *int) {
+		var calls int
+
+		service := newTokenServiceStub()
+		service.Authorizer = publicAuthorizerStub{calls: &calls}
+		service.AnonymousAccess = anonymousAccess
+		service.ScopeWarnings = true
+
+		return service, &calls
+	}
+
+	request := TokenRequest{
+		Service:   "service.example.com",
+		Anonymous: true,
+		Scopes: Scopes{
+			{Resource: Resource{Type: "repository", Name: "library/alpine"}, Actions: []string{"pull", "push"}},
+			{Resource: Resource{Type: "repository", Name: "private/app"}, Actions: []string{"pull"}},
+		},
+	}
+
+	t.Run("Authorize", func(t *testing.T) {
+		service, calls := newService(AnonymousAccessAuthorize)
+
+		response, err := service.TokenHandler(context.Background(), request)
+		require.NoError(t, err)
+
+		assert.Equal(t, "access:anonymous", response.Token)
+		assert.Equal(t, []string{
+			"access to repository:library/alpine:push was not granted",
+			"access to repository:private/app:pull was not granted",
+		}, response.Warnings)
+		assert.Equal(t, 1, *calls)
+	})
+
+	t.Run("Default", func(t *testing.T) {
+		service, calls := newService("")
+
+		response, err := service.TokenHandler(context.Background(), request)
+		require.NoError(t, err)
+
+		assert.Equal(t, "access:anonymous", response.Token)
+		assert.Equal(t, 1, *calls)
+	})
+
+	t.Run("EmptyScope", func(t *testing.T) {
+		service, _ := newService(AnonymousAccessAuthorize)
+
+		response, err := service.TokenHandler(context.Background(), TokenRequest{
+			Service:   "service.example.com",
+			Anonymous: true,
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, "access:anonymous", response.Token)
+		assert.Empty(t, response.Warnings)
+	})
+
+	t.Run("Deny", func(t *testing.T) {
+		service, calls := newService(AnonymousAccessDeny)
+
+		_, err := service.TokenHandler(context.Background(), request)
+		require.ErrorIs(t, err, ErrUnauthorized)
+
+		assert.Equal(t, 0, *calls)
+
+		// Authenticated requests are not affected
+		response, err := service.TokenHandler(context.Background(), TokenRequest{
+			Service:  "service.example.com",
+			Scopes:   request.Scopes,
+			Username: "user",
+			Password: "password",
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, "access:user", response.Token)
+	})
+}
@@ -1,5 +1,11 @@
 package auth
 
+import (
+	"maps"
+	"slices"
+	"time"
+)
+
 // Attribute keys
 const (
 	// SubjectName is an attribute key for Subject providing an alternate name.
@@ -53,3 +59,165 @@ func GetSubjectName(subject Subject) string {
 
 	return name
 }
+
+// GetSubjectAuthTime returns the time a Subject originally authenticated at (eg. when the first token in a refresh token chain was issued).
+//
+// The second return value is false if the Subject does not provide this information.
+func GetSubjectAuthTime(subject Subject) (time.Time, bool) {
+	s, ok := subject.(interface{ AuthTime() time.Time })
+	if !ok {
+		return time.Time{}, false
+	}
+
+	authTime := s.AuthTime()
+
+	return authTime, !authTime.IsZero()
+}
+
+// GetSubjectSessionID returns the session a Subject belongs to (eg. the refresh token family it authenticated with).
+//
+// The second return value is false if the Subject does not provide this information.
+func GetSubjectSessionID(subject Subject) (string, bool) {
+	s, ok := subject.(interface{ SessionID() string })
+	if !ok {
+		return "", false
+	}
+
+	sessionID := s.SessionID()
+
+	return sessionID, sessionID != ""
+}
+
+// Identity is common, typed identity information about a Subject.
+//
+// It complements Subject.Attributes (which remains the place for arbitrary, provider specific information).
+type Identity struct {
+	Email       string
+	DisplayName string
+	Groups      []string
+}
+
+// GetSubjectIdentity returns typed identity information about a Subject.
+//
+// The second return value is false if the Subject does not provide this information.
+func GetSubjectIdentity(subject Subject) (Identity, bool) {
+	s, ok := subject.(interface{ Identity() (Identity, bool) })
+	if !ok {
+		return Identity{}, false
+	}
+
+	return s.Identity()
+}
+
+// StripSubjectAttributes returns a Subject hiding the attributes listed in keys.
+//
+// It returns subject unchanged if it is nil or there is nothing to strip.
+// Optional information (eg. GetSubjectAuthTime, GetSubjectSessionID and GetSubjectIdentity) is preserved.
+func StripSubjectAttributes(subject Subject, keys []string) Subject {
+	if subject == nil || len(keys) == 0 {
+		return subject
+	}
+
+	return strippedSubject{
+		Subject: subject,
+		keys:    keys,
+	}
+}
+
+// strippedSubject hides attributes of a Subject.
+type strippedSubject struct {
+	Subject
+
+	keys []string
+}
+
+func (s strippedSubject) Attribute(key string) (string, bool) {
+	if slices.Contains(s.keys, key) {
+		return "", false
+	}
+
+	return s.Subject.Attribute(key)
+}
+
+func (s strippedSubject) Attributes() map[string]string {
+	attrs := maps.Clone(s.Subject.Attributes())
+
+	for _, key := range s.keys {
+		delete(attrs, key)
+	}
+
+	return attrs
+}
+
+func (s strippedSubject) AuthTime() time.Time {
+	authTime, _ := GetSubjectAuthTime(s.Subject)
+
+	return authTime
+}
+
+func (s strippedSubject) SessionID() string {
+	sessionID, _ := GetSubjectSessionID(s.Subject)
+
+	return sessionID
+}
+
+func (s strippedSubject) Identity() (Identity, bool) {
+	return GetSubjectIdentity(s.Subject)
+}
+
+// MergeSubjectAttributes returns a Subject carrying additional attributes.
+//
+// Attributes of subject take precedence over attrs.
+// It returns subject unchanged if it is nil or there is nothing to merge.
+// Optional information (eg. GetSubjectAuthTime, GetSubjectSessionID and GetSubjectIdentity) is preserved.
+func MergeSubjectAttributes(subject Subject, attrs map[string]string) Subject {
+	if subject == nil || len(attrs) == 0 {
+		return subject
+	}
+
+	return mergedSubject{
+		Subject: subject,
+		attrs:   attrs,
+	}
+}
+
+// mergedSubject adds attributes to a Subject.
+type mergedSubject struct {
+	Subject
+
+	attrs map[string]string
+}
+
+func (s mergedSubject) Attribute(key string) (string, bool) {
+	if v, ok := s.Subject.Attribute(key); ok {
+		return v, true
+	}
+
+	v, ok := s.attrs[key]
+
+	return v, ok
+}
+
+func (s mergedSubject) Attributes() map[string]string {
+	attrs := maps.Clone(s.attrs)
+
+	maps.Copy(attrs, s.Subject.Attributes())
+
+	return attrs
+}
+
+func (s mergedSubject) AuthTime() time.Time {
+	authTime, _ := GetSubjectAuthTime(s.Subject)
+
+	return authTime
+}
+
+func (s mergedSubject) SessionID() string {
+	sessionID, _ := GetSubjectSessionID(s.Subject)
+
+	return sessionID
+}
+
+func (s mergedSubject) Identity() (Identity, bool) {
+	return GetSubjectIdentity(s.Subject)
+}
@@ -58,3 +58,47 @@ func TestGetSubjectName(t *testing.T) {
 		assert.Equal(t, name, subjectName)
 	})
 }
+
+type identitySubjectStub struct {
+	subjectStub
+
+	identity Identity
+	ok       bool
+}
+
+// Identity implements the optional identity interface of subjects.
+func (s identitySubjectStub) Identity() (Identity, bool) {
+	return s.identity, s.ok
+}
+
+func TestGetSubjectIdentity_Wrapped(t *testing.T) {
+	identity := Identity{Email: "user@example.com", Groups: []string{"developers"}}
+
+	t.Run("Identity", func(t *testing.T) {
+		s := identitySubjectStub{subjectStub: subjectStub{id: "id"}, identity: identity, ok: true}
+
+		for _, wrapped := range []Subject{
+			StripSubjectAttributes(s, []string{"key"}),
+			MergeSubjectAttributes(s, map[string]string{"key": "value"}),
+		} {
+			actual, ok := GetSubjectIdentity(wrapped)
+			assert.True(t, ok)
+			assert.Equal(t, identity, actual)
+		}
+	})
+
+	t.Run("NoIdentity", func(t *testing.T) {
+		for _, s := range []Subject{
+			subjectStub{id: "id"},
+			identitySubjectStub{subjectStub: subjectStub{id: "id"}},
+		} {
+			for _, wrapped := range []Subject{
+				StripSubjectAttributes(s, []string{"key"}),
+				MergeSubjectAttributes(s, map[string]string{"key": "value"}),
+			} {
+				_, ok := GetSubjectIdentity(wrapped)
+				assert.False(t, ok)
+			}
+		}
+	})
+}
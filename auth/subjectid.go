@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SubjectIDTemplate composes a SubjectID from multiple claims of an upstream identity (eg. {iss}|{sub}),
+// so that subjects federated from different providers get globally unique identifiers.
+//
+// Claims are referenced by name in braces. Every referenced claim is required.
+type SubjectIDTemplate struct {
+	template string
+
+	// parts alternate between literals (even indexes) and claim names (odd indexes)
+	parts []string
+}
+
+// ParseSubjectIDTemplate parses a SubjectIDTemplate.
+func ParseSubjectIDTemplate(template string) (SubjectIDTemplate, error) {
+	var parts []string
+
+	rest := template
+
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			if strings.IndexByte(rest, '}') >= 0 {
+				return SubjectIDTemplate{}, fmt.Errorf("subject ID template %q: unexpected }", template)
+			}
+
+			parts = append(parts, rest)
+
+			break
+		}
+
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return SubjectIDTemplate{}, fmt.Errorf("subject ID template %q: unclosed {", template)
+		}
+
+		literal, claim := rest[:start], rest[start+1:start+end]
+
+		if strings.IndexByte(literal, '}') >= 0 {
+			return SubjectIDTemplate{}, fmt.Errorf("subject ID template %q: unexpected }", template)
+		}
+
+		if claim == "" || strings.IndexByte(claim, '{') >= 0 {
+			return SubjectIDTemplate{}, fmt.Errorf("subject ID template %q: invalid claim name %q", template, claim)
+		}
+
+		parts = append(parts, literal, claim)
+		rest = rest[start+end+1:]
+	}
+
+	if len(parts) < 2 {
+		return SubjectIDTemplate{}, errors.New("subject ID template must reference at least one claim")
+	}
+
+	return SubjectIDTemplate{
+		template: template,
+		parts:    parts,
+	}, nil
+}
+
+// Claims returns the names of the claims referenced by the template.
+func (t SubjectIDTemplate) Claims() []string {
+	var claims []string
+
+	for i := 1; i < len(t.parts); i += 2 {
+		claims = append(claims, t.parts[i])
+	}
+
+	return claims
+}
+
+// Execute composes a SubjectID from claims.
+//
+// It returns an ErrInvalidCredentials error if a referenced claim is missing or empty.
+func (t SubjectIDTemplate) Execute(claims map[string]string) (SubjectID, error) {
+	var b strings.Builder
+
+	for i, part := range t.parts {
+		if i%2 == 0 {
+			b.WriteString(part)
+
+			continue
+		}
+
+		value := claims[part]
+		if value == "" {
+			return "", fmt.Errorf("%w: missing claim %q", ErrInvalidCredentials, part)
+		}
+
+		b.WriteString(value)
+	}
+
+	return SubjectID(b.String()), nil
+}
+
+// String returns the template in its original form.
+func (t SubjectIDTemplate) String() string {
+	return t.template
+}
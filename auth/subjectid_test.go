@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubjectIDTemplate(t *testing.T) {
+	template, err := ParseSubjectIDTemplate("{iss}|{sub}")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"iss", "sub"}, template.Claims())
+
+	t.Run("OK", func(t *testing.T) {
+		id, err := template.Execute(map[string]string{
+			"iss": "https://accounts.example.com",
+			"sub": "1234",
+			"aud": "registry",
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, SubjectID("https://accounts.example.com|1234"), id)
+	})
+
+	t.Run("MissingClaim", func(t *testing.T) {
+		_, err := template.Execute(map[string]string{
+			"sub": "1234",
+		})
+		require.ErrorIs(t, err, ErrInvalidCredentials)
+
+		assert.ErrorContains(t, err, `"iss"`)
+	})
+}
+
+func TestParseSubjectIDTemplate_Invalid(t *testing.T) {
+	for _, template := range []string{"", "static", "{iss", "iss}|{sub}", "{}", "{i{ss}", "{iss}}"} {
+		_, err := ParseSubjectIDTemplate(template)
+		assert.Error(t, err, template)
+	}
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+)
+
+// ClientCertificate is identity information from a verified TLS client certificate.
+type ClientCertificate struct {
+	CommonName     string
+	DNSNames       []string
+	EmailAddresses []string
+	URIs           []string
+}
+
+// NewClientCertificate extracts identity information from cert.
+func NewClientCertificate(cert *x509.Certificate) ClientCertificate {
+	clientCertificate := ClientCertificate{
+		CommonName:     cert.Subject.CommonName,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+	}
+
+	for _, uri := range cert.URIs {
+		clientCertificate.URIs = append(clientCertificate.URIs, uri.String())
+	}
+
+	return clientCertificate
+}
+
+type clientCertificateContextKey struct{}
+
+// ContextWithClientCertificate returns a copy of ctx carrying a verified client certificate.
+func ContextWithClientCertificate(ctx context.Context, cert ClientCertificate) context.Context {
+	return context.WithValue(ctx, clientCertificateContextKey{}, cert)
+}
+
+// ClientCertificateFromContext returns the verified client certificate stored in ctx (if any).
+//
+// Authenticators and authorizers may use it to identify the client (eg. a CI system) presenting the certificate.
+func ClientCertificateFromContext(ctx context.Context) (ClientCertificate, bool) {
+	cert, ok := ctx.Value(clientCertificateContextKey{}).(ClientCertificate)
+
+	return cert, ok
+}
+
+// ClientCertificateMiddleware stores the verified client certificate of a mutual TLS connection in the request context.
+//
+// Only certificates verified by the TLS server (ie. part of a verified chain) are stored,
+// so the server has to be configured to verify client certificates (eg. tls.RequireAndVerifyClientCert).
+func ClientCertificateMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			cert := NewClientCertificate(r.TLS.VerifiedChains[0][0])
+
+			r = r.WithContext(ContextWithClientCertificate(r.Context(), cert))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,400 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// ErrCertificateRevoked is returned when a client certificate (or one of its issuers) is revoked.
+var ErrCertificateRevoked = errors.New("certificate revoked")
+
+// DefaultOCSPTimeout is the default deadline of an OCSP request.
+const DefaultOCSPTimeout = 5 * time.Second
+
+// DefaultCRLReloadInterval is the default interval CRLFile is reloaded at.
+const DefaultCRLReloadInterval = time.Hour
+
+// revocationClockSkew tolerates clock differences between the server and the issuers of CRLs and OCSP responses.
+const revocationClockSkew = 5 * time.Minute
+
+// maxOCSPCacheEntries bounds the number of cached OCSP responses.
+const maxOCSPCacheEntries = 10_000
+
+// ClientCertificateRevocationChecker rejects revoked client certificates, even if they are otherwise valid.
+//
+// Every certificate of the verified chain (except the root) is looked up in the CRLs issued by its issuer.
+// Certificates covered by a CRL past its next update are rejected: the CRL may be missing recent revocations.
+// If OCSP is enabled, the responder listed in the client certificate is asked about its status as well
+// (certificates without a responder are only checked against CRLs).
+// OCSP responses are cached until their next update; stale or future-dated responses are rejected.
+//
+// Register VerifyConnection as [tls.Config.VerifyConnection] to reject revoked certificates during the handshake.
+// ClientCertificateRevocationChecker must not be copied after first use.
+type ClientCertificateRevocationChecker struct {
+	// CRLs are certificate revocation lists issued by the client CAs (or their intermediates).
+	CRLs []*x509.RevocationList
+
+	// CRLFile contains additional certificate revocation lists (see [LoadRevocationListFile]).
+	// It is loaded by LoadCRLFile and reloaded periodically by Run, so that updated lists are picked up without a restart.
+	CRLFile string
+
+	// CRLReloadInterval is the interval Run reloads CRLFile at (defaults to DefaultCRLReloadInterval).
+	CRLReloadInterval time.Duration
+
+	// OCSP enables checking the status of client certificates using OCSP.
+	OCSP bool
+
+	// OCSPSoftFail accepts certificates if their status cannot be determined (eg. the responder is unreachable).
+	// By default, such certificates are rejected.
+	OCSPSoftFail bool
+
+	// OCSPTimeout limits the time an OCSP request may take during a handshake (defaults to DefaultOCSPTimeout).
+	OCSPTimeout time.Duration
+
+	// HTTPClient sends OCSP requests.
+	// Defaults to a client with OCSPTimeout.
+	HTTPClient *http.Client
+
+	// Clock decides whether CRLs and OCSP responses are fresh (defaults to the system clock).
+	Clock Clock
+
+	// Logger reports failures to reload CRLFile (defaults to discarding messages).
+	Logger *slog.Logger
+
+	mu        sync.RWMutex
+	fileCRLs  []*x509.RevocationList
+	ocspCache map[string]ocspCacheEntry
+}
+
+type ocspCacheEntry struct {
+	status     int
+	nextUpdate time.Time
+}
+
+// VerifyConnection rejects connections presenting a revoked client certificate.
+//
+// It is meant to be used as [tls.Config.VerifyConnection].
+func (c *ClientCertificateRevocationChecker) VerifyConnection(state tls.ConnectionState) error {
+	// The handshake has no context: bound the time OCSP requests may take
+	ctx, cancel := context.WithTimeout(context.Background(), c.ocspTimeout())
+	defer cancel()
+
+	for _, chain := range state.VerifiedChains {
+		if err := c.CheckChain(ctx, chain); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CheckChain checks whether any certificate of a verified chain (from the leaf to the root) is revoked.
+func (c *ClientCertificateRevocationChecker) CheckChain(ctx context.Context, chain []*x509.Certificate) error {
+	// The root is trusted explicitly
+	for i := 0; i < len(chain)-1; i++ {
+		if err := c.checkCRLs(chain[i], chain[i+1]); err != nil {
+			return err
+		}
+	}
+
+	if c.OCSP && len(chain) > 1 {
+		if err := c.checkOCSP(ctx, chain[0], chain[1]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LoadCRLFile (re)loads the certificate revocation lists in CRLFile.
+//
+// The previously loaded lists are kept if loading fails.
+func (c *ClientCertificateRevocationChecker) LoadCRLFile() error {
+	if c.CRLFile == "" {
+		return nil
+	}
+
+	crls, err := LoadRevocationListFile(c.CRLFile)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.fileCRLs = crls
+
+	return nil
+}
+
+// Run implements [Runner]: it reloads CRLFile every CRLReloadInterval until ctx is canceled.
+//
+// Failing to reload CRLFile is logged: the previously loaded lists stay in use until they become stale.
+func (c *ClientCertificateRevocationChecker) Run(ctx context.Context) error {
+	if c.CRLFile == "" {
+		<-ctx.Done()
+
+		return nil
+	}
+
+	interval := c.CRLReloadInterval
+	if interval <= 0 {
+		interval = DefaultCRLReloadInterval
+	}
+
+	logger := c.Logger
+	if logger == nil {
+		logger = Dependencies{}.GetLogger()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-ticker.C:
+			if err := c.LoadCRLFile(); err != nil {
+				logger.Warn(fmt.Sprintf("reloading certificate revocation lists: %v", err), slog.String("file", c.CRLFile))
+			}
+		}
+	}
+}
+
+func (c *ClientCertificateRevocationChecker) checkCRLs(cert *x509.Certificate, issuer *x509.Certificate) error {
+	c.mu.RLock()
+	crls := append(slices.Clip(c.CRLs), c.fileCRLs...)
+	c.mu.RUnlock()
+
+	now := c.now()
+
+	for _, crl := range crls {
+		if !bytes.Equal(crl.RawIssuer, cert.RawIssuer) {
+			continue
+		}
+
+		// CRLs not signed by the issuer of the certificate cannot revoke it
+		if err := crl.CheckSignatureFrom(issuer); err != nil {
+			continue
+		}
+
+		for _, entry := range crl.RevokedCertificateEntries {
+			if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				return fmt.Errorf("%w: %s (serial %s)", ErrCertificateRevoked, cert.Subject, cert.SerialNumber)
+			}
+		}
+
+		// A stale list may be missing recent revocations
+		if !crl.NextUpdate.IsZero() && now.After(crl.NextUpdate.Add(revocationClockSkew)) {
+			return fmt.Errorf("checking certificate status: certificate revocation list of %s expired at %s", crl.Issuer, crl.NextUpdate.UTC().Format(time.RFC3339))
+		}
+	}
+
+	return nil
+}
+
+func (c *ClientCertificateRevocationChecker) checkOCSP(ctx context.Context, cert *x509.Certificate, issuer *x509.Certificate) error {
+	if len(cert.OCSPServer) == 0 {
+		return nil
+	}
+
+	status, err := c.ocspStatus(ctx, cert.OCSPServer[0], cert, issuer)
+	if err != nil {
+		if c.OCSPSoftFail {
+			return nil
+		}
+
+		return fmt.Errorf("checking certificate status: %w", err)
+	}
+
+	switch status {
+	case ocsp.Good:
+		return nil
+
+	case ocsp.Revoked:
+		return fmt.Errorf("%w: %s (serial %s)", ErrCertificateRevoked, cert.Subject, cert.SerialNumber)
+	}
+
+	if c.OCSPSoftFail {
+		return nil
+	}
+
+	return fmt.Errorf("checking certificate status: unknown status of %s (serial %s)", cert.Subject, cert.SerialNumber)
+}
+
+func (c *ClientCertificateRevocationChecker) ocspStatus(ctx context.Context, server string, cert *x509.Certificate, issuer *x509.Certificate) (int, error) {
+	cacheKey := string(issuer.RawSubjectPublicKeyInfo) + "|" + cert.SerialNumber.String()
+
+	now := c.now()
+
+	c.mu.RLock()
+	entry, ok := c.ocspCache[cacheKey]
+	c.mu.RUnlock()
+
+	if ok && now.Before(entry.nextUpdate) {
+		return entry.status, nil
+	}
+
+	response, err := c.requestOCSP(ctx, server, cert, issuer)
+	if err != nil {
+		return 0, err
+	}
+
+	if response.ThisUpdate.After(now.Add(revocationClockSkew)) {
+		return 0, fmt.Errorf("ocsp responder %s: response is not valid until %s", server, response.ThisUpdate.UTC().Format(time.RFC3339))
+	}
+
+	if !response.NextUpdate.IsZero() && now.After(response.NextUpdate.Add(revocationClockSkew)) {
+		return 0, fmt.Errorf("ocsp responder %s: response expired at %s", server, response.NextUpdate.UTC().Format(time.RFC3339))
+	}
+
+	// Responses without a next update may change any time, so they are not cached
+	if !response.NextUpdate.IsZero() && response.Status != ocsp.Unknown {
+		c.cacheOCSPStatus(cacheKey, ocspCacheEntry{status: response.Status, nextUpdate: response.NextUpdate}, now)
+	}
+
+	return response.Status, nil
+}
+
+func (c *ClientCertificateRevocationChecker) cacheOCSPStatus(key string, entry ocspCacheEntry, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ocspCache == nil {
+		c.ocspCache = make(map[string]ocspCacheEntry)
+	}
+
+	if len(c.ocspCache) >= maxOCSPCacheEntries {
+		for k, v := range c.ocspCache {
+			if !now.Before(v.nextUpdate) {
+				delete(c.ocspCache, k)
+			}
+		}
+
+		// Responses are requested again once the cache has room
+		if len(c.ocspCache) >= maxOCSPCacheEntries {
+			return
+		}
+	}
+
+	c.ocspCache[key] = entry
+}
+
+func (c *ClientCertificateRevocationChecker) requestOCSP(ctx context.Context, server string, cert *x509.Certificate, issuer *x509.Certificate) (*ocsp.Response, error) {
+	body, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/ocsp-request")
+
+	client := c.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: c.ocspTimeout()}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ocsp responder %s: unexpected status code %d", server, resp.StatusCode)
+	}
+
+	// OCSP responses are small, don't let a misbehaving responder exhaust memory
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := ocsp.ParseResponseForCert(b, cert, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("ocsp responder %s: %w", server, err)
+	}
+
+	return response, nil
+}
+
+func (c *ClientCertificateRevocationChecker) ocspTimeout() time.Duration {
+	if c.OCSPTimeout <= 0 {
+		return DefaultOCSPTimeout
+	}
+
+	return c.OCSPTimeout
+}
+
+func (c *ClientCertificateRevocationChecker) now() time.Time {
+	if c.Clock == nil {
+		return Dependencies{}.GetClock().Now()
+	}
+
+	return c.Clock.Now()
+}
+
+// LoadRevocationListFile loads certificate revocation lists from a file (either PEM encoded "X509 CRL" blocks or a single DER encoded list).
+func LoadRevocationListFile(file string) ([]*x509.RevocationList, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Contains(b, []byte("-----BEGIN")) {
+		crl, err := x509.ParseRevocationList(b)
+		if err != nil {
+			return nil, err
+		}
+
+		return []*x509.RevocationList{crl}, nil
+	}
+
+	var crls []*x509.RevocationList
+
+	for {
+		var block *pem.Block
+
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "X509 CRL" {
+			continue
+		}
+
+		crl, err := x509.ParseRevocationList(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		crls = append(crls, crl)
+	}
+
+	if len(crls) == 0 {
+		return nil, errors.New("file does not contain any certificate revocation lists")
+	}
+
+	return crls, nil
+}
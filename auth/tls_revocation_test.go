@@ -0,0 +1,370 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func newTestCA(t *testing.T) testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return testCA{cert: cert, key: key}
+}
+
+func (ca testCA) issue(t *testing.T, serial int64, ocspServer string) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "ci.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	if ocspServer != "" {
+		template.OCSPServer = []string{ocspServer}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return cert
+}
+
+func (ca testCA) revocationList(t *testing.T, revokedSerials ...int64) *x509.RevocationList {
+	t.Helper()
+
+	return ca.revocationListUntil(t, time.Now().Add(time.Hour), revokedSerials...)
+}
+
+func (ca testCA) revocationListUntil(t *testing.T, nextUpdate time.Time, revokedSerials ...int64) *x509.RevocationList {
+	t.Helper()
+
+	template := &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: nextUpdate.Add(-2 * time.Hour),
+		NextUpdate: nextUpdate,
+	}
+
+	for _, serial := range revokedSerials {
+		template.RevokedCertificateEntries = append(template.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   big.NewInt(serial),
+			RevocationTime: time.Now().Add(-time.Minute),
+		})
+	}
+
+	der, err := x509.CreateRevocationList(rand.Reader, template, ca.cert, ca.key)
+	require.NoError(t, err)
+
+	crl, err := x509.ParseRevocationList(der)
+	require.NoError(t, err)
+
+	return crl
+}
+
+// ocspResponder responds to OCSP requests of certificates issued by ca, reporting the listed serials as revoked.
+func (ca testCA) ocspResponder(t *testing.T, revokedSerials ...int64) *httptest.Server {
+	t.Helper()
+
+	return ca.ocspResponderUntil(t, time.Now().Add(time.Hour), nil, revokedSerials...)
+}
+
+// ocspResponderUntil is like ocspResponder, but responses are valid until nextUpdate and requests are counted.
+func (ca testCA) ocspResponderUntil(t *testing.T, nextUpdate time.Time, requests *atomic.Int32, revokedSerials ...int64) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests != nil {
+			requests.Add(1)
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		req, err := ocsp.ParseRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		template := ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   nextUpdate.Add(-2 * time.Hour),
+			NextUpdate:   nextUpdate,
+		}
+
+		for _, serial := range revokedSerials {
+			if req.SerialNumber.Cmp(big.NewInt(serial)) == 0 {
+				template.Status = ocsp.Revoked
+				template.RevokedAt = time.Now().Add(-time.Minute)
+			}
+		}
+
+		resp, err := ocsp.CreateResponse(ca.cert, ca.cert, template, ca.key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		_, _ = w.Write(resp)
+	}))
+
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestClientCertificateRevocationChecker_CRL(t *testing.T) {
+	ca := newTestCA(t)
+
+	goodCert := ca.issue(t, 2, "")
+	revokedCert := ca.issue(t, 3, "")
+
+	checker := &ClientCertificateRevocationChecker{
+		CRLs: []*x509.RevocationList{ca.revocationList(t, 3)},
+	}
+
+	t.Run("Good", func(t *testing.T) {
+		err := checker.VerifyConnection(tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{goodCert, ca.cert}},
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("Revoked", func(t *testing.T) {
+		err := checker.VerifyConnection(tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{revokedCert, ca.cert}},
+		})
+		require.ErrorIs(t, err, ErrCertificateRevoked)
+	})
+
+	t.Run("OtherIssuer", func(t *testing.T) {
+		otherCA := newTestCA(t)
+
+		checker := &ClientCertificateRevocationChecker{
+			CRLs: []*x509.RevocationList{otherCA.revocationList(t, 3)},
+		}
+
+		err := checker.VerifyConnection(tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{revokedCert, ca.cert}},
+		})
+		require.NoError(t, err, "CRLs should only revoke certificates of their issuer")
+	})
+
+	t.Run("Stale", func(t *testing.T) {
+		checker := &ClientCertificateRevocationChecker{
+			CRLs: []*x509.RevocationList{ca.revocationListUntil(t, time.Now().Add(-time.Hour), 3)},
+		}
+
+		err := checker.VerifyConnection(tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{goodCert, ca.cert}},
+		})
+		require.Error(t, err)
+	})
+
+	t.Run("Reload", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "crl.pem")
+
+		writeCRL := func(crl *x509.RevocationList) {
+			err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl.Raw}), 0o600)
+			require.NoError(t, err)
+		}
+
+		writeCRL(ca.revocationList(t))
+
+		checker := &ClientCertificateRevocationChecker{
+			CRLFile: file,
+		}
+
+		require.NoError(t, checker.LoadCRLFile())
+
+		connectionState := tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{goodCert, ca.cert}},
+		}
+
+		require.NoError(t, checker.VerifyConnection(connectionState))
+
+		writeCRL(ca.revocationList(t, 2))
+
+		require.NoError(t, checker.LoadCRLFile())
+		require.ErrorIs(t, checker.VerifyConnection(connectionState), ErrCertificateRevoked)
+
+		// Broken files do not replace the loaded lists
+		require.NoError(t, os.WriteFile(file, []byte("garbage"), 0o600))
+
+		require.Error(t, checker.LoadCRLFile())
+		require.ErrorIs(t, checker.VerifyConnection(connectionState), ErrCertificateRevoked)
+	})
+}
+
+func TestClientCertificateRevocationChecker_OCSP(t *testing.T) {
+	ca := newTestCA(t)
+
+	responder := ca.ocspResponder(t, 3)
+
+	goodCert := ca.issue(t, 2, responder.URL)
+	revokedCert := ca.issue(t, 3, responder.URL)
+
+	checker := &ClientCertificateRevocationChecker{
+		OCSP: true,
+	}
+
+	t.Run("Good", func(t *testing.T) {
+		err := checker.VerifyConnection(tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{goodCert, ca.cert}},
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("Revoked", func(t *testing.T) {
+		err := checker.VerifyConnection(tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{revokedCert, ca.cert}},
+		})
+		require.ErrorIs(t, err, ErrCertificateRevoked)
+	})
+
+	t.Run("Unreachable", func(t *testing.T) {
+		unreachable := httptest.NewServer(http.NotFoundHandler())
+		unreachable.Close()
+
+		cert := ca.issue(t, 4, unreachable.URL)
+
+		connectionState := tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{cert, ca.cert}},
+		}
+
+		require.Error(t, checker.VerifyConnection(connectionState))
+
+		checker := &ClientCertificateRevocationChecker{
+			OCSP:         true,
+			OCSPSoftFail: true,
+		}
+
+		require.NoError(t, checker.VerifyConnection(connectionState))
+	})
+
+	t.Run("Cached", func(t *testing.T) {
+		var requests atomic.Int32
+
+		responder := ca.ocspResponderUntil(t, time.Now().Add(time.Hour), &requests)
+
+		cert := ca.issue(t, 5, responder.URL)
+
+		checker := &ClientCertificateRevocationChecker{
+			OCSP: true,
+		}
+
+		connectionState := tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{cert, ca.cert}},
+		}
+
+		require.NoError(t, checker.VerifyConnection(connectionState))
+		require.NoError(t, checker.VerifyConnection(connectionState))
+
+		assert.Equal(t, int32(1), requests.Load())
+	})
+
+	t.Run("Stale", func(t *testing.T) {
+		responder := ca.ocspResponderUntil(t, time.Now().Add(-time.Hour), nil)
+
+		cert := ca.issue(t, 6, responder.URL)
+
+		err := checker.VerifyConnection(tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{cert, ca.cert}},
+		})
+		require.Error(t, err)
+	})
+}
+
+func TestLoadRevocationListFile(t *testing.T) {
+	ca := newTestCA(t)
+
+	crl := ca.revocationList(t, 3)
+
+	dir := t.TempDir()
+
+	t.Run("PEM", func(t *testing.T) {
+		file := filepath.Join(dir, "crl.pem")
+
+		err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl.Raw}), 0o600)
+		require.NoError(t, err)
+
+		crls, err := LoadRevocationListFile(file)
+		require.NoError(t, err)
+
+		require.Len(t, crls, 1)
+		assert.Equal(t, crl.Raw, crls[0].Raw)
+	})
+
+	t.Run("DER", func(t *testing.T) {
+		file := filepath.Join(dir, "crl.der")
+
+		err := os.WriteFile(file, crl.Raw, 0o600)
+		require.NoError(t, err)
+
+		crls, err := LoadRevocationListFile(file)
+		require.NoError(t, err)
+
+		require.Len(t, crls, 1)
+		assert.Equal(t, crl.Raw, crls[0].Raw)
+	})
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCertificateMiddleware(t *testing.T) {
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "ci.example.com"},
+		DNSNames:       []string{"ci.example.com", "runner.example.com"},
+		EmailAddresses: []string{"ci@example.com"},
+		URIs:           []*url.URL{{Scheme: "spiffe", Host: "example.com", Path: "/ci"}},
+	}
+
+	var (
+		actual ClientCertificate
+		ok     bool
+	)
+
+	handler := ClientCertificateMiddleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		actual, ok = ClientCertificateFromContext(r.Context())
+	}))
+
+	t.Run("Verified", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/token", nil)
+		r.TLS = &tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{cert}},
+		}
+
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+
+		require.True(t, ok)
+
+		expected := ClientCertificate{
+			CommonName:     "ci.example.com",
+			DNSNames:       []string{"ci.example.com", "runner.example.com"},
+			EmailAddresses: []string{"ci@example.com"},
+			URIs:           []string{"spiffe://example.com/ci"},
+		}
+
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("Unverified", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/token", nil)
+		r.TLS = &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert},
+		}
+
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+
+		assert.False(t, ok)
+	})
+
+	t.Run("PlainHTTP", func(t *testing.T) {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/token", nil))
+
+		assert.False(t, ok)
+	})
+}
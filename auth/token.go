@@ -2,15 +2,26 @@ package auth
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 )
 
+// ErrIssuerUnavailable is returned when a token issuer fails (eg. signing fails because an HSM is unavailable).
+//
+// It is a backend error: clients should retry later.
+var ErrIssuerUnavailable = errors.New("token issuer unavailable")
+
 // AccessToken is a credential issued to a registry client described in the [AccessToken Authentication Specification].
 //
 // [AccessToken Authentication Specification]: https://github.com/distribution/distribution/blob/main/docs/spec/auth/token.md
 type AccessToken struct {
 	Payload string
 
+	// ID uniquely identifies the token (eg. the "jti" claim of a JWT).
+	// It is empty if the issuer does not assign IDs to tokens.
+	ID string
+
 	ExpiresIn time.Duration
 	IssuedAt  time.Time
 }
@@ -22,8 +33,82 @@ type AccessTokenIssuer interface {
 	IssueAccessToken(ctx context.Context, service string, subject Subject, grantedScopes []Scope) (AccessToken, error)
 }
 
+// RefreshToken is a credential issued to a registry client that it can use to obtain new access tokens.
+//
+// ExpiresIn is zero if the refresh token does not expire.
+type RefreshToken struct {
+	Payload string
+
+	ExpiresIn time.Duration
+	IssuedAt  time.Time
+}
+
 // RefreshTokenIssuer issues a token that a client can use to issue a new token for a subject without presenting credentials again.
-// TODO: add service as a parameter.
 type RefreshTokenIssuer interface {
-	IssueRefreshToken(ctx context.Context, service string, subject Subject) (string, error)
+	IssueRefreshToken(ctx context.Context, service string, subject Subject) (RefreshToken, error)
+}
+
+// ServiceAccessTokenIssuer delegates issuing access tokens to an issuer selected by the requested service.
+//
+// It allows services to mandate different signing keys or algorithms.
+type ServiceAccessTokenIssuer struct {
+	// Issuers maps service names to issuers.
+	Issuers map[string]AccessTokenIssuer
+
+	// Default issues tokens for services not listed in Issuers.
+	// If it is nil, token requests for unlisted services are rejected.
+	Default AccessTokenIssuer
+}
+
+func (i ServiceAccessTokenIssuer) IssueAccessToken(ctx context.Context, service string, subject Subject, grantedScopes []Scope) (AccessToken, error) {
+	issuer, ok := i.Issuers[service]
+	if !ok {
+		issuer = i.Default
+	}
+
+	if issuer == nil {
+		return AccessToken{}, fmt.Errorf("%w: unknown service %q", ErrInvalidRequest, service)
+	}
+
+	return issuer.IssueAccessToken(ctx, service, subject, grantedScopes)
+}
+
+// ErrAccessTokenTooLarge is returned when an access token exceeds the maximum size (see [SizeLimitedAccessTokenIssuer]).
+var ErrAccessTokenTooLarge = errors.New("access token too large")
+
+// SizeLimitedAccessTokenIssuer prevents issuing access tokens too large to be used.
+//
+// Tokens carrying the granted access (eg. JWTs) grow with the number of granted scopes
+// and may exceed the header size limits of registries or proxies in front of them.
+// Oversized tokens are issued by Fallback (eg. a reference token issuer) instead.
+type SizeLimitedAccessTokenIssuer struct {
+	Issuer AccessTokenIssuer
+
+	// MaxSize is the maximum size of a token (in bytes) issued by Issuer.
+	MaxSize int
+
+	// Fallback issues a token if the one issued by Issuer exceeds MaxSize.
+	// If it is nil, the request fails with ErrAccessTokenTooLarge.
+	Fallback AccessTokenIssuer
+}
+
+func (i SizeLimitedAccessTokenIssuer) IssueAccessToken(ctx context.Context, service string, subject Subject, grantedScopes []Scope) (AccessToken, error) {
+	token, err := i.Issuer.IssueAccessToken(ctx, service, subject, grantedScopes)
+	if err != nil {
+		return AccessToken{}, err
+	}
+
+	if len(token.Payload) <= i.MaxSize {
+		return token, nil
+	}
+
+	if i.Fallback != nil {
+		return i.Fallback.IssueAccessToken(ctx, service, subject, grantedScopes)
+	}
+
+	// Report it as a client error: the client can split the request into several smaller ones
+	return AccessToken{}, fmt.Errorf(
+		"%w: %w: token would be %d bytes (limit is %d), request fewer scopes per token",
+		ErrInvalidRequest, ErrAccessTokenTooLarge, len(token.Payload), i.MaxSize,
+	)
 }
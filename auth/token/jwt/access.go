@@ -2,12 +2,13 @@ package jwt
 
 import (
 	"context"
+	"crypto/x509"
 	"encoding/json"
+	"io"
 	"time"
 
 	"github.com/docker/libtrust"
 	"github.com/golang-jwt/jwt/v4"
-	"github.com/jonboulle/clockwork"
 
 	"github.com/sagikazarmark/registry-auth/auth"
 )
@@ -16,6 +17,25 @@ type accessTokenClaims struct {
 	jwt.RegisteredClaims
 
 	Access []auth.Scope `json:"access"`
+
+	Confirmation *confirmationClaim `json:"cnf,omitempty"`
+
+	// AuthenticationMethods lists the methods the subject authenticated with (RFC 8176).
+	AuthenticationMethods []string `json:"amr,omitempty"`
+
+	// AuthTime is the time the subject originally authenticated at (OpenID Connect Core 1.0).
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+
+	// Scope lists the granted access as space-delimited scopes (RFC 8693) for OAuth2 oriented verifiers.
+	Scope string `json:"scope,omitempty"`
+
+	// ScopeHash binds the token to the granted access (see ScopeHash).
+	ScopeHash string `json:"scope_hash,omitempty"`
+}
+
+// confirmationClaim binds a token to a key as described in RFC 7800 and RFC 9449.
+type confirmationClaim struct {
+	JWKThumbprint string `json:"jkt,omitempty"`
 }
 
 // AccessTokenIssuer issues access tokens according to the [Token Authentication Specification] and [Token Authentication Implementation].
@@ -27,8 +47,30 @@ type AccessTokenIssuer struct {
 	signingKey libtrust.PrivateKey
 	expiration time.Duration
 
+	keyID            string
+	thumbprintKeyIDs bool
+	retiredKeys      []RetiredKey
+
+	certificateChain []*x509.Certificate
+
+	weightedSigningKeys []WeightedSigningKey
+
+	signingAlgorithm string
+
+	expirationPolicies []ExpirationPolicy
+
+	leeway time.Duration
+
+	authenticationMethods bool
+	authTime              bool
+	scopeClaim            bool
+	scopeHashClaim        bool
+
+	tenantAudienceAttribute string
+
 	idGenerator IDGenerator
 	clock       Clock
+	rand        io.Reader
 }
 
 // NewAccessTokenIssuer returns a new AccessTokenIssuer.
@@ -48,18 +90,27 @@ func NewAccessTokenIssuer(issuer string, signingKey libtrust.PrivateKey, expirat
 	}
 
 	if i.idGenerator == nil {
-		i.idGenerator = uuidGenerator{}
+		i.idGenerator = auth.Dependencies{}.GetIDGenerator()
 	}
 
 	if i.clock == nil {
-		i.clock = clockwork.NewRealClock()
+		i.clock = auth.Dependencies{}.GetClock()
+	}
+
+	if i.rand == nil {
+		i.rand = auth.Dependencies{}.GetRand()
 	}
 
 	return i
 }
 
-func (i AccessTokenIssuer) IssueAccessToken(_ context.Context, service string, subject auth.Subject, grantedScopes []auth.Scope) (auth.AccessToken, error) {
-	alg, err := detectSigningMethod(i.signingKey)
+func (i AccessTokenIssuer) IssueAccessToken(ctx context.Context, service string, subject auth.Subject, grantedScopes []auth.Scope) (auth.AccessToken, error) {
+	signingKey, err := i.selectSigningKey()
+	if err != nil {
+		return auth.AccessToken{}, err
+	}
+
+	alg, err := signingMethod(signingKey, i.signingAlgorithm)
 	if err != nil {
 		return auth.AccessToken{}, err
 	}
@@ -71,40 +122,183 @@ func (i AccessTokenIssuer) IssueAccessToken(_ context.Context, service string, s
 
 	now := i.clock.Now()
 
+	expiration := expirationFor(i.expiration, i.expirationPolicies, grantedScopes)
+
+	// Scheduled tokens become valid (and their lifetime starts) in the future
+	notBefore := now
+	if t := auth.NotBeforeFromContext(ctx); t.After(now) {
+		notBefore = t
+	}
+
+	// The lifetime starts at notBefore: leeway only extends validity for verifiers with a clock running behind
+	validFrom := notBefore
+	if notBefore.Equal(now) {
+		validFrom = now.Add(-i.leeway)
+	}
+
+	// Tokens without any access (eg. credential checks) carry an empty list instead of null
+	if grantedScopes == nil {
+		grantedScopes = []auth.Scope{}
+	}
+
+	// Anonymous subjects have no ID: the claim is omitted
+	var subjectID auth.SubjectID
+	if subject != nil {
+		subjectID = subject.ID()
+	}
+
 	claims := accessTokenClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
 			ID:        id,
 			Issuer:    i.issuer,
-			Subject:   string(subject.ID()),
-			Audience:  []string{service},
-			ExpiresAt: jwt.NewNumericDate(now.Add(i.expiration)),
-			NotBefore: jwt.NewNumericDate(now),
+			Subject:   string(subjectID),
+			Audience:  i.audience(service, subject),
+			ExpiresAt: jwt.NewNumericDate(notBefore.Add(expiration)),
+			NotBefore: jwt.NewNumericDate(validFrom),
 			IssuedAt:  jwt.NewNumericDate(now),
 		},
 		Access: grantedScopes,
 	}
 
+	if jkt := auth.DPoPKeyThumbprintFromContext(ctx); jkt != "" {
+		claims.Confirmation = &confirmationClaim{
+			JWKThumbprint: jkt,
+		}
+	}
+
+	// Only include methods registered by RFC 8176 (see auth.AuthenticationMethodPassword)
+	if method := auth.AuthenticationMethodFromContext(ctx); i.authenticationMethods && method == auth.AuthenticationMethodPassword {
+		claims.AuthenticationMethods = []string{method}
+	}
+
+	if i.authTime && subject != nil {
+		authTime, ok := auth.GetSubjectAuthTime(subject)
+		if !ok {
+			// The subject authenticated with the current request
+			authTime = now
+		}
+
+		claims.AuthTime = jwt.NewNumericDate(authTime)
+	}
+
+	if i.scopeClaim {
+		claims.Scope = auth.Scopes(grantedScopes).String()
+	}
+
+	if i.scopeHashClaim {
+		claims.ScopeHash = ScopeHash(grantedScopes)
+	}
+
 	token := jwt.NewWithClaims(alg, claims)
 
-	if x5c := i.signingKey.GetExtendedField("x5c"); x5c != nil {
+	// Verifiers using a key set (see JWKSHandler) select the key by ID
+	token.Header["kid"] = i.signingKeyID(signingKey)
+
+	// The certificate chain belongs to the primary signing key
+	if len(i.certificateChain) > 0 && signingKey == i.signingKey {
+		for key, value := range certificateChainHeaders(i.certificateChain) {
+			token.Header[key] = value
+		}
+	} else if x5c := signingKey.GetExtendedField("x5c"); x5c != nil {
 		token.Header["x5c"] = x5c.([]string)
 	} else {
 		var jwkMessage json.RawMessage
-		jwkMessage, err = i.signingKey.PublicKey().MarshalJSON()
+		jwkMessage, err = signingKey.PublicKey().MarshalJSON()
 		if err != nil {
 			return auth.AccessToken{}, err
 		}
 		token.Header["jwk"] = &jwkMessage
 	}
 
-	signedToken, err := token.SignedString(i.signingKey.CryptoPrivateKey())
+	// Don't waste resources on signing if the client is gone
+	if err := ctx.Err(); err != nil {
+		return auth.AccessToken{}, err
+	}
+
+	signedToken, err := token.SignedString(signingKey.CryptoPrivateKey())
 	if err != nil {
 		return auth.AccessToken{}, err
 	}
 
 	return auth.AccessToken{
 		Payload:   signedToken,
-		ExpiresIn: i.expiration,
+		ID:        id,
+		ExpiresIn: notBefore.Add(expiration).Sub(now),
 		IssuedAt:  now,
 	}, nil
 }
+
+// PublicKeys returns the public keys of every signing key configured for the issuer
+// (including weighted signing keys that are never selected, so that they can be published ahead of a rotation)
+// and the retired keys whose grace period has not ended yet.
+// The certificate chain (see [WithCertificateChain]) is published along with the primary signing key.
+//
+// AccessTokenIssuer implements KeySet.
+func (i AccessTokenIssuer) PublicKeys() []PublicKey {
+	keys := []PublicKey{{ID: i.signingKeyID(i.signingKey), Key: i.signingKey.PublicKey(), CertificateChain: i.certificateChain}}
+
+	for _, key := range i.weightedSigningKeys {
+		keys = append(keys, PublicKey{ID: i.signingKeyID(key.Key), Key: key.Key.PublicKey()})
+	}
+
+	now := i.clock.Now()
+
+	for _, key := range i.retiredKeys {
+		if !key.NotAfter.IsZero() && now.After(key.NotAfter) {
+			continue
+		}
+
+		id := key.ID
+		if id == "" {
+			id = i.derivedKeyID(key.Key)
+		}
+
+		keys = append(keys, PublicKey{ID: id, Key: key.Key})
+	}
+
+	return uniquePublicKeys(keys)
+}
+
+// audience returns the audience of a token issued for service, including the tenant of subject (if configured).
+func (i AccessTokenIssuer) audience(service string, subject auth.Subject) jwt.ClaimStrings {
+	audience := jwt.ClaimStrings{service}
+
+	if i.tenantAudienceAttribute == "" || subject == nil {
+		return audience
+	}
+
+	if tenant, ok := subject.Attribute(i.tenantAudienceAttribute); ok && tenant != "" && tenant != service {
+		audience = append(audience, tenant)
+	}
+
+	return audience
+}
+
+// signingKeyID returns the ID of a signing key.
+func (i AccessTokenIssuer) signingKeyID(signingKey libtrust.PrivateKey) string {
+	if i.keyID != "" && signingKey.KeyID() == i.signingKey.KeyID() {
+		return i.keyID
+	}
+
+	return i.derivedKeyID(signingKey.PublicKey())
+}
+
+// derivedKeyID returns the ID derived from a key: either its JWK thumbprint (if configured) or the libtrust key ID.
+func (i AccessTokenIssuer) derivedKeyID(key libtrust.PublicKey) string {
+	if i.thumbprintKeyIDs {
+		// Thumbprints can be computed for every supported key type, but fall back to the libtrust key ID just in case
+		if thumbprint, err := JWKThumbprint(key); err == nil {
+			return thumbprint
+		}
+	}
+
+	return key.KeyID()
+}
+
+func (i AccessTokenIssuer) selectSigningKey() (libtrust.PrivateKey, error) {
+	if len(i.weightedSigningKeys) == 0 {
+		return i.signingKey, nil
+	}
+
+	return selectSigningKey(i.weightedSigningKeys, i.rand)
+}
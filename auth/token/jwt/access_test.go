@@ -2,15 +2,22 @@ package jwt
 
 import (
 	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"slices"
 	"testing"
 	"time"
 
 	"github.com/docker/libtrust"
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/jonboulle/clockwork"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/sagikazarmark/registry-auth/auth"
+	"github.com/sagikazarmark/registry-auth/auth/token/reference"
 )
 
 type idGeneratorStub struct {
@@ -56,10 +63,485 @@ func TestAccessTokenIssuer_IssueAccessToken(t *testing.T) {
 	require.NoError(t, err)
 
 	expected := auth.AccessToken{
-		Payload:   "eyJhbGciOiJSUzI1NiIsImp3ayI6eyJlIjoiQVFBQiIsImtpZCI6IjdCVE06NllVRDpYSE00OjRNWUY6Qk1RWTo2N05YOkFTWVE6VVVBRjo2N1FaOlA3SjY6SktJMjpaT0FBIiwia3R5IjoiUlNBIiwibiI6Ind0bDROcC1YM3Z0cUotZU1oaXc5SWhkRzkyclR5Ukg1c05QVmZsZmZGUHlvZnMyLWtJT0R2bVlOWmFwckRMNHlBU2lvR2k2SkFHamlIcVV5d1JyMUtmTGhsX3RpWGt3YndNalBkZmxwUURuMXpjTC1uWjdkRU1VZVU4WTN0ekN3TVg2bHBVLVd2MDFmNERHNk85eFAzQXJnN0lCNVM0ZmdTXzhCTE5tREhZaUZmSFlzSHBhMFI2Wk10UV9VcG9yTXJDcDlnR0VaYkswbkVnTnZyWTFCel9ZRUtRUFZZNUxRTTdfZFoxMWcwS3hibGpBa3hmZnVoY0RUNE9rN1FTdnRGWHVTbFBINktNbDdtYjRJaERkaHRzbHU3YnExV3lkdmEwSmtwajQ5QlFuci13VkJHZU5ROFJHSUhXaGJqWE5uNzVMdF9rNGZCOUxnRGViQmRTNkpiSUlEUUNheHU3dmpnUE9EN2tDcUVxRVFYR0VjMHdzNlZ3MlAzLUF0NXhzNHJnVFhNYVU4NmdpVXExVXFGOE0zWFRDcEtXLTgyaHN6NjRIZk1IVUNpbVpiX2pnM205N3A2Wm9oU0tSaHlSWjRyLW05U0hzMnVBSXJkZmYzOGhLcEVGUWJCTWs1SkN5a05sTDViQWxNbjItZmpQZHdjMV9TWi1Db3hIQjlrVlhoZTRIRTdYU185bXJhTUdwZlVEOGY0OTBwZFZOVkd2NHVyenJSMDMxZ3RRbzg4SWRsb2ZkRTBGOFpBQWp6a3dUS1c3WGRpMzJXTUdRNlE1b3F6amxfc1V2OUV4Qy1pc2R6MklHX3RHU184M0gxN1N0RERsd0Jpa21iMEYxQUZNM2s2RzB1SzhzVFg5RElhS1pEVXFJU1BrM1ZaV1JCR0s1N3l1MEk5S3haeFRVIn0sInR5cCI6IkpXVCJ9.eyJpc3MiOiJpc3N1ZXIuZXhhbXBsZS5jb20iLCJzdWIiOiJpZCIsImF1ZCI6WyJzZXJ2aWNlLmV4YW1wbGUuY29tIl0sImV4cCI6MTI1ODc5NCwibmJmIjoxMjU3ODk0LCJpYXQiOjEyNTc4OTQsImp0aSI6InZiODZ2ODdnODdnODdnODdiYjg5N3ZjdzIzNjdmdjcyM3ZjODIzNiIsImFjY2VzcyI6W3sidHlwZSI6InJlcG9zaXRvcnkiLCJjbGFzcyI6IiIsIm5hbWUiOiJwYXRoL3RvL3JlcG8iLCJhY3Rpb25zIjpbInB1bGwiLCJwdXNoIl19XX0.Mm48dysRPmHah3R3tYJ6pZ9aowbCYmeNiLCzlGogAQm_pQ2oiAwMUDIK9xSKFw0nS7FB2ljoMVRAyJbNvpTc7FZFCI6ZksS3j1c_GUDlADmapuQRz39Hf_7RexN5KGO0d4f-aLlKC7z-Q1gyxnjSukjnztFLzRsYwA2U1uT-BzuBy5TNEtEaqiehCMSuQWKJnm9bBgxI3NFGQplZofKugf9sUFiuhldGpY1XNk1Guwp9inQsVm8sTHlEq_1kIx8OlIm9afkBEe2etxl7fE0LM3rhRj6m9gxEgijMYvHQRJIwrSW1_CtYNPAAAnF3OsHucuXXW2K4ItKAkqDZJetIePtv0T3IiA-lD0v0Ou5qM96IDV4ZFlp8xAjIr0fJ97VCOwpO9Z03ovi0V3hEcKt8HKwmdsHgm7k7Kr0ROiyldVoPVuH1BqoCKPeDxIlHqobcvCdCA3erqr5kYM0eK3l1cSIn58d5udrtYuUwaF-yU98qSRlbOU5bgkASESWycyXbss1z6BsshQiwFQ406fUBCVDeYM0evMNXov6coyv1DnLl7eU6vOQSIi5YfJ23yPVsNF-CxJpSZjRFr6MuY2qhoQJ_C-EKmFzD1yirEFndoLhFqFFkxLXoY6W5EA2LR8dCd7JO0lpFAHDd6Uqkcf380BltzG_qpdkCHlaZYIQxerw",
+		Payload:   "eyJhbGciOiJSUzI1NiIsImp3ayI6eyJlIjoiQVFBQiIsImtpZCI6IjdCVE06NllVRDpYSE00OjRNWUY6Qk1RWTo2N05YOkFTWVE6VVVBRjo2N1FaOlA3SjY6SktJMjpaT0FBIiwia3R5IjoiUlNBIiwibiI6Ind0bDROcC1YM3Z0cUotZU1oaXc5SWhkRzkyclR5Ukg1c05QVmZsZmZGUHlvZnMyLWtJT0R2bVlOWmFwckRMNHlBU2lvR2k2SkFHamlIcVV5d1JyMUtmTGhsX3RpWGt3YndNalBkZmxwUURuMXpjTC1uWjdkRU1VZVU4WTN0ekN3TVg2bHBVLVd2MDFmNERHNk85eFAzQXJnN0lCNVM0ZmdTXzhCTE5tREhZaUZmSFlzSHBhMFI2Wk10UV9VcG9yTXJDcDlnR0VaYkswbkVnTnZyWTFCel9ZRUtRUFZZNUxRTTdfZFoxMWcwS3hibGpBa3hmZnVoY0RUNE9rN1FTdnRGWHVTbFBINktNbDdtYjRJaERkaHRzbHU3YnExV3lkdmEwSmtwajQ5QlFuci13VkJHZU5ROFJHSUhXaGJqWE5uNzVMdF9rNGZCOUxnRGViQmRTNkpiSUlEUUNheHU3dmpnUE9EN2tDcUVxRVFYR0VjMHdzNlZ3MlAzLUF0NXhzNHJnVFhNYVU4NmdpVXExVXFGOE0zWFRDcEtXLTgyaHN6NjRIZk1IVUNpbVpiX2pnM205N3A2Wm9oU0tSaHlSWjRyLW05U0hzMnVBSXJkZmYzOGhLcEVGUWJCTWs1SkN5a05sTDViQWxNbjItZmpQZHdjMV9TWi1Db3hIQjlrVlhoZTRIRTdYU185bXJhTUdwZlVEOGY0OTBwZFZOVkd2NHVyenJSMDMxZ3RRbzg4SWRsb2ZkRTBGOFpBQWp6a3dUS1c3WGRpMzJXTUdRNlE1b3F6amxfc1V2OUV4Qy1pc2R6MklHX3RHU184M0gxN1N0RERsd0Jpa21iMEYxQUZNM2s2RzB1SzhzVFg5RElhS1pEVXFJU1BrM1ZaV1JCR0s1N3l1MEk5S3haeFRVIn0sImtpZCI6IjdCVE06NllVRDpYSE00OjRNWUY6Qk1RWTo2N05YOkFTWVE6VVVBRjo2N1FaOlA3SjY6SktJMjpaT0FBIiwidHlwIjoiSldUIn0.eyJpc3MiOiJpc3N1ZXIuZXhhbXBsZS5jb20iLCJzdWIiOiJpZCIsImF1ZCI6WyJzZXJ2aWNlLmV4YW1wbGUuY29tIl0sImV4cCI6MTI1ODc5NCwibmJmIjoxMjU3ODk0LCJpYXQiOjEyNTc4OTQsImp0aSI6InZiODZ2ODdnODdnODdnODdiYjg5N3ZjdzIzNjdmdjcyM3ZjODIzNiIsImFjY2VzcyI6W3sidHlwZSI6InJlcG9zaXRvcnkiLCJjbGFzcyI6IiIsIm5hbWUiOiJwYXRoL3RvL3JlcG8iLCJhY3Rpb25zIjpbInB1bGwiLCJwdXNoIl19XX0.H1NrUNJOwMRAdlxwESbqQz9AA7pC2NBQPy5MIoH8roFwgMGjj_wMPri_pcYQPJxBx_HNZmLsU_QE8QZV7OCvr7ykBN_kfEZYVkcrHp0-3wTFUd8mQbYJxrx3_uC3BYk9vjR7jvNOW7VNtOv6h40trqKvwi6B-ZFHg_HAiSqW4LmayllQqRnD_wjjX1mlr6pKSZ1YzNVgI-h_SeO20cfPJhGbrFhExkmaK-CKn147Rxq60s41AUMHl0WSngZHNcBMzhTjSbwXmygeL_FprFf8wBN0XHys4HV4I5BHvdnJQt4KUtoEv_ggY_OEm2a_ezM9tWEqDZr3ACj-kXnU5WUQLo3hcZ31a7tmXDeRVHpvPri1dhURhBRSlN36dKB5HHmnuBRwBPHxOP4ubOMGXgMC01WYbUzngJQwU72KtH-gQLsIcGN6E1EBYeRdBaBUwIYeGpyyZ43tRDarromuAGSawDIj_A70wev8LkVa55HCnWRdpGpukgXaYP5QZf0VclK6iGevPV6jYg-Jzo_WpoOaHOrU0b5D_4pkmw6IrjtjsWdlI4_eQYhdNH1xQtfrmrMIBktktKCNr47_-4vQ19G7eaw8SyOmoxETKxwFuKjl41nZ6AKOl9InJuqUKsKK3CTlcX1mkv8yfD4I1ez2fvipr76wSoblf_DLSVP5VznF5D4",
+		ID:        id,
 		ExpiresIn: expiration,
 		IssuedAt:  now,
 	}
 
 	assert.Equal(t, expected, token)
 }
+
+func TestAccessTokenIssuer_IssueAccessToken_AuthenticationMethods(t *testing.T) {
+	signingKey, err := libtrust.LoadKeyFile("testdata/private.pem")
+	require.NoError(t, err)
+
+	ctx := auth.ContextWithAuthenticationMethod(context.Background(), auth.AuthenticationMethodPassword)
+
+	t.Run("Enabled", func(t *testing.T) {
+		tokenIssuer := NewAccessTokenIssuer("issuer.example.com", signingKey, 15*time.Minute, WithAuthenticationMethods())
+
+		token, err := tokenIssuer.IssueAccessToken(ctx, "service.example.com", subjectStub{id: "id"}, nil)
+		require.NoError(t, err)
+
+		var claims accessTokenClaims
+
+		_, _, err = jwt.NewParser().ParseUnverified(token.Payload, &claims)
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"pwd"}, claims.AuthenticationMethods)
+	})
+
+	t.Run("Unregistered", func(t *testing.T) {
+		tokenIssuer := NewAccessTokenIssuer("issuer.example.com", signingKey, 15*time.Minute, WithAuthenticationMethods())
+
+		ctx := auth.ContextWithAuthenticationMethod(context.Background(), auth.AuthenticationMethodRefreshToken)
+
+		token, err := tokenIssuer.IssueAccessToken(ctx, "service.example.com", subjectStub{id: "id"}, nil)
+		require.NoError(t, err)
+
+		var claims accessTokenClaims
+
+		_, _, err = jwt.NewParser().ParseUnverified(token.Payload, &claims)
+		require.NoError(t, err)
+
+		assert.Empty(t, claims.AuthenticationMethods)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		tokenIssuer := NewAccessTokenIssuer("issuer.example.com", signingKey, 15*time.Minute)
+
+		token, err := tokenIssuer.IssueAccessToken(ctx, "service.example.com", subjectStub{id: "id"}, nil)
+		require.NoError(t, err)
+
+		var claims accessTokenClaims
+
+		_, _, err = jwt.NewParser().ParseUnverified(token.Payload, &claims)
+		require.NoError(t, err)
+
+		assert.Empty(t, claims.AuthenticationMethods)
+	})
+}
+
+type signingKeyRecorder struct {
+	libtrust.PrivateKey
+
+	calls *int
+}
+
+func (k signingKeyRecorder) CryptoPrivateKey() crypto.PrivateKey {
+	*k.calls++
+
+	return k.PrivateKey.CryptoPrivateKey()
+}
+
+func TestAccessTokenIssuer_IssueAccessToken_Canceled(t *testing.T) {
+	signingKey, err := libtrust.LoadKeyFile("testdata/private.pem")
+	require.NoError(t, err)
+
+	var calls int
+
+	tokenIssuer := NewAccessTokenIssuer("issuer.example.com", signingKeyRecorder{signingKey, &calls}, 15*time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	token, err := tokenIssuer.IssueAccessToken(ctx, "service.example.com", subjectStub{id: "id"}, nil)
+	require.ErrorIs(t, err, context.Canceled)
+
+	assert.Empty(t, token.Payload)
+	assert.Zero(t, calls, "token should not be signed")
+}
+
+func TestAccessTokenIssuer_IssueAccessToken_AuthTime(t *testing.T) {
+	signingKey, err := libtrust.GenerateECP256PrivateKey()
+	require.NoError(t, err)
+
+	const service = "service.example.com"
+
+	authTime := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	clock := clockwork.NewFakeClockAt(authTime)
+
+	accessTokenIssuer := NewAccessTokenIssuer("issuer.example.com", signingKey, 15*time.Minute, WithClock(clock), WithAuthTime())
+	refreshTokenIssuer := NewRefreshTokenIssuer("issuer.example.com", signingKey, WithClock(clock))
+
+	parseClaims := func(t *testing.T, token auth.AccessToken) accessTokenClaims {
+		t.Helper()
+
+		var claims accessTokenClaims
+
+		_, _, err := jwt.NewParser().ParseUnverified(token.Payload, &claims)
+		require.NoError(t, err)
+
+		return claims
+	}
+
+	subject := subjectStub{id: "id"}
+
+	// Initial authentication
+	accessToken, err := accessTokenIssuer.IssueAccessToken(context.Background(), service, subject, nil)
+	require.NoError(t, err)
+
+	claims := parseClaims(t, accessToken)
+
+	require.NotNil(t, claims.AuthTime)
+	assert.Equal(t, authTime.Unix(), claims.AuthTime.Unix())
+	assert.Equal(t, claims.IssuedAt.Unix(), claims.AuthTime.Unix())
+
+	refreshToken, err := refreshTokenIssuer.IssueRefreshToken(context.Background(), service, subject)
+	require.NoError(t, err)
+
+	// Refresh an hour later
+	clock.Advance(time.Hour)
+
+	_, refreshedAuthTime, err := refreshTokenIssuer.VerifyRefreshTokenAuthTime(context.Background(), service, refreshToken.Payload)
+	require.NoError(t, err)
+
+	accessToken, err = accessTokenIssuer.IssueAccessToken(context.Background(), service, authTimeSubjectStub{subject, refreshedAuthTime}, nil)
+	require.NoError(t, err)
+
+	claims = parseClaims(t, accessToken)
+
+	require.NotNil(t, claims.AuthTime)
+	assert.Equal(t, authTime.Unix(), claims.AuthTime.Unix())
+	assert.Equal(t, authTime.Add(time.Hour).Unix(), claims.IssuedAt.Unix())
+
+	t.Run("Disabled", func(t *testing.T) {
+		accessTokenIssuer := NewAccessTokenIssuer("issuer.example.com", signingKey, 15*time.Minute, WithClock(clock))
+
+		accessToken, err := accessTokenIssuer.IssueAccessToken(context.Background(), service, subject, nil)
+		require.NoError(t, err)
+
+		assert.Nil(t, parseClaims(t, accessToken).AuthTime)
+	})
+}
+
+func TestAccessTokenIssuer_IssueAccessToken_ScopeClaim(t *testing.T) {
+	signingKey, err := libtrust.GenerateECP256PrivateKey()
+	require.NoError(t, err)
+
+	grantedScopes := []auth.Scope{
+		{
+			Resource: auth.Resource{
+				Type: "repository",
+				Name: "foo/bar",
+			},
+			Actions: []string{"pull", "push"},
+		},
+		{
+			Resource: auth.Resource{
+				Type: "registry",
+				Name: "catalog",
+			},
+			Actions: []string{"*"},
+		},
+	}
+
+	parseClaims := func(t *testing.T, token auth.AccessToken) map[string]any {
+		t.Helper()
+
+		claims := jwt.MapClaims{}
+
+		_, _, err := jwt.NewParser().ParseUnverified(token.Payload, claims)
+		require.NoError(t, err)
+
+		return claims
+	}
+
+	tokenIssuer := NewAccessTokenIssuer("issuer.example.com", signingKey, 15*time.Minute, WithScopeClaim())
+
+	token, err := tokenIssuer.IssueAccessToken(context.Background(), "service.example.com", subjectStub{id: "id"}, grantedScopes)
+	require.NoError(t, err)
+
+	claims := parseClaims(t, token)
+
+	assert.Equal(t, "repository:foo/bar:pull,push registry:catalog:*", claims["scope"])
+	assert.Len(t, claims["access"], 2)
+
+	t.Run("Disabled", func(t *testing.T) {
+		tokenIssuer := NewAccessTokenIssuer("issuer.example.com", signingKey, 15*time.Minute)
+
+		token, err := tokenIssuer.IssueAccessToken(context.Background(), "service.example.com", subjectStub{id: "id"}, grantedScopes)
+		require.NoError(t, err)
+
+		assert.NotContains(t, parseClaims(t, token), "scope")
+	})
+}
+
+func TestAccessTokenIssuer_IssueAccessToken_ScopeHashClaim(t *testing.T) {
+	signingKey, err := libtrust.GenerateECP256PrivateKey()
+	require.NoError(t, err)
+
+	grantedScopes := []auth.Scope{
+		{
+			Resource: auth.Resource{
+				Type: "repository",
+				Name: "foo/bar",
+			},
+			Actions: []string{"push", "pull"},
+		},
+		{
+			Resource: auth.Resource{
+				Type: "registry",
+				Name: "catalog",
+			},
+			Actions: []string{"*"},
+		},
+	}
+
+	issueScopeHash := func(t *testing.T, tokenIssuer AccessTokenIssuer, grantedScopes []auth.Scope) any {
+		t.Helper()
+
+		token, err := tokenIssuer.IssueAccessToken(context.Background(), "service.example.com", subjectStub{id: "id"}, grantedScopes)
+		require.NoError(t, err)
+
+		claims := jwt.MapClaims{}
+
+		_, _, err = jwt.NewParser().ParseUnverified(token.Payload, claims)
+		require.NoError(t, err)
+
+		return claims["scope_hash"]
+	}
+
+	tokenIssuer := NewAccessTokenIssuer("issuer.example.com", signingKey, 15*time.Minute, WithScopeHashClaim())
+
+	scopeHash := issueScopeHash(t, tokenIssuer, grantedScopes)
+
+	sum := sha256.Sum256([]byte("registry:catalog:* repository:foo/bar:pull,push"))
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(sum[:]), scopeHash)
+
+	t.Run("Order", func(t *testing.T) {
+		reordered := []auth.Scope{grantedScopes[1], grantedScopes[0]}
+		reordered[1].Actions = []string{"pull", "push"}
+
+		assert.Equal(t, scopeHash, issueScopeHash(t, tokenIssuer, reordered))
+	})
+
+	t.Run("ScopeChanges", func(t *testing.T) {
+		broader := slices.Clone(grantedScopes)
+		broader[0].Actions = []string{"pull", "push", "delete"}
+
+		assert.NotEqual(t, scopeHash, issueScopeHash(t, tokenIssuer, broader))
+		assert.NotEqual(t, scopeHash, issueScopeHash(t, tokenIssuer, grantedScopes[:1]))
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		tokenIssuer := NewAccessTokenIssuer("issuer.example.com", signingKey, 15*time.Minute)
+
+		assert.Nil(t, issueScopeHash(t, tokenIssuer, grantedScopes))
+	})
+}
+
+func TestAccessTokenIssuer_IssueAccessToken_NoAccess(t *testing.T) {
+	signingKey, err := libtrust.GenerateECP256PrivateKey()
+	require.NoError(t, err)
+
+	tokenIssuer := NewAccessTokenIssuer("issuer.example.com", signingKey, 15*time.Minute)
+
+	token, err := tokenIssuer.IssueAccessToken(context.Background(), "service.example.com", subjectStub{id: "id"}, nil)
+	require.NoError(t, err)
+
+	claims := jwt.MapClaims{}
+
+	_, _, err = jwt.NewParser().ParseUnverified(token.Payload, claims)
+	require.NoError(t, err)
+
+	assert.Equal(t, []any{}, claims["access"])
+}
+
+func TestAccessTokenIssuer_IssueAccessToken_NotBefore(t *testing.T) {
+	signingKey, err := libtrust.GenerateECP256PrivateKey()
+	require.NoError(t, err)
+
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	notBefore := now.Add(6 * time.Hour)
+
+	tokenIssuer := NewAccessTokenIssuer("issuer.example.com", signingKey, 15*time.Minute, WithClock(clockwork.NewFakeClockAt(now)))
+
+	ctx := auth.ContextWithNotBefore(context.Background(), notBefore)
+
+	token, err := tokenIssuer.IssueAccessToken(ctx, "service.example.com", subjectStub{id: "id"}, nil)
+	require.NoError(t, err)
+
+	var claims accessTokenClaims
+
+	_, _, err = jwt.NewParser().ParseUnverified(token.Payload, &claims)
+	require.NoError(t, err)
+
+	assert.Equal(t, now.Unix(), claims.IssuedAt.Unix())
+	assert.Equal(t, notBefore.Unix(), claims.NotBefore.Unix())
+	assert.Equal(t, notBefore.Add(15*time.Minute).Unix(), claims.ExpiresAt.Unix())
+	assert.Equal(t, 6*time.Hour+15*time.Minute, token.ExpiresIn)
+}
+
+func TestAccessTokenIssuer_IssueAccessToken_SizeLimit(t *testing.T) {
+	signingKey, err := libtrust.LoadKeyFile("testdata/private.pem")
+	require.NoError(t, err)
+
+	issuer := NewAccessTokenIssuer("issuer.example.com", signingKey, 15*time.Minute)
+
+	grantedScopes := make([]auth.Scope, 0, 100)
+
+	for i := 0; i < 100; i++ {
+		grantedScopes = append(grantedScopes, auth.Scope{
+			Resource: auth.Resource{
+				Type: "repository",
+				Name: fmt.Sprintf("team/project-%d/image", i),
+			},
+			Actions: []string{"pull", "push"},
+		})
+	}
+
+	t.Run("Error", func(t *testing.T) {
+		tokenIssuer := auth.SizeLimitedAccessTokenIssuer{
+			Issuer:  issuer,
+			MaxSize: 4096,
+		}
+
+		token, err := tokenIssuer.IssueAccessToken(context.Background(), "service.example.com", subjectStub{id: "id"}, grantedScopes[:1])
+		require.NoError(t, err)
+
+		assert.Contains(t, token.Payload, ".")
+
+		_, err = tokenIssuer.IssueAccessToken(context.Background(), "service.example.com", subjectStub{id: "id"}, grantedScopes)
+		require.ErrorIs(t, err, auth.ErrAccessTokenTooLarge)
+		require.ErrorIs(t, err, auth.ErrInvalidRequest)
+
+		assert.Contains(t, err.Error(), "request fewer scopes")
+	})
+
+	t.Run("Reference", func(t *testing.T) {
+		fallback := reference.NewAccessTokenIssuer(15 * time.Minute)
+
+		tokenIssuer := auth.SizeLimitedAccessTokenIssuer{
+			Issuer:   issuer,
+			MaxSize:  4096,
+			Fallback: fallback,
+		}
+
+		token, err := tokenIssuer.IssueAccessToken(context.Background(), "service.example.com", subjectStub{id: "id"}, grantedScopes)
+		require.NoError(t, err)
+
+		assert.LessOrEqual(t, len(token.Payload), 4096)
+		assert.NotContains(t, token.Payload, ".")
+
+		access, ok := fallback.Resolve(context.Background(), token.Payload)
+		require.True(t, ok)
+
+		assert.Equal(t, auth.SubjectID("id"), access.Subject)
+		assert.Equal(t, grantedScopes, access.Scopes)
+	})
+}
+
+func TestAccessTokenIssuer_IssueAccessToken_Leeway(t *testing.T) {
+	signingKey, err := libtrust.GenerateECP256PrivateKey()
+	require.NoError(t, err)
+
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+
+	tokenIssuer := NewAccessTokenIssuer(
+		"issuer.example.com",
+		signingKey,
+		15*time.Minute,
+		WithClock(clockwork.NewFakeClockAt(now)),
+		WithLeeway(time.Minute),
+	)
+
+	issueClaims := func(t *testing.T, ctx context.Context) jwt.RegisteredClaims {
+		t.Helper()
+
+		token, err := tokenIssuer.IssueAccessToken(ctx, "service.example.com", subjectStub{id: "id"}, nil)
+		require.NoError(t, err)
+
+		var claims jwt.RegisteredClaims
+
+		_, _, err = jwt.NewParser().ParseUnverified(token.Payload, &claims)
+		require.NoError(t, err)
+
+		return claims
+	}
+
+	claims := issueClaims(t, context.Background())
+
+	assert.Equal(t, now.Add(-time.Minute), claims.NotBefore.Time.UTC())
+	assert.Equal(t, now, claims.IssuedAt.Time.UTC())
+	assert.Equal(t, now.Add(15*time.Minute), claims.ExpiresAt.Time.UTC(), "leeway must not extend the lifetime")
+
+	t.Run("Scheduled", func(t *testing.T) {
+		notBefore := now.Add(time.Hour)
+
+		claims := issueClaims(t, auth.ContextWithNotBefore(context.Background(), notBefore))
+
+		assert.Equal(t, notBefore, claims.NotBefore.Time.UTC())
+	})
+}
+
+func TestAccessTokenIssuer_IssueAccessToken_TenantAudience(t *testing.T) {
+	signingKey, err := libtrust.GenerateECP256PrivateKey()
+	require.NoError(t, err)
+
+	const service = "service.example.com"
+
+	tokenIssuer := NewAccessTokenIssuer("issuer.example.com", signingKey, 15*time.Minute, WithTenantAudience("tenant"))
+
+	issueAudience := func(t *testing.T, tokenIssuer AccessTokenIssuer, subject auth.Subject) jwt.ClaimStrings {
+		t.Helper()
+
+		token, err := tokenIssuer.IssueAccessToken(context.Background(), service, subject, nil)
+		require.NoError(t, err)
+
+		var claims accessTokenClaims
+
+		_, _, err = jwt.NewParser().ParseUnverified(token.Payload, &claims)
+		require.NoError(t, err)
+
+		return claims.Audience
+	}
+
+	t.Run("Tenant", func(t *testing.T) {
+		audience := issueAudience(t, tokenIssuer, subjectStub{id: "id", attrs: map[string]string{"tenant": "acme"}})
+
+		assert.Equal(t, jwt.ClaimStrings{service, "acme"}, audience)
+	})
+
+	t.Run("NoTenant", func(t *testing.T) {
+		audience := issueAudience(t, tokenIssuer, subjectStub{id: "id"})
+
+		assert.Equal(t, jwt.ClaimStrings{service}, audience)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		tokenIssuer := NewAccessTokenIssuer("issuer.example.com", signingKey, 15*time.Minute)
+
+		audience := issueAudience(t, tokenIssuer, subjectStub{id: "id", attrs: map[string]string{"tenant": "acme"}})
+
+		assert.Equal(t, jwt.ClaimStrings{service}, audience)
+	})
+}
+
+func TestAccessTokenIssuer_IssueAccessToken_Anonymous(t *testing.T) {
+	signingKey, err := libtrust.GenerateECP256PrivateKey()
+	require.NoError(t, err)
+
+	tokenIssuer := NewAccessTokenIssuer("issuer.example.com", signingKey, 15*time.Minute, WithAuthTime(), WithTenantAudience("tenant"))
+
+	scopes := []auth.Scope{
+		{
+			Resource: auth.Resource{Type: "repository", Name: "library/alpine"},
+			Actions:  []string{"pull"},
+		},
+	}
+
+	token, err := tokenIssuer.IssueAccessToken(context.Background(), "service.example.com", nil, scopes)
+	require.NoError(t, err)
+
+	claims := jwt.MapClaims{}
+
+	_, _, err = jwt.NewParser().ParseUnverified(token.Payload, claims)
+	require.NoError(t, err)
+
+	assert.NotContains(t, claims, "sub")
+	assert.NotContains(t, claims, "auth_time")
+	assert.Equal(t, []any{"service.example.com"}, claims["aud"])
+	assert.Len(t, claims["access"], 1)
+}
@@ -1,8 +1,6 @@
 package jwt
 
-import "time"
+import "github.com/sagikazarmark/registry-auth/auth"
 
 // Clock provides an interface to accessing current time.
-type Clock interface {
-	Now() time.Time
-}
+type Clock = auth.Clock
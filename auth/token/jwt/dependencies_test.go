@@ -0,0 +1,81 @@
+package jwt
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/libtrust"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+type subjectAuthenticatorStub struct {
+	subject auth.Subject
+}
+
+func (a subjectAuthenticatorStub) AuthenticatePassword(_ context.Context, _ string, _ string) (auth.Subject, error) {
+	return a.subject, nil
+}
+
+type authorizerStub struct{}
+
+func (authorizerStub) Authorize(_ context.Context, _ auth.Subject, requestedScopes []auth.Scope) ([]auth.Scope, error) {
+	return requestedScopes, nil
+}
+
+func TestDependencies(t *testing.T) {
+	signingKey, err := libtrust.LoadKeyFile("testdata/private.pem")
+	require.NoError(t, err)
+
+	now := time.UnixMicro(1257894000000)
+
+	newService := func() auth.TokenServiceImpl {
+		deps := auth.Dependencies{
+			Clock: clockwork.NewFakeClockAt(now),
+			Rand:  bytes.NewReader(bytes.Repeat([]byte{42}, 1024)),
+		}
+
+		tokenIssuer := auth.TokenIssuer{
+			AccessTokenIssuer:  NewAccessTokenIssuer("issuer.example.com", signingKey, 15*time.Minute, WithDependencies(deps)),
+			RefreshTokenIssuer: NewRefreshTokenIssuer("issuer.example.com", signingKey, WithDependencies(deps)),
+		}
+
+		return auth.TokenServiceImpl{
+			Authenticator: auth.Authenticator{
+				PasswordAuthenticator: subjectAuthenticatorStub{subjectStub{id: "id"}},
+			},
+			Authorizer:   authorizerStub{},
+			TokenIssuer:  tokenIssuer,
+			Dependencies: deps,
+		}
+	}
+
+	request := auth.TokenRequest{
+		Service:  "service.example.com",
+		Offline:  true,
+		Username: "user",
+		Password: "password",
+	}
+
+	response, err := newService().TokenHandler(context.Background(), request)
+	require.NoError(t, err)
+
+	otherResponse, err := newService().TokenHandler(context.Background(), request)
+	require.NoError(t, err)
+
+	assert.Equal(t, response, otherResponse)
+
+	var claims accessTokenClaims
+
+	_, _, err = jwt.NewParser().ParseUnverified(response.Token, &claims)
+	require.NoError(t, err)
+
+	assert.Equal(t, "2a2a2a2a-2a2a-4a2a-aa2a-2a2a2a2a2a2a", claims.ID)
+	assert.Equal(t, now.Unix(), claims.IssuedAt.Unix())
+}
@@ -0,0 +1,303 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+const dpopProofType = "dpop+jwt"
+
+var dpopSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// dpopMinRSAKeySize is the minimum size of RSA keys accepted in DPoP proofs.
+const dpopMinRSAKeySize = 2048
+
+type dpopProofClaims struct {
+	ID         string           `json:"jti"`
+	HTTPMethod string           `json:"htm"`
+	HTTPURI    string           `json:"htu"`
+	IssuedAt   *jwt.NumericDate `json:"iat"`
+}
+
+// Valid implements jwt.Claims.
+//
+// Claims are validated by DPoPProofVerifier.
+func (c dpopProofClaims) Valid() error {
+	return nil
+}
+
+// DPoPProofVerifier verifies proofs defined by [RFC 9449] (OAuth 2.0 Demonstrating Proof of Possession).
+//
+// Proofs can only be used once: the "jti" claims of accepted proofs are remembered until the proofs expire.
+// Used proofs are kept in memory, so they are not shared between replicas.
+//
+// [RFC 9449]: https://datatracker.ietf.org/doc/html/rfc9449
+type DPoPProofVerifier struct {
+	maxAge time.Duration
+
+	clock Clock
+
+	usedProofs *usedDPoPProofs
+}
+
+// usedDPoPProofs remembers the proofs accepted by a DPoPProofVerifier.
+type usedDPoPProofs struct {
+	mu        sync.Mutex
+	proofs    map[string]time.Time
+	nextPrune time.Time
+}
+
+// use marks a proof as used until expiresAt and reports whether it was used before.
+func (u *usedDPoPProofs) use(id string, expiresAt time.Time, now time.Time) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if !now.Before(u.nextPrune) {
+		for id, expiresAt := range u.proofs {
+			if !now.Before(expiresAt) {
+				delete(u.proofs, id)
+			}
+		}
+
+		u.nextPrune = now.Add(time.Minute)
+	}
+
+	if usedUntil, ok := u.proofs[id]; ok && now.Before(usedUntil) {
+		return true
+	}
+
+	u.proofs[id] = expiresAt
+
+	return false
+}
+
+// NewDPoPProofVerifier returns a new DPoPProofVerifier.
+//
+// Proofs issued more than maxAge ago (or later than maxAge from now) are rejected.
+func NewDPoPProofVerifier(maxAge time.Duration, opts ...DPoPProofVerifierOption) DPoPProofVerifier {
+	if maxAge <= 0 {
+		panic("max age cannot be zero")
+	}
+
+	v := DPoPProofVerifier{
+		maxAge: maxAge,
+		usedProofs: &usedDPoPProofs{
+			proofs: make(map[string]time.Time),
+		},
+	}
+
+	for _, opt := range opts {
+		opt.applyDPoPProofVerifier(&v)
+	}
+
+	if v.clock == nil {
+		v.clock = auth.Dependencies{}.GetClock()
+	}
+
+	return v
+}
+
+// VerifyDPoPProof implements auth.DPoPProofVerifier.
+func (v DPoPProofVerifier) VerifyDPoPProof(_ context.Context, proof string, method string, uri string) (string, error) {
+	var claims dpopProofClaims
+	var thumbprint string
+
+	_, err := jwt.NewParser(jwt.WithValidMethods(dpopSigningMethods)).ParseWithClaims(proof, &claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != dpopProofType {
+			return nil, fmt.Errorf("unexpected typ header %q", typ)
+		}
+
+		jwk, ok := token.Header["jwk"].(map[string]any)
+		if !ok {
+			return nil, errors.New("missing jwk header")
+		}
+
+		publicKey, err := parseDPoPPublicKey(jwk)
+		if err != nil {
+			return nil, fmt.Errorf("jwk header: %w", err)
+		}
+
+		thumbprint, err = jwkThumbprint(jwk)
+		if err != nil {
+			return nil, err
+		}
+
+		return publicKey, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", auth.ErrInvalidDPoPProof, err)
+	}
+
+	if claims.ID == "" {
+		return "", fmt.Errorf("%w: missing jti claim", auth.ErrInvalidDPoPProof)
+	}
+
+	if claims.HTTPMethod != method {
+		return "", fmt.Errorf("%w: htm claim does not match request method", auth.ErrInvalidDPoPProof)
+	}
+
+	if !matchHTTPURI(claims.HTTPURI, uri) {
+		return "", fmt.Errorf("%w: htu claim does not match request URI", auth.ErrInvalidDPoPProof)
+	}
+
+	if claims.IssuedAt == nil {
+		return "", fmt.Errorf("%w: missing iat claim", auth.ErrInvalidDPoPProof)
+	}
+
+	now := v.clock.Now()
+
+	if age := now.Sub(claims.IssuedAt.Time); age > v.maxAge || age < -v.maxAge {
+		return "", fmt.Errorf("%w: proof is too old or issued in the future", auth.ErrInvalidDPoPProof)
+	}
+
+	// Proofs are accepted until maxAge after they were issued
+	if v.usedProofs.use(thumbprint+"|"+claims.ID, claims.IssuedAt.Add(v.maxAge), now) {
+		return "", fmt.Errorf("%w: proof has already been used", auth.ErrInvalidDPoPProof)
+	}
+
+	return thumbprint, nil
+}
+
+// parseDPoPPublicKey parses the public key in the jwk header of a DPoP proof.
+func parseDPoPPublicKey(jwk map[string]any) (crypto.PublicKey, error) {
+	if _, ok := jwk["d"]; ok {
+		return nil, errors.New("contains a private key")
+	}
+
+	member := func(name string) ([]byte, error) {
+		value, ok := jwk[name].(string)
+		if !ok {
+			return nil, fmt.Errorf("missing %q member", name)
+		}
+
+		b, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q member: %w", name, err)
+		}
+
+		return b, nil
+	}
+
+	kty, _ := jwk["kty"].(string)
+	crv, _ := jwk["crv"].(string)
+
+	switch kty {
+	case "EC":
+		var (
+			curve     elliptic.Curve
+			ecdhCurve ecdh.Curve
+		)
+
+		switch crv {
+		case "P-256":
+			curve, ecdhCurve = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, ecdhCurve = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, ecdhCurve = elliptic.P521(), ecdh.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", crv)
+		}
+
+		x, err := member("x")
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := member("y")
+		if err != nil {
+			return nil, err
+		}
+
+		// Parsing the uncompressed point makes sure it is on the curve
+		point := append(append([]byte{4}, x...), y...)
+
+		if _, err := ecdhCurve.NewPublicKey(point); err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+
+	case "RSA":
+		n, err := member("n")
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := member("e")
+		if err != nil {
+			return nil, err
+		}
+
+		exponent := new(big.Int).SetBytes(e)
+
+		if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > math.MaxInt32 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+
+		key := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(exponent.Int64()),
+		}
+
+		if key.N.BitLen() < dpopMinRSAKeySize {
+			return nil, fmt.Errorf("RSA keys must be at least %d bits", dpopMinRSAKeySize)
+		}
+
+		return key, nil
+
+	case "OKP":
+		if crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", crv)
+		}
+
+		x, err := member("x")
+		if err != nil {
+			return nil, err
+		}
+
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", kty)
+}
+
+// matchHTTPURI compares two URIs ignoring query and fragment components as described in RFC 9449 section 4.3.
+func matchHTTPURI(htu string, uri string) bool {
+	a, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+
+	b, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+
+	return a.Scheme == b.Scheme && a.Host == b.Host && a.Path == b.Path
+}
@@ -0,0 +1,246 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"maps"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/libtrust"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+func createDPoPProof(t *testing.T, key libtrust.PrivateKey, claims dpopProofClaims) string {
+	t.Helper()
+
+	jwkData, err := key.PublicKey().MarshalJSON()
+	require.NoError(t, err)
+
+	var jwk map[string]any
+
+	err = json.Unmarshal(jwkData, &jwk)
+	require.NoError(t, err)
+
+	return signDPoPProof(t, jwt.SigningMethodES256, key.CryptoPrivateKey(), jwk, claims)
+}
+
+func signDPoPProof(t *testing.T, method jwt.SigningMethod, key crypto.PrivateKey, jwk map[string]any, claims dpopProofClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["typ"] = dpopProofType
+	token.Header["jwk"] = jwk
+
+	proof, err := token.SignedString(key)
+	require.NoError(t, err)
+
+	return proof
+}
+
+func TestDPoPProofVerifier_VerifyDPoPProof(t *testing.T) {
+	key, err := libtrust.GenerateECP256PrivateKey()
+	require.NoError(t, err)
+
+	jwkData, err := key.PublicKey().MarshalJSON()
+	require.NoError(t, err)
+
+	var jwk map[string]any
+
+	err = json.Unmarshal(jwkData, &jwk)
+	require.NoError(t, err)
+
+	expectedThumbprint, err := jwkThumbprint(jwk)
+	require.NoError(t, err)
+
+	now := time.UnixMicro(1257894000000)
+	clock := clockwork.NewFakeClockAt(now)
+
+	verifier := NewDPoPProofVerifier(5*time.Minute, WithClock(clock))
+
+	const uri = "https://auth.example.com/token"
+
+	t.Run("OK", func(t *testing.T) {
+		proof := createDPoPProof(t, key, dpopProofClaims{
+			ID:         "id",
+			HTTPMethod: "POST",
+			HTTPURI:    uri + "?ignored=query",
+			IssuedAt:   jwt.NewNumericDate(now.Add(-time.Minute)),
+		})
+
+		thumbprint, err := verifier.VerifyDPoPProof(context.Background(), proof, "POST", uri)
+		require.NoError(t, err)
+
+		assert.Equal(t, expectedThumbprint, thumbprint)
+
+		// Proofs can only be used once
+		_, err = verifier.VerifyDPoPProof(context.Background(), proof, "POST", uri)
+		require.ErrorIs(t, err, auth.ErrInvalidDPoPProof)
+	})
+
+	t.Run("EdDSA", func(t *testing.T) {
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+
+		jwk := map[string]any{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"x":   base64.RawURLEncoding.EncodeToString(publicKey),
+		}
+
+		proof := signDPoPProof(t, jwt.SigningMethodEdDSA, privateKey, jwk, dpopProofClaims{
+			ID:         "eddsa",
+			HTTPMethod: "POST",
+			HTTPURI:    uri,
+			IssuedAt:   jwt.NewNumericDate(now),
+		})
+
+		expectedThumbprint, err := jwkThumbprint(jwk)
+		require.NoError(t, err)
+
+		thumbprint, err := verifier.VerifyDPoPProof(context.Background(), proof, "POST", uri)
+		require.NoError(t, err)
+
+		assert.Equal(t, expectedThumbprint, thumbprint)
+	})
+
+	t.Run("KeyID", func(t *testing.T) {
+		jwk := maps.Clone(jwk)
+		jwk["kid"] = "chosen-by-the-client"
+
+		proof := signDPoPProof(t, jwt.SigningMethodES256, key.CryptoPrivateKey(), jwk, dpopProofClaims{
+			ID:         "kid",
+			HTTPMethod: "POST",
+			HTTPURI:    uri,
+			IssuedAt:   jwt.NewNumericDate(now),
+		})
+
+		thumbprint, err := verifier.VerifyDPoPProof(context.Background(), proof, "POST", uri)
+		require.NoError(t, err)
+
+		assert.Equal(t, expectedThumbprint, thumbprint)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		testCases := map[string]dpopProofClaims{
+			"MethodMismatch": {
+				ID:         "id",
+				HTTPMethod: "GET",
+				HTTPURI:    uri,
+				IssuedAt:   jwt.NewNumericDate(now),
+			},
+			"URIMismatch": {
+				ID:         "id",
+				HTTPMethod: "POST",
+				HTTPURI:    "https://other.example.com/token",
+				IssuedAt:   jwt.NewNumericDate(now),
+			},
+			"Expired": {
+				ID:         "id",
+				HTTPMethod: "POST",
+				HTTPURI:    uri,
+				IssuedAt:   jwt.NewNumericDate(now.Add(-time.Hour)),
+			},
+			"MissingID": {
+				HTTPMethod: "POST",
+				HTTPURI:    uri,
+				IssuedAt:   jwt.NewNumericDate(now),
+			},
+		}
+
+		for name, claims := range testCases {
+			claims := claims
+
+			t.Run(name, func(t *testing.T) {
+				proof := createDPoPProof(t, key, claims)
+
+				_, err := verifier.VerifyDPoPProof(context.Background(), proof, "POST", uri)
+				require.Error(t, err)
+
+				assert.ErrorIs(t, err, auth.ErrInvalidDPoPProof)
+			})
+		}
+
+		t.Run("SmallRSAKey", func(t *testing.T) {
+			privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+			require.NoError(t, err)
+
+			jwk := map[string]any{
+				"kty": "RSA",
+				"n":   base64.RawURLEncoding.EncodeToString(privateKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(privateKey.E)).Bytes()),
+			}
+
+			proof := signDPoPProof(t, jwt.SigningMethodRS256, privateKey, jwk, dpopProofClaims{
+				ID:         "rsa",
+				HTTPMethod: "POST",
+				HTTPURI:    uri,
+				IssuedAt:   jwt.NewNumericDate(now),
+			})
+
+			_, err = verifier.VerifyDPoPProof(context.Background(), proof, "POST", uri)
+			require.ErrorIs(t, err, auth.ErrInvalidDPoPProof)
+		})
+
+		t.Run("InvalidSignature", func(t *testing.T) {
+			otherKey, err := libtrust.GenerateECP256PrivateKey()
+			require.NoError(t, err)
+
+			proof := createDPoPProof(t, key, dpopProofClaims{
+				ID:         "id",
+				HTTPMethod: "POST",
+				HTTPURI:    uri,
+				IssuedAt:   jwt.NewNumericDate(now),
+			})
+
+			otherProof := createDPoPProof(t, otherKey, dpopProofClaims{
+				ID:         "id",
+				HTTPMethod: "POST",
+				HTTPURI:    uri,
+				IssuedAt:   jwt.NewNumericDate(now),
+			})
+
+			// Replace the signature with one created by another key
+			parts := strings.Split(proof, ".")
+			parts[2] = strings.Split(otherProof, ".")[2]
+			proof = strings.Join(parts, ".")
+
+			_, err = verifier.VerifyDPoPProof(context.Background(), proof, "POST", uri)
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, auth.ErrInvalidDPoPProof)
+		})
+	})
+}
+
+func TestAccessTokenIssuer_IssueAccessToken_DPoP(t *testing.T) {
+	signingKey, err := libtrust.LoadKeyFile("testdata/private.pem")
+	require.NoError(t, err)
+
+	tokenIssuer := NewAccessTokenIssuer("issuer.example.com", signingKey, 15*time.Minute)
+
+	ctx := auth.ContextWithDPoPKeyThumbprint(context.Background(), "thumbprint")
+
+	token, err := tokenIssuer.IssueAccessToken(ctx, "service.example.com", subjectStub{id: "id"}, nil)
+	require.NoError(t, err)
+
+	var claims accessTokenClaims
+
+	_, _, err = jwt.NewParser().ParseUnverified(token.Payload, &claims)
+	require.NoError(t, err)
+
+	require.NotNil(t, claims.Confirmation)
+	assert.Equal(t, "thumbprint", claims.Confirmation.JWKThumbprint)
+}
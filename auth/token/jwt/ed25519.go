@@ -0,0 +1,185 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/docker/libtrust"
+)
+
+// keyTypeOKP is the JWK key type of Ed25519 keys (RFC 8037).
+const keyTypeOKP = "OKP"
+
+// GenerateEd25519PrivateKey generates a new Ed25519 signing key.
+func GenerateEd25519PrivateKey() (libtrust.PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewEd25519PrivateKey(key), nil
+}
+
+// NewEd25519PrivateKey adapts an Ed25519 key to [libtrust.PrivateKey] (libtrust only supports RSA and EC keys),
+// so that it can sign tokens using the EdDSA algorithm.
+//
+// The key is published as an "OKP" JSON Web Key (RFC 8037) and identified by an ID derived the same way libtrust does for other keys.
+func NewEd25519PrivateKey(key ed25519.PrivateKey) libtrust.PrivateKey {
+	return &ed25519PrivateKey{
+		ed25519PublicKey: &ed25519PublicKey{
+			key:            key.Public().(ed25519.PublicKey),
+			extendedFields: make(map[string]any),
+		},
+		key: key,
+	}
+}
+
+type ed25519PublicKey struct {
+	key            ed25519.PublicKey
+	extendedFields map[string]any
+}
+
+func (k *ed25519PublicKey) KeyType() string {
+	return keyTypeOKP
+}
+
+// KeyID follows the libtrust format: a base32 encoded SHA-256 hash (truncated to 240 bits) of the DER encoded public key.
+func (k *ed25519PublicKey) KeyID() string {
+	der, err := x509.MarshalPKIXPublicKey(k.key)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(der)
+	encoded := strings.TrimRight(base32.StdEncoding.EncodeToString(sum[:30]), "=")
+
+	var buf bytes.Buffer
+
+	for i := 0; i < len(encoded); i += 4 {
+		if i > 0 {
+			buf.WriteByte(':')
+		}
+
+		buf.WriteString(encoded[i:min(i+4, len(encoded))])
+	}
+
+	return buf.String()
+}
+
+func (k *ed25519PublicKey) Verify(data io.Reader, alg string, signature []byte) error {
+	if alg != "EdDSA" {
+		return fmt.Errorf("unsupported signature algorithm %q for Ed25519 key", alg)
+	}
+
+	message, err := io.ReadAll(data)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(k.key, message, signature) {
+		return errors.New("invalid signature")
+	}
+
+	return nil
+}
+
+func (k *ed25519PublicKey) CryptoPublicKey() crypto.PublicKey {
+	return k.key
+}
+
+func (k *ed25519PublicKey) MarshalJSON() ([]byte, error) {
+	return k.marshalJWK(nil)
+}
+
+func (k *ed25519PublicKey) marshalJWK(privateKey ed25519.PrivateKey) ([]byte, error) {
+	jwk := make(map[string]any, len(k.extendedFields)+5)
+
+	for name, value := range k.extendedFields {
+		jwk[name] = value
+	}
+
+	jwk["kty"] = keyTypeOKP
+	jwk["kid"] = k.KeyID()
+	jwk["crv"] = "Ed25519"
+	jwk["x"] = base64.RawURLEncoding.EncodeToString(k.key)
+
+	if privateKey != nil {
+		jwk["d"] = base64.RawURLEncoding.EncodeToString(privateKey.Seed())
+	}
+
+	return json.Marshal(jwk)
+}
+
+func (k *ed25519PublicKey) PEMBlock() (*pem.Block, error) {
+	der, err := x509.MarshalPKIXPublicKey(k.key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pem.Block{Type: "PUBLIC KEY", Bytes: der}, nil
+}
+
+func (k *ed25519PublicKey) String() string {
+	return fmt.Sprintf("Ed25519 Public Key <%s>", k.KeyID())
+}
+
+func (k *ed25519PublicKey) AddExtendedField(name string, value any) {
+	k.extendedFields[name] = value
+}
+
+func (k *ed25519PublicKey) GetExtendedField(name string) any {
+	return k.extendedFields[name]
+}
+
+type ed25519PrivateKey struct {
+	*ed25519PublicKey
+
+	key ed25519.PrivateKey
+}
+
+func (k *ed25519PrivateKey) PublicKey() libtrust.PublicKey {
+	return k.ed25519PublicKey
+}
+
+// Sign signs data using EdDSA (Ed25519 does not use a separate hash function, so hashID is ignored).
+func (k *ed25519PrivateKey) Sign(data io.Reader, _ crypto.Hash) ([]byte, string, error) {
+	message, err := io.ReadAll(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return ed25519.Sign(k.key, message), "EdDSA", nil
+}
+
+func (k *ed25519PrivateKey) CryptoPrivateKey() crypto.PrivateKey {
+	return k.key
+}
+
+func (k *ed25519PrivateKey) MarshalJSON() ([]byte, error) {
+	return k.marshalJWK(k.key)
+}
+
+func (k *ed25519PrivateKey) PEMBlock() (*pem.Block, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(k.key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pem.Block{Type: "PRIVATE KEY", Bytes: der}, nil
+}
+
+func (k *ed25519PrivateKey) String() string {
+	return fmt.Sprintf("Ed25519 Private Key <%s>", k.KeyID())
+}
@@ -0,0 +1,101 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/docker/libtrust"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+func TestAccessTokenIssuer_EdDSA(t *testing.T) {
+	signingKey, err := GenerateEd25519PrivateKey()
+	require.NoError(t, err)
+
+	require.NoError(t, CheckSigningKey(signingKey, ""))
+	require.NoError(t, CheckSigningKey(signingKey, "EdDSA"))
+
+	issuer := NewAccessTokenIssuer("issuer.example.com", signingKey, time.Minute)
+
+	token, err := issuer.IssueAccessToken(context.Background(), "service.example.com", subjectStub{id: "id"}, []auth.Scope{})
+	require.NoError(t, err)
+
+	// Verify the token using the published key
+	rec := httptest.NewRecorder()
+
+	JWKSHandler(issuer).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var keySet struct {
+		Keys []map[string]any `json:"keys"`
+	}
+
+	err = json.NewDecoder(rec.Body).Decode(&keySet)
+	require.NoError(t, err)
+
+	require.Len(t, keySet.Keys, 1)
+
+	jwk := keySet.Keys[0]
+
+	assert.Equal(t, "OKP", jwk["kty"])
+	assert.Equal(t, "Ed25519", jwk["crv"])
+	assert.Equal(t, signingKey.KeyID(), jwk["kid"])
+	assert.NotContains(t, jwk, "d", "private key material must not be published")
+
+	x, err := base64.RawURLEncoding.DecodeString(jwk["x"].(string))
+	require.NoError(t, err)
+
+	parsed, err := jwt.NewParser(jwt.WithValidMethods([]string{"EdDSA"})).Parse(token.Payload, func(token *jwt.Token) (any, error) {
+		assert.Equal(t, jwk["kid"], token.Header["kid"])
+
+		return ed25519.PublicKey(x), nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "EdDSA", parsed.Header["alg"])
+}
+
+func TestEd25519PrivateKey(t *testing.T) {
+	signingKey, err := GenerateEd25519PrivateKey()
+	require.NoError(t, err)
+
+	// The ID has the same format as libtrust key IDs
+	assert.Regexp(t, `^([A-Z2-7]{4}:){11}[A-Z2-7]{4}$`, signingKey.KeyID())
+	assert.Equal(t, signingKey.KeyID(), signingKey.PublicKey().KeyID())
+
+	block, err := signingKey.PEMBlock()
+	require.NoError(t, err)
+
+	parsedKey, err := ParsePrivateKeyPEM(pem.EncodeToMemory(block))
+	require.NoError(t, err)
+
+	assert.Equal(t, signingKey.KeyID(), parsedKey.KeyID())
+
+	assert.Contains(t, signingKey.String(), signingKey.KeyID())
+}
+
+func TestCheckSigningAlgorithm_EdDSA(t *testing.T) {
+	ed25519Key, err := GenerateEd25519PrivateKey()
+	require.NoError(t, err)
+
+	ecKey, err := libtrust.GenerateECP256PrivateKey()
+	require.NoError(t, err)
+
+	require.NoError(t, CheckSigningAlgorithm(ed25519Key, "EdDSA"))
+
+	assert.EqualError(t, CheckSigningAlgorithm(ecKey, "EdDSA"), "signing algorithm EdDSA requires an Ed25519 key, got EC")
+	assert.Error(t, CheckSigningAlgorithm(ed25519Key, "ES256"))
+	assert.Error(t, CheckSigningAlgorithm(ed25519Key, "RS256"))
+}
@@ -0,0 +1,69 @@
+package jwt
+
+import (
+	"strings"
+	"time"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+	"github.com/sagikazarmark/registry-auth/pkg/glob"
+)
+
+// ExpirationPolicy shortens the lifetime of access tokens granting access to matching resources (eg. sensitive repositories).
+type ExpirationPolicy struct {
+	// Type is the resource type the policy applies to (eg. repository).
+	// Empty matches every resource type.
+	Type string
+
+	// Name is a glob pattern matched against resource names (see [glob.Match]).
+	Name string
+
+	// Expiration is the maximum lifetime of tokens granting access to a matching resource.
+	Expiration time.Duration
+}
+
+func (p ExpirationPolicy) matches(resource auth.Resource) bool {
+	return (p.Type == "" || p.Type == resource.Type) && glob.Match(p.Name, resource.Name)
+}
+
+// specificity ranks policies matching the same resource: more literal characters in the pattern make a policy more specific.
+func (p ExpirationPolicy) specificity() int {
+	n := len(p.Name) - strings.Count(p.Name, "*") - strings.Count(p.Name, "?")
+
+	// A policy for a specific resource type beats an otherwise identical one for every type
+	n *= 2
+	if p.Type != "" {
+		n++
+	}
+
+	return n
+}
+
+// expirationFor returns the lifetime of a token granting scopes.
+//
+// For every scope the most specific matching policy applies (the first one in case of a tie).
+// Policies only shorten the lifetime: the result never exceeds expiration.
+func expirationFor(expiration time.Duration, policies []ExpirationPolicy, scopes []auth.Scope) time.Duration {
+	for _, scope := range scopes {
+		var (
+			policy *ExpirationPolicy
+			best   int
+		)
+
+		for i := range policies {
+			if !policies[i].matches(scope.Resource) {
+				continue
+			}
+
+			if specificity := policies[i].specificity(); policy == nil || specificity > best {
+				policy = &policies[i]
+				best = specificity
+			}
+		}
+
+		if policy != nil && policy.Expiration < expiration {
+			expiration = policy.Expiration
+		}
+	}
+
+	return expiration
+}
@@ -0,0 +1,86 @@
+package jwt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/libtrust"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+func TestAccessTokenIssuer_IssueAccessToken_ExpirationPolicies(t *testing.T) {
+	signingKey, err := libtrust.GenerateECP256PrivateKey()
+	require.NoError(t, err)
+
+	tokenIssuer := NewAccessTokenIssuer(
+		"issuer.example.com",
+		signingKey,
+		time.Hour,
+		WithExpirationPolicies(
+			ExpirationPolicy{Type: "repository", Name: "prod/**", Expiration: 5 * time.Minute},
+			ExpirationPolicy{Type: "repository", Name: "prod/public/*", Expiration: 30 * time.Minute},
+			ExpirationPolicy{Name: "**", Expiration: 2 * time.Hour},
+		),
+	)
+
+	repository := func(name string) auth.Scope {
+		return auth.Scope{
+			Resource: auth.Resource{Type: "repository", Name: name},
+			Actions:  []string{"pull"},
+		}
+	}
+
+	testCases := []struct {
+		name               string
+		scopes             []auth.Scope
+		expectedExpiration time.Duration
+	}{
+		{
+			name:               "NoScopes",
+			expectedExpiration: time.Hour,
+		},
+		{
+			name:               "Default",
+			scopes:             []auth.Scope{repository("dev/app")},
+			expectedExpiration: time.Hour,
+		},
+		{
+			name:               "Sensitive",
+			scopes:             []auth.Scope{repository("prod/app")},
+			expectedExpiration: 5 * time.Minute,
+		},
+		{
+			name:               "MostSpecific",
+			scopes:             []auth.Scope{repository("prod/public/app")},
+			expectedExpiration: 30 * time.Minute,
+		},
+		{
+			name:               "Shortest",
+			scopes:             []auth.Scope{repository("dev/app"), repository("prod/public/app"), repository("prod/app")},
+			expectedExpiration: 5 * time.Minute,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			token, err := tokenIssuer.IssueAccessToken(context.Background(), "service.example.com", subjectStub{id: "id"}, testCase.scopes)
+			require.NoError(t, err)
+
+			assert.Equal(t, testCase.expectedExpiration, token.ExpiresIn)
+
+			var claims jwt.RegisteredClaims
+
+			_, _, err = jwt.NewParser().ParseUnverified(token.Payload, &claims)
+			require.NoError(t, err)
+
+			assert.Equal(t, testCase.expectedExpiration, claims.ExpiresAt.Sub(claims.IssuedAt.Time))
+		})
+	}
+}
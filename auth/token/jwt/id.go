@@ -1,19 +1,6 @@
 package jwt
 
-import "github.com/gofrs/uuid"
+import "github.com/sagikazarmark/registry-auth/auth"
 
 // IDGenerator generates a random ID.
-type IDGenerator interface {
-	GenerateID() (string, error)
-}
-
-type uuidGenerator struct{}
-
-func (g uuidGenerator) GenerateID() (string, error) {
-	u, err := uuid.NewV4()
-	if err != nil {
-		return "", err
-	}
-
-	return u.String(), nil
-}
+type IDGenerator = auth.IDGenerator
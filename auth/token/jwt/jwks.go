@@ -0,0 +1,109 @@
+package jwt
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+
+	"github.com/docker/libtrust"
+)
+
+// PublicKey is a published public key.
+type PublicKey struct {
+	// ID matches the kid header of tokens signed by the key.
+	ID string
+
+	Key libtrust.PublicKey
+
+	// CertificateChain is published as the x5c, x5t and x5t#S256 parameters of the key (if any).
+	CertificateChain []*x509.Certificate
+}
+
+// KeySet provides the public keys to publish.
+type KeySet interface {
+	PublicKeys() []PublicKey
+}
+
+// KeySets combines multiple key sets (eg. of per-service issuers) into one.
+type KeySets []KeySet
+
+// PublicKeys implements KeySet.
+func (s KeySets) PublicKeys() []PublicKey {
+	var keys []PublicKey
+
+	for _, keySet := range s {
+		keys = append(keys, keySet.PublicKeys()...)
+	}
+
+	return uniquePublicKeys(keys)
+}
+
+// JWKSHandler publishes public keys as a JSON Web Key Set (RFC 7517),
+// so that registries can verify access tokens without being configured with the certificates of the signing keys.
+//
+// The key set is rendered for every request, so retired keys disappear once their grace period ends (see [RetiredKey]).
+// Publish every key that signs (or is about to sign) tokens during a key rotation.
+func JWKSHandler(keySet KeySet) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		body, err := marshalKeySet(keySet.PublicKeys())
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	})
+}
+
+func marshalKeySet(keys []PublicKey) ([]byte, error) {
+	keySet := struct {
+		Keys []map[string]any `json:"keys"`
+	}{
+		Keys: make([]map[string]any, 0, len(keys)),
+	}
+
+	for _, key := range keys {
+		b, err := key.Key.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+
+		var jwk map[string]any
+
+		if err := json.Unmarshal(b, &jwk); err != nil {
+			return nil, err
+		}
+
+		jwk["kid"] = key.ID
+		jwk["use"] = "sig"
+
+		if len(key.CertificateChain) > 0 {
+			for name, value := range certificateChainHeaders(key.CertificateChain) {
+				jwk[name] = value
+			}
+		}
+
+		keySet.Keys = append(keySet.Keys, jwk)
+	}
+
+	return json.Marshal(keySet)
+}
+
+// uniquePublicKeys removes duplicate keys (by ID), keeping the order of the first occurrences.
+func uniquePublicKeys(keys []PublicKey) []PublicKey {
+	seen := make(map[string]bool, len(keys))
+	unique := make([]PublicKey, 0, len(keys))
+
+	for _, key := range keys {
+		if seen[key.ID] {
+			continue
+		}
+
+		seen[key.ID] = true
+		unique = append(unique, key)
+	}
+
+	return unique
+}
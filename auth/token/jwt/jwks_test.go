@@ -0,0 +1,249 @@
+package jwt
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/docker/libtrust"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+func TestJWKSHandler(t *testing.T) {
+	oldKey, err := libtrust.GenerateECP256PrivateKey()
+	require.NoError(t, err)
+
+	newKey, err := libtrust.GenerateRSA2048PrivateKey()
+	require.NoError(t, err)
+
+	// Rotation in progress: the new key is published, but not used for signing yet
+	issuer := NewAccessTokenIssuer(
+		"issuer.example.com",
+		oldKey,
+		time.Minute,
+		WithWeightedSigningKeys(
+			WeightedSigningKey{Key: oldKey, Weight: 1},
+			WeightedSigningKey{Key: newKey, Weight: 0},
+		),
+	)
+
+	handler := JWKSHandler(issuer)
+
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var keySet struct {
+		Keys []map[string]any `json:"keys"`
+	}
+
+	err = json.NewDecoder(rec.Body).Decode(&keySet)
+	require.NoError(t, err)
+
+	require.Len(t, keySet.Keys, 2, "duplicate keys should be published once")
+
+	assert.Equal(t, oldKey.KeyID(), keySet.Keys[0]["kid"])
+	assert.Equal(t, "EC", keySet.Keys[0]["kty"])
+	assert.Equal(t, "sig", keySet.Keys[0]["use"])
+	assert.NotContains(t, keySet.Keys[0], "d", "private key material must not be published")
+
+	assert.Equal(t, newKey.KeyID(), keySet.Keys[1]["kid"])
+	assert.Equal(t, "RSA", keySet.Keys[1]["kty"])
+	assert.NotContains(t, keySet.Keys[1], "d", "private key material must not be published")
+
+	// The kid header of issued tokens refers to a published key
+	token, err := issuer.IssueAccessToken(context.Background(), "service.example.com", subjectStub{id: "id"}, []auth.Scope{})
+	require.NoError(t, err)
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(token.Payload, jwt.MapClaims{})
+	require.NoError(t, err)
+
+	assert.Equal(t, oldKey.KeyID(), parsed.Header["kid"])
+}
+
+func TestJWKSHandler_KeyRotation(t *testing.T) {
+	primaryKey, err := libtrust.GenerateECP256PrivateKey()
+	require.NoError(t, err)
+
+	retiredKey, err := libtrust.GenerateECP256PrivateKey()
+	require.NoError(t, err)
+
+	now := time.Date(2023, time.October, 1, 0, 0, 0, 0, time.UTC)
+	clock := clockwork.NewFakeClockAt(now)
+
+	issuer := NewAccessTokenIssuer(
+		"issuer.example.com",
+		primaryKey,
+		time.Minute,
+		WithKeyID("2023-10"),
+		WithRetiredKeys(RetiredKey{ID: "2023-09", Key: retiredKey.PublicKey(), NotAfter: now.Add(time.Hour)}),
+		WithClock(clock),
+	)
+
+	handler := JWKSHandler(issuer)
+
+	keyIDs := func() []string {
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var keySet struct {
+			Keys []struct {
+				KeyID string `json:"kid"`
+			} `json:"keys"`
+		}
+
+		err := json.NewDecoder(rec.Body).Decode(&keySet)
+		require.NoError(t, err)
+
+		var keyIDs []string
+
+		for _, key := range keySet.Keys {
+			keyIDs = append(keyIDs, key.KeyID)
+		}
+
+		return keyIDs
+	}
+
+	assert.Equal(t, []string{"2023-10", "2023-09"}, keyIDs(), "retired keys should be published during their grace period")
+
+	clock.Advance(2 * time.Hour)
+
+	assert.Equal(t, []string{"2023-10"}, keyIDs(), "retired keys should not be published after their grace period")
+
+	// Tokens refer to the configured ID of the primary key
+	token, err := issuer.IssueAccessToken(context.Background(), "service.example.com", subjectStub{id: "id"}, []auth.Scope{})
+	require.NoError(t, err)
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(token.Payload, jwt.MapClaims{})
+	require.NoError(t, err)
+
+	assert.Equal(t, "2023-10", parsed.Header["kid"])
+}
+
+func TestJWKSHandler_ThumbprintKeyIDs(t *testing.T) {
+	primaryKey, err := libtrust.GenerateECP256PrivateKey()
+	require.NoError(t, err)
+
+	retiredKey, err := libtrust.GenerateRSA2048PrivateKey()
+	require.NoError(t, err)
+
+	primaryThumbprint, err := JWKThumbprint(primaryKey.PublicKey())
+	require.NoError(t, err)
+
+	retiredThumbprint, err := JWKThumbprint(retiredKey.PublicKey())
+	require.NoError(t, err)
+
+	issuer := NewAccessTokenIssuer(
+		"issuer.example.com",
+		primaryKey,
+		time.Minute,
+		WithRetiredKeys(
+			RetiredKey{Key: retiredKey.PublicKey()},
+			RetiredKey{ID: "2023-09", Key: retiredKey.PublicKey()},
+		),
+		WithThumbprintKeyIDs(),
+	)
+
+	handler := JWKSHandler(issuer)
+
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var keySet struct {
+		Keys []struct {
+			KeyID string `json:"kid"`
+		} `json:"keys"`
+	}
+
+	err = json.NewDecoder(rec.Body).Decode(&keySet)
+	require.NoError(t, err)
+
+	require.Len(t, keySet.Keys, 3)
+
+	assert.Equal(t, primaryThumbprint, keySet.Keys[0].KeyID)
+	assert.Equal(t, retiredThumbprint, keySet.Keys[1].KeyID)
+	assert.Equal(t, "2023-09", keySet.Keys[2].KeyID, "configured IDs should take precedence")
+
+	// The kid header of issued tokens is the thumbprint of the signing key
+	token, err := issuer.IssueAccessToken(context.Background(), "service.example.com", subjectStub{id: "id"}, []auth.Scope{})
+	require.NoError(t, err)
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(token.Payload, jwt.MapClaims{})
+	require.NoError(t, err)
+
+	assert.Equal(t, primaryThumbprint, parsed.Header["kid"])
+}
+
+func TestJWKSHandler_CertificateChain(t *testing.T) {
+	signingKey, err := libtrust.LoadKeyFile("testdata/private.pem")
+	require.NoError(t, err)
+
+	otherKey, err := libtrust.GenerateECP256PrivateKey()
+	require.NoError(t, err)
+
+	chain := createCertificateChain(t, signingKey)
+
+	tokenIssuer := NewAccessTokenIssuer(
+		"issuer.example.com",
+		signingKey,
+		15*time.Minute,
+		WithCertificateChain(chain),
+		WithWeightedSigningKeys(
+			WeightedSigningKey{Key: signingKey, Weight: 1},
+			WeightedSigningKey{Key: otherKey, Weight: 0},
+		),
+	)
+
+	rec := httptest.NewRecorder()
+
+	JWKSHandler(tokenIssuer).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var keySet struct {
+		Keys []map[string]any `json:"keys"`
+	}
+
+	err = json.NewDecoder(rec.Body).Decode(&keySet)
+	require.NoError(t, err)
+
+	require.Len(t, keySet.Keys, 2)
+
+	sha1Sum := sha1.Sum(chain[0].Raw)
+	sha256Sum := sha256.Sum256(chain[0].Raw)
+
+	assert.Equal(
+		t,
+		[]any{
+			base64.StdEncoding.EncodeToString(chain[0].Raw),
+			base64.StdEncoding.EncodeToString(chain[1].Raw),
+		},
+		keySet.Keys[0]["x5c"],
+	)
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(sha1Sum[:]), keySet.Keys[0]["x5t"])
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(sha256Sum[:]), keySet.Keys[0]["x5t#S256"])
+
+	// The chain belongs to the primary signing key only
+	assert.NotContains(t, keySet.Keys[1], "x5c")
+	assert.NotContains(t, keySet.Keys[1], "x5t")
+}
@@ -1,6 +1,7 @@
 package jwt
 
 import (
+	"crypto/ecdsa"
 	"fmt"
 
 	"github.com/docker/libtrust"
@@ -13,7 +14,81 @@ func detectSigningMethod(signingKey libtrust.PrivateKey) (jwt.SigningMethod, err
 		return jwt.SigningMethodRS256, nil
 	case "EC":
 		return jwt.SigningMethodES256, nil
+	case keyTypeOKP:
+		return jwt.SigningMethodEdDSA, nil
 	}
 
 	return nil, fmt.Errorf("unsupported signing key type %q", signingKey.KeyType())
 }
+
+// signingMethod returns the signing method for alg or detects it from signingKey if alg is empty.
+func signingMethod(signingKey libtrust.PrivateKey, alg string) (jwt.SigningMethod, error) {
+	if alg == "" {
+		return detectSigningMethod(signingKey)
+	}
+
+	err := CheckSigningAlgorithm(signingKey, alg)
+	if err != nil {
+		return nil, err
+	}
+
+	return jwt.GetSigningMethod(alg), nil
+}
+
+// CheckSigningAlgorithm checks that alg is a supported signing algorithm and that signingKey can be used with it.
+//
+// Supported algorithms are RS256, RS384, RS512, PS256, PS384 and PS512 for RSA keys
+// ES256, ES384 and ES512 for EC keys (with the matching curve) and EdDSA for Ed25519 keys.
+func CheckSigningAlgorithm(signingKey libtrust.PrivateKey, alg string) error {
+	switch method := jwt.GetSigningMethod(alg).(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if signingKey.KeyType() != "RSA" {
+			return fmt.Errorf("signing algorithm %s requires an RSA key, got %s", alg, signingKey.KeyType())
+		}
+
+	case *jwt.SigningMethodECDSA:
+		key, ok := signingKey.CryptoPrivateKey().(*ecdsa.PrivateKey)
+		if !ok {
+			return fmt.Errorf("signing algorithm %s requires an EC key, got %s", alg, signingKey.KeyType())
+		}
+
+		if key.Curve.Params().BitSize != method.CurveBits {
+			return fmt.Errorf("signing algorithm %s requires a P-%d key, got %s", alg, method.CurveBits, key.Curve.Params().Name)
+		}
+
+	case *jwt.SigningMethodEd25519:
+		if signingKey.KeyType() != keyTypeOKP {
+			return fmt.Errorf("signing algorithm %s requires an Ed25519 key, got %s", alg, signingKey.KeyType())
+		}
+
+	default:
+		return fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+
+	return nil
+}
+
+// CheckSigningKey signs a test token with signingKey (using alg or the default algorithm for the key type if alg is empty)
+// and verifies it with the corresponding public key.
+//
+// It allows detecting unusable keys early (eg. at startup) instead of when the first token is issued.
+func CheckSigningKey(signingKey libtrust.PrivateKey, alg string) error {
+	method, err := signingMethod(signingKey, alg)
+	if err != nil {
+		return err
+	}
+
+	token, err := jwt.NewWithClaims(method, jwt.RegisteredClaims{Subject: "self-test"}).SignedString(signingKey.CryptoPrivateKey())
+	if err != nil {
+		return fmt.Errorf("signing test token: %w", err)
+	}
+
+	_, err = jwt.NewParser(jwt.WithValidMethods([]string{method.Alg()})).Parse(token, func(_ *jwt.Token) (any, error) {
+		return signingKey.CryptoPublicKey(), nil
+	})
+	if err != nil {
+		return fmt.Errorf("verifying test token: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package jwt
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/docker/libtrust"
+)
+
+// WeightedSigningKey is a signing key with a relative weight.
+//
+// The probability of a key being selected for signing a token is its weight divided by the sum of all weights.
+type WeightedSigningKey struct {
+	Key    libtrust.PrivateKey
+	Weight int
+}
+
+// RetiredKey is a key that no longer signs tokens, but is still published for verifying tokens signed before a key rotation.
+type RetiredKey struct {
+	// ID identifies the key in the published key set.
+	// Defaults to the ID derived from the key.
+	ID string
+
+	Key libtrust.PublicKey
+
+	// NotAfter is the end of the grace period: the key is no longer published after it.
+	// The zero value publishes the key indefinitely.
+	NotAfter time.Time
+}
+
+// selectSigningKey selects a key from keys proportionally to their weights using random numbers read from r.
+func selectSigningKey(keys []WeightedSigningKey, r io.Reader) (libtrust.PrivateKey, error) {
+	var total uint64
+
+	for _, key := range keys {
+		if key.Weight > 0 {
+			total += uint64(key.Weight)
+		}
+	}
+
+	if total == 0 {
+		return nil, errors.New("no signing key with a positive weight")
+	}
+
+	var buf [8]byte
+
+	_, err := io.ReadFull(r, buf[:])
+	if err != nil {
+		return nil, err
+	}
+
+	n := binary.BigEndian.Uint64(buf[:]) % total
+
+	for _, key := range keys {
+		if key.Weight <= 0 {
+			continue
+		}
+
+		if n < uint64(key.Weight) {
+			return key.Key, nil
+		}
+
+		n -= uint64(key.Weight)
+	}
+
+	// This should never happen
+	return keys[len(keys)-1].Key, nil
+}
@@ -0,0 +1,165 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/docker/libtrust"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+func TestAccessTokenIssuer_IssueAccessToken_WeightedSigningKeys(t *testing.T) {
+	oldKey, err := libtrust.GenerateECP256PrivateKey()
+	require.NoError(t, err)
+
+	newKey, err := libtrust.GenerateECP256PrivateKey()
+	require.NoError(t, err)
+
+	tokenIssuer := NewAccessTokenIssuer(
+		"issuer.example.com",
+		oldKey,
+		15*time.Minute,
+		WithDependencies(auth.Dependencies{Rand: rand.New(rand.NewSource(1))}),
+		WithWeightedSigningKeys(
+			WeightedSigningKey{Key: oldKey, Weight: 80},
+			WeightedSigningKey{Key: newKey, Weight: 20},
+		),
+	)
+
+	const issuances = 2000
+
+	counts := map[string]int{}
+
+	for i := 0; i < issuances; i++ {
+		token, err := tokenIssuer.IssueAccessToken(context.Background(), "service.example.com", subjectStub{id: "id"}, nil)
+		require.NoError(t, err)
+
+		parsedToken, _, err := jwt.NewParser().ParseUnverified(token.Payload, &jwt.RegisteredClaims{})
+		require.NoError(t, err)
+
+		jwk, ok := parsedToken.Header["jwk"].(map[string]any)
+		require.True(t, ok)
+
+		counts[jwk["kid"].(string)]++
+	}
+
+	assert.InDelta(t, 0.8, float64(counts[oldKey.KeyID()])/issuances, 0.05)
+	assert.InDelta(t, 0.2, float64(counts[newKey.KeyID()])/issuances, 0.05)
+}
+
+func TestAccessTokenIssuer_IssueAccessToken_WeightedSigningKeys_NoPositiveWeight(t *testing.T) {
+	signingKey, err := libtrust.LoadKeyFile("testdata/private.pem")
+	require.NoError(t, err)
+
+	tokenIssuer := NewAccessTokenIssuer(
+		"issuer.example.com",
+		signingKey,
+		15*time.Minute,
+		WithWeightedSigningKeys(WeightedSigningKey{Key: signingKey}),
+	)
+
+	_, err = tokenIssuer.IssueAccessToken(context.Background(), "service.example.com", subjectStub{id: "id"}, nil)
+	require.Error(t, err)
+}
+
+func TestAccessTokenIssuer_IssueAccessToken_ServiceSigningAlgorithms(t *testing.T) {
+	rsaKey, err := libtrust.LoadKeyFile("testdata/private.pem")
+	require.NoError(t, err)
+
+	ecKey, err := libtrust.GenerateECP256PrivateKey()
+	require.NoError(t, err)
+
+	tokenIssuer := auth.ServiceAccessTokenIssuer{
+		Issuers: map[string]auth.AccessTokenIssuer{
+			"rsa.example.com": NewAccessTokenIssuer("issuer.example.com", rsaKey, 15*time.Minute, WithSigningAlgorithm("RS384")),
+			"ec.example.com":  NewAccessTokenIssuer("issuer.example.com", ecKey, 15*time.Minute, WithSigningAlgorithm("ES256")),
+		},
+	}
+
+	testCases := []struct {
+		service   string
+		alg       string
+		publicKey libtrust.PublicKey
+	}{
+		{
+			service:   "rsa.example.com",
+			alg:       "RS384",
+			publicKey: rsaKey.PublicKey(),
+		},
+		{
+			service:   "ec.example.com",
+			alg:       "ES256",
+			publicKey: ecKey.PublicKey(),
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.service, func(t *testing.T) {
+			token, err := tokenIssuer.IssueAccessToken(context.Background(), testCase.service, subjectStub{id: "id"}, nil)
+			require.NoError(t, err)
+
+			parsedToken, err := jwt.NewParser(jwt.WithValidMethods([]string{testCase.alg})).Parse(token.Payload, func(_ *jwt.Token) (any, error) {
+				return testCase.publicKey.CryptoPublicKey(), nil
+			})
+			require.NoError(t, err)
+
+			assert.Equal(t, testCase.alg, parsedToken.Method.Alg())
+		})
+	}
+
+	t.Run("UnknownService", func(t *testing.T) {
+		_, err := tokenIssuer.IssueAccessToken(context.Background(), "unknown.example.com", subjectStub{id: "id"}, nil)
+		require.ErrorIs(t, err, auth.ErrInvalidRequest)
+	})
+}
+
+func TestCheckSigningAlgorithm(t *testing.T) {
+	rsaKey, err := libtrust.LoadKeyFile("testdata/private.pem")
+	require.NoError(t, err)
+
+	ecKey, err := libtrust.GenerateECP256PrivateKey()
+	require.NoError(t, err)
+
+	require.NoError(t, CheckSigningAlgorithm(rsaKey, "PS256"))
+	require.NoError(t, CheckSigningAlgorithm(ecKey, "ES256"))
+
+	assert.Error(t, CheckSigningAlgorithm(rsaKey, "ES256"))
+	assert.Error(t, CheckSigningAlgorithm(ecKey, "RS256"))
+	assert.Error(t, CheckSigningAlgorithm(ecKey, "ES384"))
+	assert.Error(t, CheckSigningAlgorithm(rsaKey, "HS256"))
+}
+
+func TestCheckSigningKey(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		signingKey, err := libtrust.LoadKeyFile("testdata/private.pem")
+		require.NoError(t, err)
+
+		require.NoError(t, CheckSigningKey(signingKey, ""))
+		require.NoError(t, CheckSigningKey(signingKey, "PS512"))
+	})
+
+	t.Run("PublicKeyMismatch", func(t *testing.T) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+		require.NoError(t, err)
+
+		otherKey, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+		require.NoError(t, err)
+
+		// Private part does not belong to the public part
+		corruptKey, err := libtrust.FromCryptoPrivateKey(&ecdsa.PrivateKey{PublicKey: otherKey.PublicKey, D: key.D})
+		require.NoError(t, err)
+
+		require.Error(t, CheckSigningKey(corruptKey, ""))
+	})
+}
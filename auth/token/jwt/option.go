@@ -1,5 +1,12 @@
 package jwt
 
+import (
+	"crypto/x509"
+	"time"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
 // AccessTokenIssuerOption configures a AccessTokenIssuer.
 type AccessTokenIssuerOption interface {
 	applyAccessTokenIssuer(i *AccessTokenIssuer)
@@ -10,10 +17,46 @@ type RefreshTokenIssuerOption interface {
 	applyRefreshTokenIssuer(i *RefreshTokenIssuer)
 }
 
-// Option configures a token issuer.
+// DPoPProofVerifierOption configures a DPoPProofVerifier.
+type DPoPProofVerifierOption interface {
+	applyDPoPProofVerifier(v *DPoPProofVerifier)
+}
+
+// IssuerOption configures both access and refresh token issuers.
+type IssuerOption interface {
+	AccessTokenIssuerOption
+	RefreshTokenIssuerOption
+}
+
+// Option configures a token issuer or verifier.
 type Option interface {
 	AccessTokenIssuerOption
 	RefreshTokenIssuerOption
+	DPoPProofVerifierOption
+}
+
+// WithDependencies configures a token issuer or verifier to use the clock, random source and ID generator from deps.
+func WithDependencies(deps auth.Dependencies) Option {
+	return withDependencies{deps}
+}
+
+type withDependencies struct {
+	deps auth.Dependencies
+}
+
+func (w withDependencies) applyAccessTokenIssuer(i *AccessTokenIssuer) {
+	i.clock = w.deps.GetClock()
+	i.idGenerator = w.deps.GetIDGenerator()
+	i.rand = w.deps.GetRand()
+}
+
+func (w withDependencies) applyRefreshTokenIssuer(i *RefreshTokenIssuer) {
+	i.clock = w.deps.GetClock()
+	i.idGenerator = w.deps.GetIDGenerator()
+}
+
+func (w withDependencies) applyDPoPProofVerifier(v *DPoPProofVerifier) {
+	v.clock = w.deps.GetClock()
 }
 
 // WithClock configures a token issuer to use a Clock.
@@ -33,7 +76,11 @@ func (w withClock) applyRefreshTokenIssuer(i *RefreshTokenIssuer) {
 	i.clock = w.clock
 }
 
-// WIthIDGenerator configures a token issuer to use an IDGenerator.
+func (w withClock) applyDPoPProofVerifier(v *DPoPProofVerifier) {
+	v.clock = w.clock
+}
+
+// WithIDGenerator configures a token issuer to use an IDGenerator.
 func WithIDGenerator(idGenerator IDGenerator) AccessTokenIssuerOption {
 	return withIDGenerator{idGenerator}
 }
@@ -45,3 +92,230 @@ type withIDGenerator struct {
 func (w withIDGenerator) applyAccessTokenIssuer(i *AccessTokenIssuer) {
 	i.idGenerator = w.idGenerator
 }
+
+// WithRefreshTokenExpiration configures a RefreshTokenIssuer to issue tokens that expire after the given duration.
+//
+// By default, refresh tokens do not expire.
+func WithRefreshTokenExpiration(expiration time.Duration) RefreshTokenIssuerOption {
+	return withRefreshTokenExpiration{expiration}
+}
+
+type withRefreshTokenExpiration struct {
+	expiration time.Duration
+}
+
+func (w withRefreshTokenExpiration) applyRefreshTokenIssuer(i *RefreshTokenIssuer) {
+	i.expiration = w.expiration
+}
+
+// WithLeeway configures a token issuer to tolerate clock skew between the issuer and token verifiers (eg. registries).
+//
+// Issued tokens become valid (nbf) leeway before their time of issuance, so that verifiers with a clock running behind accept them.
+// A RefreshTokenIssuer also accepts refresh tokens up to leeway after they expire (or before they become valid).
+func WithLeeway(leeway time.Duration) IssuerOption {
+	return withLeeway{leeway}
+}
+
+type withLeeway struct {
+	leeway time.Duration
+}
+
+func (w withLeeway) applyAccessTokenIssuer(i *AccessTokenIssuer) {
+	i.leeway = w.leeway
+}
+
+func (w withLeeway) applyRefreshTokenIssuer(i *RefreshTokenIssuer) {
+	i.leeway = w.leeway
+}
+
+// WithSessionLimiter configures a RefreshTokenIssuer to cap the number of concurrent sessions (refresh token families) per subject.
+//
+// Every refresh token carries the ID of its session in the "sid" claim.
+// Refresh tokens issued in exchange for a refresh token stay in the same session, other ones start a new session.
+// Refresh tokens of revoked sessions are rejected.
+func WithSessionLimiter(limiter SessionLimiter) RefreshTokenIssuerOption {
+	return withSessionLimiter{limiter}
+}
+
+type withSessionLimiter struct {
+	limiter SessionLimiter
+}
+
+func (w withSessionLimiter) applyRefreshTokenIssuer(i *RefreshTokenIssuer) {
+	i.sessionLimiter = w.limiter
+}
+
+// WithCertificateChain configures an AccessTokenIssuer to include a certificate chain (x5c) and its thumbprint (x5t) in the token header.
+//
+// The chain should be verified using [VerifyCertificateChain] first.
+func WithCertificateChain(chain []*x509.Certificate) AccessTokenIssuerOption {
+	return withCertificateChain{chain}
+}
+
+type withCertificateChain struct {
+	chain []*x509.Certificate
+}
+
+func (w withCertificateChain) applyAccessTokenIssuer(i *AccessTokenIssuer) {
+	i.certificateChain = w.chain
+}
+
+// WithAuthenticationMethods configures an AccessTokenIssuer to include the method the subject authenticated with
+// in the "amr" claim of access tokens (if the method has a value registered by RFC 8176).
+func WithAuthenticationMethods() AccessTokenIssuerOption {
+	return withAuthenticationMethods{}
+}
+
+type withAuthenticationMethods struct{}
+
+func (withAuthenticationMethods) applyAccessTokenIssuer(i *AccessTokenIssuer) {
+	i.authenticationMethods = true
+}
+
+// WithAuthTime configures an AccessTokenIssuer to include the time the subject originally authenticated at in the "auth_time" claim.
+//
+// Tokens issued using a refresh token carry the authentication time of the refresh token (see [auth.GetSubjectAuthTime]),
+// otherwise it is the time of issuance.
+func WithAuthTime() AccessTokenIssuerOption {
+	return withAuthTime{}
+}
+
+type withAuthTime struct{}
+
+func (withAuthTime) applyAccessTokenIssuer(i *AccessTokenIssuer) {
+	i.authTime = true
+}
+
+// WithScopeClaim configures an AccessTokenIssuer to include the granted access in a standard "scope" claim
+// (space-delimited scopes, eg. "repository:foo:pull,push") in addition to the "access" claim.
+func WithScopeClaim() AccessTokenIssuerOption {
+	return withScopeClaim{}
+}
+
+type withScopeClaim struct{}
+
+func (withScopeClaim) applyAccessTokenIssuer(i *AccessTokenIssuer) {
+	i.scopeClaim = true
+}
+
+// WithScopeHashClaim configures an AccessTokenIssuer to include a hash of the granted access in a "scope_hash" claim (see [ScopeHash]),
+// binding the token to the exact scope it was issued for: registries cross-checking the claim reject tokens replayed for other operations.
+func WithScopeHashClaim() AccessTokenIssuerOption {
+	return withScopeHashClaim{}
+}
+
+type withScopeHashClaim struct{}
+
+func (withScopeHashClaim) applyAccessTokenIssuer(i *AccessTokenIssuer) {
+	i.scopeHashClaim = true
+}
+
+// WithTenantAudience configures an AccessTokenIssuer to add the value of a subject attribute (eg. tenant) to the "aud" claim
+// next to the requested service, so that registries enforcing tenant isolation can tell which tenant a token belongs to.
+//
+// Tokens of subjects without the attribute (eg. anonymous ones) are only issued for the service.
+func WithTenantAudience(attribute string) AccessTokenIssuerOption {
+	return withTenantAudience{attribute}
+}
+
+type withTenantAudience struct {
+	attribute string
+}
+
+func (w withTenantAudience) applyAccessTokenIssuer(i *AccessTokenIssuer) {
+	i.tenantAudienceAttribute = w.attribute
+}
+
+// WithWeightedSigningKeys configures an AccessTokenIssuer to sign each token with a key randomly selected from keys
+// (proportionally to their weights) instead of always using the signing key passed to [NewAccessTokenIssuer].
+//
+// It allows gradually rolling out a new signing key. Keys with a non-positive weight are never selected.
+func WithWeightedSigningKeys(keys ...WeightedSigningKey) AccessTokenIssuerOption {
+	return withWeightedSigningKeys{keys}
+}
+
+type withWeightedSigningKeys struct {
+	keys []WeightedSigningKey
+}
+
+func (w withWeightedSigningKeys) applyAccessTokenIssuer(i *AccessTokenIssuer) {
+	i.weightedSigningKeys = w.keys
+}
+
+// WithKeyID configures an AccessTokenIssuer to identify the primary signing key by id
+// (in the kid header of tokens and in the published key set) instead of the ID derived from the key.
+func WithKeyID(id string) AccessTokenIssuerOption {
+	return withKeyID{id}
+}
+
+type withKeyID struct {
+	id string
+}
+
+func (w withKeyID) applyAccessTokenIssuer(i *AccessTokenIssuer) {
+	i.keyID = w.id
+}
+
+// WithThumbprintKeyIDs configures an AccessTokenIssuer to identify keys by their [JWK Thumbprint] (RFC 7638)
+// instead of the libtrust key ID, both in the kid header of tokens and in the published key set.
+//
+// Thumbprints are stable across restarts and rotations, so there is no need to assign IDs manually.
+// IDs configured using [WithKeyID] or [RetiredKey] take precedence.
+//
+// [JWK Thumbprint]: https://datatracker.ietf.org/doc/html/rfc7638
+func WithThumbprintKeyIDs() AccessTokenIssuerOption {
+	return withThumbprintKeyIDs{}
+}
+
+type withThumbprintKeyIDs struct{}
+
+func (withThumbprintKeyIDs) applyAccessTokenIssuer(i *AccessTokenIssuer) {
+	i.thumbprintKeyIDs = true
+}
+
+// WithRetiredKeys configures an AccessTokenIssuer to keep publishing keys that no longer sign tokens (see [AccessTokenIssuer.PublicKeys]),
+// so that tokens signed before a key rotation can still be verified.
+func WithRetiredKeys(keys ...RetiredKey) AccessTokenIssuerOption {
+	return withRetiredKeys{keys}
+}
+
+type withRetiredKeys struct {
+	keys []RetiredKey
+}
+
+func (w withRetiredKeys) applyAccessTokenIssuer(i *AccessTokenIssuer) {
+	i.retiredKeys = w.keys
+}
+
+// WithSigningAlgorithm configures an AccessTokenIssuer to sign tokens using alg (eg. RS384 or ES384)
+// instead of the default algorithm for the type of the signing key (RS256 or ES256).
+//
+// Use [CheckSigningAlgorithm] to make sure the signing key supports alg.
+func WithSigningAlgorithm(alg string) AccessTokenIssuerOption {
+	return withSigningAlgorithm{alg}
+}
+
+type withSigningAlgorithm struct {
+	alg string
+}
+
+func (w withSigningAlgorithm) applyAccessTokenIssuer(i *AccessTokenIssuer) {
+	i.signingAlgorithm = w.alg
+}
+
+// WithExpirationPolicies configures an AccessTokenIssuer to shorten the lifetime of tokens
+// granting access to resources matched by policies (eg. sensitive repositories).
+//
+// For every granted scope the most specific matching policy applies.
+// The token expires after the shortest resulting lifetime, but never later than the default expiration.
+func WithExpirationPolicies(policies ...ExpirationPolicy) AccessTokenIssuerOption {
+	return withExpirationPolicies{policies}
+}
+
+type withExpirationPolicies struct {
+	policies []ExpirationPolicy
+}
+
+func (w withExpirationPolicies) applyAccessTokenIssuer(i *AccessTokenIssuer) {
+	i.expirationPolicies = w.policies
+}
@@ -0,0 +1,70 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/docker/libtrust"
+)
+
+// LoadPrivateKeyFile loads a PEM encoded private key from a file (see ParsePrivateKeyPEM).
+func LoadPrivateKeyFile(filename string) (libtrust.PrivateKey, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParsePrivateKeyPEM(data)
+}
+
+// ParsePrivateKeyPEM parses a PEM encoded private key.
+//
+// The key type is detected from the encoding: RSA keys may be encoded in PKCS#1 or PKCS#8,
+// EC keys in SEC 1 or PKCS#8 and Ed25519 keys in PKCS#8 format (see NewEd25519PrivateKey). Other blocks (eg. the EC PARAMETERS block written by OpenSSL) are skipped.
+func ParsePrivateKeyPEM(data []byte) (libtrust.PrivateKey, error) {
+	for {
+		var block *pem.Block
+
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("no PEM encoded private key found")
+		}
+
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("parsing PKCS#1 RSA private key: %w", err)
+			}
+
+			return libtrust.FromCryptoPrivateKey(key)
+
+		case "EC PRIVATE KEY":
+			key, err := x509.ParseECPrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("parsing SEC 1 EC private key: %w", err)
+			}
+
+			return libtrust.FromCryptoPrivateKey(key)
+
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("parsing PKCS#8 private key: %w", err)
+			}
+
+			if key, ok := key.(ed25519.PrivateKey); ok {
+				return NewEd25519PrivateKey(key), nil
+			}
+
+			return libtrust.FromCryptoPrivateKey(key)
+
+		case "ENCRYPTED PRIVATE KEY":
+			return nil, errors.New("encrypted private keys are not supported")
+		}
+	}
+}
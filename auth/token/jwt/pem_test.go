@@ -0,0 +1,82 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePrivateKeyPEM(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	encode := func(t *testing.T, typ string, der []byte) []byte {
+		t.Helper()
+
+		return pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+	}
+
+	pkcs8 := func(t *testing.T, key any) []byte {
+		t.Helper()
+
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		require.NoError(t, err)
+
+		return encode(t, "PRIVATE KEY", der)
+	}
+
+	sec1, err := x509.MarshalECPrivateKey(ecKey)
+	require.NoError(t, err)
+
+	ecParameters := encode(t, "EC PARAMETERS", []byte{0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07})
+
+	testCases := []struct {
+		name    string
+		data    []byte
+		keyType string
+	}{
+		{"PKCS1", encode(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey)), "RSA"},
+		{"PKCS8RSA", pkcs8(t, rsaKey), "RSA"},
+		{"SEC1", encode(t, "EC PRIVATE KEY", sec1), "EC"},
+		{"SEC1WithParameters", append(ecParameters, encode(t, "EC PRIVATE KEY", sec1)...), "EC"},
+		{"PKCS8EC", pkcs8(t, ecKey), "EC"},
+		{"PKCS8Ed25519", pkcs8(t, ed25519Key), "OKP"},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			key, err := ParsePrivateKeyPEM(testCase.data)
+			require.NoError(t, err)
+
+			assert.Equal(t, testCase.keyType, key.KeyType())
+		})
+	}
+
+	t.Run("Corrupt", func(t *testing.T) {
+		_, err := ParsePrivateKeyPEM(encode(t, "PRIVATE KEY", []byte("corrupt")))
+		require.Error(t, err)
+
+		assert.Contains(t, err.Error(), "PKCS#8")
+	})
+
+	t.Run("NotPEM", func(t *testing.T) {
+		_, err := ParsePrivateKeyPEM([]byte("private_key.pem"))
+		require.Error(t, err)
+	})
+}
@@ -2,20 +2,38 @@ package jwt
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/docker/libtrust"
 	"github.com/golang-jwt/jwt/v4"
-	"github.com/jonboulle/clockwork"
 
 	"github.com/sagikazarmark/registry-auth/auth"
+	"github.com/sagikazarmark/registry-auth/auth/authn"
 )
 
 // RefreshTokenIssuer issues a refresh token.
 type RefreshTokenIssuer struct {
 	issuer     string
 	signingKey libtrust.PrivateKey
+	expiration time.Duration
+	leeway     time.Duration
 
-	clock Clock
+	sessionLimiter SessionLimiter
+
+	idGenerator IDGenerator
+	clock       Clock
+}
+
+// SessionLimiter caps the number of concurrent sessions (refresh token families) of a subject.
+//
+// See [github.com/sagikazarmark/registry-auth/auth/revocation.SessionLimiter] for an implementation.
+type SessionLimiter interface {
+	// RecordSession records a session of a subject, revoking its oldest sessions exceeding the limit.
+	RecordSession(ctx context.Context, subject auth.SubjectID, id string, expiresAt time.Time) error
+
+	// IsSessionRevoked reports whether a session is revoked.
+	IsSessionRevoked(ctx context.Context, id string) (bool, error)
 }
 
 // NewRefreshTokenIssuer returns a new RefreshTokenIssuer.
@@ -29,49 +47,128 @@ func NewRefreshTokenIssuer(issuer string, signingKey libtrust.PrivateKey, opts .
 		opt.applyRefreshTokenIssuer(&i)
 	}
 
+	if i.idGenerator == nil {
+		i.idGenerator = auth.Dependencies{}.GetIDGenerator()
+	}
+
 	if i.clock == nil {
-		i.clock = clockwork.NewRealClock()
+		i.clock = auth.Dependencies{}.GetClock()
 	}
 
 	return i
 }
 
 // IssueRefreshToken implements auth.RefreshTokenIssuer.
-func (i RefreshTokenIssuer) IssueRefreshToken(_ context.Context, service string, subject auth.Subject) (string, error) {
+func (i RefreshTokenIssuer) IssueRefreshToken(ctx context.Context, service string, subject auth.Subject) (auth.RefreshToken, error) {
 	alg, err := detectSigningMethod(i.signingKey)
 	if err != nil {
-		return "", err
+		return auth.RefreshToken{}, err
 	}
 
 	now := i.clock.Now()
 
-	claims := jwt.RegisteredClaims{
-		Issuer:    i.issuer,
-		Subject:   string(subject.ID()),
-		Audience:  []string{service},
-		NotBefore: jwt.NewNumericDate(now),
-		IssuedAt:  jwt.NewNumericDate(now),
+	authTime, ok := auth.GetSubjectAuthTime(subject)
+	if !ok {
+		authTime = now
+	}
+
+	claims := refreshTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    i.issuer,
+			Subject:   string(subject.ID()),
+			Audience:  []string{service},
+			NotBefore: jwt.NewNumericDate(now.Add(-i.leeway)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		AuthTime: jwt.NewNumericDate(authTime),
+	}
+
+	var expiresAt time.Time
+
+	if i.expiration > 0 {
+		expiresAt = now.Add(i.expiration)
+		claims.ExpiresAt = jwt.NewNumericDate(expiresAt)
+	}
+
+	if i.sessionLimiter != nil {
+		// Refresh tokens issued in exchange for a refresh token stay in its session
+		sessionID, ok := auth.GetSubjectSessionID(subject)
+		if !ok {
+			sessionID, err = i.idGenerator.GenerateID()
+			if err != nil {
+				return auth.RefreshToken{}, err
+			}
+		}
+
+		claims.SessionID = sessionID
 	}
 
 	token := jwt.NewWithClaims(alg, claims)
 
+	// Don't waste resources on signing if the client is gone
+	if err := ctx.Err(); err != nil {
+		return auth.RefreshToken{}, err
+	}
+
 	signedToken, err := token.SignedString(i.signingKey.CryptoPrivateKey())
 	if err != nil {
-		return "", err
+		return auth.RefreshToken{}, err
 	}
 
-	return signedToken, nil
+	if i.sessionLimiter != nil {
+		err := i.sessionLimiter.RecordSession(ctx, subject.ID(), claims.SessionID, expiresAt)
+		if err != nil {
+			return auth.RefreshToken{}, err
+		}
+	}
+
+	return auth.RefreshToken{
+		Payload:   signedToken,
+		ExpiresIn: i.expiration,
+		IssuedAt:  now,
+	}, nil
 }
 
 // VerifyRefreshToken implements authn.RefreshTokenVerifier.
-func (i RefreshTokenIssuer) VerifyRefreshToken(_ context.Context, service string, refreshToken string) (auth.SubjectID, error) {
-	var claims jwt.RegisteredClaims
+func (i RefreshTokenIssuer) VerifyRefreshToken(ctx context.Context, service string, refreshToken string) (auth.SubjectID, error) {
+	subjectID, _, err := i.VerifyRefreshTokenAuthTime(ctx, service, refreshToken)
+
+	return subjectID, err
+}
+
+// VerifyRefreshTokenAuthTime implements authn.RefreshTokenAuthTimeVerifier.
+//
+// Tokens without an "auth_time" claim fall back to the time they were issued at.
+func (i RefreshTokenIssuer) VerifyRefreshTokenAuthTime(ctx context.Context, service string, refreshToken string) (auth.SubjectID, time.Time, error) {
+	session, err := i.VerifyRefreshTokenSession(ctx, service, refreshToken)
+
+	return session.SubjectID, session.AuthTime, err
+}
+
+// VerifyRefreshTokenSession implements authn.RefreshTokenSessionVerifier.
+//
+// If the issuer limits sessions (see [WithSessionLimiter]), tokens belonging to a revoked session are rejected.
+func (i RefreshTokenIssuer) VerifyRefreshTokenSession(ctx context.Context, service string, refreshToken string) (authn.RefreshTokenSession, error) {
+	var claims refreshTokenClaims
 
-	token, err := jwt.ParseWithClaims(refreshToken, &claims, func(token *jwt.Token) (interface{}, error) {
+	// Time based claims are verified below (using the clock of the issuer and leeway)
+	parser := jwt.NewParser(jwt.WithoutClaimsValidation())
+
+	token, err := parser.ParseWithClaims(refreshToken, &claims, func(token *jwt.Token) (interface{}, error) {
 		return i.signingKey.CryptoPublicKey(), nil
 	})
 	if err != nil {
-		return "", err
+		return authn.RefreshTokenSession{}, fmt.Errorf("%w: %v", auth.ErrInvalidCredentials, err)
+	}
+
+	now := i.clock.Now()
+
+	if !claims.VerifyExpiresAt(now.Add(-i.leeway), false) {
+		return authn.RefreshTokenSession{}, fmt.Errorf("%w: token is expired", auth.ErrInvalidCredentials)
+	}
+
+	if !claims.VerifyNotBefore(now.Add(i.leeway), false) {
+		return authn.RefreshTokenSession{}, fmt.Errorf("%w: token is not valid yet", auth.ErrInvalidCredentials)
 	}
 	// TODO: validate audience/service/issuer?
 
@@ -82,5 +179,50 @@ func (i RefreshTokenIssuer) VerifyRefreshToken(_ context.Context, service string
 	claims.VerifyAudience(service, true)
 	claims.VerifyIssuer(i.issuer, true)
 
-	return auth.SubjectID(claims.Subject), nil
+	if i.sessionLimiter != nil && claims.SessionID != "" {
+		revoked, err := i.sessionLimiter.IsSessionRevoked(ctx, claims.SessionID)
+		if err != nil {
+			return authn.RefreshTokenSession{}, err
+		}
+
+		if revoked {
+			return authn.RefreshTokenSession{}, fmt.Errorf("%w: session revoked", auth.ErrInvalidCredentials)
+		}
+	}
+
+	session := authn.RefreshTokenSession{
+		SubjectID: auth.SubjectID(claims.Subject),
+		ID:        claims.SessionID,
+	}
+
+	if claims.AuthTime != nil {
+		session.AuthTime = claims.AuthTime.Time
+	} else if claims.IssuedAt != nil {
+		session.AuthTime = claims.IssuedAt.Time
+	}
+
+	return session, nil
+}
+
+// Run implements [auth.Runner]: it runs the background tasks of the session limiter (if any) until ctx is canceled.
+func (i RefreshTokenIssuer) Run(ctx context.Context) error {
+	if runner, ok := i.sessionLimiter.(auth.Runner); ok {
+		return runner.Run(ctx)
+	}
+
+	<-ctx.Done()
+
+	return nil
+}
+
+type refreshTokenClaims struct {
+	jwt.RegisteredClaims
+
+	// AuthTime is the time the subject originally authenticated at.
+	// It is preserved when a refresh token is used to obtain a new one.
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+
+	// SessionID identifies the session (refresh token family) the token belongs to.
+	// It is only set if the issuer limits sessions.
+	SessionID string `json:"sid,omitempty"`
 }
@@ -0,0 +1,32 @@
+package jwt
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"slices"
+	"strings"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+// ScopeHash computes the value of the "scope_hash" claim (see [WithScopeHashClaim]) for a list of scopes.
+//
+// Scopes are serialized in a canonical form (scopes and their actions sorted lexicographically, eg. "repository:foo:pull,push"),
+// joined by spaces and hashed using SHA-256. The hash is encoded using unpadded base64url encoding.
+// Verifiers compute the hash of the scope an operation requires and compare it to the claim.
+func ScopeHash(scopes []auth.Scope) string {
+	serialized := make([]string, 0, len(scopes))
+
+	for _, scope := range scopes {
+		scope.Actions = slices.Clone(scope.Actions)
+		slices.Sort(scope.Actions)
+
+		serialized = append(serialized, scope.String())
+	}
+
+	slices.Sort(serialized)
+
+	sum := sha256.Sum256([]byte(strings.Join(serialized, " ")))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
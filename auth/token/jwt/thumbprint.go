@@ -0,0 +1,68 @@
+package jwt
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/docker/libtrust"
+)
+
+// thumbprintMembers lists the required members of a JWK by key type as defined in RFC 7638.
+var thumbprintMembers = map[string][]string{
+	"EC":  {"crv", "kty", "x", "y"},
+	"OKP": {"crv", "kty", "x"},
+	"RSA": {"e", "kty", "n"},
+}
+
+// JWKThumbprint computes the [JWK Thumbprint] of a public key using SHA-256.
+//
+// [JWK Thumbprint]: https://datatracker.ietf.org/doc/html/rfc7638
+func JWKThumbprint(key libtrust.PublicKey) (string, error) {
+	data, err := key.MarshalJSON()
+	if err != nil {
+		return "", err
+	}
+
+	var jwk map[string]any
+
+	if err := json.Unmarshal(data, &jwk); err != nil {
+		return "", err
+	}
+
+	return jwkThumbprint(jwk)
+}
+
+// jwkThumbprint computes the [JWK Thumbprint] of a JSON Web Key using SHA-256.
+//
+// [JWK Thumbprint]: https://datatracker.ietf.org/doc/html/rfc7638
+func jwkThumbprint(jwk map[string]any) (string, error) {
+	kty, _ := jwk["kty"].(string)
+
+	members, ok := thumbprintMembers[kty]
+	if !ok {
+		return "", fmt.Errorf("unsupported key type %q", kty)
+	}
+
+	// Members are listed in lexicographic order and encoding/json sorts map keys as well
+	required := make(map[string]string, len(members))
+
+	for _, member := range members {
+		value, ok := jwk[member].(string)
+		if !ok {
+			return "", fmt.Errorf("missing required JWK member %q", member)
+		}
+
+		required[member] = value
+	}
+
+	data, err := json.Marshal(required)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
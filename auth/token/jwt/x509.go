@@ -0,0 +1,93 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/docker/libtrust"
+)
+
+// LoadCertificateChain loads a PEM encoded certificate chain from a file.
+//
+// The first certificate must belong to the signing key and every subsequent certificate must be the issuer of the previous one.
+func LoadCertificateChain(filename string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var chain []*x509.Certificate
+
+	for {
+		var block *pem.Block
+
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		chain = append(chain, cert)
+	}
+
+	if len(chain) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+
+	return chain, nil
+}
+
+// VerifyCertificateChain checks that the first certificate in chain belongs to signingKey
+// and that every certificate is signed by the next one in the chain.
+func VerifyCertificateChain(signingKey libtrust.PrivateKey, chain []*x509.Certificate) error {
+	if len(chain) == 0 {
+		return errors.New("certificate chain is empty")
+	}
+
+	publicKey, ok := chain[0].PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !publicKey.Equal(signingKey.CryptoPublicKey()) {
+		return errors.New("certificate does not match signing key")
+	}
+
+	for i := 0; i < len(chain)-1; i++ {
+		if err := chain[i].CheckSignatureFrom(chain[i+1]); err != nil {
+			return fmt.Errorf("certificate %d is not signed by certificate %d: %w", i, i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// certificateChainHeaders returns the x5c, x5t and x5t#S256 header values for chain.
+func certificateChainHeaders(chain []*x509.Certificate) map[string]any {
+	x5c := make([]string, 0, len(chain))
+
+	for _, cert := range chain {
+		x5c = append(x5c, base64.StdEncoding.EncodeToString(cert.Raw))
+	}
+
+	// x5t is defined as a SHA-1 thumbprint by RFC 7515
+	sha1Sum := sha1.Sum(chain[0].Raw)
+	sha256Sum := sha256.Sum256(chain[0].Raw)
+
+	return map[string]any{
+		"x5c":      x5c,
+		"x5t":      base64.RawURLEncoding.EncodeToString(sha1Sum[:]),
+		"x5t#S256": base64.RawURLEncoding.EncodeToString(sha256Sum[:]),
+	}
+}
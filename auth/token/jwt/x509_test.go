@@ -0,0 +1,124 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/docker/libtrust"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createCertificate(t *testing.T, template *x509.Certificate, parent *x509.Certificate, publicKey crypto.PublicKey, signer crypto.Signer) *x509.Certificate {
+	t.Helper()
+
+	if parent == nil {
+		parent = template
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, publicKey, signer)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return cert
+}
+
+func createCertificateChain(t *testing.T, signingKey libtrust.PrivateKey) []*x509.Certificate {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	ca := createCertificate(t, caTemplate, nil, caKey.Public(), caKey)
+
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "issuer.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+
+	leaf := createCertificate(t, leafTemplate, ca, signingKey.CryptoPublicKey(), caKey)
+
+	return []*x509.Certificate{leaf, ca}
+}
+
+func TestVerifyCertificateChain(t *testing.T) {
+	signingKey, err := libtrust.LoadKeyFile("testdata/private.pem")
+	require.NoError(t, err)
+
+	chain := createCertificateChain(t, signingKey)
+
+	t.Run("OK", func(t *testing.T) {
+		err := VerifyCertificateChain(signingKey, chain)
+		require.NoError(t, err)
+	})
+
+	t.Run("KeyMismatch", func(t *testing.T) {
+		otherKey, err := libtrust.GenerateECP256PrivateKey()
+		require.NoError(t, err)
+
+		err = VerifyCertificateChain(otherKey, chain)
+		require.Error(t, err)
+	})
+
+	t.Run("BrokenChain", func(t *testing.T) {
+		err := VerifyCertificateChain(signingKey, []*x509.Certificate{chain[0], chain[0]})
+		require.Error(t, err)
+	})
+}
+
+func TestAccessTokenIssuer_IssueAccessToken_CertificateChain(t *testing.T) {
+	signingKey, err := libtrust.LoadKeyFile("testdata/private.pem")
+	require.NoError(t, err)
+
+	chain := createCertificateChain(t, signingKey)
+
+	tokenIssuer := NewAccessTokenIssuer("issuer.example.com", signingKey, 15*time.Minute, WithCertificateChain(chain))
+
+	token, err := tokenIssuer.IssueAccessToken(context.Background(), "service.example.com", subjectStub{id: "id"}, nil)
+	require.NoError(t, err)
+
+	parsedToken, _, err := jwt.NewParser().ParseUnverified(token.Payload, &jwt.RegisteredClaims{})
+	require.NoError(t, err)
+
+	sha1Sum := sha1.Sum(chain[0].Raw)
+	sha256Sum := sha256.Sum256(chain[0].Raw)
+
+	assert.Equal(
+		t,
+		[]any{
+			base64.StdEncoding.EncodeToString(chain[0].Raw),
+			base64.StdEncoding.EncodeToString(chain[1].Raw),
+		},
+		parsedToken.Header["x5c"],
+	)
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(sha1Sum[:]), parsedToken.Header["x5t"])
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(sha256Sum[:]), parsedToken.Header["x5t#S256"])
+	assert.NotContains(t, parsedToken.Header, "jwk")
+}
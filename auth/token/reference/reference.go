@@ -0,0 +1,338 @@
+// Package reference issues opaque reference access tokens.
+//
+// Instead of carrying the granted access (which may be too large for a header when a client has access to lots of repositories),
+// a reference token is a random string pointing to access stored by the issuer.
+// Registries resolve it using token introspection (RFC 7662), see [IntrospectionHandler].
+//
+// References are kept in memory, so they do not survive restarts and they are not shared between replicas.
+package reference
+
+import (
+	"container/heap"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+// referenceLength is the number of random bytes in a reference.
+const referenceLength = 32
+
+// DefaultMaxEntries is the default maximum number of references kept at the same time.
+const DefaultMaxEntries = 100_000
+
+// DefaultMaxEntriesPerSubject is the default maximum number of references kept for a single subject at the same time.
+//
+// Anonymous subjects share a single limit, so that anonymous clients cannot exhaust the references available to everyone else.
+const DefaultMaxEntriesPerSubject = 1_000
+
+// ErrTooManyReferences is returned when the maximum number of references (in total or for a subject) are kept
+// and none of them expired yet.
+var ErrTooManyReferences = errors.New("too many active reference tokens")
+
+// AccessTokenIssuer issues opaque reference access tokens and resolves them.
+//
+// AccessTokenIssuer is safe for concurrent use.
+type AccessTokenIssuer struct {
+	expiration time.Duration
+
+	clock auth.Clock
+	rand  io.Reader
+
+	maxEntries           int
+	maxEntriesPerSubject int
+
+	mu             sync.Mutex
+	entries        map[string]Access
+	subjectEntries map[auth.SubjectID]int
+	expiry         expiryQueue
+}
+
+// Access is the access a reference token refers to.
+type Access struct {
+	Service   string
+	Subject   auth.SubjectID
+	Scopes    []auth.Scope
+	IssuedAt  time.Time
+	NotBefore time.Time
+	ExpiresAt time.Time
+
+	// DPoPKeyThumbprint is the JWK thumbprint of the DPoP proof key the token is bound to (if any).
+	DPoPKeyThumbprint string
+}
+
+// NewAccessTokenIssuer returns a new AccessTokenIssuer.
+func NewAccessTokenIssuer(expiration time.Duration, opts ...AccessTokenIssuerOption) *AccessTokenIssuer {
+	if expiration <= 0 {
+		panic("expiration cannot be zero")
+	}
+
+	i := &AccessTokenIssuer{
+		expiration:     expiration,
+		entries:        make(map[string]Access),
+		subjectEntries: make(map[auth.SubjectID]int),
+	}
+
+	for _, opt := range opts {
+		opt.applyAccessTokenIssuer(i)
+	}
+
+	if i.clock == nil {
+		i.clock = auth.Dependencies{}.GetClock()
+	}
+
+	if i.rand == nil {
+		i.rand = auth.Dependencies{}.GetRand()
+	}
+
+	if i.maxEntries <= 0 {
+		i.maxEntries = DefaultMaxEntries
+	}
+
+	if i.maxEntriesPerSubject <= 0 {
+		i.maxEntriesPerSubject = DefaultMaxEntriesPerSubject
+	}
+
+	return i
+}
+
+// IssueAccessToken implements auth.AccessTokenIssuer.
+//
+// Tokens are bound to the DPoP proof key stored in ctx (see [auth.DPoPKeyThumbprintFromContext]).
+func (i *AccessTokenIssuer) IssueAccessToken(ctx context.Context, service string, subject auth.Subject, grantedScopes []auth.Scope) (auth.AccessToken, error) {
+	b := make([]byte, referenceLength)
+
+	if _, err := io.ReadFull(i.rand, b); err != nil {
+		return auth.AccessToken{}, err
+	}
+
+	reference := base64.RawURLEncoding.EncodeToString(b)
+
+	now := i.clock.Now()
+
+	// Scheduled tokens become valid (and their lifetime starts) in the future
+	notBefore := now
+	if t := auth.NotBeforeFromContext(ctx); t.After(now) {
+		notBefore = t
+	}
+
+	access := Access{
+		Service:   service,
+		Scopes:    append([]auth.Scope(nil), grantedScopes...),
+		IssuedAt:  now,
+		NotBefore: notBefore,
+		ExpiresAt: notBefore.Add(i.expiration),
+
+		DPoPKeyThumbprint: auth.DPoPKeyThumbprintFromContext(ctx),
+	}
+
+	if subject != nil {
+		access.Subject = subject.ID()
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.prune(now)
+
+	if len(i.entries) >= i.maxEntries || i.subjectEntries[access.Subject] >= i.maxEntriesPerSubject {
+		return auth.AccessToken{}, ErrTooManyReferences
+	}
+
+	i.entries[reference] = access
+	i.subjectEntries[access.Subject]++
+	heap.Push(&i.expiry, expiryQueueItem{reference: reference, expiresAt: access.ExpiresAt})
+
+	return auth.AccessToken{
+		Payload:   reference,
+		ExpiresIn: access.ExpiresAt.Sub(now),
+		IssuedAt:  now,
+	}, nil
+}
+
+// Resolve returns the access a reference token refers to.
+//
+// It returns false if the token is unknown, expired or not valid yet.
+func (i *AccessTokenIssuer) Resolve(_ context.Context, token string) (Access, bool) {
+	now := i.clock.Now()
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	access, ok := i.entries[token]
+	if !ok || !now.Before(access.ExpiresAt) || now.Before(access.NotBefore) {
+		return Access{}, false
+	}
+
+	return access, true
+}
+
+// prune forgets expired references. The caller must hold the lock.
+//
+// References are queued by expiry, so only expired references are visited.
+func (i *AccessTokenIssuer) prune(now time.Time) {
+	for len(i.expiry) > 0 && !now.Before(i.expiry[0].expiresAt) {
+		item := heap.Pop(&i.expiry).(expiryQueueItem)
+
+		subject := i.entries[item.reference].Subject
+
+		if i.subjectEntries[subject]--; i.subjectEntries[subject] <= 0 {
+			delete(i.subjectEntries, subject)
+		}
+
+		delete(i.entries, item.reference)
+	}
+}
+
+// expiryQueue orders references by expiry (the earliest first) using container/heap.
+//
+// Scheduled tokens expire later than their issuance order suggests, so a plain FIFO queue is not enough.
+type expiryQueue []expiryQueueItem
+
+type expiryQueueItem struct {
+	reference string
+	expiresAt time.Time
+}
+
+func (q expiryQueue) Len() int           { return len(q) }
+func (q expiryQueue) Less(i, j int) bool { return q[i].expiresAt.Before(q[j].expiresAt) }
+func (q expiryQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *expiryQueue) Push(x any) {
+	*q = append(*q, x.(expiryQueueItem))
+}
+
+func (q *expiryQueue) Pop() any {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	*q = old[:n-1]
+
+	return item
+}
+
+// introspectionResponse is a token introspection response (RFC 7662).
+//
+// In addition to the standard members, the granted access is returned in the "access" (Docker token) format.
+type introspectionResponse struct {
+	Active    bool         `json:"active"`
+	Scope     string       `json:"scope,omitempty"`
+	TokenType string       `json:"token_type,omitempty"`
+	Subject   string       `json:"sub,omitempty"`
+	Audience  string       `json:"aud,omitempty"`
+	IssuedAt  int64        `json:"iat,omitempty"`
+	NotBefore int64        `json:"nbf,omitempty"`
+	ExpiresAt int64        `json:"exp,omitempty"`
+	Access    []auth.Scope `json:"access,omitempty"`
+
+	// Confirmation binds the token to a DPoP proof key (RFC 9449).
+	Confirmation *confirmation `json:"cnf,omitempty"`
+}
+
+type confirmation struct {
+	JWKThumbprint string `json:"jkt"`
+}
+
+// IntrospectionHandler returns a token introspection (RFC 7662) endpoint resolving reference tokens issued by issuer.
+//
+// The handler does not authenticate callers: RFC 7662 requires protecting the endpoint,
+// so wrap it in a middleware authenticating registries (eg. auth.AdminMiddleware).
+func IntrospectionHandler(issuer *AccessTokenIssuer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+
+			return
+		}
+
+		token := r.PostForm.Get("token")
+		if token == "" {
+			http.Error(w, "token is required", http.StatusBadRequest)
+
+			return
+		}
+
+		var response introspectionResponse
+
+		if access, ok := issuer.Resolve(r.Context(), token); ok {
+			response = introspectionResponse{
+				Active:    true,
+				Scope:     auth.Scopes(access.Scopes).String(),
+				TokenType: "Bearer",
+				Subject:   string(access.Subject),
+				Audience:  access.Service,
+				IssuedAt:  access.IssuedAt.Unix(),
+				NotBefore: access.NotBefore.Unix(),
+				ExpiresAt: access.ExpiresAt.Unix(),
+				Access:    access.Scopes,
+			}
+
+			if access.DPoPKeyThumbprint != "" {
+				response.TokenType = "DPoP"
+				response.Confirmation = &confirmation{JWKThumbprint: access.DPoPKeyThumbprint}
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+
+		_ = json.NewEncoder(w).Encode(response)
+	})
+}
+
+// AccessTokenIssuerOption configures an AccessTokenIssuer.
+type AccessTokenIssuerOption interface {
+	applyAccessTokenIssuer(i *AccessTokenIssuer)
+}
+
+// WithDependencies configures an AccessTokenIssuer to use the clock and random source from deps.
+func WithDependencies(deps auth.Dependencies) AccessTokenIssuerOption {
+	return withDependencies{deps}
+}
+
+type withDependencies struct {
+	deps auth.Dependencies
+}
+
+func (w withDependencies) applyAccessTokenIssuer(i *AccessTokenIssuer) {
+	i.clock = w.deps.GetClock()
+	i.rand = w.deps.GetRand()
+}
+
+// WithMaxEntries limits the number of references kept at the same time (defaults to DefaultMaxEntries).
+//
+// Once the limit is reached, issuing fails with ErrTooManyReferences until references expire.
+func WithMaxEntries(n int) AccessTokenIssuerOption {
+	return withMaxEntries{n}
+}
+
+type withMaxEntries struct {
+	n int
+}
+
+func (w withMaxEntries) applyAccessTokenIssuer(i *AccessTokenIssuer) {
+	i.maxEntries = w.n
+}
+
+// WithMaxEntriesPerSubject limits the number of references kept for a single subject at the same time
+// (defaults to DefaultMaxEntriesPerSubject).
+//
+// Anonymous subjects share a single limit.
+// Once the limit is reached, issuing for the subject fails with ErrTooManyReferences until its references expire.
+func WithMaxEntriesPerSubject(n int) AccessTokenIssuerOption {
+	return withMaxEntriesPerSubject{n}
+}
+
+type withMaxEntriesPerSubject struct {
+	n int
+}
+
+func (w withMaxEntriesPerSubject) applyAccessTokenIssuer(i *AccessTokenIssuer) {
+	i.maxEntriesPerSubject = w.n
+}
@@ -0,0 +1,191 @@
+package reference
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+type subjectStub struct {
+	id auth.SubjectID
+}
+
+func (s subjectStub) ID() auth.SubjectID {
+	return s.id
+}
+
+func (subjectStub) Attribute(_ string) (string, bool) {
+	return "", false
+}
+
+func (subjectStub) Attributes() map[string]string {
+	return nil
+}
+
+func introspect(t *testing.T, handler http.Handler, token string) string {
+	t.Helper()
+
+	body := url.Values{"token": {token}}.Encode()
+
+	r := httptest.NewRequest(http.MethodPost, "/introspect", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, r)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	return w.Body.String()
+}
+
+func TestAccessTokenIssuer(t *testing.T) {
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	clock := clockwork.NewFakeClockAt(now)
+
+	issuer := NewAccessTokenIssuer(5*time.Minute, WithDependencies(auth.Dependencies{Clock: clock}))
+	handler := IntrospectionHandler(issuer)
+
+	scopes := []auth.Scope{
+		{
+			Resource: auth.Resource{Type: "repository", Name: "product/image"},
+			Actions:  []string{"pull", "push"},
+		},
+	}
+
+	token, err := issuer.IssueAccessToken(context.Background(), "registry.example.com", subjectStub{id: "user"}, scopes)
+	require.NoError(t, err)
+
+	assert.Len(t, token.Payload, 43)
+	assert.Equal(t, 5*time.Minute, token.ExpiresIn)
+	assert.Equal(t, now, token.IssuedAt)
+
+	t.Run("Active", func(t *testing.T) {
+		expected := `{
+			"active": true,
+			"scope": "repository:product/image:pull,push",
+			"token_type": "Bearer",
+			"sub": "user",
+			"aud": "registry.example.com",
+			"iat": 1257894000,
+			"nbf": 1257894000,
+			"exp": 1257894300,
+			"access": [{"type": "repository", "class": "", "name": "product/image", "actions": ["pull", "push"]}]
+		}`
+
+		assert.JSONEq(t, expected, introspect(t, handler, token.Payload))
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		assert.JSONEq(t, `{"active": false}`, introspect(t, handler, "unknown"))
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		clock.Advance(5 * time.Minute)
+
+		assert.JSONEq(t, `{"active": false}`, introspect(t, handler, token.Payload))
+	})
+}
+
+func TestAccessTokenIssuer_MaxEntries(t *testing.T) {
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	clock := clockwork.NewFakeClockAt(now)
+
+	issuer := NewAccessTokenIssuer(
+		5*time.Minute,
+		WithDependencies(auth.Dependencies{Clock: clock}),
+		WithMaxEntries(2),
+	)
+
+	ctx := context.Background()
+
+	// Scheduled: expires after the other references
+	scheduled, err := issuer.IssueAccessToken(auth.ContextWithNotBefore(ctx, now.Add(10*time.Minute)), "service.example.com", nil, nil)
+	require.NoError(t, err)
+
+	_, err = issuer.IssueAccessToken(ctx, "service.example.com", nil, nil)
+	require.NoError(t, err)
+
+	_, err = issuer.IssueAccessToken(ctx, "service.example.com", nil, nil)
+	require.ErrorIs(t, err, ErrTooManyReferences)
+
+	clock.Advance(5 * time.Minute)
+
+	_, err = issuer.IssueAccessToken(ctx, "service.example.com", nil, nil)
+	require.NoError(t, err, "expired references should be pruned")
+
+	assert.Len(t, issuer.entries, 2)
+
+	clock.Advance(5 * time.Minute)
+
+	_, ok := issuer.Resolve(ctx, scheduled.Payload)
+	assert.True(t, ok, "references expiring later should not be pruned")
+}
+
+func TestAccessTokenIssuer_MaxEntriesPerSubject(t *testing.T) {
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	clock := clockwork.NewFakeClockAt(now)
+
+	issuer := NewAccessTokenIssuer(
+		5*time.Minute,
+		WithDependencies(auth.Dependencies{Clock: clock}),
+		WithMaxEntriesPerSubject(2),
+	)
+
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		_, err := issuer.IssueAccessToken(ctx, "service.example.com", nil, nil)
+		require.NoError(t, err)
+	}
+
+	_, err := issuer.IssueAccessToken(ctx, "service.example.com", nil, nil)
+	require.ErrorIs(t, err, ErrTooManyReferences)
+
+	// Anonymous clients do not block other subjects
+	_, err = issuer.IssueAccessToken(ctx, "service.example.com", subjectStub{id: "user"}, nil)
+	require.NoError(t, err)
+
+	clock.Advance(5 * time.Minute)
+
+	_, err = issuer.IssueAccessToken(ctx, "service.example.com", nil, nil)
+	require.NoError(t, err, "expired references should not count")
+
+	assert.Equal(t, map[auth.SubjectID]int{"": 1}, issuer.subjectEntries)
+}
+
+func TestAccessTokenIssuer_DPoP(t *testing.T) {
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	clock := clockwork.NewFakeClockAt(now)
+
+	issuer := NewAccessTokenIssuer(5*time.Minute, WithDependencies(auth.Dependencies{Clock: clock}))
+	handler := IntrospectionHandler(issuer)
+
+	ctx := auth.ContextWithDPoPKeyThumbprint(context.Background(), "thumbprint")
+
+	token, err := issuer.IssueAccessToken(ctx, "registry.example.com", subjectStub{id: "user"}, nil)
+	require.NoError(t, err)
+
+	expected := `{
+		"active": true,
+		"token_type": "DPoP",
+		"sub": "user",
+		"aud": "registry.example.com",
+		"iat": 1257894000,
+		"nbf": 1257894000,
+		"exp": 1257894300,
+		"cnf": {"jkt": "thumbprint"}
+	}`
+
+	assert.JSONEq(t, expected, introspect(t, handler, token.Payload))
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultTokenCacheRefreshBefore is the default time before expiry at which cached tokens are replaced.
+const DefaultTokenCacheRefreshBefore = 30 * time.Second
+
+// AnonymousAccessTokenCache caches access tokens granting anonymous pull access to frequently accessed (hot) public repositories,
+// so that they are not signed again for every request.
+//
+// Only tokens issued to anonymous subjects for a single hot repository with exactly the pull action are cached,
+// everything else (including tokens bound to a DPoP key and scheduled tokens) is passed to the underlying issuer.
+// A cached token is served until it gets within RefreshBefore of its expiry, at which point a new one is issued.
+//
+// Every anonymous client receives the same token (including its ID) until it is replaced.
+type AnonymousAccessTokenCache struct {
+	issuer AccessTokenIssuer
+
+	services     []string
+	repositories []string
+
+	refreshBefore time.Duration
+	clock         Clock
+
+	mu     sync.Mutex
+	tokens map[tokenCacheKey]AccessToken
+}
+
+type tokenCacheKey struct {
+	service    string
+	repository string
+}
+
+// NewAnonymousAccessTokenCache returns a new AnonymousAccessTokenCache caching tokens for repositories of the listed services.
+//
+// refreshBefore defaults to DefaultTokenCacheRefreshBefore.
+func NewAnonymousAccessTokenCache(issuer AccessTokenIssuer, services []string, repositories []string, refreshBefore time.Duration, deps Dependencies) *AnonymousAccessTokenCache {
+	if refreshBefore <= 0 {
+		refreshBefore = DefaultTokenCacheRefreshBefore
+	}
+
+	return &AnonymousAccessTokenCache{
+		issuer:        issuer,
+		services:      services,
+		repositories:  repositories,
+		refreshBefore: refreshBefore,
+		clock:         deps.GetClock(),
+		tokens:        make(map[tokenCacheKey]AccessToken),
+	}
+}
+
+// IssueAccessToken implements AccessTokenIssuer.
+func (c *AnonymousAccessTokenCache) IssueAccessToken(ctx context.Context, service string, subject Subject, grantedScopes []Scope) (AccessToken, error) {
+	key, ok := c.key(ctx, service, subject, grantedScopes)
+	if !ok {
+		return c.issuer.IssueAccessToken(ctx, service, subject, grantedScopes)
+	}
+
+	if token, ok := c.get(key); ok {
+		return token, nil
+	}
+
+	return c.issue(ctx, key, grantedScopes)
+}
+
+// Warmup pre-issues (or replaces expiring) tokens for every hot repository.
+//
+// It keeps going if issuing a token fails and returns every error at the end.
+func (c *AnonymousAccessTokenCache) Warmup(ctx context.Context) error {
+	var errs []error
+
+	for _, service := range c.services {
+		for _, repository := range c.repositories {
+			key := tokenCacheKey{service: service, repository: repository}
+
+			if _, ok := c.get(key); ok {
+				continue
+			}
+
+			_, err := c.issue(ctx, key, []Scope{pullScope(repository)})
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *AnonymousAccessTokenCache) key(ctx context.Context, service string, subject Subject, grantedScopes []Scope) (tokenCacheKey, bool) {
+	if subject != nil || len(grantedScopes) != 1 || !slices.Contains(c.services, service) {
+		return tokenCacheKey{}, false
+	}
+
+	// Tokens bound to a DPoP key or becoming valid in the future must not be shared with other clients
+	// (and clients asking for them must not receive a shared token either)
+	if DPoPKeyThumbprintFromContext(ctx) != "" || !NotBeforeFromContext(ctx).IsZero() {
+		return tokenCacheKey{}, false
+	}
+
+	scope := grantedScopes[0]
+
+	if scope.Type != "repository" || scope.Class != "" || !slices.Equal(scope.Actions, []string{"pull"}) {
+		return tokenCacheKey{}, false
+	}
+
+	if !slices.Contains(c.repositories, scope.Name) {
+		return tokenCacheKey{}, false
+	}
+
+	return tokenCacheKey{service: service, repository: scope.Name}, true
+}
+
+func (c *AnonymousAccessTokenCache) get(key tokenCacheKey) (AccessToken, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	token, ok := c.tokens[key]
+	if !ok {
+		return AccessToken{}, false
+	}
+
+	// Leave clients enough time to use the token
+	if !c.clock.Now().Before(token.IssuedAt.Add(token.ExpiresIn - c.refreshBefore)) {
+		delete(c.tokens, key)
+
+		return AccessToken{}, false
+	}
+
+	return token, true
+}
+
+func (c *AnonymousAccessTokenCache) issue(ctx context.Context, key tokenCacheKey, grantedScopes []Scope) (AccessToken, error) {
+	token, err := c.issuer.IssueAccessToken(ctx, key.service, nil, grantedScopes)
+	if err != nil {
+		return AccessToken{}, err
+	}
+
+	// Tokens too short-lived to be served from the cache
+	if token.ExpiresIn <= c.refreshBefore {
+		return token, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.tokens[key] = token
+
+	return token, nil
+}
+
+func pullScope(repository string) Scope {
+	return Scope{
+		Resource: Resource{Type: "repository", Name: repository},
+		Actions:  []string{"pull"},
+	}
+}
@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingAccessTokenIssuer issues a new token (signature) on every call.
+type countingAccessTokenIssuer struct {
+	clock     clockwork.Clock
+	expiresIn time.Duration
+	err       error
+
+	calls *int
+}
+
+func (i countingAccessTokenIssuer) IssueAccessToken(_ context.Context, service string, _ Subject, grantedScopes []Scope) (AccessToken, error) {
+	*i.calls++
+
+	if i.err != nil {
+		return AccessToken{}, i.err
+	}
+
+	return AccessToken{
+		Payload:   fmt.Sprintf("%s:%s:%d", service, Scopes(grantedScopes), *i.calls),
+		ExpiresIn: i.expiresIn,
+		IssuedAt:  i.clock.Now(),
+	}, nil
+}
+
+func TestAnonymousAccessTokenCache(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+
+	var calls int
+
+	issuer := countingAccessTokenIssuer{
+		clock:     clock,
+		expiresIn: 5 * time.Minute,
+		calls:     &calls,
+	}
+
+	cache := NewAnonymousAccessTokenCache(
+		issuer,
+		[]string{"registry.example.com"},
+		[]string{"library/alpine"},
+		time.Minute,
+		Dependencies{Clock: clock},
+	)
+
+	hotPull := []Scope{pullScope("library/alpine")}
+
+	issue := func(t *testing.T, service string, subject Subject, grantedScopes []Scope) AccessToken {
+		t.Helper()
+
+		token, err := cache.IssueAccessToken(context.Background(), service, subject, grantedScopes)
+		require.NoError(t, err)
+
+		return token
+	}
+
+	require.NoError(t, cache.Warmup(context.Background()))
+	require.Equal(t, 1, calls, "warmup should pre-issue a token for every hot repository")
+
+	t.Run("Cached", func(t *testing.T) {
+		calls = 0
+
+		first := issue(t, "registry.example.com", nil, hotPull)
+		second := issue(t, "registry.example.com", nil, hotPull)
+
+		assert.Equal(t, 0, calls, "hot repository pull should be served from the cache without signing")
+		assert.Equal(t, first, second)
+	})
+
+	t.Run("NotCached", func(t *testing.T) {
+		testCases := []struct {
+			name          string
+			ctx           context.Context
+			service       string
+			subject       Subject
+			grantedScopes []Scope
+		}{
+			{
+				name:          "DPoP",
+				ctx:           ContextWithDPoPKeyThumbprint(context.Background(), "thumbprint"),
+				service:       "registry.example.com",
+				grantedScopes: hotPull,
+			},
+			{
+				name:          "Scheduled",
+				ctx:           ContextWithNotBefore(context.Background(), clock.Now().Add(time.Hour)),
+				service:       "registry.example.com",
+				grantedScopes: hotPull,
+			},
+			{
+				name:          "Authenticated",
+				service:       "registry.example.com",
+				subject:       subjectStub{id: "user"},
+				grantedScopes: hotPull,
+			},
+			{
+				name:          "OtherRepository",
+				service:       "registry.example.com",
+				grantedScopes: []Scope{pullScope("library/busybox")},
+			},
+			{
+				name:          "OtherService",
+				service:       "other.example.com",
+				grantedScopes: hotPull,
+			},
+			{
+				name:    "Push",
+				service: "registry.example.com",
+				grantedScopes: []Scope{
+					{
+						Resource: Resource{Type: "repository", Name: "library/alpine"},
+						Actions:  []string{"pull", "push"},
+					},
+				},
+			},
+			{
+				name:          "MultipleScopes",
+				service:       "registry.example.com",
+				grantedScopes: []Scope{pullScope("library/alpine"), pullScope("library/busybox")},
+			},
+		}
+
+		for _, testCase := range testCases {
+			testCase := testCase
+
+			t.Run(testCase.name, func(t *testing.T) {
+				calls = 0
+
+				ctx := testCase.ctx
+				if ctx == nil {
+					ctx = context.Background()
+				}
+
+				for i := 0; i < 2; i++ {
+					_, err := cache.IssueAccessToken(ctx, testCase.service, testCase.subject, testCase.grantedScopes)
+					require.NoError(t, err)
+				}
+
+				assert.Equal(t, 2, calls)
+			})
+		}
+	})
+
+	t.Run("NearExpiry", func(t *testing.T) {
+		calls = 0
+
+		cached := issue(t, "registry.example.com", nil, hotPull)
+
+		clock.Advance(4 * time.Minute)
+
+		refreshed := issue(t, "registry.example.com", nil, hotPull)
+
+		assert.Equal(t, 1, calls, "token close to expiry should be replaced")
+		assert.NotEqual(t, cached, refreshed)
+
+		assert.Equal(t, refreshed, issue(t, "registry.example.com", nil, hotPull))
+		assert.Equal(t, 1, calls)
+	})
+}
+
+func TestAnonymousAccessTokenCache_Warmup_Error(t *testing.T) {
+	var calls int
+
+	issuer := countingAccessTokenIssuer{
+		clock: clockwork.NewFakeClock(),
+		err:   errors.New("HSM unavailable"),
+		calls: &calls,
+	}
+
+	cache := NewAnonymousAccessTokenCache(
+		issuer,
+		[]string{"registry.example.com"},
+		[]string{"library/alpine", "library/busybox"},
+		0,
+		Dependencies{},
+	)
+
+	err := cache.Warmup(context.Background())
+	require.Error(t, err)
+
+	assert.Equal(t, 2, calls, "warmup should try every hot repository")
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of spans recorded by the token service.
+const tracerName = "github.com/sagikazarmark/registry-auth/auth"
+
+// Span attributes.
+//
+// Spans never carry credentials: only the shape of a request (eg. the number of requested scopes) is recorded.
+const (
+	TraceAttributeGrantType            = attribute.Key("registry_auth.grant_type")
+	TraceAttributeAuthenticationMethod = attribute.Key("registry_auth.authentication_method")
+	TraceAttributeService              = attribute.Key("registry_auth.service")
+	TraceAttributeRequestedScopes      = attribute.Key("registry_auth.requested_scopes")
+	TraceAttributeGrantedActions       = attribute.Key("registry_auth.granted_actions")
+	TraceAttributeTokenType            = attribute.Key("registry_auth.token_type")
+)
+
+// TraceContextMiddleware continues the trace of the caller (if any) propagated in the request headers (eg. traceparent).
+func TraceContextMiddleware(propagator propagation.TextMapPropagator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func startSpan(ctx context.Context, tracerProvider trace.TracerProvider, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracerProvider.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends a span, marking it as failed if err is not nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// countActions returns the number of actions in scopes.
+func countActions(scopes []Scope) int {
+	var n int
+
+	for _, scope := range scopes {
+		n += len(scope.Actions)
+	}
+
+	return n
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTokenServiceImpl_Tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+
+	service := newTokenServiceStub()
+	service.Dependencies.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	scopes, err := ParseScopes([]string{"repository:foo:pull,push", "repository:bar:pull"})
+	require.NoError(t, err)
+
+	_, err = service.OAuth2Handler(context.Background(), OAuth2Request{
+		GrantType:  GrantTypePassword,
+		Service:    "service.example.com",
+		ClientID:   "client",
+		AccessType: AccessTypeOffline,
+		Scopes:     scopes,
+		Username:   "user",
+		Password:   "s3cr3t",
+	})
+	require.NoError(t, err)
+
+	spans := recorder.Ended()
+
+	names := make([]string, 0, len(spans))
+	attrs := make(map[string]map[attribute.Key]attribute.Value)
+
+	for _, span := range spans {
+		names = append(names, span.Name())
+
+		attrs[span.Name()] = make(map[attribute.Key]attribute.Value)
+
+		for _, attr := range span.Attributes() {
+			attrs[span.Name()][attr.Key] = attr.Value
+
+			assert.NotContains(t, attr.Value.Emit(), "s3cr3t", "span %s leaks credentials", span.Name())
+		}
+	}
+
+	assert.ElementsMatch(t, []string{"OAuth2Handler", "Authenticate", "Authorize", "IssueAccessToken", "IssueRefreshToken"}, names)
+
+	assert.Equal(t, GrantTypePassword, attrs["OAuth2Handler"][TraceAttributeGrantType].AsString())
+	assert.Equal(t, int64(2), attrs["OAuth2Handler"][TraceAttributeRequestedScopes].AsInt64())
+	assert.Equal(t, int64(3), attrs["Authorize"][TraceAttributeGrantedActions].AsInt64())
+
+	// Every span belongs to the same trace
+	for _, span := range spans {
+		assert.Equal(t, spans[0].SpanContext().TraceID(), span.SpanContext().TraceID())
+	}
+}
+
+func TestTraceContextMiddleware(t *testing.T) {
+	var spanContext trace.SpanContext
+
+	handler := TraceContextMiddleware(propagation.TraceContext{})(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		spanContext = trace.SpanContextFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/token", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.True(t, spanContext.IsRemote())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spanContext.TraceID().String())
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/sagikazarmark/registry-auth/config"
+)
+
+// importUsers implements the import-users command.
+// It converts a CSV or JSON file of users into a configuration snippet for the "user" authenticator.
+func importUsers(args []string) error {
+	var (
+		input  string
+		format string
+		cost   int
+	)
+
+	flags := flag.NewFlagSet("import-users", flag.ExitOnError)
+	flags.StringVar(&input, "input", "-", "Input file (- for standard input)")
+	flags.StringVar(&format, "format", "", "Input format: csv or json (detected from the file extension by default)")
+	flags.IntVar(&cost, "cost", bcrypt.DefaultCost, "bcrypt cost of password hashes")
+	policy := passwordPolicyFlags(flags)
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(input), ".")
+	}
+
+	var r io.Reader = os.Stdin
+
+	if input != "-" {
+		file, err := os.Open(input)
+		if err != nil {
+			return fmt.Errorf("opening input file: %w", err)
+		}
+		defer file.Close()
+
+		r = file
+	}
+
+	return config.ImportUsers(os.Stdout, r, format, cost, *policy)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// Log formats.
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// newLogHandler returns a handler writing log records of at least level (eg. debug, info, warn or error) to w in format.
+//
+// Attributes (eg. those of the token service logger) are preserved as structured fields in both formats.
+func newLogHandler(w io.Writer, format string, level string) (slog.Handler, error) {
+	var logLevel slog.Level
+
+	if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("log level: %w", err)
+	}
+
+	handlerOptions := &slog.HandlerOptions{
+		Level: logLevel,
+	}
+
+	switch format {
+	case logFormatText:
+		return slog.NewTextHandler(w, handlerOptions), nil
+
+	case logFormatJSON:
+		return slog.NewJSONHandler(w, handlerOptions), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported log format %q (must be %q or %q)", format, logFormatText, logFormatJSON)
+	}
+}
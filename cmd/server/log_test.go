@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLogHandler(t *testing.T) {
+	t.Run("JSON", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		handler, err := newLogHandler(&buf, "json", "warn")
+		require.NoError(t, err)
+
+		logger := slog.New(handler)
+
+		logger.Info("ignored")
+		logger.Warn("token request", slog.String("subject", "user"))
+
+		var record map[string]any
+
+		err = json.Unmarshal(buf.Bytes(), &record)
+		require.NoError(t, err, "only records of at least the configured level should be logged")
+
+		assert.Equal(t, "WARN", record["level"])
+		assert.Equal(t, "token request", record["msg"])
+		assert.Equal(t, "user", record["subject"])
+	})
+
+	t.Run("Text", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		handler, err := newLogHandler(&buf, "text", "debug")
+		require.NoError(t, err)
+
+		slog.New(handler).Debug("token request", slog.String("subject", "user"))
+
+		assert.Contains(t, buf.String(), "level=DEBUG")
+		assert.Contains(t, buf.String(), "subject=user")
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := newLogHandler(&bytes.Buffer{}, "xml", "info")
+		require.Error(t, err)
+
+		_, err = newLogHandler(&bytes.Buffer{}, "text", "verbose")
+		require.Error(t, err)
+	})
+}
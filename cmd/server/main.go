@@ -1,15 +1,24 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/golang-jwt/jwt/v4"
-	"github.com/gorilla/mux"
-	"gopkg.in/yaml.v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 
 	"github.com/sagikazarmark/registry-auth/auth"
 	"github.com/sagikazarmark/registry-auth/auth/authn"
@@ -21,30 +30,80 @@ func init() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import-users" {
+		if err := importUsers(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "importing users: %v\n", err)
+
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "hash-password" {
+		if err := hashPassword(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "hashing password: %v\n", err)
+
+			os.Exit(1)
+		}
+
+		return
+	}
+
 	var (
-		configFile string
-		addr       string
-		debug      bool
-		err        error
+		configFile   string
+		addr         string
+		metricsAddr  string
+		otlpEndpoint string
+		debug        bool
+		logFormat    string
+		logLevel     string
+		err          error
+
+		shutdownTimeout time.Duration
+
+		tlsCert     string
+		tlsKey      string
+		tlsClientCA string
+
+		tlsClientCRL               string
+		tlsClientCRLReloadInterval time.Duration
+		tlsClientOCSP              bool
+		tlsClientOCSPSoftFail      bool
 
 		realm string
 	)
 
 	flag.StringVar(&configFile, "config", "config.yaml", "Configuration file")
 	flag.StringVar(&addr, "addr", "localhost:8080", "Address to listen on")
-	flag.BoolVar(&debug, "debug", false, "Debug mode")
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "Address to expose Prometheus metrics on (disabled if empty)")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "", "OTLP/HTTP endpoint URL to export traces to (eg. http://localhost:4318; disabled if empty)")
+	flag.BoolVar(&debug, "debug", false, "Debug mode (same as -log-level debug)")
+	flag.StringVar(&logFormat, "log-format", logFormatText, "Log format (text or json)")
+	flag.StringVar(&logLevel, "log-level", "info", "Minimum level of logged messages (debug, info, warn or error)")
 	flag.StringVar(&realm, "realm", "", "Authentication realm")
+	flag.StringVar(&tlsCert, "tls-cert", "", "TLS certificate file (serves HTTPS with TLS 1.2 or later)")
+	flag.StringVar(&tlsKey, "tls-key", "", "TLS private key file")
+	flag.StringVar(&tlsClientCA, "tls-client-ca", "", "CA certificates verifying client certificates (requires a client certificate from every client)")
+	flag.StringVar(&tlsClientCRL, "tls-client-crl", "", "Certificate revocation lists (PEM or DER) rejecting revoked client certificates")
+	flag.DurationVar(&tlsClientCRLReloadInterval, "tls-client-crl-reload-interval", auth.DefaultCRLReloadInterval, "Interval the certificate revocation lists are reloaded at")
+	flag.BoolVar(&tlsClientOCSP, "tls-client-ocsp", false, "Reject client certificates revoked according to their OCSP responder")
+	flag.BoolVar(&tlsClientOCSPSoftFail, "tls-client-ocsp-soft-fail", false, "Accept client certificates if their OCSP status cannot be determined")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 15*time.Second, "Time to wait for in-flight requests to finish on shutdown")
 	flag.Parse()
 
-	handlerOptions := &slog.HandlerOptions{
-		Level: slog.LevelInfo,
+	if debug {
+		logLevel = "debug"
 	}
 
-	if debug {
-		handlerOptions.Level = slog.LevelDebug
+	logHandler, err := newLogHandler(os.Stdout, logFormat, logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		os.Exit(2)
 	}
 
-	logger := slog.New(slog.NewTextHandler(os.Stdout, handlerOptions))
+	logger := slog.New(logHandler)
 
 	if realm == "" {
 		logger.Error("must provide realm")
@@ -52,25 +111,29 @@ func main() {
 		os.Exit(1)
 	}
 
-	var config config.Config
+	if (tlsCert == "") != (tlsKey == "") {
+		logger.Error("must provide both tls-cert and tls-key")
 
-	{
-		file, err := os.Open(configFile)
-		if err != nil {
-			logger.Error(fmt.Sprintf("loading config file: %v", err))
+		os.Exit(1)
+	}
 
-			os.Exit(1)
-		}
-		defer file.Close()
+	if tlsClientCA != "" && tlsCert == "" {
+		logger.Error("tls-client-ca requires tls-cert and tls-key")
 
-		decoder := yaml.NewDecoder(file)
+		os.Exit(1)
+	}
 
-		err = decoder.Decode(&config)
-		if err != nil {
-			logger.Error(fmt.Sprintf("decoding config file: %v", err))
+	if (tlsClientCRL != "" || tlsClientOCSP) && tlsClientCA == "" {
+		logger.Error("tls-client-crl and tls-client-ocsp require tls-client-ca")
 
-			os.Exit(1)
-		}
+		os.Exit(1)
+	}
+
+	config, err := loadConfig(configFile)
+	if err != nil {
+		logger.Error(fmt.Sprintf("loading config file: %v", err))
+
+		os.Exit(1)
 	}
 
 	if err := config.Validate(); err != nil {
@@ -79,6 +142,26 @@ func main() {
 		os.Exit(1)
 	}
 
+	for _, warning := range config.Warnings() {
+		logger.Warn(fmt.Sprintf("configuration: %s", warning))
+	}
+
+	auditSigningKey, err := config.Audit.SigningKey()
+	if err != nil {
+		logger.Error(fmt.Sprintf("audit: %v", err))
+
+		os.Exit(1)
+	}
+
+	var auditLogger auth.AuditLogger = auth.SlogAuditLogger{Logger: logger}
+
+	if auditSigningKey != nil {
+		auditLogger = auth.SigningAuditLogger{
+			AuditLogger: auditLogger,
+			Key:         auditSigningKey,
+		}
+	}
+
 	passwordAuthenticator, err := config.PasswordAuthenticator.New()
 	if err != nil {
 		logger.Error(fmt.Sprintf("creating authenticator: %v", err))
@@ -86,6 +169,15 @@ func main() {
 		os.Exit(1)
 	}
 
+	if config.BreakGlass.Enabled {
+		passwordAuthenticator = authn.NewBreakGlassAuthenticator(
+			passwordAuthenticator,
+			config.BreakGlass.User(),
+			auditLogger,
+			config.BreakGlass.AuthenticatorOptions()...,
+		)
+	}
+
 	accessTokenIssuer, err := config.AccessTokenIssuer.New()
 	if err != nil {
 		logger.Error(fmt.Sprintf("creating access token issuer: %v", err))
@@ -114,12 +206,29 @@ func main() {
 		os.Exit(1)
 	}
 
-	// TODO: configuration
-	refreshTokenAuthenticator := authn.NewRefreshTokenAuthenticator(refreshTokenVerifier, subjectRepository)
+	refreshTokenAuthenticator := authn.NewRefreshTokenAuthenticator(
+		refreshTokenVerifier,
+		subjectRepository,
+		config.RefreshToken.AuthenticatorOptions()...,
+	)
+
+	var issuer auth.AccessTokenIssuer = accessTokenIssuer
+
+	if config.AnonymousTokenCache.Enabled {
+		cache := config.AnonymousTokenCache.New(accessTokenIssuer, auth.Dependencies{Logger: logger})
+
+		// Failing to pre-issue tokens is not fatal: they are issued on demand
+		if err := cache.Warmup(context.Background()); err != nil {
+			logger.Warn(fmt.Sprintf("warming up anonymous token cache: %v", err))
+		}
+
+		issuer = cache
+	}
 
 	tokenIssuer := auth.TokenIssuer{
-		AccessTokenIssuer:  accessTokenIssuer,
+		AccessTokenIssuer:  issuer,
 		RefreshTokenIssuer: refreshTokenIssuer,
+		StrippedAttributes: config.Server.StrippedAttributes,
 	}
 
 	authenticator := auth.Authenticator{
@@ -127,6 +236,29 @@ func main() {
 		RefreshTokenAuthenticator: refreshTokenAuthenticator,
 	}
 
+	// Remote callouts share a client (and its connection pool)
+	httpClient, err := config.HTTPClient.New()
+	if err != nil {
+		logger.Error(fmt.Sprintf("creating HTTP client: %v", err))
+
+		os.Exit(1)
+	}
+
+	if config.OIDC.Enabled {
+		oidcAuthenticator, err := config.OIDC.NewAuthenticator(httpClient)
+		if err != nil {
+			logger.Error(fmt.Sprintf("creating OIDC authenticator: %v", err))
+
+			os.Exit(1)
+		}
+
+		authenticator.BearerTokenAuthenticator = oidcAuthenticator
+	}
+
+	if config.SubjectEnrichment.Enabled {
+		authenticator.SubjectEnricher = config.SubjectEnrichment.NewEnricher(httpClient)
+	}
+
 	authorizer, err := config.Authorizer.New()
 	if err != nil {
 		logger.Error(fmt.Sprintf("creating authorizer issuer: %v", err))
@@ -134,33 +266,265 @@ func main() {
 		os.Exit(1)
 	}
 
+	dependencies := auth.Dependencies{
+		Logger: logger,
+	}
+
+	var tracerProvider *sdktrace.TracerProvider
+
+	if otlpEndpoint != "" {
+		tracerProvider, err = newTracerProvider(context.Background(), otlpEndpoint)
+		if err != nil {
+			logger.Error(fmt.Sprintf("configuring tracing: %v", err))
+
+			os.Exit(1)
+		}
+
+		otel.SetTracerProvider(tracerProvider)
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+		dependencies.TracerProvider = tracerProvider
+	}
+
+	var (
+		metricsRegistry *prometheus.Registry
+		metrics         *auth.PrometheusMetrics
+	)
+
+	if metricsAddr != "" {
+		metricsRegistry = prometheus.NewRegistry()
+		metricsRegistry.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+
+		metrics, err = auth.NewPrometheusMetrics(config.Metrics.GetNamespace(), config.Metrics.Subsystem, metricsRegistry)
+		if err != nil {
+			logger.Error(fmt.Sprintf("registering metrics: %v", err))
+
+			os.Exit(1)
+		}
+
+		dependencies.Metrics = metrics
+	}
+
 	var service auth.TokenService
 
 	service = auth.TokenServiceImpl{
-		Authenticator: authenticator,
-		Authorizer:    authorizer,
-		TokenIssuer:   tokenIssuer,
+		Authenticator:   authenticator,
+		Authorizer:      authorizer,
+		TokenIssuer:     tokenIssuer,
+		ScheduledTokens: config.Server.GetScheduledTokens(),
+		EmptyScope:      config.Server.EmptyScope,
+		AnonymousAccess: config.Server.AnonymousAccess,
+		ScopeWarnings:   config.Server.ScopeWarnings,
+
+		PasswordFallback: config.OIDC.Enabled && config.OIDC.PasswordFallback,
+
+		Dependencies: dependencies,
+	}
+
+	if config.Audit.Enabled {
+		service = auth.AuditTokenService{
+			Service:     service,
+			AuditLogger: auditLogger,
+			SampleRates: config.Audit.SampleRates,
+
+			TokenFingerprints: config.Audit.TokenFingerprints,
+		}
 	}
+
+	if metrics != nil {
+		service = auth.InstrumentedTokenService{
+			Service: service,
+			Metrics: metrics,
+		}
+	}
+
 	service = auth.LoggerTokenService{
-		Service: service,
-		Logger:  logger,
+		Service:         service,
+		Logger:          logger,
+		HashSubjectIDs:  config.Logging.HashSubjectIDs,
+		SubjectHashSalt: []byte(config.Logging.SubjectHashSalt),
+		LogUsernames:    config.Logging.Usernames,
 	}
 
 	server := auth.TokenServer{
-		Service: service,
-		Logger:  logger,
+		Service:         service,
+		Logger:          logger,
+		ResourceActions: config.Server.GetResourceActions(),
+
+		MaxActionsPerScope: config.Server.MaxActionsPerScope,
+		MaxScopes:          config.Server.MaxScopes,
+		MaxAudiences:       config.Server.MaxAudiences,
+		MaxBatchEntries:    config.Server.MaxBatchEntries,
+		RegistryHosts:      config.Server.RegistryHosts,
+
+		DefaultService:      config.Server.DefaultService,
+		MultipleServices:    config.Server.MultipleServices,
+		ResponseFields:      config.Server.ResponseFields,
+		CacheControl:        config.Server.CacheControl,
+		RetryAfter:          config.Server.RetryAfter,
+		RateLimitedResponse: config.Server.RateLimitedResponse,
+		Realm:               realm,
+		AnonymousDenial:     config.Server.AnonymousDenial,
+
+		HTMLErrors: config.Server.ErrorPages.Enabled,
+		HelpURL:    config.Server.ErrorPages.HelpURL,
+
+		PermissionScopes: config.Server.GetPermissionScopes(),
+
+		RejectEmptyPassword: config.Server.RejectEmptyPassword,
+
+		DPoPProofVerifier: config.Server.NewDPoPProofVerifier(),
+		RequireDPoP:       config.Server.DPoP.Required,
+		ExternalURL:       config.Server.GetExternalURL(),
+	}
+
+	components := map[string]any{
+		"passwordAuthenticator":    passwordAuthenticator,
+		"bearerTokenAuthenticator": authenticator.BearerTokenAuthenticator,
+		"accessTokenIssuer":        accessTokenIssuer,
+		"refreshTokenIssuer":       refreshTokenIssuer,
+		"authorizer":               authorizer,
 	}
 
-	router := mux.NewRouter()
-	router.Path("/token").Methods("GET").HandlerFunc(server.TokenHandler)
-	router.Path("/token").Methods("POST").HandlerFunc(server.OAuth2Handler)
+	// Signing keys are loaded above (or the server exits), so only backends need checking
+	server.ReadinessCheckers = make(map[string]auth.Checker)
 
-	logger.Info("launching server")
+	for name, component := range components {
+		if checker, ok := component.(auth.Checker); ok {
+			server.ReadinessCheckers[name] = checker
+		}
+	}
 
-	err = http.ListenAndServe(addr, router)
-	if err != nil {
-		logger.Error(fmt.Sprintf("error serving: %v", err))
+	router, adminRouter := newRouters(server, config, passwordAuthenticator, accessTokenIssuer, logger)
 
-		os.Exit(1)
+	mainServer := &http.Server{
+		Addr:           addr,
+		Handler:        router,
+		MaxHeaderBytes: config.Server.MaxHeaderBytes,
 	}
+
+	// The admin server is expected to be reachable on an internal network only, so TLS applies to the main server
+	if tlsCert != "" {
+		var revocationChecker *auth.ClientCertificateRevocationChecker
+
+		if tlsClientCRL != "" || tlsClientOCSP {
+			revocationChecker = &auth.ClientCertificateRevocationChecker{
+				CRLFile:           tlsClientCRL,
+				CRLReloadInterval: tlsClientCRLReloadInterval,
+				OCSP:              tlsClientOCSP,
+				OCSPSoftFail:      tlsClientOCSPSoftFail,
+				Logger:            logger,
+			}
+
+			if err := revocationChecker.LoadCRLFile(); err != nil {
+				logger.Error(fmt.Sprintf("loading client certificate revocation lists: %v", err))
+
+				os.Exit(1)
+			}
+
+			// Reload revocation lists in the background
+			components["clientCertificateRevocationChecker"] = revocationChecker
+		}
+
+		tlsConfig, err := newTLSConfig(tlsClientCA, revocationChecker)
+		if err != nil {
+			logger.Error(fmt.Sprintf("configuring TLS: %v", err))
+
+			os.Exit(1)
+		}
+
+		mainServer.TLSConfig = tlsConfig
+
+		if tlsClientCA != "" {
+			// Expose the verified client certificate to authenticators and authorizers
+			mainServer.Handler = auth.ClientCertificateMiddleware(router)
+		}
+	}
+
+	servers := []namedServer{{Name: "server", Server: mainServer, CertFile: tlsCert, KeyFile: tlsKey}}
+
+	if adminRouter != nil {
+		servers = append(servers, namedServer{
+			Name: "admin server",
+			Server: &http.Server{
+				Addr:           config.Server.Admin.Addr,
+				Handler:        adminRouter,
+				MaxHeaderBytes: config.Server.MaxHeaderBytes,
+			},
+		})
+	}
+
+	// Like the admin server, the metrics server is expected to be reachable on an internal network only
+	if metricsRegistry != nil {
+		metricsRouter := http.NewServeMux()
+		metricsRouter.Handle("/metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+
+		servers = append(servers, namedServer{
+			Name: "metrics server",
+			Server: &http.Server{
+				Addr:           metricsAddr,
+				Handler:        metricsRouter,
+				MaxHeaderBytes: config.Server.MaxHeaderBytes,
+			},
+		})
+	}
+
+	for i, server := range servers {
+		listener, err := net.Listen("tcp", server.Server.Addr)
+		if err != nil {
+			logger.Error(fmt.Sprintf("error listening: %s: %v", server.Name, err))
+
+			os.Exit(1)
+		}
+
+		servers[i].Listener = listener
+	}
+
+	runners := make(map[string]auth.Runner)
+
+	for name, component := range components {
+		if runner, ok := component.(auth.Runner); ok {
+			runners[name] = runner
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Stop listening for signals once shutting down: a second signal terminates the process immediately
+	context.AfterFunc(ctx, stop)
+
+	exitCode := runServers(ctx, logger, servers, runners, shutdownTimeout)
+
+	// Flush buffered spans
+	if tracerProvider != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		if err := tracerProvider.Shutdown(shutdownCtx); err != nil {
+			logger.Error(fmt.Sprintf("error shutting down tracer provider: %v", err))
+
+			exitCode = 1
+		}
+	}
+
+	logger.Info("server stopped")
+
+	if exitCode != 0 {
+		os.Exit(exitCode)
+	}
+}
+
+// loadConfig loads the configuration file (expanding environment variable references).
+func loadConfig(path string) (config.Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return config.Config{}, err
+	}
+	defer file.Close()
+
+	return config.Load(file)
 }
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/sagikazarmark/registry-auth/config"
+)
+
+// passwordPolicyFlags registers flags configuring a password policy on flags.
+func passwordPolicyFlags(flags *flag.FlagSet) *config.PasswordPolicy {
+	var policy config.PasswordPolicy
+
+	flags.IntVar(&policy.MinLength, "min-length", 0, "Reject passwords shorter than this")
+	flags.IntVar(&policy.MinCharacterClasses, "min-character-classes", 0, "Reject passwords with fewer character classes (lowercase, uppercase, digits, others) than this")
+
+	return &policy
+}
+
+// hashPassword implements the hash-password command.
+// It reads a password from the standard input and prints its bcrypt hash.
+func hashPassword(args []string) error {
+	var cost int
+
+	flags := flag.NewFlagSet("hash-password", flag.ExitOnError)
+	flags.IntVar(&cost, "cost", bcrypt.DefaultCost, "bcrypt cost of the password hash")
+	policy := passwordPolicyFlags(flags)
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+
+		return errors.New("no password on standard input")
+	}
+
+	hash, err := config.HashPassword(strings.TrimSuffix(scanner.Text(), "\r"), cost, *policy)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Println(hash)
+
+	return err
+}
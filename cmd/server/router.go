@@ -0,0 +1,152 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+	"github.com/sagikazarmark/registry-auth/auth/authz"
+	"github.com/sagikazarmark/registry-auth/auth/token/jwt"
+	"github.com/sagikazarmark/registry-auth/auth/token/reference"
+	"github.com/sagikazarmark/registry-auth/config"
+)
+
+// newRouters returns the handlers of the public and the admin API.
+//
+// If the admin API has no address of its own, admin routes are served by the public handler under /admin
+// and the returned admin handler is nil.
+func newRouters(server auth.TokenServer, config config.Config, passwordAuthenticator auth.PasswordAuthenticator, accessTokenIssuer auth.AccessTokenIssuer, logger *slog.Logger) (http.Handler, http.Handler) {
+	router := mux.NewRouter()
+	router.Use(
+		auth.RequestIDMiddleware,
+		auth.TraceContextMiddleware(otel.GetTextMapPropagator()),
+		auth.RecoveryMiddleware(logger),
+		auth.RequestLimitsMiddleware(config.Server.GetRequestLimits()),
+	)
+	router.Path("/healthz").Methods("GET").HandlerFunc(server.HealthHandler)
+	router.Path("/readyz").Methods("GET").HandlerFunc(server.ReadyHandler)
+
+	var rateLimitMiddleware func(http.Handler) http.Handler
+
+	// Limiters are shared by every token endpoint
+	if config.Server.RateLimit.Enabled() {
+		rateLimitMiddleware = server.RateLimitMiddleware(config.Server.GetRateLimits(auth.Dependencies{Logger: logger}))
+	}
+
+	// Client restrictions apply to token endpoints only (probes and registries use other user agents)
+	clientEndpoint := func(handler http.HandlerFunc) http.Handler {
+		var h http.Handler = handler
+
+		if rateLimitMiddleware != nil {
+			h = rateLimitMiddleware(h)
+		}
+
+		if config.Server.UserAgents.Enabled() {
+			h = auth.UserAgentMiddleware(config.Server.GetUserAgentFilter())(h)
+		}
+
+		return h
+	}
+
+	router.Path("/token").Methods("GET").Handler(clientEndpoint(server.TokenHandler))
+	router.Path("/token").Methods("POST").Handler(clientEndpoint(server.OAuth2Handler))
+
+	if config.Server.BatchTokens {
+		router.Path("/token/batch").Methods("POST").Handler(clientEndpoint(server.BatchTokenHandler))
+	}
+
+	if config.Server.Permissions.Enabled {
+		router.Path("/permissions").Methods("GET").Handler(clientEndpoint(server.PermissionsHandler))
+	}
+
+	// Registries resolve reference tokens using introspection (callers have to authenticate according to RFC 7662)
+	if issuer, ok := referenceAccessTokenIssuer(accessTokenIssuer); ok {
+		introspectionMiddleware := auth.AdminMiddleware(passwordAuthenticator, config.Server.Introspection.SubjectAttributes)
+
+		router.Path("/introspect").Methods("POST").Handler(introspectionMiddleware(reference.IntrospectionHandler(issuer)))
+	}
+
+	// Registries verify JWT access tokens using the published keys
+	if keySets := jwtKeySets(accessTokenIssuer); len(keySets) > 0 {
+		router.Path("/.well-known/jwks.json").Methods("GET").Handler(jwt.JWKSHandler(keySets))
+	}
+
+	if !config.Server.Admin.Enabled {
+		return router, nil
+	}
+
+	var (
+		adminRouter *mux.Router
+		adminServer http.Handler
+	)
+
+	if config.Server.Admin.Addr == "" {
+		adminRouter = router.PathPrefix("/admin").Subrouter()
+	} else {
+		root := mux.NewRouter()
+		root.Use(
+			auth.RequestIDMiddleware,
+			auth.RecoveryMiddleware(logger),
+		)
+
+		adminRouter = root.PathPrefix("/admin").Subrouter()
+		adminServer = root
+	}
+
+	adminRouter.Use(auth.AdminMiddleware(passwordAuthenticator, config.Server.Admin.SubjectAttributes))
+
+	if ruleSet, ok := config.Authorizer.RuleSet(); ok {
+		adminRouter.Path("/rules").Methods("GET").Handler(authz.RuleSetHandler(ruleSet))
+	}
+
+	return router, adminServer
+}
+
+// jwtKeySets returns the key sets of every JWT access token issuer, including per-service ones.
+func jwtKeySets(accessTokenIssuer auth.AccessTokenIssuer) jwt.KeySets {
+	switch issuer := accessTokenIssuer.(type) {
+	case jwt.AccessTokenIssuer:
+		return jwt.KeySets{issuer}
+
+	case auth.SizeLimitedAccessTokenIssuer:
+		return jwtKeySets(issuer.Issuer)
+
+	case auth.ServiceAccessTokenIssuer:
+		var keySets jwt.KeySets
+
+		if issuer.Default != nil {
+			keySets = append(keySets, jwtKeySets(issuer.Default)...)
+		}
+
+		services := make([]string, 0, len(issuer.Issuers))
+		for service := range issuer.Issuers {
+			services = append(services, service)
+		}
+
+		// Keep the key set stable across restarts
+		slices.Sort(services)
+
+		for _, service := range services {
+			keySets = append(keySets, jwtKeySets(issuer.Issuers[service])...)
+		}
+
+		return keySets
+	}
+
+	return nil
+}
+
+// referenceAccessTokenIssuer returns the reference token issuer used directly or as a fallback for oversized tokens.
+func referenceAccessTokenIssuer(accessTokenIssuer auth.AccessTokenIssuer) (*reference.AccessTokenIssuer, bool) {
+	if sizeLimitedIssuer, ok := accessTokenIssuer.(auth.SizeLimitedAccessTokenIssuer); ok {
+		accessTokenIssuer = sizeLimitedIssuer.Fallback
+	}
+
+	issuer, ok := accessTokenIssuer.(*reference.AccessTokenIssuer)
+
+	return issuer, ok
+}
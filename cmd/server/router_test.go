@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/libtrust"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+	"github.com/sagikazarmark/registry-auth/auth/authn"
+	"github.com/sagikazarmark/registry-auth/auth/token/jwt"
+	"github.com/sagikazarmark/registry-auth/auth/token/reference"
+	"github.com/sagikazarmark/registry-auth/config"
+)
+
+func serve(t *testing.T, handler http.Handler) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := &http.Server{Handler: handler}
+
+	go server.Serve(listener) //nolint:errcheck
+
+	t.Cleanup(func() { server.Close() })
+
+	return "http://" + listener.Addr().String()
+}
+
+func TestNewRouters_AdminListener(t *testing.T) {
+	const input = `
+authorizer:
+  type: default
+  config:
+    rules:
+      - repository: "{subject}/**"
+        actions: ["*"]
+server:
+  admin:
+    enabled: true
+    addr: 127.0.0.1:0
+    subjectAttributes:
+      role: admin
+`
+
+	var config config.Config
+
+	err := yaml.Unmarshal([]byte(input), &config)
+	require.NoError(t, err)
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	passwordAuthenticator := authn.NewUserAuthenticator([]authn.User{
+		{
+			Enabled:      true,
+			Username:     "admin",
+			PasswordHash: string(passwordHash),
+			Attrs:        map[string]string{"role": "admin"},
+		},
+	})
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	router, adminRouter := newRouters(auth.TokenServer{}, config, passwordAuthenticator, nil, logger)
+	require.NotNil(t, adminRouter)
+
+	publicURL := serve(t, router)
+	adminURL := serve(t, adminRouter)
+
+	get := func(t *testing.T, url string) int {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+
+		req.SetBasicAuth("admin", "password")
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, get(t, adminURL+"/admin/rules"))
+	assert.Equal(t, http.StatusNotFound, get(t, publicURL+"/admin/rules"))
+	assert.Equal(t, http.StatusNotFound, get(t, adminURL+"/token"))
+	assert.NotEqual(t, http.StatusNotFound, get(t, publicURL+"/token"))
+}
+
+func TestNewRouters_SharedListener(t *testing.T) {
+	config := config.Config{
+		Server: config.Server{
+			Admin: config.Admin{
+				Enabled:           true,
+				SubjectAttributes: map[string]string{"role": "admin"},
+			},
+		},
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	_, adminRouter := newRouters(auth.TokenServer{}, config, authn.NewUserAuthenticator(nil), nil, logger)
+	assert.Nil(t, adminRouter)
+}
+
+func TestNewRouters_Introspection(t *testing.T) {
+	config := config.Config{
+		Server: config.Server{
+			Introspection: config.Introspection{
+				SubjectAttributes: map[string]string{"role": "registry"},
+			},
+		},
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	passwordAuthenticator := authn.NewUserAuthenticator([]authn.User{
+		{
+			Enabled:      true,
+			Username:     "registry",
+			PasswordHash: string(passwordHash),
+			Attrs:        map[string]string{"role": "registry"},
+		},
+		{
+			Enabled:      true,
+			Username:     "user",
+			PasswordHash: string(passwordHash),
+		},
+	})
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	router, _ := newRouters(auth.TokenServer{}, config, passwordAuthenticator, reference.NewAccessTokenIssuer(time.Minute), logger)
+
+	url := serve(t, router) + "/introspect"
+
+	introspect := func(t *testing.T, username string) int {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodPost, url, strings.NewReader("token=unknown"))
+		require.NoError(t, err)
+
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		if username != "" {
+			req.SetBasicAuth(username, "password")
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, introspect(t, ""))
+	assert.Equal(t, http.StatusForbidden, introspect(t, "user"))
+	assert.Equal(t, http.StatusOK, introspect(t, "registry"))
+}
+
+func TestNewRouters_JWKS(t *testing.T) {
+	defaultKey, err := libtrust.GenerateECP256PrivateKey()
+	require.NoError(t, err)
+
+	serviceKey, err := libtrust.GenerateECP256PrivateKey()
+	require.NoError(t, err)
+
+	accessTokenIssuer := auth.ServiceAccessTokenIssuer{
+		Issuers: map[string]auth.AccessTokenIssuer{
+			"service.example.com": jwt.NewAccessTokenIssuer("issuer.example.com", serviceKey, time.Minute),
+		},
+		Default: jwt.NewAccessTokenIssuer("issuer.example.com", defaultKey, time.Minute),
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	router, _ := newRouters(auth.TokenServer{}, config.Config{}, authn.NewUserAuthenticator(nil), accessTokenIssuer, logger)
+
+	resp, err := http.Get(serve(t, router) + "/.well-known/jwks.json")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var keySet struct {
+		Keys []struct {
+			KeyID string `json:"kid"`
+		} `json:"keys"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&keySet)
+	require.NoError(t, err)
+
+	require.Len(t, keySet.Keys, 2)
+	assert.Equal(t, defaultKey.KeyID(), keySet.Keys[0].KeyID)
+	assert.Equal(t, serviceKey.KeyID(), keySet.Keys[1].KeyID)
+}
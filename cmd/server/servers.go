@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+// namedServer is an HTTP server along with the listener it serves on.
+type namedServer struct {
+	// Name identifies the server in logs.
+	Name string
+
+	Server   *http.Server
+	Listener net.Listener
+
+	// CertFile and KeyFile are passed to [http.Server.ServeTLS] if the server has a TLS configuration.
+	CertFile string
+	KeyFile  string
+}
+
+func (s namedServer) serve() error {
+	if s.Server.TLSConfig != nil {
+		return s.Server.ServeTLS(s.Listener, s.CertFile, s.KeyFile)
+	}
+
+	return s.Server.Serve(s.Listener)
+}
+
+// runServers serves requests and runs background tasks until ctx is done or a server fails.
+//
+// Servers are then shut down, waiting up to shutdownTimeout for in-flight requests to finish.
+// Background tasks (eg. persisting revocations) are stopped after the servers,
+// so that they capture the changes made by in-flight requests.
+//
+// runServers returns the exit code of the process: non-zero if any server, shutdown or background task failed.
+func runServers(ctx context.Context, logger *slog.Logger, servers []namedServer, runners map[string]auth.Runner, shutdownTimeout time.Duration) int {
+	serveErrs := make(chan error, len(servers))
+
+	for _, server := range servers {
+		go func(server namedServer) {
+			logger.Info("launching "+server.Name, slog.String("addr", server.Listener.Addr().String()))
+
+			if err := server.serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serveErrs <- fmt.Errorf("%s: %w", server.Name, err)
+			}
+		}(server)
+	}
+
+	runCtx, cancelRun := context.WithCancel(context.Background())
+	defer cancelRun()
+
+	var (
+		wg        sync.WaitGroup
+		runFailed atomic.Bool
+	)
+
+	for name, runner := range runners {
+		wg.Add(1)
+
+		go func(name string, runner auth.Runner) {
+			defer wg.Done()
+
+			if err := runner.Run(runCtx); err != nil {
+				logger.Error(fmt.Sprintf("error running %s: %v", name, err))
+
+				runFailed.Store(true)
+			}
+		}(name, runner)
+	}
+
+	var exitCode int
+
+	select {
+	case err := <-serveErrs:
+		logger.Error(fmt.Sprintf("error serving: %v", err))
+
+		exitCode = 1
+
+	case <-ctx.Done():
+		logger.Info("shutting down", slog.Duration("timeout", shutdownTimeout))
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	for _, server := range servers {
+		if err := server.Server.Shutdown(shutdownCtx); err != nil {
+			logger.Error(fmt.Sprintf("error shutting down %s: %v", server.Name, err), slog.String("addr", server.Listener.Addr().String()))
+
+			exitCode = 1
+		}
+	}
+
+	cancelRun()
+	wg.Wait()
+
+	if runFailed.Load() {
+		exitCode = 1
+	}
+
+	return exitCode
+}
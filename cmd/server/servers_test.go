@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+func newTestServer(t *testing.T, name string, handler http.Handler) namedServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	return namedServer{
+		Name:     name,
+		Server:   &http.Server{Handler: handler},
+		Listener: listener,
+	}
+}
+
+type runnerFunc func(ctx context.Context) error
+
+func (fn runnerFunc) Run(ctx context.Context) error {
+	return fn(ctx)
+}
+
+func TestRunServers_InFlightRequest(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	var requestCompleted atomic.Bool
+
+	server := newTestServer(t, "server", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		close(started)
+		<-release
+
+		_, _ = w.Write([]byte("done"))
+
+		requestCompleted.Store(true)
+	}))
+
+	// Background tasks are stopped after in-flight requests complete
+	var completedBeforeRunnerStopped atomic.Bool
+
+	runners := map[string]auth.Runner{
+		"runner": runnerFunc(func(ctx context.Context) error {
+			<-ctx.Done()
+
+			completedBeforeRunnerStopped.Store(requestCompleted.Load())
+
+			return nil
+		}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	exitCode := make(chan int, 1)
+
+	go func() {
+		exitCode <- runServers(ctx, logger, []namedServer{server}, runners, 5*time.Second)
+	}()
+
+	type result struct {
+		body string
+		err  error
+	}
+
+	results := make(chan result, 1)
+
+	go func() {
+		resp, err := http.Get("http://" + server.Listener.Addr().String())
+		if err != nil {
+			results <- result{err: err}
+
+			return
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+
+		results <- result{body: string(body), err: err}
+	}()
+
+	<-started
+
+	// Shut down while the request is in flight
+	cancel()
+
+	select {
+	case <-exitCode:
+		t.Fatal("servers should wait for in-flight requests")
+
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+
+	r := <-results
+	require.NoError(t, r.err)
+
+	assert.Equal(t, "done", r.body)
+	assert.Equal(t, 0, <-exitCode)
+	assert.True(t, completedBeforeRunnerStopped.Load())
+}
+
+func TestRunServers_ServeError(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	server := newTestServer(t, "server", http.NotFoundHandler())
+
+	// Serving on a closed listener fails with an error other than http.ErrServerClosed
+	require.NoError(t, server.Listener.Close())
+
+	var runnerStopped atomic.Bool
+
+	runners := map[string]auth.Runner{
+		"runner": runnerFunc(func(ctx context.Context) error {
+			<-ctx.Done()
+
+			runnerStopped.Store(true)
+
+			return nil
+		}),
+	}
+
+	exitCode := runServers(context.Background(), logger, []namedServer{server}, runners, time.Second)
+
+	assert.Equal(t, 1, exitCode)
+	assert.True(t, runnerStopped.Load())
+}
+
+func TestRunServers_RunnerError(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	server := newTestServer(t, "server", http.NotFoundHandler())
+
+	runners := map[string]auth.Runner{
+		"runner": runnerFunc(func(_ context.Context) error {
+			return errors.New("runner failed")
+		}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	exitCode := runServers(ctx, logger, []namedServer{server}, runners, time.Second)
+
+	assert.Equal(t, 1, exitCode)
+}
@@ -0,0 +1,9 @@
+package main
+
+// Drivers of the SQL backed components (eg. the sql password authenticator and refresh token store).
+//
+// Binaries embedding the config package need to link the drivers they use the same way.
+import (
+	_ "github.com/go-sql-driver/mysql" // mysql
+	_ "github.com/jackc/pgx/v5/stdlib" // pgx (PostgreSQL)
+)
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/sagikazarmark/registry-auth/config"
+)
+
+func TestSQLDrivers_PasswordAuthenticator(t *testing.T) {
+	for _, driver := range []string{"pgx", "mysql"} {
+		driver := driver
+
+		t.Run(driver, func(t *testing.T) {
+			var authenticator config.PasswordAuthenticator
+
+			err := yaml.Unmarshal([]byte(`
+type: sql
+config:
+  driver: `+driver+`
+  dsn: dsn
+  query: SELECT username, password_hash, enabled FROM users WHERE username = ?
+`), &authenticator)
+			require.NoError(t, err)
+
+			require.NoError(t, authenticator.Validate())
+		})
+	}
+}
+
+func TestSQLDrivers_RefreshTokenStore(t *testing.T) {
+	for _, driver := range []string{"pgx", "mysql"} {
+		driver := driver
+
+		t.Run(driver, func(t *testing.T) {
+			var issuer config.RefreshTokenIssuer
+
+			err := yaml.Unmarshal([]byte(`
+type: store
+config:
+  store: sql
+  sql:
+    driver: `+driver+`
+    dsn: dsn
+`), &issuer)
+			require.NoError(t, err)
+
+			require.NoError(t, issuer.Validate())
+		})
+	}
+}
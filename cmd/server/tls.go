@@ -0,0 +1,46 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+// newTLSConfig returns the TLS configuration of the server.
+//
+// TLS 1.2 is the minimum version accepted.
+// If clientCAFile is not empty, clients have to present a certificate signed by one of the CAs in it (mutual TLS).
+// If revocationChecker is not nil, revoked client certificates are rejected during the handshake.
+func newTLSConfig(clientCAFile string, revocationChecker *auth.ClientCertificateRevocationChecker) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if clientCAFile == "" {
+		return tlsConfig, nil
+	}
+
+	pem, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading client CA file: %w", err)
+	}
+
+	clientCAs := x509.NewCertPool()
+
+	if !clientCAs.AppendCertsFromPEM(pem) {
+		return nil, errors.New("client CA file does not contain any certificates")
+	}
+
+	tlsConfig.ClientCAs = clientCAs
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+
+	if revocationChecker != nil {
+		tlsConfig.VerifyConnection = revocationChecker.VerifyConnection
+	}
+
+	return tlsConfig, nil
+}
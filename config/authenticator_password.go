@@ -1,8 +1,11 @@
 package config
 
 import (
+	"database/sql"
 	"fmt"
 	"maps"
+	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 
@@ -28,6 +31,9 @@ func RegisterPasswordAuthenticatorFactory(name string, factory func() PasswordAu
 
 func init() {
 	RegisterPasswordAuthenticatorFactory("user", func() PasswordAuthenticatorFactory { return userAuthenticator{} })
+	RegisterPasswordAuthenticatorFactory("htpasswd", func() PasswordAuthenticatorFactory { return htpasswdAuthenticator{} })
+	RegisterPasswordAuthenticatorFactory("ldap", func() PasswordAuthenticatorFactory { return ldapAuthenticator{} })
+	RegisterPasswordAuthenticatorFactory("sql", func() PasswordAuthenticatorFactory { return sqlAuthenticator{} })
 }
 
 // PasswordAuthenticator is the configuration for an [auth.PasswordAuthenticator].
@@ -65,12 +71,26 @@ func (c *PasswordAuthenticator) UnmarshalYAML(value *yaml.Node) error {
 
 type userAuthenticator struct {
 	Entries []user `mapstructure:"entries"`
+
+	// Duplicates controls users listed multiple times with conflicting enabled flags:
+	// "mostRestrictive" (default) disables the user if any of its entries is disabled,
+	// "lastWins" uses the last entry and "reject" fails validation.
+	Duplicates string `mapstructure:"duplicates"`
 }
 
+const (
+	duplicatesMostRestrictive = "mostRestrictive"
+	duplicatesLastWins        = "lastWins"
+	duplicatesReject          = "reject"
+)
+
 type user struct {
 	Enabled      bool              `mapstructure:"enabled"`
 	Username     string            `mapstructure:"username"`
 	PasswordHash string            `mapstructure:"passwordHash"`
+	Email        string            `mapstructure:"email"`
+	DisplayName  string            `mapstructure:"displayName"`
+	Groups       []string          `mapstructure:"groups"`
 	Attrs        map[string]string `mapstructure:"attributes"`
 }
 
@@ -80,14 +100,33 @@ func (c userAuthenticator) New() (auth.PasswordAuthenticator, error) {
 			Enabled:      v.Enabled,
 			Username:     v.Username,
 			PasswordHash: v.PasswordHash,
+			Email:        v.Email,
+			DisplayName:  v.DisplayName,
+			Groups:       v.Groups,
 			Attrs:        maps.Clone(v.Attrs),
 		}
 	})
 
-	return authn.NewUserAuthenticator(entries), nil
+	var opts []authn.UserAuthenticatorOption
+
+	if c.Duplicates == duplicatesLastWins {
+		opts = append(opts, authn.WithLastEntryWins())
+	}
+
+	return authn.NewUserAuthenticator(entries, opts...), nil
 }
 
 func (c userAuthenticator) Validate() error {
+	switch c.Duplicates {
+	case "", duplicatesMostRestrictive, duplicatesLastWins, duplicatesReject:
+	default:
+		return fmt.Errorf("user authenticator: duplicates: must be one of %q, %q or %q", duplicatesMostRestrictive, duplicatesLastWins, duplicatesReject)
+	}
+
+	if conflicts := c.conflictingEntries(); len(conflicts) > 0 && c.Duplicates == duplicatesReject {
+		return fmt.Errorf("user authenticator: %s", conflicts[0])
+	}
+
 	for i, entry := range c.Entries {
 		if entry.Username == "" {
 			return fmt.Errorf("user authenticator: entry[%d]: username is required", i)
@@ -96,7 +135,192 @@ func (c userAuthenticator) Validate() error {
 		if entry.PasswordHash == "" {
 			return fmt.Errorf("user authenticator: entry[%d]: password hash is required", i)
 		}
+
+		if err := authn.CheckPasswordHash(entry.PasswordHash); err != nil {
+			return fmt.Errorf("user authenticator: entry[%d]: password hash: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// Warnings implements [Warner].
+func (c userAuthenticator) Warnings() []string {
+	if c.Duplicates == duplicatesReject {
+		return nil
+	}
+
+	var warnings []string
+
+	for _, conflict := range c.conflictingEntries() {
+		if c.Duplicates == duplicatesLastWins {
+			warnings = append(warnings, fmt.Sprintf("user authenticator: %s: the last entry wins", conflict))
+		} else {
+			warnings = append(warnings, fmt.Sprintf("user authenticator: %s: the user is disabled", conflict))
+		}
+	}
+
+	return warnings
+}
+
+// conflictingEntries describes entries listing the same username as the previous entry of the user with a different enabled flag.
+func (c userAuthenticator) conflictingEntries() []string {
+	var conflicts []string
+
+	previousEntries := make(map[string]int, len(c.Entries))
+
+	for i, entry := range c.Entries {
+		if j, ok := previousEntries[entry.Username]; ok && c.Entries[j].Enabled != entry.Enabled {
+			conflicts = append(conflicts, fmt.Sprintf("entry[%d]: user %q conflicts with entry[%d] (enabled: %t)", i, entry.Username, j, c.Entries[j].Enabled))
+		}
+
+		previousEntries[entry.Username] = i
+	}
+
+	return conflicts
+}
+
+type htpasswdAuthenticator struct {
+	Path string `mapstructure:"path"`
+}
+
+func (c htpasswdAuthenticator) New() (auth.PasswordAuthenticator, error) {
+	return authn.NewHtpasswdAuthenticator(c.Path)
+}
+
+func (c htpasswdAuthenticator) Validate() error {
+	if c.Path == "" {
+		return fmt.Errorf("htpasswd authenticator: path is required")
+	}
+
+	data, err := os.ReadFile(c.Path)
+	if err != nil {
+		return fmt.Errorf("htpasswd authenticator: %w", err)
+	}
+
+	if _, err := authn.ParseHtpasswd(data); err != nil {
+		return fmt.Errorf("htpasswd authenticator: %s: %w", c.Path, err)
+	}
+
+	return nil
+}
+
+type ldapAuthenticator struct {
+	URL          string        `mapstructure:"url"`
+	StartTLS     bool          `mapstructure:"startTLS"`
+	BindDN       string        `mapstructure:"bindDN"`
+	BindPassword string        `mapstructure:"bindPassword"`
+	BaseDN       string        `mapstructure:"baseDN"`
+	UserFilter   string        `mapstructure:"userFilter"`
+	Attributes   []string      `mapstructure:"attributes"`
+	Timeout      time.Duration `mapstructure:"timeout"`
+
+	// EmailAttribute, DisplayNameAttribute and GroupsAttribute populate the typed identity of users
+	// (mail, displayName and memberOf by default).
+	EmailAttribute       string `mapstructure:"emailAttribute"`
+	DisplayNameAttribute string `mapstructure:"displayNameAttribute"`
+	GroupsAttribute      string `mapstructure:"groupsAttribute"`
+}
+
+func (c ldapAuthenticator) config() authn.LDAPConfig {
+	return authn.LDAPConfig{
+		URL:                  c.URL,
+		StartTLS:             c.StartTLS,
+		BindDN:               c.BindDN,
+		BindPassword:         c.BindPassword,
+		BaseDN:               c.BaseDN,
+		UserFilter:           c.UserFilter,
+		Attributes:           c.Attributes,
+		EmailAttribute:       c.EmailAttribute,
+		DisplayNameAttribute: c.DisplayNameAttribute,
+		GroupsAttribute:      c.GroupsAttribute,
+		Timeout:              c.Timeout,
+	}
+}
+
+func (c ldapAuthenticator) New() (auth.PasswordAuthenticator, error) {
+	return authn.NewLDAPAuthenticator(c.config()), nil
+}
+
+func (c ldapAuthenticator) Validate() error {
+	if err := c.config().Validate(); err != nil {
+		return fmt.Errorf("ldap authenticator: %w", err)
 	}
 
 	return nil
 }
+
+type sqlAuthenticator struct {
+	// Driver is the name of a database/sql driver linked into the binary
+	// (the server links "pgx" for PostgreSQL and "mysql").
+	Driver string `mapstructure:"driver"`
+	DSN    string `mapstructure:"dsn"`
+
+	// Query looks up a user by username (see [authn.SQLAuthenticator]).
+	Query string `mapstructure:"query"`
+
+	MaxOpenConns int `mapstructure:"maxOpenConns"`
+	MaxIdleConns int `mapstructure:"maxIdleConns"`
+
+	// Columns holding the typed identity of users (defaults: email, display_name and groups).
+	EmailColumn       string `mapstructure:"emailColumn"`
+	DisplayNameColumn string `mapstructure:"displayNameColumn"`
+	GroupsColumn      string `mapstructure:"groupsColumn"`
+}
+
+func (c sqlAuthenticator) New() (auth.PasswordAuthenticator, error) {
+	db, err := sql.Open(c.Driver, c.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(c.MaxOpenConns)
+
+	if c.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(c.MaxIdleConns)
+	}
+
+	return authn.NewSQLAuthenticator(db, c.Query, authn.WithIdentityColumns(authn.SQLIdentityColumns{
+		Email:       c.EmailColumn,
+		DisplayName: c.DisplayNameColumn,
+		Groups:      c.GroupsColumn,
+	})), nil
+}
+
+func (c sqlAuthenticator) Validate() error {
+	if c.Driver == "" {
+		return fmt.Errorf("sql authenticator: driver is required")
+	}
+
+	if c.DSN == "" {
+		return fmt.Errorf("sql authenticator: dsn is required")
+	}
+
+	if c.Query == "" {
+		return fmt.Errorf("sql authenticator: query is required")
+	}
+
+	if c.MaxOpenConns < 0 {
+		return fmt.Errorf("sql authenticator: maxOpenConns cannot be negative")
+	}
+
+	if c.MaxIdleConns < 0 {
+		return fmt.Errorf("sql authenticator: maxIdleConns cannot be negative")
+	}
+
+	if !isSQLDriverRegistered(c.Driver) {
+		return fmt.Errorf("sql authenticator: unknown driver %q (forgotten import?)", c.Driver)
+	}
+
+	return nil
+}
+
+func isSQLDriverRegistered(driver string) bool {
+	for _, name := range sql.Drivers() {
+		if name == driver {
+			return true
+		}
+	}
+
+	return false
+}
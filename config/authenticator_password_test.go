@@ -0,0 +1,139 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+func TestPasswordAuthenticator_SQL_Validate(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{
+			name: "EmptyQuery",
+			input: `
+type: sql
+config:
+  driver: postgres
+  dsn: postgres://localhost/users
+`,
+			err: "sql authenticator: query is required",
+		},
+		{
+			name: "UnknownDriver",
+			input: `
+type: sql
+config:
+  driver: unknown
+  dsn: postgres://localhost/users
+  query: SELECT username, password_hash, enabled FROM users WHERE username = $1
+  maxOpenConns: 10
+  maxIdleConns: 5
+`,
+			err: `sql authenticator: unknown driver "unknown" (forgotten import?)`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			var config PasswordAuthenticator
+
+			err := yaml.Unmarshal([]byte(testCase.input), &config)
+			require.NoError(t, err)
+
+			assert.EqualError(t, config.Validate(), testCase.err)
+		})
+	}
+}
+
+func TestPasswordAuthenticator_User_Duplicates(t *testing.T) {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	newConfig := func(t *testing.T, duplicates string) Config {
+		t.Helper()
+
+		input := fmt.Sprintf(`
+passwordAuthenticator:
+  type: user
+  config:
+    duplicates: %q
+    entries:
+      - username: user
+        passwordHash: %q
+        enabled: false
+      - username: other
+        passwordHash: %q
+        enabled: true
+      - username: user
+        passwordHash: %q
+        enabled: true
+`, duplicates, passwordHash, passwordHash, passwordHash)
+
+		var config Config
+
+		err := yaml.Unmarshal([]byte(input), &config)
+		require.NoError(t, err)
+
+		return config
+	}
+
+	authenticate := func(t *testing.T, config Config) error {
+		t.Helper()
+
+		authenticator, err := config.PasswordAuthenticator.New()
+		require.NoError(t, err)
+
+		_, err = authenticator.AuthenticatePassword(context.Background(), "user", "password")
+
+		return err
+	}
+
+	t.Run("MostRestrictive", func(t *testing.T) {
+		config := newConfig(t, "")
+
+		require.NoError(t, config.PasswordAuthenticator.Validate())
+
+		assert.Equal(t, []string{
+			`password authenticator: user authenticator: entry[2]: user "user" conflicts with entry[0] (enabled: false): the user is disabled`,
+		}, config.Warnings())
+
+		require.ErrorIs(t, authenticate(t, config), auth.ErrAccountDisabled)
+	})
+
+	t.Run("LastWins", func(t *testing.T) {
+		config := newConfig(t, "lastWins")
+
+		require.NoError(t, config.PasswordAuthenticator.Validate())
+
+		assert.Equal(t, []string{
+			`password authenticator: user authenticator: entry[2]: user "user" conflicts with entry[0] (enabled: false): the last entry wins`,
+		}, config.Warnings())
+
+		require.NoError(t, authenticate(t, config))
+	})
+
+	t.Run("Reject", func(t *testing.T) {
+		config := newConfig(t, "reject")
+
+		assert.EqualError(t, config.PasswordAuthenticator.Validate(), `user authenticator: entry[2]: user "user" conflicts with entry[0] (enabled: false)`)
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		config := newConfig(t, "firstWins")
+
+		assert.EqualError(t, config.PasswordAuthenticator.Validate(), `user authenticator: duplicates: must be one of "mostRestrictive", "lastWins" or "reject"`)
+	})
+}
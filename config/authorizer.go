@@ -1,10 +1,16 @@
 package config
 
 import (
+	"fmt"
+	"maps"
+	"regexp"
+	"strings"
+
 	"gopkg.in/yaml.v3"
 
 	"github.com/sagikazarmark/registry-auth/auth"
 	"github.com/sagikazarmark/registry-auth/auth/authz"
+	"github.com/sagikazarmark/registry-auth/pkg/slices"
 )
 
 // AuthorizerFactory creates a new [auth.Authorizer].
@@ -29,16 +35,28 @@ func init() {
 // Authorizer is the configuration for an auth.Authorizer.
 type Authorizer struct {
 	AuthorizerFactory
+
+	// CircuitBreaker protects the token service from outages of the authorizer (optional).
+	CircuitBreaker CircuitBreaker
 }
 
 func (c *Authorizer) UnmarshalYAML(value *yaml.Node) error {
-	var rawConfig rawConfig
+	var rawConfig struct {
+		rawConfig `yaml:",inline"`
+
+		CircuitBreaker map[string]interface{} `yaml:"circuitBreaker"`
+	}
 
 	err := value.Decode(&rawConfig)
 	if err != nil {
 		return err
 	}
 
+	err = decode(rawConfig.CircuitBreaker, &c.CircuitBreaker)
+	if err != nil {
+		return err
+	}
+
 	factory, ok := authorizerFactoryRegistry.GetFactory(rawConfig.Type)
 	if !ok {
 		c.AuthorizerFactory = unknownFactoryType[auth.Authorizer]{
@@ -59,14 +77,203 @@ func (c *Authorizer) UnmarshalYAML(value *yaml.Node) error {
 	return nil
 }
 
+// New returns a new [auth.Authorizer] (wrapped in a circuit breaker if configured).
+func (c Authorizer) New() (auth.Authorizer, error) {
+	authorizer, err := c.AuthorizerFactory.New()
+	if err != nil {
+		return nil, err
+	}
+
+	return c.CircuitBreaker.New(authorizer), nil
+}
+
+// Validate validates the configuration.
+func (c Authorizer) Validate() error {
+	if err := c.AuthorizerFactory.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.CircuitBreaker.Validate(); err != nil {
+		return fmt.Errorf("circuit breaker: %w", err)
+	}
+
+	return nil
+}
+
+// RuleSet returns the authorization rules of the configured authorizer.
+//
+// It returns false if the authorizer does not support rules.
+func (c Authorizer) RuleSet() (authz.RuleSet, bool) {
+	factory, ok := c.AuthorizerFactory.(interface{ ruleSet() authz.RuleSet })
+	if !ok {
+		return authz.RuleSet{}, false
+	}
+
+	return factory.ruleSet(), true
+}
+
 type defaultAuthorizer struct {
-	AllowAnonymous bool `mapstructure:"allowAnonymous"`
+	AllowAnonymous           bool                      `mapstructure:"allowAnonymous"`
+	ResourceTypeFilters      []resourceTypeFilter      `mapstructure:"resourceTypeFilters"`
+	AttributeTransformations []attributeTransformation `mapstructure:"attributeTransformations"`
+	Rules                    []rule                    `mapstructure:"rules"`
+	MissingAttribute         string                    `mapstructure:"missingAttribute"`
+	NamespaceProvisioning    namespaceProvisioning     `mapstructure:"namespaceProvisioning"`
+}
+
+type namespaceProvisioning struct {
+	Repository string   `mapstructure:"repository"`
+	Actions    []string `mapstructure:"actions"`
+}
+
+type rule struct {
+	Name              string            `mapstructure:"name"`
+	Repository        string            `mapstructure:"repository"`
+	SubjectAttributes map[string]string `mapstructure:"subjectAttributes"`
+	Groups            []string          `mapstructure:"groups"`
+	Actions           []string          `mapstructure:"actions"`
+	MissingAttribute  string            `mapstructure:"missingAttribute"`
+}
+
+type attributeTransformation struct {
+	Attribute string            `mapstructure:"attribute"`
+	Regexp    string            `mapstructure:"regexp"`
+	Mapping   map[string]string `mapstructure:"mapping"`
+}
+
+type resourceTypeFilter struct {
+	Service           string            `mapstructure:"service"`
+	SubjectAttributes map[string]string `mapstructure:"subjectAttributes"`
+	Allow             []string          `mapstructure:"allow"`
+	Deny              []string          `mapstructure:"deny"`
 }
 
 func (c defaultAuthorizer) New() (auth.Authorizer, error) {
-	return authz.NewDefaultAuthorizer(authz.NewDefaultRepositoryAuthorizer(c.AllowAnonymous), c.AllowAnonymous), nil
+	var repositoryAuthorizer authz.RepositoryAuthorizer = authz.NewDefaultRepositoryAuthorizer(c.AllowAnonymous)
+
+	if len(c.Rules) > 0 {
+		ruleSet := c.ruleSet()
+
+		repositoryAuthorizer = authz.NewRuleRepositoryAuthorizer(ruleSet.Rules, ruleSet.MissingAttribute)
+	}
+
+	if c.NamespaceProvisioning.Repository != "" {
+		repositoryAuthorizer = authz.NewNamespaceProvisioningRepositoryAuthorizer(
+			repositoryAuthorizer,
+			c.NamespaceProvisioning.Repository,
+			c.NamespaceProvisioning.Actions,
+		)
+	}
+
+	var authorizer auth.Authorizer = authz.NewDefaultAuthorizer(repositoryAuthorizer, c.AllowAnonymous)
+
+	if len(c.ResourceTypeFilters) > 0 {
+		filters := slices.Map(c.ResourceTypeFilters, func(v resourceTypeFilter) authz.ResourceTypeFilter {
+			return authz.ResourceTypeFilter{
+				Service:           v.Service,
+				SubjectAttributes: maps.Clone(v.SubjectAttributes),
+				Allow:             v.Allow,
+				Deny:              v.Deny,
+			}
+		})
+
+		authorizer = authz.NewFilteringAuthorizer(authorizer, filters)
+	}
+
+	if len(c.AttributeTransformations) > 0 {
+		transformations := make([]authz.AttributeTransformation, 0, len(c.AttributeTransformations))
+
+		for _, v := range c.AttributeTransformations {
+			transformation := authz.AttributeTransformation{
+				Attribute: v.Attribute,
+				Mapping:   maps.Clone(v.Mapping),
+			}
+
+			if v.Regexp != "" {
+				re, err := regexp.Compile(v.Regexp)
+				if err != nil {
+					return nil, err
+				}
+
+				transformation.Regexp = re
+			}
+
+			transformations = append(transformations, transformation)
+		}
+
+		authorizer = authz.NewAttributeTransformingAuthorizer(authorizer, transformations)
+	}
+
+	return authorizer, nil
+}
+
+func (c defaultAuthorizer) ruleSet() authz.RuleSet {
+	return authz.RuleSet{
+		MissingAttribute: c.MissingAttribute,
+		Rules: slices.Map(c.Rules, func(v rule) authz.Rule {
+			return authz.Rule{
+				Name:              v.Name,
+				Repository:        v.Repository,
+				SubjectAttributes: maps.Clone(v.SubjectAttributes),
+				Groups:            v.Groups,
+				Actions:           v.Actions,
+				MissingAttribute:  v.MissingAttribute,
+			}
+		}),
+	}
 }
 
 func (c defaultAuthorizer) Validate() error {
+	for i, filter := range c.ResourceTypeFilters {
+		if len(filter.Allow) == 0 && len(filter.Deny) == 0 {
+			return fmt.Errorf("default authorizer: resourceTypeFilters[%d]: either allow or deny is required", i)
+		}
+	}
+
+	for i, transformation := range c.AttributeTransformations {
+		if transformation.Attribute == "" {
+			return fmt.Errorf("default authorizer: attributeTransformations[%d]: attribute is required", i)
+		}
+
+		if transformation.Regexp == "" && len(transformation.Mapping) == 0 {
+			return fmt.Errorf("default authorizer: attributeTransformations[%d]: either regexp or mapping is required", i)
+		}
+
+		if _, err := regexp.Compile(transformation.Regexp); err != nil {
+			return fmt.Errorf("default authorizer: attributeTransformations[%d]: invalid regexp: %w", i, err)
+		}
+	}
+
+	if err := validateMissingAttribute(c.MissingAttribute); err != nil {
+		return fmt.Errorf("default authorizer: missingAttribute: %w", err)
+	}
+
+	for i, rule := range c.Rules {
+		if rule.Repository == "" {
+			return fmt.Errorf("default authorizer: rules[%d]: repository is required", i)
+		}
+
+		if len(rule.Actions) == 0 {
+			return fmt.Errorf("default authorizer: rules[%d]: actions are required", i)
+		}
+
+		if err := validateMissingAttribute(rule.MissingAttribute); err != nil {
+			return fmt.Errorf("default authorizer: rules[%d]: missingAttribute: %w", i, err)
+		}
+	}
+
+	if repository := c.NamespaceProvisioning.Repository; repository != "" && !strings.Contains(repository, auth.SubjectPlaceholder) {
+		return fmt.Errorf("default authorizer: namespaceProvisioning: repository must contain %s", auth.SubjectPlaceholder)
+	}
+
 	return nil
 }
+
+func validateMissingAttribute(v string) error {
+	switch v {
+	case "", authz.MissingAttributeDeny, authz.MissingAttributeSkip:
+		return nil
+	default:
+		return fmt.Errorf("unsupported value %q (supported values: %s, %s)", v, authz.MissingAttributeDeny, authz.MissingAttributeSkip)
+	}
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+	"github.com/sagikazarmark/registry-auth/auth/authz"
+)
+
+const (
+	circuitBreakerFailClosed = "failClosed"
+	circuitBreakerFailOpen   = "failOpen"
+)
+
+// CircuitBreaker configures a circuit breaker in front of an authorizer (see [authz.CircuitBreakerAuthorizer]).
+//
+// It protects the token service during outages of remote authorizers (eg. OPA bundles served over the network).
+type CircuitBreaker struct {
+	// Threshold is the number of consecutive failures opening the circuit (disabled if zero).
+	Threshold int `mapstructure:"threshold"`
+
+	// Cooldown is the time the circuit stays open before a probe request is let through (defaults to 30s).
+	Cooldown time.Duration `mapstructure:"cooldown"`
+
+	// Policy decides what happens while the circuit is open:
+	// "failClosed" (default) rejects requests, "failOpen" grants FailOpenActions on every requested repository to authenticated subjects.
+	Policy string `mapstructure:"policy"`
+
+	// FailOpenActions are the actions granted while the circuit is open (defaults to pull).
+	FailOpenActions []string `mapstructure:"failOpenActions"`
+}
+
+// Validate validates the configuration.
+func (c CircuitBreaker) Validate() error {
+	if c.Threshold < 0 {
+		return errors.New("threshold cannot be negative")
+	}
+
+	if c.Cooldown < 0 {
+		return errors.New("cooldown cannot be negative")
+	}
+
+	switch c.Policy {
+	case "", circuitBreakerFailClosed, circuitBreakerFailOpen:
+
+	default:
+		return fmt.Errorf("unsupported policy %q (must be %q or %q)", c.Policy, circuitBreakerFailClosed, circuitBreakerFailOpen)
+	}
+
+	if len(c.FailOpenActions) > 0 && c.Policy != circuitBreakerFailOpen {
+		return fmt.Errorf("failOpenActions requires the %q policy", circuitBreakerFailOpen)
+	}
+
+	return nil
+}
+
+// GetCooldown returns the configured cooldown or the default.
+func (c CircuitBreaker) GetCooldown() time.Duration {
+	if c.Cooldown == 0 {
+		return 30 * time.Second
+	}
+
+	return c.Cooldown
+}
+
+// New returns authorizer wrapped in a circuit breaker (or authorizer itself if the circuit breaker is disabled).
+func (c CircuitBreaker) New(authorizer auth.Authorizer) auth.Authorizer {
+	if c.Threshold == 0 {
+		return authorizer
+	}
+
+	var opts []authz.CircuitBreakerOption
+
+	if c.Policy == circuitBreakerFailOpen {
+		actions := c.FailOpenActions
+		if len(actions) == 0 {
+			actions = []string{"pull"}
+		}
+
+		opts = append(opts, authz.WithFallback(authz.NewFailOpenAuthorizer(actions)))
+	}
+
+	return authz.NewCircuitBreakerAuthorizer(authorizer, c.Threshold, c.GetCooldown(), opts...)
+}
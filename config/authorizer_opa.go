@@ -0,0 +1,59 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+	"github.com/sagikazarmark/registry-auth/auth/authz/opa"
+)
+
+func init() {
+	RegisterAuthorizerFactory("opa", func() AuthorizerFactory { return opaAuthorizer{} })
+}
+
+// opaAuthorizer delegates authorization decisions to a Rego policy (see [opa.Authorizer]).
+type opaAuthorizer struct {
+	// Policy is an inline Rego module.
+	Policy string `mapstructure:"policy"`
+
+	// Bundle is the path of a policy bundle (a directory or a .tar.gz file).
+	Bundle string `mapstructure:"bundle"`
+
+	// Decision is the reference of the rule producing the allowed actions (eg. data.registry.authz.allow).
+	Decision string `mapstructure:"decision"`
+
+	// Timeout limits the time a single policy evaluation may take (defaults to 1s).
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+func (c opaAuthorizer) config() opa.Config {
+	return opa.Config{
+		Policy:   c.Policy,
+		Bundle:   c.Bundle,
+		Decision: c.Decision,
+		Timeout:  c.Timeout,
+	}
+}
+
+func (c opaAuthorizer) New() (auth.Authorizer, error) {
+	authorizer, err := opa.NewAuthorizer(context.Background(), c.config())
+	if err != nil {
+		return nil, fmt.Errorf("opa authorizer: %w", err)
+	}
+
+	return authorizer, nil
+}
+
+func (c opaAuthorizer) Validate() error {
+	if c.Timeout < 0 {
+		return fmt.Errorf("opa authorizer: timeout cannot be negative")
+	}
+
+	if err := c.config().Validate(); err != nil {
+		return fmt.Errorf("opa authorizer: %w", err)
+	}
+
+	return nil
+}
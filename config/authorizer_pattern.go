@@ -0,0 +1,116 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+	"github.com/sagikazarmark/registry-auth/auth/authz"
+)
+
+func init() {
+	RegisterAuthorizerFactory("pattern", func() AuthorizerFactory { return patternAuthorizer{} })
+}
+
+// patternAuthorizer grants repository actions based on rules matching repository names and usernames
+// against glob patterns or regular expressions.
+//
+// Access is denied if no rule matches.
+type patternAuthorizer struct {
+	AllowAnonymous bool `mapstructure:"allowAnonymous"`
+
+	// Precedence selects the rule applied when multiple rules match (first-match or most-specific, defaults to first-match).
+	Precedence string        `mapstructure:"precedence"`
+	Rules      []patternRule `mapstructure:"rules"`
+}
+
+type patternRule struct {
+	Name string `mapstructure:"name"`
+
+	// Either Repository (glob) or RepositoryRegexp is required.
+	Repository       string `mapstructure:"repository"`
+	RepositoryRegexp string `mapstructure:"repositoryRegexp"`
+
+	// Subject (glob) or SubjectRegexp restrict the rule to matching usernames (optional).
+	Subject       string `mapstructure:"subject"`
+	SubjectRegexp string `mapstructure:"subjectRegexp"`
+
+	Actions []string `mapstructure:"actions"`
+}
+
+func (c patternAuthorizer) New() (auth.Authorizer, error) {
+	rules := make([]authz.PatternRule, 0, len(c.Rules))
+
+	for i, rule := range c.Rules {
+		repository, err := newPattern(rule.Repository, rule.RepositoryRegexp)
+		if err != nil {
+			return nil, fmt.Errorf("pattern authorizer: rules[%d]: repositoryRegexp: %w", i, err)
+		}
+
+		subject, err := newPattern(rule.Subject, rule.SubjectRegexp)
+		if err != nil {
+			return nil, fmt.Errorf("pattern authorizer: rules[%d]: subjectRegexp: %w", i, err)
+		}
+
+		rules = append(rules, authz.PatternRule{
+			Name:       rule.Name,
+			Repository: repository,
+			Subject:    subject,
+			Actions:    rule.Actions,
+		})
+	}
+
+	repositoryAuthorizer, err := authz.NewPatternRepositoryAuthorizer(rules, c.Precedence)
+	if err != nil {
+		return nil, fmt.Errorf("pattern authorizer: %w", err)
+	}
+
+	return authz.NewDefaultAuthorizer(repositoryAuthorizer, c.AllowAnonymous), nil
+}
+
+func newPattern(glob string, re string) (authz.Pattern, error) {
+	if re != "" {
+		return authz.RegexpPattern(re)
+	}
+
+	return authz.GlobPattern(glob), nil
+}
+
+func (c patternAuthorizer) Validate() error {
+	switch c.Precedence {
+	case "", authz.PrecedenceFirstMatch, authz.PrecedenceMostSpecific:
+	default:
+		return fmt.Errorf("pattern authorizer: precedence: unsupported value %q (supported values: %s, %s)", c.Precedence, authz.PrecedenceFirstMatch, authz.PrecedenceMostSpecific)
+	}
+
+	for i, rule := range c.Rules {
+		if (rule.Repository == "") == (rule.RepositoryRegexp == "") {
+			return fmt.Errorf("pattern authorizer: rules[%d]: either repository or repositoryRegexp is required", i)
+		}
+
+		if rule.Subject != "" && rule.SubjectRegexp != "" {
+			return fmt.Errorf("pattern authorizer: rules[%d]: subject and subjectRegexp are mutually exclusive", i)
+		}
+
+		if _, err := newPattern(rule.Repository, rule.RepositoryRegexp); err != nil {
+			return fmt.Errorf("pattern authorizer: rules[%d]: invalid repositoryRegexp: %w", i, err)
+		}
+
+		if _, err := newPattern(rule.Subject, rule.SubjectRegexp); err != nil {
+			return fmt.Errorf("pattern authorizer: rules[%d]: invalid subjectRegexp: %w", i, err)
+		}
+
+		if len(rule.Actions) == 0 {
+			return fmt.Errorf("pattern authorizer: rules[%d]: actions are required", i)
+		}
+
+		for _, action := range rule.Actions {
+			switch action {
+			case "pull", "push", "delete", "*":
+			default:
+				return fmt.Errorf("pattern authorizer: rules[%d]: unsupported action %q (supported actions: pull, push, delete, *)", i, action)
+			}
+		}
+	}
+
+	return nil
+}
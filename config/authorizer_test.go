@@ -0,0 +1,286 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+	"github.com/sagikazarmark/registry-auth/auth/authn"
+	"github.com/sagikazarmark/registry-auth/auth/authz"
+)
+
+func TestAuthorizer_RuleSet(t *testing.T) {
+	const input = `
+type: default
+config:
+  missingAttribute: skip
+  rules:
+    - repository: "{subject}/**"
+      actions: ["*"]
+    - repository: team/**
+      subjectAttributes:
+        group: team
+      actions: [pull, push]
+      missingAttribute: deny
+`
+
+	var config Authorizer
+
+	err := yaml.Unmarshal([]byte(input), &config)
+	require.NoError(t, err)
+
+	ruleSet, ok := config.RuleSet()
+	require.True(t, ok)
+
+	rec := httptest.NewRecorder()
+
+	authz.RuleSetHandler(ruleSet).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/rules", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var actual map[string]any
+
+	err = json.NewDecoder(rec.Body).Decode(&actual)
+	require.NoError(t, err)
+
+	expected := map[string]any{
+		"missingAttribute": "skip",
+		"rules": []any{
+			map[string]any{
+				"repository": "{subject}/**",
+				"actions":    []any{"*"},
+			},
+			map[string]any{
+				"repository":        "team/**",
+				"subjectAttributes": map[string]any{"group": "team"},
+				"actions":           []any{"pull", "push"},
+				"missingAttribute":  "deny",
+			},
+		},
+	}
+
+	assert.Equal(t, expected, actual)
+}
+
+func TestPatternAuthorizer(t *testing.T) {
+	const input = `
+type: pattern
+config:
+  precedence: most-specific
+  rules:
+    - repository: team/**
+      actions: [pull]
+    - repositoryRegexp: team/app(-[a-z]+)?
+      subject: ci-*
+      actions: [pull, push]
+`
+
+	var config Authorizer
+
+	err := yaml.Unmarshal([]byte(input), &config)
+	require.NoError(t, err)
+
+	require.NoError(t, config.Validate())
+
+	authorizer, err := config.New()
+	require.NoError(t, err)
+
+	scopes := []auth.Scope{
+		{
+			Resource: auth.Resource{Type: "repository", Name: "team/app-dev"},
+			Actions:  []string{"pull", "push", "delete"},
+		},
+		{
+			Resource: auth.Resource{Type: "repository", Name: "other/app"},
+			Actions:  []string{"pull"},
+		},
+	}
+
+	granted, err := authorizer.Authorize(context.Background(), authn.User{Username: "ci-build", Enabled: true}, scopes)
+	require.NoError(t, err)
+
+	expected := []auth.Scope{
+		{
+			Resource: auth.Resource{Type: "repository", Name: "team/app-dev"},
+			Actions:  []string{"pull", "push"},
+		},
+	}
+
+	assert.Equal(t, expected, granted)
+}
+
+func TestPatternAuthorizer_Validate(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+	}{
+		{
+			name: "UnsupportedPrecedence",
+			input: `
+precedence: last-match
+`,
+		},
+		{
+			name: "MissingRepository",
+			input: `
+rules:
+  - actions: [pull]
+`,
+		},
+		{
+			name: "RepositoryAndRepositoryRegexp",
+			input: `
+rules:
+  - repository: team/**
+    repositoryRegexp: team/.*
+    actions: [pull]
+`,
+		},
+		{
+			name: "InvalidRegexp",
+			input: `
+rules:
+  - repositoryRegexp: team/(
+    actions: [pull]
+`,
+		},
+		{
+			name: "UnsupportedAction",
+			input: `
+rules:
+  - repository: team/**
+    actions: [pull, tag]
+`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			var rawConfig map[string]any
+
+			err := yaml.Unmarshal([]byte(testCase.input), &rawConfig)
+			require.NoError(t, err)
+
+			var factory patternAuthorizer
+
+			err = decode(rawConfig, &factory)
+			require.NoError(t, err)
+
+			assert.Error(t, factory.Validate())
+		})
+	}
+}
+
+func TestOPAAuthorizer(t *testing.T) {
+	const input = `
+type: opa
+config:
+  decision: data.registry.authz.allow
+  timeout: 100ms
+  policy: |
+    package registry.authz
+
+    import future.keywords.if
+    import future.keywords.in
+
+    allow[scope.resource] := ["pull"] if {
+      some scope in input.scopes
+      input.subject.attributes.group == "team"
+    }
+`
+
+	var config Authorizer
+
+	err := yaml.Unmarshal([]byte(input), &config)
+	require.NoError(t, err)
+
+	require.NoError(t, config.Validate())
+
+	authorizer, err := config.New()
+	require.NoError(t, err)
+
+	scopes := []auth.Scope{
+		{
+			Resource: auth.Resource{Type: "repository", Name: "team/app"},
+			Actions:  []string{"pull", "push"},
+		},
+	}
+
+	granted, err := authorizer.Authorize(context.Background(), authn.User{Username: "user", Enabled: true, Attrs: map[string]string{"group": "team"}}, scopes)
+	require.NoError(t, err)
+
+	expected := []auth.Scope{
+		{
+			Resource: auth.Resource{Type: "repository", Name: "team/app"},
+			Actions:  []string{"pull"},
+		},
+	}
+
+	assert.Equal(t, expected, granted)
+
+	t.Run("UndefinedDecision", func(t *testing.T) {
+		config := opaAuthorizer{
+			Policy:   "package registry.authz\n\ndeny := true\n",
+			Decision: "data.registry.authz.allow",
+		}
+
+		assert.Error(t, config.Validate())
+	})
+}
+
+func TestAuthorizer_CircuitBreaker(t *testing.T) {
+	const input = `
+type: opa
+config:
+  decision: data.registry.authz.allow
+  policy: |
+    package registry.authz
+
+    allow := {}
+circuitBreaker:
+  threshold: 3
+  cooldown: 1m
+  policy: failOpen
+`
+
+	var config Authorizer
+
+	err := yaml.Unmarshal([]byte(input), &config)
+	require.NoError(t, err)
+
+	require.NoError(t, config.Validate())
+
+	assert.Equal(t, CircuitBreaker{Threshold: 3, Cooldown: time.Minute, Policy: "failOpen"}, config.CircuitBreaker)
+
+	authorizer, err := config.New()
+	require.NoError(t, err)
+
+	assert.IsType(t, &authz.CircuitBreakerAuthorizer{}, authorizer)
+
+	t.Run("Invalid", func(t *testing.T) {
+		testCases := []CircuitBreaker{
+			{Threshold: -1},
+			{Threshold: 1, Cooldown: -time.Second},
+			{Threshold: 1, Policy: "failSometimes"},
+			{Threshold: 1, FailOpenActions: []string{"pull"}},
+		}
+
+		for _, testCase := range testCases {
+			testCase := testCase
+
+			t.Run("", func(t *testing.T) {
+				assert.Error(t, testCase.Validate())
+			})
+		}
+	})
+}
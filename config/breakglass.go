@@ -0,0 +1,68 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/sagikazarmark/registry-auth/auth/authn"
+)
+
+// BreakGlass configures an emergency credential that works even if the password authenticator's backend is down.
+//
+// Every use of the credential is recorded as a high severity audit event (regardless of audit logging being enabled).
+type BreakGlass struct {
+	Enabled      bool   `yaml:"enabled"`
+	Username     string `yaml:"username"`
+	PasswordHash string `yaml:"passwordHash"`
+
+	Groups     []string          `yaml:"groups"`
+	Attributes map[string]string `yaml:"attributes"`
+
+	// NotAfter limits the validity of the credential (optional).
+	NotAfter time.Time `yaml:"notAfter"`
+}
+
+// Validate validates the configuration.
+func (c BreakGlass) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if c.Username == "" {
+		return fmt.Errorf("username is required")
+	}
+
+	if c.PasswordHash == "" {
+		return fmt.Errorf("password hash is required")
+	}
+
+	if err := authn.CheckPasswordHash(c.PasswordHash); err != nil {
+		return fmt.Errorf("password hash: %w", err)
+	}
+
+	return nil
+}
+
+// User returns the break-glass user.
+func (c BreakGlass) User() authn.User {
+	return authn.User{
+		Enabled:      true,
+		Username:     c.Username,
+		PasswordHash: c.PasswordHash,
+		Groups:       slices.Clone(c.Groups),
+		Attrs:        maps.Clone(c.Attributes),
+	}
+}
+
+// AuthenticatorOptions returns options for an [authn.BreakGlassAuthenticator].
+func (c BreakGlass) AuthenticatorOptions() []authn.BreakGlassAuthenticatorOption {
+	var opts []authn.BreakGlassAuthenticatorOption
+
+	if !c.NotAfter.IsZero() {
+		opts = append(opts, authn.WithNotAfter(c.NotAfter))
+	}
+
+	return opts
+}
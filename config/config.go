@@ -5,9 +5,19 @@ import "fmt"
 // Config collects all configuration options.
 type Config struct {
 	PasswordAuthenticator PasswordAuthenticator `yaml:"passwordAuthenticator"`
+	BreakGlass            BreakGlass            `yaml:"breakGlass"`
+	OIDC                  OIDC                  `yaml:"oidc"`
+	SubjectEnrichment     SubjectEnrichment     `yaml:"subjectEnrichment"`
+	HTTPClient            HTTPClient            `yaml:"httpClient"`
 	AccessTokenIssuer     AccessTokenIssuer     `yaml:"accessTokenIssuer"`
+	AnonymousTokenCache   AnonymousTokenCache   `yaml:"anonymousTokenCache"`
 	RefreshTokenIssuer    RefreshTokenIssuer    `yaml:"refreshTokenIssuer"`
+	RefreshToken          RefreshToken          `yaml:"refreshToken"`
 	Authorizer            Authorizer            `yaml:"authorizer"`
+	Server                Server                `yaml:"server"`
+	Logging               Logging               `yaml:"logging"`
+	Audit                 Audit                 `yaml:"audit"`
+	Metrics               Metrics               `yaml:"metrics"`
 }
 
 // Validate validates the configuration.
@@ -16,21 +26,82 @@ func (c Config) Validate() error {
 		return fmt.Errorf("password authenticator: %w", err)
 	}
 
+	if err := c.BreakGlass.Validate(); err != nil {
+		return fmt.Errorf("break glass: %w", err)
+	}
+
+	if err := c.OIDC.Validate(); err != nil {
+		return fmt.Errorf("oidc: %w", err)
+	}
+
+	if err := c.SubjectEnrichment.Validate(); err != nil {
+		return fmt.Errorf("subject enrichment: %w", err)
+	}
+
+	if err := c.HTTPClient.Validate(); err != nil {
+		return fmt.Errorf("http client: %w", err)
+	}
+
 	if err := c.AccessTokenIssuer.Validate(); err != nil {
 		return fmt.Errorf("access token issuer: %w", err)
 	}
 
+	if err := c.AnonymousTokenCache.Validate(); err != nil {
+		return fmt.Errorf("anonymous token cache: %w", err)
+	}
+
 	if err := c.RefreshTokenIssuer.Validate(); err != nil {
 		return fmt.Errorf("refresh token issuer: %w", err)
 	}
 
+	if err := c.RefreshToken.Validate(); err != nil {
+		return fmt.Errorf("refresh token: %w", err)
+	}
+
 	if err := c.Authorizer.Validate(); err != nil {
 		return fmt.Errorf("authorizer: %w", err)
 	}
 
+	if err := c.Server.Validate(); err != nil {
+		return fmt.Errorf("server: %w", err)
+	}
+
+	if err := c.Logging.Validate(); err != nil {
+		return fmt.Errorf("logging: %w", err)
+	}
+
+	if err := c.Audit.Validate(); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+
+	if err := c.Metrics.Validate(); err != nil {
+		return fmt.Errorf("metrics: %w", err)
+	}
+
 	return nil
 }
 
+// Warner is implemented by configuration (eg. factories) that is valid, but likely contains a mistake.
+type Warner interface {
+	// Warnings describes the likely mistakes.
+	Warnings() []string
+}
+
+// Warnings returns likely mistakes in the configuration that do not make it invalid (eg. conflicting duplicate users).
+//
+// Call it after Validate.
+func (c Config) Warnings() []string {
+	var warnings []string
+
+	if warner, ok := c.PasswordAuthenticator.PasswordAuthenticatorFactory.(Warner); ok {
+		for _, warning := range warner.Warnings() {
+			warnings = append(warnings, "password authenticator: "+warning)
+		}
+	}
+
+	return warnings
+}
+
 // rawConfig is a general struct to be used by other config structs to unmarshal yaml config first.
 type rawConfig struct {
 	Type   string                 `yaml:"type"`
@@ -35,6 +35,9 @@ func TestComplete(t *testing.T) {
 						Enabled:      true,
 						Username:     "user",
 						PasswordHash: "$2a$12$vox7h99HV.gzbZGeBj69jeJVgkkP2nHTndG9USjp..00.WtIqvSpa",
+						Email:        "user@example.com",
+						DisplayName:  "User",
+						Groups:       []string{"admin"},
 						Attrs: map[string]string{
 							"group": "admin",
 						},
@@ -45,19 +48,34 @@ func TestComplete(t *testing.T) {
 		AccessTokenIssuer: AccessTokenIssuer{
 			AccessTokenIssuerFactory: jwtAccessTokenIssuer{
 				Issuer:         "localhost:8080",
-				PrivateKeyFile: "private_key.pem",
+				PrivateKeyFile: "../private_key.pem",
 				Expiration:     15 * time.Minute,
 			},
 		},
 		RefreshTokenIssuer: RefreshTokenIssuer{
 			RefreshTokenIssuerFactory: jwtRefreshTokenIssuer{
 				Issuer:         "localhost:8080",
-				PrivateKeyFile: "private_key.pem",
+				PrivateKeyFile: "../private_key.pem",
+				Expiration:     168 * time.Hour,
 			},
 		},
+		RefreshToken: RefreshToken{
+			MaxLifetime: 720 * time.Hour,
+		},
 		Authorizer: Authorizer{
 			AuthorizerFactory: defaultAuthorizer{
 				AllowAnonymous: true,
+				ResourceTypeFilters: []resourceTypeFilter{
+					{
+						Service: "tenant.example.com",
+						Deny:    []string{"registry"},
+					},
+				},
+			},
+		},
+		Server: Server{
+			ResourceActions: map[string][]string{
+				"registry": {"*", "search"},
 			},
 		},
 	}
@@ -1,6 +1,12 @@
 package config
 
-import "github.com/mitchellh/mapstructure"
+import (
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
 
 func decode(input interface{}, output interface{}) error {
 	config := &mapstructure.DecoderConfig{
@@ -8,6 +14,8 @@ func decode(input interface{}, output interface{}) error {
 		Result:   output,
 		DecodeHook: mapstructure.ComposeDecodeHookFunc(
 			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToTimeHookFunc(time.RFC3339),
+			stringToScalarHookFunc(),
 		),
 	}
 
@@ -18,3 +26,32 @@ func decode(input interface{}, output interface{}) error {
 
 	return decoder.Decode(input)
 }
+
+// stringToScalarHookFunc converts strings to numbers and booleans.
+//
+// Expanded environment variable references are strings in factory configs (see Load).
+func stringToScalarHookFunc() mapstructure.DecodeHookFuncKind {
+	return func(from reflect.Kind, to reflect.Kind, data interface{}) (interface{}, error) {
+		if from != reflect.String {
+			return data, nil
+		}
+
+		s := data.(string)
+
+		switch to {
+		case reflect.Bool:
+			return strconv.ParseBool(s)
+
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return strconv.ParseInt(s, 0, 64)
+
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return strconv.ParseUint(s, 0, 64)
+
+		case reflect.Float32, reflect.Float64:
+			return strconv.ParseFloat(s, 64)
+		}
+
+		return data, nil
+	}
+}
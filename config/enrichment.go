@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sagikazarmark/registry-auth/auth/authn"
+)
+
+// Subject enrichment failure policies.
+const (
+	enrichmentFailClosed = "closed"
+	enrichmentFailOpen   = "open"
+)
+
+// SubjectEnrichment configures looking up additional attributes (eg. roles) of authenticated subjects from an HTTP service.
+type SubjectEnrichment struct {
+	Enabled bool   `yaml:"enabled"`
+	URL     string `yaml:"url"`
+
+	// CacheTTL is how long looked up attributes are cached for (zero disables caching).
+	CacheTTL time.Duration `yaml:"cacheTTL"`
+
+	// FailurePolicy is either "closed" (default, authentication fails if the lookup fails)
+	// or "open" (subjects are authenticated without additional attributes).
+	FailurePolicy string `yaml:"failurePolicy"`
+}
+
+// Validate validates the configuration.
+func (c SubjectEnrichment) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	switch c.FailurePolicy {
+	case "", enrichmentFailClosed, enrichmentFailOpen:
+	default:
+		return fmt.Errorf("unsupported failurePolicy %q (must be %q or %q)", c.FailurePolicy, enrichmentFailClosed, enrichmentFailOpen)
+	}
+
+	return c.enricherConfig().Validate()
+}
+
+// NewEnricher returns a new [authn.HTTPSubjectEnricher] calling the lookup endpoint using client (see [HTTPClient]).
+func (c SubjectEnrichment) NewEnricher(client *http.Client) authn.HTTPSubjectEnricher {
+	config := c.enricherConfig()
+	config.HTTPClient = client
+
+	return authn.NewHTTPSubjectEnricher(config)
+}
+
+func (c SubjectEnrichment) enricherConfig() authn.HTTPSubjectEnricherConfig {
+	return authn.HTTPSubjectEnricherConfig{
+		URL:      c.URL,
+		CacheTTL: c.CacheTTL,
+		FailOpen: c.FailurePolicy == enrichmentFailOpen,
+	}
+}
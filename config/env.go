@@ -0,0 +1,211 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envReference matches ${VAR} references (and $${VAR} escapes) in configuration values.
+//
+// Bare $VAR references are not supported: they would clash with values like bcrypt hashes ($2a$12$...).
+var envReference = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Load decodes a YAML configuration from r.
+//
+// String values may reference environment variables as ${VAR} (eg. bindPassword: ${REGISTRY_AUTH_LDAP_PASSWORD}),
+// so that secrets do not have to be stored in the configuration file.
+// References are expanded in every value (including factory configs) before decoding.
+// Referencing a variable that is not set is an error; $${VAR} results in a literal ${VAR}.
+//
+// Expanded values are strings, unless the option they are assigned to is a number or a boolean
+// (eg. maxActionsPerScope: ${MAX_ACTIONS}), so that a password like 123456 or null stays a string.
+func Load(r io.Reader) (Config, error) {
+	var node yaml.Node
+
+	if err := yaml.NewDecoder(r).Decode(&node); err != nil {
+		if errors.Is(err, io.EOF) {
+			return Config{}, nil
+		}
+
+		return Config{}, err
+	}
+
+	if err := expandEnvNode(&node, reflect.TypeOf(Config{})); err != nil {
+		return Config{}, err
+	}
+
+	var config Config
+
+	if err := node.Decode(&config); err != nil {
+		return Config{}, err
+	}
+
+	return config, nil
+}
+
+// expandEnvNode expands environment variable references in scalar values of a YAML document
+// decoded into a value of type typ.
+//
+// typ is nil if the type of the value is not known (eg. factory configs decoded into maps before being decoded into their actual type):
+// expanded values are kept as strings in that case and converted by the decoder (see decode).
+func expandEnvNode(node *yaml.Node, typ reflect.Type) error {
+	for typ != nil && typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	// Custom unmarshalers decode values in their own way
+	if typ != nil && reflect.PointerTo(typ).Implements(yamlUnmarshalerType) {
+		typ = nil
+	}
+
+	switch node.Kind {
+	case yaml.ScalarNode:
+		expanded, err := expandEnv(node.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+
+		if expanded != node.Value && node.Style&yaml.TaggedStyle == 0 {
+			if isScalarKind(typ) {
+				// Resolve the type of the expanded value (eg. ${MAX_ACTIONS} becomes an int)
+				node.Tag = ""
+			} else {
+				node.Tag = "!!str"
+			}
+		}
+
+		node.Value = expanded
+
+	case yaml.MappingNode:
+		// Keys are not expanded
+		for i := 1; i < len(node.Content); i += 2 {
+			if err := expandEnvNode(node.Content[i], fieldType(typ, node.Content[i-1].Value)); err != nil {
+				return err
+			}
+		}
+
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			if err := expandEnvNode(child, typ); err != nil {
+				return err
+			}
+		}
+
+	case yaml.SequenceNode:
+		var elemType reflect.Type
+
+		if typ != nil && (typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array) {
+			elemType = typ.Elem()
+		}
+
+		for _, child := range node.Content {
+			if err := expandEnvNode(child, elemType); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+var yamlUnmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+
+// fieldType returns the type of the value under key in a mapping decoded into typ (nil if unknown).
+func fieldType(typ reflect.Type, key string) reflect.Type {
+	if typ == nil {
+		return nil
+	}
+
+	switch typ.Kind() {
+	case reflect.Map:
+		return typ.Elem()
+
+	case reflect.Struct:
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+
+			name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+
+			if name == key {
+				return field.Type
+			}
+		}
+	}
+
+	return nil
+}
+
+// isScalarKind reports whether typ is a number or a boolean.
+func isScalarKind(typ reflect.Type) bool {
+	if typ == nil {
+		return false
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+
+	return false
+}
+
+// expandEnv expands ${VAR} references in s.
+func expandEnv(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var missing []string
+
+	expanded := envReference.ReplaceAllStringFunc(s, func(ref string) string {
+		if strings.HasPrefix(ref, "$$") {
+			return ref[1:]
+		}
+
+		name := envReference.FindStringSubmatch(ref)[1]
+
+		value, ok := lookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+
+		return value
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("undefined environment variables: %v", missing)
+	}
+
+	return expanded, nil
+}
+
+// lookupEnv looks up a variable referenced in the configuration.
+//
+// HOSTNAME falls back to the host name reported by the kernel if it is not set in the environment.
+func lookupEnv(name string) (string, bool) {
+	if value, ok := os.LookupEnv(name); ok {
+		return value, true
+	}
+
+	if name == "HOSTNAME" {
+		hostname, err := os.Hostname()
+		if err == nil {
+			return hostname, true
+		}
+	}
+
+	return "", false
+}
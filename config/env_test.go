@@ -0,0 +1,117 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	t.Setenv("REGISTRY_AUTH_TEST_PASSWORD", "s3cr3t")
+	t.Setenv("REGISTRY_AUTH_TEST_MAX_ACTIONS", "3")
+	t.Setenv("REGISTRY_AUTH_TEST_EXPIRATION", "10m")
+
+	input := `
+passwordAuthenticator:
+  type: user
+  config:
+    entries:
+      - username: user
+        enabled: true
+        passwordHash: $2a$12$vox7h99HV.gzbZGeBj69jeJVgkkP2nHTndG9USjp..00.WtIqvSpa
+        attributes:
+          password: ${REGISTRY_AUTH_TEST_PASSWORD}
+          literal: $${REGISTRY_AUTH_TEST_PASSWORD}
+          quoted: "${REGISTRY_AUTH_TEST_MAX_ACTIONS}"
+
+server:
+  maxActionsPerScope: ${REGISTRY_AUTH_TEST_MAX_ACTIONS}
+
+accessTokenIssuer:
+  type: jwt
+  config:
+    issuer: issuer.example.com
+    privateKeyFile: private_key.pem
+    expiration: ${REGISTRY_AUTH_TEST_EXPIRATION}
+`
+
+	config, err := Load(strings.NewReader(input))
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, config.Server.MaxActionsPerScope)
+
+	users := config.PasswordAuthenticator.PasswordAuthenticatorFactory.(userAuthenticator)
+
+	assert.Equal(t, "$2a$12$vox7h99HV.gzbZGeBj69jeJVgkkP2nHTndG9USjp..00.WtIqvSpa", users.Entries[0].PasswordHash)
+	assert.Equal(t, "s3cr3t", users.Entries[0].Attrs["password"])
+	assert.Equal(t, "${REGISTRY_AUTH_TEST_PASSWORD}", users.Entries[0].Attrs["literal"])
+	assert.Equal(t, "3", users.Entries[0].Attrs["quoted"])
+
+	assert.Equal(t, 10*time.Minute, config.AccessTokenIssuer.AccessTokenIssuerFactory.(jwtAccessTokenIssuer).Expiration)
+}
+
+func TestLoad_UndefinedVariable(t *testing.T) {
+	input := `
+passwordAuthenticator:
+  type: ldap
+  config:
+    bindPassword: ${REGISTRY_AUTH_TEST_UNDEFINED}
+`
+
+	_, err := Load(strings.NewReader(input))
+	require.Error(t, err)
+
+	assert.Contains(t, err.Error(), "line 5")
+	assert.Contains(t, err.Error(), "REGISTRY_AUTH_TEST_UNDEFINED")
+}
+
+func TestLoad_Types(t *testing.T) {
+	t.Setenv("REGISTRY_AUTH_TEST_PASSWORD", "123456")
+	t.Setenv("REGISTRY_AUTH_TEST_NULL", "null")
+	t.Setenv("REGISTRY_AUTH_TEST_TILDE", "~")
+	t.Setenv("REGISTRY_AUTH_TEST_START_TLS", "true")
+	t.Setenv("REGISTRY_AUTH_TEST_MAX_OPEN_CONNS", "10")
+
+	input := `
+passwordAuthenticator:
+  type: ldap
+  config:
+    url: ldap://ldap.example.com
+    startTLS: ${REGISTRY_AUTH_TEST_START_TLS}
+    bindDN: ${REGISTRY_AUTH_TEST_NULL}
+    bindPassword: ${REGISTRY_AUTH_TEST_PASSWORD}
+    baseDN: ${REGISTRY_AUTH_TEST_TILDE}
+
+server:
+  introspection:
+    subjectAttributes:
+      password: ${REGISTRY_AUTH_TEST_PASSWORD}
+`
+
+	config, err := Load(strings.NewReader(input))
+	require.NoError(t, err)
+
+	ldap := config.PasswordAuthenticator.PasswordAuthenticatorFactory.(ldapAuthenticator)
+
+	assert.True(t, ldap.StartTLS)
+	assert.Equal(t, "null", ldap.BindDN)
+	assert.Equal(t, "123456", ldap.BindPassword)
+	assert.Equal(t, "~", ldap.BaseDN)
+
+	assert.Equal(t, "123456", config.Server.Introspection.SubjectAttributes["password"])
+
+	input = `
+passwordAuthenticator:
+  type: sql
+  config:
+    maxOpenConns: ${REGISTRY_AUTH_TEST_MAX_OPEN_CONNS}
+`
+
+	config, err = Load(strings.NewReader(input))
+	require.NoError(t, err)
+
+	assert.Equal(t, 10, config.PasswordAuthenticator.PasswordAuthenticatorFactory.(sqlAuthenticator).MaxOpenConns)
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// defaultHTTPClientTimeout limits the time a single outgoing request may take if not configured otherwise.
+const defaultHTTPClientTimeout = 10 * time.Second
+
+// HTTPClient configures the HTTP client shared by remote callouts (eg. fetching OIDC signing keys and subject enrichment),
+// so that they reuse connections instead of each using their own default client.
+type HTTPClient struct {
+	// Timeout limits the time a single request may take, including reading the response (10 seconds by default).
+	Timeout time.Duration `yaml:"timeout"`
+
+	// MaxIdleConns limits the number of idle (keep-alive) connections across all hosts (100 by default).
+	MaxIdleConns int `yaml:"maxIdleConns"`
+
+	// MaxIdleConnsPerHost limits the number of idle (keep-alive) connections per host (2 by default).
+	MaxIdleConnsPerHost int `yaml:"maxIdleConnsPerHost"`
+
+	// IdleConnTimeout is how long idle connections are kept open (90 seconds by default).
+	IdleConnTimeout time.Duration `yaml:"idleConnTimeout"`
+
+	// Proxy is the URL of a proxy server requests are sent through.
+	// By default, the proxy is configured using the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+	Proxy string `yaml:"proxy"`
+}
+
+// Validate validates the configuration.
+func (c HTTPClient) Validate() error {
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout cannot be negative")
+	}
+
+	if c.MaxIdleConns < 0 {
+		return fmt.Errorf("maxIdleConns cannot be negative")
+	}
+
+	if c.MaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("maxIdleConnsPerHost cannot be negative")
+	}
+
+	if c.IdleConnTimeout < 0 {
+		return fmt.Errorf("idleConnTimeout cannot be negative")
+	}
+
+	if c.Proxy != "" {
+		if _, err := c.proxyURL(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// New returns a new [http.Client].
+//
+// Create it once and share it between callouts, so that they share the connection pool as well.
+func (c HTTPClient) New() (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if c.MaxIdleConns > 0 {
+		transport.MaxIdleConns = c.MaxIdleConns
+	}
+
+	if c.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+	}
+
+	if c.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = c.IdleConnTimeout
+	}
+
+	if c.Proxy != "" {
+		proxyURL, err := c.proxyURL()
+		if err != nil {
+			return nil, err
+		}
+
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = defaultHTTPClientTimeout
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}, nil
+}
+
+func (c HTTPClient) proxyURL() (*url.URL, error) {
+	u, err := url.Parse(c.Proxy)
+	if err != nil {
+		return nil, fmt.Errorf("proxy: %w", err)
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5":
+
+	default:
+		return nil, fmt.Errorf("proxy: unsupported scheme %q (must be http, https or socks5)", u.Scheme)
+	}
+
+	return u, nil
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sagikazarmark/registry-auth/auth/authn"
+)
+
+func TestHTTPClient_Timeout(t *testing.T) {
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	client, err := HTTPClient{Timeout: 50 * time.Millisecond}.New()
+	require.NoError(t, err)
+
+	assert.Equal(t, 50*time.Millisecond, client.Timeout)
+
+	enrichment := SubjectEnrichment{
+		Enabled: true,
+		URL:     server.URL + "/lookup",
+	}
+
+	require.NoError(t, enrichment.Validate())
+
+	enricher := enrichment.NewEnricher(client)
+
+	_, err = enricher.EnrichSubject(context.Background(), authn.User{Username: "user"})
+	require.Error(t, err)
+
+	var netErr net.Error
+
+	require.True(t, errors.As(err, &netErr), "callout should fail with a network error")
+	assert.True(t, netErr.Timeout(), "callout should time out")
+}
+
+func TestHTTPClient_New(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		client, err := HTTPClient{}.New()
+		require.NoError(t, err)
+
+		assert.Equal(t, defaultHTTPClientTimeout, client.Timeout)
+	})
+
+	t.Run("Transport", func(t *testing.T) {
+		client, err := HTTPClient{
+			MaxIdleConns:        10,
+			MaxIdleConnsPerHost: 5,
+			IdleConnTimeout:     time.Minute,
+			Proxy:               "http://proxy.example.com:3128",
+		}.New()
+		require.NoError(t, err)
+
+		require.IsType(t, &http.Transport{}, client.Transport)
+
+		transport := client.Transport.(*http.Transport)
+
+		assert.Equal(t, 10, transport.MaxIdleConns)
+		assert.Equal(t, 5, transport.MaxIdleConnsPerHost)
+		assert.Equal(t, time.Minute, transport.IdleConnTimeout)
+
+		proxyURL, err := transport.Proxy(httptest.NewRequest(http.MethodGet, "https://idp.example.com/jwks", nil))
+		require.NoError(t, err)
+
+		assert.Equal(t, "http://proxy.example.com:3128", proxyURL.String())
+	})
+}
+
+func TestHTTPClient_Validate(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config HTTPClient
+	}{
+		{
+			name:   "NegativeTimeout",
+			config: HTTPClient{Timeout: -time.Second},
+		},
+		{
+			name:   "NegativeMaxIdleConns",
+			config: HTTPClient{MaxIdleConns: -1},
+		},
+		{
+			name:   "NegativeMaxIdleConnsPerHost",
+			config: HTTPClient{MaxIdleConnsPerHost: -1},
+		},
+		{
+			name:   "NegativeIdleConnTimeout",
+			config: HTTPClient{IdleConnTimeout: -time.Second},
+		},
+		{
+			name:   "UnsupportedProxyScheme",
+			config: HTTPClient{Proxy: "ftp://proxy.example.com"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Error(t, testCase.config.Validate())
+		})
+	}
+}
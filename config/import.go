@@ -0,0 +1,205 @@
+package config
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Supported ImportUsers formats.
+const (
+	ImportFormatCSV  = "csv"
+	ImportFormatJSON = "json"
+)
+
+// ImportedUser is a user record read by ImportUsers.
+//
+// Either Password (plain text) or PasswordHash (bcrypt) must be set.
+type ImportedUser struct {
+	Username     string            `json:"username"`
+	Password     string            `json:"password"`
+	PasswordHash string            `json:"passwordHash"`
+	Enabled      *bool             `json:"enabled"`
+	Attributes   map[string]string `json:"attributes"`
+}
+
+// ImportUsers reads users from r and writes a passwordAuthenticator configuration snippet (for the "user" authenticator) to w.
+// Plain text passwords are checked against policy and hashed using bcrypt with the given cost.
+// Existing hashes are imported as is.
+//
+// Users are processed one by one, so large inputs are never fully loaded into memory.
+//
+// CSV input must have a header row. The username, password, passwordHash and enabled columns are recognized,
+// every other column becomes an attribute.
+// JSON input is a list of ImportedUser objects.
+func ImportUsers(w io.Writer, r io.Reader, format string, cost int, policy PasswordPolicy) error {
+	_, err := io.WriteString(w, "passwordAuthenticator:\n  type: user\n  config:\n    entries:\n")
+	if err != nil {
+		return err
+	}
+
+	write := func(u ImportedUser) error {
+		entry, err := u.entry(cost, policy)
+		if err != nil {
+			return err
+		}
+
+		out, err := yaml.Marshal([]importedEntry{entry})
+		if err != nil {
+			return err
+		}
+
+		for _, line := range strings.Split(strings.TrimSuffix(string(out), "\n"), "\n") {
+			if _, err := io.WriteString(w, "      "+line+"\n"); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	switch format {
+	case ImportFormatCSV:
+		return importCSVUsers(r, write)
+	case ImportFormatJSON:
+		return importJSONUsers(r, write)
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+type importedEntry struct {
+	Username     string            `yaml:"username"`
+	Enabled      bool              `yaml:"enabled"`
+	PasswordHash string            `yaml:"passwordHash"`
+	Attributes   map[string]string `yaml:"attributes,omitempty"`
+}
+
+func (u ImportedUser) entry(cost int, policy PasswordPolicy) (importedEntry, error) {
+	if u.Username == "" {
+		return importedEntry{}, errors.New("username is required")
+	}
+
+	passwordHash := u.PasswordHash
+
+	if passwordHash == "" {
+		if u.Password == "" {
+			return importedEntry{}, fmt.Errorf("user %q: either password or passwordHash is required", u.Username)
+		}
+
+		hash, err := HashPassword(u.Password, cost, policy)
+		if err != nil {
+			return importedEntry{}, fmt.Errorf("user %q: hashing password: %w", u.Username, err)
+		}
+
+		passwordHash = hash
+	}
+
+	enabled := true
+	if u.Enabled != nil {
+		enabled = *u.Enabled
+	}
+
+	return importedEntry{
+		Username:     u.Username,
+		Enabled:      enabled,
+		PasswordHash: passwordHash,
+		Attributes:   u.Attributes,
+	}, nil
+}
+
+func importCSVUsers(r io.Reader, fn func(u ImportedUser) error) error {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("reading header: %w", err)
+	}
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var u ImportedUser
+
+		for i, column := range header {
+			value := record[i]
+
+			switch column {
+			case "username":
+				u.Username = value
+			case "password":
+				u.Password = value
+			case "passwordHash":
+				u.PasswordHash = value
+			case "enabled":
+				if value == "" {
+					continue
+				}
+
+				enabled, err := strconv.ParseBool(value)
+				if err != nil {
+					return fmt.Errorf("line %d: invalid enabled value: %w", line, err)
+				}
+
+				u.Enabled = &enabled
+			default:
+				if value == "" {
+					continue
+				}
+
+				if u.Attributes == nil {
+					u.Attributes = map[string]string{}
+				}
+
+				u.Attributes[column] = value
+			}
+		}
+
+		if err := fn(u); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+}
+
+func importJSONUsers(r io.Reader, fn func(u ImportedUser) error) error {
+	decoder := json.NewDecoder(r)
+
+	// Decode the list element by element
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	if token != json.Delim('[') {
+		return errors.New("input must be a list of users")
+	}
+
+	for i := 0; decoder.More(); i++ {
+		var u ImportedUser
+
+		if err := decoder.Decode(&u); err != nil {
+			return fmt.Errorf("user[%d]: %w", i, err)
+		}
+
+		if err := fn(u); err != nil {
+			return fmt.Errorf("user[%d]: %w", i, err)
+		}
+	}
+
+	_, err = decoder.Token()
+
+	return err
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+func TestImportUsers(t *testing.T) {
+	testCases := []struct {
+		name   string
+		format string
+		input  string
+	}{
+		{
+			name:   "CSV",
+			format: ImportFormatCSV,
+			input: `username,password,enabled,group
+alice,secret,true,admin
+bob,hunter2,,
+carol,password,false,dev
+`,
+		},
+		{
+			name:   "JSON",
+			format: ImportFormatJSON,
+			input: `[
+	{"username": "alice", "password": "secret", "attributes": {"group": "admin"}},
+	{"username": "bob", "password": "hunter2"},
+	{"username": "carol", "password": "password", "enabled": false, "attributes": {"group": "dev"}}
+]`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			err := ImportUsers(&buf, strings.NewReader(testCase.input), testCase.format, bcrypt.MinCost, PasswordPolicy{})
+			require.NoError(t, err)
+
+			var config Config
+
+			err = yaml.Unmarshal(buf.Bytes(), &config)
+			require.NoError(t, err)
+
+			err = config.PasswordAuthenticator.Validate()
+			require.NoError(t, err)
+
+			authenticator, err := config.PasswordAuthenticator.New()
+			require.NoError(t, err)
+
+			subject, err := authenticator.AuthenticatePassword(context.Background(), "alice", "secret")
+			require.NoError(t, err)
+
+			group, _ := subject.Attribute("group")
+			assert.Equal(t, "admin", group)
+
+			_, err = authenticator.AuthenticatePassword(context.Background(), "bob", "hunter2")
+			require.NoError(t, err)
+
+			_, err = authenticator.AuthenticatePassword(context.Background(), "bob", "wrong")
+			require.Error(t, err)
+
+			// carol is disabled
+			_, err = authenticator.AuthenticatePassword(context.Background(), "carol", "password")
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestImportUsers_MissingPassword(t *testing.T) {
+	var buf bytes.Buffer
+
+	err := ImportUsers(&buf, strings.NewReader("username,password\nalice,\n"), ImportFormatCSV, bcrypt.MinCost, PasswordPolicy{})
+	require.Error(t, err)
+}
+
+func TestImportUsers_PasswordPolicy(t *testing.T) {
+	policy := PasswordPolicy{
+		MinLength:           12,
+		MinCharacterClasses: 3,
+	}
+
+	var buf bytes.Buffer
+
+	err := ImportUsers(&buf, strings.NewReader("username,password\nalice,Correct-Horse-42\n"), ImportFormatCSV, bcrypt.MinCost, policy)
+	require.NoError(t, err)
+
+	err = ImportUsers(&buf, strings.NewReader("username,password\nbob,hunter2\n"), ImportFormatCSV, bcrypt.MinCost, policy)
+	require.Error(t, err)
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"os"
+)
+
+// Logging configures what information appears in logs.
+type Logging struct {
+	// HashSubjectIDs replaces subject identifiers in logs with a salted SHA-256 hash.
+	// Audit events always contain the real value.
+	HashSubjectIDs bool `yaml:"hashSubjectIDs"`
+
+	// SubjectHashSalt is the salt used for hashing subject identifiers.
+	SubjectHashSalt string `yaml:"subjectHashSalt"`
+
+	// Usernames includes the username presented by clients in logs (even if authentication fails).
+	// Passwords and tokens are never logged.
+	Usernames bool `yaml:"usernames"`
+}
+
+// Validate validates the configuration.
+func (c Logging) Validate() error {
+	if c.HashSubjectIDs && c.SubjectHashSalt == "" {
+		return fmt.Errorf("subjectHashSalt is required when hashSubjectIDs is enabled")
+	}
+
+	return nil
+}
+
+// Audit configures audit logging.
+type Audit struct {
+	// Enabled records an audit event for every token request.
+	Enabled bool `yaml:"enabled"`
+
+	// SampleRates audits only a fraction (between 0 and 1) of successful requests for the listed actions (eg. pull: 0.1).
+	// Requests for other actions (eg. push) and failed requests are always audited.
+	SampleRates map[string]float64 `yaml:"sampleRates"`
+
+	// TokenFingerprints records a SHA-256 hash of the ID (jti) of issued access tokens in audit events.
+	TokenFingerprints bool `yaml:"tokenFingerprints"`
+
+	// SigningKeyFile contains a key (at least 32 bytes) used for signing audit events with HMAC-SHA256 (optional).
+	// The key should not be used for anything else.
+	SigningKeyFile string `yaml:"signingKeyFile"`
+}
+
+// minAuditSigningKeySize is the minimum size of audit signing keys (the output size of SHA-256).
+const minAuditSigningKeySize = 32
+
+// SigningKey reads the audit signing key from SigningKeyFile.
+// It returns nil if signing is disabled.
+func (c Audit) SigningKey() ([]byte, error) {
+	if c.SigningKeyFile == "" {
+		return nil, nil
+	}
+
+	key, err := os.ReadFile(c.SigningKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading signing key: %w", err)
+	}
+
+	if len(key) < minAuditSigningKeySize {
+		return nil, fmt.Errorf("signing key must be at least %d bytes long", minAuditSigningKeySize)
+	}
+
+	return key, nil
+}
+
+// Validate validates the configuration.
+func (c Audit) Validate() error {
+	for action, rate := range c.SampleRates {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("sampleRates: %s: rate must be between 0 and 1", action)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// defaultMetricsNamespace is the default namespace of Prometheus metrics.
+const defaultMetricsNamespace = "registry_auth"
+
+var metricNamePart = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Metrics configures the Prometheus metrics exposed by the server.
+type Metrics struct {
+	// Namespace is the prefix of metric names (defaults to registry_auth).
+	Namespace string `yaml:"namespace"`
+
+	// Subsystem is appended to Namespace in metric names (optional).
+	Subsystem string `yaml:"subsystem"`
+}
+
+// GetNamespace returns the configured namespace or the default one.
+func (c Metrics) GetNamespace() string {
+	if c.Namespace == "" {
+		return defaultMetricsNamespace
+	}
+
+	return c.Namespace
+}
+
+// Validate validates the configuration.
+func (c Metrics) Validate() error {
+	if c.Namespace != "" && !metricNamePart.MatchString(c.Namespace) {
+		return fmt.Errorf("invalid namespace %q", c.Namespace)
+	}
+
+	if c.Subsystem != "" && !metricNamePart.MatchString(c.Subsystem) {
+		return fmt.Errorf("invalid subsystem %q", c.Subsystem)
+	}
+
+	return nil
+}
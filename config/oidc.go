@@ -0,0 +1,87 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+	"github.com/sagikazarmark/registry-auth/auth/authn"
+)
+
+// OIDC configures authenticating subjects with ID tokens issued by an OpenID Connect provider.
+//
+// Clients present the token in an "Authorization: Bearer" header (GET token endpoint)
+// or in a jwt-bearer grant (OAuth2 token endpoint).
+type OIDC struct {
+	Enabled  bool   `yaml:"enabled"`
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+	JWKSURL  string `yaml:"jwksURL"`
+
+	// SubjectID composes the subject ID from claims (defaults to {sub}).
+	SubjectID string `yaml:"subjectID"`
+
+	// GroupsClaim is the claim listing the groups of the subject (defaults to groups).
+	GroupsClaim string `yaml:"groupsClaim"`
+
+	// RefreshInterval is how often signing keys are refreshed (defaults to 1 hour).
+	RefreshInterval time.Duration `yaml:"refreshInterval"`
+
+	// MaxClockSkew rejects tokens issued more than MaxClockSkew in the future (disabled if zero).
+	// A validly signed token issued in the far future may have been forged using a leaked key.
+	MaxClockSkew time.Duration `yaml:"maxClockSkew"`
+
+	// PasswordFallback authenticates jwt-bearer grants with the username and password of the request
+	// if the ID token is missing or invalid (eg. while migrating clients to token exchange).
+	PasswordFallback bool `yaml:"passwordFallback"`
+}
+
+// Validate validates the configuration.
+func (c OIDC) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	_, err := c.authenticatorConfig()
+
+	return err
+}
+
+// NewAuthenticator returns a new [authn.OIDCAuthenticator] fetching signing keys using client (see [HTTPClient]).
+func (c OIDC) NewAuthenticator(client *http.Client) (authn.OIDCAuthenticator, error) {
+	config, err := c.authenticatorConfig()
+	if err != nil {
+		return authn.OIDCAuthenticator{}, err
+	}
+
+	config.HTTPClient = client
+
+	return authn.NewOIDCAuthenticator(config), nil
+}
+
+func (c OIDC) authenticatorConfig() (authn.OIDCConfig, error) {
+	config := authn.OIDCConfig{
+		Issuer:          c.Issuer,
+		Audience:        c.Audience,
+		JWKSURL:         c.JWKSURL,
+		GroupsClaim:     c.GroupsClaim,
+		RefreshInterval: c.RefreshInterval,
+		MaxClockSkew:    c.MaxClockSkew,
+	}
+
+	if c.SubjectID != "" {
+		template, err := auth.ParseSubjectIDTemplate(c.SubjectID)
+		if err != nil {
+			return authn.OIDCConfig{}, fmt.Errorf("subjectID: %w", err)
+		}
+
+		config.SubjectID = template
+	}
+
+	if err := config.Validate(); err != nil {
+		return authn.OIDCConfig{}, err
+	}
+
+	return config, nil
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordPolicy rejects weak passwords before they are hashed.
+//
+// The zero value accepts every password.
+type PasswordPolicy struct {
+	// MinLength is the minimum number of characters.
+	MinLength int
+
+	// MinCharacterClasses is the minimum number of character classes
+	// (lowercase letters, uppercase letters, digits and other characters) the password must contain.
+	MinCharacterClasses int
+}
+
+// Check returns an error if password does not satisfy the policy.
+func (p PasswordPolicy) Check(password string) error {
+	if length := utf8.RuneCountInString(password); length < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters long (got %d)", p.MinLength, length)
+	}
+
+	if classes := characterClasses(password); classes < p.MinCharacterClasses {
+		return fmt.Errorf("password must contain at least %d character classes (got %d)", p.MinCharacterClasses, classes)
+	}
+
+	return nil
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, other int
+
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+
+	return lower + upper + digit + other
+}
+
+// HashPassword checks password against policy and hashes it using bcrypt with the given cost.
+func HashPassword(password string, cost int, policy PasswordPolicy) (string, error) {
+	err := policy.Check(password)
+	if err != nil {
+		return "", err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordPolicy_Check(t *testing.T) {
+	policy := PasswordPolicy{
+		MinLength:           12,
+		MinCharacterClasses: 3,
+	}
+
+	testCases := []struct {
+		password string
+		valid    bool
+	}{
+		{password: "Correct-Horse-42", valid: true},
+		{password: "correcthorsebattery42", valid: false},
+		{password: "Sh0rt!", valid: false},
+		{password: "", valid: false},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.password, func(t *testing.T) {
+			err := policy.Check(testCase.password)
+
+			if testCase.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 8}
+
+	hash, err := HashPassword("long enough", bcrypt.MinCost, policy)
+	require.NoError(t, err)
+
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(hash), []byte("long enough")))
+
+	_, err = HashPassword("weak", bcrypt.MinCost, policy)
+	require.Error(t, err)
+}
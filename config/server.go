@@ -0,0 +1,483 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"time"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+	"github.com/sagikazarmark/registry-auth/auth/token/jwt"
+)
+
+// Server is the configuration for an [auth.TokenServer].
+type Server struct {
+	// ResourceActions overrides the valid actions for a resource type.
+	// Resource types not listed here use the defaults from [auth.DefaultResourceActions].
+	ResourceActions map[string][]string `yaml:"resourceActions"`
+
+	// MaxActionsPerScope is the maximum number of actions a single requested scope may list (zero means no limit).
+	MaxActionsPerScope int `yaml:"maxActionsPerScope"`
+
+	// MaxScopes is the maximum number of scopes a request may list (zero means no limit).
+	MaxScopes int `yaml:"maxScopes"`
+
+	// MaxAudiences is the maximum number of service parameters a request may list (zero means no limit).
+	MaxAudiences int `yaml:"maxAudiences"`
+
+	// MaxBatchEntries is the maximum number of entries a batch token request may list
+	// (defaults to [auth.DefaultMaxBatchEntries]).
+	MaxBatchEntries int `yaml:"maxBatchEntries"`
+
+	// RegistryHosts are stripped from repository names in requested scopes (eg. registry.example.com/team/app becomes team/app).
+	RegistryHosts []string `yaml:"registryHosts"`
+
+	// DefaultService is used when a token request does not specify a service.
+	DefaultService string `yaml:"defaultService"`
+
+	// MultipleServices controls requests with multiple service parameters:
+	// "reject" (default) rejects them as invalid, "first" uses the first one, "matching" accepts them if they are all the same.
+	MultipleServices string `yaml:"multipleServices"`
+
+	// AnonymousDenial controls the response to denied anonymous requests:
+	// "challenge" (default) responds with 401 and a WWW-Authenticate challenge, "forbidden" responds with 403.
+	AnonymousDenial string `yaml:"anonymousDenial"`
+
+	// CacheControl overrides the Cache-Control header of token responses (no-store by default).
+	CacheControl string `yaml:"cacheControl"`
+
+	// RetryAfter is advertised in the Retry-After header when the token issuer is unavailable (30 seconds by default).
+	RetryAfter time.Duration `yaml:"retryAfter"`
+
+	// RateLimitedResponse controls the body of 429 responses to rate limited requests:
+	// "plain" (default) responds with plain text, "json" responds with a JSON body including retry hints (retry_after in seconds).
+	RateLimitedResponse string `yaml:"rateLimitedResponse"`
+
+	// ResponseFields renames fields of token responses (eg. access_token: jwt) for registries expecting a non-standard envelope.
+	ResponseFields map[string]string `yaml:"responseFields"`
+
+	// StrippedAttributes lists subject attributes (eg. userPassword) that are removed before tokens are issued,
+	// so that they never end up in a token.
+	StrippedAttributes []string `yaml:"strippedAttributes"`
+
+	// RejectEmptyPassword rejects basic auth credentials and password grants with an empty password instead of passing them to the authenticator.
+	RejectEmptyPassword bool `yaml:"rejectEmptyPassword"`
+
+	DPoP DPoP `yaml:"dpop"`
+
+	// ExternalURL is the URL clients reach the server at (eg. https://auth.example.com behind a TLS terminating proxy).
+	// DPoP proofs are verified against it. Defaults to the scheme of the connection and the Host header of requests.
+	ExternalURL string `yaml:"externalURL"`
+
+	// BatchTokens enables the batch token endpoint issuing multiple access tokens in a single request.
+	BatchTokens bool `yaml:"batchTokens"`
+
+	Permissions Permissions `yaml:"permissions"`
+
+	ErrorPages ErrorPages `yaml:"errorPages"`
+
+	ScheduledTokens ScheduledTokens `yaml:"scheduledTokens"`
+
+	// EmptyScope controls authenticated requests without any scope (eg. docker login):
+	// "issue" (default) issues a token without any access, "authorize" passes them to the authorizer like any other request.
+	EmptyScope string `yaml:"emptyScope"`
+
+	// AnonymousAccess controls requests without credentials:
+	// "authorize" (default) lets the authorizer decide what anonymous subjects may do (eg. pull public repositories),
+	// "deny" rejects them without consulting the authorizer.
+	AnonymousAccess string `yaml:"anonymousAccess"`
+
+	// ScopeWarnings lists requested scopes that were not granted in a non-standard "warnings" field of token responses.
+	ScopeWarnings bool `yaml:"scopeWarnings"`
+
+	Admin Admin `yaml:"admin"`
+
+	Introspection Introspection `yaml:"introspection"`
+
+	// MaxURLLength is the maximum accepted length of request URLs (including the query string).
+	MaxURLLength int `yaml:"maxURLLength"`
+
+	// MaxBodySize is the maximum accepted size of request bodies in bytes.
+	MaxBodySize int64 `yaml:"maxBodySize"`
+
+	// MaxHeaderBytes is the maximum accepted size of request headers in bytes.
+	// Defaults to [http.DefaultMaxHeaderBytes].
+	MaxHeaderBytes int `yaml:"maxHeaderBytes"`
+
+	UserAgents UserAgents `yaml:"userAgents"`
+
+	RateLimit RateLimit `yaml:"rateLimit"`
+}
+
+// RateLimit configures rate limiting of token endpoints (eg. against credential stuffing).
+type RateLimit struct {
+	// ClientIP limits requests by client IP address.
+	ClientIP TokenBucket `yaml:"clientIP"`
+
+	// Username limits requests by the presented username.
+	Username TokenBucket `yaml:"username"`
+
+	// Services limits requests by the requested service (keyed by the service name).
+	Services map[string]TokenBucket `yaml:"services"`
+
+	// TrustedProxy takes the client IP address from the X-Forwarded-For header.
+	// Only enable it behind a proxy setting the header.
+	TrustedProxy bool `yaml:"trustedProxy"`
+}
+
+// Enabled reports whether any limit is configured.
+func (c RateLimit) Enabled() bool {
+	for _, service := range c.Services {
+		if service.Enabled() {
+			return true
+		}
+	}
+
+	return c.ClientIP.Enabled() || c.Username.Enabled()
+}
+
+// TokenBucket configures a token bucket rate limiter.
+type TokenBucket struct {
+	// Rate is the number of requests allowed per second (zero disables the limit).
+	Rate float64 `yaml:"rate"`
+
+	// Burst is the number of requests allowed at once (defaults to 1).
+	Burst int `yaml:"burst"`
+}
+
+// Enabled reports whether the limit is configured.
+func (c TokenBucket) Enabled() bool {
+	return c.Rate > 0
+}
+
+func (c TokenBucket) newRateLimiter(deps auth.Dependencies) auth.RateLimiter {
+	if !c.Enabled() {
+		return nil
+	}
+
+	return auth.NewTokenBucketRateLimiter(c.Rate, max(1, c.Burst), deps)
+}
+
+func (c TokenBucket) validate() error {
+	if c.Rate < 0 {
+		return fmt.Errorf("rate cannot be negative")
+	}
+
+	if c.Burst < 0 {
+		return fmt.Errorf("burst cannot be negative")
+	}
+
+	return nil
+}
+
+// UserAgents restricts the clients allowed to request tokens by their User-Agent header.
+//
+// Patterns match case-insensitive substrings of the header. Rejected requests receive 403 Forbidden.
+type UserAgents struct {
+	// Allow lists the accepted user agents (eg. docker/, containerd/). If empty, every user agent not denied is accepted.
+	Allow []string `yaml:"allow"`
+
+	// Deny lists the rejected user agents (eg. python-requests). Deny takes precedence over Allow.
+	Deny []string `yaml:"deny"`
+
+	// Required rejects requests without a User-Agent header.
+	Required bool `yaml:"required"`
+}
+
+// Enabled reports whether any restriction is configured.
+func (c UserAgents) Enabled() bool {
+	return len(c.Allow) > 0 || len(c.Deny) > 0 || c.Required
+}
+
+// GetUserAgentFilter returns the configured User-Agent filter.
+func (c Server) GetUserAgentFilter() auth.UserAgentFilter {
+	return auth.UserAgentFilter{
+		Allow:            c.UserAgents.Allow,
+		Deny:             c.UserAgents.Deny,
+		RequireUserAgent: c.UserAgents.Required,
+	}
+}
+
+// GetRateLimits returns the configured rate limits.
+func (c Server) GetRateLimits(deps auth.Dependencies) auth.RateLimits {
+	limits := auth.RateLimits{
+		ClientIP:     c.RateLimit.ClientIP.newRateLimiter(deps),
+		Username:     c.RateLimit.Username.newRateLimiter(deps),
+		TrustedProxy: c.RateLimit.TrustedProxy,
+	}
+
+	for service, bucket := range c.RateLimit.Services {
+		if !bucket.Enabled() {
+			continue
+		}
+
+		if limits.Services == nil {
+			limits.Services = make(map[string]auth.RateLimiter)
+		}
+
+		limits.Services[service] = bucket.newRateLimiter(deps)
+	}
+
+	return limits
+}
+
+// GetRequestLimits returns the configured request limits.
+func (c Server) GetRequestLimits() auth.RequestLimits {
+	return auth.RequestLimits{
+		MaxURLLength: c.MaxURLLength,
+		MaxBodySize:  c.MaxBodySize,
+	}
+}
+
+// Permissions configures the endpoint listing the effective permissions of a subject.
+type Permissions struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Scopes lists the candidate scopes checked for the subject.
+	// Authorizers cannot enumerate the resources they grant access to (eg. wildcard rules),
+	// so only the scopes listed here appear in the response.
+	//
+	// Resource names may contain the {subject} placeholder (eg. repository:{subject}/app:pull,push).
+	Scopes []string `yaml:"scopes"`
+}
+
+// GetPermissionScopes returns the parsed candidate scopes of the permissions endpoint.
+func (c Server) GetPermissionScopes() auth.Scopes {
+	// Scopes are validated by Validate
+	scopes, _ := auth.ParseScopes(c.Permissions.Scopes)
+
+	return scopes
+}
+
+// ScheduledTokens allows privileged subjects to request access tokens becoming valid in the future (using the not_before parameter).
+type ScheduledTokens struct {
+	// MaxDelay is the maximum time a token may become valid in the future.
+	// Scheduled tokens are disabled by default.
+	MaxDelay time.Duration `yaml:"maxDelay"`
+
+	// SubjectAttributes are attributes a subject must have to request scheduled tokens.
+	SubjectAttributes map[string]string `yaml:"subjectAttributes"`
+}
+
+// GetScheduledTokens returns the configured scheduled token policy.
+func (c Server) GetScheduledTokens() auth.ScheduledTokens {
+	return auth.ScheduledTokens{
+		MaxDelay:          c.ScheduledTokens.MaxDelay,
+		SubjectAttributes: maps.Clone(c.ScheduledTokens.SubjectAttributes),
+	}
+}
+
+// Admin configures administrative endpoints (eg. /admin/rules dumping the authorization rules).
+type Admin struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Addr is the address of a separate listener serving administrative endpoints (eg. localhost:8081),
+	// so they are not exposed with the token endpoints.
+	// By default, administrative endpoints are served on the main listener.
+	Addr string `yaml:"addr"`
+
+	// SubjectAttributes are attributes a subject (authenticated using basic auth) must have to access administrative endpoints.
+	SubjectAttributes map[string]string `yaml:"subjectAttributes"`
+}
+
+// Introspection configures the token introspection endpoint resolving reference tokens (see the reference access token issuer).
+type Introspection struct {
+	// SubjectAttributes are attributes a caller (a registry authenticated using basic auth) must have to introspect tokens.
+	// If empty, every introspection request is rejected.
+	SubjectAttributes map[string]string `yaml:"subjectAttributes"`
+}
+
+// ErrorPages configures HTML error responses for clients accepting text/html (eg. browsers).
+type ErrorPages struct {
+	Enabled bool `yaml:"enabled"`
+
+	// HelpURL is linked from error pages.
+	HelpURL string `yaml:"helpURL"`
+}
+
+// DPoP configures support for [RFC 9449] DPoP bound access tokens.
+//
+// [RFC 9449]: https://datatracker.ietf.org/doc/html/rfc9449
+type DPoP struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Required rejects token requests without a DPoP proof.
+	Required bool `yaml:"required"`
+
+	// MaxAge is the maximum age of accepted proofs. Defaults to 5 minutes.
+	MaxAge time.Duration `yaml:"maxAge"`
+}
+
+// NewDPoPProofVerifier returns a new [auth.DPoPProofVerifier] or nil if DPoP is disabled.
+func (c Server) NewDPoPProofVerifier() auth.DPoPProofVerifier {
+	if !c.DPoP.Enabled {
+		return nil
+	}
+
+	maxAge := c.DPoP.MaxAge
+	if maxAge == 0 {
+		maxAge = 5 * time.Minute
+	}
+
+	return jwt.NewDPoPProofVerifier(maxAge)
+}
+
+// GetExternalURL returns the parsed external URL (nil if it is not configured).
+//
+// Call it after Validate.
+func (c Server) GetExternalURL() *url.URL {
+	if c.ExternalURL == "" {
+		return nil
+	}
+
+	u, _ := url.Parse(c.ExternalURL)
+
+	return u
+}
+
+// GetResourceActions returns the default resource actions merged with the configured ones.
+func (c Server) GetResourceActions() auth.ResourceActions {
+	resourceActions := maps.Clone(auth.DefaultResourceActions)
+
+	maps.Copy(resourceActions, c.ResourceActions)
+
+	return resourceActions
+}
+
+// Validate validates the configuration.
+func (c Server) Validate() error {
+	for _, pattern := range append(append([]string{}, c.UserAgents.Allow...), c.UserAgents.Deny...) {
+		if pattern == "" {
+			return fmt.Errorf("userAgents: patterns cannot be empty")
+		}
+	}
+
+	for resourceType, actions := range c.ResourceActions {
+		if len(actions) == 0 {
+			return fmt.Errorf("resourceActions: %s: at least one action is required", resourceType)
+		}
+	}
+
+	for field, name := range c.ResponseFields {
+		if name == "" {
+			return fmt.Errorf("responseFields: %s: new name is required", field)
+		}
+	}
+
+	switch c.MultipleServices {
+	case "", auth.MultipleServicesReject, auth.MultipleServicesFirst, auth.MultipleServicesMatching:
+	default:
+		return fmt.Errorf("multipleServices: unknown value %q", c.MultipleServices)
+	}
+
+	switch c.RateLimitedResponse {
+	case "", auth.RateLimitedResponsePlain, auth.RateLimitedResponseJSON:
+	default:
+		return fmt.Errorf("rateLimitedResponse: unknown value %q", c.RateLimitedResponse)
+	}
+
+	switch c.AnonymousDenial {
+	case "", auth.AnonymousDenialChallenge, auth.AnonymousDenialForbidden:
+	default:
+		return fmt.Errorf("anonymousDenial: unknown value %q", c.AnonymousDenial)
+	}
+
+	switch c.EmptyScope {
+	case "", auth.EmptyScopeIssue, auth.EmptyScopeAuthorize:
+	default:
+		return fmt.Errorf("emptyScope: unknown value %q", c.EmptyScope)
+	}
+
+	switch c.AnonymousAccess {
+	case "", auth.AnonymousAccessAuthorize, auth.AnonymousAccessDeny:
+	default:
+		return fmt.Errorf("anonymousAccess: unknown value %q", c.AnonymousAccess)
+	}
+
+	if c.Admin.Enabled && len(c.Admin.SubjectAttributes) == 0 {
+		return fmt.Errorf("admin: subjectAttributes are required")
+	}
+
+	if !c.Admin.Enabled && c.Admin.Addr != "" {
+		return fmt.Errorf("admin: addr requires admin endpoints to be enabled")
+	}
+
+	if c.ScheduledTokens.MaxDelay < 0 {
+		return fmt.Errorf("scheduledTokens: maxDelay cannot be negative")
+	}
+
+	if c.ScheduledTokens.MaxDelay > 0 && len(c.ScheduledTokens.SubjectAttributes) == 0 {
+		return fmt.Errorf("scheduledTokens: subjectAttributes are required")
+	}
+
+	if c.RetryAfter < 0 {
+		return fmt.Errorf("retryAfter cannot be negative")
+	}
+
+	if c.DPoP.MaxAge < 0 {
+		return fmt.Errorf("dpop: maxAge cannot be negative")
+	}
+
+	if c.ExternalURL != "" {
+		u, err := url.Parse(c.ExternalURL)
+		if err != nil {
+			return fmt.Errorf("externalURL: %w", err)
+		}
+
+		if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("externalURL: must be an absolute http or https URL")
+		}
+
+		if u.RawQuery != "" || u.Fragment != "" {
+			return fmt.Errorf("externalURL: cannot have a query or fragment")
+		}
+	}
+
+	if _, err := auth.ParseScopes(c.Permissions.Scopes); err != nil {
+		return fmt.Errorf("permissions: %w", err)
+	}
+
+	if c.MaxActionsPerScope < 0 {
+		return fmt.Errorf("maxActionsPerScope cannot be negative")
+	}
+
+	if c.MaxScopes < 0 {
+		return fmt.Errorf("maxScopes cannot be negative")
+	}
+
+	if c.MaxAudiences < 0 {
+		return fmt.Errorf("maxAudiences cannot be negative")
+	}
+
+	if c.MaxBatchEntries < 0 {
+		return fmt.Errorf("maxBatchEntries cannot be negative")
+	}
+
+	if c.MaxURLLength < 0 {
+		return fmt.Errorf("maxURLLength cannot be negative")
+	}
+
+	if c.MaxBodySize < 0 {
+		return fmt.Errorf("maxBodySize cannot be negative")
+	}
+
+	if c.MaxHeaderBytes < 0 {
+		return fmt.Errorf("maxHeaderBytes cannot be negative")
+	}
+
+	if err := c.RateLimit.ClientIP.validate(); err != nil {
+		return fmt.Errorf("rateLimit: clientIP: %w", err)
+	}
+
+	if err := c.RateLimit.Username.validate(); err != nil {
+		return fmt.Errorf("rateLimit: username: %w", err)
+	}
+
+	for service, bucket := range c.RateLimit.Services {
+		if err := bucket.validate(); err != nil {
+			return fmt.Errorf("rateLimit: services: %s: %w", service, err)
+		}
+	}
+
+	return nil
+}
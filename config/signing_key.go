@@ -0,0 +1,64 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/docker/libtrust"
+
+	"github.com/sagikazarmark/registry-auth/auth/token/jwt"
+)
+
+// loadPrivateKey loads a PEM encoded signing key either from a file or from an inline PEM string.
+//
+// Inline keys can be read from the environment using a variable reference (eg. privateKey: ${REGISTRY_AUTH_SIGNING_KEY}).
+// See [jwt.ParsePrivateKeyPEM] for the supported encodings.
+func loadPrivateKey(privateKeyFile string, privateKey string) (libtrust.PrivateKey, error) {
+	if privateKey != "" {
+		key, err := jwt.ParsePrivateKeyPEM([]byte(privateKey))
+		if err != nil {
+			return nil, fmt.Errorf("parsing privateKey: %w", err)
+		}
+
+		return key, nil
+	}
+
+	key, err := jwt.LoadPrivateKeyFile(privateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading signing key %s: %w", privateKeyFile, err)
+	}
+
+	return key, nil
+}
+
+// privateKeyName describes the source of a signing key in error messages.
+func privateKeyName(privateKeyFile string, privateKey string) string {
+	if privateKey != "" {
+		return "privateKey"
+	}
+
+	return privateKeyFile
+}
+
+// validatePrivateKey checks that exactly one key source is configured,
+// then loads the key eagerly and checks that it can sign tokens using alg (detected from the key if empty).
+func validatePrivateKey(privateKeyFile string, privateKey string, alg string) error {
+	if privateKeyFile == "" && privateKey == "" {
+		return errors.New("either privateKeyFile or privateKey is required")
+	}
+
+	if privateKeyFile != "" && privateKey != "" {
+		return errors.New("privateKeyFile and privateKey are mutually exclusive")
+	}
+
+	key, err := loadPrivateKey(privateKeyFile, privateKey)
+	if err != nil {
+		return err
+	}
+
+	if err := jwt.CheckSigningKey(key, alg); err != nil {
+		return fmt.Errorf("checking signing key %s: %w", privateKeyName(privateKeyFile, privateKey), err)
+	}
+
+	return nil
+}
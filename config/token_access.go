@@ -9,6 +9,8 @@ import (
 
 	"github.com/sagikazarmark/registry-auth/auth"
 	"github.com/sagikazarmark/registry-auth/auth/token/jwt"
+	"github.com/sagikazarmark/registry-auth/auth/token/reference"
+	"github.com/sagikazarmark/registry-auth/pkg/slices"
 )
 
 // AccessTokenIssuerFactory creates a new [auth.AccessTokenIssuer].
@@ -28,6 +30,7 @@ func RegisterAccessTokenIssuerFactory(name string, factory func() AccessTokenIss
 
 func init() {
 	RegisterAccessTokenIssuerFactory("jwt", func() AccessTokenIssuerFactory { return jwtAccessTokenIssuer{} })
+	RegisterAccessTokenIssuerFactory("reference", func() AccessTokenIssuerFactory { return referenceAccessTokenIssuer{} })
 }
 
 // AccessTokenIssuer is the configuration for an auth.AccessTokenIssuer.
@@ -64,18 +67,334 @@ func (c *AccessTokenIssuer) UnmarshalYAML(value *yaml.Node) error {
 }
 
 type jwtAccessTokenIssuer struct {
-	Issuer         string        `mapstructure:"issuer"`
-	PrivateKeyFile string        `mapstructure:"privateKeyFile"`
-	Expiration     time.Duration `mapstructure:"expiration"`
+	Issuer               string `mapstructure:"issuer"`
+	PrivateKeyFile       string `mapstructure:"privateKeyFile"`
+	CertificateChainFile string `mapstructure:"certificateChainFile"`
+
+	// Expiration is the lifetime of access tokens (5 minutes by default).
+	Expiration time.Duration `mapstructure:"expiration"`
+
+	// Leeway tolerates clock skew between the issuer and registries: tokens become valid leeway before their time of issuance.
+	Leeway time.Duration `mapstructure:"leeway"`
+
+	// PrivateKey is an inline PEM encoded signing key (alternative to PrivateKeyFile).
+	// It can be read from the environment using a variable reference (eg. ${REGISTRY_AUTH_SIGNING_KEY}).
+	PrivateKey string `mapstructure:"privateKey"`
+
+	// AuthenticationMethods includes the method the subject authenticated with in the "amr" claim (if RFC 8176 registers a value for it).
+	AuthenticationMethods bool `mapstructure:"authenticationMethods"`
+
+	// AuthTime includes the time the subject originally authenticated at in the "auth_time" claim.
+	AuthTime bool `mapstructure:"authTime"`
+
+	// ScopeClaim includes the granted access in a space-delimited "scope" claim in addition to the "access" claim.
+	ScopeClaim bool `mapstructure:"scopeClaim"`
+
+	// ScopeHashClaim includes a hash of the granted access in a "scope_hash" claim, binding tokens to the exact granted scope.
+	ScopeHashClaim bool `mapstructure:"scopeHashClaim"`
+
+	// TenantAudienceAttribute adds the value of a subject attribute (eg. tenant) to the "aud" claim next to the service.
+	// The attribute must not be listed in strippedAttributes.
+	TenantAudienceAttribute string `mapstructure:"tenantAudienceAttribute"`
+
+	// SigningKeys signs tokens with a key randomly selected by weight instead of always using PrivateKeyFile.
+	SigningKeys []weightedSigningKey `mapstructure:"signingKeys"`
+
+	// Keys configures signing key rotation instead of PrivateKeyFile:
+	// the primary key signs tokens, retired keys are only published (see the JWKS endpoint) for verifying tokens signed before the rotation.
+	// Tokens identify their signing key by ID in the kid header.
+	Keys []signingKey `mapstructure:"keys"`
+
+	// KeyIDs controls how keys are identified in the kid header of tokens and in the published key set:
+	// "libtrust" (default) derives IDs from keys the way libtrust does, "thumbprint" uses their RFC 7638 JWK thumbprint.
+	// IDs configured in Keys take precedence (they are optional when using thumbprints).
+	KeyIDs string `mapstructure:"keyIDs"`
+
+	// Algorithm is the signing algorithm (eg. RS256, ES256 or EdDSA).
+	// Defaults to RS256 for RSA keys, ES256 for EC keys and EdDSA for Ed25519 keys.
+	Algorithm string `mapstructure:"algorithm"`
+
+	// Services overrides the signing key and algorithm for specific services (selected by the requested service).
+	// Other settings (eg. issuer and expiration) are shared.
+	Services map[string]jwtServiceSigning `mapstructure:"services"`
+
+	// ExpirationPolicies shortens the lifetime of tokens granting access to matching resources.
+	ExpirationPolicies []expirationPolicy `mapstructure:"expirationPolicies"`
+
+	// MaxSize limits the size of issued tokens in bytes (optional).
+	// Tokens granting access to lots of repositories may exceed the header size limits of registries or proxies.
+	MaxSize int `mapstructure:"maxSize"`
+
+	// Oversized controls what happens when a token exceeds MaxSize:
+	// "error" (default) rejects the request asking the client to request fewer scopes,
+	// "reference" issues a reference token (resolved by registries using token introspection) instead.
+	Oversized string `mapstructure:"oversized"`
+}
+
+// defaultAccessTokenExpiration is the lifetime of access tokens if not configured otherwise.
+const defaultAccessTokenExpiration = 5 * time.Minute
+
+const (
+	oversizedError     = "error"
+	oversizedReference = "reference"
+)
+
+const (
+	keyIDsLibtrust   = "libtrust"
+	keyIDsThumbprint = "thumbprint"
+)
+
+type expirationPolicy struct {
+	ResourceType string        `mapstructure:"resourceType"`
+	Resource     string        `mapstructure:"resource"`
+	Expiration   time.Duration `mapstructure:"expiration"`
+}
+
+type jwtServiceSigning struct {
+	PrivateKeyFile       string `mapstructure:"privateKeyFile"`
+	PrivateKey           string `mapstructure:"privateKey"`
+	CertificateChainFile string `mapstructure:"certificateChainFile"`
+	Algorithm            string `mapstructure:"algorithm"`
+}
+
+type signingKey struct {
+	ID             string `mapstructure:"id"`
+	PrivateKeyFile string `mapstructure:"privateKeyFile"`
+	Primary        bool   `mapstructure:"primary"`
+
+	// PrivateKey is an inline PEM encoded key (alternative to PrivateKeyFile).
+	PrivateKey string `mapstructure:"privateKey"`
+
+	// RetiredUntil ends the grace period of a retired key (optional, retired keys are published indefinitely by default).
+	RetiredUntil time.Time `mapstructure:"retiredUntil"`
+}
+
+type weightedSigningKey struct {
+	PrivateKeyFile string `mapstructure:"privateKeyFile"`
+	Weight         int    `mapstructure:"weight"`
+
+	// PrivateKey is an inline PEM encoded key (alternative to PrivateKeyFile).
+	PrivateKey string `mapstructure:"privateKey"`
 }
 
 func (c jwtAccessTokenIssuer) New() (auth.AccessTokenIssuer, error) {
-	signingKey, err := libtrust.LoadKeyFile(c.PrivateKeyFile)
+	issuer, err := c.newIssuer()
 	if err != nil {
 		return nil, err
 	}
 
-	return jwt.NewAccessTokenIssuer(c.Issuer, signingKey, c.Expiration), nil
+	if c.MaxSize <= 0 {
+		return issuer, nil
+	}
+
+	sizeLimitedIssuer := auth.SizeLimitedAccessTokenIssuer{
+		Issuer:  issuer,
+		MaxSize: c.MaxSize,
+	}
+
+	if c.Oversized == oversizedReference {
+		sizeLimitedIssuer.Fallback = reference.NewAccessTokenIssuer(c.expiration())
+	}
+
+	return sizeLimitedIssuer, nil
+}
+
+func (c jwtAccessTokenIssuer) newIssuer() (auth.AccessTokenIssuer, error) {
+	signingKey, opts, err := c.loadSigningKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	sharedOpts := c.sharedOptions()
+
+	opts = append(opts, sharedOpts...)
+
+	if len(c.SigningKeys) > 0 {
+		keys := make([]jwt.WeightedSigningKey, 0, len(c.SigningKeys))
+
+		for i, key := range c.SigningKeys {
+			signingKey, err := loadPrivateKey(key.PrivateKeyFile, key.PrivateKey)
+			if err != nil {
+				return nil, fmt.Errorf("signingKeys[%d]: %w", i, err)
+			}
+
+			err = jwt.CheckSigningKey(signingKey, c.Algorithm)
+			if err != nil {
+				return nil, fmt.Errorf("signingKeys[%d]: checking signing key %s: %w", i, privateKeyName(key.PrivateKeyFile, key.PrivateKey), err)
+			}
+
+			keys = append(keys, jwt.WeightedSigningKey{
+				Key:    signingKey,
+				Weight: key.Weight,
+			})
+		}
+
+		opts = append(opts, jwt.WithWeightedSigningKeys(keys...))
+	}
+
+	defaultIssuer := jwt.NewAccessTokenIssuer(c.Issuer, signingKey, c.expiration(), opts...)
+
+	if len(c.Services) == 0 {
+		return defaultIssuer, nil
+	}
+
+	issuers := make(map[string]auth.AccessTokenIssuer, len(c.Services))
+
+	for service, signing := range c.Services {
+		signingKey, opts, err := loadSigning(signing.PrivateKeyFile, signing.PrivateKey, signing.CertificateChainFile, signing.Algorithm)
+		if err != nil {
+			return nil, fmt.Errorf("services: %s: %w", service, err)
+		}
+
+		opts = append(opts, sharedOpts...)
+
+		issuers[service] = jwt.NewAccessTokenIssuer(c.Issuer, signingKey, c.expiration(), opts...)
+	}
+
+	return auth.ServiceAccessTokenIssuer{
+		Issuers: issuers,
+		Default: defaultIssuer,
+	}, nil
+}
+
+// loadSigningKeys loads the primary signing key either from PrivateKeyFile or Keys (along with the retired keys).
+func (c jwtAccessTokenIssuer) loadSigningKeys() (libtrust.PrivateKey, []jwt.AccessTokenIssuerOption, error) {
+	if len(c.Keys) == 0 {
+		return loadSigning(c.PrivateKeyFile, c.PrivateKey, c.CertificateChainFile, c.Algorithm)
+	}
+
+	var (
+		primaryKey  libtrust.PrivateKey
+		opts        []jwt.AccessTokenIssuerOption
+		retiredKeys []jwt.RetiredKey
+	)
+
+	for _, key := range c.Keys {
+		name := key.ID
+		if name == "" {
+			name = privateKeyName(key.PrivateKeyFile, key.PrivateKey)
+		}
+
+		if key.Primary {
+			signingKey, signingOpts, err := loadSigning(key.PrivateKeyFile, key.PrivateKey, c.CertificateChainFile, c.Algorithm)
+			if err != nil {
+				return nil, nil, fmt.Errorf("keys: %s: %w", name, err)
+			}
+
+			primaryKey = signingKey
+			opts = append(signingOpts, jwt.WithKeyID(key.ID))
+
+			continue
+		}
+
+		retiredKey, err := loadPrivateKey(key.PrivateKeyFile, key.PrivateKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("keys: %s: %w", name, err)
+		}
+
+		retiredKeys = append(retiredKeys, jwt.RetiredKey{
+			ID:       key.ID,
+			Key:      retiredKey.PublicKey(),
+			NotAfter: key.RetiredUntil,
+		})
+	}
+
+	if len(retiredKeys) > 0 {
+		opts = append(opts, jwt.WithRetiredKeys(retiredKeys...))
+	}
+
+	return primaryKey, opts, nil
+}
+
+// expiration returns the lifetime of access tokens (defaults to defaultAccessTokenExpiration).
+func (c jwtAccessTokenIssuer) expiration() time.Duration {
+	if c.Expiration == 0 {
+		return defaultAccessTokenExpiration
+	}
+
+	return c.Expiration
+}
+
+// sharedOptions returns the options shared by all issuers (including per-service ones).
+func (c jwtAccessTokenIssuer) sharedOptions() []jwt.AccessTokenIssuerOption {
+	var opts []jwt.AccessTokenIssuerOption
+
+	if c.Leeway > 0 {
+		opts = append(opts, jwt.WithLeeway(c.Leeway))
+	}
+
+	if c.AuthenticationMethods {
+		opts = append(opts, jwt.WithAuthenticationMethods())
+	}
+
+	if c.AuthTime {
+		opts = append(opts, jwt.WithAuthTime())
+	}
+
+	if c.ScopeClaim {
+		opts = append(opts, jwt.WithScopeClaim())
+	}
+
+	if c.ScopeHashClaim {
+		opts = append(opts, jwt.WithScopeHashClaim())
+	}
+
+	if c.TenantAudienceAttribute != "" {
+		opts = append(opts, jwt.WithTenantAudience(c.TenantAudienceAttribute))
+	}
+
+	if c.KeyIDs == keyIDsThumbprint {
+		opts = append(opts, jwt.WithThumbprintKeyIDs())
+	}
+
+	if len(c.ExpirationPolicies) > 0 {
+		policies := slices.Map(c.ExpirationPolicies, func(v expirationPolicy) jwt.ExpirationPolicy {
+			return jwt.ExpirationPolicy{
+				Type:       v.ResourceType,
+				Name:       v.Resource,
+				Expiration: v.Expiration,
+			}
+		})
+
+		opts = append(opts, jwt.WithExpirationPolicies(policies...))
+	}
+
+	return opts
+}
+
+// loadSigning loads a signing key (and optionally its certificate chain) and returns the corresponding issuer options.
+func loadSigning(privateKeyFile string, privateKey string, certificateChainFile string, alg string) (libtrust.PrivateKey, []jwt.AccessTokenIssuerOption, error) {
+	signingKey, err := loadPrivateKey(privateKeyFile, privateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var opts []jwt.AccessTokenIssuerOption
+
+	if certificateChainFile != "" {
+		chain, err := jwt.LoadCertificateChain(certificateChainFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("loading certificate chain: %w", err)
+		}
+
+		err = jwt.VerifyCertificateChain(signingKey, chain)
+		if err != nil {
+			return nil, nil, fmt.Errorf("verifying certificate chain: %w", err)
+		}
+
+		opts = append(opts, jwt.WithCertificateChain(chain))
+	}
+
+	err = jwt.CheckSigningKey(signingKey, alg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("checking signing key %s: %w", privateKeyName(privateKeyFile, privateKey), err)
+	}
+
+	if alg != "" {
+		opts = append(opts, jwt.WithSigningAlgorithm(alg))
+	}
+
+	return signingKey, opts, nil
 }
 
 func (c jwtAccessTokenIssuer) Validate() error {
@@ -83,12 +402,168 @@ func (c jwtAccessTokenIssuer) Validate() error {
 		return fmt.Errorf("jwt: issuer is required")
 	}
 
-	if c.PrivateKeyFile == "" {
-		return fmt.Errorf("jwt: privateKeyFile is required")
+	switch c.KeyIDs {
+	case "", keyIDsLibtrust, keyIDsThumbprint:
+
+	default:
+		return fmt.Errorf("jwt: keyIDs: unsupported value %q (must be %q or %q)", c.KeyIDs, keyIDsLibtrust, keyIDsThumbprint)
 	}
 
-	if c.Expiration == 0 {
-		return fmt.Errorf("jwt: expiration is required")
+	if len(c.Keys) > 0 {
+		if err := c.validateKeys(); err != nil {
+			return err
+		}
+	} else if err := validatePrivateKey(c.PrivateKeyFile, c.PrivateKey, c.Algorithm); err != nil {
+		return fmt.Errorf("jwt: %w", err)
+	}
+
+	if c.Expiration < 0 {
+		return fmt.Errorf("jwt: expiration cannot be negative")
+	}
+
+	if c.Leeway < 0 {
+		return fmt.Errorf("jwt: leeway cannot be negative")
+	}
+
+	var totalWeight int
+
+	for i, key := range c.SigningKeys {
+		if err := validatePrivateKey(key.PrivateKeyFile, key.PrivateKey, c.Algorithm); err != nil {
+			return fmt.Errorf("jwt: signingKeys[%d]: %w", i, err)
+		}
+
+		if key.Weight < 0 {
+			return fmt.Errorf("jwt: signingKeys[%d]: weight cannot be negative", i)
+		}
+
+		totalWeight += key.Weight
+	}
+
+	if len(c.SigningKeys) > 0 && totalWeight == 0 {
+		return fmt.Errorf("jwt: at least one signing key must have a positive weight")
+	}
+
+	for i, policy := range c.ExpirationPolicies {
+		if policy.Resource == "" {
+			return fmt.Errorf("jwt: expirationPolicies[%d]: resource is required", i)
+		}
+
+		if policy.Expiration <= 0 {
+			return fmt.Errorf("jwt: expirationPolicies[%d]: expiration must be positive", i)
+		}
+	}
+
+	for service, signing := range c.Services {
+		if err := validatePrivateKey(signing.PrivateKeyFile, signing.PrivateKey, signing.Algorithm); err != nil {
+			return fmt.Errorf("jwt: services: %s: %w", service, err)
+		}
+	}
+
+	if c.MaxSize < 0 {
+		return fmt.Errorf("jwt: maxSize cannot be negative")
+	}
+
+	switch c.Oversized {
+	case "", oversizedError:
+
+	case oversizedReference:
+		if c.MaxSize == 0 {
+			return fmt.Errorf("jwt: oversized: maxSize is required")
+		}
+
+	default:
+		return fmt.Errorf("jwt: oversized: unsupported value %q (must be %q or %q)", c.Oversized, oversizedError, oversizedReference)
+	}
+
+	return nil
+}
+
+func (c jwtAccessTokenIssuer) validateKeys() error {
+	if c.PrivateKeyFile != "" {
+		return fmt.Errorf("jwt: keys and privateKeyFile are mutually exclusive")
+	}
+
+	if c.PrivateKey != "" {
+		return fmt.Errorf("jwt: keys and privateKey are mutually exclusive")
+	}
+
+	if len(c.SigningKeys) > 0 {
+		return fmt.Errorf("jwt: keys and signingKeys are mutually exclusive")
+	}
+
+	var primaryKeys int
+
+	ids := make(map[string]bool, len(c.Keys))
+
+	for i, key := range c.Keys {
+		// Keys are identified by their thumbprint unless configured otherwise
+		if key.ID == "" && c.KeyIDs != keyIDsThumbprint {
+			return fmt.Errorf("jwt: keys[%d]: id is required", i)
+		}
+
+		if key.ID != "" && ids[key.ID] {
+			return fmt.Errorf("jwt: keys[%d]: duplicate id %q", i, key.ID)
+		}
+
+		ids[key.ID] = true
+
+		// Retired keys only verify tokens signed before the rotation: they are not checked against the configured algorithm
+		alg := ""
+		if key.Primary {
+			alg = c.Algorithm
+		}
+
+		if err := validatePrivateKey(key.PrivateKeyFile, key.PrivateKey, alg); err != nil {
+			return fmt.Errorf("jwt: keys[%d]: %w", i, err)
+		}
+
+		if key.Primary {
+			primaryKeys++
+
+			if !key.RetiredUntil.IsZero() {
+				return fmt.Errorf("jwt: keys[%d]: the primary key cannot be retired", i)
+			}
+		}
+	}
+
+	if primaryKeys != 1 {
+		return fmt.Errorf("jwt: keys: exactly one key must be primary (got %d)", primaryKeys)
+	}
+
+	return nil
+}
+
+// referenceAccessTokenIssuer issues opaque reference tokens resolved by registries using token introspection.
+type referenceAccessTokenIssuer struct {
+	Expiration time.Duration `mapstructure:"expiration"`
+
+	// MaxEntries limits the number of reference tokens kept in memory at the same time (100000 by default).
+	MaxEntries int `mapstructure:"maxEntries"`
+
+	// MaxEntriesPerSubject limits the number of reference tokens kept for a single subject at the same time (1000 by default).
+	// Anonymous clients share a single limit.
+	MaxEntriesPerSubject int `mapstructure:"maxEntriesPerSubject"`
+}
+
+func (c referenceAccessTokenIssuer) New() (auth.AccessTokenIssuer, error) {
+	return reference.NewAccessTokenIssuer(
+		c.Expiration,
+		reference.WithMaxEntries(c.MaxEntries),
+		reference.WithMaxEntriesPerSubject(c.MaxEntriesPerSubject),
+	), nil
+}
+
+func (c referenceAccessTokenIssuer) Validate() error {
+	if c.Expiration <= 0 {
+		return fmt.Errorf("reference: expiration is required")
+	}
+
+	if c.MaxEntries < 0 {
+		return fmt.Errorf("reference: maxEntries cannot be negative")
+	}
+
+	if c.MaxEntriesPerSubject < 0 {
+		return fmt.Errorf("reference: maxEntriesPerSubject cannot be negative")
 	}
 
 	return nil
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sagikazarmark/registry-auth/auth"
+)
+
+// AnonymousTokenCache configures pre-issuing and caching anonymous pull tokens for frequently accessed public repositories.
+type AnonymousTokenCache struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Services lists the services tokens are cached for.
+	Services []string `yaml:"services"`
+
+	// Repositories lists the hot repositories.
+	Repositories []string `yaml:"repositories"`
+
+	// RefreshBefore is how long before expiry a cached token is replaced (defaults to 30s).
+	// It should leave clients enough time to use the token.
+	RefreshBefore time.Duration `yaml:"refreshBefore"`
+}
+
+// Validate validates the configuration.
+func (c AnonymousTokenCache) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if len(c.Services) == 0 {
+		return errors.New("services are required")
+	}
+
+	if len(c.Repositories) == 0 {
+		return errors.New("repositories are required")
+	}
+
+	for i, repository := range c.Repositories {
+		if repository == "" {
+			return fmt.Errorf("repositories[%d]: repository name cannot be empty", i)
+		}
+	}
+
+	if c.RefreshBefore < 0 {
+		return errors.New("refreshBefore cannot be negative")
+	}
+
+	return nil
+}
+
+// New returns a new [auth.AnonymousAccessTokenCache] in front of issuer.
+func (c AnonymousTokenCache) New(issuer auth.AccessTokenIssuer, deps auth.Dependencies) *auth.AnonymousAccessTokenCache {
+	return auth.NewAnonymousAccessTokenCache(issuer, c.Services, c.Repositories, c.RefreshBefore, deps)
+}
@@ -1,12 +1,16 @@
 package config
 
 import (
+	"database/sql"
 	"fmt"
+	"regexp"
+	"time"
 
-	"github.com/docker/libtrust"
 	"gopkg.in/yaml.v3"
 
 	"github.com/sagikazarmark/registry-auth/auth"
+	"github.com/sagikazarmark/registry-auth/auth/authn"
+	"github.com/sagikazarmark/registry-auth/auth/revocation"
 	"github.com/sagikazarmark/registry-auth/auth/token/jwt"
 )
 
@@ -27,6 +31,7 @@ func RegisterRefreshTokenIssuerFactory(name string, factory func() RefreshTokenI
 
 func init() {
 	RegisterRefreshTokenIssuerFactory("jwt", func() RefreshTokenIssuerFactory { return jwtRefreshTokenIssuer{} })
+	RegisterRefreshTokenIssuerFactory("store", func() RefreshTokenIssuerFactory { return storedRefreshTokenIssuer{} })
 }
 
 // RefreshTokenIssuer is the configuration for an auth.RefreshTokenIssuer.
@@ -62,18 +67,99 @@ func (c *RefreshTokenIssuer) UnmarshalYAML(value *yaml.Node) error {
 	return nil
 }
 
+// RefreshToken configures how refresh tokens are authenticated.
+type RefreshToken struct {
+	// MaxLifetime is the absolute lifetime of a chain of refresh tokens, measured from the original authentication.
+	// Once it passes, refresh tokens are rejected even if they have not expired yet.
+	// Zero means no limit.
+	MaxLifetime time.Duration `yaml:"maxLifetime"`
+}
+
+// AuthenticatorOptions returns options for [authn.NewRefreshTokenAuthenticator].
+func (c RefreshToken) AuthenticatorOptions() []authn.RefreshTokenAuthenticatorOption {
+	var opts []authn.RefreshTokenAuthenticatorOption
+
+	if c.MaxLifetime > 0 {
+		opts = append(opts, authn.WithMaxLifetime(c.MaxLifetime))
+	}
+
+	return opts
+}
+
+// Validate validates the configuration.
+func (c RefreshToken) Validate() error {
+	if c.MaxLifetime < 0 {
+		return fmt.Errorf("maxLifetime cannot be negative")
+	}
+
+	return nil
+}
+
+// defaultRefreshTokenExpiration is the lifetime of refresh tokens if not configured otherwise.
+const defaultRefreshTokenExpiration = 30 * 24 * time.Hour
+
+// refreshTokenExpiration returns the lifetime of refresh tokens (defaults to defaultRefreshTokenExpiration).
+func refreshTokenExpiration(expiration time.Duration) time.Duration {
+	if expiration == 0 {
+		return defaultRefreshTokenExpiration
+	}
+
+	return expiration
+}
+
 type jwtRefreshTokenIssuer struct {
 	Issuer         string `mapstructure:"issuer"`
 	PrivateKeyFile string `mapstructure:"privateKeyFile"`
+
+	// Expiration is the lifetime of refresh tokens (30 days by default).
+	Expiration time.Duration `mapstructure:"expiration"`
+
+	// Leeway tolerates clock skew when verifying the validity period of refresh tokens.
+	Leeway time.Duration `mapstructure:"leeway"`
+
+	// PrivateKey is an inline PEM encoded signing key (alternative to PrivateKeyFile).
+	// It can be read from the environment using a variable reference (eg. ${REGISTRY_AUTH_SIGNING_KEY}).
+	PrivateKey string `mapstructure:"privateKey"`
+
+	// MaxSessions caps the number of concurrent sessions (refresh token families) per subject (optional).
+	// A new login exceeding the cap revokes the oldest session of the subject.
+	// Sessions are kept in memory, revoked sessions are persisted if RevocationSnapshotFile is set.
+	MaxSessions int `mapstructure:"maxSessions"`
+
+	// RevocationSnapshotFile persists revoked sessions, so that they survive restarts (optional).
+	RevocationSnapshotFile string `mapstructure:"revocationSnapshotFile"`
+
+	// RevocationSnapshotInterval is the interval revoked sessions are persisted at (defaults to 1 minute).
+	RevocationSnapshotInterval time.Duration `mapstructure:"revocationSnapshotInterval"`
 }
 
 func (c jwtRefreshTokenIssuer) New() (auth.RefreshTokenIssuer, error) {
-	signingKey, err := libtrust.LoadKeyFile(c.PrivateKeyFile)
+	signingKey, err := loadPrivateKey(c.PrivateKeyFile, c.PrivateKey)
 	if err != nil {
 		return nil, err
 	}
 
-	return jwt.NewRefreshTokenIssuer(c.Issuer, signingKey), nil
+	err = jwt.CheckSigningKey(signingKey, "")
+	if err != nil {
+		return nil, fmt.Errorf("checking signing key %s: %w", privateKeyName(c.PrivateKeyFile, c.PrivateKey), err)
+	}
+
+	opts := []jwt.RefreshTokenIssuerOption{jwt.WithRefreshTokenExpiration(refreshTokenExpiration(c.Expiration))}
+
+	if c.Leeway > 0 {
+		opts = append(opts, jwt.WithLeeway(c.Leeway))
+	}
+
+	if c.MaxSessions > 0 {
+		store, err := revocation.NewMemoryStore(c.RevocationSnapshotFile, revocation.WithSnapshotInterval(c.RevocationSnapshotInterval))
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, jwt.WithSessionLimiter(revocation.NewSessionLimiter(store, c.MaxSessions)))
+	}
+
+	return jwt.NewRefreshTokenIssuer(c.Issuer, signingKey, opts...), nil
 }
 
 func (c jwtRefreshTokenIssuer) Validate() error {
@@ -81,8 +167,124 @@ func (c jwtRefreshTokenIssuer) Validate() error {
 		return fmt.Errorf("jwt: issuer is required")
 	}
 
-	if c.PrivateKeyFile == "" {
-		return fmt.Errorf("jwt: privateKeyFile is required")
+	if err := validatePrivateKey(c.PrivateKeyFile, c.PrivateKey, ""); err != nil {
+		return fmt.Errorf("jwt: %w", err)
+	}
+
+	if c.Expiration < 0 {
+		return fmt.Errorf("jwt: expiration cannot be negative")
+	}
+
+	if c.Leeway < 0 {
+		return fmt.Errorf("jwt: leeway cannot be negative")
+	}
+
+	if c.MaxSessions < 0 {
+		return fmt.Errorf("jwt: maxSessions cannot be negative")
+	}
+
+	if c.RevocationSnapshotInterval < 0 {
+		return fmt.Errorf("jwt: revocationSnapshotInterval cannot be negative")
+	}
+
+	if c.RevocationSnapshotFile != "" && c.MaxSessions == 0 {
+		return fmt.Errorf("jwt: revocationSnapshotFile requires maxSessions")
+	}
+
+	return nil
+}
+
+// storedRefreshTokenIssuer issues opaque refresh tokens persisted in a store, so that they can be revoked.
+type storedRefreshTokenIssuer struct {
+	// Expiration is the lifetime of refresh tokens (30 days by default).
+	Expiration time.Duration `mapstructure:"expiration"`
+
+	// Store is either "memory" (default, tokens are lost on restart) or "sql".
+	Store string `mapstructure:"store"`
+
+	SQL sqlRefreshTokenStore `mapstructure:"sql"`
+}
+
+type sqlRefreshTokenStore struct {
+	// Driver is the name of a database/sql driver linked into the binary
+	// (the server links "pgx" for PostgreSQL and "mysql").
+	Driver string `mapstructure:"driver"`
+	DSN    string `mapstructure:"dsn"`
+
+	// Table defaults to refresh_tokens (see [authn.SQLRefreshTokenStore] for the schema).
+	Table string `mapstructure:"table"`
+
+	// Placeholder is the placeholder style of the driver: "question" (eg. MySQL) or "dollar" (eg. PostgreSQL).
+	// Defaults to "dollar" for the pgx driver and "question" otherwise.
+	Placeholder string `mapstructure:"placeholder"`
+}
+
+// placeholder returns the placeholder style of the driver (see Placeholder).
+func (c sqlRefreshTokenStore) placeholder() string {
+	if c.Placeholder == "" && c.Driver == "pgx" {
+		return authn.PlaceholderDollar
+	}
+
+	return c.Placeholder
+}
+
+const (
+	refreshTokenStoreMemory = "memory"
+	refreshTokenStoreSQL    = "sql"
+)
+
+var sqlTableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+func (c storedRefreshTokenIssuer) New() (auth.RefreshTokenIssuer, error) {
+	var store authn.RefreshTokenStore = authn.NewMemoryRefreshTokenStore()
+
+	if c.Store == refreshTokenStoreSQL {
+		db, err := sql.Open(c.SQL.Driver, c.SQL.DSN)
+		if err != nil {
+			return nil, err
+		}
+
+		store = authn.NewSQLRefreshTokenStore(db, c.SQL.Table, c.SQL.placeholder())
+	}
+
+	return authn.NewStoredRefreshTokenIssuer(store, refreshTokenExpiration(c.Expiration)), nil
+}
+
+func (c storedRefreshTokenIssuer) Validate() error {
+	if c.Expiration < 0 {
+		return fmt.Errorf("store: expiration cannot be negative")
+	}
+
+	switch c.Store {
+	case "", refreshTokenStoreMemory:
+		return nil
+
+	case refreshTokenStoreSQL:
+
+	default:
+		return fmt.Errorf("store: unsupported store %q (must be %q or %q)", c.Store, refreshTokenStoreMemory, refreshTokenStoreSQL)
+	}
+
+	if c.SQL.Driver == "" {
+		return fmt.Errorf("store: sql: driver is required")
+	}
+
+	if c.SQL.DSN == "" {
+		return fmt.Errorf("store: sql: dsn is required")
+	}
+
+	if !isSQLDriverRegistered(c.SQL.Driver) {
+		return fmt.Errorf("store: sql: unknown driver %q (forgotten import?)", c.SQL.Driver)
+	}
+
+	if c.SQL.Table != "" && !sqlTableName.MatchString(c.SQL.Table) {
+		return fmt.Errorf("store: sql: invalid table name %q", c.SQL.Table)
+	}
+
+	switch c.SQL.Placeholder {
+	case "", authn.PlaceholderQuestion, authn.PlaceholderDollar:
+	default:
+		return fmt.Errorf("store: sql: unsupported placeholder %q (must be %q or %q)", c.SQL.Placeholder, authn.PlaceholderQuestion, authn.PlaceholderDollar)
 	}
 
 	return nil
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sagikazarmark/registry-auth/auth/authn"
+)
+
+func TestRefreshTokenIssuer_DefaultExpiration(t *testing.T) {
+	testCases := []struct {
+		name               string
+		factory            RefreshTokenIssuerFactory
+		expectedExpiration time.Duration
+	}{
+		{
+			name: "JWT",
+			factory: jwtRefreshTokenIssuer{
+				Issuer:         "auth.example.com",
+				PrivateKeyFile: "../private_key.pem",
+			},
+			expectedExpiration: defaultRefreshTokenExpiration,
+		},
+		{
+			name: "JWTExpiration",
+			factory: jwtRefreshTokenIssuer{
+				Issuer:         "auth.example.com",
+				PrivateKeyFile: "../private_key.pem",
+				Expiration:     time.Hour,
+			},
+			expectedExpiration: time.Hour,
+		},
+		{
+			name:               "Store",
+			factory:            storedRefreshTokenIssuer{},
+			expectedExpiration: defaultRefreshTokenExpiration,
+		},
+		{
+			name:               "StoreExpiration",
+			factory:            storedRefreshTokenIssuer{Expiration: time.Hour},
+			expectedExpiration: time.Hour,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			require.NoError(t, testCase.factory.Validate())
+
+			issuer, err := testCase.factory.New()
+			require.NoError(t, err)
+
+			token, err := issuer.IssueRefreshToken(context.Background(), "service.example.com", authn.User{Username: "user", Enabled: true})
+			require.NoError(t, err)
+
+			assert.Equal(t, testCase.expectedExpiration, token.ExpiresIn)
+		})
+	}
+}
+
+func TestRefreshTokenIssuer_Validate_Expiration(t *testing.T) {
+	t.Run("JWT", func(t *testing.T) {
+		factory := jwtRefreshTokenIssuer{
+			Issuer:         "auth.example.com",
+			PrivateKeyFile: "../private_key.pem",
+			Expiration:     -time.Hour,
+		}
+
+		require.EqualError(t, factory.Validate(), "jwt: expiration cannot be negative")
+	})
+
+	t.Run("Store", func(t *testing.T) {
+		factory := storedRefreshTokenIssuer{Expiration: -time.Hour}
+
+		require.EqualError(t, factory.Validate(), "store: expiration cannot be negative")
+	})
+}
+
+func TestSQLRefreshTokenStore_Placeholder(t *testing.T) {
+	assert.Equal(t, authn.PlaceholderDollar, sqlRefreshTokenStore{Driver: "pgx"}.placeholder())
+	assert.Equal(t, "", sqlRefreshTokenStore{Driver: "mysql"}.placeholder())
+	assert.Equal(t, authn.PlaceholderQuestion, sqlRefreshTokenStore{Driver: "pgx", Placeholder: authn.PlaceholderQuestion}.placeholder())
+}
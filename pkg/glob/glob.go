@@ -0,0 +1,85 @@
+// Package glob matches slash separated names (eg. repository names) against glob patterns.
+package glob
+
+import "strings"
+
+// Match reports whether name matches pattern.
+//
+// Pattern syntax:
+//
+//   - "*" matches any sequence of characters except '/'
+//   - "**" matches any sequence of characters including '/'
+//   - "?" matches any single character except '/'
+//   - "\" escapes the following character, so that it matches itself (see QuoteMeta)
+//
+// Every other character matches itself.
+func Match(pattern string, name string) bool {
+	for len(pattern) > 0 {
+		switch {
+		case len(pattern) > 1 && pattern[0] == '\\':
+			pattern = pattern[1:]
+
+			if len(name) == 0 || name[0] != pattern[0] {
+				return false
+			}
+
+		case len(pattern) > 1 && pattern[0] == '*' && pattern[1] == '*':
+			rest := pattern[2:]
+
+			for i := 0; i <= len(name); i++ {
+				if Match(rest, name[i:]) {
+					return true
+				}
+			}
+
+			return false
+
+		case pattern[0] == '*':
+			rest := pattern[1:]
+
+			for i := 0; i <= len(name); i++ {
+				if Match(rest, name[i:]) {
+					return true
+				}
+
+				if i < len(name) && name[i] == '/' {
+					break
+				}
+			}
+
+			return false
+
+		case pattern[0] == '?':
+			if len(name) == 0 || name[0] == '/' {
+				return false
+			}
+
+		default:
+			if len(name) == 0 || name[0] != pattern[0] {
+				return false
+			}
+		}
+
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
+
+// QuoteMeta escapes every metacharacter in s, so that the result matches s literally.
+func QuoteMeta(s string) string {
+	var b strings.Builder
+
+	b.Grow(len(s))
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*', '?', '\\':
+			b.WriteByte('\\')
+		}
+
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
@@ -0,0 +1,60 @@
+package glob
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	testCases := []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{"team/app", "team/app", true},
+		{"team/app", "team/other", false},
+		{"team/*", "team/app", true},
+		{"team/*", "team/app/sub", false},
+		{"team/*", "team", false},
+		{"team/**", "team/app", true},
+		{"team/**", "team/app/sub", true},
+		{"team/**", "other/app", false},
+		{"**/app", "team/nested/app", true},
+		{"*", "app", true},
+		{"*", "team/app", false},
+		{"**", "team/app", true},
+		{"team/ap?", "team/app", true},
+		{"team/ap?", "team/ap/", false},
+		{"team/*-dev", "team/app-dev", true},
+		{"team/*-dev", "team/app-prod", false},
+		{`team/\*`, "team/*", true},
+		{`team/\*`, "team/app", false},
+		{`team/\?`, "team/a", false},
+		{`team/\\`, `team/\`, true},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.pattern+"_"+testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, Match(testCase.pattern, testCase.name))
+		})
+	}
+}
+
+func TestQuoteMeta(t *testing.T) {
+	testCases := []string{"user", "*", "**", "?", "a*b?c", `back\slash`}
+
+	for _, name := range testCases {
+		name := name
+
+		t.Run(name, func(t *testing.T) {
+			pattern := QuoteMeta(name)
+
+			assert.True(t, Match(pattern, name))
+			assert.False(t, Match(pattern+"/**", "other/app"))
+			assert.False(t, Match(pattern, "other"))
+		})
+	}
+}